@@ -26,6 +26,7 @@ import (
 	"os/signal"
 	"path/filepath"
 	"sync"
+	"sync/atomic"
 	"syscall"
 	"time"
 
@@ -35,6 +36,7 @@ import (
 	"go.qbee.io/agent/app/log"
 	"go.qbee.io/agent/app/metrics"
 	"go.qbee.io/agent/app/remoteaccess"
+	"go.qbee.io/agent/app/software"
 	"go.qbee.io/agent/app/utils"
 )
 
@@ -53,17 +55,39 @@ type Agent struct {
 	update     chan bool
 	stop       chan bool
 	reboot     chan bool
+	restart    chan bool
 
 	Inventory     *inventory.Service
 	Configuration *configuration.Service
 	Metrics       *metrics.Service
 	remoteAccess  *remoteaccess.Service
+	// metricsExporter exposes metrics to Prometheus - only when the agent runs as a service
+	metricsExporter *metrics.Exporter
 	// disableRemoteAccess is used to disable remote access for RunOnce
 	disableRemoteAccess bool
+
+	// runSplayPercent defines maximum random offset of scheduled runs (as percentage of the run interval)
+	runSplayPercent int
+
+	// runStarted is the Unix timestamp when the run in progress started (0 when no run is in progress)
+	runStarted atomic.Int64
+
+	// ready is used to notify systemd once the first run succeeded
+	ready sync.Once
+
+	// maxRunDuration is the duration after which a run in progress is considered hung,
+	// so the systemd watchdog is no longer notified and systemd restarts the agent.
+	maxRunDuration time.Duration
 }
 
+// defaultMaxRunDuration is the default duration after which a run in progress is considered hung.
+const defaultMaxRunDuration = 2 * time.Hour
+
 // Run the main control loop of the agent.
 func (agent *Agent) Run(ctx context.Context) error {
+	// expose metrics to Prometheus (if enabled in settings)
+	agent.metricsExporter = metrics.NewExporter(agent.Metrics)
+
 	// look for run interval changes
 	intervalChange := agent.Configuration.RunIntervalChangedNotifier()
 
@@ -76,7 +100,30 @@ func (agent *Agent) Run(ctx context.Context) error {
 	signal.Notify(updateSignalCh, syscall.SIGUSR1)
 
 	// ticker won't trigger the first run immediately, so let's do that ourselves
-	go agent.RunOnce(ctx, FullRun)
+	go func() {
+		// verify that the system is healthy after a reboot scheduled by the agent
+		if err := agent.Configuration.RunPostRebootCommand(ctx); err != nil {
+			log.Errorf("failed to run post-reboot command: %v", err)
+		}
+
+		agent.RunOnce(ctx, FullRun)
+	}()
+
+	// serve status to local health checks
+	statusListener, err := agent.serveStatus()
+	if err != nil {
+		log.Errorf("failed to start status socket: %v", err)
+	} else {
+		defer statusListener.Close()
+	}
+
+	// notify systemd watchdog (when enabled with WatchdogSec=), so a hung agent gets restarted
+	var watchdogTick <-chan time.Time
+	if interval := sdWatchdogInterval(); interval > 0 {
+		watchdogTicker := time.NewTicker(interval)
+		defer watchdogTicker.Stop()
+		watchdogTick = watchdogTicker.C
+	}
 
 	log.Infof("starting agent scheduler")
 	for {
@@ -84,19 +131,34 @@ func (agent *Agent) Run(ctx context.Context) error {
 		case <-agent.stop:
 			log.Infof("stopping the agent")
 
+			if err := sdNotify(sdNotifyStopping); err != nil {
+				log.Warnf("failed to notify systemd: %v", err)
+			}
+
 			// stop the remote access service (if running)
 			if err := agent.remoteAccess.Stop(); err != nil {
 				log.Errorf("failed to stop remote access: %s", err)
 			}
 
+			// stop the metrics exporter (if running)
+			if err := agent.metricsExporter.Stop(); err != nil {
+				log.Errorf("failed to stop metrics exporter: %s", err)
+			}
+
 			// let all the processing finish
 			agent.Wait()
 
 			// and return
 			return nil
+		case <-watchdogTick:
+			agent.notifyWatchdog()
+
 		case <-agent.reboot:
 			agent.RebootSystem(ctx)
 
+		case <-agent.restart:
+			agent.RestartAgent(ctx)
+
 		case <-stopSignalCh:
 			log.Debugf("received interrupt signal")
 
@@ -107,6 +169,9 @@ func (agent *Agent) Run(ctx context.Context) error {
 			agent.loopTicker.Reset(newInterval)
 
 		case <-agent.loopTicker.C:
+			// offset the next scheduled run, so devices don't contact the device hub in sync
+			agent.loopTicker.Reset(agent.nextScheduledRun())
+
 			go agent.RunOnce(ctx, FullRun)
 
 		case <-updateSignalCh:
@@ -147,12 +212,18 @@ func (agent *Agent) RunOnce(ctx context.Context, mode RunOnceMode) {
 		return
 	}
 
+	agent.runStarted.Store(time.Now().Unix())
+
 	defer func() {
+		agent.runStarted.Store(0)
 		agent.lock.Unlock()
 
 		if agent.Configuration.ShouldReboot() {
 			log.Warnf("reboot condition detected, scheduling system reboot")
 			agent.reboot <- true
+		} else if agent.Configuration.ShouldRestartAgent() {
+			log.Warnf("restart condition detected, restarting the agent")
+			agent.restart <- true
 		}
 
 		if err := recover(); err != nil {
@@ -171,26 +242,60 @@ func (agent *Agent) RunOnce(ctx context.Context, mode RunOnceMode) {
 	agent.Configuration.UpdateSettings(configData)
 	agent.Configuration.UpdateMetricsMonitorState(configData)
 
+	succeeded := true
+
 	if mode == FullRun {
-		agent.do(ctx, "check-in", agent.checkIn)
-		agent.do(ctx, "remote-access", agent.doRemoteAccess(configData))
-		agent.do(ctx, "config", agent.doConfig(configData))
-		agent.do(ctx, "metrics", agent.doMetrics)
-		agent.do(ctx, "inventories", agent.doInventories)
+		succeeded = agent.do(ctx, "check-in", agent.checkIn) && succeeded
+		succeeded = agent.do(ctx, "certificate", agent.checkCertificate) && succeeded
+		succeeded = agent.do(ctx, "remote-access", agent.doRemoteAccess(configData)) && succeeded
+		succeeded = agent.do(ctx, "config", agent.doConfig(configData)) && succeeded
+		succeeded = agent.do(ctx, "jobs", agent.doJobs(configData)) && succeeded
+		succeeded = agent.do(ctx, "metrics", agent.doMetrics) && succeeded
+		succeeded = agent.do(ctx, "metrics-exporter", agent.doMetricsExporter) && succeeded
+		succeeded = agent.do(ctx, "inventories", agent.doInventories) && succeeded
 	} else {
-		agent.do(ctx, "system-inventory", agent.doSystemInventory)
+		succeeded = agent.do(ctx, "system-inventory", agent.doSystemInventory)
+	}
+
+	// systemd is notified about readiness only after a successful run,
+	// so with Type=notify a failing agent doesn't start (and is restarted by systemd)
+	if !succeeded {
+		return
+	}
+
+	agent.ready.Do(func() {
+		if err := sdNotify(sdNotifyReady); err != nil {
+			log.Warnf("failed to notify systemd: %v", err)
+		}
+	})
+}
+
+// notifyWatchdog notifies systemd watchdog that the agent is alive, unless the run in progress seems to be hung.
+func (agent *Agent) notifyWatchdog() {
+	if started := agent.runStarted.Load(); started != 0 {
+		if runDuration := time.Since(time.Unix(started, 0)); runDuration > agent.maxRunDuration {
+			log.Warnf("agent run in progress for %s, not notifying systemd watchdog", runDuration.Round(time.Second))
+			return
+		}
+	}
+
+	if err := sdNotify(sdNotifyWatchdog); err != nil {
+		log.Warnf("failed to notify systemd watchdog: %v", err)
 	}
 }
 
 // do execute a named function and report on errors.
-func (agent *Agent) do(ctx context.Context, name string, fn func(ctx context.Context) error) {
+// It returns false when the function failed.
+func (agent *Agent) do(ctx context.Context, name string, fn func(ctx context.Context) error) bool {
 	log.Debugf("starting %s", name)
+	defer log.Debugf("stopping %s", name)
 
 	if err := fn(ctx); err != nil {
 		log.Errorf("failed to do %s: %v", name, err)
+		return false
 	}
 
-	log.Debugf("stopping %s", name)
+	return true
 }
 
 // doMetrics collects system metrics - if enabled - and delivers them to the device hub API.
@@ -206,6 +311,15 @@ func (agent *Agent) doMetrics(ctx context.Context) error {
 	return nil
 }
 
+// doMetricsExporter starts, reconfigures or stops the Prometheus metrics exporter based on settings.
+func (agent *Agent) doMetricsExporter(_ context.Context) error {
+	if agent.metricsExporter == nil {
+		return nil
+	}
+
+	return agent.metricsExporter.UpdateState(agent.Configuration.MetricsExporterAddress())
+}
+
 // doConfig returns a function which executes the committed configuration.
 func (agent *Agent) doConfig(configData *configuration.CommittedConfig) func(ctx context.Context) error {
 	return func(ctx context.Context) error {
@@ -216,6 +330,16 @@ func (agent *Agent) doConfig(configData *configuration.CommittedConfig) func(ctx
 	}
 }
 
+// doJobs executes a one-shot job scheduled for the device - if remote jobs are enabled.
+func (agent *Agent) doJobs(configData *configuration.CommittedConfig) func(ctx context.Context) error {
+	return func(ctx context.Context) error {
+		if err := agent.Configuration.RunJobs(ctx, configData); err != nil {
+			return fmt.Errorf("failed to run jobs: %w", err)
+		}
+		return nil
+	}
+}
+
 // doRemoteAccess maintains remote access for the agent - if enabled.
 func (agent *Agent) doRemoteAccess(cfg *configuration.CommittedConfig) func(ctx context.Context) error {
 	return func(ctx context.Context) error {
@@ -231,6 +355,10 @@ func (agent *Agent) doRemoteAccess(cfg *configuration.CommittedConfig) func(ctx
 // RebootSystem reboots the host system.
 func (agent *Agent) RebootSystem(ctx context.Context) {
 
+	if err := agent.Configuration.SavePostRebootCommand(); err != nil {
+		log.Errorf("failed to save post-reboot command: %v", err)
+	}
+
 	rebootCmd, err := utils.RebootCommand()
 
 	if err != nil {
@@ -247,6 +375,35 @@ func (agent *Agent) RebootSystem(ctx context.Context) {
 	agent.stop <- true
 }
 
+// RestartAgent restarts the agent using the service manager.
+// If the agent is not managed by a service manager, the agent process is re-executed.
+func (agent *Agent) RestartAgent(ctx context.Context) {
+	restartCmd, err := utils.GenerateServiceCommand(ctx, "qbee-agent", "restart")
+	if err == nil && restartCmd != nil {
+		var output []byte
+		if output, err = utils.RunCommand(ctx, restartCmd); err == nil {
+			log.Infof("agent restart requested: %s", output)
+			return
+		}
+	}
+
+	log.Warnf("cannot restart agent using service manager (%v), re-executing the agent", err)
+
+	if err = agent.remoteAccess.Stop(); err != nil {
+		log.Errorf("failed to stop remote access: %s", err)
+	}
+
+	var executable string
+	if executable, err = os.Executable(); err != nil {
+		log.Errorf("failed to determine agent executable: %v", err)
+		return
+	}
+
+	if err = syscall.Exec(executable, os.Args, os.Environ()); err != nil {
+		log.Errorf("failed to re-execute the agent: %v", err)
+	}
+}
+
 // Wait for the agent to finish any ongoing processing to finish.
 func (agent *Agent) Wait() {
 	agent.lock.Lock()
@@ -261,47 +418,110 @@ func (agent *Agent) IsTPMEnabled() bool {
 // NewWithoutCredentials returns a new instance of Agent without loaded credentials.
 func NewWithoutCredentials(cfg *Config) (*Agent, error) {
 	if err := prepareDirectories(cfg.Directory, cfg.StateDirectory); err != nil {
-		return nil, err
+		return nil, newStartupError("prepare agent directories", err)
 	}
 
+	return newWithoutCredentials(cfg)
+}
+
+// newWithoutCredentials returns a new instance of Agent without credentials and without preparing its directories.
+func newWithoutCredentials(cfg *Config) (*Agent, error) {
 	agent := &Agent{
-		cfg:    cfg,
-		update: make(chan bool, 1),
-		stop:   make(chan bool, 1),
-		reboot: make(chan bool, 1),
-	}
-
-	var proxy *api.Proxy
-	if cfg.ProxyServer != "" {
-		proxy = &api.Proxy{
-			Host:     cfg.ProxyServer,
-			Port:     cfg.ProxyPort,
-			User:     cfg.ProxyUser,
-			Password: cfg.ProxyPassword,
-		}
+		cfg:     cfg,
+		update:  make(chan bool, 1),
+		stop:    make(chan bool, 1),
+		reboot:  make(chan bool, 1),
+		restart: make(chan bool, 1),
+	}
 
-		if err := api.UseProxy(proxy); err != nil {
-			return nil, err
-		}
+	proxy := &api.Proxy{
+		Type:     api.ProxyType(cfg.ProxyType),
+		Host:     cfg.ProxyServer,
+		Port:     cfg.ProxyPort,
+		User:     cfg.ProxyUser,
+		Password: cfg.ProxyPassword,
+		NoProxy:  cfg.NoProxy,
+	}
+
+	if err := api.UseProxy(proxy); err != nil {
+		return nil, newStartupError("configure proxy", err)
 	}
 
 	if err := agent.loadCACertificatesPool(cfg.CACert); err != nil {
-		return nil, err
+		return nil, newStartupError("load CA certificate", err)
+	}
+
+	if err := agent.loadExtraCACertificates(cfg.ExtraCACerts); err != nil {
+		return nil, newStartupError("load extra CA certificates", err)
+	}
+
+	binding := api.LocalBinding{Address: cfg.BindAddress, Interface: cfg.BindInterface}
+	if err := binding.Validate(); err != nil {
+		return nil, newStartupError("configure local binding", err)
+	}
+
+	// network interface may not be up yet, so connections are retried with the binding during next runs
+	if err := binding.Available(); err != nil {
+		log.Warnf("local binding is not available yet, connections will fail until it is: %v", err)
 	}
 
 	agent.api = api.NewClient(cfg.DeviceHubServer, cfg.DeviceHubPort).
-		WithTLSConfig(&tls.Config{RootCAs: agent.caCertPool})
+		WithBasePath(cfg.DeviceHubBasePath).
+		WithTLSConfig(&tls.Config{RootCAs: agent.caCertPool}).
+		WithTimeouts(api.Timeouts{
+			Connect:  time.Duration(cfg.ConnectTimeout) * time.Second,
+			Request:  time.Duration(cfg.RequestTimeout) * time.Second,
+			CheckIn:  time.Duration(cfg.CheckInTimeout) * time.Second,
+			Download: time.Duration(cfg.DownloadTimeout) * time.Second,
+		}).
+		WithLocalBinding(binding)
+
+	if cfg.DNSOverHTTPS != "" {
+		resolver, err := api.NewDoHResolver(cfg.DNSOverHTTPS)
+		if err != nil {
+			return nil, newStartupError("configure DNS-over-HTTPS resolver", err)
+		}
+
+		agent.api.WithResolver(resolver.WithLocalBinding(binding))
+	}
+
+	software.SetDownloadClient(agent.api.NewDownloadClient())
 
 	appDir := filepath.Join(cfg.StateDirectory, appWorkingDirectory)
 	cacheDir := filepath.Join(appDir, cacheDirectory)
 
 	agent.Inventory = inventory.New(agent.api)
 	agent.Metrics = metrics.New(agent.api)
-	agent.Configuration = configuration.New(agent.api, appDir, cacheDir).WithURLSigner(agent).WithMetricsService(agent.Metrics)
+	agent.Configuration = configuration.New(agent.api, appDir, cacheDir).
+		WithURLSigner(agent).
+		WithMetricsService(agent.Metrics).
+		WithReportsDelivery(cfg.ReportsBatchCount, cfg.ReportsBatchSize, !cfg.DisableReportsCompression).
+		WithDownloadLimits(cfg.DownloadRateLimit, cfg.MaxConcurrentDownloads).
+		WithBundleFilter(configuration.BundleFilter{Skip: cfg.SkipBundles, Only: cfg.OnlyBundles}).
+		WithSettingsOverrides(filepath.Join(cfg.Directory, settingsOverridesFileName))
+
+	// time of the last package index update is always persisted, so the update interval survives agent restarts
+	software.SetIndexUpdateStateDirectory(filepath.Join(cacheDir, packageCacheDirectory))
+
+	if cfg.PersistPackageCache {
+		software.SetPackageCacheDirectory(filepath.Join(cacheDir, packageCacheDirectory))
+	}
+
+	if !cfg.DisableAuditLog {
+		agent.Configuration.WithAuditLog(cfg.AuditLogMaxSize, cfg.AuditLogMaxFiles)
+	}
+
+	if err := agent.loadConfigSigningKey(cfg.ConfigSigningKey); err != nil {
+		return nil, newStartupError("load config signing key", err)
+	}
+
 	agent.remoteAccess = remoteaccess.New().
+		WithLocalBinding(binding).
 		WithConfigReloadNotifier(agent.update)
 	agent.loopTicker = time.NewTicker(agent.Configuration.RunInterval())
 	agent.disableRemoteAccess = cfg.DisableRemoteAccess
+	agent.runSplayPercent = runSplayPercent(cfg)
+	agent.maxRunDuration = maxRunDuration(cfg)
 
 	return agent, nil
 }
@@ -313,15 +533,30 @@ func New(cfg *Config) (*Agent, error) {
 		return nil, err
 	}
 
+	// credentials might be left in the middle of a key rotation by a crash
+	recoverSwappedFiles(rotatedCredentialPaths(cfg.Directory))
+
 	if err = agent.loadPrivateKey(); err != nil {
-		return nil, err
+		return nil, newStartupError("load private key", err)
 	}
 
 	if err = agent.loadCertificate(); err != nil {
-		return nil, err
+		return nil, newStartupError("load device certificate", err)
 	}
 
-	tlsConfig := &tls.Config{
+	agent.Configuration.WithDeviceID(agent.deviceID())
+
+	tlsConfig := agent.clientTLSConfig()
+
+	agent.api.WithTLSConfig(tlsConfig)
+	agent.remoteAccess.WithTLSConfig(tlsConfig)
+
+	return agent, nil
+}
+
+// clientTLSConfig returns TLS configuration authenticating the agent with its private key and certificate.
+func (agent *Agent) clientTLSConfig() *tls.Config {
+	return &tls.Config{
 		RootCAs: agent.caCertPool,
 		Certificates: []tls.Certificate{
 			{
@@ -330,9 +565,4 @@ func New(cfg *Config) (*Agent, error) {
 			},
 		},
 	}
-
-	agent.api.WithTLSConfig(tlsConfig)
-	agent.remoteAccess.WithTLSConfig(tlsConfig)
-
-	return agent, nil
 }
@@ -21,6 +21,8 @@ import (
 	"fmt"
 	"net/http"
 	"runtime"
+
+	"go.qbee.io/agent/app/api"
 )
 
 // BootstrapRequest is the request sent to the device hub during device bootstrap.
@@ -95,6 +97,7 @@ type BootstrapResponse struct {
 const bootstrapAPIPath = "/v1/org/device/xauth/bootstrap"
 
 // sendBootstrapRequest sends bootstrap request to the device hub.
+// When bootstrapKey is empty, the request is authenticated with the agent's client certificate only.
 func (agent *Agent) sendBootstrapRequest(
 	ctx context.Context,
 	bootstrapKey string,
@@ -105,7 +108,9 @@ func (agent *Agent) sendBootstrapRequest(
 		return nil, fmt.Errorf("error preparing bootstrap request: %w", err)
 	}
 
-	request.Header.Set("Authorization", fmt.Sprintf("token %s", bootstrapKey))
+	if bootstrapKey != "" {
+		request.Header.Set("Authorization", fmt.Sprintf("token %s", bootstrapKey))
+	}
 
 	bootstrapResponse := new(BootstrapResponse)
 
@@ -116,9 +121,36 @@ func (agent *Agent) sendBootstrapRequest(
 	return bootstrapResponse, nil
 }
 
+// KeyRotationRequest is the request sent to the device hub to obtain a certificate for a new device key.
+type KeyRotationRequest struct {
+	// RawPublicKey of the new device key as slice of PEM-encoded lines.
+	RawPublicKey []string `json:"pub_key"`
+}
+
+// KeyRotationResponse is the response sent by the device hub for a key rotation request.
+type KeyRotationResponse struct {
+	// Certificate is the PEM-encoded certificate for the new device key.
+	Certificate []string `json:"cert"`
+}
+
+const keyRotationAPIPath = "/v1/org/device/auth/rotate-key"
+
+// sendKeyRotationRequest requests a certificate for a new device key using agent's current credentials.
+func (agent *Agent) sendKeyRotationRequest(ctx context.Context, req *KeyRotationRequest) (*KeyRotationResponse, error) {
+	keyRotationResponse := new(KeyRotationResponse)
+
+	if err := agent.api.Post(ctx, keyRotationAPIPath, req, keyRotationResponse); err != nil {
+		return nil, fmt.Errorf("error sending key rotation request: %w", err)
+	}
+
+	return keyRotationResponse, nil
+}
+
 var checkInPath = fmt.Sprintf("/v1/org/device/auth/agent/%s/checkin", runtime.GOARCH)
 
 // checkIn sends a heartbeat to the device hub and retrieves agent metadata.
 func (agent *Agent) checkIn(ctx context.Context) error {
+	ctx = api.WithRequestTimeout(ctx, agent.api.Timeouts().CheckIn)
+
 	return agent.api.Get(ctx, checkInPath, nil)
 }
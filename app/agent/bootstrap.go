@@ -18,6 +18,7 @@ package agent
 
 import (
 	"context"
+	"crypto/ecdsa"
 	"crypto/x509"
 	"encoding/pem"
 	"fmt"
@@ -35,6 +36,7 @@ import (
 const bootstrapWaitTime = 5 * time.Second
 
 // Bootstrap device using agent's config and provided bootstrap key.
+// If pre-provisioned device key and certificate are provided, they are used to authenticate instead.
 func Bootstrap(ctx context.Context, cfg *Config) error {
 
 	// make sure the custom CA certificate path is not the same as the default path
@@ -53,7 +55,12 @@ func Bootstrap(ctx context.Context, cfg *Config) error {
 		return fmt.Errorf("CA certificate pool is empty, bootstrap not possible")
 	}
 
-	if err = agent.createPrivateKey(); err != nil {
+	if cfg.DeviceKey != "" {
+		err = agent.useDeviceCredentials(cfg.DeviceKey, cfg.DeviceCert)
+	} else {
+		err = agent.createPrivateKey()
+	}
+	if err != nil {
 		return err
 	}
 
@@ -74,6 +81,9 @@ func Bootstrap(ctx context.Context, cfg *Config) error {
 			// There might be other errors that we can recover from, like network errors, clock skew, etc.
 			asErr, ok := err.(*api.Error)
 			if ok && asErr.ResponseCode == http.StatusUnauthorized {
+				if cfg.DeviceKey != "" {
+					return fmt.Errorf("device credentials are not accepted: %w", err)
+				}
 				return fmt.Errorf("bootstrap key is invalid: %w", err)
 			}
 			log.Errorf("error sending bootstrap request: %v", err)
@@ -126,8 +136,11 @@ func (agent *Agent) getRawPublicKey() ([]string, error) {
 		return nil, fmt.Errorf("agent does not have a private key set")
 	}
 
-	publicKey := &agent.privateKey.PublicKey
+	return encodeRawPublicKey(&agent.privateKey.PublicKey)
+}
 
+// encodeRawPublicKey returns a slice of PEM-encoded public key lines for provided public key.
+func encodeRawPublicKey(publicKey *ecdsa.PublicKey) ([]string, error) {
 	publicKeyDER, err := x509.MarshalPKIXPublicKey(publicKey)
 	if err != nil {
 		return nil, fmt.Errorf("error marshaling public key: %w", err)
@@ -0,0 +1,158 @@
+// Copyright 2023 qbee.io
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package agent
+
+import (
+	"context"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+
+	"golang.org/x/sys/unix"
+)
+
+// BootstrapCheck is a result of a single bootstrap pre-flight check.
+type BootstrapCheck struct {
+	// Name of the check.
+	Name string
+
+	// Err is set when the check failed.
+	Err error
+}
+
+// CheckBootstrap validates that all prerequisites of the bootstrap process are met.
+// Unlike Bootstrap, it doesn't generate keys, persist anything or send the enrollment request.
+func CheckBootstrap(ctx context.Context, cfg *Config) []BootstrapCheck {
+	checks := []BootstrapCheck{
+		{Name: "Config directory is writable", Err: checkDirectoryWritable(cfg.Directory)},
+		{Name: "State directory is writable", Err: checkDirectoryWritable(cfg.StateDirectory)},
+	}
+
+	agent, err := newWithoutCredentials(cfg)
+	if err == nil && agent.caCertPool.Equal(x509.NewCertPool()) {
+		err = fmt.Errorf("CA certificate pool is empty")
+	}
+
+	checks = append(checks, BootstrapCheck{Name: "Proxy and CA certificates are valid", Err: err})
+	if err != nil {
+		return checks
+	}
+
+	if cfg.DeviceKey != "" {
+		checks = append(checks, BootstrapCheck{
+			Name: "Device key matches device certificate",
+			Err:  checkDeviceCredentials(cfg.DeviceKey, cfg.DeviceCert),
+		})
+	}
+
+	statusCode, err := agent.checkBootstrapEndpoint(ctx, cfg.BootstrapKey)
+	checks = append(checks, BootstrapCheck{
+		Name: fmt.Sprintf("Device hub %s:%s is reachable", cfg.DeviceHubServer, cfg.DeviceHubPort),
+		Err:  err,
+	})
+	if err != nil {
+		return checks
+	}
+
+	if cfg.BootstrapKey != "" {
+		var keyErr error
+		if statusCode == http.StatusUnauthorized || statusCode == http.StatusForbidden {
+			keyErr = fmt.Errorf("bootstrap key rejected by the device hub (HTTP %d)", statusCode)
+		}
+
+		checks = append(checks, BootstrapCheck{Name: "Bootstrap key is not rejected", Err: keyErr})
+	}
+
+	return checks
+}
+
+// checkBootstrapEndpoint connects to the device hub (TLS handshake included) and returns status code
+// of a GET request to the bootstrap endpoint. GET requests don't enroll the device, so server state is not modified.
+// The endpoint only accepts POST requests, so the device hub responds with 405 (or 401/403 for rejected keys).
+// Any other status means that the server is not a working device hub (e.g. a proxy error page or wrong host).
+func (agent *Agent) checkBootstrapEndpoint(ctx context.Context, bootstrapKey string) (int, error) {
+	request, err := agent.api.NewRequest(ctx, http.MethodGet, bootstrapAPIPath, nil)
+	if err != nil {
+		return 0, err
+	}
+
+	if bootstrapKey != "" {
+		request.Header.Set("Authorization", fmt.Sprintf("token %s", bootstrapKey))
+	}
+
+	response, err := agent.api.Do(request)
+	if err != nil {
+		return 0, err
+	}
+
+	_ = response.Body.Close()
+
+	switch response.StatusCode {
+	case http.StatusMethodNotAllowed, http.StatusUnauthorized, http.StatusForbidden:
+		return response.StatusCode, nil
+	default:
+		return response.StatusCode, fmt.Errorf("unexpected response from bootstrap endpoint: %s", response.Status)
+	}
+}
+
+// checkDeviceCredentials verifies that pre-provisioned device key and certificate can be loaded and match.
+func checkDeviceCredentials(keyPath, certPath string) error {
+	privateKey, err := loadDeviceKey(keyPath)
+	if err != nil {
+		return err
+	}
+
+	certificate, err := loadDeviceCertificate(certPath)
+	if err != nil {
+		return err
+	}
+
+	if !privateKey.PublicKey.Equal(certificate.PublicKey) {
+		return fmt.Errorf("device certificate %s does not match device key %s", certPath, keyPath)
+	}
+
+	return nil
+}
+
+// checkDirectoryWritable returns an error if the directory cannot be written to by the agent.
+// Directories which don't exist yet are checked against their closest existing parent directory.
+func checkDirectoryWritable(path string) error {
+	for checkedPath := filepath.Clean(path); ; checkedPath = filepath.Dir(checkedPath) {
+		fileInfo, err := os.Stat(checkedPath)
+		if errors.Is(err, fs.ErrNotExist) && checkedPath != filepath.Dir(checkedPath) {
+			continue
+		}
+
+		if err != nil {
+			return fmt.Errorf("cannot check directory %s: %w", path, err)
+		}
+
+		if !fileInfo.IsDir() {
+			return fmt.Errorf("%s is not a directory", checkedPath)
+		}
+
+		if err = unix.Access(checkedPath, unix.W_OK|unix.X_OK); err != nil {
+			return fmt.Errorf("directory %s is not writable: %w", checkedPath, err)
+		}
+
+		return nil
+	}
+}
@@ -0,0 +1,103 @@
+// Copyright 2023 qbee.io
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package agent
+
+import (
+	"context"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"go.qbee.io/agent/app/utils/assert"
+)
+
+func TestCheckBootstrap(t *testing.T) {
+	var enrollmentRequests int
+
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			enrollmentRequests++
+		}
+
+		if r.Header.Get("Authorization") == "token proxy-error" {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+
+		if r.Header.Get("Authorization") != "token valid-key" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}))
+	defer server.Close()
+
+	serverURL, err := url.Parse(server.URL)
+	assert.NoError(t, err)
+
+	dir := t.TempDir()
+	caCertPath := filepath.Join(dir, "ca.pem")
+	caCertPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})
+	assert.NoError(t, os.WriteFile(caCertPath, caCertPEM, 0600))
+
+	cfg := &Config{
+		Directory:       filepath.Join(dir, "etc", "qbee"),
+		StateDirectory:  filepath.Join(dir, "var", "lib", "qbee"),
+		DeviceHubServer: serverURL.Hostname(),
+		DeviceHubPort:   serverURL.Port(),
+		CACert:          caCertPath,
+		BootstrapKey:    "valid-key",
+	}
+
+	for _, check := range CheckBootstrap(context.Background(), cfg) {
+		assert.NoError(t, check.Err)
+	}
+
+	cfg.BootstrapKey = "invalid-key"
+	checks := CheckBootstrap(context.Background(), cfg)
+	assert.Equal(t, checks[len(checks)-1].Name, "Bootstrap key is not rejected")
+	assert.NotEqual(t, checks[len(checks)-1].Err, nil)
+
+	// device hub is not reachable, when the server doesn't respond as the bootstrap endpoint
+	cfg.BootstrapKey = "proxy-error"
+	checks = CheckBootstrap(context.Background(), cfg)
+	assert.HasPrefix(t, checks[len(checks)-1].Name, "Device hub ")
+	assert.NotEqual(t, checks[len(checks)-1].Err, nil)
+
+	// nothing is persisted and the device is not enrolled
+	_, err = os.Stat(cfg.Directory)
+	assert.True(t, os.IsNotExist(err))
+	_, err = os.Stat(cfg.StateDirectory)
+	assert.True(t, os.IsNotExist(err))
+	assert.Equal(t, enrollmentRequests, 0)
+}
+
+func Test_checkDirectoryWritable(t *testing.T) {
+	dir := t.TempDir()
+
+	assert.NoError(t, checkDirectoryWritable(dir))
+	assert.NoError(t, checkDirectoryWritable(filepath.Join(dir, "missing", "directory")))
+
+	filePath := filepath.Join(dir, "file")
+	assert.NoError(t, os.WriteFile(filePath, nil, 0600))
+	assert.NotEqual(t, checkDirectoryWritable(filepath.Join(filePath, "directory")), nil)
+}
@@ -0,0 +1,69 @@
+// Copyright 2023 qbee.io
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package agent
+
+import (
+	"context"
+	"crypto/x509"
+	"fmt"
+	"path/filepath"
+	"time"
+
+	"go.qbee.io/agent/app/configuration"
+	"go.qbee.io/agent/app/log"
+)
+
+// certificateRenewalPeriod defines how long before its expiry the device certificate is renewed.
+const certificateRenewalPeriod = 30 * 24 * time.Hour
+
+// certificateDaysToExpiry returns the number of full days until the certificate expires (negative once expired).
+func certificateDaysToExpiry(certificate *x509.Certificate, now time.Time) int {
+	return int(certificate.NotAfter.Sub(now).Hours() / 24)
+}
+
+// certificateRenewalDue returns true when the certificate expires within the renewal period.
+func certificateRenewalDue(certificate *x509.Certificate, now time.Time) bool {
+	return now.Add(certificateRenewalPeriod).After(certificate.NotAfter)
+}
+
+// checkCertificate renews the device certificate (together with the private key) when it approaches expiry.
+// When renewal fails, a warning report is recorded and the renewal is retried during the next run.
+func (agent *Agent) checkCertificate(ctx context.Context) error {
+	now := time.Now()
+	notAfter := agent.certificate.NotAfter
+	daysToExpiry := certificateDaysToExpiry(agent.certificate, now)
+
+	if !certificateRenewalDue(agent.certificate, now) {
+		log.Debugf("device certificate expires in %d days", daysToExpiry)
+		return nil
+	}
+
+	log.Warnf("device certificate expires in %d days (%s), renewing", daysToExpiry, notAfter.UTC().Format(time.RFC3339))
+
+	err := agent.rotateKey(ctx)
+	if err == nil {
+		return nil
+	}
+
+	appDirectory := filepath.Join(agent.cfg.StateDirectory, appWorkingDirectory)
+
+	if recordErr := configuration.RecordCertificateExpiry(appDirectory, notAfter, err); recordErr != nil {
+		log.Errorf("failed to record certificate expiry: %v", recordErr)
+	}
+
+	return fmt.Errorf("failed to renew device certificate: %w", err)
+}
@@ -0,0 +1,54 @@
+// Copyright 2023 qbee.io
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package agent
+
+import (
+	"crypto/x509"
+	"testing"
+	"time"
+)
+
+func Test_certificateExpiry(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name       string
+		notAfter   time.Time
+		days       int
+		renewalDue bool
+	}{
+		{name: "valid for a year", notAfter: now.AddDate(1, 0, 0), days: 366, renewalDue: false},
+		{name: "renewal period boundary", notAfter: now.Add(certificateRenewalPeriod + time.Hour), days: 30},
+		{name: "within renewal period", notAfter: now.AddDate(0, 0, 10), days: 10, renewalDue: true},
+		{name: "expires today", notAfter: now.Add(time.Hour), days: 0, renewalDue: true},
+		{name: "expired", notAfter: now.AddDate(0, 0, -2), days: -2, renewalDue: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			certificate := &x509.Certificate{NotAfter: tt.notAfter}
+
+			if got := certificateDaysToExpiry(certificate, now); got != tt.days {
+				t.Errorf("expected %d days to expiry, got %d", tt.days, got)
+			}
+
+			if got := certificateRenewalDue(certificate, now); got != tt.renewalDue {
+				t.Errorf("expected renewal due %t, got %t", tt.renewalDue, got)
+			}
+		})
+	}
+}
@@ -18,10 +18,13 @@ package agent
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io/fs"
 	"os"
 	"path/filepath"
 
+	"go.qbee.io/agent/app/log"
 	"go.qbee.io/agent/app/utils"
 )
 
@@ -31,12 +34,22 @@ const (
 	DefaultDeviceHubPort   = "443"
 )
 
+// DefaultStateDirectory is used when neither the state directory nor the writable state directory is provided.
+const DefaultStateDirectory = "/var/lib/qbee"
+
 const (
 	configFileName = "qbee-agent.json"
 	configFileMode = 0600
 )
 
+// settingsOverridesFileName is a file in the config directory with settings forced locally over the server config.
+const settingsOverridesFileName = "settings-overrides.json"
+
 // Config defines the configuration of the agent.
+//
+// Configuration is loaded from the config file and overridden by environment variables named after the fields
+// (e.g. QBEE_DEVICE_HUB_SERVER, QBEE_PROXY_SERVER or QBEE_NO_PROXY="10.0.0.0/8,.local").
+// When the config file doesn't exist, configuration is loaded from environment variables only.
 type Config struct {
 
 	// BootstrapKey is the bootstrap key used to bootstrap the device.
@@ -48,46 +61,163 @@ type Config struct {
 	// StateDirectory where the agent's state is persisted.
 	StateDirectory string `json:"-"`
 
+	// SkipBundles lists configuration bundles which are not executed (provided through command line options).
+	SkipBundles []string `json:"-"`
+
+	// OnlyBundles lists the only configuration bundles which are executed (provided through command line options).
+	OnlyBundles []string `json:"-"`
+
 	// Device Hub API endpoint
 	DeviceHubServer string `json:"server"`
 	DeviceHubPort   string `json:"port"`
 
+	// DeviceHubBasePath is an optional path prefix for all device hub API calls (e.g. "/qbee" behind a reverse proxy).
+	DeviceHubBasePath string `json:"base_path,omitempty"`
+
+	// DNSOverHTTPS is an optional DNS-over-HTTPS resolver URL (e.g. "https://1.1.1.1/dns-query")
+	// used to resolve the device hub host for agent's own API connections.
+	DNSOverHTTPS string `json:"dns_over_https,omitempty"`
+
+	// BindAddress is an optional local IP address used as the source address of device hub connections,
+	// DNS-over-HTTPS lookups and file downloads (including connections to the proxy server).
+	// Remote access connections are not affected.
+	BindAddress string `json:"bind_address,omitempty"`
+
+	// BindInterface is an optional network interface device hub connections, DNS-over-HTTPS lookups
+	// and file downloads are bound to (e.g. "eth1.100"). Remote access connections are not affected.
+	BindInterface string `json:"bind_interface,omitempty"`
+
+	// ConnectTimeout limits establishing a connection to the device hub, in seconds (defaults to 15).
+	ConnectTimeout int `json:"connect_timeout,omitempty"`
+
+	// RequestTimeout limits total time of a device hub API call, in seconds (defaults to 60).
+	RequestTimeout int `json:"request_timeout,omitempty"`
+
+	// CheckInTimeout limits total time of the device hub check-in call, in seconds (defaults to 20).
+	CheckInTimeout int `json:"check_in_timeout,omitempty"`
+
+	// DownloadTimeout limits total time of a file download from the device hub, in seconds (defaults to 2700).
+	DownloadTimeout int `json:"download_timeout,omitempty"`
+
 	// HTTP Proxy configuration
+	// Explicit proxy configuration takes precedence over HTTPS_PROXY and NO_PROXY environment variables.
+	ProxyType     string `json:"http_proxy_type,omitempty"` // "http" (default) or "socks5"
 	ProxyServer   string `json:"http_proxy_server,omitempty"`
 	ProxyPort     string `json:"http_proxy_port,omitempty"`
 	ProxyUser     string `json:"http_proxy_user,omitempty"`
 	ProxyPassword string `json:"http_proxy_pass,omitempty"`
 
+	// NoProxy is a list of hosts, IP addresses or CIDRs which bypass the proxy (e.g. ["device.example.com", "10.0.0.0/8"]).
+	NoProxy []string `json:"no_proxy,omitempty"`
+
 	// TPM Configuration
 	TPMDevice string `json:"tpm_device,omitempty"`
 
 	// DeviceName is the name of the device - only to be used during bootstrap
 	DeviceName string `json:"device_name,omitempty"`
 
+	// DeviceKey is the path to a pre-provisioned device private key - only to be used during bootstrap
+	DeviceKey string `json:"device_key,omitempty"`
+
+	// DeviceCert is the path to a pre-provisioned device certificate - only to be used during bootstrap
+	DeviceCert string `json:"device_cert,omitempty"`
+
 	// DisableRemoteAccess disables remote access.
 	DisableRemoteAccess bool `json:"disable_remote_access,omitempty"`
 
 	// CACert is the path to the CA certificate.
 	CACert string `json:"ca_cert,omitempty"`
+
+	// ExtraCACerts is the path to a PEM file or a directory of PEM files (*.pem, *.crt) with additional
+	// CA certificates (e.g. private intermediates) trusted alongside the CA certificate.
+	ExtraCACerts string `json:"extra_ca_certs,omitempty"`
+
+	// ConfigSigningKey is the path to a PEM-encoded P-256 public key used to verify device configuration.
+	// When set, the agent refuses to apply configuration which is not signed with the corresponding private key.
+	ConfigSigningKey string `json:"config_signing_key,omitempty"`
+
+	// ReportsBatchCount is the maximum number of reports delivered in a single request (defaults to 100).
+	ReportsBatchCount int `json:"reports_batch_count,omitempty"`
+
+	// ReportsBatchSize is the maximum size (in bytes) of reports delivered in a single request (defaults to 1 MiB).
+	ReportsBatchSize int `json:"reports_batch_size,omitempty"`
+
+	// DisableReportsCompression disables gzip compression of reports delivery requests.
+	DisableReportsCompression bool `json:"disable_reports_compression,omitempty"`
+
+	// DownloadRateLimit is the bandwidth limit (in bytes per second) shared by all file downloads (0 means unlimited).
+	DownloadRateLimit int64 `json:"download_rate_limit,omitempty"`
+
+	// MaxConcurrentDownloads is the maximum number of concurrent file downloads (0 means unlimited).
+	MaxConcurrentDownloads int `json:"max_concurrent_downloads,omitempty"`
+
+	// PersistPackageCache persists lists of installed packages and available updates in the state directory,
+	// so they are not refreshed after every agent restart (lists are still refreshed daily and after any change).
+	PersistPackageCache bool `json:"persist_package_cache,omitempty"`
+
+	// DisableAuditLog disables local audit log of changes applied by the agent.
+	DisableAuditLog bool `json:"disable_audit_log,omitempty"`
+
+	// AuditLogMaxSize is the size (in bytes) at which the audit log is rotated (defaults to 1 MiB).
+	AuditLogMaxSize int64 `json:"audit_log_max_size,omitempty"`
+
+	// AuditLogMaxFiles is the number of rotated audit log files to keep (defaults to 5).
+	AuditLogMaxFiles int `json:"audit_log_max_files,omitempty"`
+
+	// RunSplayPercent is the maximum random offset of scheduled runs as percentage of the run interval
+	// (defaults to 10, max 50), so devices bootstrapped together don't contact the device hub in sync.
+	RunSplayPercent int `json:"run_splay_percent,omitempty"`
+
+	// DisableRunSplay disables random offset of scheduled runs.
+	DisableRunSplay bool `json:"disable_run_splay,omitempty"`
+
+	// MaxRunDuration is the time, in seconds, after which a run in progress is considered hung (defaults to 7200),
+	// so the systemd watchdog is no longer notified and systemd restarts the agent.
+	MaxRunDuration int `json:"max_run_duration,omitempty"`
+
+	// WritableStateDirectory is used as the state directory when no state directory (--state-dir) is provided,
+	// e.g. to keep agent's state on a data partition or overlay on devices with read-only rootfs.
+	WritableStateDirectory string `json:"writable_state_directory,omitempty"`
 }
 
-// LoadConfig loads config from a provided config file path.
+// LoadConfig loads config from a provided config file path, with environment variables taking precedence.
+// Config file can be omitted if the agent is configured using environment variables.
+// Explicitly provided state directory takes precedence over the configured writable state directory,
+// and when none of them is set, DefaultStateDirectory is used.
 func LoadConfig(configDir, stateDir string) (*Config, error) {
 	configFilePath := filepath.Join(configDir, configFileName)
 
+	config := new(Config)
+
 	configBytes, err := os.ReadFile(configFilePath)
 	if err != nil {
-		return nil, fmt.Errorf("error loading config from file %s: %w", configFilePath, err)
+		if !errors.Is(err, fs.ErrNotExist) || !hasConfigEnv() {
+			return nil, fmt.Errorf("error loading config from file %s: %w", configFilePath, err)
+		}
+	} else if err = json.Unmarshal(configBytes, config); err != nil {
+		return nil, fmt.Errorf("error parsing config file %s: %w", configFilePath, err)
 	}
 
-	config := new(Config)
-
-	if err = json.Unmarshal(configBytes, config); err != nil {
-		return nil, fmt.Errorf("error parsing config file %s: %w", configFilePath, err)
+	if err = applyConfigEnv(config); err != nil {
+		return nil, err
 	}
 
 	config.Directory = configDir
 
+	switch {
+	case stateDir != "" && config.WritableStateDirectory != "":
+		log.Infof("using state directory %s (writable state directory %s is ignored)",
+			stateDir, config.WritableStateDirectory)
+	case stateDir != "":
+		log.Debugf("using state directory %s", stateDir)
+	case config.WritableStateDirectory != "":
+		stateDir = config.WritableStateDirectory
+		log.Infof("using writable state directory %s", stateDir)
+	default:
+		stateDir = DefaultStateDirectory
+		log.Debugf("using default state directory %s", stateDir)
+	}
+
 	if config.StateDirectory, err = filepath.Abs(stateDir); err != nil {
 		return nil, fmt.Errorf("cannot determine state directory path: %w", err)
 	}
@@ -114,6 +244,9 @@ func (agent *Agent) saveConfig() error {
 		agent.cfg.DeviceName = ""
 	}
 
+	agent.cfg.DeviceKey = ""
+	agent.cfg.DeviceCert = ""
+
 	config, err := json.Marshal(agent.cfg)
 	if err != nil {
 		return fmt.Errorf("error marshaling configuration file: %w", err)
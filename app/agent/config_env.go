@@ -0,0 +1,142 @@
+// Copyright 2023 qbee.io
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package agent
+
+import (
+	"fmt"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// configEnvPrefix is the prefix of environment variables overriding agent's configuration.
+const configEnvPrefix = "QBEE_"
+
+// configEnvName returns environment variable name for a Config field name (e.g. DeviceHubServer -> QBEE_DEVICE_HUB_SERVER).
+func configEnvName(fieldName string) string {
+	runes := []rune(fieldName)
+
+	var name strings.Builder
+	name.WriteString(configEnvPrefix)
+
+	for i, r := range runes {
+		if i > 0 && unicode.IsUpper(r) {
+			prevLower := !unicode.IsUpper(runes[i-1])
+			nextLower := i+1 < len(runes) && unicode.IsLower(runes[i+1])
+
+			if prevLower || nextLower {
+				name.WriteRune('_')
+			}
+		}
+
+		name.WriteRune(unicode.ToUpper(r))
+	}
+
+	return name.String()
+}
+
+// hasConfigEnv returns true if any of the configuration environment variables is set.
+func hasConfigEnv() bool {
+	configType := reflect.TypeOf(Config{})
+
+	for i := 0; i < configType.NumField(); i++ {
+		field := configType.Field(i)
+		if field.Tag.Get("json") == "-" {
+			continue
+		}
+
+		if _, ok := os.LookupEnv(configEnvName(field.Name)); ok {
+			return true
+		}
+	}
+
+	return false
+}
+
+// applyConfigEnv overrides configuration values with values of the corresponding environment variables.
+// Lists are provided as comma-separated values (e.g. QBEE_NO_PROXY="10.0.0.0/8,.local").
+func applyConfigEnv(config *Config) error {
+	configValue := reflect.ValueOf(config).Elem()
+	configType := configValue.Type()
+
+	for i := 0; i < configType.NumField(); i++ {
+		field := configType.Field(i)
+
+		// directories are provided through command line options
+		if field.Tag.Get("json") == "-" {
+			continue
+		}
+
+		envName := configEnvName(field.Name)
+
+		envValue, ok := os.LookupEnv(envName)
+		if !ok {
+			continue
+		}
+
+		if err := setConfigValue(configValue.Field(i), envValue); err != nil {
+			return fmt.Errorf("invalid value of %s: %w", envName, err)
+		}
+	}
+
+	return nil
+}
+
+// setConfigValue sets configuration field value from its string representation.
+func setConfigValue(field reflect.Value, value string) error {
+	switch field.Kind() {
+	case reflect.String:
+		field.SetString(value)
+
+	case reflect.Bool:
+		boolValue, err := strconv.ParseBool(value)
+		if err != nil {
+			return err
+		}
+
+		field.SetBool(boolValue)
+
+	case reflect.Int, reflect.Int64:
+		intValue, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return err
+		}
+
+		field.SetInt(intValue)
+
+	case reflect.Slice:
+		if field.Type().Elem().Kind() != reflect.String {
+			return fmt.Errorf("unsupported type %s", field.Type())
+		}
+
+		values := make([]string, 0)
+		for _, item := range strings.Split(value, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				values = append(values, item)
+			}
+		}
+
+		field.Set(reflect.ValueOf(values))
+
+	default:
+		return fmt.Errorf("unsupported type %s", field.Type())
+	}
+
+	return nil
+}
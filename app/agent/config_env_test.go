@@ -0,0 +1,143 @@
+// Copyright 2023 qbee.io
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package agent
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func Test_configEnvName(t *testing.T) {
+	tests := map[string]string{
+		"DeviceHubServer":   "QBEE_DEVICE_HUB_SERVER",
+		"ProxyServer":       "QBEE_PROXY_SERVER",
+		"DNSOverHTTPS":      "QBEE_DNS_OVER_HTTPS",
+		"CACert":            "QBEE_CA_CERT",
+		"TPMDevice":         "QBEE_TPM_DEVICE",
+		"ReportsBatchCount": "QBEE_REPORTS_BATCH_COUNT",
+	}
+
+	for fieldName, want := range tests {
+		if got := configEnvName(fieldName); got != want {
+			t.Fatalf("expected %s for %s, got %s", want, fieldName, got)
+		}
+	}
+}
+
+func Test_applyConfigEnv_supportsAllFields(t *testing.T) {
+	configValue := reflect.ValueOf(new(Config)).Elem()
+
+	for i := 0; i < configValue.NumField(); i++ {
+		field := configValue.Type().Field(i)
+		if field.Tag.Get("json") == "-" {
+			continue
+		}
+
+		value := "1"
+		if field.Type.Kind() == reflect.Bool {
+			value = "true"
+		}
+
+		if err := setConfigValue(configValue.Field(i), value); err != nil {
+			t.Fatalf("field %s cannot be set from environment: %v", field.Name, err)
+		}
+	}
+}
+
+func TestLoadConfig_environment(t *testing.T) {
+	configDir := t.TempDir()
+	stateDir := t.TempDir()
+
+	// without config file and environment variables, loading fails
+	if _, err := LoadConfig(configDir, stateDir); err == nil {
+		t.Fatalf("expected error when config is missing")
+	}
+
+	t.Setenv("QBEE_PROXY_SERVER", "proxy.example.com")
+	t.Setenv("QBEE_NO_PROXY", "10.0.0.0/8, .local")
+	t.Setenv("QBEE_DISABLE_REMOTE_ACCESS", "true")
+	t.Setenv("QBEE_REPORTS_BATCH_COUNT", "10")
+
+	// environment-only configuration
+	cfg, err := LoadConfig(configDir, stateDir)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if cfg.DeviceHubServer != DefaultDeviceHubServer || cfg.ProxyServer != "proxy.example.com" {
+		t.Fatalf("unexpected config: %+v", cfg)
+	}
+
+	if !reflect.DeepEqual(cfg.NoProxy, []string{"10.0.0.0/8", ".local"}) || !cfg.DisableRemoteAccess || cfg.ReportsBatchCount != 10 {
+		t.Fatalf("unexpected config: %+v", cfg)
+	}
+
+	// environment variables take precedence over the config file
+	configFile := `{"server":"hub.example.com","port":"8443","http_proxy_server":"file-proxy.example.com"}`
+	if err = os.WriteFile(filepath.Join(configDir, configFileName), []byte(configFile), configFileMode); err != nil {
+		t.Fatalf("cannot write config file: %v", err)
+	}
+
+	t.Setenv("QBEE_DEVICE_HUB_PORT", "9443")
+
+	if cfg, err = LoadConfig(configDir, stateDir); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if cfg.DeviceHubServer != "hub.example.com" || cfg.DeviceHubPort != "9443" || cfg.ProxyServer != "proxy.example.com" {
+		t.Fatalf("unexpected config: %+v", cfg)
+	}
+
+	// without a state directory, the default one is used
+	if cfg, err = LoadConfig(configDir, ""); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if cfg.StateDirectory != DefaultStateDirectory {
+		t.Fatalf("unexpected state directory: %s", cfg.StateDirectory)
+	}
+
+	// state directory can be moved to a writable filesystem
+	writableStateDir := t.TempDir()
+	t.Setenv("QBEE_WRITABLE_STATE_DIRECTORY", writableStateDir)
+
+	if cfg, err = LoadConfig(configDir, ""); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if cfg.StateDirectory != writableStateDir {
+		t.Fatalf("unexpected state directory: %s", cfg.StateDirectory)
+	}
+
+	// but explicitly provided state directory wins
+	if cfg, err = LoadConfig(configDir, stateDir); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if cfg.StateDirectory != stateDir {
+		t.Fatalf("unexpected state directory: %s", cfg.StateDirectory)
+	}
+
+	// invalid values are rejected
+	t.Setenv("QBEE_REPORTS_BATCH_COUNT", "ten")
+
+	if _, err = LoadConfig(configDir, stateDir); err == nil {
+		t.Fatalf("expected error for invalid environment value")
+	}
+}
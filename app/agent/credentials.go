@@ -20,6 +20,7 @@ import (
 	"crypto/ecdsa"
 	"crypto/elliptic"
 	"crypto/rand"
+	"crypto/sha256"
 	"crypto/x509"
 	"encoding/pem"
 	"errors"
@@ -28,7 +29,9 @@ import (
 	"math/big"
 	"os"
 	"path/filepath"
+	"slices"
 
+	"go.qbee.io/agent/app/configuration"
 	"go.qbee.io/agent/app/log"
 	"go.qbee.io/agent/app/utils"
 )
@@ -78,6 +81,115 @@ func (agent *Agent) loadCACertificatesPool(caCert string) error {
 	return nil
 }
 
+// extraCACertSuffixes defines file suffixes loaded from the extra CA certificates directory.
+var extraCACertSuffixes = []string{".pem", ".crt", ".cert"}
+
+// loadExtraCACertificates appends additional CA certificates from a PEM file or a directory of PEM files to the pool.
+// The pool is shared by the API client and remote access TLS configuration.
+func (agent *Agent) loadExtraCACertificates(path string) error {
+	if path == "" {
+		return nil
+	}
+
+	fileInfo, err := os.Stat(path)
+	if err != nil {
+		return fmt.Errorf("error reading extra CA certificates %s: %w", path, err)
+	}
+
+	files := []string{path}
+
+	if fileInfo.IsDir() {
+		var entries []os.DirEntry
+		if entries, err = os.ReadDir(path); err != nil {
+			return fmt.Errorf("error reading extra CA certificates directory %s: %w", path, err)
+		}
+
+		files = make([]string, 0, len(entries))
+		for _, entry := range entries {
+			if entry.IsDir() || !slices.Contains(extraCACertSuffixes, filepath.Ext(entry.Name())) {
+				continue
+			}
+
+			files = append(files, filepath.Join(path, entry.Name()))
+		}
+	}
+
+	added := 0
+
+	for _, file := range files {
+		var certificates []*x509.Certificate
+		if certificates, err = parsePEMCertificates(file); err != nil {
+			return err
+		}
+
+		for _, certificate := range certificates {
+			agent.caCertPool.AddCert(certificate)
+		}
+
+		added += len(certificates)
+	}
+
+	log.Infof("Added %d additional CA certificate(s) from %s", added, path)
+
+	return nil
+}
+
+// parsePEMCertificates returns all certificates from the PEM file.
+// Returns an error if file contains any PEM blocks other than certificates.
+func parsePEMCertificates(path string) ([]*x509.Certificate, error) {
+	pemData, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading certificates file %s: %w", path, err)
+	}
+
+	certificates := make([]*x509.Certificate, 0)
+
+	for {
+		var pemBlock *pem.Block
+		if pemBlock, pemData = pem.Decode(pemData); pemBlock == nil {
+			break
+		}
+
+		if pemBlock.Type != "CERTIFICATE" {
+			return nil, fmt.Errorf("unexpected PEM block %s in certificates file %s", pemBlock.Type, path)
+		}
+
+		var certificate *x509.Certificate
+		if certificate, err = x509.ParseCertificate(pemBlock.Bytes); err != nil {
+			return nil, fmt.Errorf("error parsing certificate in %s: %w", path, err)
+		}
+
+		certificates = append(certificates, certificate)
+	}
+
+	if len(certificates) == 0 {
+		return nil, fmt.Errorf("no certificates found in %s", path)
+	}
+
+	return certificates, nil
+}
+
+// loadConfigSigningKey loads public key used to verify configuration signatures (if configured).
+func (agent *Agent) loadConfigSigningKey(keyPath string) error {
+	if keyPath == "" {
+		return nil
+	}
+
+	publicKeyPEM, err := os.ReadFile(keyPath)
+	if err != nil {
+		return fmt.Errorf("error reading config signing key %s: %w", keyPath, err)
+	}
+
+	var publicKey *ecdsa.PublicKey
+	if publicKey, err = configuration.ParseConfigSigningKey(publicKeyPEM); err != nil {
+		return err
+	}
+
+	agent.Configuration.WithConfigSigningKey(publicKey)
+
+	return nil
+}
+
 const (
 	ecPrivateKeyPEMHeader       = "EC PRIVATE KEY"
 	sealedECPrivateKeyPEMHeader = "SEALED PRIVATE KEY"
@@ -99,9 +211,32 @@ func (agent *Agent) createPrivateKey() error {
 		return fmt.Errorf("error generating new private key: %w", err)
 	}
 
-	var privateKeyDER []byte
-	if privateKeyDER, err = x509.MarshalECPrivateKey(privateKey); err != nil {
-		return fmt.Errorf("error marshaling private key: %w", err)
+	var pemBytes []byte
+	if pemBytes, err = agent.encodePrivateKey(privateKey); err != nil {
+		return err
+	}
+
+	keyPath := filepath.Join(agent.cfg.Directory, credentialsDirectory, privateKeyFilename)
+
+	if err = utils.WriteFileSync(keyPath, pemBytes, credentialsFileMode); err != nil {
+		return fmt.Errorf("unable to write private key to %s: %w", keyPath, err)
+	}
+
+	agent.privateKey = privateKey
+
+	return nil
+}
+
+// sealedKeyCurveHeader is a PEM header defining the curve of a sealed private key.
+// When not set, P-521 is assumed for compatibility with keys sealed by older agent versions.
+const sealedKeyCurveHeader = "Curve"
+
+// encodePrivateKey returns PEM-encoded private key.
+// If TPM is available, key will be sealed before encoding.
+func (agent *Agent) encodePrivateKey(privateKey *ecdsa.PrivateKey) ([]byte, error) {
+	privateKeyDER, err := x509.MarshalECPrivateKey(privateKey)
+	if err != nil {
+		return nil, fmt.Errorf("error marshaling private key: %w", err)
 	}
 
 	pemBlock := &pem.Block{
@@ -112,20 +247,15 @@ func (agent *Agent) createPrivateKey() error {
 	if agent.cfg.TPMDevice != "" {
 		pemBlock.Type = sealedECPrivateKeyPEMHeader
 		if pemBlock.Bytes, err = agent.SealSecret(privateKey.D.Bytes()); err != nil {
-			return err
+			return nil, err
 		}
-	}
-
-	pemBytes := pem.EncodeToMemory(pemBlock)
-	keyPath := filepath.Join(agent.cfg.Directory, credentialsDirectory, privateKeyFilename)
 
-	if err = utils.WriteFileSync(keyPath, pemBytes, credentialsFileMode); err != nil {
-		return fmt.Errorf("unable to write private key to %s: %w", keyPath, err)
+		if privateKey.Curve != elliptic.P521() {
+			pemBlock.Headers = map[string]string{sealedKeyCurveHeader: privateKey.Curve.Params().Name}
+		}
 	}
 
-	agent.privateKey = privateKey
-
-	return nil
+	return pem.EncodeToMemory(pemBlock), nil
 }
 
 // loadPrivateKey loads private key from the config directory.
@@ -148,11 +278,20 @@ func (agent *Agent) loadPrivateKey() error {
 			return err
 		}
 
-		x, y := elliptic.P521().ScalarBaseMult(dBytes)
+		curve := elliptic.P521()
+		switch curveName := pemBlock.Headers[sealedKeyCurveHeader]; curveName {
+		case "", curve.Params().Name:
+		case elliptic.P256().Params().Name:
+			curve = elliptic.P256()
+		default:
+			return fmt.Errorf("unsupported sealed private key curve %s", curveName)
+		}
+
+		x, y := curve.ScalarBaseMult(dBytes)
 		agent.privateKey = &ecdsa.PrivateKey{
 			D: new(big.Int).SetBytes(dBytes),
 			PublicKey: ecdsa.PublicKey{
-				Curve: elliptic.P521(),
+				Curve: curve,
 				X:     x,
 				Y:     y,
 			},
@@ -166,6 +305,108 @@ func (agent *Agent) loadPrivateKey() error {
 	return nil
 }
 
+// useDeviceCredentials installs pre-provisioned device key and certificate as agent's credentials
+// and configures the API client to authenticate using them.
+func (agent *Agent) useDeviceCredentials(keyPath, certPath string) error {
+	if agent.cfg.TPMDevice != "" {
+		return fmt.Errorf("pre-provisioned device key cannot be used together with TPM")
+	}
+
+	privateKey, err := loadDeviceKey(keyPath)
+	if err != nil {
+		return err
+	}
+
+	var certificate *x509.Certificate
+	if certificate, err = loadDeviceCertificate(certPath); err != nil {
+		return err
+	}
+
+	if !privateKey.PublicKey.Equal(certificate.PublicKey) {
+		return fmt.Errorf("device certificate %s does not match device key %s", certPath, keyPath)
+	}
+
+	var privateKeyDER []byte
+	if privateKeyDER, err = x509.MarshalECPrivateKey(privateKey); err != nil {
+		return fmt.Errorf("error marshaling private key: %w", err)
+	}
+
+	pemBytes := pem.EncodeToMemory(&pem.Block{Type: ecPrivateKeyPEMHeader, Bytes: privateKeyDER})
+	agentKeyPath := filepath.Join(agent.cfg.Directory, credentialsDirectory, privateKeyFilename)
+
+	if err = utils.WriteFileSync(agentKeyPath, pemBytes, credentialsFileMode); err != nil {
+		return fmt.Errorf("unable to write private key to %s: %w", agentKeyPath, err)
+	}
+
+	log.Infof("Using pre-provisioned device key")
+
+	agent.privateKey = privateKey
+	agent.certificate = certificate
+	agent.api.WithTLSConfig(agent.clientTLSConfig())
+
+	return nil
+}
+
+// loadDeviceKey loads a PEM-encoded P-256 private key from provided path.
+func loadDeviceKey(keyPath string) (*ecdsa.PrivateKey, error) {
+	pemBytes, err := os.ReadFile(keyPath)
+	if err != nil {
+		return nil, fmt.Errorf("error loading device key file %s: %w", keyPath, err)
+	}
+
+	pemBlock, _ := pem.Decode(pemBytes)
+	if pemBlock == nil {
+		return nil, fmt.Errorf("error decoding device key's PEM block")
+	}
+
+	var privateKey *ecdsa.PrivateKey
+
+	switch pemBlock.Type {
+	case ecPrivateKeyPEMHeader:
+		if privateKey, err = x509.ParseECPrivateKey(pemBlock.Bytes); err != nil {
+			return nil, fmt.Errorf("error parsing device key: %w", err)
+		}
+	case "PRIVATE KEY":
+		var key any
+		if key, err = x509.ParsePKCS8PrivateKey(pemBlock.Bytes); err != nil {
+			return nil, fmt.Errorf("error parsing device key: %w", err)
+		}
+
+		var ok bool
+		if privateKey, ok = key.(*ecdsa.PrivateKey); !ok {
+			return nil, fmt.Errorf("device key is not an EC private key")
+		}
+	default:
+		return nil, fmt.Errorf("unsupported device key type %s", pemBlock.Type)
+	}
+
+	if privateKey.Curve != elliptic.P256() {
+		return nil, fmt.Errorf("device key must use P-256 curve, got %s", privateKey.Curve.Params().Name)
+	}
+
+	return privateKey, nil
+}
+
+// loadDeviceCertificate loads a PEM-encoded device certificate from provided path.
+func loadDeviceCertificate(certPath string) (*x509.Certificate, error) {
+	pemBytes, err := os.ReadFile(certPath)
+	if err != nil {
+		return nil, fmt.Errorf("error loading device certificate file %s: %w", certPath, err)
+	}
+
+	pemBlock, _ := pem.Decode(pemBytes)
+	if pemBlock == nil || pemBlock.Type != "CERTIFICATE" {
+		return nil, fmt.Errorf("error decoding device certificate's PEM block")
+	}
+
+	certificate, err := x509.ParseCertificate(pemBlock.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing device certificate: %w", err)
+	}
+
+	return certificate, nil
+}
+
 func (agent *Agent) saveCertificate(pemCertificate []byte) error {
 	pemBlock, _ := pem.Decode(pemCertificate)
 	if pemBlock == nil || pemBlock.Type != "CERTIFICATE" {
@@ -218,3 +459,13 @@ func (agent *Agent) GetOrganizationID() (string, error) {
 
 	return string(agent.certificate.AuthorityKeyId), nil
 }
+
+// deviceID returns a stable device identifier - the certificate's common name,
+// or a digest of the device public key if the common name is not set.
+func (agent *Agent) deviceID() string {
+	if agent.certificate.Subject.CommonName != "" {
+		return agent.certificate.Subject.CommonName
+	}
+
+	return fmt.Sprintf("%x", sha256.Sum256(agent.certificate.RawSubjectPublicKeyInfo))
+}
@@ -0,0 +1,293 @@
+// Copyright 2023 qbee.io
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package agent
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"go.qbee.io/agent/app/api"
+)
+
+// testCACertificatePEM returns a PEM-encoded self-signed CA certificate.
+func testCACertificatePEM(t *testing.T, name string) []byte {
+	privateKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: name},
+		NotBefore:             time.Now(),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &privateKey.PublicKey, privateKey)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+}
+
+func TestAgent_loadExtraCACertificates(t *testing.T) {
+	dir := t.TempDir()
+
+	bundle := append(testCACertificatePEM(t, "intermediate-1"), testCACertificatePEM(t, "intermediate-2")...)
+	writeTestFile(t, filepath.Join(dir, "bundle.pem"), bundle)
+	writeTestFile(t, filepath.Join(dir, "other.crt"), testCACertificatePEM(t, "intermediate-3"))
+	writeTestFile(t, filepath.Join(dir, "README"), []byte("not a certificate"))
+
+	agent := &Agent{caCertPool: x509.NewCertPool()}
+
+	if err := agent.loadExtraCACertificates(dir); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if got := len(agent.caCertPool.Subjects()); got != 3 {
+		t.Fatalf("expected 3 certificates in the pool, got %d", got)
+	}
+}
+
+func TestAgent_loadExtraCACertificates_invalid(t *testing.T) {
+	dir := t.TempDir()
+
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: []byte("key")})
+
+	tests := map[string][]byte{
+		"private key": append(testCACertificatePEM(t, "ca"), keyPEM...),
+		"empty":       []byte("no PEM data"),
+	}
+
+	for name, content := range tests {
+		t.Run(name, func(t *testing.T) {
+			path := filepath.Join(dir, name+".pem")
+			writeTestFile(t, path, content)
+
+			agent := &Agent{caCertPool: x509.NewCertPool()}
+
+			if err := agent.loadExtraCACertificates(path); err == nil {
+				t.Fatalf("expected error")
+			}
+		})
+	}
+
+	agent := &Agent{caCertPool: x509.NewCertPool()}
+	if err := agent.loadExtraCACertificates(filepath.Join(dir, "missing.pem")); err == nil {
+		t.Fatalf("expected error for missing file")
+	}
+}
+
+// testDeviceCredentials returns a private key and PEM-encoded self-signed certificate for it.
+func testDeviceCredentials(t *testing.T, curve elliptic.Curve) (*ecdsa.PrivateKey, []byte) {
+	privateKey, err := ecdsa.GenerateKey(curve, rand.Reader)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "device"},
+		NotBefore:    time.Now(),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &privateKey.PublicKey, privateKey)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	return privateKey, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+}
+
+// testPrivateKeyPEM returns private key encoded as a PEM block of the provided type.
+func testPrivateKeyPEM(t *testing.T, privateKey any, blockType string) []byte {
+	var der []byte
+	var err error
+
+	if blockType == ecPrivateKeyPEMHeader {
+		der, err = x509.MarshalECPrivateKey(privateKey.(*ecdsa.PrivateKey))
+	} else {
+		der, err = x509.MarshalPKCS8PrivateKey(privateKey)
+	}
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	return pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der})
+}
+
+func Test_loadDeviceKey(t *testing.T) {
+	dir := t.TempDir()
+
+	privateKey, _ := testDeviceCredentials(t, elliptic.P256())
+	p384Key, _ := testDeviceCredentials(t, elliptic.P384())
+
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		content []byte
+		wantErr bool
+	}{
+		{name: "EC private key", content: testPrivateKeyPEM(t, privateKey, ecPrivateKeyPEMHeader)},
+		{name: "PKCS8 private key", content: testPrivateKeyPEM(t, privateKey, "PRIVATE KEY")},
+		{name: "RSA private key", content: testPrivateKeyPEM(t, rsaKey, "PRIVATE KEY"), wantErr: true},
+		{name: "P-384 private key", content: testPrivateKeyPEM(t, p384Key, ecPrivateKeyPEMHeader), wantErr: true},
+		{name: "unsupported block", content: pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY"}), wantErr: true},
+		{name: "not PEM", content: []byte("invalid"), wantErr: true},
+	}
+
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			keyPath := filepath.Join(dir, fmt.Sprintf("device-%d.key", i))
+			writeTestFile(t, keyPath, tt.content)
+
+			loadedKey, err := loadDeviceKey(keyPath)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("expected error")
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if !loadedKey.Equal(privateKey) {
+				t.Fatalf("loaded key doesn't match the provided key")
+			}
+		})
+	}
+
+	if _, err = loadDeviceKey(filepath.Join(dir, "missing.key")); err == nil {
+		t.Fatalf("expected error for missing file")
+	}
+}
+
+func Test_loadDeviceCertificate(t *testing.T) {
+	dir := t.TempDir()
+	privateKey, certPEM := testDeviceCredentials(t, elliptic.P256())
+
+	certPath := filepath.Join(dir, "device.cert")
+	writeTestFile(t, certPath, certPEM)
+
+	certificate, err := loadDeviceCertificate(certPath)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if !privateKey.PublicKey.Equal(certificate.PublicKey) {
+		t.Fatalf("loaded certificate doesn't match the device key")
+	}
+
+	keyPath := filepath.Join(dir, "device.key")
+	writeTestFile(t, keyPath, testPrivateKeyPEM(t, privateKey, ecPrivateKeyPEMHeader))
+
+	if _, err = loadDeviceCertificate(keyPath); err == nil {
+		t.Fatalf("expected error for non-certificate PEM block")
+	}
+}
+
+func TestAgent_useDeviceCredentials(t *testing.T) {
+	dir := t.TempDir()
+
+	if err := os.Mkdir(filepath.Join(dir, credentialsDirectory), 0700); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	privateKey, certPEM := testDeviceCredentials(t, elliptic.P256())
+	_, otherCertPEM := testDeviceCredentials(t, elliptic.P256())
+
+	keyPath := filepath.Join(dir, "device.key")
+	certPath := filepath.Join(dir, "device.cert")
+	otherCertPath := filepath.Join(dir, "other.cert")
+
+	writeTestFile(t, keyPath, testPrivateKeyPEM(t, privateKey, "PRIVATE KEY"))
+	writeTestFile(t, certPath, certPEM)
+	writeTestFile(t, otherCertPath, otherCertPEM)
+
+	agent := &Agent{cfg: &Config{Directory: dir}, api: api.NewClient("localhost", "443")}
+	agentKeyPath := filepath.Join(dir, credentialsDirectory, privateKeyFilename)
+
+	// certificate must match the key
+	if err := agent.useDeviceCredentials(keyPath, otherCertPath); err == nil {
+		t.Fatalf("expected error for mismatched certificate")
+	}
+
+	if _, err := os.Stat(agentKeyPath); !os.IsNotExist(err) {
+		t.Fatalf("expected private key not to be written, got %v", err)
+	}
+
+	// pre-provisioned key cannot be combined with TPM
+	agent.cfg.TPMDevice = "/dev/tpmrm0"
+	if err := agent.useDeviceCredentials(keyPath, certPath); err == nil {
+		t.Fatalf("expected error when TPM is configured")
+	}
+	agent.cfg.TPMDevice = ""
+
+	if err := agent.useDeviceCredentials(keyPath, certPath); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if !agent.privateKey.Equal(privateKey) || !agent.certificate.PublicKey.(*ecdsa.PublicKey).Equal(&privateKey.PublicKey) {
+		t.Fatalf("expected agent to use the device credentials")
+	}
+
+	// key is stored as agent's private key, so it's loaded by the agent after bootstrap
+	storedKey, err := loadDeviceKey(agentKeyPath)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if !storedKey.Equal(privateKey) {
+		t.Fatalf("stored key doesn't match the device key")
+	}
+
+	fileInfo, err := os.Stat(agentKeyPath)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if fileInfo.Mode().Perm() != credentialsFileMode {
+		t.Fatalf("expected private key mode %v, got %v", os.FileMode(credentialsFileMode), fileInfo.Mode().Perm())
+	}
+}
+
+func writeTestFile(t *testing.T, path string, content []byte) {
+	if err := os.WriteFile(path, content, 0600); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
@@ -67,6 +67,9 @@ func (agent *Agent) SignURL(rawURL string) (string, error) {
 		return "", err
 	}
 
+	// signature covers the path as seen by the device hub, so base path is only added to the resulting URL
+	parsedURL.Path = agent.api.BasePath() + parsedURL.Path
+
 	query := parsedURL.Query()
 	query.Set("o", orgID)
 	query.Set("k", base64.RawURLEncoding.EncodeToString(pubKeyBytes))
@@ -31,6 +31,9 @@ const (
 	credentialsDirectory = "ppkeys"
 	appWorkingDirectory  = "app_workdir"
 	cacheDirectory       = "cache"
+
+	// packageCacheDirectory (within the cache directory) persists package lists when enabled by the config.
+	packageCacheDirectory = "packages"
 )
 
 // prepareDirectories makes sure that agent's directories are in place.
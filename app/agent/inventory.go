@@ -18,10 +18,12 @@ package agent
 
 import (
 	"context"
+	"errors"
 	"fmt"
 
 	"go.qbee.io/agent/app"
 	"go.qbee.io/agent/app/inventory"
+	"go.qbee.io/agent/app/software"
 )
 
 // doInventories collects all inventories and delivers them to the device hub API.
@@ -38,18 +40,34 @@ func (agent *Agent) doInventories(ctx context.Context) error {
 		"podman-images":     agent.doPodmanImagesInventory,
 		"podman-volumes":    agent.doPodmanVolumesInventory,
 		"podman-networks":   agent.doPodmanNetworksInventory,
+		"container-stats":   agent.doContainerStatsInventory,
 		"software":          agent.doSoftwareInventory,
 		"process":           agent.doProcessInventory,
 		"rauc":              agent.doRaucInventory,
+		"agent-run":         agent.doAgentRunInventory,
 	}
 
+	batchInventories := agent.Configuration.BatchInventories()
+	if batchInventories {
+		agent.Inventory.StartBatch(agent.Configuration.InventoryBatchSize())
+	}
+
+	// failure of a single inventory doesn't prevent delivery of the others
+	errs := make([]error, 0)
+
 	for name, fn := range inventories {
 		if err := fn(ctx); err != nil {
-			return fmt.Errorf("failed to do %s inventory: %w", name, err)
+			errs = append(errs, fmt.Errorf("failed to do %s inventory: %w", name, err))
 		}
 	}
 
-	return nil
+	if batchInventories {
+		if err := agent.Inventory.SendBatch(ctx); err != nil {
+			errs = append(errs, fmt.Errorf("failed to send batched inventories: %w", err))
+		}
+	}
+
+	return errors.Join(errs...)
 }
 
 // doSystemInventory collects system inventory and delivers it to the device hub API.
@@ -68,6 +86,16 @@ func (agent *Agent) doSystemInventory(ctx context.Context) error {
 	return agent.Inventory.Send(ctx, inventory.TypeSystem, systemInventory)
 }
 
+// doAgentRunInventory delivers timing statistics of the last configuration run to the device hub API.
+func (agent *Agent) doAgentRunInventory(ctx context.Context) error {
+	agentRunInventory := agent.Configuration.AgentRunInventory()
+	if agentRunInventory == nil {
+		return nil
+	}
+
+	return agent.Inventory.Send(ctx, inventory.TypeAgentRun, agentRunInventory)
+}
+
 // doUsersInventory collects users inventory and delivers it to the device hub API.
 func (agent *Agent) doUsersInventory(ctx context.Context) error {
 	usersInventory, err := inventory.CollectUsersInventory()
@@ -78,8 +106,12 @@ func (agent *Agent) doUsersInventory(ctx context.Context) error {
 	return agent.Inventory.Send(ctx, inventory.TypeUsers, usersInventory)
 }
 
-// doPortsInventory collects ports inventory and delivers it to the device hub API.
+// doPortsInventory collects ports inventory - if enabled - and delivers it to the device hub API.
 func (agent *Agent) doPortsInventory(ctx context.Context) error {
+	if !agent.Configuration.CollectPortsInventory() {
+		return nil
+	}
+
 	portsInventory, err := inventory.CollectPortsInventory()
 	if err != nil {
 		return err
@@ -169,12 +201,28 @@ func (agent *Agent) doPodmanNetworksInventory(ctx context.Context) error {
 	return agent.Inventory.Send(ctx, inventory.TypePodmanNetworks, podmanNetworksInventory)
 }
 
+// doContainerStatsInventory collects container resource usage inventory - if enabled - and delivers it to the device hub API.
+func (agent *Agent) doContainerStatsInventory(ctx context.Context) error {
+	if !agent.Configuration.CollectContainerStatsInventory() {
+		return nil
+	}
+
+	containerStatsInventory, err := inventory.CollectContainerStatsInventory(ctx)
+	if err != nil {
+		return err
+	}
+
+	return agent.Inventory.Send(ctx, inventory.TypeContainerStats, containerStatsInventory)
+}
+
 // doSoftwareInventory collects software inventory - if enabled - and delivers it to the device hub API.
 func (agent *Agent) doSoftwareInventory(ctx context.Context) error {
 	if !agent.Configuration.CollectSoftwareInventory() {
 		return nil
 	}
 
+	ctx = software.WithIndexUpdatePolicy(ctx, agent.Configuration.IndexUpdatePolicy())
+
 	softwareInventory, err := inventory.CollectSoftwareInventory(ctx)
 	if err != nil {
 		return err
@@ -194,6 +242,11 @@ func (agent *Agent) doProcessInventory(ctx context.Context) error {
 		return err
 	}
 
+	// limit the payload size before submission
+	if processesInventory, err = agent.Configuration.ProcessInventoryFilter().Apply(processesInventory); err != nil {
+		return err
+	}
+
 	return agent.Inventory.Send(ctx, inventory.TypeProcesses, processesInventory)
 }
 
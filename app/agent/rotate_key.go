@@ -0,0 +1,263 @@
+// Copyright 2023 qbee.io
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package agent
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"go.qbee.io/agent/app/log"
+	"go.qbee.io/agent/app/utils"
+)
+
+const (
+	rotatedFileSuffix = ".new"
+	backupFileSuffix  = ".old"
+)
+
+// RotateKey replaces agent's private key with a new P-256 key and obtains a matching certificate from the device hub.
+// If TPM is configured, the new key is sealed with the TPM before it's stored on the filesystem.
+// The current credentials remain in place until the new key and certificate are fully written to disk.
+func RotateKey(ctx context.Context, cfg *Config) error {
+	agent, err := New(cfg)
+	if err != nil {
+		return err
+	}
+
+	return agent.rotateKey(ctx)
+}
+
+// rotateKey performs key rotation for an agent with loaded credentials.
+func (agent *Agent) rotateKey(ctx context.Context) error {
+	log.Infof("Generating new private key")
+
+	privateKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return fmt.Errorf("error generating new private key: %w", err)
+	}
+
+	var keyPEM []byte
+	if keyPEM, err = agent.encodePrivateKey(privateKey); err != nil {
+		return err
+	}
+
+	var rawPublicKey []string
+	if rawPublicKey, err = encodeRawPublicKey(&privateKey.PublicKey); err != nil {
+		return err
+	}
+
+	log.Infof("Requesting certificate for the new private key")
+
+	var response *KeyRotationResponse
+	if response, err = agent.sendKeyRotationRequest(ctx, &KeyRotationRequest{RawPublicKey: rawPublicKey}); err != nil {
+		return err
+	}
+
+	certPEM := []byte(strings.Join(response.Certificate, "\n"))
+
+	pemBlock, _ := pem.Decode(certPEM)
+	if pemBlock == nil || pemBlock.Type != "CERTIFICATE" {
+		return fmt.Errorf("got invalid certificate")
+	}
+
+	var certificate *x509.Certificate
+	if certificate, err = x509.ParseCertificate(pemBlock.Bytes); err != nil {
+		return fmt.Errorf("error parsing certificate: %w", err)
+	}
+
+	if !privateKey.PublicKey.Equal(certificate.PublicKey) {
+		return fmt.Errorf("received certificate does not match the new private key")
+	}
+
+	credentialsPath := filepath.Join(agent.cfg.Directory, credentialsDirectory)
+
+	err = swapFiles(map[string][]byte{
+		filepath.Join(credentialsPath, privateKeyFilename):  keyPEM,
+		filepath.Join(credentialsPath, certificateFilename): certPEM,
+	})
+	if err != nil {
+		return fmt.Errorf("error storing new credentials: %w", err)
+	}
+
+	agent.privateKey = privateKey
+	agent.certificate = certificate
+
+	// remote access client is stopped and re-created with the new certificate on the next state update
+	tlsConfig := agent.clientTLSConfig()
+	agent.api.WithTLSConfig(tlsConfig)
+	agent.remoteAccess.WithTLSConfig(tlsConfig)
+
+	log.Infof("Key rotation successfully completed")
+
+	return nil
+}
+
+// rotatedCredentialPaths returns paths of the credential files replaced by key rotation (see rotateKey).
+func rotatedCredentialPaths(directory string) []string {
+	credentialsPath := filepath.Join(directory, credentialsDirectory)
+
+	return []string{
+		filepath.Join(credentialsPath, privateKeyFilename),
+		filepath.Join(credentialsPath, certificateFilename),
+	}
+}
+
+// swapFiles replaces contents of provided files, so either all or none of them are updated, even if the agent crashes.
+// New contents are written and synced to temporary files first, and existing files are hard-linked to backups.
+// The swap is complete once all temporary files have been renamed over existing files, then backups are removed.
+// An interrupted swap is finished or rolled back by recoverSwappedFiles on the next start.
+func swapFiles(files map[string][]byte) error {
+	paths := make([]string, 0, len(files))
+	for path := range files {
+		paths = append(paths, path)
+	}
+
+	sort.Strings(paths)
+
+	// stale backups would be restored over existing files by a rollback
+	for _, path := range paths {
+		if err := os.Remove(path + backupFileSuffix); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+	}
+
+	for _, path := range paths {
+		if err := utils.WriteFileSync(path+rotatedFileSuffix, files[path], credentialsFileMode); err != nil {
+			rollbackSwappedFiles(paths)
+			return err
+		}
+
+		// backup links point to the existing files, which remain in place until they are replaced
+		if err := os.Link(path, path+backupFileSuffix); err != nil {
+			rollbackSwappedFiles(paths)
+			return err
+		}
+	}
+
+	if err := syncDirectories(paths); err != nil {
+		rollbackSwappedFiles(paths)
+		return err
+	}
+
+	for _, path := range paths {
+		if err := os.Rename(path+rotatedFileSuffix, path); err != nil {
+			rollbackSwappedFiles(paths)
+			return err
+		}
+	}
+
+	// all files are replaced at this point, so failing to persist the renames is recovered on the next start
+	if err := syncDirectories(paths); err != nil {
+		log.Warnf("cannot sync credentials directory: %v", err)
+	}
+
+	removeBackupFiles(paths)
+
+	return nil
+}
+
+// recoverSwappedFiles finishes or rolls back a file swap interrupted by a crash.
+// Remaining temporary files mean that not all files were replaced, so existing files are restored from backups.
+// Otherwise, all files were replaced and only leftover backups are removed.
+func recoverSwappedFiles(paths []string) {
+	for _, path := range paths {
+		if _, err := os.Lstat(path + rotatedFileSuffix); err == nil {
+			log.Warnf("Restoring credentials after interrupted key rotation")
+			rollbackSwappedFiles(paths)
+			return
+		}
+	}
+
+	removeBackupFiles(paths)
+}
+
+// rollbackSwappedFiles restores provided files from their backups and removes temporary files.
+// Temporary files are removed last, so a rollback interrupted by a crash is repeated on the next start.
+func rollbackSwappedFiles(paths []string) {
+	for _, path := range paths {
+		err := os.Rename(path+backupFileSuffix, path)
+		if err != nil {
+			if !errors.Is(err, fs.ErrNotExist) {
+				log.Errorf("cannot restore %s from backup: %v", path, err)
+			}
+			continue
+		}
+
+		// renaming a backup over the file it links to is a no-op, so the backup is removed explicitly
+		if err = os.Remove(path + backupFileSuffix); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			log.Warnf("cannot remove backup file %s: %v", path+backupFileSuffix, err)
+		}
+	}
+
+	if err := syncDirectories(paths); err != nil {
+		log.Errorf("cannot sync credentials directory: %v", err)
+	}
+
+	for _, path := range paths {
+		if err := os.Remove(path + rotatedFileSuffix); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			log.Errorf("cannot remove %s: %v", path+rotatedFileSuffix, err)
+		}
+	}
+}
+
+// removeBackupFiles removes backups of provided files.
+func removeBackupFiles(paths []string) {
+	for _, path := range paths {
+		if err := os.Remove(path + backupFileSuffix); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			log.Warnf("cannot remove backup file %s: %v", path+backupFileSuffix, err)
+		}
+	}
+}
+
+// syncDirectories flushes directory entries of provided files to disk, so renames survive a power loss.
+func syncDirectories(paths []string) error {
+	synced := make(map[string]bool)
+
+	for _, path := range paths {
+		directory := filepath.Dir(path)
+		if synced[directory] {
+			continue
+		}
+
+		fd, err := os.Open(directory)
+		if err != nil {
+			return err
+		}
+
+		err = fd.Sync()
+		_ = fd.Close()
+
+		if err != nil {
+			return err
+		}
+
+		synced[directory] = true
+	}
+
+	return nil
+}
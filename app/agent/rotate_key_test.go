@@ -0,0 +1,156 @@
+// Copyright 2023 qbee.io
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package agent
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// readTestFiles returns contents of provided files ("" for missing files).
+func readTestFiles(t *testing.T, paths ...string) []string {
+	contents := make([]string, 0, len(paths))
+
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil && !os.IsNotExist(err) {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		contents = append(contents, string(data))
+	}
+
+	return contents
+}
+
+func Test_swapFiles(t *testing.T) {
+	dir := t.TempDir()
+	keyPath := filepath.Join(dir, "key")
+	certPath := filepath.Join(dir, "cert")
+
+	writeTestFile(t, keyPath, []byte("old key"))
+	writeTestFile(t, certPath, []byte("old cert"))
+
+	if err := swapFiles(map[string][]byte{keyPath: []byte("new key"), certPath: []byte("new cert")}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	got := readTestFiles(t, keyPath, certPath)
+	if got[0] != "new key" || got[1] != "new cert" {
+		t.Fatalf("expected new contents, got %v", got)
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(entries) != 2 {
+		t.Fatalf("expected no temporary files left, got %d entries", len(entries))
+	}
+}
+
+func Test_swapFiles_Failure(t *testing.T) {
+	dir := t.TempDir()
+	certPath := filepath.Join(dir, "cert")
+	keyPath := filepath.Join(dir, "key")
+
+	writeTestFile(t, certPath, []byte("old cert"))
+	writeTestFile(t, keyPath, []byte("old key"))
+
+	// new key cannot be written, so the swap fails after the certificate was prepared
+	if err := os.MkdirAll(filepath.Join(keyPath+rotatedFileSuffix, "blocker"), 0700); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if err := swapFiles(map[string][]byte{keyPath: []byte("new key"), certPath: []byte("new cert")}); err == nil {
+		t.Fatalf("expected error")
+	}
+
+	got := readTestFiles(t, keyPath, certPath, certPath+rotatedFileSuffix, certPath+backupFileSuffix)
+	if got[0] != "old key" || got[1] != "old cert" || got[2] != "" || got[3] != "" {
+		t.Fatalf("expected old contents without temporary files, got %v", got)
+	}
+}
+
+func Test_recoverSwappedFiles(t *testing.T) {
+	tests := []struct {
+		name string
+		// files present after the crash (path suffix -> contents)
+		key  map[string]string
+		cert map[string]string
+		want []string
+	}{
+		{
+			name: "crashed while writing new files",
+			key:  map[string]string{"": "old key", rotatedFileSuffix: "new key", backupFileSuffix: "old key"},
+			cert: map[string]string{"": "old cert", rotatedFileSuffix: "new"},
+			want: []string{"old key", "old cert"},
+		},
+		{
+			name: "crashed while replacing files",
+			key:  map[string]string{"": "new key", backupFileSuffix: "old key"},
+			cert: map[string]string{"": "old cert", rotatedFileSuffix: "new cert", backupFileSuffix: "old cert"},
+			want: []string{"old key", "old cert"},
+		},
+		{
+			name: "crashed while removing backups",
+			key:  map[string]string{"": "new key"},
+			cert: map[string]string{"": "new cert", backupFileSuffix: "old cert"},
+			want: []string{"new key", "new cert"},
+		},
+		{
+			name: "crashed while rolling back",
+			key:  map[string]string{"": "old key", rotatedFileSuffix: "new key"},
+			cert: map[string]string{"": "old cert"},
+			want: []string{"old key", "old cert"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			keyPath := filepath.Join(dir, "key")
+			certPath := filepath.Join(dir, "cert")
+
+			for suffix, contents := range tt.key {
+				writeTestFile(t, keyPath+suffix, []byte(contents))
+			}
+
+			for suffix, contents := range tt.cert {
+				writeTestFile(t, certPath+suffix, []byte(contents))
+			}
+
+			recoverSwappedFiles([]string{keyPath, certPath})
+
+			got := readTestFiles(t, keyPath, certPath)
+			if got[0] != tt.want[0] || got[1] != tt.want[1] {
+				t.Fatalf("expected %v, got %v", tt.want, got)
+			}
+
+			entries, err := os.ReadDir(dir)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if len(entries) != 2 {
+				t.Fatalf("expected no temporary files left, got %d entries", len(entries))
+			}
+		})
+	}
+}
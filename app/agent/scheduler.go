@@ -0,0 +1,65 @@
+// Copyright 2023 qbee.io
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package agent
+
+import (
+	"math/rand"
+	"time"
+)
+
+const (
+	// defaultRunSplayPercent is the default maximum offset of scheduled runs (as percentage of the run interval).
+	defaultRunSplayPercent = 10
+
+	// maxRunSplayPercent limits the offset, so scheduled runs are never more than 50% off the run interval.
+	maxRunSplayPercent = 50
+)
+
+// runSplayPercent returns maximum offset of scheduled runs based on agent's configuration.
+func runSplayPercent(cfg *Config) int {
+	if cfg.DisableRunSplay {
+		return 0
+	}
+
+	if cfg.RunSplayPercent <= 0 {
+		return defaultRunSplayPercent
+	}
+
+	if cfg.RunSplayPercent > maxRunSplayPercent {
+		return maxRunSplayPercent
+	}
+
+	return cfg.RunSplayPercent
+}
+
+// splayInterval returns run interval with a random offset of up to ±splayPercent% applied.
+// This spreads runs of devices bootstrapped at the same time, so they don't contact the device hub in sync.
+func splayInterval(interval time.Duration, splayPercent int) time.Duration {
+	maxOffset := int64(interval) * int64(splayPercent) / 100
+	if maxOffset <= 0 {
+		return interval
+	}
+
+	offset := rand.Int63n(2*maxOffset+1) - maxOffset
+
+	return interval + time.Duration(offset)
+}
+
+// nextScheduledRun returns duration until the next scheduled run.
+func (agent *Agent) nextScheduledRun() time.Duration {
+	return splayInterval(agent.Configuration.RunInterval(), agent.runSplayPercent)
+}
@@ -0,0 +1,69 @@
+// Copyright 2023 qbee.io
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package agent
+
+import (
+	"testing"
+	"time"
+)
+
+func Test_splayInterval(t *testing.T) {
+	interval := 5 * time.Minute
+	minInterval, maxInterval := 4*time.Minute+30*time.Second, 5*time.Minute+30*time.Second
+
+	distinct := make(map[time.Duration]bool)
+
+	// consecutive scheduled runs are offset within ±10% of the interval
+	for i := 0; i < 1000; i++ {
+		next := splayInterval(interval, 10)
+
+		if next < minInterval || next > maxInterval {
+			t.Fatalf("scheduled run offset out of bounds: %s", next)
+		}
+
+		distinct[next] = true
+	}
+
+	if len(distinct) < 2 {
+		t.Fatalf("expected scheduled runs to be offset randomly")
+	}
+
+	if next := splayInterval(interval, 0); next != interval {
+		t.Fatalf("expected no offset with splay disabled, got %s", next)
+	}
+}
+
+func Test_runSplayPercent(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  Config
+		want int
+	}{
+		{name: "default", cfg: Config{}, want: defaultRunSplayPercent},
+		{name: "configured", cfg: Config{RunSplayPercent: 25}, want: 25},
+		{name: "capped", cfg: Config{RunSplayPercent: 90}, want: maxRunSplayPercent},
+		{name: "disabled", cfg: Config{RunSplayPercent: 25, DisableRunSplay: true}, want: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := runSplayPercent(&tt.cfg); got != tt.want {
+				t.Fatalf("expected %d, got %d", tt.want, got)
+			}
+		})
+	}
+}
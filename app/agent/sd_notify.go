@@ -0,0 +1,83 @@
+// Copyright 2023 qbee.io
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package agent
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"time"
+)
+
+// systemd notification states sent by the agent.
+const (
+	sdNotifyReady    = "READY=1"
+	sdNotifyWatchdog = "WATCHDOG=1"
+	sdNotifyStopping = "STOPPING=1"
+)
+
+// maxRunDuration returns the duration after which a run in progress is considered hung.
+func maxRunDuration(cfg *Config) time.Duration {
+	if cfg.MaxRunDuration <= 0 {
+		return defaultMaxRunDuration
+	}
+
+	return time.Duration(cfg.MaxRunDuration) * time.Second
+}
+
+// sdNotify sends a state notification to systemd (see sd_notify(3)).
+// It's a no-op when the agent is not started by systemd with a notification socket (NOTIFY_SOCKET unset).
+func sdNotify(state string) error {
+	socketPath := os.Getenv("NOTIFY_SOCKET")
+	if socketPath == "" {
+		return nil
+	}
+
+	// socket path starting with @ refers to the abstract namespace
+	if socketPath[0] == '@' {
+		socketPath = "\x00" + socketPath[1:]
+	}
+
+	conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: socketPath, Net: "unixgram"})
+	if err != nil {
+		return fmt.Errorf("error connecting to systemd notification socket: %w", err)
+	}
+	defer conn.Close()
+
+	if _, err = conn.Write([]byte(state)); err != nil {
+		return fmt.Errorf("error sending systemd notification: %w", err)
+	}
+
+	return nil
+}
+
+// sdWatchdogInterval returns how often the systemd watchdog should be notified (half of WatchdogSec=),
+// or zero when the watchdog is not enabled for the agent process.
+func sdWatchdogInterval() time.Duration {
+	usec, err := strconv.ParseInt(os.Getenv("WATCHDOG_USEC"), 10, 64)
+	if err != nil || usec <= 0 {
+		return 0
+	}
+
+	// watchdog settings might be inherited from a parent process, so they are used only when meant for the agent
+	if pid := os.Getenv("WATCHDOG_PID"); pid != "" && pid != strconv.Itoa(os.Getpid()) {
+		return 0
+	}
+
+	return time.Duration(usec) * time.Microsecond / 2
+}
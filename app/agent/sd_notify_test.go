@@ -0,0 +1,137 @@
+// Copyright 2023 qbee.io
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package agent
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// listenNotifySocket creates a systemd notification socket and sets NOTIFY_SOCKET to its path.
+func listenNotifySocket(t *testing.T) *net.UnixConn {
+	socketPath := filepath.Join(t.TempDir(), "notify.sock")
+
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: socketPath, Net: "unixgram"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	t.Cleanup(func() { _ = conn.Close() })
+
+	t.Setenv("NOTIFY_SOCKET", socketPath)
+
+	return conn
+}
+
+// readNotification returns the next notification received on the socket (or empty string if there is none).
+func readNotification(t *testing.T, conn *net.UnixConn) string {
+	if err := conn.SetReadDeadline(time.Now().Add(100 * time.Millisecond)); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	buf := make([]byte, 64)
+
+	n, err := conn.Read(buf)
+	if err != nil {
+		return ""
+	}
+
+	return string(buf[:n])
+}
+
+func Test_sdNotify(t *testing.T) {
+	t.Setenv("NOTIFY_SOCKET", "")
+
+	// no-op when not started by systemd
+	if err := sdNotify(sdNotifyReady); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	conn := listenNotifySocket(t)
+
+	if err := sdNotify(sdNotifyReady); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if got := readNotification(t, conn); got != sdNotifyReady {
+		t.Errorf("expected %q, got %q", sdNotifyReady, got)
+	}
+}
+
+func Test_sdWatchdogInterval(t *testing.T) {
+	tests := []struct {
+		name     string
+		usec     string
+		pid      string
+		interval time.Duration
+	}{
+		{name: "watchdog disabled"},
+		{name: "invalid value", usec: "abc"},
+		{name: "watchdog enabled", usec: "30000000", interval: 15 * time.Second},
+		{name: "watchdog for the agent", usec: "30000000", pid: strconv.Itoa(os.Getpid()), interval: 15 * time.Second},
+		{name: "watchdog for other process", usec: "30000000", pid: "1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("WATCHDOG_USEC", tt.usec)
+			t.Setenv("WATCHDOG_PID", tt.pid)
+
+			if got := sdWatchdogInterval(); got != tt.interval {
+				t.Errorf("expected %s, got %s", tt.interval, got)
+			}
+		})
+	}
+}
+
+func TestAgent_notifyWatchdog(t *testing.T) {
+	conn := listenNotifySocket(t)
+
+	agent := &Agent{maxRunDuration: maxRunDuration(&Config{MaxRunDuration: 600})}
+
+	agent.notifyWatchdog()
+	if got := readNotification(t, conn); got != sdNotifyWatchdog {
+		t.Errorf("expected %q, got %q", sdNotifyWatchdog, got)
+	}
+
+	// watchdog is notified during a run
+	agent.runStarted.Store(time.Now().Add(-time.Minute).Unix())
+	agent.notifyWatchdog()
+	if got := readNotification(t, conn); got != sdNotifyWatchdog {
+		t.Errorf("expected %q, got %q", sdNotifyWatchdog, got)
+	}
+
+	// but not when the run seems to be hung
+	agent.runStarted.Store(time.Now().Add(-11 * time.Minute).Unix())
+	agent.notifyWatchdog()
+	if got := readNotification(t, conn); got != "" {
+		t.Errorf("expected no notification, got %q", got)
+	}
+}
+
+func Test_maxRunDuration(t *testing.T) {
+	if got := maxRunDuration(&Config{}); got != defaultMaxRunDuration {
+		t.Errorf("expected %s, got %s", defaultMaxRunDuration, got)
+	}
+
+	if got := maxRunDuration(&Config{MaxRunDuration: 600}); got != 10*time.Minute {
+		t.Errorf("expected %s, got %s", 10*time.Minute, got)
+	}
+}
@@ -19,29 +19,63 @@ package agent
 import (
 	"context"
 	"fmt"
+
+	"go.qbee.io/agent/app/configuration"
 )
 
 // Start starts the agent.
 func Start(ctx context.Context, cfg *Config) error {
 	agent, err := New(cfg)
 	if err != nil {
+		recordStartupError(cfg, err)
 		return fmt.Errorf("error initializing the agent: %w", err)
 	}
 
+	agent.checkStartup()
+
 	return agent.Run(ctx)
 }
 
 // RunOnce starts the agent and exits after the first run.
 func RunOnce(ctx context.Context, cfg *Config) error {
+	agent, err := New(cfg)
+	if err != nil {
+		recordStartupError(cfg, err)
+		return fmt.Errorf("error initializing the agent: %w", err)
+	}
+
+	agent.checkStartup()
+
+	agent.disableRemoteAccess = true
+	agent.RunOnce(ctx, FullRun)
+
+	agent.Wait()
+
+	return nil
+}
+
+// RunOnceWithReports starts the agent, prints configuration reports to console and exits after the first run.
+// Returns an error when configuration was not applied or when any configuration bundle failed.
+func RunOnceWithReports(ctx context.Context, cfg *Config, format configuration.ReportFormat) error {
 	agent, err := New(cfg)
 	if err != nil {
 		return fmt.Errorf("error initializing the agent: %w", err)
 	}
 
 	agent.disableRemoteAccess = true
+	agent.Configuration.EnableConsoleReporting()
+	agent.Configuration.SetConsoleReportFormat(format)
 	agent.RunOnce(ctx, FullRun)
 
 	agent.Wait()
 
+	if agent.Configuration.AgentRunInventory() == nil {
+		return fmt.Errorf("configuration was not applied")
+	}
+
+	if agent.Configuration.LastRunFailed() {
+		return fmt.Errorf("configuration applied with errors")
+	}
+
 	return nil
 }
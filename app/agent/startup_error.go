@@ -0,0 +1,109 @@
+// Copyright 2024 qbee.io
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package agent
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"time"
+
+	"go.qbee.io/agent/app/configuration"
+	"go.qbee.io/agent/app/log"
+)
+
+// startupError describes which agent startup step failed.
+type startupError struct {
+	step string
+	err  error
+}
+
+// Error returns a string representation of the error.
+func (err *startupError) Error() string {
+	return fmt.Sprintf("%s: %v", err.step, err.err)
+}
+
+// Unwrap returns the underlying error.
+func (err *startupError) Unwrap() error {
+	return err.err
+}
+
+// newStartupError returns an error of the failed startup step (or nil if err is nil).
+func newStartupError(step string, err error) error {
+	if err == nil {
+		return nil
+	}
+
+	return &startupError{step: step, err: err}
+}
+
+// recordStartupError records a failed agent startup as a report, delivered by the next successful agent run.
+func recordStartupError(cfg *Config, err error) {
+	step := "initialize the agent"
+
+	var stepErr *startupError
+	if errors.As(err, &stepErr) {
+		step, err = stepErr.step, stepErr.err
+	}
+
+	appDirectory := filepath.Join(cfg.StateDirectory, appWorkingDirectory)
+
+	if recordErr := configuration.RecordStartupError(appDirectory, step, err); recordErr != nil {
+		log.Errorf("failed to record startup error: %v", recordErr)
+	}
+}
+
+// checkStateDirectories returns an error if the agent's state or cache directory is not writable
+// (e.g. when the state directory is located on a read-only rootfs).
+func checkStateDirectories(stateDirectory string) error {
+	appDirectory := filepath.Join(stateDirectory, appWorkingDirectory)
+
+	for _, directory := range []string{appDirectory, filepath.Join(appDirectory, cacheDirectory)} {
+		if err := checkDirectoryWritable(directory); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// checkStartup records problems which don't prevent the agent from starting (e.g. expired certificate),
+// or forgets previously recorded startup error when there are none.
+func (agent *Agent) checkStartup() {
+	if err := checkStateDirectories(agent.cfg.StateDirectory); err != nil {
+		log.Errorf("agent state is not writable: %v", err)
+		recordStartupError(agent.cfg, newStartupError("check state directories", err))
+		return
+	}
+
+	if notAfter := agent.certificate.NotAfter; time.Now().After(notAfter) {
+		err := fmt.Errorf("certificate expired on %s", notAfter.UTC().Format(time.RFC3339))
+		recordStartupError(agent.cfg, newStartupError("check device certificate", err))
+		return
+	}
+
+	if certificateRenewalDue(agent.certificate, time.Now()) {
+		log.Warnf("device certificate expires in %d days, it will be renewed during the next run",
+			certificateDaysToExpiry(agent.certificate, time.Now()))
+	}
+
+	appDirectory := filepath.Join(agent.cfg.StateDirectory, appWorkingDirectory)
+
+	if err := configuration.ClearStartupError(appDirectory); err != nil {
+		log.Errorf("failed to clear startup error: %v", err)
+	}
+}
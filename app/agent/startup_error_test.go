@@ -0,0 +1,64 @@
+// Copyright 2024 qbee.io
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package agent
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"go.qbee.io/agent/app/configuration"
+	"go.qbee.io/agent/app/utils/assert"
+)
+
+func Test_recordStartupError(t *testing.T) {
+	cfg := &Config{StateDirectory: t.TempDir()}
+	appDirectory := filepath.Join(cfg.StateDirectory, appWorkingDirectory)
+	assert.NoError(t, os.MkdirAll(appDirectory, 0700))
+
+	err := newStartupError("load CA certificate", errors.New("cannot read /etc/qbee/ppkeys/qbee-ca-cert.server"))
+	assert.Equal(t, err.Error(), "load CA certificate: cannot read /etc/qbee/ppkeys/qbee-ca-cert.server")
+
+	recordStartupError(cfg, err)
+
+	buffer, openErr := os.Open(filepath.Join(appDirectory, "reports.jsonl"))
+	assert.NoError(t, openErr)
+	defer buffer.Close()
+
+	scanner := bufio.NewScanner(buffer)
+	assert.True(t, scanner.Scan())
+
+	var report configuration.Report
+	assert.NoError(t, json.Unmarshal(scanner.Bytes(), &report))
+	assert.Equal(t, report.Text, "Agent startup failed: load CA certificate.")
+	assert.False(t, scanner.Scan())
+}
+
+func Test_checkStateDirectories(t *testing.T) {
+	stateDirectory := t.TempDir()
+	assert.NoError(t, checkStateDirectories(stateDirectory))
+
+	// cache directory cannot be created when its path is taken by a file
+	appDirectory := filepath.Join(stateDirectory, appWorkingDirectory)
+	assert.NoError(t, os.MkdirAll(appDirectory, 0700))
+	assert.NoError(t, os.WriteFile(filepath.Join(appDirectory, cacheDirectory), nil, 0600))
+
+	assert.NotEqual(t, checkStateDirectories(stateDirectory), nil)
+}
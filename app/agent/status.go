@@ -0,0 +1,178 @@
+// Copyright 2024 qbee.io
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package agent
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net"
+	"os"
+	"path/filepath"
+	"time"
+
+	"go.qbee.io/agent/app/configuration"
+	"go.qbee.io/agent/app/log"
+)
+
+const (
+	statusSocketFilename = "status.sock"
+	statusSocketMode     = 0600
+	statusTimeout        = 5 * time.Second
+)
+
+// statusSocketPath returns path of the local status socket.
+func statusSocketPath(cfg *Config) string {
+	return filepath.Join(cfg.StateDirectory, statusSocketFilename)
+}
+
+// serveStatus starts serving configuration status on the local Unix socket.
+// Socket is bound in a private directory and moved into place once its permissions are set,
+// so it's never accessible by other users.
+// Returns the listener, which should be closed when the agent stops.
+func (agent *Agent) serveStatus() (net.Listener, error) {
+	socketPath := statusSocketPath(agent.cfg)
+
+	if err := removeStaleStatusSocket(socketPath); err != nil {
+		return nil, err
+	}
+
+	privateDirectory, err := os.MkdirTemp(filepath.Dir(socketPath), ".status-")
+	if err != nil {
+		return nil, fmt.Errorf("error creating status socket directory: %w", err)
+	}
+	defer os.RemoveAll(privateDirectory)
+
+	privateSocketPath := filepath.Join(privateDirectory, statusSocketFilename)
+
+	unixListener, err := net.ListenUnix("unix", &net.UnixAddr{Name: privateSocketPath, Net: "unix"})
+	if err != nil {
+		return nil, fmt.Errorf("error creating status socket: %w", err)
+	}
+
+	// socket is moved, so it's removed by statusListener instead
+	unixListener.SetUnlinkOnClose(false)
+
+	if err = os.Chmod(privateSocketPath, statusSocketMode); err != nil {
+		_ = unixListener.Close()
+		return nil, fmt.Errorf("error setting status socket permissions: %w", err)
+	}
+
+	if err = os.Rename(privateSocketPath, socketPath); err != nil {
+		_ = unixListener.Close()
+		return nil, fmt.Errorf("error creating status socket: %w", err)
+	}
+
+	listener := &statusListener{UnixListener: unixListener, path: socketPath}
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				if !errors.Is(err, net.ErrClosed) {
+					log.Errorf("status socket error: %v", err)
+				}
+				return
+			}
+
+			go agent.writeStatus(conn)
+		}
+	}()
+
+	return listener, nil
+}
+
+// statusListener removes the status socket when closed.
+type statusListener struct {
+	*net.UnixListener
+	path string
+}
+
+// Close stops listening and removes the status socket.
+func (listener *statusListener) Close() error {
+	err := listener.UnixListener.Close()
+
+	if removeErr := os.Remove(listener.path); removeErr != nil && !errors.Is(removeErr, fs.ErrNotExist) && err == nil {
+		err = removeErr
+	}
+
+	return err
+}
+
+// removeStaleStatusSocket removes status socket left by an agent which wasn't stopped gracefully.
+// Files which are not sockets and sockets of a running agent are left in place.
+func removeStaleStatusSocket(socketPath string) error {
+	fileInfo, err := os.Lstat(socketPath)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil
+		}
+		return fmt.Errorf("error checking status socket: %w", err)
+	}
+
+	if fileInfo.Mode().Type() != fs.ModeSocket {
+		return fmt.Errorf("cannot create status socket: %s is not a socket", socketPath)
+	}
+
+	if conn, dialErr := net.DialTimeout("unix", socketPath, statusTimeout); dialErr == nil {
+		_ = conn.Close()
+		return fmt.Errorf("cannot create status socket: %s is used by another agent", socketPath)
+	}
+
+	if err = os.Remove(socketPath); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("error removing stale status socket: %w", err)
+	}
+
+	return nil
+}
+
+// writeStatus writes configuration status as JSON to the connection and closes it.
+func (agent *Agent) writeStatus(conn net.Conn) {
+	defer conn.Close()
+
+	_ = conn.SetWriteDeadline(time.Now().Add(statusTimeout))
+
+	status := agent.Configuration.Status()
+	if agent.certificate != nil {
+		status.CertificateNotAfter = agent.certificate.NotAfter.Unix()
+	}
+
+	if err := json.NewEncoder(conn).Encode(status); err != nil {
+		log.Debugf("failed to write status: %v", err)
+	}
+}
+
+// GetStatus returns configuration status from the running agent.
+func GetStatus(cfg *Config) (*configuration.Status, error) {
+	socketPath := statusSocketPath(cfg)
+
+	conn, err := net.DialTimeout("unix", socketPath, statusTimeout)
+	if err != nil {
+		return nil, fmt.Errorf("agent is not running (cannot connect to %s): %w", socketPath, err)
+	}
+	defer conn.Close()
+
+	_ = conn.SetReadDeadline(time.Now().Add(statusTimeout))
+
+	status := new(configuration.Status)
+	if err = json.NewDecoder(conn).Decode(status); err != nil {
+		return nil, fmt.Errorf("error reading agent status: %w", err)
+	}
+
+	return status, nil
+}
@@ -0,0 +1,115 @@
+// Copyright 2023 qbee.io
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package agent
+
+import (
+	"net"
+	"os"
+	"testing"
+
+	"go.qbee.io/agent/app/configuration"
+)
+
+func TestGetStatus(t *testing.T) {
+	cfg := &Config{StateDirectory: t.TempDir()}
+
+	// agent not running
+	if _, err := GetStatus(cfg); err == nil {
+		t.Fatalf("expected error when agent is not running")
+	}
+
+	agent := &Agent{
+		cfg:           cfg,
+		Configuration: configuration.New(nil, cfg.StateDirectory, cfg.StateDirectory),
+	}
+
+	listener, err := agent.serveStatus()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer listener.Close()
+
+	socketInfo, err := os.Stat(statusSocketPath(cfg))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if socketInfo.Mode().Perm() != statusSocketMode {
+		t.Errorf("expected socket mode %o, got %o", statusSocketMode, socketInfo.Mode().Perm())
+	}
+
+	status, err := GetStatus(cfg)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if status.LastRun != 0 || status.RebootPending || len(status.Bundles) != 0 {
+		t.Errorf("unexpected status before the first run: %+v", status)
+	}
+}
+
+func TestAgent_serveStatus_existingPath(t *testing.T) {
+	cfg := &Config{StateDirectory: t.TempDir()}
+
+	agent := &Agent{
+		cfg:           cfg,
+		Configuration: configuration.New(nil, cfg.StateDirectory, cfg.StateDirectory),
+	}
+
+	// regular files are not removed
+	if err := os.WriteFile(statusSocketPath(cfg), []byte("data"), 0600); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if _, err := agent.serveStatus(); err == nil {
+		t.Fatalf("expected error when status socket path is not a socket")
+	}
+
+	if err := os.Remove(statusSocketPath(cfg)); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// stale socket is replaced
+	staleListener, err := net.Listen("unix", statusSocketPath(cfg))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	staleListener.(*net.UnixListener).SetUnlinkOnClose(false)
+	_ = staleListener.Close()
+
+	listener, err := agent.serveStatus()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// socket of a running agent is not replaced
+	if _, err = agent.serveStatus(); err == nil {
+		t.Fatalf("expected error when status socket is in use")
+	}
+
+	if _, err = GetStatus(cfg); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if err = listener.Close(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if _, err = os.Stat(statusSocketPath(cfg)); !os.IsNotExist(err) {
+		t.Fatalf("expected status socket to be removed, got %v", err)
+	}
+}
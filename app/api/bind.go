@@ -0,0 +1,125 @@
+// Copyright 2023 qbee.io
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package api
+
+import (
+	"fmt"
+	"net"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+// LocalBinding defines local address and/or network interface used for outgoing device hub connections.
+type LocalBinding struct {
+	// Address is a local IP address used as the source address of connections.
+	Address string
+
+	// Interface is a name of the network interface connections are bound to (SO_BINDTODEVICE).
+	Interface string
+}
+
+// IsSet returns true if any binding is defined.
+func (binding LocalBinding) IsSet() bool {
+	return binding.Address != "" || binding.Interface != ""
+}
+
+// Validate returns an error if the binding is invalid (e.g. the address is not a valid IP address).
+func (binding LocalBinding) Validate() error {
+	if binding.Address != "" && net.ParseIP(binding.Address) == nil {
+		return fmt.Errorf("invalid bind address %s", binding.Address)
+	}
+
+	return nil
+}
+
+// Available returns an error if the address is not assigned to a local network interface (or the provided one),
+// or if the network interface doesn't exist. Interfaces and addresses may appear later (e.g. when a modem connects),
+// and binding is applied to every new connection, so connections succeed once the binding becomes available.
+func (binding LocalBinding) Available() error {
+	if !binding.IsSet() {
+		return nil
+	}
+
+	var ifaceAddrs []net.Addr
+	var err error
+
+	if binding.Interface != "" {
+		var iface *net.Interface
+		if iface, err = net.InterfaceByName(binding.Interface); err != nil {
+			return fmt.Errorf("network interface %s not found: %w", binding.Interface, err)
+		}
+
+		if ifaceAddrs, err = iface.Addrs(); err != nil {
+			return fmt.Errorf("cannot get addresses of network interface %s: %w", binding.Interface, err)
+		}
+	} else if ifaceAddrs, err = net.InterfaceAddrs(); err != nil {
+		return fmt.Errorf("cannot get addresses of network interfaces: %w", err)
+	}
+
+	if binding.Address == "" {
+		return nil
+	}
+
+	ip := net.ParseIP(binding.Address)
+	if ip == nil {
+		return fmt.Errorf("invalid bind address %s", binding.Address)
+	}
+
+	for _, addr := range ifaceAddrs {
+		if ipNet, ok := addr.(*net.IPNet); ok && ipNet.IP.Equal(ip) {
+			return nil
+		}
+	}
+
+	if binding.Interface != "" {
+		return fmt.Errorf("bind address %s is not assigned to network interface %s", binding.Address, binding.Interface)
+	}
+
+	return fmt.Errorf("bind address %s is not assigned to any network interface", binding.Address)
+}
+
+// apply sets local address and interface binding on the dialer.
+func (binding LocalBinding) apply(dialer *net.Dialer) {
+	if binding.Address != "" {
+		dialer.LocalAddr = &net.TCPAddr{IP: net.ParseIP(binding.Address)}
+	}
+
+	if binding.Interface != "" {
+		dialer.Control = bindToDevice(binding.Interface)
+	}
+}
+
+// bindToDevice returns dialer control function binding sockets to the network interface.
+func bindToDevice(iface string) func(network, address string, conn syscall.RawConn) error {
+	return func(_, _ string, conn syscall.RawConn) error {
+		var bindErr error
+
+		err := conn.Control(func(fd uintptr) {
+			bindErr = unix.SetsockoptString(int(fd), unix.SOL_SOCKET, unix.SO_BINDTODEVICE, iface)
+		})
+		if err != nil {
+			return err
+		}
+
+		if bindErr != nil {
+			return fmt.Errorf("cannot bind to network interface %s: %w", iface, bindErr)
+		}
+
+		return nil
+	}
+}
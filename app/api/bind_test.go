@@ -0,0 +1,120 @@
+// Copyright 2023 qbee.io
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package api
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestLocalBinding_Validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		binding LocalBinding
+		wantErr string
+	}{
+		{name: "not set", binding: LocalBinding{}},
+		{name: "address", binding: LocalBinding{Address: "192.0.2.1"}},
+		{name: "interface", binding: LocalBinding{Interface: "missing0"}},
+		{
+			name:    "invalid address",
+			binding: LocalBinding{Address: "not-an-ip"},
+			wantErr: "invalid bind address not-an-ip",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.binding.Validate()
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				return
+			}
+
+			if err == nil || !strings.HasPrefix(err.Error(), tt.wantErr) {
+				t.Fatalf("expected error %q, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestLocalBinding_Available(t *testing.T) {
+	tests := []struct {
+		name    string
+		binding LocalBinding
+		wantErr string
+	}{
+		{name: "not set", binding: LocalBinding{}},
+		{name: "loopback address", binding: LocalBinding{Address: "127.0.0.1"}},
+		{name: "loopback interface", binding: LocalBinding{Interface: "lo"}},
+		{name: "address of interface", binding: LocalBinding{Address: "127.0.0.1", Interface: "lo"}},
+		{
+			name:    "address not assigned",
+			binding: LocalBinding{Address: "192.0.2.1"},
+			wantErr: "bind address 192.0.2.1 is not assigned to any network interface",
+		},
+		{
+			name:    "address not assigned to interface",
+			binding: LocalBinding{Address: "192.0.2.1", Interface: "lo"},
+			wantErr: "bind address 192.0.2.1 is not assigned to network interface lo",
+		},
+		{
+			name:    "missing interface",
+			binding: LocalBinding{Interface: "missing0"},
+			wantErr: "network interface missing0 not found",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.binding.Available()
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				return
+			}
+
+			if err == nil || !strings.HasPrefix(err.Error(), tt.wantErr) {
+				t.Fatalf("expected error %q, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestClient_WithLocalBinding(t *testing.T) {
+	var remoteAddr string
+
+	client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		remoteAddr = r.RemoteAddr
+		w.WriteHeader(http.StatusOK)
+	}).WithLocalBinding(LocalBinding{Address: "127.0.0.1"})
+
+	if err := client.Get(context.Background(), "/v1/test", nil); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	host, _, err := net.SplitHostPort(remoteAddr)
+	if err != nil || host != "127.0.0.1" {
+		t.Fatalf("unexpected remote address %s", remoteAddr)
+	}
+}
@@ -22,6 +22,7 @@ import (
 	"context"
 	"crypto/tls"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net"
@@ -36,37 +37,87 @@ import (
 // This is used to identify active versions of the agent.
 var UserAgent = "qbee-agent/" + app.Version
 
-// apiCallTimeout defines total request/response time we allow for any API call.
-// This timeout doesn't apply to file downloads.
-const apiCallTimeout = 60 * time.Second
+// Default timeouts of device hub API calls.
+const (
+	defaultConnectTimeout  = 15 * time.Second
+	defaultRequestTimeout  = 60 * time.Second
+	defaultCheckInTimeout  = 20 * time.Second
+	defaultDownloadTimeout = 45 * time.Minute
+)
+
+// Timeouts define time limits of device hub API calls.
+type Timeouts struct {
+	// Connect limits establishing a connection to the device hub (or proxy), including TLS handshake.
+	Connect time.Duration
+
+	// Request limits total request/response time of an API call. It doesn't apply to file downloads.
+	Request time.Duration
+
+	// CheckIn limits total request/response time of the check-in call, which should be fast.
+	CheckIn time.Duration
+
+	// Download limits total time of a file download.
+	Download time.Duration
+}
+
+// withDefaults returns timeouts with defaults applied to non-positive values.
+func (timeouts Timeouts) withDefaults() Timeouts {
+	if timeouts.Connect <= 0 {
+		timeouts.Connect = defaultConnectTimeout
+	}
+
+	if timeouts.Request <= 0 {
+		timeouts.Request = defaultRequestTimeout
+	}
+
+	if timeouts.CheckIn <= 0 {
+		timeouts.CheckIn = defaultCheckInTimeout
+	}
+
+	if timeouts.Download <= 0 {
+		timeouts.Download = defaultDownloadTimeout
+	}
+
+	return timeouts
+}
 
 // Client is a device hub API client.
 type Client struct {
 	host       string
 	port       string
+	basePath   string
 	httpClient *http.Client
+	timeouts   Timeouts
+	resolver   *DoHResolver
+	binding    LocalBinding
 }
 
 // NewClient returns a new device hub client.
 func NewClient(host, port string) *Client {
 	return &Client{
-		host: host,
-		port: port,
-		httpClient: &http.Client{
-			Transport: &http.Transport{
-				Proxy: http.ProxyFromEnvironment,
-				DialContext: (&net.Dialer{
-					Timeout:   15 * time.Second,
-					KeepAlive: 45 * time.Second,
-				}).DialContext,
-				ForceAttemptHTTP2:     true,
-				MaxIdleConns:          5,
-				IdleConnTimeout:       60 * time.Second,
-				TLSHandshakeTimeout:   10 * time.Second,
-				ExpectContinueTimeout: 1 * time.Second,
-			},
-			Timeout: 45 * time.Minute,
+		host:       host,
+		port:       port,
+		httpClient: NewHTTPClient(),
+		timeouts:   Timeouts{}.withDefaults(),
+	}
+}
+
+// NewHTTPClient returns a new HTTP client using agent's proxy settings and system's trusted CA certificates.
+func NewHTTPClient() *http.Client {
+	return &http.Client{
+		Transport: &http.Transport{
+			Proxy: ProxyFromEnvironment,
+			DialContext: (&net.Dialer{
+				Timeout:   15 * time.Second,
+				KeepAlive: 45 * time.Second,
+			}).DialContext,
+			ForceAttemptHTTP2:     true,
+			MaxIdleConns:          5,
+			IdleConnTimeout:       60 * time.Second,
+			TLSHandshakeTimeout:   10 * time.Second,
+			ExpectContinueTimeout: 1 * time.Second,
 		},
+		Timeout: 45 * time.Minute,
 	}
 }
 
@@ -76,8 +127,104 @@ func (cli *Client) WithTLSConfig(config *tls.Config) *Client {
 	return cli
 }
 
+// WithResolver makes the client resolve its device hub host using provided DNS-over-HTTPS resolver.
+// Connections to other hosts (e.g. a proxy server) use the system resolver.
+func (cli *Client) WithResolver(resolver *DoHResolver) *Client {
+	cli.resolver = resolver
+	cli.configureTransport()
+	return cli
+}
+
+// WithTimeouts sets time limits of API calls. Non-positive values use the defaults.
+func (cli *Client) WithTimeouts(timeouts Timeouts) *Client {
+	cli.timeouts = timeouts.withDefaults()
+	cli.configureTransport()
+	return cli
+}
+
+// WithLocalBinding makes the client connect from provided local address and/or network interface.
+// Binding applies to all connections made by the client, including connections to the proxy server.
+// Binding should be validated (see LocalBinding.Validate) before it's used.
+func (cli *Client) WithLocalBinding(binding LocalBinding) *Client {
+	cli.binding = binding
+	cli.configureTransport()
+	return cli
+}
+
+// Timeouts returns time limits of API calls.
+func (cli *Client) Timeouts() Timeouts {
+	return cli.timeouts
+}
+
+// configureTransport applies connect timeout, local binding and resolver to the HTTP client.
+func (cli *Client) configureTransport() {
+	dialer := &net.Dialer{
+		Timeout:   cli.timeouts.Connect,
+		KeepAlive: 45 * time.Second,
+	}
+
+	cli.binding.apply(dialer)
+
+	transport := cli.httpClient.Transport.(*http.Transport)
+	transport.TLSHandshakeTimeout = cli.timeouts.Connect
+
+	if cli.resolver != nil {
+		transport.DialContext = cli.resolver.DialContext(dialer, cli.host)
+	} else {
+		transport.DialContext = dialer.DialContext
+	}
+
+	cli.httpClient.Timeout = cli.timeouts.Download
+}
+
+// NewDownloadClient returns an HTTP client for downloads from URLs outside the device hub.
+// The client trusts the same CA certificates and uses the same dialer (connect timeout, local binding and resolver)
+// as the API client, but doesn't authenticate with the device certificate.
+func (cli *Client) NewDownloadClient() *http.Client {
+	httpClient := NewHTTPClient()
+	transport := httpClient.Transport.(*http.Transport)
+	apiTransport := cli.httpClient.Transport.(*http.Transport)
+
+	if apiTransport.TLSClientConfig != nil {
+		transport.TLSClientConfig = &tls.Config{RootCAs: apiTransport.TLSClientConfig.RootCAs}
+	}
+
+	transport.DialContext = apiTransport.DialContext
+	transport.TLSHandshakeTimeout = apiTransport.TLSHandshakeTimeout
+	httpClient.Timeout = cli.httpClient.Timeout
+
+	return httpClient
+}
+
+// WithBasePath sets a path prefix for all API calls (e.g. when the device hub is behind a path-prefixing proxy).
+func (cli *Client) WithBasePath(basePath string) *Client {
+	basePath = strings.TrimRight(basePath, "/")
+
+	if basePath != "" && !strings.HasPrefix(basePath, "/") {
+		basePath = "/" + basePath
+	}
+
+	cli.basePath = basePath
+	return cli
+}
+
+// BasePath returns the path prefix used for all API calls.
+func (cli *Client) BasePath() string {
+	return cli.basePath
+}
+
+// Origin returns scheme, host and port of the device hub API (e.g. "https://device.app.qbee.io:443").
+func (cli *Client) Origin() string {
+	return fmt.Sprintf("https://%s:%s", cli.host, cli.port)
+}
+
 // NewRequest returns a new HTTP request for provided method, path and src.
 func (cli *Client) NewRequest(ctx context.Context, method, path string, src any) (*http.Request, error) {
+	return cli.newRequest(ctx, method, path, src, true)
+}
+
+// newRequest returns a new HTTP request for provided method, path and src with optionally gzip-compressed body.
+func (cli *Client) newRequest(ctx context.Context, method, path string, src any, compress bool) (*http.Request, error) {
 	if !strings.HasPrefix(path, "/") {
 		return nil, fmt.Errorf("path %s must start with /", path)
 	}
@@ -92,16 +239,27 @@ func (cli *Client) NewRequest(ctx context.Context, method, path string, src any)
 		}
 	}
 
-	url := fmt.Sprintf("https://%s:%s%s", cli.host, cli.port, path)
+	url := cli.Origin() + cli.basePath + path
+
+	var requestBody io.Reader
+	if body != nil {
+		requestBody = body
+		if compress {
+			requestBody = compressRequestBody(body)
+		}
+	}
 
-	request, err := http.NewRequestWithContext(ctx, method, url, compressRequestBody(body))
+	request, err := http.NewRequestWithContext(ctx, method, url, requestBody)
 	if err != nil {
 		return nil, fmt.Errorf("error initializing http request %s %s: %w", method, path, err)
 	}
 
 	if body != nil {
 		request.Header.Set("Content-Type", "application/json")
-		request.Header.Set("Content-Encoding", "gzip")
+
+		if compress {
+			request.Header.Set("Content-Encoding", "gzip")
+		}
 	}
 
 	return request, nil
@@ -122,6 +280,11 @@ func (cli *Client) Make(request *http.Request, dst any) error {
 
 	if dst != nil {
 		if err = json.NewDecoder(response.Body).Decode(dst); err != nil {
+			// response body is not received in time, which is a connectivity issue rather than invalid response
+			if isTimeout(err) {
+				return NewConnectionError(err)
+			}
+
 			return fmt.Errorf("cannot decode API response body: %w", err)
 		}
 	}
@@ -144,10 +307,20 @@ func (cli *Client) Do(request *http.Request) (*http.Response, error) {
 
 // request creates, sends and processes response for an HTTP request.
 func (cli *Client) request(ctx context.Context, method, path string, src, dst any) error {
-	ctxWithTimeout, cancel := context.WithTimeout(ctx, apiCallTimeout)
+	return cli.doRequest(ctx, method, path, src, dst, true)
+}
+
+// doRequest creates, sends and processes response for an HTTP request with optionally compressed body.
+func (cli *Client) doRequest(ctx context.Context, method, path string, src, dst any, compress bool) error {
+	timeout := cli.timeouts.Request
+	if ctxTimeout, ok := ctx.Value(ctxRequestTimeout).(time.Duration); ok && ctxTimeout > 0 {
+		timeout = ctxTimeout
+	}
+
+	ctxWithTimeout, cancel := context.WithTimeout(ctx, timeout)
 	defer cancel()
 
-	request, err := cli.NewRequest(ctxWithTimeout, method, path, src)
+	request, err := cli.newRequest(ctxWithTimeout, method, path, src, compress)
 	if err != nil {
 		return err
 	}
@@ -155,6 +328,26 @@ func (cli *Client) request(ctx context.Context, method, path string, src, dst an
 	return cli.Make(request, dst)
 }
 
+// contextKey is used to store API call options in the context.
+type contextKey string
+
+const ctxRequestTimeout = contextKey("api:request-timeout")
+
+// WithRequestTimeout returns context overriding request timeout of API calls made with it.
+func WithRequestTimeout(ctx context.Context, timeout time.Duration) context.Context {
+	return context.WithValue(ctx, ctxRequestTimeout, timeout)
+}
+
+// isTimeout returns true if err is caused by an exceeded deadline.
+func isTimeout(err error) bool {
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return true
+	}
+
+	return errors.Is(err, context.DeadlineExceeded)
+}
+
 // Get sends a GET request to device hub.
 func (cli *Client) Get(ctx context.Context, path string, dst any) error {
 	return cli.request(ctx, http.MethodGet, path, nil, dst)
@@ -165,6 +358,11 @@ func (cli *Client) Post(ctx context.Context, path string, src, dst any) error {
 	return cli.request(ctx, http.MethodPost, path, src, dst)
 }
 
+// PostUncompressed sends a POST request to device hub without compressing the request body.
+func (cli *Client) PostUncompressed(ctx context.Context, path string, src, dst any) error {
+	return cli.doRequest(ctx, http.MethodPost, path, src, dst, false)
+}
+
 // Put sends a PUT request to device hub.
 func (cli *Client) Put(ctx context.Context, path string, src, dst any) error {
 	return cli.request(ctx, http.MethodPut, path, src, dst)
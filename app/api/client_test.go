@@ -0,0 +1,164 @@
+// Copyright 2023 qbee.io
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package api
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+)
+
+// newTestClient returns a client connected to a test server using provided handler.
+func newTestClient(t *testing.T, handler http.HandlerFunc) *Client {
+	server := httptest.NewTLSServer(handler)
+	t.Cleanup(server.Close)
+
+	serverURL, err := url.Parse(server.URL)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	host, port, err := net.SplitHostPort(serverURL.Host)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	return NewClient(host, port).WithTLSConfig(&tls.Config{InsecureSkipVerify: true})
+}
+
+// stall blocks the handler until the client gives up (or 5 seconds pass).
+func stall(r *http.Request) {
+	select {
+	case <-r.Context().Done():
+	case <-time.After(5 * time.Second):
+	}
+}
+
+func TestClient_RequestTimeout(t *testing.T) {
+	tests := []struct {
+		name    string
+		handler http.HandlerFunc
+	}{
+		{
+			name: "no response",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				stall(r)
+			},
+		},
+		{
+			name: "incomplete response body",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "application/json")
+				_, _ = w.Write([]byte(`{"status":`))
+				w.(http.Flusher).Flush()
+				stall(r)
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cli := newTestClient(t, tt.handler).WithTimeouts(Timeouts{Request: 100 * time.Millisecond})
+
+			started := time.Now()
+			err := cli.Get(context.Background(), "/test", new(map[string]any))
+
+			if !errors.As(err, new(ConnectionError)) {
+				t.Fatalf("expected connection error, got %v", err)
+			}
+
+			if elapsed := time.Since(started); elapsed > 2*time.Second {
+				t.Errorf("request took %s, timeout was not applied", elapsed)
+			}
+		})
+	}
+}
+
+func TestClient_WithRequestTimeout(t *testing.T) {
+	cli := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(200 * time.Millisecond)
+		_, _ = w.Write([]byte(`{}`))
+	})
+
+	// default request timeout is long enough
+	if err := cli.Get(context.Background(), "/test", nil); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// but per-call timeout is not
+	ctx := WithRequestTimeout(context.Background(), 50*time.Millisecond)
+	if err := cli.Get(ctx, "/test", nil); !errors.As(err, new(ConnectionError)) {
+		t.Fatalf("expected connection error, got %v", err)
+	}
+}
+
+func TestTimeouts_withDefaults(t *testing.T) {
+	timeouts := Timeouts{Request: 5 * time.Second}.withDefaults()
+
+	expected := Timeouts{
+		Connect:  defaultConnectTimeout,
+		Request:  5 * time.Second,
+		CheckIn:  defaultCheckInTimeout,
+		Download: defaultDownloadTimeout,
+	}
+
+	if timeouts != expected {
+		t.Errorf("expected %+v, got %+v", expected, timeouts)
+	}
+}
+
+func TestClient_NewDownloadClient(t *testing.T) {
+	var remoteAddr string
+
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		remoteAddr = r.RemoteAddr
+		w.WriteHeader(http.StatusOK)
+	}))
+	t.Cleanup(server.Close)
+
+	rootCAs := x509.NewCertPool()
+	rootCAs.AddCert(server.Certificate())
+
+	cli := NewClient("example.com", "443").
+		WithTLSConfig(&tls.Config{RootCAs: rootCAs, Certificates: []tls.Certificate{{}}}).
+		WithLocalBinding(LocalBinding{Address: "127.0.0.1"})
+
+	downloadClient := cli.NewDownloadClient()
+
+	tlsConfig := downloadClient.Transport.(*http.Transport).TLSClientConfig
+	if len(tlsConfig.Certificates) != 0 {
+		t.Fatalf("download client must not use the device certificate")
+	}
+
+	response, err := downloadClient.Get(server.URL)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	_ = response.Body.Close()
+
+	host, _, err := net.SplitHostPort(remoteAddr)
+	if err != nil || host != "127.0.0.1" {
+		t.Fatalf("unexpected remote address %s", remoteAddr)
+	}
+}
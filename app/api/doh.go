@@ -0,0 +1,328 @@
+// Copyright 2023 qbee.io
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"go.qbee.io/agent/app/utils/cache"
+)
+
+// DNS record types supported by the DoH resolver.
+const (
+	dnsTypeA    uint16 = 1
+	dnsTypeAAAA uint16 = 28
+	dnsClassIN  uint16 = 1
+)
+
+const (
+	dohContentType    = "application/dns-message"
+	dohRequestTimeout = 10 * time.Second
+	dohMaxResponseLen = 65535
+	dohMinCacheTTL    = time.Minute
+	dohCacheKeyPrefix = "api:doh"
+)
+
+// DoHResolver resolves host names using DNS-over-HTTPS (RFC 8484).
+type DoHResolver struct {
+	url        string
+	httpClient *http.Client
+}
+
+// NewDoHResolver returns a new DNS-over-HTTPS resolver for provided resolver URL (e.g. https://1.1.1.1/dns-query).
+func NewDoHResolver(resolverURL string) (*DoHResolver, error) {
+	parsedURL, err := url.Parse(resolverURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid DoH resolver URL: %w", err)
+	}
+
+	if parsedURL.Scheme != "https" || parsedURL.Host == "" {
+		return nil, fmt.Errorf("invalid DoH resolver URL %s: https URL required", resolverURL)
+	}
+
+	resolver := &DoHResolver{
+		url: resolverURL,
+		httpClient: &http.Client{
+			Transport: &http.Transport{
+				Proxy:             ProxyFromEnvironment,
+				ForceAttemptHTTP2: true,
+			},
+			Timeout: dohRequestTimeout,
+		},
+	}
+
+	return resolver, nil
+}
+
+// WithLocalBinding makes the resolver connect from provided local address and/or network interface.
+// Binding should be validated (see LocalBinding.Validate) before it's used.
+func (resolver *DoHResolver) WithLocalBinding(binding LocalBinding) *DoHResolver {
+	dialer := new(net.Dialer)
+	binding.apply(dialer)
+
+	resolver.httpClient.Transport.(*http.Transport).DialContext = dialer.DialContext
+
+	return resolver
+}
+
+// LookupHost returns IP addresses of provided host (IPv4 addresses first).
+func (resolver *DoHResolver) LookupHost(ctx context.Context, host string) ([]string, error) {
+	if ip := net.ParseIP(host); ip != nil {
+		return []string{host}, nil
+	}
+
+	cacheKey := fmt.Sprintf("%s:%s", dohCacheKeyPrefix, host)
+
+	if cachedAddresses, ok := cache.Get(cacheKey); ok {
+		return cachedAddresses.([]string), nil
+	}
+
+	addresses := make([]string, 0)
+	minTTL := uint32(0)
+
+	for _, recordType := range []uint16{dnsTypeA, dnsTypeAAAA} {
+		records, ttl, err := resolver.query(ctx, host, recordType)
+		if err != nil {
+			return nil, err
+		}
+
+		if len(records) > 0 && (minTTL == 0 || ttl < minTTL) {
+			minTTL = ttl
+		}
+
+		addresses = append(addresses, records...)
+	}
+
+	if len(addresses) == 0 {
+		return nil, fmt.Errorf("no DoH records found for %s", host)
+	}
+
+	cacheTTL := time.Duration(minTTL) * time.Second
+	if cacheTTL < dohMinCacheTTL {
+		cacheTTL = dohMinCacheTTL
+	}
+
+	cache.Set(cacheKey, addresses, cacheTTL)
+
+	return addresses, nil
+}
+
+// query sends a single DNS query to the DoH resolver and returns records with their minimum TTL.
+func (resolver *DoHResolver) query(ctx context.Context, host string, recordType uint16) ([]string, uint32, error) {
+	query, err := encodeDNSQuery(host, recordType)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, resolver.url, bytes.NewReader(query))
+	if err != nil {
+		return nil, 0, fmt.Errorf("error initializing DoH request: %w", err)
+	}
+
+	request.Header.Set("Content-Type", dohContentType)
+	request.Header.Set("Accept", dohContentType)
+	request.Header.Set("User-Agent", UserAgent)
+
+	response, err := resolver.httpClient.Do(request)
+	if err != nil {
+		return nil, 0, fmt.Errorf("error sending DoH request: %w", err)
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		return nil, 0, fmt.Errorf("DoH resolver returned unexpected status: %s", response.Status)
+	}
+
+	responseBody, err := io.ReadAll(io.LimitReader(response.Body, dohMaxResponseLen))
+	if err != nil {
+		return nil, 0, fmt.Errorf("error reading DoH response: %w", err)
+	}
+
+	return decodeDNSResponse(responseBody, recordType)
+}
+
+// DialContext returns a dial function which resolves provided hosts using DoH and passes other addresses to dialer.
+func (resolver *DoHResolver) DialContext(dialer *net.Dialer, hosts ...string) func(context.Context, string, string) (net.Conn, error) {
+	return func(ctx context.Context, network, address string) (net.Conn, error) {
+		host, port, err := net.SplitHostPort(address)
+		if err != nil {
+			return nil, err
+		}
+
+		resolve := false
+		for _, resolvedHost := range hosts {
+			if strings.EqualFold(host, resolvedHost) {
+				resolve = true
+				break
+			}
+		}
+
+		if !resolve {
+			return dialer.DialContext(ctx, network, address)
+		}
+
+		addresses, err := resolver.LookupHost(ctx, host)
+		if err != nil {
+			return nil, err
+		}
+
+		var dialErr error
+		for _, ip := range addresses {
+			var conn net.Conn
+			if conn, dialErr = dialer.DialContext(ctx, network, net.JoinHostPort(ip, port)); dialErr == nil {
+				return conn, nil
+			}
+		}
+
+		return nil, dialErr
+	}
+}
+
+// encodeDNSQuery returns wire-format DNS query for provided host and record type.
+func encodeDNSQuery(host string, recordType uint16) ([]byte, error) {
+	buf := new(bytes.Buffer)
+
+	// header: ID (0 as recommended by RFC 8484), flags (recursion desired), 1 question, no other records
+	header := []uint16{0, 0x0100, 1, 0, 0, 0}
+	for _, field := range header {
+		_ = binary.Write(buf, binary.BigEndian, field)
+	}
+
+	for _, label := range strings.Split(strings.TrimSuffix(host, "."), ".") {
+		if len(label) == 0 || len(label) > 63 {
+			return nil, fmt.Errorf("invalid host name: %s", host)
+		}
+
+		buf.WriteByte(byte(len(label)))
+		buf.WriteString(label)
+	}
+
+	buf.WriteByte(0)
+
+	_ = binary.Write(buf, binary.BigEndian, recordType)
+	_ = binary.Write(buf, binary.BigEndian, dnsClassIN)
+
+	return buf.Bytes(), nil
+}
+
+var errInvalidDNSResponse = errors.New("invalid DNS response")
+
+// dnsResponseCodeNameError is returned by the server when the domain name doesn't exist.
+const dnsResponseCodeNameError = 3
+
+// decodeDNSResponse returns IP addresses of the requested record type from wire-format DNS response,
+// together with the minimum TTL of the returned records.
+func decodeDNSResponse(msg []byte, recordType uint16) ([]string, uint32, error) {
+	if len(msg) < 12 {
+		return nil, 0, errInvalidDNSResponse
+	}
+
+	flags := binary.BigEndian.Uint16(msg[2:4])
+	responseCode := flags & 0x000f
+
+	if responseCode == dnsResponseCodeNameError {
+		return nil, 0, nil
+	}
+
+	if responseCode != 0 {
+		return nil, 0, fmt.Errorf("DNS query failed with response code %d", responseCode)
+	}
+
+	questions := int(binary.BigEndian.Uint16(msg[4:6]))
+	answers := int(binary.BigEndian.Uint16(msg[6:8]))
+
+	offset := 12
+
+	var err error
+	for i := 0; i < questions; i++ {
+		if offset, err = skipDNSName(msg, offset); err != nil {
+			return nil, 0, err
+		}
+
+		// type and class
+		offset += 4
+	}
+
+	records := make([]string, 0)
+	minTTL := uint32(0)
+
+	for i := 0; i < answers; i++ {
+		if offset, err = skipDNSName(msg, offset); err != nil {
+			return nil, 0, err
+		}
+
+		if offset+10 > len(msg) {
+			return nil, 0, errInvalidDNSResponse
+		}
+
+		answerType := binary.BigEndian.Uint16(msg[offset : offset+2])
+		ttl := binary.BigEndian.Uint32(msg[offset+4 : offset+8])
+		dataLength := int(binary.BigEndian.Uint16(msg[offset+8 : offset+10]))
+		offset += 10
+
+		if offset+dataLength > len(msg) {
+			return nil, 0, errInvalidDNSResponse
+		}
+
+		data := msg[offset : offset+dataLength]
+		offset += dataLength
+
+		// skip other record types (e.g. CNAME), since servers return the final records as well
+		if answerType != recordType || (dataLength != net.IPv4len && dataLength != net.IPv6len) {
+			continue
+		}
+
+		records = append(records, net.IP(data).String())
+
+		if minTTL == 0 || ttl < minTTL {
+			minTTL = ttl
+		}
+	}
+
+	return records, minTTL, nil
+}
+
+// skipDNSName returns offset of the first byte after the (possibly compressed) name starting at offset.
+func skipDNSName(msg []byte, offset int) (int, error) {
+	for {
+		if offset >= len(msg) {
+			return 0, errInvalidDNSResponse
+		}
+
+		labelLength := int(msg[offset])
+
+		switch {
+		case labelLength == 0:
+			return offset + 1, nil
+		case labelLength&0xc0 == 0xc0:
+			// compression pointer terminates the name
+			return offset + 2, nil
+		default:
+			offset += labelLength + 1
+		}
+	}
+}
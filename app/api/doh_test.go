@@ -0,0 +1,74 @@
+// Copyright 2023 qbee.io
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package api
+
+import (
+	"encoding/binary"
+	"reflect"
+	"testing"
+)
+
+func Test_decodeDNSResponse(t *testing.T) {
+	query, err := encodeDNSQuery("device.app.qbee.io", dnsTypeA)
+	if err != nil {
+		t.Fatalf("error encoding query: %v", err)
+	}
+
+	// build a response: copy the query, set response flags and 2 answers (CNAME followed by an A record)
+	response := append([]byte{}, query...)
+	binary.BigEndian.PutUint16(response[2:4], 0x8180)
+	binary.BigEndian.PutUint16(response[6:8], 2)
+
+	// CNAME answer with a compressed name pointing to the question name (offset 12)
+	response = append(response, 0xc0, 12)
+	response = binary.BigEndian.AppendUint16(response, 5)
+	response = binary.BigEndian.AppendUint16(response, dnsClassIN)
+	response = binary.BigEndian.AppendUint32(response, 300)
+	response = binary.BigEndian.AppendUint16(response, 2)
+	response = append(response, 0xc0, 12)
+
+	// A answer
+	response = append(response, 0xc0, 12)
+	response = binary.BigEndian.AppendUint16(response, dnsTypeA)
+	response = binary.BigEndian.AppendUint16(response, dnsClassIN)
+	response = binary.BigEndian.AppendUint32(response, 120)
+	response = binary.BigEndian.AppendUint16(response, 4)
+	response = append(response, 192, 0, 2, 10)
+
+	records, ttl, err := decodeDNSResponse(response, dnsTypeA)
+	if err != nil {
+		t.Fatalf("decodeDNSResponse() error = %v", err)
+	}
+
+	if !reflect.DeepEqual(records, []string{"192.0.2.10"}) {
+		t.Errorf("decodeDNSResponse() records = %v", records)
+	}
+
+	if ttl != 120 {
+		t.Errorf("decodeDNSResponse() ttl = %d, want 120", ttl)
+	}
+
+	if _, _, err = decodeDNSResponse(response[:20], dnsTypeA); err == nil {
+		t.Errorf("expected error for truncated response")
+	}
+}
+
+func Test_encodeDNSQuery_invalidHost(t *testing.T) {
+	if _, err := encodeDNSQuery("invalid..host", dnsTypeA); err == nil {
+		t.Errorf("expected error for invalid host")
+	}
+}
@@ -18,43 +18,206 @@ package api
 
 import (
 	"fmt"
+	"net"
+	"net/http"
+	"net/url"
 	"os"
 	"strings"
 )
 
-const proxyEnvVar = "HTTPS_PROXY"
+// Proxy environment variables.
+// Lowercase variants are checked first and set as well (curl based tools use lowercase, eg. rauc).
+const (
+	proxyEnvVar   = "HTTPS_PROXY"
+	noProxyEnvVar = "NO_PROXY"
+)
+
+// ProxyType defines the protocol of the proxy server.
+type ProxyType string
+
+// Supported proxy types.
+const (
+	// ProxyTypeHTTP is an HTTP proxy supporting the CONNECT method (default).
+	ProxyTypeHTTP ProxyType = "http"
+
+	// ProxyTypeSOCKS5 is a SOCKS5 proxy (with optional username/password authentication).
+	ProxyTypeSOCKS5 ProxyType = "socks5"
+)
 
 // Proxy represents a proxy server configuration.
 type Proxy struct {
+	Type     ProxyType
 	Host     string
 	Port     string
 	User     string
 	Password string
+
+	// NoProxy is a list of hosts which should bypass the proxy (see matchNoProxy for supported rules).
+	NoProxy []string
 }
 
-// UseProxy sets HTTP_PROXY environmental variable, so HTTP clients can make use of it.
+// UseProxy sets proxy environmental variables, so HTTP clients (and executed tools) can make use of them.
+// Explicit configuration takes precedence over the environment:
+// - when proxy Host is set, it overrides HTTPS_PROXY from the environment,
+// - when NoProxy is set, it overrides NO_PROXY from the environment.
+// Otherwise, HTTPS_PROXY and NO_PROXY from the environment are used as-is.
 func UseProxy(proxy *Proxy) error {
-	// if proxy server is not specified or proxy is already set in the environment, return nil.
-	if proxy == nil || os.Getenv(proxyEnvVar) != "" {
+	if proxy == nil {
 		return nil
 	}
 
-	proxyURL := fmt.Sprintf("%s:%s", proxy.Host, proxy.Port)
+	if proxy.Host != "" {
+		proxyURL, err := proxy.URL()
+		if err != nil {
+			return err
+		}
+
+		if err = setProxyEnv(proxyEnvVar, proxyURL.String()); err != nil {
+			return fmt.Errorf("error setting up HTTP proxy: %w", err)
+		}
+	}
+
+	if len(proxy.NoProxy) > 0 {
+		if err := setProxyEnv(noProxyEnvVar, strings.Join(proxy.NoProxy, ",")); err != nil {
+			return fmt.Errorf("error setting up HTTP proxy bypass: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// URL returns proxy URL with scheme matching the proxy type.
+// SOCKS5 proxies are dialed by http.Transport directly, so TLS to the target is verified the same way as without proxy.
+func (proxy *Proxy) URL() (*url.URL, error) {
+	scheme := string(proxy.Type)
+
+	switch proxy.Type {
+	case "":
+		scheme = string(ProxyTypeHTTP)
+	case ProxyTypeHTTP, ProxyTypeSOCKS5:
+	default:
+		return nil, fmt.Errorf("unsupported proxy type: %s", proxy.Type)
+	}
+
+	proxyURL := &url.URL{
+		Scheme: scheme,
+		Host:   net.JoinHostPort(proxy.Host, proxy.Port),
+	}
 
 	if proxy.User != "" {
-		proxyURL = fmt.Sprintf("%s:%s@%s", proxy.User, proxy.Password, proxyURL)
+		proxyURL.User = url.UserPassword(proxy.User, proxy.Password)
 	}
 
-	proxyURL = "http://" + proxyURL
+	return proxyURL, nil
+}
 
-	if err := os.Setenv(proxyEnvVar, proxyURL); err != nil {
-		return fmt.Errorf("error setting up HTTP proxy: %w", err)
+// setProxyEnv sets both uppercase and lowercase version of the proxy environment variable.
+func setProxyEnv(name, value string) error {
+	if err := os.Setenv(name, value); err != nil {
+		return err
 	}
 
-	// Set lowercase version of the proxy environment variable as well (curl based tools use lowercase, eg. rauc)
-	if err := os.Setenv(strings.ToLower(proxyEnvVar), proxyURL); err != nil {
-		return fmt.Errorf("error setting up HTTP proxy: %w", err)
+	return os.Setenv(strings.ToLower(name), value)
+}
+
+// getProxyEnv returns value of the proxy environment variable (lowercase version takes precedence).
+func getProxyEnv(name string) string {
+	if value := os.Getenv(strings.ToLower(name)); value != "" {
+		return value
 	}
 
-	return nil
+	return os.Getenv(name)
+}
+
+// ProxyFromEnvironment returns proxy URL for provided request based on HTTPS_PROXY and NO_PROXY variables.
+// Unlike http.ProxyFromEnvironment, the environment is read on every call, so changes made by UseProxy apply
+// to already created clients.
+func ProxyFromEnvironment(request *http.Request) (*url.URL, error) {
+	proxyValue := getProxyEnv(proxyEnvVar)
+	if proxyValue == "" {
+		return nil, nil
+	}
+
+	if matchNoProxy(request.URL.Host, strings.Split(getProxyEnv(noProxyEnvVar), ",")) {
+		return nil, nil
+	}
+
+	if !strings.Contains(proxyValue, "://") {
+		proxyValue = "http://" + proxyValue
+	}
+
+	proxyURL, err := url.Parse(proxyValue)
+	if err != nil {
+		return nil, fmt.Errorf("invalid proxy address %s: %w", proxyValue, err)
+	}
+
+	return proxyURL, nil
+}
+
+// matchNoProxy returns true if provided address (host or host:port) matches any of the NO_PROXY rules.
+// Supported rules:
+// - "*" matches all hosts,
+// - IP address (e.g. "10.0.0.1") matches that address,
+// - CIDR (e.g. "10.0.0.0/8") matches all addresses in the network,
+// - "example.com" matches example.com and all of its subdomains,
+// - ".example.com" matches only subdomains of example.com,
+// - any host rule can be followed by a port (e.g. "example.com:8443") to match only that port.
+func matchNoProxy(address string, rules []string) bool {
+	host, port, err := net.SplitHostPort(address)
+	if err != nil {
+		host = address
+	}
+
+	host = strings.ToLower(strings.Trim(host, "[]"))
+	hostIP := net.ParseIP(host)
+
+	for _, rule := range rules {
+		rule = strings.ToLower(strings.TrimSpace(rule))
+		if rule == "" {
+			continue
+		}
+
+		if rule == "*" {
+			return true
+		}
+
+		if _, network, err := net.ParseCIDR(rule); err == nil {
+			if hostIP != nil && network.Contains(hostIP) {
+				return true
+			}
+			continue
+		}
+
+		ruleHost, rulePort, err := net.SplitHostPort(rule)
+		if err != nil {
+			ruleHost = rule
+			rulePort = ""
+		}
+
+		ruleHost = strings.Trim(ruleHost, "[]")
+
+		if rulePort != "" && rulePort != port {
+			continue
+		}
+
+		if ruleIP := net.ParseIP(ruleHost); ruleIP != nil {
+			if hostIP != nil && ruleIP.Equal(hostIP) {
+				return true
+			}
+			continue
+		}
+
+		if strings.HasPrefix(ruleHost, ".") {
+			if strings.HasSuffix(host, ruleHost) {
+				return true
+			}
+			continue
+		}
+
+		if host == ruleHost || strings.HasSuffix(host, "."+ruleHost) {
+			return true
+		}
+	}
+
+	return false
 }
@@ -28,7 +28,9 @@ const (
 	bootstrapKeyOption                 = "bootstrap-key"
 	bootstrapDeviceHubHostOption       = "device-hub-host"
 	bootstrapDeviceHubPortOption       = "device-hub-port"
+	bootstrapDeviceHubBasePathOption   = "device-hub-base-path"
 	bootstrapTPMDeviceOption           = "tpm-device"
+	bootstrapProxyTypeOption           = "proxy-type"
 	bootstrapProxyHostOption           = "proxy-host"
 	bootstrapProxyPortOption           = "proxy-port"
 	bootstrapProxyUserOption           = "proxy-user"
@@ -36,16 +38,19 @@ const (
 	bootstrapDeviceNameOption          = "device-name"
 	bootstrapDisableRemoteAccessOption = "disable-remote-access"
 	bootstrapCACert                    = "ca-cert"
+	bootstrapExtraCACertsOption        = "extra-ca-certs"
+	bootstrapDeviceKeyOption           = "device-key"
+	bootstrapDeviceCertOption          = "device-cert"
+	bootstrapCheckOption               = "check"
 )
 
 var bootstrapCommand = cmd.Command{
 	Description: "Bootstrap device.",
 	Options: []cmd.Option{
 		{
-			Name:     bootstrapKeyOption,
-			Short:    "k",
-			Help:     "Set the bootstrap key found in the user profile.",
-			Required: true,
+			Name:  bootstrapKeyOption,
+			Short: "k",
+			Help:  "Set the bootstrap key found in the user profile.",
 		},
 		{
 			Name: bootstrapDisableRemoteAccessOption,
@@ -64,6 +69,11 @@ var bootstrapCommand = cmd.Command{
 			Hidden:  true,
 			Default: agent.DefaultDeviceHubPort,
 		},
+		{
+			Name:   bootstrapDeviceHubBasePathOption,
+			Help:   "Device Hub API base path (when behind a path-prefixing proxy).",
+			Hidden: true,
+		},
 		{
 			Name: bootstrapDeviceNameOption,
 			Help: "Custom device name to use.",
@@ -73,6 +83,10 @@ var bootstrapCommand = cmd.Command{
 			Short: "t",
 			Help:  "[Beta] TPM device to use (e.g. /dev/tpm0).",
 		},
+		{
+			Name: bootstrapProxyTypeOption,
+			Help: "Proxy type: http or socks5.",
+		},
 		{
 			Name: bootstrapProxyHostOption,
 			Help: "HTTP proxy host to use.",
@@ -93,16 +107,35 @@ var bootstrapCommand = cmd.Command{
 			Name: bootstrapCACert,
 			Help: "Custom CA certificate to use for TLS.",
 		},
+		{
+			Name: bootstrapExtraCACertsOption,
+			Help: "File or directory with additional CA certificates (e.g. private intermediates) to trust for TLS.",
+		},
+		{
+			Name: bootstrapDeviceKeyOption,
+			Help: "Pre-provisioned device private key (P-256) to bootstrap with instead of the bootstrap key.",
+		},
+		{
+			Name: bootstrapDeviceCertOption,
+			Help: "Pre-provisioned device certificate matching the device key.",
+		},
+		{
+			Name: bootstrapCheckOption,
+			Flag: "true",
+			Help: "Only check bootstrap prerequisites (connectivity, keys, directories) without enrolling the device.",
+		},
 	},
 
 	Target: func(opts cmd.Options) error {
 		cfg := &agent.Config{
 			BootstrapKey:        opts[bootstrapKeyOption],
 			Directory:           opts[mainConfigDirOption],
-			StateDirectory:      opts[mainStateDirOption],
+			StateDirectory:      stateDirectory(opts),
 			DeviceHubServer:     opts[bootstrapDeviceHubHostOption],
 			DeviceHubPort:       opts[bootstrapDeviceHubPortOption],
+			DeviceHubBasePath:   opts[bootstrapDeviceHubBasePathOption],
 			TPMDevice:           opts[bootstrapTPMDeviceOption],
+			ProxyType:           opts[bootstrapProxyTypeOption],
 			ProxyServer:         opts[bootstrapProxyHostOption],
 			ProxyPort:           opts[bootstrapProxyPortOption],
 			ProxyUser:           opts[bootstrapProxyUserOption],
@@ -110,14 +143,26 @@ var bootstrapCommand = cmd.Command{
 			DeviceName:          opts[bootstrapDeviceNameOption],
 			DisableRemoteAccess: opts[bootstrapDisableRemoteAccessOption] == "true",
 			CACert:              opts[bootstrapCACert],
+			ExtraCACerts:        opts[bootstrapExtraCACertsOption],
+			DeviceKey:           opts[bootstrapDeviceKeyOption],
+			DeviceCert:          opts[bootstrapDeviceCertOption],
 		}
 
-		if cfg.BootstrapKey == "" {
-			return fmt.Errorf("bootstrap key (-k) is required")
+		if (cfg.DeviceKey == "") != (cfg.DeviceCert == "") {
+			return fmt.Errorf("both device key (--%s) and device certificate (--%s) are required",
+				bootstrapDeviceKeyOption, bootstrapDeviceCertOption)
 		}
 
 		ctx := context.Background()
 
+		if opts[bootstrapCheckOption] == "true" {
+			return checkBootstrap(ctx, cfg)
+		}
+
+		if cfg.BootstrapKey == "" && cfg.DeviceKey == "" {
+			return fmt.Errorf("bootstrap key (-k) is required")
+		}
+
 		if err := agent.Bootstrap(ctx, cfg); err != nil {
 			return fmt.Errorf("bootstrap error: %w", err)
 		}
@@ -125,3 +170,24 @@ var bootstrapCommand = cmd.Command{
 		return nil
 	},
 }
+
+// checkBootstrap prints results of bootstrap pre-flight checks and returns an error if any of them failed.
+func checkBootstrap(ctx context.Context, cfg *agent.Config) error {
+	failed := 0
+
+	for _, check := range agent.CheckBootstrap(ctx, cfg) {
+		if check.Err != nil {
+			failed++
+			fmt.Printf("[FAIL] %s: %v\n", check.Name, check.Err)
+			continue
+		}
+
+		fmt.Printf("[PASS] %s\n", check.Name)
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("bootstrap check failed: %d check(s) did not pass", failed)
+	}
+
+	return nil
+}
@@ -20,7 +20,9 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"io"
 	"os"
+	"strings"
 
 	"go.qbee.io/agent/app/agent"
 	"go.qbee.io/agent/app/configuration"
@@ -29,17 +31,41 @@ import (
 
 const (
 	configFromFileOption        = "from-file"
+	configFromStdinOption       = "config-stdin"
 	configDryRunOption          = "dry-run"
 	configReportToConsoleOption = "report-to-console"
+	configOutputOption          = "output"
+	configSkipBundleOption      = "skip-bundle"
+	configOnlyBundleOption      = "only-bundle"
 )
 
+// bundleFilterOptions select configuration bundles executed by the agent (e.g. to skip a bundle while debugging).
+var bundleFilterOptions = []cmd.Option{
+	{
+		Name:       configSkipBundleOption,
+		Help:       "Don't execute provided configuration bundle (can be repeated).",
+		Repeatable: true,
+	},
+	{
+		Name:       configOnlyBundleOption,
+		Help:       "Execute only provided configuration bundle (can be repeated).",
+		Repeatable: true,
+	},
+}
+
 var configCommand = cmd.Command{
 	Description: "Execute device configuration.",
-	Options: []cmd.Option{
+	Options: append([]cmd.Option{
 		{
 			Name:  configFromFileOption,
 			Short: "f",
-			Help:  "Apply configuration from provided file.",
+			Help:  "Apply configuration from provided file (use - to read from standard input).",
+		},
+		{
+			Name: configFromStdinOption,
+			Help: "Apply configuration read from standard input (same as --from-file -). " +
+				"Local files can be referenced with file:// sources.",
+			Flag: "true",
 		},
 		{
 			Name:  configReportToConsoleOption,
@@ -47,18 +73,37 @@ var configCommand = cmd.Command{
 			Help:  "Print configuration reports to console.",
 			Flag:  "true",
 		},
+		{
+			Name:    configOutputOption,
+			Short:   "o",
+			Help:    "Format of console reports: text or json (json implies --report-to-console).",
+			Default: "text",
+		},
 		{
 			Name:  configDryRunOption,
 			Short: "d",
 			Help:  "Don't apply configuration. Just dump current configuration as JSON to standard output.",
 			Flag:  "true",
 		},
-	},
+	}, bundleFilterOptions...),
 	Target: func(opts cmd.Options) error {
 		dryRun := opts[configDryRunOption] == "true"
 		fromFile := opts[configFromFileOption]
+		if opts[configFromStdinOption] == "true" {
+			fromFile = configFromStdin
+		}
 		reportToConsole := opts[configReportToConsoleOption] == "true"
 
+		reportFormat := configuration.ReportFormatText
+		switch opts[configOutputOption] {
+		case "text":
+		case "json":
+			reportFormat = configuration.ReportFormatJSON
+			reportToConsole = true
+		default:
+			return fmt.Errorf("unsupported output format: %s", opts[configOutputOption])
+		}
+
 		ctx := context.Background()
 
 		cfg, err := loadConfig(opts)
@@ -66,6 +111,10 @@ var configCommand = cmd.Command{
 			return err
 		}
 
+		if err = applyBundleFilter(cfg, opts); err != nil {
+			return err
+		}
+
 		var deviceAgent *agent.Agent
 
 		if fromFile != "" {
@@ -80,6 +129,7 @@ var configCommand = cmd.Command{
 
 		if reportToConsole {
 			deviceAgent.Configuration.EnableConsoleReporting()
+			deviceAgent.Configuration.SetConsoleReportFormat(reportFormat)
 		}
 
 		if err != nil {
@@ -89,15 +139,8 @@ var configCommand = cmd.Command{
 		var configurationData *configuration.CommittedConfig
 
 		if fromFile != "" {
-			configBytes, err := os.ReadFile(fromFile)
-			if err != nil {
-				return fmt.Errorf("cannot open local config file: %w", err)
-			}
-
-			configurationData = new(configuration.CommittedConfig)
-
-			if err = json.Unmarshal(configBytes, configurationData); err != nil {
-				return fmt.Errorf("cannot parse local config file: %w", err)
+			if configurationData, err = readLocalConfig(fromFile); err != nil {
+				return err
 			}
 		} else {
 			if configurationData, err = deviceAgent.Configuration.Get(ctx); err != nil {
@@ -112,3 +155,57 @@ var configCommand = cmd.Command{
 		return deviceAgent.Configuration.Execute(ctx, configurationData)
 	},
 }
+
+// configFromStdin is the local config path which reads the configuration from standard input.
+const configFromStdin = "-"
+
+// readLocalConfig reads committed configuration from a local file or from standard input.
+func readLocalConfig(path string) (*configuration.CommittedConfig, error) {
+	var configBytes []byte
+	var err error
+
+	if path == configFromStdin {
+		configBytes, err = io.ReadAll(os.Stdin)
+	} else {
+		configBytes, err = os.ReadFile(path)
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("cannot open local config file: %w", err)
+	}
+
+	configurationData := new(configuration.CommittedConfig)
+
+	if err = json.Unmarshal(configBytes, configurationData); err != nil {
+		return nil, fmt.Errorf("cannot parse local config file: %w", err)
+	}
+
+	return configurationData, nil
+}
+
+// applyBundleFilter sets configuration bundles selected by command line options.
+// Settings and parameters bundles cannot be filtered, as other bundles depend on them.
+func applyBundleFilter(cfg *agent.Config, opts cmd.Options) error {
+	filter := configuration.BundleFilter{
+		Skip: splitOptionValues(opts[configSkipBundleOption]),
+		Only: splitOptionValues(opts[configOnlyBundleOption]),
+	}
+
+	if err := filter.Validate(); err != nil {
+		return err
+	}
+
+	cfg.SkipBundles = filter.Skip
+	cfg.OnlyBundles = filter.Only
+
+	return nil
+}
+
+// splitOptionValues returns values of a repeatable option.
+func splitOptionValues(value string) []string {
+	if value == "" {
+		return nil
+	}
+
+	return strings.Split(value, ",")
+}
@@ -81,6 +81,8 @@ var inventoryCommand = cmd.Command{
 			inventoryData, err = inventory.CollectDockerNetworksInventory(ctx)
 		case inventory.TypeDockerVolumes:
 			inventoryData, err = inventory.CollectDockerVolumesInventory(ctx)
+		case inventory.TypeContainerStats:
+			inventoryData, err = inventory.CollectContainerStatsInventory(ctx)
 		case inventory.TypeRauc:
 			inventoryData, err = inventory.CollectRaucInventory(ctx)
 		default:
@@ -17,6 +17,8 @@
 package cmd
 
 import (
+	"path/filepath"
+
 	"go.qbee.io/agent/app/agent"
 	"go.qbee.io/agent/app/log"
 	"go.qbee.io/agent/app/utils/cmd"
@@ -26,12 +28,11 @@ const (
 	mainConfigDirOption = "config-dir"
 	mainStateDirOption  = "state-dir"
 	mainLogLevel        = "log-level"
+	mainLogFile         = "log-file"
+	mainLogFormat       = "log-format"
 )
 
-const (
-	defaultConfigDir = "/etc/qbee"
-	defaultStateDir  = "/var/lib/qbee"
-)
+const defaultConfigDir = "/etc/qbee"
 
 // Main is the main command of the agent.
 var Main = cmd.Command{
@@ -44,30 +45,44 @@ var Main = cmd.Command{
 			Default: defaultConfigDir,
 		},
 		{
-			Name:    mainStateDirOption,
-			Short:   "s",
-			Help:    "State directory.",
-			Default: defaultStateDir,
+			Name:  mainStateDirOption,
+			Short: "s",
+			Help:  "State directory (defaults to writable_state_directory from the config or " + agent.DefaultStateDirectory + ").",
 		},
 		{
 			Name:    mainLogLevel,
 			Short:   "l",
-			Help:    "Logging level: DEBUG, INFO, WARNING or ERROR.",
+			Help:    "Logging level: TRACE (logs executed commands), DEBUG, INFO, WARNING or ERROR.",
 			Default: "INFO",
 		},
+		{
+			Name:    mainLogFormat,
+			Help:    "Logging format: text or json.",
+			Default: "text",
+		},
+		{
+			Name:  mainLogFile,
+			Short: "L",
+			Help:  "Log file (relative paths are resolved against the state directory). Rotated when it reaches 10MB.",
+		},
 	},
 	SubCommands: map[string]cmd.Command{
-		"bootstrap": bootstrapCommand,
-		"config":    configCommand,
-		"inventory": inventoryCommand,
-		"start":     startCommand,
-		"version":   versionCommand,
+		"bootstrap":  bootstrapCommand,
+		"config":     configCommand,
+		"inventory":  inventoryCommand,
+		"rotate-key": rotateKeyCommand,
+		"run":        runCommand,
+		"start":      startCommand,
+		"status":     statusCommand,
+		"version":    versionCommand,
 	},
 }
 
 // loadConfig is a helper method to load agent's config based on provided command-line options.
 func loadConfig(opts cmd.Options) (*agent.Config, error) {
 	switch opts[mainLogLevel] {
+	case "TRACE":
+		log.SetLevel(log.TRACE)
 	case "DEBUG":
 		log.SetLevel(log.DEBUG)
 	case "INFO":
@@ -78,5 +93,32 @@ func loadConfig(opts cmd.Options) (*agent.Config, error) {
 		log.SetLevel(log.ERROR)
 	}
 
+	switch opts[mainLogFormat] {
+	case "text":
+		log.SetFormat(log.Text)
+	case "json":
+		log.SetFormat(log.JSON)
+	}
+
+	if logFile := opts[mainLogFile]; logFile != "" {
+		if !filepath.IsAbs(logFile) {
+			logFile = filepath.Join(stateDirectory(opts), logFile)
+		}
+
+		// use default size limits for the log file
+		if err := log.SetFileOutput(logFile, 0, 0); err != nil {
+			return nil, err
+		}
+	}
+
 	return agent.LoadConfig(opts[mainConfigDirOption], opts[mainStateDirOption])
 }
+
+// stateDirectory returns state directory provided on the command-line or the default one.
+func stateDirectory(opts cmd.Options) string {
+	if stateDir := opts[mainStateDirOption]; stateDir != "" {
+		return stateDir
+	}
+
+	return agent.DefaultStateDirectory
+}
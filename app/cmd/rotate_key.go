@@ -0,0 +1,44 @@
+// Copyright 2023 qbee.io
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package cmd
+
+import (
+	"context"
+	"fmt"
+
+	"go.qbee.io/agent/app/agent"
+	"go.qbee.io/agent/app/log"
+	"go.qbee.io/agent/app/utils/cmd"
+)
+
+var rotateKeyCommand = cmd.Command{
+	Description: "Rotate device private key and certificate.",
+	Target: func(opts cmd.Options) error {
+		cfg, err := loadConfig(opts)
+		if err != nil {
+			return err
+		}
+
+		if err = agent.RotateKey(context.Background(), cfg); err != nil {
+			return fmt.Errorf("key rotation error: %w", err)
+		}
+
+		log.Infof("Please restart the qbee-agent service to use the new credentials")
+
+		return nil
+	},
+}
@@ -0,0 +1,81 @@
+// Copyright 2023 qbee.io
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package cmd
+
+import (
+	"context"
+	"fmt"
+
+	"go.qbee.io/agent/app/agent"
+	"go.qbee.io/agent/app/configuration"
+	"go.qbee.io/agent/app/utils/cmd"
+)
+
+const (
+	runOnceOption = "once"
+	runJSONOption = "json"
+)
+
+var runCommand = cmd.Command{
+	Description: "Run the agent in the foreground.",
+
+	Options: append([]cmd.Option{
+		{
+			Name:  runOnceOption,
+			Short: "1",
+			Help:  "Perform a single full run against the device hub configuration and exit with its aggregate status.",
+			Flag:  "true",
+		},
+		{
+			Name:  runJSONOption,
+			Short: "j",
+			Help:  "Print configuration reports to standard output as JSON lines (requires --once).",
+			Flag:  "true",
+		},
+	}, bundleFilterOptions...),
+
+	Target: func(opts cmd.Options) error {
+		runOnce := opts[runOnceOption] == "true"
+		jsonOutput := opts[runJSONOption] == "true"
+
+		if jsonOutput && !runOnce {
+			return fmt.Errorf("--%s requires --%s", runJSONOption, runOnceOption)
+		}
+
+		ctx := context.Background()
+
+		cfg, err := loadConfig(opts)
+		if err != nil {
+			return err
+		}
+
+		if err = applyBundleFilter(cfg, opts); err != nil {
+			return err
+		}
+
+		if !runOnce {
+			return agent.Start(ctx, cfg)
+		}
+
+		reportFormat := configuration.ReportFormatText
+		if jsonOutput {
+			reportFormat = configuration.ReportFormatJSON
+		}
+
+		return agent.RunOnceWithReports(ctx, cfg, reportFormat)
+	},
+}
@@ -35,7 +35,7 @@ const deviceConfigurationAPIPath = "/v1/org/device/auth/config"
 
 // get retrieves currently committed device configuration from the device hub API.
 func (srv *Service) get(ctx context.Context) (*CommittedConfig, error) {
-	cfg, err := srv.getWithRetry(ctx)
+	payload, err := srv.getWithRetry(ctx)
 
 	srv.reportAPIError(ctx, err)
 
@@ -43,6 +43,24 @@ func (srv *Service) get(ctx context.Context) (*CommittedConfig, error) {
 		return nil, err
 	}
 
+	return srv.decodeConfig(payload)
+}
+
+// decodeConfig decodes configuration payload, verifying its signature if config signing key is set.
+func (srv *Service) decodeConfig(payload []byte) (*CommittedConfig, error) {
+	if srv.configSigningKey != nil {
+		if err := verifyConfigSignature(payload, srv.configSigningKey); err != nil {
+			return nil, fmt.Errorf("config signature verification failed: %w", err)
+		}
+	}
+
+	cfg := new(CommittedConfig)
+	if err := json.Unmarshal(payload, cfg); err != nil {
+		return nil, fmt.Errorf("error decoding config: %w", err)
+	}
+
+	cfg.payload = payload
+
 	return cfg, nil
 }
 
@@ -51,20 +69,20 @@ const (
 	maxReconnectDelay = 10
 )
 
-func (srv *Service) getWithRetry(ctx context.Context) (*CommittedConfig, error) {
+func (srv *Service) getWithRetry(ctx context.Context) (json.RawMessage, error) {
 
 	var err error
-	cfg := new(CommittedConfig)
+	payload := make(json.RawMessage, 0)
 
 	if srv.firstRunRetryCounter == 0 {
-		err = srv.api.Get(ctx, deviceConfigurationAPIPath, cfg)
-		return cfg, err
+		err = srv.api.Get(ctx, deviceConfigurationAPIPath, &payload)
+		return payload, err
 	}
 
 	// retry on first run as network might not be ready yet
 	for srv.firstRunRetryCounter > 0 {
 		srv.firstRunRetryCounter--
-		err = srv.api.Get(ctx, deviceConfigurationAPIPath, cfg)
+		err = srv.api.Get(ctx, deviceConfigurationAPIPath, &payload)
 		if err != nil {
 			attempts := defaultFirstRunRetryCounter - srv.firstRunRetryCounter
 			reconnectIn := minReconnectDelay + rand.Int63n(maxReconnectDelay-minReconnectDelay)
@@ -74,7 +92,7 @@ func (srv *Service) getWithRetry(ctx context.Context) (*CommittedConfig, error)
 		}
 		// successful connection, set retry counter to 0
 		srv.firstRunRetryCounter = 0
-		return cfg, nil
+		return payload, nil
 	}
 	return nil, err
 }
@@ -92,8 +110,14 @@ func (srv *Service) getFileMetadataFromAPI(ctx context.Context, src string) (*Fi
 
 	fileMetadataResp := new(fileMetadataResponse)
 
+	if err := srv.retryBudget.check(); err != nil {
+		return nil, fmt.Errorf("error getting file metadata: %w", err)
+	}
+
 	if err := srv.api.Get(ctx, path, fileMetadataResp); err != nil {
-		wrappedErr := fmt.Errorf("error getting file metadata: %w", err)
+		srv.retryBudget.track(err)
+
+		wrappedErr := fmt.Errorf("error getting file metadata: %w", newDownloadError(srv.api.Origin(), err))
 		if errors.As(err, new(api.ConnectionError)) {
 			return nil, api.NewConnectionError(wrappedErr)
 		}
@@ -111,6 +135,10 @@ const fileManagerPublicAPIPath = "/v1/org/device/public/files"
 func (srv *Service) getFileFromAPI(ctx context.Context, src string) (io.ReadCloser, error) {
 	path := fmt.Sprintf(fileManagerAPIPath, src)
 
+	if err := srv.retryBudget.check(); err != nil {
+		return nil, fmt.Errorf("error getting file: %w", err)
+	}
+
 	request, err := srv.api.NewRequest(ctx, http.MethodGet, path, nil)
 	if err != nil {
 		return nil, err
@@ -118,44 +146,50 @@ func (srv *Service) getFileFromAPI(ctx context.Context, src string) (io.ReadClos
 
 	var response *http.Response
 	if response, err = srv.api.Do(request); err != nil {
-		return nil, fmt.Errorf("error getting file: %w", err)
+		srv.retryBudget.track(err)
+		return nil, fmt.Errorf("error getting file: %w", newDownloadError(srv.api.Origin(), err))
+	}
+
+	if response.StatusCode >= http.StatusBadRequest {
+		defer response.Body.Close()
+
+		apiErr := api.NewError(response.StatusCode, response.Body)
+		return nil, fmt.Errorf("error getting file: %w", newDownloadError(srv.api.Origin(), apiErr))
 	}
 
 	return response.Body, nil
 }
 
 const reportsAPIPath = "/v1/org/device/auth/report"
-const reportsDeliveryBatchSize = 100
+
+const (
+	defaultReportsBatchCount = 100
+	defaultReportsBatchSize  = 1024 * 1024 // bytes
+)
 
 // sendReports delivers reports from a configuration execution.
+// Reports are delivered in batches limited by reports count and encoded payload size.
 // Returns number of reports successfully delivered.
 func (srv *Service) sendReports(ctx context.Context, reports []Report) (int, error) {
 	log.Debugf("sending %d reports", len(reports))
 
 	delivered := 0
 
-	if len(reports) == 0 {
-		return delivered, nil
-	}
-
 	// attempt to deliver reports to the device hub
 	for len(reports) > 0 {
-		buf := new(bytes.Buffer)
-		jsonEncoder := json.NewEncoder(buf)
-		count := 0
-
-		for _, report := range reports {
-			if err := jsonEncoder.Encode(report); err != nil {
-				return delivered, fmt.Errorf("error encoding report into JSON: %w", err)
-			}
-
-			if count++; count >= reportsDeliveryBatchSize {
-				break
-			}
+		buf, count, err := srv.encodeReportsBatch(reports)
+		if err != nil {
+			return delivered, err
 		}
 
-		log.Debugf("sending batch of %d reports", count)
-		if err := srv.api.Post(ctx, reportsAPIPath, buf, nil); err != nil {
+		log.Debugf("sending batch of %d reports (%d bytes)", count, buf.Len())
+
+		if srv.reportsCompression {
+			err = srv.api.Post(ctx, reportsAPIPath, buf, nil)
+		} else {
+			err = srv.api.PostUncompressed(ctx, reportsAPIPath, buf, nil)
+		}
+		if err != nil {
 			return delivered, fmt.Errorf("error delivering reports: %w", err)
 		}
 
@@ -165,3 +199,32 @@ func (srv *Service) sendReports(ctx context.Context, reports []Report) (int, err
 
 	return delivered, nil
 }
+
+// encodeReportsBatch encodes the largest leading batch of reports which fits within configured batch limits.
+// A single report exceeding the size limit is still encoded on its own, so it doesn't block delivery.
+// Returns the encoded batch (JSONL) and number of reports included in it.
+func (srv *Service) encodeReportsBatch(reports []Report) (*bytes.Buffer, int, error) {
+	buf := new(bytes.Buffer)
+	count := 0
+
+	for _, report := range reports {
+		if count >= srv.reportsBatchCount {
+			break
+		}
+
+		line, err := json.Marshal(report)
+		if err != nil {
+			return nil, count, fmt.Errorf("error encoding report into JSON: %w", err)
+		}
+
+		if count > 0 && buf.Len()+len(line)+1 > srv.reportsBatchSize {
+			break
+		}
+
+		buf.Write(line)
+		buf.WriteByte('\n')
+		count++
+	}
+
+	return buf, count, nil
+}
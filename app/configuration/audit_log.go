@@ -0,0 +1,313 @@
+// Copyright 2024 qbee.io
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package configuration
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"go.qbee.io/agent/app/log"
+	"go.qbee.io/agent/app/utils"
+)
+
+const (
+	auditLogFileName       = "audit.jsonl"
+	auditLogIssuesFileName = "audit_issues.json"
+	auditLogFileMode       = 0600
+
+	defaultAuditLogMaxSize  = 1024 * 1024 // bytes
+	defaultAuditLogMaxFiles = 5
+)
+
+// AuditEvent represents a single change applied to the system by the agent.
+type AuditEvent struct {
+	// Timestamp when the change was applied.
+	Timestamp int64 `json:"ts"`
+
+	// CommitID of the configuration which caused the change.
+	CommitID string `json:"commit_id"`
+
+	// Bundle which applied the change.
+	Bundle string `json:"bundle"`
+
+	// BundleCommitID of the bundle configuration which caused the change.
+	BundleCommitID string `json:"bundle_commit_id"`
+
+	// Severity of the event. Can be INFO, ERR, WARN.
+	Severity string `json:"sev"`
+
+	// Text describes the change.
+	Text string `json:"text"`
+}
+
+// newAuditEvent returns audit event for the provided report (operation log is not included).
+func newAuditEvent(report Report) AuditEvent {
+	return AuditEvent{
+		Timestamp:      report.Timestamp,
+		CommitID:       report.CommitID,
+		Bundle:         report.Bundle,
+		BundleCommitID: report.BundleCommitID,
+		Severity:       report.Severity,
+		Text:           report.Text,
+	}
+}
+
+// auditIssue identifies a warning or an error reported by a bundle.
+type auditIssue struct {
+	Bundle   string `json:"bundle"`
+	Severity string `json:"sev"`
+	Text     string `json:"text"`
+}
+
+// auditLog is a local append-only record of all changes applied by the agent.
+// Unlike the reports buffer, audit log is never consumed by reports delivery, but rotated based on its size.
+type auditLog struct {
+	path       string
+	issuesPath string
+	maxSize    int64
+	maxFiles   int
+	mutex      sync.Mutex
+}
+
+// newAuditLog returns audit log stored in the provided directory.
+// Non-positive maxSize (in bytes) or maxFiles use defaults.
+func newAuditLog(directory string, maxSize int64, maxFiles int) *auditLog {
+	if maxSize <= 0 {
+		maxSize = defaultAuditLogMaxSize
+	}
+
+	if maxFiles <= 0 {
+		maxFiles = defaultAuditLogMaxFiles
+	}
+
+	return &auditLog{
+		path:       filepath.Join(directory, auditLogFileName),
+		issuesPath: filepath.Join(directory, auditLogIssuesFileName),
+		maxSize:    maxSize,
+		maxFiles:   maxFiles,
+	}
+}
+
+// record appends events for provided reports to the audit log.
+func (audit *auditLog) record(reports []Report) error {
+	events := make([]AuditEvent, 0, len(reports))
+	for _, report := range reports {
+		events = append(events, newAuditEvent(report))
+	}
+
+	audit.mutex.Lock()
+	defer audit.mutex.Unlock()
+
+	return audit.write(events)
+}
+
+// recordRun appends events for reports of an agent run to the audit log.
+// Warnings and errors are recorded only when they first occur and resolution is recorded when a bundle executed
+// by the run doesn't report them anymore, so issues repeated by every run are not recorded again.
+func (audit *auditLog) recordRun(commitID string, executedBundles []string, reports []Report) error {
+	audit.mutex.Lock()
+	defer audit.mutex.Unlock()
+
+	previousIssues := audit.loadIssues()
+
+	executed := make(map[string]bool, len(executedBundles))
+	for _, bundleName := range executedBundles {
+		executed[bundleName] = true
+	}
+
+	currentIssues := make(map[auditIssue]bool)
+	events := make([]AuditEvent, 0, len(reports))
+
+	for _, report := range reports {
+		if report.Severity == severityInfo {
+			events = append(events, newAuditEvent(report))
+			continue
+		}
+
+		issue := auditIssue{Bundle: report.Bundle, Severity: report.Severity, Text: report.Text}
+		if !previousIssues[issue] && !currentIssues[issue] {
+			events = append(events, newAuditEvent(report))
+		}
+
+		currentIssues[issue] = true
+	}
+
+	now := time.Now().Unix()
+
+	for _, issue := range sortedAuditIssues(previousIssues) {
+		if currentIssues[issue] {
+			continue
+		}
+
+		// issues of bundles which were not executed by this run are kept until the bundle is executed again
+		if !executed[issue.Bundle] {
+			currentIssues[issue] = true
+			continue
+		}
+
+		events = append(events, AuditEvent{
+			Timestamp: now,
+			CommitID:  commitID,
+			Bundle:    issue.Bundle,
+			Severity:  severityInfo,
+			Text:      "Resolved: " + issue.Text,
+		})
+	}
+
+	if err := audit.write(events); err != nil {
+		return err
+	}
+
+	return audit.saveIssues(currentIssues)
+}
+
+// loadIssues returns a set of issues recorded by the previous run.
+func (audit *auditLog) loadIssues() map[auditIssue]bool {
+	issues := make(map[auditIssue]bool)
+
+	data, err := os.ReadFile(audit.issuesPath)
+	if err != nil {
+		if !errors.Is(err, fs.ErrNotExist) {
+			log.Errorf("failed to read audit log issues: %v", err)
+		}
+		return issues
+	}
+
+	var issuesList []auditIssue
+	if err = json.Unmarshal(data, &issuesList); err != nil {
+		log.Errorf("failed to parse audit log issues: %v", err)
+		return issues
+	}
+
+	for _, issue := range issuesList {
+		issues[issue] = true
+	}
+
+	return issues
+}
+
+// saveIssues persists the set of issues reported by the current run.
+func (audit *auditLog) saveIssues(issues map[auditIssue]bool) error {
+	data, err := json.Marshal(sortedAuditIssues(issues))
+	if err != nil {
+		return fmt.Errorf("failed to encode audit log issues: %w", err)
+	}
+
+	if err = utils.WriteFileSync(audit.issuesPath, data, auditLogFileMode); err != nil {
+		return fmt.Errorf("failed to write audit log issues: %w", err)
+	}
+
+	return nil
+}
+
+// sortedAuditIssues returns issues from the set in a stable order.
+func sortedAuditIssues(issues map[auditIssue]bool) []auditIssue {
+	issuesList := make([]auditIssue, 0, len(issues))
+	for issue := range issues {
+		issuesList = append(issuesList, issue)
+	}
+
+	sort.Slice(issuesList, func(i, j int) bool {
+		if issuesList[i].Bundle != issuesList[j].Bundle {
+			return issuesList[i].Bundle < issuesList[j].Bundle
+		}
+		if issuesList[i].Severity != issuesList[j].Severity {
+			return issuesList[i].Severity < issuesList[j].Severity
+		}
+		return issuesList[i].Text < issuesList[j].Text
+	})
+
+	return issuesList
+}
+
+// write appends provided events to the audit log.
+// Caller must hold the audit log mutex.
+func (audit *auditLog) write(events []AuditEvent) error {
+	if len(events) == 0 {
+		return nil
+	}
+
+	if err := audit.rotate(); err != nil {
+		return err
+	}
+
+	fp, err := os.OpenFile(audit.path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, auditLogFileMode)
+	if err != nil {
+		return fmt.Errorf("failed to open audit log: %w", err)
+	}
+	defer fp.Close()
+
+	encoder := json.NewEncoder(fp)
+
+	for _, event := range events {
+		if err = encoder.Encode(event); err != nil {
+			return fmt.Errorf("failed to encode audit event: %w", err)
+		}
+	}
+
+	// sync disk writes, so the record survives a power loss
+	if err = fp.Sync(); err != nil {
+		return fmt.Errorf("failed to sync audit log: %w", err)
+	}
+
+	return nil
+}
+
+// rotate the audit log when it reaches its maximum size.
+// Rotated files are suffixed with a number (1 being the most recent) and only maxFiles of them are kept.
+func (audit *auditLog) rotate() error {
+	fileInfo, err := os.Stat(audit.path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+
+		return fmt.Errorf("failed to check audit log: %w", err)
+	}
+
+	if fileInfo.Size() < audit.maxSize {
+		return nil
+	}
+
+	if err = os.Remove(audit.rotatedPath(audit.maxFiles)); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to remove expired audit log: %w", err)
+	}
+
+	for i := audit.maxFiles - 1; i > 0; i-- {
+		if err = os.Rename(audit.rotatedPath(i), audit.rotatedPath(i+1)); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("failed to rotate audit log: %w", err)
+		}
+	}
+
+	if err = os.Rename(audit.path, audit.rotatedPath(1)); err != nil {
+		return fmt.Errorf("failed to rotate audit log: %w", err)
+	}
+
+	return nil
+}
+
+// rotatedPath returns path of the n-th rotated audit log file.
+func (audit *auditLog) rotatedPath(n int) string {
+	return fmt.Sprintf("%s.%d", audit.path, n)
+}
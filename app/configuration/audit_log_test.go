@@ -0,0 +1,124 @@
+// Copyright 2024 qbee.io
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package configuration
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"go.qbee.io/agent/app/utils/assert"
+)
+
+func Test_auditLog_record(t *testing.T) {
+	audit := newAuditLog(t.TempDir(), 0, 0)
+
+	reports := []Report{
+		{Bundle: BundleFileDistribution, CommitID: "c1", Severity: severityInfo, Text: "file written", Log: "ZXh0cmE=", Timestamp: 1},
+		{Bundle: BundleSoftwareManagement, CommitID: "c1", Severity: severityInfo, Text: "package installed", Timestamp: 2},
+	}
+
+	assert.NoError(t, audit.record(reports))
+	assert.NoError(t, audit.record(reports[1:]))
+
+	expected := []AuditEvent{
+		{Timestamp: 1, CommitID: "c1", Bundle: BundleFileDistribution, Severity: severityInfo, Text: "file written"},
+		{Timestamp: 2, CommitID: "c1", Bundle: BundleSoftwareManagement, Severity: severityInfo, Text: "package installed"},
+		{Timestamp: 2, CommitID: "c1", Bundle: BundleSoftwareManagement, Severity: severityInfo, Text: "package installed"},
+	}
+
+	assert.Equal(t, readAuditEvents(t, audit.path), expected)
+}
+
+func Test_auditLog_recordRun(t *testing.T) {
+	audit := newAuditLog(t.TempDir(), 0, 0)
+
+	change := Report{Bundle: BundleFileDistribution, CommitID: "c1", Severity: severityInfo, Text: "file written"}
+	usersError := Report{Bundle: BundleUsers, CommitID: "c1", Severity: severityError, Text: "unable to add user"}
+	sshKeysWarning := Report{Bundle: BundleSSHKeys, CommitID: "c1", Severity: severityWarning, Text: "user not found"}
+
+	executed := []string{BundleFileDistribution, BundleUsers, BundleSSHKeys}
+
+	// first occurrence of issues is recorded
+	assert.NoError(t, audit.recordRun("c1", executed, []Report{change, usersError, sshKeysWarning}))
+	assert.Length(t, readAuditEvents(t, audit.path), 3)
+
+	// repeated issues are not recorded again (also after the audit log is re-opened)
+	audit = newAuditLog(filepath.Dir(audit.path), 0, 0)
+	assert.NoError(t, audit.recordRun("c1", executed, []Report{usersError, sshKeysWarning, usersError}))
+	assert.Length(t, readAuditEvents(t, audit.path), 3)
+
+	// issues of bundles which were not executed are not resolved
+	assert.NoError(t, audit.recordRun("c2", []string{BundleFileDistribution}, nil))
+	assert.Length(t, readAuditEvents(t, audit.path), 3)
+
+	// issue not reported anymore is resolved
+	assert.NoError(t, audit.recordRun("c2", executed, []Report{sshKeysWarning}))
+
+	events := readAuditEvents(t, audit.path)
+	assert.Length(t, events, 4)
+	assert.Equal(t, events[3].CommitID, "c2")
+	assert.Equal(t, events[3].Bundle, BundleUsers)
+	assert.Equal(t, events[3].Severity, severityInfo)
+	assert.Equal(t, events[3].Text, "Resolved: unable to add user")
+
+	// issue occurring again is recorded
+	assert.NoError(t, audit.recordRun("c2", executed, []Report{usersError, sshKeysWarning}))
+
+	events = readAuditEvents(t, audit.path)
+	assert.Length(t, events, 5)
+	assert.Equal(t, events[4].Text, usersError.Text)
+}
+
+func Test_auditLog_rotate(t *testing.T) {
+	audit := newAuditLog(t.TempDir(), 1, 2)
+
+	for i := int64(1); i <= 4; i++ {
+		assert.NoError(t, audit.record([]Report{{Text: "change", Timestamp: i}}))
+	}
+
+	// every record exceeds the max size, so the log is rotated before each write and only 2 rotated files are kept
+	assert.Equal(t, readAuditEvents(t, audit.path)[0].Timestamp, int64(4))
+	assert.Equal(t, readAuditEvents(t, audit.rotatedPath(1))[0].Timestamp, int64(3))
+	assert.Equal(t, readAuditEvents(t, audit.rotatedPath(2))[0].Timestamp, int64(2))
+
+	if _, err := os.Stat(audit.rotatedPath(3)); !os.IsNotExist(err) {
+		t.Fatalf("expected expired audit log to be removed, got %v", err)
+	}
+}
+
+// readAuditEvents returns audit events recorded in the provided file.
+func readAuditEvents(t *testing.T, path string) []AuditEvent {
+	fp, err := os.Open(path)
+	assert.NoError(t, err)
+	defer fp.Close()
+
+	events := make([]AuditEvent, 0)
+	scanner := bufio.NewScanner(fp)
+
+	for scanner.Scan() {
+		var event AuditEvent
+		assert.NoError(t, json.Unmarshal(scanner.Bytes(), &event))
+		events = append(events, event)
+	}
+
+	assert.NoError(t, scanner.Err())
+
+	return events
+}
@@ -22,6 +22,15 @@ import "context"
 type Metadata struct {
 	Enabled  bool   `json:"enabled"`
 	CommitID string `json:"bundle_commit_id"`
+
+	// Rollout defines percentage of devices (1-99) which should execute the bundle.
+	// Devices are selected deterministically, so the same devices keep executing the bundle as the percentage grows.
+	// When not set (or set to 100), bundle is executed on all devices.
+	Rollout int `json:"rollout_percentage,omitempty"`
+
+	// DependsOn lists bundles (e.g. "file_distribution") which must be executed before this bundle.
+	// Dependencies affect only the execution order and are ignored for bundles not present in the configuration.
+	DependsOn []string `json:"depends_on,omitempty"`
 }
 
 // IsEnabled returns true if bundle is enabled
@@ -34,9 +43,21 @@ func (m Metadata) BundleCommitID() string {
 	return m.CommitID
 }
 
+// RolloutPercentage returns percentage of devices which should execute the bundle.
+func (m Metadata) RolloutPercentage() int {
+	return m.Rollout
+}
+
+// Dependencies returns names of bundles which must be executed before this bundle.
+func (m Metadata) Dependencies() []string {
+	return m.DependsOn
+}
+
 // Bundle defines a configuration bundle.
 type Bundle interface {
 	IsEnabled() bool
 	BundleCommitID() string
+	RolloutPercentage() int
+	Dependencies() []string
 	Execute(context.Context, *Service) error
 }
@@ -20,18 +20,41 @@ import (
 	"context"
 	"fmt"
 	"strconv"
+
+	"go.qbee.io/agent/app/utils"
+)
+
+// WatchdogAction defines what the connectivity watchdog does when the failed connections threshold is reached.
+type WatchdogAction string
+
+// Supported connectivity watchdog actions.
+const (
+	WatchdogReboot         WatchdogAction = "reboot"
+	WatchdogRestartNetwork WatchdogAction = "restart-network"
+	WatchdogRestartAgent   WatchdogAction = "restart-agent"
 )
 
+// defaultWatchdogNetworkService is the service restarted by the restart-network action if not configured.
+const defaultWatchdogNetworkService = "networking"
+
 // ConnectivityWatchdogBundle configures a watchdog.
 //
 // Example payload:
 // {
-//   "threshold": "3"
+//   "threshold": "3",
+//   "action": "restart-network",
+//   "network_service": "NetworkManager"
 // }
 type ConnectivityWatchdogBundle struct {
 	Metadata
 
 	Threshold string `json:"threshold"`
+
+	// Action defines what to do when the threshold is reached (defaults to reboot).
+	Action WatchdogAction `json:"action,omitempty"`
+
+	// NetworkService defines a service restarted by the restart-network action (defaults to networking).
+	NetworkService string `json:"network_service,omitempty"`
 }
 
 // Execute connectivity watchdog configuration bundle.
@@ -41,7 +64,71 @@ func (c ConnectivityWatchdogBundle) Execute(_ context.Context, service *Service)
 		return fmt.Errorf("invalid threshold value")
 	}
 
+	action := c.Action
+	switch action {
+	case "":
+		action = WatchdogReboot
+	case WatchdogReboot, WatchdogRestartNetwork, WatchdogRestartAgent:
+	default:
+		return fmt.Errorf("invalid watchdog action: %s", c.Action)
+	}
+
+	networkService := c.NetworkService
+	if networkService == "" {
+		networkService = defaultWatchdogNetworkService
+	}
+
 	service.connectivityWatchdogThreshold = threshold
+	service.connectivityWatchdogAction = action
+	service.connectivityWatchdogNetworkService = networkService
 
 	return nil
 }
+
+// triggerConnectivityWatchdog performs the configured connectivity watchdog action.
+func (srv *Service) triggerConnectivityWatchdog(ctx context.Context) {
+	action := srv.connectivityWatchdogAction
+	if action == "" {
+		action = WatchdogReboot
+	}
+
+	ReportWarning(ctx, nil, "Connectivity watchdog triggered after %d failed connections to the device hub (action: %s).",
+		srv.failedConnectionsCount, action)
+
+	switch action {
+	case WatchdogRestartNetwork:
+		// start counting again, so the network is not restarted on every failed connection
+		srv.failedConnectionsCount = 0
+		srv.restartNetworkService(ctx)
+	case WatchdogRestartAgent:
+		srv.failedConnectionsCount = 0
+		srv.RestartAgentAfterRun(ctx)
+	default:
+		srv.RebootAfterRun(ctx)
+	}
+}
+
+// restartNetworkService restarts the network service configured for the connectivity watchdog.
+func (srv *Service) restartNetworkService(ctx context.Context) {
+	serviceName := srv.connectivityWatchdogNetworkService
+	if serviceName == "" {
+		serviceName = defaultWatchdogNetworkService
+	}
+
+	cmd, err := utils.GenerateServiceCommand(ctx, serviceName, "restart")
+	if err == nil && cmd == nil {
+		err = fmt.Errorf("service %s not found", serviceName)
+	}
+	if err != nil {
+		ReportError(ctx, err, "Unable to restart network service %s.", serviceName)
+		return
+	}
+
+	var output []byte
+	if output, err = utils.RunCommand(ctx, cmd); err != nil {
+		ReportError(ctx, err, "Unable to restart network service %s.", serviceName)
+		return
+	}
+
+	reportChange(ctx, output, "Restarted network service %s.", serviceName)
+}
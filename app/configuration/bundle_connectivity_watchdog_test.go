@@ -27,7 +27,7 @@ import (
 
 func Test_ConnectivityWatchdog(t *testing.T) {
 	apiClient := api.NewClient("invalid-host.example", "12345")
-	service := configuration.New(apiClient, "", "")
+	service := configuration.New(apiClient, t.TempDir(), "")
 
 	committedConfig := configuration.CommittedConfig{
 		Bundles: []string{"connectivity_watchdog"},
@@ -80,3 +80,61 @@ func Test_ConnectivityWatchdog(t *testing.T) {
 		t.Fatalf("unexpected should reboot flag")
 	}
 }
+
+func Test_ConnectivityWatchdog_RestartAgent(t *testing.T) {
+	apiClient := api.NewClient("invalid-host.example", "12345")
+	service := configuration.New(apiClient, t.TempDir(), "")
+
+	committedConfig := configuration.CommittedConfig{
+		Bundles: []string{"connectivity_watchdog"},
+		BundleData: configuration.BundleData{
+			ConnectivityWatchdog: &configuration.ConnectivityWatchdogBundle{
+				Metadata:  configuration.Metadata{Enabled: true},
+				Threshold: "2",
+				Action:    configuration.WatchdogRestartAgent,
+			},
+		},
+	}
+
+	ctx := context.Background()
+
+	if err := service.Execute(ctx, &committedConfig); err != nil {
+		t.Fatalf("error executing config: %v", err)
+	}
+
+	for i := 0; i < 2; i++ {
+		if _, err := service.Get(ctx); !errors.As(err, new(api.ConnectionError)) {
+			t.Fatalf("expected connection error, got %t", err)
+		}
+	}
+
+	if !service.ShouldRestartAgent() {
+		t.Fatalf("should restart agent flag not set")
+	}
+
+	if service.ShouldReboot() {
+		t.Fatalf("unexpected should reboot flag")
+	}
+
+	// counter is reset after the action, so the next failure doesn't trigger the watchdog again
+	service.ResetRestartAgentAfterRun()
+
+	if _, err := service.Get(ctx); !errors.As(err, new(api.ConnectionError)) {
+		t.Fatalf("expected connection error, got %t", err)
+	}
+
+	if service.ShouldRestartAgent() {
+		t.Fatalf("unexpected should restart agent flag")
+	}
+}
+
+func Test_ConnectivityWatchdog_InvalidAction(t *testing.T) {
+	bundle := configuration.ConnectivityWatchdogBundle{
+		Threshold: "2",
+		Action:    "shutdown",
+	}
+
+	if err := bundle.Execute(context.Background(), configuration.New(nil, "", "")); err == nil {
+		t.Fatalf("expected error for invalid action")
+	}
+}
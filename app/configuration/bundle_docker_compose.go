@@ -19,12 +19,15 @@ package configuration
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io/fs"
 	"os"
 	"os/exec"
 	"path"
 	"path/filepath"
 	"regexp"
+	"sort"
 	"strings"
 
 	"go.qbee.io/agent/app/utils"
@@ -53,6 +56,9 @@ type DockerComposeBundle struct {
 
 	// Clean removes all docker compose projects that are not defined in the bundle.
 	Clean bool `json:"clean,omitempty"`
+
+	// Runtime is the container runtime used to run compose projects (docker or podman). Defaults to docker.
+	Runtime string `json:"runtime,omitempty"`
 }
 
 var dockerComposeVersionRE = regexp.MustCompile(`Docker Compose version v?([0-9.]+)`)
@@ -63,37 +69,19 @@ const dockerComposeMinimumVersion = "2.0.0"
 // Execute docker compose configuration bundle on the system.
 func (d DockerComposeBundle) Execute(ctx context.Context, service *Service) error {
 
-	dockerBin, err := exec.LookPath("docker")
-	if err != nil {
-		ReportError(ctx, nil, "Docker compose configuration configured, but no docker executable found on system")
-		return fmt.Errorf("docker compose not supported: %v", err)
-	}
-
-	output, err := utils.RunCommand(ctx, []string{"docker", "compose", "version"})
+	runtime, err := d.getRuntime(ctx)
 	if err != nil {
-		ReportError(ctx, err, "Docker Compose is not installed")
-		return err
-	}
-
-	version, err := d.ParseVersion(string(output))
-	if err != nil {
-		ReportError(ctx, err, "Cannot parse Docker Compose version")
-		return err
-	}
-
-	if !utils.IsNewerVersionOrEqual(version, dockerComposeMinimumVersion) {
-		ReportError(ctx, err, "Docker Compose version %s is not supported. Minimum version is %s", version, dockerComposeMinimumVersion)
 		return err
 	}
 
 	// populate all registry credentials
 	for _, auth := range d.RegistryAuths {
-		auth.ContainerRuntime = dockerRuntimeType
+		auth.ContainerRuntime = runtime.name
 		auth.Server = resolveParameters(ctx, auth.Server)
 		auth.Username = resolveParameters(ctx, auth.Username)
 		auth.Password = resolveParameters(ctx, auth.Password)
 
-		if err = auth.execute(ctx, dockerBin); err != nil {
+		if err = auth.execute(ctx, runtime.bin); err != nil {
 			ReportError(ctx, err, "Unable to authenticate with %s repository.", auth.URL())
 			return err
 		}
@@ -103,25 +91,35 @@ func (d DockerComposeBundle) Execute(ctx context.Context, service *Service) erro
 	for _, project := range d.Projects {
 		project.Name = resolveParameters(ctx, project.Name)
 		project.File = resolveParameters(ctx, project.File)
+
+		files := make([]string, len(project.Files))
+		for i, file := range project.Files {
+			files[i] = resolveParameters(ctx, file)
+		}
+		project.Files = files
+
 		project.Context = resolveParameters(ctx, project.Context)
 		project.PreCondition = resolveParameters(ctx, project.PreCondition)
+		project.runtime = runtime
 
 		configuredProjects[project.Name] = project
 	}
 
-	runningProjects, err := d.getLocalStatus(ctx)
+	runningProjects, err := d.getLocalStatus(ctx, runtime)
 	if err != nil {
 		ReportError(ctx, err, "Cannot get list of running compose projects")
 		return err
 	}
 
 	// clean projects first to release resources
-	if err := d.clean(ctx, service, configuredProjects, runningProjects); err != nil {
+	if err := d.clean(ctx, service, runtime, configuredProjects, runningProjects); err != nil {
 		ReportError(ctx, err, "Cannot clean up compose projects")
 		return err
 	}
 
 	for _, project := range d.Projects {
+		project.runtime = runtime
+
 		if !CheckPreCondition(ctx, project.PreCondition) {
 			continue
 		}
@@ -133,7 +131,8 @@ func (d DockerComposeBundle) Execute(ctx context.Context, service *Service) erro
 		}
 
 		restart := false
-		if runningProject, ok := runningProjects[project.Name]; ok {
+		runningProject, running := runningProjects[project.Name]
+		if running {
 			restart = project.needsRestart(runningProject) && !project.SkipRestart
 		}
 
@@ -141,25 +140,15 @@ func (d DockerComposeBundle) Execute(ctx context.Context, service *Service) erro
 			ReportWarning(ctx, nil, "One or more containers in exited state for project %s. Restart scehduled", project.Name)
 		}
 
-		if created || restart {
-			dockerComposeStart := []string{
-				"docker",
-				"compose",
-				"--project-name",
-				project.Name,
-				"--project-directory",
-				filepath.Join(service.cacheDirectory, DockerComposeDirectory, project.Name, composeContext),
-				"--file",
-				filepath.Join(service.cacheDirectory, DockerComposeDirectory, project.Name, composeFile),
-				"up",
-				"--build",
-				"--remove-orphans",
-				"--wait",
-				"--timeout",
-				dockerComposeTimeout,
-				"--timestamps",
-				"--force-recreate",
-			}
+		start := created || restart
+
+		// recreating containers of a running project is deferred until the maintenance window
+		if running {
+			start = service.restartAllowed(ctx, "compose:"+project.Name, start)
+		}
+
+		if start {
+			dockerComposeStart := runtime.upCommand(project, service)
 
 			output, err := utils.RunCommand(ctx, dockerComposeStart)
 			if err != nil {
@@ -167,13 +156,91 @@ func (d DockerComposeBundle) Execute(ctx context.Context, service *Service) erro
 				return err
 			}
 
-			ReportInfo(ctx, output, "Started compose project %s", project.Name)
+			reportChange(ctx, output, "Started compose project %s", project.Name)
 		}
 	}
 
 	return nil
 }
 
+// getRuntime returns compose runtime configured for the bundle, making sure it's available on the system.
+func (d DockerComposeBundle) getRuntime(ctx context.Context) (composeRuntime, error) {
+	switch d.Runtime {
+	case "", dockerRuntimeType:
+		return d.getDockerRuntime(ctx)
+	case podmanRuntimeType:
+		return d.getPodmanRuntime(ctx)
+	default:
+		ReportError(ctx, nil, "Unsupported compose runtime %s", d.Runtime)
+		return composeRuntime{}, fmt.Errorf("unsupported compose runtime: %s", d.Runtime)
+	}
+}
+
+// getDockerRuntime returns docker compose runtime.
+func (d DockerComposeBundle) getDockerRuntime(ctx context.Context) (composeRuntime, error) {
+	dockerBin, err := exec.LookPath("docker")
+	if err != nil {
+		ReportError(ctx, nil, "Docker compose configuration configured, but no docker executable found on system")
+		return composeRuntime{}, fmt.Errorf("docker compose not supported: %v", err)
+	}
+
+	output, err := utils.RunCommand(ctx, []string{"docker", "compose", "version"})
+	if err != nil {
+		ReportError(ctx, err, "Docker Compose is not installed")
+		return composeRuntime{}, err
+	}
+
+	version, err := d.ParseVersion(string(output))
+	if err != nil {
+		ReportError(ctx, err, "Cannot parse Docker Compose version")
+		return composeRuntime{}, err
+	}
+
+	if !utils.IsNewerVersionOrEqual(version, dockerComposeMinimumVersion) {
+		ReportError(ctx, err, "Docker Compose version %s is not supported. Minimum version is %s", version, dockerComposeMinimumVersion)
+		return composeRuntime{}, fmt.Errorf("unsupported docker compose version %s", version)
+	}
+
+	runtime := composeRuntime{
+		name:      dockerRuntimeType,
+		bin:       dockerBin,
+		command:   []string{"docker", "compose"},
+		directory: DockerComposeDirectory,
+	}
+
+	return runtime, nil
+}
+
+// getPodmanRuntime returns podman compose runtime.
+// Native `podman compose` is preferred, with standalone podman-compose used as a fallback.
+func (d DockerComposeBundle) getPodmanRuntime(ctx context.Context) (composeRuntime, error) {
+	podmanBin, err := exec.LookPath("podman")
+	if err != nil {
+		ReportError(ctx, nil, "Podman compose configuration configured, but no podman executable found on system")
+		return composeRuntime{}, fmt.Errorf("podman compose not supported: %v", err)
+	}
+
+	runtime := composeRuntime{
+		name:      podmanRuntimeType,
+		bin:       podmanBin,
+		command:   []string{"podman", "compose"},
+		directory: PodmanComposeDirectory,
+	}
+
+	if _, err = utils.RunCommand(ctx, []string{"podman", "compose", "version"}); err == nil {
+		return runtime, nil
+	}
+
+	if _, lookupErr := exec.LookPath("podman-compose"); lookupErr != nil {
+		ReportError(ctx, err, "Podman Compose is not installed")
+		return composeRuntime{}, err
+	}
+
+	runtime.command = []string{"podman-compose"}
+
+	return runtime, nil
+}
+
 // projectStatus is a project that is running in the system.
 type projectStatus struct {
 	Name   string `json:"Name"`
@@ -211,6 +278,7 @@ func (c Compose) getResources(ctx context.Context, service *Service) (bool, erro
 	return downloadedComposeFile || downloadedContextFile, nil
 }
 
+// getComposeFile downloads all compose files of the project and returns true if any of them has changed.
 func (c Compose) getComposeFile(ctx context.Context, service *Service) (bool, error) {
 
 	projectDirectory := c.getProjectDirectory(service)
@@ -219,18 +287,57 @@ func (c Compose) getComposeFile(ctx context.Context, service *Service) (bool, er
 		return false, err
 	}
 
-	composeFilePath := filepath.Join(projectDirectory, composeFile)
-
 	parameters := templateParametersMap(c.Parameters)
 
-	if len(parameters) > 0 {
-		return service.downloadTemplateFile(ctx, "", c.File, composeFilePath, parameters)
+	changed := false
+	for i, file := range c.composeFiles() {
+		composeFilePath := filepath.Join(projectDirectory, localComposeFileName(i))
+
+		var downloaded bool
+		var err error
+		if len(parameters) > 0 {
+			downloaded, err = service.downloadTemplateFile(ctx, "", file, composeFilePath, parameters)
+		} else {
+			downloaded, err = service.downloadFile(ctx, "", file, composeFilePath)
+		}
+		if err != nil {
+			return false, err
+		}
+
+		changed = changed || downloaded
+	}
+
+	removed, err := c.removeStaleComposeFiles(projectDirectory)
+	if err != nil {
+		return false, err
+	}
+
+	return changed || removed, nil
+}
+
+// removeStaleComposeFiles removes local override files which are no longer part of the project.
+// Returns true if any file was removed, so the project is redeployed without the removed override.
+func (c Compose) removeStaleComposeFiles(projectDirectory string) (bool, error) {
+	removed := false
+	for i := len(c.composeFiles()); ; i++ {
+		if i == 0 {
+			continue
+		}
+
+		err := os.Remove(filepath.Join(projectDirectory, localComposeFileName(i)))
+		if errors.Is(err, fs.ErrNotExist) {
+			return removed, nil
+		}
+		if err != nil {
+			return removed, err
+		}
+
+		removed = true
 	}
-	return service.downloadFile(ctx, "", c.File, composeFilePath)
 }
 
 func (c Compose) getProjectDirectory(service *Service) string {
-	return filepath.Join(service.cacheDirectory, DockerComposeDirectory, c.Name)
+	return c.runtime.projectDirectory(service, c.Name)
 }
 
 func (c Compose) getContext(ctx context.Context, service *Service) (bool, error) {
@@ -275,8 +382,12 @@ func (c Compose) getContext(ctx context.Context, service *Service) (bool, error)
 	return true, nil
 }
 
-func (d DockerComposeBundle) getLocalStatus(ctx context.Context) (map[string]projectStatus, error) {
-	projectListingCmd := []string{"docker", "compose", "ls", "--all", "--format", "json"}
+func (d DockerComposeBundle) getLocalStatus(ctx context.Context, runtime composeRuntime) (map[string]projectStatus, error) {
+	if runtime.name == podmanRuntimeType {
+		return d.getLocalPodmanStatus(ctx, runtime)
+	}
+
+	projectListingCmd := append(append([]string{}, runtime.command...), "ls", "--all", "--format", "json")
 	output, err := utils.RunCommand(ctx, projectListingCmd)
 
 	if err != nil {
@@ -296,9 +407,72 @@ func (d DockerComposeBundle) getLocalStatus(ctx context.Context) (map[string]pro
 	return projects, nil
 }
 
+// podmanComposeProjectLabels are container labels carrying compose project name.
+// Native `podman compose` with docker-compose provider uses the docker label, podman-compose uses its own.
+var podmanComposeProjectLabels = []string{"com.docker.compose.project", "io.podman.compose.project"}
+
+// podmanContainerStatus is a container listed by podman.
+type podmanContainerStatus struct {
+	Labels map[string]string `json:"Labels"`
+	State  string            `json:"State"`
+}
+
+// getLocalPodmanStatus returns compose projects status based on podman containers,
+// as podman-compose does not support listing projects.
+func (d DockerComposeBundle) getLocalPodmanStatus(ctx context.Context, runtime composeRuntime) (map[string]projectStatus, error) {
+	output, err := utils.RunCommand(ctx, []string{runtime.bin, "ps", "--all", "--format", "json"})
+	if err != nil {
+		return nil, fmt.Errorf("cannot get list of running compose projects: %w", err)
+	}
+
+	return parsePodmanComposeStatus(output)
+}
+
+// parsePodmanComposeStatus groups podman containers by compose project and returns docker-like projects status.
+func parsePodmanComposeStatus(output []byte) (map[string]projectStatus, error) {
+	var containers []podmanContainerStatus
+	if err := json.Unmarshal(output, &containers); err != nil {
+		return nil, fmt.Errorf("cannot parse list of running compose projects: %w", err)
+	}
+
+	projectStates := make(map[string]map[string]int)
+	for _, container := range containers {
+		for _, label := range podmanComposeProjectLabels {
+			projectName, ok := container.Labels[label]
+			if !ok {
+				continue
+			}
+
+			if projectStates[projectName] == nil {
+				projectStates[projectName] = make(map[string]int)
+			}
+
+			projectStates[projectName][container.State]++
+			break
+		}
+	}
+
+	projects := make(map[string]projectStatus)
+	for projectName, states := range projectStates {
+		statuses := make([]string, 0, len(states))
+		for state, count := range states {
+			statuses = append(statuses, fmt.Sprintf("%s(%d)", state, count))
+		}
+		sort.Strings(statuses)
+
+		projects[projectName] = projectStatus{
+			Name:   projectName,
+			Status: strings.Join(statuses, ", "),
+		}
+	}
+
+	return projects, nil
+}
+
 func (d DockerComposeBundle) clean(
 	ctx context.Context,
 	service *Service,
+	runtime composeRuntime,
 	configuredProjects map[string]Compose,
 	runningProjects map[string]projectStatus,
 ) error {
@@ -312,11 +486,11 @@ func (d DockerComposeBundle) clean(
 		}
 
 		// Skip projects not deployed by qbee
-		if !project.isDeployed(service) {
+		if !project.isDeployed(service, runtime) {
 			continue
 		}
 
-		_, err := project.remove(ctx, service, project.Name)
+		_, err := project.remove(ctx, service, runtime)
 		if err != nil {
 			return fmt.Errorf("cannot stop compose project %s: %w", project.Name, err)
 		}
@@ -329,34 +503,19 @@ func (d Compose) needsRestart(project projectStatus) bool {
 	return strings.Contains(project.Status, "exited")
 }
 
-func (p projectStatus) remove(ctx context.Context, service *Service, projectName string) ([]byte, error) {
-	dockerComposeStop := []string{
-		"docker",
-		"compose",
-		"--project-name",
-		projectName,
-		"down",
-		"--remove-orphans",
-		"--volumes",
-		"--timeout",
-		"60",
-		"--rmi",
-		"all",
-	}
-
-	if output, err := utils.RunCommand(ctx, dockerComposeStop); err != nil {
+func (p projectStatus) remove(ctx context.Context, service *Service, runtime composeRuntime) ([]byte, error) {
+	if output, err := utils.RunCommand(ctx, runtime.downCommand(p.Name)); err != nil {
 		return output, err
 	}
 
-	dockerComposeProjectDir := filepath.Join(service.cacheDirectory, DockerComposeDirectory, projectName)
-	if err := os.RemoveAll(dockerComposeProjectDir); err != nil {
+	if err := os.RemoveAll(runtime.projectDirectory(service, p.Name)); err != nil {
 		return nil, err
 	}
 	return nil, nil
 }
 
-func (p projectStatus) isDeployed(service *Service) bool {
-	if _, err := os.Stat(filepath.Join(service.cacheDirectory, DockerComposeDirectory, p.Name)); err != nil {
+func (p projectStatus) isDeployed(service *Service, runtime composeRuntime) bool {
+	if _, err := os.Stat(runtime.projectDirectory(service, p.Name)); err != nil {
 		return false
 	}
 	return true
@@ -396,7 +555,7 @@ func downloadStateFileCompare(
 			return false, err
 		}
 
-		if stateData.SHA256() != fileMetadata.SHA256() {
+		if stateData.Digest() != fileMetadata.Digest() {
 			doDownload = true
 		}
 	}
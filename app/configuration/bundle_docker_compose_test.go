@@ -177,6 +177,61 @@ func Test_ComposeWithParams(t *testing.T) {
 	r.MustExec("docker", "compose", "-p", "project-a", "down", "--remove-orphans", "--volumes", "--timeout", "60", "--rmi", "all")
 }
 
+func Test_ComposeRedactsSecrets(t *testing.T) {
+
+	r := runner.New(t)
+
+	dockerComposeBundle := configuration.DockerComposeBundle{
+		Projects: []configuration.Compose{
+			{
+				Name: "$(project)",
+				File: "file:///docker-compose/compose-nobuild.yml",
+			},
+		},
+	}
+
+	dockerComposeBundle.Enabled = true
+
+	config := configuration.CommittedConfig{
+		Bundles: []string{configuration.BundleParameters, configuration.BundleDockerCompose},
+		BundleData: configuration.BundleData{
+			Parameters: &configuration.ParametersBundle{
+				Metadata: configuration.Metadata{Enabled: true},
+				Secrets: []configuration.Parameter{
+					{Key: "project", Value: "secret-project"},
+				},
+			},
+			DockerCompose: &dockerComposeBundle,
+		},
+	}
+
+	reports, logs := configuration.ExecuteTestConfigInDocker(r, config)
+	expectedReports := []string{
+		"[INFO] Successfully downloaded file file:///docker-compose/compose-nobuild.yml to /var/lib/qbee/app_workdir/cache/docker_compose/********/compose.yml",
+		"[INFO] Started compose project ********",
+	}
+
+	assert.Equal(t, reports, expectedReports)
+
+	// compose up output contains container names derived from the project name
+	redactedOutput := false
+	for _, line := range logs {
+		if strings.Contains(line, "secret-project") {
+			t.Fatalf("secret found in compose output: %s", line)
+		}
+
+		if strings.Contains(line, "********-web-1") {
+			redactedOutput = true
+		}
+	}
+
+	if !redactedOutput {
+		t.Fatalf("expected redacted compose output, got %v", logs)
+	}
+
+	r.MustExec("docker", "compose", "-p", "secret-project", "down", "--remove-orphans", "--volumes", "--timeout", "60", "--rmi", "all")
+}
+
 func Test_ComposeWithBuildContext(t *testing.T) {
 
 	r := runner.New(t)
@@ -33,9 +33,12 @@ import (
 //	     "image": "debian:stable",
 //	     "docker_args": "-v /path/to/data-volume:/data --hostname my-hostname",
 //	     "env_file": "/my-directory/my-envfile",
+//	     "env": {"API_TOKEN": "$(api_token)"},
 //	     "command": "echo 'hello world!'"
 //		  }
 //		],
+//	 "log_tail_lines": 50,
+//	 "clean": true,
 //	 "registry_auths": [
 //	   {
 //	      "server": "gcr.io",
@@ -52,6 +55,13 @@ type DockerContainersBundle struct {
 
 	// RegistryAuths contains credentials to private docker registries.
 	RegistryAuths []RegistryAuth `json:"registry_auths"`
+
+	// LogTailLines defines how many lines of container logs are attached to reports
+	// when a container fails to start or exits unexpectedly (default: 50).
+	LogTailLines int `json:"log_tail_lines,omitempty"`
+
+	// Clean removes containers started by the agent, which are not defined in the bundle.
+	Clean bool `json:"clean,omitempty"`
 }
 
 // Execute docker containers configuration bundle on the system.
@@ -75,24 +85,40 @@ func (d DockerContainersBundle) Execute(ctx context.Context, service *Service) e
 		}
 	}
 
+	containers := make([]Container, 0, len(d.Containers))
+
 	for containerIndex, container := range d.Containers {
 		container.ContainerRuntime = dockerRuntimeType
 		container.Name = resolveParameters(ctx, container.Name)
 		container.Image = resolveParameters(ctx, container.Image)
 		container.Args = resolveParameters(ctx, container.Args)
 		container.EnvFile = resolveParameters(ctx, container.EnvFile)
+		container.Env = resolveContainerEnv(ctx, container.Env)
 		container.Command = resolveParameters(ctx, container.Command)
 		container.PreCondition = resolveParameters(ctx, container.PreCondition)
+		container.LogTailLines = d.LogTailLines
 
 		// for containers with empty name, use its index
 		if container.Name == "" {
 			container.Name = fmt.Sprintf("%d", containerIndex)
 		}
 
+		containers = append(containers, container)
+	}
+
+	if err = checkContainerNames(ctx, dockerRuntimeType, dockerBin, containers); err != nil {
+		return err
+	}
+
+	for _, container := range containers {
 		if err = container.execute(ctx, service, dockerBin); err != nil {
 			return err
 		}
 	}
 
+	if d.Clean {
+		return cleanOrphanedContainers(ctx, dockerRuntimeType, dockerBin, containers)
+	}
+
 	return nil
 }
@@ -161,6 +161,50 @@ func Test_DockerContainers_Container_StartExited(t *testing.T) {
 	assert.Equal(t, string(output), fmt.Sprintf(`"%s"`, dockerBundle.Containers[0].Command))
 }
 
+func Test_DockerContainers_Container_RestartPolicy(t *testing.T) {
+	r := runner.New(t)
+
+	r.MustExec("apt-get", "install", "-y", "docker-ce-cli")
+
+	containerName := fmt.Sprintf("%s-%d", t.Name(), time.Now().Unix())
+
+	// container exits briefly after start, so the runtime keeps restarting it
+	dockerBundle := configuration.DockerContainersBundle{
+		Containers: []configuration.Container{
+			{
+				Name:          containerName,
+				Image:         runner.Debian,
+				RestartPolicy: "always",
+				Command:       "sleep 1",
+			},
+		},
+	}
+
+	reports := executeDockerContainersBundle(r, dockerBundle)
+	expectedReports := []string{
+		"[INFO] Successfully started container for image debian:qbee.",
+	}
+	assert.Equal(t, reports, expectedReports)
+
+	// let the container exit, agent should leave restarting to the runtime
+	time.Sleep(2 * time.Second)
+
+	reports = executeDockerContainersBundle(r, dockerBundle)
+	assert.Empty(t, reports)
+
+	// configuration change still restarts the container
+	dockerBundle.Containers[0].Command = "sleep 2"
+
+	reports = executeDockerContainersBundle(r, dockerBundle)
+	expectedReports = []string{
+		"[WARN] Container configuration update detected for image debian:qbee.",
+		"[INFO] Successfully restarted container for image debian:qbee.",
+	}
+	assert.Equal(t, reports, expectedReports)
+
+	r.MustExec("docker", "rm", "--force", containerName)
+}
+
 func Test_DockerContainers_Container_RestartOnConfigChange(t *testing.T) {
 	r := runner.New(t)
 
@@ -208,6 +252,48 @@ func Test_DockerContainers_Container_RestartOnConfigChange(t *testing.T) {
 	assert.Equal(t, string(output), fmt.Sprintf(`"%s"`, dockerBundle.Containers[0].Command))
 }
 
+func Test_DockerContainers_Container_SecurityOptions(t *testing.T) {
+	r := runner.New(t)
+
+	r.MustExec("apt-get", "install", "-y", "docker-ce-cli")
+
+	containerName := fmt.Sprintf("%s-%d", t.Name(), time.Now().Unix())
+
+	dockerBundle := configuration.DockerContainersBundle{
+		Containers: []configuration.Container{
+			{
+				Name:    containerName,
+				Image:   runner.Debian,
+				Args:    "--rm",
+				Command: "sleep 5",
+			},
+		},
+	}
+
+	reports := executeDockerContainersBundle(r, dockerBundle)
+	expectedReports := []string{
+		"[INFO] Successfully started container for image debian:qbee.",
+	}
+	assert.Equal(t, reports, expectedReports)
+
+	// adding security settings triggers a container restart
+	dockerBundle.Containers[0].SecurityOpts = []string{"no-new-privileges"}
+	dockerBundle.Containers[0].CapDrop = []string{"ALL"}
+	dockerBundle.Containers[0].CapAdd = []string{"NET_BIND_SERVICE"}
+	dockerBundle.Containers[0].ReadOnly = true
+
+	reports = executeDockerContainersBundle(r, dockerBundle)
+	expectedReports = []string{
+		"[WARN] Container configuration update detected for image debian:qbee.",
+		"[INFO] Successfully restarted container for image debian:qbee.",
+	}
+	assert.Equal(t, reports, expectedReports)
+
+	format := "{{.HostConfig.SecurityOpt}} {{.HostConfig.CapDrop}} {{.HostConfig.ReadonlyRootfs}}"
+	output := r.MustExec("docker", "container", "inspect", containerName, "--format", format)
+	assert.Equal(t, string(output), "[no-new-privileges] [ALL] true")
+}
+
 func Test_DockerContainers_Container_PreCondition(t *testing.T) {
 	r := runner.New(t)
 
@@ -256,6 +342,96 @@ func Test_DockerContainers_Container_PreCondition(t *testing.T) {
 	assert.Empty(t, reports)
 }
 
+func Test_DockerContainers_Container_DuplicateNames(t *testing.T) {
+	r := runner.New(t)
+
+	r.MustExec("apt-get", "install", "-y", "docker-ce-cli")
+
+	containerName := fmt.Sprintf("%s-%d", t.Name(), time.Now().Unix())
+
+	dockerBundle := configuration.DockerContainersBundle{
+		Containers: []configuration.Container{
+			{
+				Name:    containerName,
+				Image:   runner.Debian,
+				Args:    "--rm",
+				Command: "sleep 5",
+			},
+			{
+				Name:    containerName,
+				Image:   runner.Debian,
+				Args:    "--rm",
+				Command: "sleep 10",
+			},
+		},
+	}
+
+	reports := executeDockerContainersBundle(r, dockerBundle)
+	expectedReports := []string{
+		fmt.Sprintf("[ERR] Duplicate container names found in configuration: %s", containerName),
+	}
+
+	assert.Equal(t, reports, expectedReports)
+
+	// check that no container was started
+	output := r.MustExec("docker", "container", "ls", "--filter", "name="+containerName, "--format", "{{.ID}}")
+	assert.Empty(t, string(output))
+}
+
+func Test_DockerContainers_Container_PullPolicy(t *testing.T) {
+	r := runner.New(t)
+
+	r.MustExec("apt-get", "install", "-y", "docker-ce-cli")
+
+	containerName := fmt.Sprintf("%s-%d", t.Name(), time.Now().Unix())
+
+	dockerBundle := configuration.DockerContainersBundle{
+		Containers: []configuration.Container{
+			{
+				Name:       containerName,
+				Image:      "qbee-missing-image:latest",
+				Args:       "--rm",
+				Command:    "sleep 5",
+				PullPolicy: "never",
+			},
+		},
+	}
+
+	// image which is not available locally is not pulled with "never" pull policy
+	reports := executeDockerContainersBundle(r, dockerBundle)
+	expectedReports := []string{
+		"[ERR] Image qbee-missing-image:latest is not available locally (pull policy: never).",
+	}
+	assert.Equal(t, reports, expectedReports)
+
+	// locally available image is used with "never" pull policy
+	image := fmt.Sprintf("qbee-pull-policy-test:%d", time.Now().Unix())
+	r.MustExec("docker", "tag", runner.Debian, image)
+	dockerBundle.Containers[0].Image = image
+
+	reports = executeDockerContainersBundle(r, dockerBundle)
+	expectedReports = []string{
+		fmt.Sprintf("[INFO] Successfully started container for image %s.", image),
+	}
+	assert.Equal(t, reports, expectedReports)
+
+	// image ID of the running container is recorded
+	imageID := r.MustExec("docker", "image", "inspect", "--format", "{{.Id}}", image)
+	format := `{{index .Config.Labels "qbee-docker-image-id"}}`
+	output := r.MustExec("docker", "container", "inspect", containerName, "--format", format)
+	assert.Equal(t, string(output), string(imageID))
+
+	// container is restarted when the configured tag points to a different image
+	r.MustExec("docker", "tag", runner.OpenWRT, image)
+
+	reports = executeDockerContainersBundle(r, dockerBundle)
+	expectedReports = []string{
+		fmt.Sprintf("[WARN] Container image update detected for image %s.", image),
+		fmt.Sprintf("[INFO] Successfully restarted container for image %s.", image),
+	}
+	assert.Equal(t, reports, expectedReports)
+}
+
 // executeDockerContainersBundle is a helper method to quickly execute docker containers bundle.
 // On success, it returns a slice of produced reports.
 func executeDockerContainersBundle(r *runner.Runner, bundle configuration.DockerContainersBundle) []string {
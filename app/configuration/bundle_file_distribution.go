@@ -18,7 +18,9 @@ package configuration
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"path/filepath"
 )
 
 // FileDistributionBundle controls files in the system.
@@ -33,7 +35,25 @@ import (
 //	       {
 //	         "source": "demo_file.json",
 //	         "destination": "/tmp/demo_file.json",
-//	         "is_template": true
+//	         "is_template": true,
+//	         "durable": true,
+//	         "immutable": true,
+//	         "owner": "app",
+//	         "group": "app",
+//	         "mode": "0600",
+//	         "command": "systemctl reload app"
+//	       },
+//	       {
+//	         "source": "app-1.2.3.tar.gz",
+//	         "destination": "/opt/app/app-1.2.3.tar.gz",
+//	         "extract": "/opt/app/releases/1.2.3"
+//	       }
+//	     ],
+//	     "symlinks": [
+//	       {
+//	         "target": "/etc/app/releases/123",
+//	         "link_path": "/etc/app/current",
+//	         "force": false
 //	       }
 //	     ],
 //	     "parameters": [
@@ -42,6 +62,7 @@ import (
 //	         "value": "VAL1"
 //	       }
 //	     ],
+//	     "transactional": true,
 //	     "command": "echo \"it worked!\""
 //	   }
 //	 ]
@@ -63,74 +84,284 @@ type FileSet struct {
 	// Parameters define values to be used for template files.
 	TemplateParameters []TemplateParameter `json:"parameters"`
 
+	// Symlinks defines symbolic links to be maintained in the filesystem (after files are processed).
+	Symlinks []Symlink `json:"symlinks,omitempty"`
+
 	// AfterCommand defines a command to be executed after files are saved on the filesystem.
 	AfterCommand string `json:"command"`
 
+	// Transactional defines whether files changed by the FileSet are restored to their previous versions
+	// when processing of the FileSet or any of its after commands fails.
+	// After restoring the files, the FileSet after command is executed again to reload the previous configuration.
+	Transactional bool `json:"transactional,omitempty"`
+
 	// PreCondition defines an optional command which needs to return 0 in order for the FileSet to be executed.
 	PreCondition string `json:"pre_condition" bson:"pre_condition"`
+
+	// When defines an optional condition on system facts and parameters (see CheckCondition),
+	// which needs to be met in order for the FileSet to be executed (e.g. "sys.arch == 'aarch64'").
+	When string `json:"when,omitempty"`
 }
 
 // File defines a single file parameters.
 type File struct {
-	// Source full file path from the file manager.
+	// Source full file path from the file manager, local file (file://) or HTTP(S) URL.
 	Source string `json:"source"`
 
+	// Digest defines optional expected digest of the source file ("<algorithm>:<hex>" or "<hex>").
+	// For HTTP(S) sources, it's required unless the server provides file checksum in response headers.
+	Digest string `json:"digest,omitempty"`
+
+	// DigestAlgorithm defines algorithm (sha256, sha512 or blake3) used to verify Digest
+	// and detect changes of local and rendered template files. Defaults to sha256.
+	DigestAlgorithm DigestAlgorithm `json:"digest_algorithm,omitempty"`
+
 	// Destination defines absolute path of the file in the filesystem.
+	// Destination can contain parameters and system facts (e.g. "/etc/app/$(sys.host).conf").
 	Destination string `json:"destination"`
 
 	// IsTemplate defines whether the file should be processed by the templating engine.
 	IsTemplate bool `json:"is_template"`
+
+	// Durable defines whether the file and its parent directory should be synced to disk after being written.
+	// This protects critical files from being lost on power loss, at the cost of slower writes.
+	Durable bool `json:"durable,omitempty"`
+
+	// Immutable defines whether the file should have the immutable attribute set (chattr +i).
+	// The attribute is re-applied when cleared and temporarily removed when the agent updates the file.
+	Immutable bool `json:"immutable,omitempty"`
+
+	// AfterCommand defines an optional command to be executed only when this file was (re)written.
+	// It's executed before the file set AfterCommand, in order of files in the set.
+	AfterCommand string `json:"command,omitempty"`
+
+	// Extract defines an optional absolute path of a directory where the file is extracted as a tar archive
+	// (tar, tar.gz or tar.bz2). The archive is extracted again only when its contents change.
+	// Ownership and permissions defined by FileAttributes are applied to the extracted tree.
+	Extract string `json:"extract,omitempty"`
+
+	// FileAttributes define optional owner, group and mode of the file.
+	FileAttributes
 }
 
 // Execute file distribution config on the system.
 func (fd FileDistributionBundle) Execute(ctx context.Context, service *Service) error {
 	for _, fileSet := range fd.FileSets {
+		if !conditionMet(ctx, fileSet.When) {
+			continue
+		}
+
 		if !CheckPreCondition(ctx, fileSet.PreCondition) {
 			continue
 		}
 
-		parameters := templateParametersMap(fileSet.TemplateParameters)
-		anythingChanged := false
+		if err := fileSet.execute(ctx, service); err != nil {
+			return err
+		}
+	}
 
-		for _, file := range fileSet.Files {
-			var err error
-			var fileSource string
-			var fileDestination string
+	return nil
+}
 
-			if fileSource, err = resolveSourcePath(file.Source); err != nil {
-				return fmt.Errorf("cannot resolve file path: %w", err)
-			}
+// execute processes files and symlinks of the file set.
+// In transactional mode, files changed by a failing file set are restored to their previous versions.
+func (fileSet FileSet) execute(ctx context.Context, service *Service) (err error) {
+	parameters := templateParametersMap(fileSet.TemplateParameters)
+	anythingChanged := false
 
-			if fileDestination, err = resolveDestinationPath(fileSource, file.Destination); err != nil {
-				return fmt.Errorf("cannot resolve file path: %w", err)
+	// failing file after command doesn't prevent other files in the set from being processed
+	var afterCommandErr error
+
+	// previous versions of rewritten files are kept until the transactional file set succeeds
+	var snapshotter *fileSnapshotter
+	if fileSet.Transactional {
+		snapshotter = &fileSnapshotter{directory: filepath.Join(service.cacheDirectory, fileSnapshotDirectory)}
+
+		defer func() {
+			if err == nil {
+				snapshotter.snapshots.discard(ctx, fileSet.Label)
+			} else if len(snapshotter.snapshots) > 0 {
+				fileSet.rollback(ctx, snapshotter.snapshots)
 			}
+		}()
+	}
+
+	for _, file := range fileSet.Files {
+		var err error
+		var fileSource string
+		var fileDestination string
+
+		if fileSource, err = resolveSourcePath(resolveParameters(ctx, file.Source)); err != nil {
+			return fmt.Errorf("cannot resolve file path: %w", err)
+		}
+
+		// resolve parameters and system facts (e.g. $(sys.host)) before checking the destination path
+		fileDestination = resolveParameters(ctx, file.Destination)
+
+		if fileDestination, err = resolveDestinationPath(fileSource, fileDestination); err != nil {
+			return fmt.Errorf("cannot resolve file path: %w", err)
+		}
+
+		var attrs *fileAttributes
+		if attrs, err = file.FileAttributes.resolve(); err != nil {
+			ReportError(ctx, err, msgWithLabel(fileSet.Label, "Invalid file attributes for %s", fileDestination))
+			return err
+		}
 
-			var created bool
+		if file.Immutable {
+			attrs = attrs.withImmutable()
+		}
+
+		fileCtx := withFileSnapshotter(withFileAttributes(ctx, attrs), snapshotter)
 
-			if file.IsTemplate {
-				created, err = service.downloadTemplateFile(ctx, fileSet.Label, fileSource, fileDestination, parameters)
-			} else {
-				created, err = service.downloadFile(ctx, fileSet.Label, fileSource, fileDestination)
+		if file.DigestAlgorithm != "" {
+			if err = file.DigestAlgorithm.validate(); err != nil {
+				ReportError(ctx, err, msgWithLabel(fileSet.Label, "Invalid digest algorithm for %s", fileSource))
+				return err
 			}
 
-			if err != nil {
+			fileCtx = withFileDigestAlgorithm(fileCtx, file.DigestAlgorithm)
+		}
+
+		if file.Digest != "" {
+			var digest fileDigest
+			if digest, err = parseFileDigest(file.Digest, file.DigestAlgorithm); err != nil {
+				ReportError(ctx, err, msgWithLabel(fileSet.Label, "Invalid digest for %s", fileSource))
 				return err
 			}
 
-			if created {
-				anythingChanged = true
+			fileCtx = withFileDigest(fileCtx, digest)
+		}
+
+		// errors are ignored, since file might not exist yet or filesystem doesn't support the attribute
+		wasImmutable, _ := isImmutable(fileDestination)
+
+		var created bool
+
+		if file.IsTemplate {
+			created, err = service.downloadTemplateFile(fileCtx, fileSet.Label, fileSource, fileDestination, parameters)
+		} else {
+			created, err = service.downloadFile(fileCtx, fileSet.Label, fileSource, fileDestination)
+		}
+
+		if err != nil {
+			return err
+		}
+
+		if created && file.Durable {
+			if err = syncToDisk(fileDestination); err != nil {
+				ReportError(ctx, err, msgWithLabel(fileSet.Label, "Unable to sync file %s to disk", fileDestination))
+				return err
 			}
 		}
 
-		if anythingChanged && fileSet.AfterCommand != "" {
-			output, err := RunCommand(ctx, fileSet.AfterCommand)
-			if err != nil {
-				ReportError(ctx, output, msgWithLabel(fileSet.Label, "After command failed: %v", err))
+		if err = file.ensureImmutability(ctx, fileSet.Label, fileDestination, wasImmutable); err != nil {
+			return err
+		}
+
+		if file.Extract != "" {
+			var extracted bool
+			extractDirectory := resolveParameters(ctx, file.Extract)
+
+			if extracted, err = service.extractArchive(fileCtx, fileSet.Label, fileDestination, extractDirectory); err != nil {
 				return err
 			}
 
-			ReportInfo(ctx, output, msgWithLabel(fileSet.Label, "Successfully executed after command"))
+			created = created || extracted
+		}
+
+		if created {
+			anythingChanged = true
+		}
+
+		if created && file.AfterCommand != "" {
+			output, cmdErr := RunCommand(ctx, file.AfterCommand)
+			if cmdErr != nil {
+				ReportError(ctx, output, msgWithLabel(fileSet.Label, "After command for %s failed: %v", fileDestination, cmdErr))
+				if afterCommandErr == nil {
+					afterCommandErr = cmdErr
+				}
+				continue
+			}
+
+			ReportInfo(ctx, output, msgWithLabel(fileSet.Label, "Successfully executed after command for %s", fileDestination))
+		}
+	}
+
+	for _, symlink := range fileSet.Symlinks {
+		symlink.Target = resolveParameters(ctx, symlink.Target)
+		symlink.LinkPath = resolveParameters(ctx, symlink.LinkPath)
+
+		changed, err := symlink.ensure(ctx, fileSet.Label)
+		if err != nil {
+			return err
+		}
+
+		if changed {
+			anythingChanged = true
+		}
+	}
+
+	if anythingChanged && fileSet.AfterCommand != "" {
+		output, err := RunCommand(ctx, fileSet.AfterCommand)
+		if err != nil {
+			ReportError(ctx, output, msgWithLabel(fileSet.Label, "After command failed: %v", err))
+			return err
+		}
+
+		ReportInfo(ctx, output, msgWithLabel(fileSet.Label, "Successfully executed after command"))
+	}
+
+	if afterCommandErr != nil {
+		return afterCommandErr
+	}
+
+	return nil
+}
+
+// rollback restores previous versions of files changed by the failed file set
+// and executes the file set after command again to reload the previous configuration.
+func (fileSet FileSet) rollback(ctx context.Context, snapshots fileSnapshots) {
+	if !snapshots.rollback(ctx, fileSet.Label) {
+		return
+	}
+
+	ReportWarning(ctx, nil, msgWithLabel(fileSet.Label, "Rolled back %d changed file(s) to previous versions", len(snapshots)))
+
+	if fileSet.AfterCommand == "" {
+		return
+	}
+
+	output, err := RunCommand(ctx, fileSet.AfterCommand)
+	if err != nil {
+		ReportError(ctx, output, msgWithLabel(fileSet.Label, "After command failed after rollback: %v", err))
+		return
+	}
+
+	ReportInfo(ctx, output, msgWithLabel(fileSet.Label, "Successfully executed after command after rollback"))
+}
+
+// ensureImmutability sets the immutable attribute on the file if it's configured.
+// wasImmutable defines whether the file was immutable before it was processed by the agent.
+func (f File) ensureImmutability(ctx context.Context, label, path string, wasImmutable bool) error {
+	if !f.Immutable {
+		return nil
+	}
+
+	changed, err := setImmutable(path, true)
+	if err != nil {
+		if errors.Is(err, errImmutableNotSupported) {
+			ReportWarning(ctx, nil, msgWithLabel(label, "Immutable attribute is not supported for %s", path))
+			return nil
 		}
+
+		ReportError(ctx, err, msgWithLabel(label, "Unable to set immutable attribute on %s", path))
+		return err
+	}
+
+	// attribute is silently re-applied after the agent updated the file
+	if changed && !wasImmutable {
+		reportChange(ctx, nil, msgWithLabel(label, "Immutable attribute set on %s", path))
 	}
 
 	return nil
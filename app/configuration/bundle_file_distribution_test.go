@@ -19,6 +19,7 @@ package configuration_test
 import (
 	"fmt"
 	"path/filepath"
+	"strings"
 	"testing"
 
 	"go.qbee.io/agent/app/agent"
@@ -56,6 +57,112 @@ func Test_FileDistributionBundle(t *testing.T) {
 	assert.Equal(t, string(output), "e45340c618b94c459663efc454ea1a50  /tmp/test1")
 }
 
+func Test_FileDistributionBundle_JSONReports(t *testing.T) {
+	r := runner.New(t)
+
+	localFileRef := "file:///apt-repo/repo/qbee-test_2.1.1_all.deb"
+
+	agentConfig := configuration.CommittedConfig{
+		CommitID: "config-commit",
+		Bundles:  []string{configuration.BundleFileDistribution},
+		BundleData: configuration.BundleData{
+			FileDistribution: &configuration.FileDistributionBundle{
+				Metadata: configuration.Metadata{Enabled: true, CommitID: "bundle-commit"},
+				FileSets: []configuration.FileSet{
+					{Files: []configuration.File{{Source: localFileRef, Destination: "/tmp/test1"}}},
+				},
+			},
+		},
+	}
+
+	reports, _ := configuration.ExecuteTestConfigInDockerJSON(r, agentConfig)
+	assert.Length(t, reports, 1)
+
+	report := reports[0]
+	assert.Equal(t, report.Severity, "INFO")
+	assert.Equal(t, report.Bundle, configuration.BundleFileDistribution)
+	assert.Equal(t, report.BundleCommitID, "bundle-commit")
+	assert.Equal(t, report.CommitID, "config-commit")
+	assert.HasPrefix(t, report.Text, "Successfully downloaded file")
+	assert.RecentUnix(t, report.Timestamp)
+}
+
+func Test_FileDistributionBundle_Immutable(t *testing.T) {
+	// setting immutable attribute requires CAP_LINUX_IMMUTABLE
+	r := runner.NewWithImage(t, runner.Debian, true)
+
+	localFileRef := "file:///apt-repo/repo/qbee-test_2.1.1_all.deb"
+	destination := "/etc/qbee-immutable-test"
+
+	file := configuration.File{Source: localFileRef, Destination: destination, Immutable: true}
+
+	agentConfig := configuration.CommittedConfig{
+		Bundles: []string{configuration.BundleFileDistribution},
+		BundleData: configuration.BundleData{
+			FileDistribution: &configuration.FileDistributionBundle{
+				Metadata: configuration.Metadata{Enabled: true},
+				FileSets: []configuration.FileSet{
+					{Files: []configuration.File{file}},
+				},
+			},
+		},
+	}
+
+	reports, _ := configuration.ExecuteTestConfigInDocker(r, agentConfig)
+
+	expectedReports := []string{
+		fmt.Sprintf("[INFO] Successfully downloaded file %s to %s", localFileRef, destination),
+		fmt.Sprintf("[INFO] Immutable attribute set on %s", destination),
+	}
+	assert.Equal(t, reports, expectedReports)
+
+	// immutable file cannot be modified locally
+	if _, err := r.Exec("sh", "-c", "echo modified > "+destination); err == nil {
+		t.Fatalf("expected immutable file to be protected from modification")
+	}
+
+	// no changes on subsequent run
+	reports, _ = configuration.ExecuteTestConfigInDocker(r, agentConfig)
+	assert.Empty(t, reports)
+
+	// legitimate update of the file keeps it immutable
+	r.MustExec("chattr", "-i", destination)
+	r.MustExec("sh", "-c", "echo modified > "+destination)
+	r.MustExec("chattr", "+i", destination)
+
+	reports, _ = configuration.ExecuteTestConfigInDocker(r, agentConfig)
+
+	expectedReports = []string{
+		fmt.Sprintf("[INFO] Successfully downloaded file %s to %s", localFileRef, destination),
+	}
+	assert.Equal(t, reports, expectedReports)
+
+	// cleared attribute is re-applied
+	r.MustExec("chattr", "-i", destination)
+
+	reports, _ = configuration.ExecuteTestConfigInDocker(r, agentConfig)
+
+	expectedReports = []string{
+		fmt.Sprintf("[INFO] Immutable attribute set on %s", destination),
+	}
+	assert.Equal(t, reports, expectedReports)
+
+	// attribute set by an admin is not cleared for files which are not managed as immutable
+	r.MustExec("chattr", "-i", destination)
+	r.MustExec("sh", "-c", "echo modified > "+destination)
+	r.MustExec("chattr", "+i", destination)
+
+	agentConfig.BundleData.FileDistribution.FileSets[0].Files[0].Immutable = false
+
+	reports, _ = configuration.ExecuteTestConfigInDocker(r, agentConfig)
+
+	expectedReports = []string{
+		fmt.Sprintf("[ERR] Unable to download file %s to %s", localFileRef, destination),
+	}
+	assert.Equal(t, reports, expectedReports)
+	assert.Equal(t, string(r.MustExec("cat", destination)), "modified")
+}
+
 func Test_FileDistributionBundle_IsTemplate(t *testing.T) {
 	r := runner.New(t)
 
@@ -179,6 +286,56 @@ func Test_FileDistributionBundle_AfterCommand(t *testing.T) {
 	assert.Equal(t, string(output), "it worked!")
 }
 
+func Test_FileDistributionBundle_FileAfterCommand(t *testing.T) {
+	r := runner.New(t)
+
+	localFileRef := "file:///apt-repo/repo/qbee-test_2.1.1_all.deb"
+
+	agentConfig := configuration.CommittedConfig{
+		Bundles: []string{configuration.BundleFileDistribution},
+		BundleData: configuration.BundleData{
+			FileDistribution: &configuration.FileDistributionBundle{
+				Metadata: configuration.Metadata{Enabled: true},
+				FileSets: []configuration.FileSet{
+					{
+						Files: []configuration.File{
+							{Source: localFileRef, Destination: "/tmp/test1", AfterCommand: "false"},
+							{Source: localFileRef, Destination: "/tmp/test2", AfterCommand: "echo 'file 2' > /tmp/test2.out"},
+						},
+						AfterCommand: "echo 'set' > /tmp/set.out",
+					},
+				},
+			},
+		},
+	}
+
+	reports, _ := configuration.ExecuteTestConfigInDocker(r, agentConfig)
+
+	expectedReports := []string{
+		fmt.Sprintf("[INFO] Successfully downloaded file %[1]s to /tmp/test1", localFileRef),
+		"[ERR] After command for /tmp/test1 failed: exit status 1",
+		fmt.Sprintf("[INFO] Successfully downloaded file %[1]s to /tmp/test2", localFileRef),
+		"[INFO] Successfully executed after command for /tmp/test2",
+		"[INFO] Successfully executed after command",
+	}
+	assert.Equal(t, reports, expectedReports)
+
+	assert.Equal(t, string(r.MustExec("cat", "/tmp/test2.out")), "file 2")
+	assert.Equal(t, string(r.MustExec("cat", "/tmp/set.out")), "set")
+
+	// only changed files trigger their after commands
+	r.MustExec("rm", "/tmp/test2", "/tmp/test2.out", "/tmp/set.out")
+
+	reports, _ = configuration.ExecuteTestConfigInDocker(r, agentConfig)
+
+	expectedReports = []string{
+		fmt.Sprintf("[INFO] Successfully downloaded file %[1]s to /tmp/test2", localFileRef),
+		"[INFO] Successfully executed after command for /tmp/test2",
+		"[INFO] Successfully executed after command",
+	}
+	assert.Equal(t, reports, expectedReports)
+}
+
 func Test_FileDistributionBundle_PreCondition_True(t *testing.T) {
 	r := runner.New(t)
 
@@ -325,6 +482,46 @@ func Test_FileDistributionBundle_Destination_Regular_Path(t *testing.T) {
 	assert.Equal(t, string(output), fmt.Sprintf("e45340c618b94c459663efc454ea1a50  %s", destFile))
 }
 
+func Test_FileDistributionBundle_Destination_WithParameters(t *testing.T) {
+	r := runner.New(t)
+
+	hostname := strings.TrimSpace(string(r.MustExec("hostname")))
+
+	localFileRef := "file:///apt-repo/repo/qbee-test_2.1.1_all.deb"
+	destFile := "/tmp/$(app)/$(sys.host).deb"
+	expectedDestFile := fmt.Sprintf("/tmp/qbee-test/%s.deb", hostname)
+
+	agentConfig := configuration.CommittedConfig{
+		Bundles: []string{configuration.BundleParameters, configuration.BundleFileDistribution},
+		BundleData: configuration.BundleData{
+			Parameters: &configuration.ParametersBundle{
+				Metadata:   configuration.Metadata{Enabled: true},
+				Parameters: []configuration.Parameter{{Key: "app", Value: "qbee-test"}},
+			},
+			FileDistribution: &configuration.FileDistributionBundle{
+				Metadata: configuration.Metadata{Enabled: true},
+				FileSets: []configuration.FileSet{
+					{
+						Files: []configuration.File{
+							{Source: localFileRef, Destination: destFile},
+						},
+					},
+				},
+			},
+		},
+	}
+
+	reports, _ := configuration.ExecuteTestConfigInDocker(r, agentConfig)
+
+	expectedReports := []string{
+		fmt.Sprintf("[INFO] Successfully downloaded file %s to %s", localFileRef, expectedDestFile),
+	}
+	assert.Equal(t, reports, expectedReports)
+
+	output := r.MustExec("md5sum", expectedDestFile)
+	assert.Equal(t, string(output), fmt.Sprintf("e45340c618b94c459663efc454ea1a50  %s", expectedDestFile))
+}
+
 func Test_FileDistributionBundle_Destination_Dirname_NotExists(t *testing.T) {
 	r := runner.New(t)
 
@@ -0,0 +1,56 @@
+// Copyright 2023 qbee.io
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package configuration
+
+import (
+	"fmt"
+	"slices"
+)
+
+// BundleFilter selects bundles executed during configuration runs (e.g. to skip a misbehaving bundle while debugging).
+// Settings and parameters bundles are always processed, as other bundles depend on them.
+type BundleFilter struct {
+	// Skip lists bundles which are not executed.
+	Skip []string
+
+	// Only lists bundles which are executed (all bundles are executed when empty).
+	Only []string
+}
+
+// Validate checks that the filter refers only to known bundles, which can be skipped.
+func (f BundleFilter) Validate() error {
+	for _, bundleName := range append(slices.Clone(f.Skip), f.Only...) {
+		if bundleName == BundleSettings || bundleName == BundleParameters {
+			return fmt.Errorf("%s bundle cannot be filtered", bundleName)
+		}
+
+		if new(CommittedConfig).selectBundleByName(bundleName) == nil {
+			return fmt.Errorf("unknown bundle: %s", bundleName)
+		}
+	}
+
+	return nil
+}
+
+// allows returns true if the bundle should be executed.
+func (f BundleFilter) allows(bundleName string) bool {
+	if slices.Contains(f.Skip, bundleName) {
+		return false
+	}
+
+	return len(f.Only) == 0 || slices.Contains(f.Only, bundleName)
+}
@@ -0,0 +1,65 @@
+// Copyright 2023 qbee.io
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package configuration
+
+import (
+	"testing"
+
+	"go.qbee.io/agent/app/utils/assert"
+)
+
+func TestBundleFilter_Validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		filter  BundleFilter
+		wantErr string
+	}{
+		{name: "empty filter"},
+		{name: "known bundles", filter: BundleFilter{Skip: []string{BundleFirewall}, Only: []string{BundleUsers}}},
+		{name: "unknown bundle", filter: BundleFilter{Skip: []string{"firewal"}}, wantErr: "unknown bundle: firewal"},
+		{name: "settings", filter: BundleFilter{Skip: []string{BundleSettings}}, wantErr: "settings bundle cannot be filtered"},
+		{name: "parameters", filter: BundleFilter{Only: []string{BundleParameters}}, wantErr: "parameters bundle cannot be filtered"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.filter.Validate()
+			if tt.wantErr == "" {
+				assert.NoError(t, err)
+				return
+			}
+
+			if err == nil {
+				t.Fatalf("expected error %q, got nil", tt.wantErr)
+			}
+			assert.Equal(t, err.Error(), tt.wantErr)
+		})
+	}
+}
+
+func TestBundleFilter_allows(t *testing.T) {
+	assert.True(t, BundleFilter{}.allows(BundleFirewall))
+
+	skip := BundleFilter{Skip: []string{BundleFirewall}}
+	assert.False(t, skip.allows(BundleFirewall))
+	assert.True(t, skip.allows(BundleUsers))
+
+	only := BundleFilter{Only: []string{BundleUsers, BundleFirewall}, Skip: []string{BundleFirewall}}
+	assert.True(t, only.allows(BundleUsers))
+	assert.False(t, only.allows(BundleFirewall))
+	assert.False(t, only.allows(BundleHosts))
+}
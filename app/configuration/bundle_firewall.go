@@ -146,29 +146,52 @@ func (c FirewallChain) execute(ctx context.Context, table FirewallTableName, cha
 
 	ReportWarning(ctx, currentRules, "Current firewall rules are not in compliance.")
 
-	// flush all rules
-	flushCmd := []string{iptablesBin, "-t", string(table), "-F", string(chain)}
-	if _, err = utils.RunCommand(ctx, flushCmd); err != nil {
-		ReportError(ctx, err, "Firewall configuration failed.")
-		return err
+	// apply only the difference, so established connections are not dropped while rules are changed
+	pinEstablished := table == Filter && chain == Input
+	operations, ok := firewallChainDiff(chain, strings.Split(string(currentRules), "\n"), expectedRules, pinEstablished)
+	if !ok {
+		if operations, err = c.flushOperations(ctx, iptablesBin, table, chain); err != nil {
+			ReportError(ctx, err, "Firewall configuration failed.")
+			return err
+		}
 	}
 
-	applyRules := c.Render(table, chain, true)
-
-	// apply correct rules
-	for _, rule := range applyRules {
-		cmd := append([]string{iptablesBin, "-t", string(table)}, strings.Fields(rule)...)
+	for _, operation := range operations {
+		cmd := append([]string{iptablesBin, "-t", string(table)}, operation...)
 		if _, err = utils.RunCommand(ctx, cmd); err != nil {
 			ReportError(ctx, err, "Firewall configuration failed.")
 			return err
 		}
 	}
 
-	ReportInfo(ctx, nil, "Load of new iptables rules succeeded for table %s.", table)
+	reportChange(ctx, nil, "Load of new iptables rules succeeded for table %s.", table)
 
 	return nil
 }
 
+// flushOperations flushes all rules of the chain and returns operations re-adding all the rules.
+// It's used only when current rules can't be safely compared with the expected ones.
+func (c FirewallChain) flushOperations(
+	ctx context.Context,
+	iptablesBin string,
+	table FirewallTableName,
+	chain FirewallChainName,
+) ([][]string, error) {
+	flushCmd := []string{iptablesBin, "-t", string(table), "-F", string(chain)}
+	if _, err := utils.RunCommand(ctx, flushCmd); err != nil {
+		return nil, err
+	}
+
+	applyRules := c.Render(table, chain, true)
+
+	operations := make([][]string, 0, len(applyRules))
+	for _, rule := range applyRules {
+		operations = append(operations, strings.Fields(rule))
+	}
+
+	return operations, nil
+}
+
 func (c FirewallChain) renderRules(table FirewallTableName, chain FirewallChainName) []string {
 	// for INPUT chain in the filter table we want to add some special rules
 	rules := make([]string, 0)
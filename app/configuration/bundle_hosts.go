@@ -0,0 +1,262 @@
+// Copyright 2023 qbee.io
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package configuration
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"regexp"
+	"strings"
+	"syscall"
+)
+
+// HostsBundle manages static host name mappings in a delimited block of /etc/hosts.
+// Lines outside the managed block (e.g. entries maintained by DHCP clients) are left untouched.
+//
+// Example payload:
+//
+//	{
+//	 "entries": [
+//	   {
+//	     "ip": "10.0.0.10",
+//	     "hostnames": ["registry.internal", "registry"]
+//	   },
+//	   {
+//	     "ip": "fd00::10",
+//	     "hostnames": ["metrics.internal"]
+//	   }
+//	 ]
+//	}
+type HostsBundle struct {
+	Metadata
+
+	// Entries defines host name mappings in the managed block (empty list removes the block).
+	Entries []HostsEntry `json:"entries"`
+}
+
+// HostsEntry defines a single IP address to host names mapping.
+type HostsEntry struct {
+	// IP is an IPv4 or IPv6 address.
+	IP string `json:"ip"`
+
+	// Hostnames is a list of host names (canonical name first, followed by aliases).
+	Hostnames []string `json:"hostnames"`
+}
+
+const (
+	hostsBlockBegin = "# BEGIN qbee managed hosts - do not edit"
+	hostsBlockEnd   = "# END qbee managed hosts"
+	hostsFileMode   = 0644
+)
+
+// hostsFilePath is a variable, so it can be overridden in tests.
+var hostsFilePath = "/etc/hosts"
+
+var hostnameRE = regexp.MustCompile(`^[A-Za-z0-9]([A-Za-z0-9_.-]*[A-Za-z0-9])?$`)
+
+// line returns hosts file line for the entry with normalized IP address.
+func (entry HostsEntry) line() (string, error) {
+	ip := net.ParseIP(entry.IP)
+	if ip == nil {
+		return "", fmt.Errorf("invalid IP address: %q", entry.IP)
+	}
+
+	if len(entry.Hostnames) == 0 {
+		return "", fmt.Errorf("no host names defined for %s", entry.IP)
+	}
+
+	for _, hostname := range entry.Hostnames {
+		if !hostnameRE.MatchString(hostname) {
+			return "", fmt.Errorf("invalid host name for %s: %q", entry.IP, hostname)
+		}
+	}
+
+	return ip.String() + "\t" + strings.Join(entry.Hostnames, " "), nil
+}
+
+// Execute hosts configuration bundle on the system.
+func (h HostsBundle) Execute(ctx context.Context, _ *Service) error {
+	lines := make([]string, 0, len(h.Entries))
+
+	for _, entry := range h.Entries {
+		entry.IP = resolveParameters(ctx, entry.IP)
+
+		hostnames := make([]string, len(entry.Hostnames))
+		for i, hostname := range entry.Hostnames {
+			hostnames[i] = resolveParameters(ctx, hostname)
+		}
+		entry.Hostnames = hostnames
+
+		line, err := entry.line()
+		if err != nil {
+			ReportError(ctx, err, "Invalid hosts entry.")
+			return err
+		}
+
+		lines = append(lines, line)
+	}
+
+	currentContents, err := os.ReadFile(hostsFilePath)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		ReportError(ctx, err, "Unable to read %s.", hostsFilePath)
+		return err
+	}
+
+	newContents, added, removed, err := updateHostsBlock(currentContents, lines)
+	if err != nil {
+		ReportError(ctx, err, "Unable to update %s, file left unchanged.", hostsFilePath)
+		return err
+	}
+
+	if bytes.Equal(currentContents, newContents) {
+		return nil
+	}
+
+	if err = writeHostsFile(newContents); err != nil {
+		ReportError(ctx, err, "Unable to update %s.", hostsFilePath)
+		return err
+	}
+
+	if len(added) > 0 {
+		reportChange(ctx, strings.Join(added, "\n"), "Hosts entries added: %d.", len(added))
+	}
+
+	if len(removed) > 0 {
+		reportChange(ctx, strings.Join(removed, "\n"), "Hosts entries removed: %d.", len(removed))
+	}
+
+	return nil
+}
+
+// updateHostsBlock replaces the managed block in hosts file contents with provided lines.
+// The block is appended at the end of the file when it doesn't exist yet and removed when there are no lines.
+// Returns new contents of the file together with added and removed lines of the managed block.
+// Returns an error when the file contains the begin marker without the end marker.
+func updateHostsBlock(contents []byte, lines []string) ([]byte, []string, []string, error) {
+	before, block, after, found := splitHostsBlock(string(contents))
+
+	// without the end marker, the extent of the managed block is unknown, so the file must be left alone
+	if !found && hostsBlockBeginIndex(before) >= 0 {
+		return contents, nil, nil, errHostsBlockIncomplete
+	}
+
+	var newContents strings.Builder
+
+	newContents.WriteString(before)
+
+	if len(lines) > 0 {
+		if before != "" && !strings.HasSuffix(before, "\n") {
+			newContents.WriteString("\n")
+		}
+
+		newContents.WriteString(hostsBlockBegin + "\n")
+		for _, line := range lines {
+			newContents.WriteString(line + "\n")
+		}
+		newContents.WriteString(hostsBlockEnd + "\n")
+	}
+
+	if found {
+		newContents.WriteString(after)
+	}
+
+	return []byte(newContents.String()), linesDifference(lines, block), linesDifference(block, lines), nil
+}
+
+// errHostsBlockIncomplete is returned when the managed block in hosts file is missing the end marker.
+var errHostsBlockIncomplete = fmt.Errorf("managed block is missing the end marker (%s)", hostsBlockEnd)
+
+// hostsBlockBeginIndex returns index of the managed block begin marker line or -1 if not found.
+func hostsBlockBeginIndex(contents string) int {
+	beginIndex := strings.Index(contents, hostsBlockBegin+"\n")
+	if beginIndex < 0 || (beginIndex > 0 && contents[beginIndex-1] != '\n') {
+		return -1
+	}
+
+	return beginIndex
+}
+
+// splitHostsBlock splits hosts file contents into parts before and after the managed block and lines of the block.
+// Returns false, when the file doesn't contain the managed block (including a block without the end marker).
+func splitHostsBlock(contents string) (string, []string, string, bool) {
+	beginIndex := hostsBlockBeginIndex(contents)
+	if beginIndex < 0 {
+		return contents, nil, "", false
+	}
+
+	blockStart := beginIndex + len(hostsBlockBegin) + 1
+
+	endIndex := strings.Index(contents[blockStart:], hostsBlockEnd)
+	if endIndex < 0 {
+		return contents, nil, "", false
+	}
+
+	blockEnd := blockStart + endIndex
+	after := strings.TrimPrefix(contents[blockEnd+len(hostsBlockEnd):], "\n")
+
+	return contents[:beginIndex], hostsBlockLines(contents[blockStart:blockEnd]), after, true
+}
+
+// hostsBlockLines returns non-empty lines of the managed block.
+func hostsBlockLines(block string) []string {
+	lines := make([]string, 0)
+
+	for _, line := range strings.Split(block, "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			lines = append(lines, line)
+		}
+	}
+
+	return lines
+}
+
+// linesDifference returns lines from a, which are not present in b.
+func linesDifference(a, b []string) []string {
+	present := make(map[string]bool, len(b))
+	for _, line := range b {
+		present[line] = true
+	}
+
+	difference := make([]string, 0)
+	for _, line := range a {
+		if !present[line] {
+			difference = append(difference, line)
+		}
+	}
+
+	return difference
+}
+
+// writeHostsFile replaces the hosts file atomically, keeping its owner and mode.
+// Hosts file bind-mounted into a container cannot be replaced, so it's rewritten in place instead.
+func writeHostsFile(contents []byte) error {
+	err := writeFileAtomically(hostsFilePath, hostsFileMode, nil, func(w io.Writer) error {
+		_, writeErr := w.Write(contents)
+		return writeErr
+	})
+
+	if errors.Is(err, syscall.EBUSY) {
+		return os.WriteFile(hostsFilePath, contents, hostsFileMode)
+	}
+
+	return err
+}
@@ -0,0 +1,198 @@
+// Copyright 2023 qbee.io
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package configuration
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"go.qbee.io/agent/app/utils/assert"
+)
+
+// executeHostsBundle executes hosts bundle against the hosts file in a temporary directory.
+func executeHostsBundle(t *testing.T, hostsPath string, bundle HostsBundle) ([]string, error) {
+	originalPath := hostsFilePath
+	hostsFilePath = hostsPath
+	defer func() { hostsFilePath = originalPath }()
+
+	reporter := NewReporter("", false, nil)
+	ctx := reporter.BundleContext(context.Background(), "", "")
+	ctx = new(ParametersBundle).Context(ctx, nil)
+
+	err := bundle.Execute(ctx, nil)
+
+	reports := make([]string, 0, len(reporter.reports))
+	for _, report := range reporter.reports {
+		reports = append(reports, report.String())
+	}
+
+	return reports, err
+}
+
+func readHostsFile(t *testing.T, path string) string {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	return string(data)
+}
+
+func TestHostsBundle(t *testing.T) {
+	hostsPath := filepath.Join(t.TempDir(), "hosts")
+
+	unmanaged := "127.0.0.1\tlocalhost\n192.168.1.20\tdevice # added by DHCP client\n"
+	if err := os.WriteFile(hostsPath, []byte(unmanaged), 0644); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// insert
+	bundle := HostsBundle{
+		Entries: []HostsEntry{
+			{IP: "10.0.0.10", Hostnames: []string{"registry.internal", "registry"}},
+			{IP: "FD00:0:0::10", Hostnames: []string{"metrics.internal"}},
+		},
+	}
+
+	reports, err := executeHostsBundle(t, hostsPath, bundle)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	assert.Equal(t, reports, []string{"[INFO] Hosts entries added: 2."})
+	assert.Equal(t, readHostsFile(t, hostsPath), unmanaged+
+		hostsBlockBegin+"\n"+
+		"10.0.0.10\tregistry.internal registry\n"+
+		"fd00::10\tmetrics.internal\n"+
+		hostsBlockEnd+"\n")
+
+	// no changes
+	reports, err = executeHostsBundle(t, hostsPath, bundle)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	assert.Equal(t, reports, []string{})
+
+	// lines added outside the managed block are kept
+	contents := readHostsFile(t, hostsPath) + "192.168.1.30\tprinter\n"
+	if err = os.WriteFile(hostsPath, []byte(contents), 0644); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// update
+	bundle.Entries[0].IP = "10.0.0.11"
+
+	reports, err = executeHostsBundle(t, hostsPath, bundle)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	assert.Equal(t, reports, []string{"[INFO] Hosts entries added: 1.", "[INFO] Hosts entries removed: 1."})
+	assert.Equal(t, readHostsFile(t, hostsPath), unmanaged+
+		hostsBlockBegin+"\n"+
+		"10.0.0.11\tregistry.internal registry\n"+
+		"fd00::10\tmetrics.internal\n"+
+		hostsBlockEnd+"\n"+
+		"192.168.1.30\tprinter\n")
+
+	// remove
+	reports, err = executeHostsBundle(t, hostsPath, HostsBundle{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	assert.Equal(t, reports, []string{"[INFO] Hosts entries removed: 2."})
+	assert.Equal(t, readHostsFile(t, hostsPath), unmanaged+"192.168.1.30\tprinter\n")
+}
+
+func TestHostsBundle_NoTrailingNewline(t *testing.T) {
+	hostsPath := filepath.Join(t.TempDir(), "hosts")
+
+	if err := os.WriteFile(hostsPath, []byte("127.0.0.1\tlocalhost"), 0600); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	bundle := HostsBundle{Entries: []HostsEntry{{IP: "10.0.0.10", Hostnames: []string{"registry"}}}}
+
+	if _, err := executeHostsBundle(t, hostsPath, bundle); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	assert.Equal(t, readHostsFile(t, hostsPath), "127.0.0.1\tlocalhost\n"+
+		hostsBlockBegin+"\n"+
+		"10.0.0.10\tregistry\n"+
+		hostsBlockEnd+"\n")
+
+	// mode of the existing file is preserved
+	fileInfo, err := os.Stat(hostsPath)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	assert.Equal(t, fileInfo.Mode().Perm(), os.FileMode(0600))
+}
+
+func TestHostsBundle_MissingEndMarker(t *testing.T) {
+	hostsPath := filepath.Join(t.TempDir(), "hosts")
+
+	contents := "127.0.0.1\tlocalhost\n" +
+		hostsBlockBegin + "\n" +
+		"10.0.0.10\tregistry\n" +
+		"192.168.1.30\tprinter\n"
+
+	if err := os.WriteFile(hostsPath, []byte(contents), 0644); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	bundle := HostsBundle{Entries: []HostsEntry{{IP: "10.0.0.11", Hostnames: []string{"registry"}}}}
+
+	reports, err := executeHostsBundle(t, hostsPath, bundle)
+	if err == nil {
+		t.Fatalf("expected error for missing end marker")
+	}
+
+	assert.Length(t, reports, 1)
+	assert.HasPrefix(t, reports[0], "[ERR] Unable to update")
+
+	// lines after the begin marker are not treated as managed, so the file is left alone
+	assert.Equal(t, readHostsFile(t, hostsPath), contents)
+}
+
+func TestHostsBundle_InvalidEntry(t *testing.T) {
+	hostsPath := filepath.Join(t.TempDir(), "hosts")
+
+	tests := []struct {
+		name  string
+		entry HostsEntry
+	}{
+		{name: "invalid IP", entry: HostsEntry{IP: "10.0.0.256", Hostnames: []string{"registry"}}},
+		{name: "no host names", entry: HostsEntry{IP: "10.0.0.10"}},
+		{name: "invalid host name", entry: HostsEntry{IP: "10.0.0.10", Hostnames: []string{"registry\n10.0.0.1"}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reports, err := executeHostsBundle(t, hostsPath, HostsBundle{Entries: []HostsEntry{tt.entry}})
+			if err == nil {
+				t.Fatalf("expected error")
+			}
+			assert.Equal(t, reports, []string{"[ERR] Invalid hosts entry."})
+
+			if _, err = os.Stat(hostsPath); !os.IsNotExist(err) {
+				t.Fatalf("expected hosts file not to be created, got %v", err)
+			}
+		})
+	}
+}
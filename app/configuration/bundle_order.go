@@ -0,0 +1,101 @@
+// Copyright 2023 qbee.io
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package configuration
+
+import (
+	"fmt"
+	"strings"
+)
+
+// executionOrder returns bundles of the configuration ordered, so each bundle is executed after its dependencies.
+// Bundles without dependencies between them keep their configured order.
+// When dependencies form a cycle, the configured order is returned with an error.
+func (cc *CommittedConfig) executionOrder() ([]string, error) {
+	// position of each bundle in the configured order
+	positions := make(map[string]int, len(cc.Bundles))
+	for i, bundleName := range cc.Bundles {
+		if _, exists := positions[bundleName]; !exists {
+			positions[bundleName] = i
+		}
+	}
+
+	// pending number of dependencies and dependent bundles of each bundle
+	pendingDependencies := make(map[string]int, len(positions))
+	dependents := make(map[string][]string, len(positions))
+
+	for bundleName := range positions {
+		for _, dependency := range cc.bundleDependencies(bundleName) {
+			if _, configured := positions[dependency]; !configured || dependency == bundleName {
+				continue
+			}
+
+			pendingDependencies[bundleName]++
+			dependents[dependency] = append(dependents[dependency], bundleName)
+		}
+	}
+
+	order := make([]string, 0, len(positions))
+	executed := make(map[string]bool, len(positions))
+
+	// repeatedly select the first bundle (in the configured order) with all dependencies executed
+	for len(order) < len(positions) {
+		selected := ""
+
+		for _, bundleName := range cc.Bundles {
+			if !executed[bundleName] && pendingDependencies[bundleName] == 0 {
+				selected = bundleName
+				break
+			}
+		}
+
+		if selected == "" {
+			return cc.Bundles, fmt.Errorf("bundle dependencies contain a cycle: %s", cc.unorderedBundles(executed))
+		}
+
+		executed[selected] = true
+		order = append(order, selected)
+
+		for _, dependent := range dependents[selected] {
+			pendingDependencies[dependent]--
+		}
+	}
+
+	return order, nil
+}
+
+// bundleDependencies returns dependencies of the bundle (if the bundle is defined).
+func (cc *CommittedConfig) bundleDependencies(bundleName string) []string {
+	bundle := cc.selectBundleByName(bundleName)
+	if bundle == nil {
+		return nil
+	}
+
+	return bundle.Dependencies()
+}
+
+// unorderedBundles returns comma-separated list of configured bundles which are not executed.
+func (cc *CommittedConfig) unorderedBundles(executed map[string]bool) string {
+	bundles := make([]string, 0)
+
+	for _, bundleName := range cc.Bundles {
+		if !executed[bundleName] {
+			bundles = append(bundles, bundleName)
+		}
+	}
+
+	return strings.Join(bundles, ", ")
+}
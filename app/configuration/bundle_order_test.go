@@ -0,0 +1,112 @@
+// Copyright 2023 qbee.io
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package configuration
+
+import (
+	"testing"
+
+	"go.qbee.io/agent/app/utils/assert"
+)
+
+func Test_CommittedConfig_executionOrder(t *testing.T) {
+	tests := []struct {
+		name      string
+		config    CommittedConfig
+		wantOrder []string
+		wantErr   bool
+	}{
+		{
+			name: "no dependencies",
+			config: CommittedConfig{
+				Bundles: []string{BundleSettings, BundleDockerContainers, BundleFileDistribution},
+				BundleData: BundleData{
+					DockerContainers: &DockerContainersBundle{},
+					FileDistribution: &FileDistributionBundle{},
+				},
+			},
+			wantOrder: []string{BundleSettings, BundleDockerContainers, BundleFileDistribution},
+		},
+		{
+			name: "dependencies",
+			config: CommittedConfig{
+				Bundles: []string{
+					BundleSettings,
+					BundleDockerContainers,
+					BundleSoftwareManagement,
+					BundleFileDistribution,
+					BundleUsers,
+				},
+				BundleData: BundleData{
+					DockerContainers: &DockerContainersBundle{
+						Metadata: Metadata{DependsOn: []string{BundleSoftwareManagement}},
+					},
+					SoftwareManagement: &SoftwareManagementBundle{
+						Metadata: Metadata{DependsOn: []string{BundleFileDistribution, BundleParameters}},
+					},
+					FileDistribution: &FileDistributionBundle{},
+					Users:            &UsersBundle{},
+				},
+			},
+			wantOrder: []string{
+				BundleSettings,
+				BundleFileDistribution,
+				BundleSoftwareManagement,
+				BundleDockerContainers,
+				BundleUsers,
+			},
+		},
+		{
+			name: "dependency not configured",
+			config: CommittedConfig{
+				Bundles: []string{BundleDockerContainers, BundleUsers},
+				BundleData: BundleData{
+					DockerContainers: &DockerContainersBundle{
+						Metadata: Metadata{DependsOn: []string{BundleSoftwareManagement, BundleDockerContainers}},
+					},
+					Users: &UsersBundle{},
+				},
+			},
+			wantOrder: []string{BundleDockerContainers, BundleUsers},
+		},
+		{
+			name: "cycle",
+			config: CommittedConfig{
+				Bundles: []string{BundleUsers, BundleDockerContainers, BundleSoftwareManagement},
+				BundleData: BundleData{
+					Users: &UsersBundle{},
+					DockerContainers: &DockerContainersBundle{
+						Metadata: Metadata{DependsOn: []string{BundleSoftwareManagement}},
+					},
+					SoftwareManagement: &SoftwareManagementBundle{
+						Metadata: Metadata{DependsOn: []string{BundleDockerContainers}},
+					},
+				},
+			},
+			wantOrder: []string{BundleUsers, BundleDockerContainers, BundleSoftwareManagement},
+			wantErr:   true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			order, err := tt.config.executionOrder()
+
+			assert.Equal(t, order, tt.wantOrder)
+			assert.Equal(t, err != nil, tt.wantErr)
+		})
+	}
+}
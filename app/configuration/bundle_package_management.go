@@ -18,7 +18,9 @@ package configuration
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"strings"
 
 	"go.qbee.io/agent/app/software"
 )
@@ -36,7 +38,33 @@ import (
 //	   }
 //	 ],
 //	 "reboot_mode": "always",
-//	 "full_upgrade": false
+//	 "full_upgrade": false,
+//	 "dpkg_config_mode": "confold",
+//	 "apt_options": ["Acquire::Retries=3"],
+//	 "install_recommends": false,
+//	 "repositories": [
+//	   {
+//	     "name": "example",
+//	     "url": "https://packages.example.com/debian",
+//	     "distribution": "bookworm",
+//	     "components": ["main"],
+//	     "signing_key": "-----BEGIN PGP PUBLIC KEY BLOCK-----..."
+//	   }
+//	 ],
+//	 "modules": [
+//	   {
+//	     "name": "nodejs",
+//	     "stream": "18",
+//	     "profile": "common"
+//	   }
+//	 ],
+//	 "absent": [
+//	   {
+//	     "name": "telnetd"
+//	   }
+//	 ],
+//	 "purge": true,
+//	 "auto_remove": false
 //	}
 type PackageManagementBundle struct {
 	Metadata
@@ -45,6 +73,33 @@ type PackageManagementBundle struct {
 	RebootMode   RebootMode `json:"reboot_mode"`
 	FullUpgrade  bool       `json:"full_upgrade"`
 	Packages     []Package  `json:"items"`
+
+	// DpkgConfigMode defines how config file conflicts are resolved on Debian systems: confold (default) or confnew.
+	DpkgConfigMode software.DpkgConfigMode `json:"dpkg_config_mode,omitempty"`
+
+	// AptOptions are additional apt-get configuration options (passed as "-o <option>") on Debian systems.
+	AptOptions []string `json:"apt_options,omitempty"`
+
+	// InstallRecommends defines whether recommended packages (weak dependencies) are installed
+	// with installed and upgraded packages (Debian and dnf based systems). When not set, the system default is used.
+	InstallRecommends *bool `json:"install_recommends,omitempty"`
+
+	// Repositories defines third-party package repositories configured before installing packages.
+	Repositories []software.Repository `json:"repositories,omitempty"`
+
+	// Modules defines module streams enabled (and profiles installed) before installing packages.
+	// Supported only on systems using dnf with modularity (e.g. RHEL 8+).
+	Modules []software.Module `json:"modules,omitempty"`
+
+	// Absent defines packages which must not be installed in the system.
+	// Package versions are ignored - all installed versions are removed.
+	Absent []Package `json:"absent,omitempty"`
+
+	// Purge removes also configuration files of absent packages (Debian only).
+	Purge bool `json:"purge,omitempty"`
+
+	// AutoRemove removes also dependencies of absent packages, which are no longer required.
+	AutoRemove bool `json:"auto_remove,omitempty"`
 }
 
 // RebootMode defines whether system should be rebooted after package maintenance or not.
@@ -57,6 +112,10 @@ const (
 
 	// RebootAlways means that system will always be rebooted after package maintenance.
 	RebootAlways RebootMode = "always"
+
+	// RebootIfNeeded means that system will be rebooted after package maintenance,
+	// only if the operating system signals that a reboot is required (e.g. after kernel update).
+	RebootIfNeeded RebootMode = "if_needed"
 )
 
 // Package defines a package to be maintained in the system.
@@ -78,34 +137,196 @@ func (p PackageManagementBundle) Execute(ctx context.Context, service *Service)
 		return fmt.Errorf("unuspported package manager")
 	}
 
+	aptOptions := software.AptOptions{
+		ConfigMode:   p.DpkgConfigMode,
+		ExtraOptions: p.AptOptions,
+	}
+
+	if err := aptOptions.Validate(); err != nil {
+		ReportError(ctx, err, "Invalid apt options.")
+		return err
+	}
+
+	ctx = software.WithAptOptions(ctx, aptOptions)
+	ctx = withIndexUpdateSkippedReport(ctx)
+
+	if p.InstallRecommends != nil {
+		ctx = software.WithInstallRecommends(ctx, *p.InstallRecommends)
+	}
+
 	if busy, err := pkgManager.Busy(); err != nil {
 		ReportError(ctx, err, "Package manager error.")
 		return err
 	} else if busy {
+		ReportInfo(ctx, nil, "Package management skipped: package manager (%s) busy.", pkgManager.Type())
 		return nil
 	}
 
-	var err error
+	if err := p.configureRepositories(ctx, pkgManager); err != nil {
+		return err
+	}
+
+	modulesInstalled, err := p.configureModules(ctx, pkgManager)
+	if err != nil {
+		return err
+	}
+
+	removed, err := p.removePackages(ctx, pkgManager)
+	if err != nil {
+		return err
+	}
+
 	var updated bool
 
 	if p.FullUpgrade {
-		updated, err = p.fullUpgrade(ctx, pkgManager)
+		// full upgrade may restart services, so it's deferred until the maintenance window
+		if service.disruptiveActionAllowed(ctx, "Full upgrade") {
+			updated, err = p.fullUpgrade(ctx, pkgManager)
+		}
 	} else {
 		updated, err = p.partialUpgrade(ctx, pkgManager)
 	}
 
-	if updated && p.RebootMode == RebootAlways {
-		service.RebootAfterRun(ctx)
+	updated = updated || modulesInstalled || removed
+
+	if updated {
+		switch p.RebootMode {
+		case RebootAlways:
+			service.RebootAfterRun(ctx)
+		case RebootIfNeeded:
+			p.rebootIfNeeded(ctx, service, pkgManager)
+		}
 	}
 
 	return err
 }
 
+// rebootIfNeeded schedules a reboot when the operating system signals that it's required.
+func (p PackageManagementBundle) rebootIfNeeded(ctx context.Context, service *Service, pkgManager software.PackageManager) {
+	required, reason, err := pkgManager.RebootRequired(ctx)
+	if err != nil {
+		ReportWarning(ctx, err, "Unable to determine whether reboot is required.")
+		return
+	}
+
+	if !required {
+		return
+	}
+
+	ReportInfo(ctx, reason, "Reboot required after package maintenance.")
+	service.RebootAfterRun(ctx)
+}
+
+// configureRepositories ensures that package repositories defined in the bundle are configured.
+func (p PackageManagementBundle) configureRepositories(ctx context.Context, pkgManager software.PackageManager) error {
+	if len(p.Repositories) == 0 {
+		return nil
+	}
+
+	repos := make([]software.Repository, len(p.Repositories))
+	for i, repo := range p.Repositories {
+		repo.URL = resolveParameters(ctx, repo.URL)
+		repo.Distribution = resolveParameters(ctx, repo.Distribution)
+		repo.SigningKey = resolveParameters(ctx, repo.SigningKey)
+
+		components := make([]string, len(repo.Components))
+		for j, component := range repo.Components {
+			components[j] = resolveParameters(ctx, component)
+		}
+		repo.Components = components
+
+		repos[i] = repo
+	}
+
+	changes, output, err := pkgManager.ConfigureRepositories(ctx, repos)
+
+	added := make([]string, 0)
+	updated := make([]string, 0)
+
+	for _, change := range changes {
+		if change.Added {
+			added = append(added, change.Name)
+		} else {
+			updated = append(updated, change.Name)
+		}
+	}
+
+	if len(added) > 0 {
+		reportChange(ctx, nil, "Package repositories added: %s.", strings.Join(added, ", "))
+	}
+
+	if len(updated) > 0 {
+		reportChange(ctx, nil, "Package repositories updated: %s.", strings.Join(updated, ", "))
+	}
+
+	if err != nil {
+		ReportError(ctx, output, "Unable to configure package repositories: %v", err)
+		return err
+	}
+
+	return nil
+}
+
+// configureModules ensures that module streams defined in the bundle are enabled and their profiles installed.
+// Returns true if any module profile was installed.
+func (p PackageManagementBundle) configureModules(ctx context.Context, pkgManager software.PackageManager) (bool, error) {
+	if len(p.Modules) == 0 {
+		return false, nil
+	}
+
+	moduleManager, ok := pkgManager.(software.ModuleManager)
+	if !ok || !moduleManager.ModulesSupported(ctx) {
+		ReportError(ctx, nil, "Module streams are not supported by the package manager (%s).", pkgManager.Type())
+		return false, fmt.Errorf("module streams are not supported by %s package manager", pkgManager.Type())
+	}
+
+	modules := make([]software.Module, len(p.Modules))
+	for i, module := range p.Modules {
+		module.Name = resolveParameters(ctx, module.Name)
+		module.Stream = resolveParameters(ctx, module.Stream)
+		module.Profile = resolveParameters(ctx, module.Profile)
+
+		modules[i] = module
+	}
+
+	changes, output, err := moduleManager.ConfigureModules(ctx, modules)
+
+	enabled := make([]string, 0)
+	installed := make([]string, 0)
+
+	for _, change := range changes {
+		if change.Enabled {
+			enabled = append(enabled, change.Module.Name+":"+change.Module.Stream)
+		}
+
+		if change.Installed {
+			installed = append(installed, change.Module.String())
+		}
+	}
+
+	if len(enabled) > 0 {
+		reportChange(ctx, output, "Module streams enabled: %s.", strings.Join(enabled, ", "))
+	}
+
+	if len(installed) > 0 {
+		reportChange(ctx, output, "Module profiles installed: %s.", strings.Join(installed, ", "))
+	}
+
+	if err != nil {
+		ReportError(ctx, output, "Unable to configure module streams: %v", err)
+		return len(installed) > 0, err
+	}
+
+	return len(installed) > 0, nil
+}
+
 // fullUpgrade performs full system upgrade and reports the results.
 func (p PackageManagementBundle) fullUpgrade(ctx context.Context, pkgManager software.PackageManager) (bool, error) {
+	ctx = withReportAction(ctx, reportActionUpgrade, "")
+
 	updated, output, err := pkgManager.UpgradeAll(ctx)
 	if err != nil {
-		ReportError(ctx, err, "Full upgrade failed.")
+		ReportError(ctx, err, "Full upgrade failed.%s", packageFailuresSummary(err))
 		return false, err
 	}
 
@@ -113,7 +334,7 @@ func (p PackageManagementBundle) fullUpgrade(ctx context.Context, pkgManager sof
 		return false, nil
 	}
 
-	ReportInfo(ctx, output, "Full upgrade was successful - %d packages updated.", updated)
+	reportChange(ctx, output, "Full upgrade was successful - %d packages updated.", updated)
 
 	return true, nil
 }
@@ -134,7 +355,7 @@ func (p PackageManagementBundle) partialUpgrade(ctx context.Context, pkgManager
 		installedPackagesMap[installedPackages[i].Name] = &installedPackages[i]
 	}
 
-	packagesInstalled := false
+	pendingPackages := make([]software.Package, 0, len(p.Packages))
 
 	for _, pkg := range p.Packages {
 		pkg.Name = resolveParameters(ctx, pkg.Name)
@@ -153,15 +374,121 @@ func (p PackageManagementBundle) partialUpgrade(ctx context.Context, pkgManager
 			}
 		}
 
+		pendingPackages = append(pendingPackages, software.Package{Name: pkg.Name, Version: pkg.Version})
+	}
+
+	if len(pendingPackages) == 0 {
+		return false, nil
+	}
+
+	// install interdependent packages together, so the set is either installed as a whole or not at all
+	if transactionInstaller, ok := pkgManager.(software.TransactionInstaller); ok && len(pendingPackages) > 1 {
+		if err = p.installTransaction(ctx, transactionInstaller, pendingPackages); err != nil {
+			return false, err
+		}
+
+		return true, nil
+	}
+
+	for _, pkg := range pendingPackages {
+		ctx := withReportAction(ctx, reportActionInstall, pkg.Name)
+
 		output, err := pkgManager.Install(ctx, pkg.Name, pkg.Version)
 		if err != nil {
-			ReportError(ctx, err, "Unable to install package '%s'", pkg.Name)
+			ReportError(ctx, err, "Unable to install package '%s'.%s", pkg.Name, packageFailuresSummary(err))
 			return false, err
 		}
 
-		ReportInfo(ctx, output, "Package '%s' successfully installed.", pkg.Name)
-		packagesInstalled = true
+		reportChange(ctx, output, "Package '%s' successfully installed.", pkg.Name)
+	}
+
+	return true, nil
+}
+
+// installTransaction installs provided packages in a single package manager transaction.
+func (p PackageManagementBundle) installTransaction(
+	ctx context.Context,
+	transactionInstaller software.TransactionInstaller,
+	packages []software.Package,
+) error {
+	names := make([]string, len(packages))
+	for i, pkg := range packages {
+		names[i] = pkg.Name
+	}
+
+	ctx = withReportAction(ctx, reportActionInstall, strings.Join(names, ","))
+
+	output, err := transactionInstaller.InstallTransaction(ctx, packages)
+	if err != nil {
+		ReportError(ctx, err, "Unable to install packages: %s.%s", strings.Join(names, ", "), packageFailuresSummary(err))
+		return err
+	}
+
+	reportChange(ctx, output, "Packages successfully installed: %s.", strings.Join(names, ", "))
+
+	return nil
+}
+
+// removePackages ensures that packages defined as absent are not installed in the system.
+// Returns true if any package was removed.
+func (p PackageManagementBundle) removePackages(ctx context.Context, pkgManager software.PackageManager) (bool, error) {
+	if len(p.Absent) == 0 {
+		return false, nil
+	}
+
+	installedPackages, err := pkgManager.ListPackages(ctx)
+	if err != nil {
+		ReportError(ctx, err, "Unable to list installed packages.")
+		return false, err
+	}
+
+	installedPackagesMap := make(map[string]bool)
+	for _, pkg := range installedPackages {
+		installedPackagesMap[pkg.Name] = true
+	}
+
+	opts := software.RemoveOptions{
+		Purge:      p.Purge,
+		AutoRemove: p.AutoRemove,
+	}
+
+	packagesRemoved := false
+
+	for _, pkg := range p.Absent {
+		pkgName := resolveParameters(ctx, pkg.Name)
+
+		if !installedPackagesMap[pkgName] {
+			continue
+		}
+
+		ctx := withReportAction(ctx, reportActionRemove, pkgName)
+
+		output, err := pkgManager.Remove(ctx, pkgName, opts)
+		if err != nil {
+			ReportError(ctx, err, "Unable to remove package '%s'", pkgName)
+			return packagesRemoved, err
+		}
+
+		reportChange(ctx, output, "Package '%s' successfully removed.", pkgName)
+		packagesRemoved = true
+	}
+
+	return packagesRemoved, nil
+}
+
+// withIndexUpdateSkippedReport returns context reporting package index updates skipped by the index update policy.
+func withIndexUpdateSkippedReport(ctx context.Context) context.Context {
+	return software.WithIndexUpdateSkippedHandler(ctx, func(reason string) {
+		ReportInfo(ctx, nil, "Package index update skipped: %s.", reason)
+	})
+}
+
+// packageFailuresSummary returns a summary of failed packages (prefixed with a space) when err provides it.
+func packageFailuresSummary(err error) string {
+	var pkgErr *software.PackageError
+	if !errors.As(err, &pkgErr) {
+		return ""
 	}
 
-	return packagesInstalled, nil
+	return " " + pkgErr.Summary()
 }
@@ -22,6 +22,7 @@ import (
 	"testing"
 
 	"go.qbee.io/agent/app/configuration"
+	"go.qbee.io/agent/app/software"
 	"go.qbee.io/agent/app/utils/assert"
 	"go.qbee.io/agent/app/utils/runner"
 )
@@ -97,6 +98,7 @@ func Test_PackageManagement_InstallPackage_Downgrade(t *testing.T) {
 	runners := []*runner.Runner{
 		runner.New(t),
 		runner.NewRHELRunner(t),
+		runner.NewOpenWRTRunner(t),
 	}
 
 	wg := sync.WaitGroup{}
@@ -225,6 +227,113 @@ func Test_PackageManagement_InstallPackage_UpdateWithReboot(t *testing.T) {
 	wg.Wait()
 }
 
+func Test_PackageManagement_InstallPackage_UpdateWithRebootIfNeeded(t *testing.T) {
+	r := runner.New(t)
+
+	installOlderVersionOfTestPackage(r)
+
+	bundle := configuration.PackageManagementBundle{
+		RebootMode: configuration.RebootIfNeeded,
+		Packages:   []configuration.Package{{Name: "qbee-test", Version: "2.1.1"}},
+	}
+
+	// reboot is not scheduled when the system doesn't require it
+	reports := executePackageManagementBundle(r, bundle)
+	expectedReports := []string{
+		"[INFO] Package 'qbee-test' successfully installed.",
+	}
+	assert.Equal(t, reports, expectedReports)
+
+	// reboot is scheduled when the system signals it's required
+	installOlderVersionOfTestPackage(r)
+	r.MustExec("touch", "/var/run/reboot-required")
+	r.MustExec("sh", "-c", "echo linux-image-amd64 > /var/run/reboot-required.pkgs")
+
+	reports = executePackageManagementBundle(r, bundle)
+	expectedReports = []string{
+		"[INFO] Package 'qbee-test' successfully installed.",
+		"[INFO] Reboot required after package maintenance.",
+		"[WARN] Scheduling system reboot.",
+	}
+	assert.Equal(t, reports, expectedReports)
+}
+
+func Test_PackageManagement_Modules_Unsupported(t *testing.T) {
+	r := runner.New(t)
+
+	bundle := configuration.PackageManagementBundle{
+		Modules:  []software.Module{{Name: "nodejs", Stream: "18"}},
+		Packages: []configuration.Package{{Name: "qbee-test"}},
+	}
+
+	reports := executePackageManagementBundle(r, bundle)
+	expectedReports := []string{
+		"[ERR] Module streams are not supported by the package manager (deb).",
+	}
+	assert.Equal(t, reports, expectedReports)
+}
+
+func Test_PackageManagement_InstallPackages_Transaction(t *testing.T) {
+	runners := []*runner.Runner{
+		runner.New(t),
+		runner.NewRHELRunner(t),
+	}
+
+	wg := sync.WaitGroup{}
+
+	for _, r := range runners {
+		wg.Add(1)
+		go func(r *runner.Runner) {
+			defer wg.Done()
+
+			// set with a missing package fails as a whole, so no package is installed
+			reports := executePackageManagementBundle(r, configuration.PackageManagementBundle{
+				Packages: []configuration.Package{{Name: "qbee-test"}, {Name: "qbee-test-missing"}},
+			})
+
+			expectedReports := []string{"[ERR] Unable to install packages: qbee-test, qbee-test-missing"}
+			assert.Equal(t, reports, expectedReports)
+			assert.Equal(t, checkInstalledVersionOfTestPackage(r), "")
+		}(r)
+	}
+	wg.Wait()
+}
+
+func Test_PackageManagement_RemovePackage(t *testing.T) {
+	runners := []*runner.Runner{
+		runner.New(t),
+		runner.NewRHELRunner(t),
+		runner.NewOpenWRTRunner(t),
+	}
+
+	wg := sync.WaitGroup{}
+
+	for _, r := range runners {
+		wg.Add(1)
+		go func(r *runner.Runner) {
+			defer wg.Done()
+
+			installNewestVersionOfTestPackage(r)
+
+			bundle := configuration.PackageManagementBundle{
+				Absent: []configuration.Package{{Name: "qbee-test"}},
+				Purge:  true,
+			}
+
+			reports := executePackageManagementBundle(r, bundle)
+			expectedReports := []string{"[INFO] Package 'qbee-test' successfully removed."}
+			assert.Equal(t, reports, expectedReports)
+
+			assert.Equal(t, checkInstalledVersionOfTestPackage(r), "")
+
+			// package is no longer installed, so nothing should be done
+			reports = executePackageManagementBundle(r, bundle)
+			assert.Empty(t, reports)
+		}(r)
+	}
+	wg.Wait()
+}
+
 func Test_PackageManagement_UpgradeAll(t *testing.T) {
 	runners := []*runner.Runner{
 		runner.New(t),
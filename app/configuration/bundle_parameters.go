@@ -37,9 +37,28 @@ const ctxParameterStore = contextKey("configuration:parameter-store")
 
 // ParametersBundle defines global system parameters.
 //
+// Parameter and secret values may reference device-local sources, which are read when building the context:
+//   - $(env:NAME) - value of the NAME environment variable,
+//   - $(file:/path/to/file) - contents of a local file (without trailing newline).
+//
+// Parameters may be provided in layers (e.g. group defaults followed by device-specific values),
+// which are merged in order, so later layers override earlier ones. Parameters and secrets of the bundle itself
+// are merged last. Secrets from all layers are redacted, including secrets overridden by later layers.
+//
 // Example payload:
 //
 //		{
+//		 "layers": [
+//		   {
+//		     "name": "group-defaults",
+//		     "parameters": [
+//		       {
+//		         "key": "placeholder",
+//		         "value": "default"
+//		       }
+//		     ]
+//		   }
+//		 ],
 //		 "parameters": [
 //		   {
 //		     "key": "placeholder",
@@ -56,10 +75,30 @@ const ctxParameterStore = contextKey("configuration:parameter-store")
 type ParametersBundle struct {
 	Metadata
 
+	// Layers define parameter sets merged before Parameters and Secrets, with later layers taking precedence.
+	Layers []ParameterLayer `json:"layers,omitempty"`
+
 	Parameters []Parameter `json:"parameters"`
 	Secrets    []Parameter `json:"secrets"`
 }
 
+// ParameterLayer defines a set of parameters and secrets merged into the ParametersBundle.
+type ParameterLayer struct {
+	// Name identifies the source of the layer (e.g. group name).
+	Name string `json:"name,omitempty"`
+
+	Parameters []Parameter `json:"parameters"`
+	Secrets    []Parameter `json:"secrets"`
+}
+
+// layers returns all parameter layers ordered by precedence (lowest first), including the bundle's own parameters.
+func (parameters *ParametersBundle) layers() []ParameterLayer {
+	return append(append([]ParameterLayer{}, parameters.Layers...), ParameterLayer{
+		Parameters: parameters.Parameters,
+		Secrets:    parameters.Secrets,
+	})
+}
+
 // URLSigner is an interface for signing URLs.
 type URLSigner interface {
 	SignURL(url string) (string, error)
@@ -68,6 +107,7 @@ type URLSigner interface {
 // ParameterStore defines a key->value map of parameters, as well as URL signer.
 type ParameterStore struct {
 	values    map[string]string
+	errors    map[string]error
 	urlSigner URLSigner
 }
 
@@ -75,6 +115,9 @@ const (
 	parameterKeyOpen       = "$("
 	parameterKeyClose      = ')'
 	parameterKeyFilePrefix = "file://"
+
+	parameterSourceEnvPrefix  = "env:"
+	parameterSourceFilePrefix = "file:"
 )
 
 var systemParameters = map[string]func() (string, error){
@@ -142,6 +185,19 @@ var systemParameters = map[string]func() (string, error){
 	},
 }
 
+// set adds parameter to the store, reading its value from device-local sources if referenced.
+func (store *ParameterStore) set(parameter Parameter) {
+	value, err := resolveParameterSources(parameter.Value)
+	if err != nil {
+		store.errors[parameter.Key] = err
+		delete(store.values, parameter.Key)
+		return
+	}
+
+	store.values[parameter.Key] = value
+	delete(store.errors, parameter.Key)
+}
+
 // resolveParameter given context with parameter store attached, returns resolved parameter value.
 func resolveParameters(ctx context.Context, value string) string {
 	parameterStore, ok := ctx.Value(ctxParameterStore).(*ParameterStore)
@@ -193,6 +249,13 @@ func resolveParameters(ctx context.Context, value string) string {
 			}
 		}
 
+		// Report parameters with values which couldn't be read from their device-local source.
+		if err, failed := parameterStore.errors[key]; failed {
+			ReportError(ctx, err, "cannot resolve parameter %s", key)
+			result.WriteString(value[start : i+1])
+			continue
+		}
+
 		// Lookup in the parameter store and use if found.
 		if val, exists := parameterStore.values[key]; exists {
 			result.WriteString(val)
@@ -224,26 +287,106 @@ func (parameters *ParametersBundle) Context(ctx context.Context, urlSigner URLSi
 	parametersStore := &ParameterStore{
 		urlSigner: urlSigner,
 		values:    make(map[string]string),
+		errors:    make(map[string]error),
 	}
 
-	for _, parameter := range parameters.Parameters {
-		parametersStore.values[parameter.Key] = parameter.Value
-	}
+	// within a layer, secrets take precedence over parameters with the same key
+	for _, layer := range parameters.layers() {
+		for _, parameter := range layer.Parameters {
+			parametersStore.set(parameter)
+		}
 
-	for _, secret := range parameters.Secrets {
-		parametersStore.values[secret.Key] = secret.Value
+		for _, secret := range layer.Secrets {
+			parametersStore.set(secret)
+		}
 	}
 
 	return context.WithValue(ctx, ctxParameterStore, parametersStore)
 }
 
-// SecretsList returns a list of all secrets.
+// SecretsList returns a list of all secrets from all layers.
 func (parameters *ParametersBundle) SecretsList() []string {
 	var secrets []string
 
-	for _, secret := range parameters.Secrets {
-		secrets = append(secrets, secret.Value)
+	for _, layer := range parameters.layers() {
+		for _, secret := range layer.Secrets {
+			secrets = append(secrets, secret.Value)
+
+			// make sure that values read from device-local sources are redacted as well
+			if value, err := resolveParameterSources(secret.Value); err == nil && value != secret.Value {
+				secrets = append(secrets, value)
+			}
+		}
 	}
 
 	return secrets
 }
+
+// resolveParameterSources returns value with all $(env:NAME) and $(file:/path) references replaced
+// with values read from the device. Other references are left as is.
+func resolveParameterSources(value string) (string, error) {
+	var result strings.Builder
+
+	for {
+		start := strings.Index(value, parameterKeyOpen)
+		if start < 0 {
+			break
+		}
+
+		end := strings.IndexByte(value[start:], parameterKeyClose)
+		if end < 0 {
+			break
+		}
+		end += start
+
+		key := value[start+len(parameterKeyOpen) : end]
+
+		sourceValue, isSource, err := readParameterSource(key)
+		if err != nil {
+			return "", err
+		}
+
+		result.WriteString(value[:start])
+		if isSource {
+			result.WriteString(sourceValue)
+		} else {
+			result.WriteString(value[start : end+1])
+		}
+
+		value = value[end+1:]
+	}
+
+	result.WriteString(value)
+
+	return result.String(), nil
+}
+
+// readParameterSource returns value of a device-local parameter source.
+// If key doesn't refer to a device-local source, isSource is false.
+func readParameterSource(key string) (value string, isSource bool, err error) {
+	switch {
+	case strings.HasPrefix(key, parameterSourceEnvPrefix):
+		name := strings.TrimPrefix(key, parameterSourceEnvPrefix)
+
+		envValue, ok := os.LookupEnv(name)
+		if !ok {
+			return "", true, fmt.Errorf("environment variable %s is not set", name)
+		}
+
+		return envValue, true, nil
+
+	// file:// prefix refers to files in the file manager, which are resolved to signed URLs
+	case strings.HasPrefix(key, parameterSourceFilePrefix) && !strings.HasPrefix(key, parameterKeyFilePrefix):
+		filePath := strings.TrimPrefix(key, parameterSourceFilePrefix)
+
+		data, err := os.ReadFile(filePath)
+		if err != nil {
+			return "", true, fmt.Errorf("cannot read parameter value from file: %w", err)
+		}
+
+		return strings.TrimRight(string(data), "\r\n"), true, nil
+
+	default:
+		return "", false, nil
+	}
+}
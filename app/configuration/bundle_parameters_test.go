@@ -20,6 +20,7 @@ import (
 	"context"
 	"net/url"
 	"os"
+	"path/filepath"
 	"testing"
 
 	"go.qbee.io/agent/app/inventory"
@@ -59,6 +60,11 @@ func Test_resolveParameters(t *testing.T) {
 
 	invSystem := systemInventory.System
 
+	t.Setenv("QBEE_TEST_PARAMETER", "env-value")
+
+	sourceFile := filepath.Join(t.TempDir(), "machine-id")
+	assert.NoError(t, os.WriteFile(sourceFile, []byte("file-value\n"), 0600))
+
 	tests := []struct {
 		name       string
 		parameters []Parameter
@@ -153,6 +159,38 @@ func Test_resolveParameters(t *testing.T) {
 			value:      "example $(file://test.cfg)",
 			want:       "example https://example.com/v1/org/device/public/files/test.cfg?signed=true",
 		},
+		{
+			name: "parameter from environment",
+			parameters: []Parameter{
+				{Key: "key", Value: "prefix-$(env:QBEE_TEST_PARAMETER)"},
+			},
+			value: "example $(key)",
+			want:  "example prefix-env-value",
+		},
+		{
+			name: "secret from file",
+			secrets: []Parameter{
+				{Key: "secret", Value: "$(file:" + sourceFile + ")"},
+			},
+			value: "example $(secret)",
+			want:  "example file-value",
+		},
+		{
+			name: "parameter from missing environment variable",
+			parameters: []Parameter{
+				{Key: "key", Value: "$(env:QBEE_TEST_PARAMETER_MISSING)"},
+			},
+			value: "example $(key)",
+			want:  "example $(key)",
+		},
+		{
+			name: "parameter from missing file",
+			parameters: []Parameter{
+				{Key: "key", Value: "$(file:/non-existing/file)"},
+			},
+			value: "example $(key)",
+			want:  "example $(key)",
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -170,6 +208,71 @@ func Test_resolveParameters(t *testing.T) {
 	}
 }
 
+func TestParametersBundle_SecretsList(t *testing.T) {
+	sourceFile := filepath.Join(t.TempDir(), "secret")
+	assert.NoError(t, os.WriteFile(sourceFile, []byte("file-secret\n"), 0600))
+
+	parametersBundle := ParametersBundle{
+		Secrets: []Parameter{
+			{Key: "plain", Value: "plain-secret"},
+			{Key: "file", Value: "$(file:" + sourceFile + ")"},
+		},
+	}
+
+	want := []string{"plain-secret", "$(file:" + sourceFile + ")", "file-secret"}
+
+	assert.Equal(t, parametersBundle.SecretsList(), want)
+}
+
+func TestParametersBundle_Layers(t *testing.T) {
+	parametersBundle := ParametersBundle{
+		Layers: []ParameterLayer{
+			{
+				Name: "fleet",
+				Parameters: []Parameter{
+					{Key: "server", Value: "fleet.example.com"},
+					{Key: "port", Value: "8080"},
+					{Key: "mode", Value: "fleet"},
+				},
+				Secrets: []Parameter{
+					{Key: "token", Value: "fleet-token"},
+				},
+			},
+			{
+				Name: "group",
+				Parameters: []Parameter{
+					{Key: "server", Value: "group.example.com"},
+					{Key: "token", Value: "group-token"},
+				},
+				Secrets: []Parameter{
+					{Key: "password", Value: "group-password"},
+				},
+			},
+		},
+		Parameters: []Parameter{
+			{Key: "port", Value: "9090"},
+		},
+		Secrets: []Parameter{
+			{Key: "password", Value: "device-password"},
+		},
+	}
+
+	ctx := parametersBundle.Context(context.Background(), new(mockURLSigner))
+
+	got := resolveParameters(ctx, "$(server):$(port) $(mode) $(token) $(password)")
+	assert.Equal(t, got, "group.example.com:9090 fleet group-token device-password")
+
+	// secrets from all layers are redacted, even when overridden by a later layer
+	want := []string{"fleet-token", "group-password", "device-password"}
+	assert.Equal(t, parametersBundle.SecretsList(), want)
+
+	reporter := NewReporter("", false, parametersBundle.SecretsList())
+	reportCtx := reporter.BundleContext(ctx, BundleParameters, "")
+
+	ReportInfo(reportCtx, nil, "fleet-token group-password device-password")
+	assert.Equal(t, reporter.Reports()[0].Text, "******** ******** ********")
+}
+
 func Test_UsersWithParameters(t *testing.T) {
 	r := runner.New(t)
 
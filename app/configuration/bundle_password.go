@@ -105,7 +105,7 @@ func (p PasswordBundle) Execute(ctx context.Context, service *Service) error {
 
 	// and report users for which we changed the password
 	for _, user := range modifiedUsers {
-		ReportInfo(ctx, nil, "Password for user %s successfully set.", user)
+		reportChange(ctx, nil, "Password for user %s successfully set.", user)
 	}
 
 	return nil
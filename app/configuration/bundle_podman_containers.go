@@ -33,9 +33,13 @@ import (
 //	     "image": "debian:stable",
 //	     "docker_args": "-v /path/to/data-volume:/data --hostname my-hostname",
 //	     "env_file": "/my-directory/my-envfile",
-//	     "command": "echo 'hello world!'"
+//	     "env": {"API_TOKEN": "$(api_token)"},
+//	     "command": "echo 'hello world!'",
+//	     "auto_update": true
 //		  }
 //		],
+//	 "log_tail_lines": 50,
+//	 "clean": true,
 //	 "registry_auths": [
 //	   {
 //	      "server": "gcr.io",
@@ -52,6 +56,13 @@ type PodmanContainerBundle struct {
 
 	// RegistryAuths is a list of registry authentication credentials.
 	RegistryAuths []RegistryAuth `json:"registry_auths"`
+
+	// LogTailLines defines how many lines of container logs are attached to reports
+	// when a container fails to start or exits unexpectedly (default: 50).
+	LogTailLines int `json:"log_tail_lines,omitempty"`
+
+	// Clean removes containers started by the agent, which are not defined in the bundle.
+	Clean bool `json:"clean,omitempty"`
 }
 
 // Execute ensures that the specified containers are in the desired state.
@@ -75,24 +86,40 @@ func (p PodmanContainerBundle) Execute(ctx context.Context, service *Service) er
 		}
 	}
 
+	containers := make([]Container, 0, len(p.Containers))
+
 	for containerIndex, container := range p.Containers {
 		container.ContainerRuntime = podmanRuntimeType
 		container.Name = resolveParameters(ctx, container.Name)
 		container.Image = resolveParameters(ctx, container.Image)
 		container.Args = resolveParameters(ctx, container.Args)
 		container.EnvFile = resolveParameters(ctx, container.EnvFile)
+		container.Env = resolveContainerEnv(ctx, container.Env)
 		container.Command = resolveParameters(ctx, container.Command)
 		container.PreCondition = resolveParameters(ctx, container.PreCondition)
+		container.LogTailLines = p.LogTailLines
 
 		// for containers with empty name, use its index
 		if container.Name == "" {
 			container.Name = fmt.Sprintf("%d", containerIndex)
 		}
 
+		containers = append(containers, container)
+	}
+
+	if err = checkContainerNames(ctx, podmanRuntimeType, podmanBin, containers); err != nil {
+		return err
+	}
+
+	for _, container := range containers {
 		if err = container.execute(ctx, service, podmanBin); err != nil {
 			return err
 		}
 	}
 
+	if p.Clean {
+		return cleanOrphanedContainers(ctx, podmanRuntimeType, podmanBin, containers)
+	}
+
 	return nil
 }
@@ -62,6 +62,36 @@ func Test_PodmanContainers_Container_Start(t *testing.T) {
 	assert.Empty(t, reports)
 }
 
+func Test_PodmanContainers_Container_AutoUpdate(t *testing.T) {
+	r := runner.NewPodmanRunner(t)
+
+	r.MustExec("apt-get", "install", "-y", "podman")
+
+	containerName := fmt.Sprintf("%s-%d", t.Name(), time.Now().Unix())
+
+	podmanBundle := configuration.PodmanContainerBundle{
+		Containers: []configuration.Container{
+			{
+				Name:       containerName,
+				Image:      "alpine:latest",
+				Command:    "sleep 60",
+				AutoUpdate: true,
+			},
+		},
+	}
+
+	reports := executePodmanContainersBundle(r, podmanBundle)
+	expectedReports := []string{
+		"[INFO] Successfully started container for image alpine:latest.",
+	}
+
+	assert.Equal(t, reports, expectedReports)
+
+	// container started from the current digest of the tag is not restarted
+	reports = executePodmanContainersBundle(r, podmanBundle)
+	assert.Empty(t, reports)
+}
+
 func Test_PodmanContainers_Container_Change(t *testing.T) {
 	r := runner.NewPodmanRunner(t)
 
@@ -148,6 +178,37 @@ func Test_PodmanContainers_Container_StartExited(t *testing.T) {
 	assert.Equal(t, string(output), podmanBundle.Containers[0].Command)
 }
 
+func Test_PodmanContainers_Container_Clean(t *testing.T) {
+	r := runner.NewPodmanRunner(t)
+
+	r.MustExec("apt-get", "install", "-y", "podman")
+
+	// container not started by the agent must never be removed
+	r.MustExec("podman", "run", "--detach", "--name", "unmanaged", "alpine:latest", "sleep", "60")
+
+	podmanBundle := configuration.PodmanContainerBundle{
+		Containers: []configuration.Container{
+			{Name: "keep", Image: "alpine:latest", Command: "sleep 60"},
+			{Name: "orphan", Image: "alpine:latest", Command: "sleep 60"},
+		},
+	}
+
+	reports := executePodmanContainersBundle(r, podmanBundle)
+	assert.Length(t, reports, 2)
+
+	podmanBundle.Containers = podmanBundle.Containers[:1]
+	podmanBundle.Clean = true
+
+	reports = executePodmanContainersBundle(r, podmanBundle)
+	expectedReports := []string{
+		"[INFO] Removed orphaned container orphan.",
+	}
+	assert.Equal(t, reports, expectedReports)
+
+	output := r.MustExec("podman", "container", "ls", "--all", "--sort", "names", "--format", "{{.Names}}")
+	assert.Equal(t, string(output), "keep\nunmanaged")
+}
+
 // executePodmanContainersBundle is a helper method to quickly execute podman containers bundle.
 // On success, it returns a slice of produced reports.
 func executePodmanContainersBundle(r *runner.Runner, bundle configuration.PodmanContainerBundle) []string {
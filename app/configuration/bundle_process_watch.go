@@ -124,7 +124,7 @@ func (w ProcessWatcher) execute(ctx context.Context, runningProcesses map[string
 		return err
 	}
 
-	ReportInfo(ctx, output, "Successfully ran command for process %s", w.Name)
+	reportChange(ctx, output, "Successfully ran command for process %s", w.Name)
 
 	return nil
 }
@@ -127,6 +127,11 @@ func (r RaucBundle) Execute(ctx context.Context, service *Service) error {
 		return nil
 	}
 
+	// installation is followed by a reboot, so it's deferred until the maintenance window
+	if !service.disruptiveActionAllowed(ctx, "RAUC bundle installation") {
+		return nil
+	}
+
 	raucInstallCmd := []string{"rauc", "install", raucPath}
 	output, err := utils.RunCommand(ctx, raucInstallCmd)
 
@@ -139,7 +144,7 @@ func (r RaucBundle) Execute(ctx context.Context, service *Service) error {
 		return err
 	}
 
-	ReportInfo(
+	reportChange(
 		ctx,
 		strings.ReplaceAll(string(output), raucPath, r.RaucBundle),
 		"RAUC bundle successfully installed '%s'",
@@ -279,7 +284,7 @@ func downloadRaucBundle(ctx context.Context, service *Service, raucPath, raucDow
 			return "", err
 		}
 
-		if stateData.SHA256() != bundleMetadata.SHA256() {
+		if stateData.Digest() != bundleMetadata.Digest() {
 			doDownload = true
 		}
 	}
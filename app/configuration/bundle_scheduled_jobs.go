@@ -0,0 +1,510 @@
+// Copyright 2023 qbee.io
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package configuration
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+
+	"go.qbee.io/agent/app/log"
+	"go.qbee.io/agent/app/utils"
+)
+
+// ScheduledJobsBundle manages scheduled jobs rendered as cron.d entries or systemd timer units.
+//
+// Example payload:
+//
+//	{
+//	 "backend": "cron",
+//	 "items": [
+//	   {
+//	     "name": "cleanup",
+//	     "schedule": "*/15 * * * *",
+//	     "command": "/usr/local/bin/cleanup --quiet",
+//	     "user": "app"
+//	   }
+//	 ],
+//	 "clean": true
+//	}
+type ScheduledJobsBundle struct {
+	Metadata
+
+	// Backend defines how jobs are scheduled: "cron" (default) or "systemd".
+	Backend ScheduledJobsBackend `json:"backend,omitempty"`
+
+	// Jobs defines a list of scheduled jobs.
+	Jobs []ScheduledJob `json:"items"`
+
+	// Clean removes all jobs created by the agent, which are not defined in the bundle.
+	Clean bool `json:"clean,omitempty"`
+}
+
+// ScheduledJobsBackend defines how scheduled jobs are executed.
+type ScheduledJobsBackend string
+
+// Supported scheduled jobs backends.
+const (
+	// ScheduledJobsCron renders jobs as /etc/cron.d entries.
+	ScheduledJobsCron ScheduledJobsBackend = "cron"
+
+	// ScheduledJobsSystemd renders jobs as systemd timer and service units.
+	ScheduledJobsSystemd ScheduledJobsBackend = "systemd"
+)
+
+// ScheduledJob defines a command executed on schedule.
+type ScheduledJob struct {
+	// Name identifies the job and is used to name the cron.d file or systemd units.
+	Name string `json:"name"`
+
+	// Schedule in cron syntax (e.g. "*/15 * * * *") or a macro (e.g. "@daily").
+	Schedule string `json:"schedule"`
+
+	// Command to execute (using /bin/sh).
+	Command string `json:"command"`
+
+	// User to execute the command as (default: root).
+	User string `json:"user,omitempty"`
+}
+
+const (
+	scheduledJobPrefix       = "qbee-"
+	scheduledJobSystemdUnit  = "qbee-job-"
+	scheduledJobFileMode     = 0644
+	scheduledJobDefaultUser  = "root"
+	scheduledJobHeader       = "# Managed by qbee-agent - do not edit\n"
+	scheduledJobTimerSuffix  = ".timer"
+	scheduledJobUnitSuffix   = ".service"
+	scheduledJobsDescription = "qbee scheduled job %s"
+)
+
+// scheduledJobsCronDirectory and scheduledJobsSystemdDirectory are variables, so they can be overridden in tests.
+var (
+	scheduledJobsCronDirectory    = "/etc/cron.d"
+	scheduledJobsSystemdDirectory = systemdUnitDirectory
+)
+
+// cron.d ignores files with names containing other characters (e.g. dots).
+var scheduledJobNameRE = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+var scheduledJobUserRE = regexp.MustCompile(`^[a-z_][a-z0-9_-]*\$?$`)
+
+// validate returns an error if the job definition is not valid.
+func (job ScheduledJob) validate() error {
+	if !scheduledJobNameRE.MatchString(job.Name) {
+		return fmt.Errorf("invalid job name: %q", job.Name)
+	}
+
+	if !scheduledJobUserRE.MatchString(job.User) {
+		return fmt.Errorf("invalid user for job %s: %q", job.Name, job.User)
+	}
+
+	if strings.TrimSpace(job.Command) == "" || strings.ContainsAny(job.Command, "\r\n") {
+		return fmt.Errorf("invalid command for job %s: must be a single non-empty line", job.Name)
+	}
+
+	if _, err := parseCronSchedule(job.Schedule); err != nil {
+		return fmt.Errorf("invalid schedule for job %s: %w", job.Name, err)
+	}
+
+	return nil
+}
+
+// scheduledJobFile defines a file rendered for a scheduled job.
+type scheduledJobFile struct {
+	path     string
+	contents []byte
+}
+
+// files returns files which need to be created for the job using the provided backend.
+func (job ScheduledJob) files(backend ScheduledJobsBackend) ([]scheduledJobFile, error) {
+	if backend == ScheduledJobsCron {
+		fields, err := parseCronSchedule(job.Schedule)
+		if err != nil {
+			return nil, err
+		}
+
+		// % is a newline in cron commands, unless escaped
+		command := strings.ReplaceAll(job.Command, "%", `\%`)
+
+		contents := fmt.Sprintf("%sSHELL=/bin/sh\n%s %s %s\n", scheduledJobHeader, strings.Join(fields, " "), job.User, command)
+
+		return []scheduledJobFile{{path: job.cronPath(), contents: []byte(contents)}}, nil
+	}
+
+	calendar, err := cronToCalendar(job.Schedule)
+	if err != nil {
+		return nil, err
+	}
+
+	description := fmt.Sprintf(scheduledJobsDescription, job.Name)
+
+	service := fmt.Sprintf("%s[Unit]\nDescription=%s\n\n[Service]\nType=oneshot\nUser=%s\nExecStart=/bin/sh -c %s\n",
+		scheduledJobHeader, description, job.User, systemdQuote(job.Command))
+
+	timer := fmt.Sprintf("%s[Unit]\nDescription=%s\n\n[Timer]\nOnCalendar=%s\n\n[Install]\nWantedBy=timers.target\n",
+		scheduledJobHeader, description, calendar)
+
+	unitPath := filepath.Join(scheduledJobsSystemdDirectory, job.systemdUnit())
+
+	return []scheduledJobFile{
+		{path: unitPath + scheduledJobUnitSuffix, contents: []byte(service)},
+		{path: unitPath + scheduledJobTimerSuffix, contents: []byte(timer)},
+	}, nil
+}
+
+// cronPath returns path of the cron.d file for the job.
+func (job ScheduledJob) cronPath() string {
+	return filepath.Join(scheduledJobsCronDirectory, scheduledJobPrefix+job.Name)
+}
+
+// systemdUnit returns name of the systemd units (without suffix) for the job.
+func (job ScheduledJob) systemdUnit() string {
+	return scheduledJobSystemdUnit + job.Name
+}
+
+// systemdQuote quotes the argument for use in systemd unit Exec lines,
+// escaping quotes and backslashes, as well as specifiers (%) and environment variable references ($).
+func systemdQuote(arg string) string {
+	replacer := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "%", "%%", "$", "$$")
+
+	return `"` + replacer.Replace(arg) + `"`
+}
+
+// Execute scheduled jobs configuration bundle on the system.
+func (s ScheduledJobsBundle) Execute(ctx context.Context, service *Service) error {
+	backend := s.Backend
+	if backend == "" {
+		backend = ScheduledJobsCron
+	}
+
+	if backend != ScheduledJobsCron && backend != ScheduledJobsSystemd {
+		err := fmt.Errorf("unsupported scheduled jobs backend: %s", backend)
+		ReportError(ctx, err, "Invalid scheduled jobs configuration.")
+		return err
+	}
+
+	systemdAvailable := true
+	if _, err := exec.LookPath("systemctl"); err != nil {
+		systemdAvailable = false
+	}
+
+	if backend == ScheduledJobsSystemd && !systemdAvailable {
+		ReportError(ctx, nil, "Scheduled jobs configured with systemd backend, but systemd is not available.")
+		return fmt.Errorf("systemd is not available")
+	}
+
+	configuredJobs := make(map[string]bool)
+	configuredFiles := make(map[string]bool)
+	configuredTimers := make(map[string]bool)
+	added := make([]string, 0)
+	updated := make([]string, 0)
+	changedTimers := make([]string, 0)
+
+	for _, job := range s.Jobs {
+		job.Name = resolveParameters(ctx, job.Name)
+		job.Schedule = resolveParameters(ctx, job.Schedule)
+		job.Command = resolveParameters(ctx, job.Command)
+		job.User = resolveParameters(ctx, job.User)
+
+		if job.User == "" {
+			job.User = scheduledJobDefaultUser
+		}
+
+		if err := job.validate(); err != nil {
+			ReportError(ctx, err, "Invalid scheduled job.")
+			return err
+		}
+
+		if configuredJobs[job.Name] {
+			err := fmt.Errorf("duplicate job name: %s", job.Name)
+			ReportError(ctx, err, "Invalid scheduled job.")
+			return err
+		}
+		configuredJobs[job.Name] = true
+
+		files, err := job.files(backend)
+		if err != nil {
+			ReportError(ctx, err, "Unable to configure scheduled job %s.", job.Name)
+			return err
+		}
+
+		jobAdded, jobChanged := false, false
+
+		for _, file := range files {
+			configuredFiles[file.path] = true
+
+			var created, changed bool
+			if created, changed, err = writeScheduledJobFile(file); err != nil {
+				ReportError(ctx, err, "Unable to configure scheduled job %s.", job.Name)
+				return err
+			}
+
+			jobAdded = jobAdded || created
+			jobChanged = jobChanged || changed
+		}
+
+		switch {
+		case jobAdded:
+			added = append(added, job.Name)
+		case jobChanged:
+			updated = append(updated, job.Name)
+		}
+
+		if backend == ScheduledJobsSystemd {
+			timer := job.systemdUnit() + scheduledJobTimerSuffix
+			configuredTimers[timer] = true
+
+			if jobAdded || jobChanged {
+				changedTimers = append(changedTimers, timer)
+			}
+		}
+	}
+
+	removed, removedUnits, err := s.clean(ctx, configuredFiles, systemdAvailable)
+	if err != nil {
+		ReportError(ctx, err, "Unable to remove scheduled jobs.")
+		return err
+	}
+
+	// unit files don't change again after a failed reload, so timers of a failed reload are kept pending
+	pendingTimers, reloadPending := service.loadPendingScheduledJobTimers()
+	for _, timer := range pendingTimers {
+		if configuredTimers[timer] && !slices.Contains(changedTimers, timer) {
+			changedTimers = append(changedTimers, timer)
+		}
+	}
+
+	// cron daemons detect changes in /etc/cron.d automatically, so only systemd needs to be reloaded
+	if len(changedTimers) > 0 || removedUnits || reloadPending {
+		if err = service.savePendingScheduledJobTimers(changedTimers); err != nil {
+			ReportError(ctx, err, "Unable to record pending scheduled jobs timers reload.")
+			return err
+		}
+
+		if err = reloadScheduledJobTimers(ctx, changedTimers); err != nil {
+			ReportError(ctx, err, "Unable to reload scheduled jobs timers.")
+			return err
+		}
+
+		if err = service.clearPendingScheduledJobTimers(); err != nil {
+			log.Errorf("failed to clear pending scheduled jobs timers reload: %v", err)
+		}
+	}
+
+	if len(added) > 0 {
+		reportChange(ctx, nil, "Scheduled jobs added: %s.", strings.Join(added, ", "))
+	}
+
+	if len(updated) > 0 {
+		reportChange(ctx, nil, "Scheduled jobs updated: %s.", strings.Join(updated, ", "))
+	}
+
+	if len(removed) > 0 {
+		reportChange(ctx, nil, "Scheduled jobs removed: %s.", strings.Join(removed, ", "))
+	}
+
+	return nil
+}
+
+// writeScheduledJobFile writes the file if its contents differ from the expected ones.
+// Returns whether the file was created and whether an existing file was changed.
+func writeScheduledJobFile(file scheduledJobFile) (bool, bool, error) {
+	currentContents, err := os.ReadFile(file.path)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return false, false, fmt.Errorf("error reading %s: %w", file.path, err)
+	}
+
+	exists := err == nil
+	if exists && bytes.Equal(currentContents, file.contents) {
+		return false, false, nil
+	}
+
+	err = writeFileAtomically(file.path, scheduledJobFileMode, nil, func(w io.Writer) error {
+		_, writeErr := w.Write(file.contents)
+		return writeErr
+	})
+	if err != nil {
+		return false, false, err
+	}
+
+	return !exists, exists, nil
+}
+
+// clean removes jobs created by the agent (using any backend), which are not configured in the bundle.
+// Returns names of removed jobs and whether any systemd units were removed.
+func (s ScheduledJobsBundle) clean(
+	ctx context.Context,
+	configuredFiles map[string]bool,
+	systemdAvailable bool,
+) ([]string, bool, error) {
+	removed := make([]string, 0)
+	if !s.Clean {
+		return removed, false, nil
+	}
+
+	cronFiles, err := filepath.Glob(filepath.Join(scheduledJobsCronDirectory, scheduledJobPrefix+"*"))
+	if err != nil {
+		return nil, false, err
+	}
+
+	for _, path := range cronFiles {
+		if configuredFiles[path] || !isScheduledJobFile(path) {
+			continue
+		}
+
+		if err = os.Remove(path); err != nil {
+			return removed, false, fmt.Errorf("error removing %s: %w", path, err)
+		}
+
+		removed = append(removed, strings.TrimPrefix(filepath.Base(path), scheduledJobPrefix))
+	}
+
+	timerFiles, err := filepath.Glob(filepath.Join(scheduledJobsSystemdDirectory, scheduledJobSystemdUnit+"*"+scheduledJobTimerSuffix))
+	if err != nil {
+		return nil, false, err
+	}
+
+	removedUnits := false
+
+	for _, timerPath := range timerFiles {
+		if configuredFiles[timerPath] || !isScheduledJobFile(timerPath) {
+			continue
+		}
+
+		timer := filepath.Base(timerPath)
+
+		if systemdAvailable {
+			if _, err = utils.RunCommand(ctx, []string{"systemctl", "disable", "--now", timer}); err != nil {
+				return removed, removedUnits, fmt.Errorf("error disabling %s: %w", timer, err)
+			}
+		}
+
+		servicePath := strings.TrimSuffix(timerPath, scheduledJobTimerSuffix) + scheduledJobUnitSuffix
+
+		for _, path := range []string{timerPath, servicePath} {
+			if err = os.Remove(path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+				return removed, removedUnits, fmt.Errorf("error removing %s: %w", path, err)
+			}
+		}
+
+		removedUnits = true
+		removed = append(removed, strings.TrimSuffix(strings.TrimPrefix(timer, scheduledJobSystemdUnit), scheduledJobTimerSuffix))
+	}
+
+	sort.Strings(removed)
+
+	return removed, removedUnits && systemdAvailable, nil
+}
+
+// isScheduledJobFile returns true if the file was created by the agent.
+func isScheduledJobFile(path string) bool {
+	file, err := os.Open(path)
+	if err != nil {
+		return false
+	}
+	defer file.Close()
+
+	header := make([]byte, len(scheduledJobHeader))
+	if _, err = io.ReadFull(file, header); err != nil {
+		return false
+	}
+
+	return string(header) == scheduledJobHeader
+}
+
+const (
+	// scheduledJobsReloadPendingFileName contains timers which were not reloaded due to a failure.
+	scheduledJobsReloadPendingFileName = "scheduled_jobs_reload_pending.json"
+	scheduledJobsReloadPendingFileMode = 0600
+)
+
+// loadPendingScheduledJobTimers returns timers to be (re)started by a reload which failed during a previous run.
+// Returns false, when no reload is pending.
+func (srv *Service) loadPendingScheduledJobTimers() ([]string, bool) {
+	data, err := os.ReadFile(filepath.Join(srv.appDirectory, scheduledJobsReloadPendingFileName))
+	if err != nil {
+		if !errors.Is(err, fs.ErrNotExist) {
+			log.Errorf("failed to read pending scheduled jobs timers: %v", err)
+		}
+		return nil, false
+	}
+
+	var timers []string
+	if err = json.Unmarshal(data, &timers); err != nil {
+		log.Errorf("failed to parse pending scheduled jobs timers: %v", err)
+	}
+
+	// reload is still pending, even if the list of timers is corrupted
+	return timers, true
+}
+
+// savePendingScheduledJobTimers records that systemd must be reloaded and provided timers (re)started.
+func (srv *Service) savePendingScheduledJobTimers(timers []string) error {
+	data, err := json.Marshal(timers)
+	if err != nil {
+		return fmt.Errorf("error encoding pending timers: %w", err)
+	}
+
+	pendingFilePath := filepath.Join(srv.appDirectory, scheduledJobsReloadPendingFileName)
+
+	if err = utils.WriteFileSync(pendingFilePath, data, scheduledJobsReloadPendingFileMode); err != nil {
+		return fmt.Errorf("error writing pending timers: %w", err)
+	}
+
+	return nil
+}
+
+// clearPendingScheduledJobTimers removes record of the pending reload.
+func (srv *Service) clearPendingScheduledJobTimers() error {
+	pendingFilePath := filepath.Join(srv.appDirectory, scheduledJobsReloadPendingFileName)
+
+	if err := os.Remove(pendingFilePath); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+
+	return nil
+}
+
+// reloadScheduledJobTimers reloads systemd configuration and (re)starts changed timers.
+func reloadScheduledJobTimers(ctx context.Context, timers []string) error {
+	if _, err := utils.RunCommand(ctx, []string{"systemctl", "daemon-reload"}); err != nil {
+		return err
+	}
+
+	for _, timer := range timers {
+		if _, err := utils.RunCommand(ctx, []string{"systemctl", "enable", timer}); err != nil {
+			return err
+		}
+
+		if _, err := utils.RunCommand(ctx, []string{"systemctl", "restart", timer}); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,190 @@
+// Copyright 2023 qbee.io
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package configuration
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"go.qbee.io/agent/app/utils/assert"
+)
+
+// executeScheduledJobsBundle executes the bundle with cron.d and systemd directories in a temporary directory.
+func executeScheduledJobsBundle(t *testing.T, dir string, bundle ScheduledJobsBundle) ([]string, error) {
+	cronDirectory, systemdDirectory := scheduledJobsCronDirectory, scheduledJobsSystemdDirectory
+	scheduledJobsCronDirectory = filepath.Join(dir, "cron.d")
+	scheduledJobsSystemdDirectory = filepath.Join(dir, "systemd")
+	defer func() {
+		scheduledJobsCronDirectory, scheduledJobsSystemdDirectory = cronDirectory, systemdDirectory
+	}()
+
+	reporter := NewReporter("", false, nil)
+	ctx := reporter.BundleContext(context.Background(), "", "")
+	ctx = new(ParametersBundle).Context(ctx, nil)
+
+	err := bundle.Execute(ctx, New(nil, dir, dir))
+
+	reports := make([]string, 0, len(reporter.reports))
+	for _, report := range reporter.reports {
+		reports = append(reports, report.String())
+	}
+
+	return reports, err
+}
+
+func TestScheduledJobsBundle_Cron(t *testing.T) {
+	dir := t.TempDir()
+	cronDirectory := filepath.Join(dir, "cron.d")
+
+	if err := os.MkdirAll(cronDirectory, 0755); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// files not created by the agent are never removed
+	unmanagedPath := filepath.Join(cronDirectory, "qbee-custom")
+	if err := os.WriteFile(unmanagedPath, []byte("* * * * * root true\n"), 0644); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	bundle := ScheduledJobsBundle{
+		Jobs: []ScheduledJob{
+			{Name: "cleanup", Schedule: "*/15 * * * *", Command: "/usr/bin/cleanup --date=$(date +%F)", User: "app"},
+			{Name: "backup", Schedule: "@daily", Command: "/usr/bin/backup"},
+		},
+		Clean: true,
+	}
+
+	// add
+	reports, err := executeScheduledJobsBundle(t, dir, bundle)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	assert.Equal(t, reports, []string{"[INFO] Scheduled jobs added: cleanup, backup."})
+
+	data, err := os.ReadFile(filepath.Join(cronDirectory, "qbee-cleanup"))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	assert.Equal(t, string(data), scheduledJobHeader+"SHELL=/bin/sh\n*/15 * * * * app /usr/bin/cleanup --date=$(date +\\%F)\n")
+
+	data, err = os.ReadFile(filepath.Join(cronDirectory, "qbee-backup"))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	assert.Equal(t, string(data), scheduledJobHeader+"SHELL=/bin/sh\n0 0 * * * root /usr/bin/backup\n")
+
+	// no changes
+	reports, err = executeScheduledJobsBundle(t, dir, bundle)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	assert.Equal(t, reports, []string{})
+
+	// update and remove
+	bundle.Jobs = []ScheduledJob{
+		{Name: "cleanup", Schedule: "0 * * * *", Command: "/usr/bin/cleanup", User: "app"},
+	}
+
+	reports, err = executeScheduledJobsBundle(t, dir, bundle)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	assert.Equal(t, reports, []string{
+		"[INFO] Scheduled jobs updated: cleanup.",
+		"[INFO] Scheduled jobs removed: backup.",
+	})
+
+	if _, err = os.Stat(filepath.Join(cronDirectory, "qbee-backup")); !os.IsNotExist(err) {
+		t.Fatalf("expected removed job file, got %v", err)
+	}
+
+	if _, err = os.Stat(unmanagedPath); err != nil {
+		t.Fatalf("expected unmanaged file to be kept, got %v", err)
+	}
+}
+
+func TestScheduledJobsBundle_Invalid(t *testing.T) {
+	tests := []struct {
+		name string
+		job  ScheduledJob
+	}{
+		{name: "invalid name", job: ScheduledJob{Name: "backup.daily", Schedule: "@daily", Command: "true"}},
+		{name: "invalid schedule", job: ScheduledJob{Name: "backup", Schedule: "61 * * * *", Command: "true"}},
+		{name: "multi-line command", job: ScheduledJob{Name: "backup", Schedule: "@daily", Command: "true\nreboot"}},
+		{name: "invalid user", job: ScheduledJob{Name: "backup", Schedule: "@daily", Command: "true", User: "root app"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+
+			reports, err := executeScheduledJobsBundle(t, dir, ScheduledJobsBundle{Jobs: []ScheduledJob{tt.job}})
+			if err == nil {
+				t.Fatalf("expected error")
+			}
+			assert.Equal(t, reports, []string{"[ERR] Invalid scheduled job."})
+		})
+	}
+}
+
+func TestScheduledJob_files_Systemd(t *testing.T) {
+	job := ScheduledJob{Name: "report", Schedule: "30 6 * * 1-5", Command: `echo "100%" > $HOME/report`, User: "app"}
+
+	files, err := job.files(ScheduledJobsSystemd)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	unitPath := filepath.Join(scheduledJobsSystemdDirectory, "qbee-job-report")
+
+	assert.Equal(t, len(files), 2)
+	assert.Equal(t, files[0].path, unitPath+".service")
+	assert.Equal(t, string(files[0].contents), scheduledJobHeader+
+		"[Unit]\nDescription=qbee scheduled job report\n\n"+
+		"[Service]\nType=oneshot\nUser=app\nExecStart=/bin/sh -c \"echo \\\"100%%\\\" > $$HOME/report\"\n")
+	assert.Equal(t, files[1].path, unitPath+".timer")
+	assert.Equal(t, string(files[1].contents), scheduledJobHeader+
+		"[Unit]\nDescription=qbee scheduled job report\n\n"+
+		"[Timer]\nOnCalendar=Mon..Fri *-*-* 6:30:00\n\n"+
+		"[Install]\nWantedBy=timers.target\n")
+}
+
+func TestService_pendingScheduledJobTimers(t *testing.T) {
+	srv := New(nil, t.TempDir(), t.TempDir())
+
+	timers, pending := srv.loadPendingScheduledJobTimers()
+	assert.False(t, pending)
+	assert.Length(t, timers, 0)
+
+	// reload without timers (e.g. after units removal) is pending as well
+	assert.NoError(t, srv.savePendingScheduledJobTimers(nil))
+	_, pending = srv.loadPendingScheduledJobTimers()
+	assert.True(t, pending)
+
+	assert.NoError(t, srv.savePendingScheduledJobTimers([]string{"qbee-job-report.timer"}))
+
+	// pending reload is kept by a new service instance (e.g. after agent restart)
+	timers, pending = New(nil, srv.appDirectory, t.TempDir()).loadPendingScheduledJobTimers()
+	assert.True(t, pending)
+	assert.Equal(t, timers, []string{"qbee-job-report.timer"})
+
+	assert.NoError(t, srv.clearPendingScheduledJobTimers())
+	_, pending = srv.loadPendingScheduledJobTimers()
+	assert.False(t, pending)
+}
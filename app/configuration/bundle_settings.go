@@ -18,6 +18,10 @@ package configuration
 
 import (
 	"time"
+
+	"go.qbee.io/agent/app/inventory"
+	"go.qbee.io/agent/app/metrics"
+	"go.qbee.io/agent/app/software"
 )
 
 // SettingsBundle defines settings for the agent.
@@ -26,10 +30,21 @@ import (
 //
 //	"settings": {
 //	  "metrics": true,
+//	  "prometheus_exporter": true,
+//	  "prometheus_exporter_address": "127.0.0.1:9101",
 //	  "reports": true,
 //	  "remoteconsole": true,
 //	  "software_inventory": true,
+//	  "package_index_update_interval": 360,
 //	  "process_inventory": true,
+//	  "ports_inventory": true,
+//	  "container_stats_inventory": false,
+//	  "inventory_batch": true,
+//	  "inventory_batch_size": 5,
+//	  "run_summary": false,
+//	  "remote_jobs": false,
+//	  "allow_reboot": true,
+//	  "maintenance_window": {"start": "22:00", "end": "04:00", "timezone": "Europe/Oslo"},
 //	  "agentinterval": 10
 //	}
 type SettingsBundle struct {
@@ -38,6 +53,12 @@ type SettingsBundle struct {
 	// EnableMetrics collection enabled.
 	EnableMetrics bool `json:"metrics"`
 
+	// EnablePrometheusExporter exposes collected metrics on a local HTTP listener in Prometheus format.
+	EnablePrometheusExporter bool `json:"prometheus_exporter"`
+
+	// PrometheusExporterAddress defines bind address of the Prometheus exporter (defaults to 127.0.0.1:9101).
+	PrometheusExporterAddress string `json:"prometheus_exporter_address,omitempty"`
+
 	// EnableReports collection enabled.
 	EnableReports bool `json:"reports"`
 
@@ -47,9 +68,63 @@ type SettingsBundle struct {
 	// EnableSoftwareInventory collection enabled.
 	EnableSoftwareInventory bool `json:"software_inventory"`
 
+	// DisablePackageIndexUpdate prevents package managers from updating package indexes (e.g. apt-get update),
+	// so installed packages can be listed even when package repositories are unreachable.
+	DisablePackageIndexUpdate bool `json:"disable_package_index_update,omitempty"`
+
+	// PackageIndexUpdateInterval defines minimal time between package index updates (in minutes).
+	// When 0, package indexes are updated every time available updates are listed.
+	PackageIndexUpdateInterval int `json:"package_index_update_interval,omitempty"`
+
 	// EnableProcessInventory collection enabled.
 	EnableProcessInventory bool `json:"process_inventory"`
 
+	// ProcessInventoryFilter limits processes reported in the process inventory.
+	// An empty filter preserves all processes.
+	ProcessInventoryFilter inventory.ProcessFilter `json:"process_inventory_filter,omitempty"`
+
+	// EnablePortsInventory collection enabled (defaults to true).
+	EnablePortsInventory *bool `json:"ports_inventory,omitempty"`
+
+	// EnableContainerStatsInventory collects resource usage (CPU, memory, network and block IO)
+	// of containers managed by the agent.
+	EnableContainerStatsInventory bool `json:"container_stats_inventory"`
+
+	// EnableInventoryBatch delivers collected inventories in batched requests (when supported by the device hub).
+	EnableInventoryBatch bool `json:"inventory_batch"`
+
+	// InventoryBatchSize limits how many inventories are delivered in a single batched request (0 means unlimited).
+	InventoryBatchSize int `json:"inventory_batch_size,omitempty"`
+
+	// EnableRunSummary reports a per-run summary of bundles which made changes and which didn't.
+	EnableRunSummary bool `json:"run_summary"`
+
+	// RetryBudget defines how many device hub operations may fail during a single run,
+	// before remaining bundles are skipped (0 means unlimited).
+	RetryBudget int `json:"retry_budget"`
+
+	// EnableRemoteJobs allows the agent to fetch and execute one-shot jobs from the device hub (see Job).
+	// Jobs are only executed when config signing key is configured and the job is signed with it.
+	EnableRemoteJobs bool `json:"remote_jobs"`
+
+	// PostRebootCommand is a shell command executed when the agent starts after a reboot scheduled by the agent.
+	// Its result is reported, so updates breaking boot-critical services can be detected.
+	PostRebootCommand string `json:"post_reboot_command,omitempty"`
+
+	// ProvisioningCommand is a shell command executed only once on the device (e.g. to enroll with an external system).
+	// Its result is recorded in the provisioned.json marker file in agent's state directory,
+	// and the command is executed again only if the marker file is removed.
+	ProvisioningCommand string `json:"provisioning_command,omitempty"`
+
+	// AllowReboot defines whether the agent may reboot the system (defaults to true).
+	// When false, requested reboots are deferred and performed by a later run, once reboots are allowed again.
+	AllowReboot *bool `json:"allow_reboot,omitempty"`
+
+	// MaintenanceWindow limits restarts (of services, containers and compose projects), full package upgrades,
+	// RAUC bundle installations and reboots to the defined time window.
+	// Outside the window, they are deferred and performed by a later run.
+	MaintenanceWindow *MaintenanceWindow `json:"maintenance_window,omitempty"`
+
 	// RunInterval defines how often agent reports back to the device hub (in minutes).
 	RunInterval int `json:"agentinterval"`
 }
@@ -58,8 +133,31 @@ type SettingsBundle struct {
 func (s SettingsBundle) Execute(service *Service) {
 	service.reportingEnabled = s.EnableReports
 	service.metricsEnabled = s.EnableMetrics
+	service.metricsExporterAddress = ""
+	if s.EnablePrometheusExporter {
+		service.metricsExporterAddress = s.PrometheusExporterAddress
+		if service.metricsExporterAddress == "" {
+			service.metricsExporterAddress = metrics.DefaultExporterAddress
+		}
+	}
 	service.softwareInventoryEnabled = s.EnableSoftwareInventory
+	service.indexUpdatePolicy = software.IndexUpdatePolicy{
+		Disabled: s.DisablePackageIndexUpdate,
+		Interval: time.Duration(s.PackageIndexUpdateInterval) * time.Minute,
+	}
 	service.processInventoryEnabled = s.EnableProcessInventory
+	service.processInventoryFilter = s.ProcessInventoryFilter
+	service.portsInventoryEnabled = s.EnablePortsInventory == nil || *s.EnablePortsInventory
+	service.containerStatsEnabled = s.EnableContainerStatsInventory
+	service.inventoryBatchEnabled = s.EnableInventoryBatch
+	service.inventoryBatchSize = s.InventoryBatchSize
+	service.runSummaryEnabled = s.EnableRunSummary
+	service.retryBudgetLimit = s.RetryBudget
+	service.remoteJobsEnabled = s.EnableRemoteJobs
+	service.postRebootCommand = s.PostRebootCommand
+	service.provisioningCommand = s.ProvisioningCommand
+	service.allowReboot = s.AllowReboot == nil || *s.AllowReboot
+	service.maintenanceWindow = s.MaintenanceWindow
 
 	if service.runInterval != s.RunInterval {
 		service.runIntervalChangeNotifier <- time.Duration(s.RunInterval) * time.Minute
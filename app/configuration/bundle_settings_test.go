@@ -0,0 +1,62 @@
+// Copyright 2023 qbee.io
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package configuration
+
+import (
+	"encoding/json"
+	"testing"
+
+	"go.qbee.io/agent/app/software"
+	"go.qbee.io/agent/app/utils/assert"
+)
+
+func TestSettingsBundle_Execute_PortsInventory(t *testing.T) {
+	tests := []struct {
+		name     string
+		settings string
+		want     bool
+	}{
+		{name: "absent", settings: `{}`, want: true},
+		{name: "enabled", settings: `{"ports_inventory": true}`, want: true},
+		{name: "disabled", settings: `{"ports_inventory": false}`, want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var settings SettingsBundle
+			assert.NoError(t, json.Unmarshal([]byte(tt.settings), &settings))
+
+			srv := &Service{}
+			settings.Execute(srv)
+
+			assert.Equal(t, srv.CollectPortsInventory(), tt.want)
+		})
+	}
+}
+
+func TestSettingsBundle_Execute_IndexUpdatePolicy(t *testing.T) {
+	var settings SettingsBundle
+	assert.NoError(t, json.Unmarshal([]byte(`{"disable_package_index_update": true}`), &settings))
+
+	srv := &Service{}
+	settings.Execute(srv)
+	assert.Equal(t, srv.IndexUpdatePolicy(), software.IndexUpdatePolicy{Disabled: true})
+
+	// removed settings bundle restores the default policy
+	srv.applyDefaultSettings()
+	assert.Equal(t, srv.IndexUpdatePolicy(), software.IndexUpdatePolicy{})
+}
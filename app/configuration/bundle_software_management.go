@@ -19,8 +19,10 @@ package configuration
 import (
 	"context"
 	"fmt"
+	"os"
 	"path/filepath"
 	"strings"
+	"syscall"
 
 	"go.qbee.io/agent/app/software"
 	"go.qbee.io/agent/app/utils"
@@ -46,7 +48,15 @@ import (
 //	         "key": "configKey",
 //	         "value": "configValue"
 //	       }
-//	     ]
+//	     ],
+//	     "systemd_drop_ins": [
+//	       {
+//	         "name": "override.conf",
+//	         "template": "dropInTemplate"
+//	       }
+//	     ],
+//	     "enable": true,
+//	     "masked": false
 //	   }
 //	 ]
 //	}
@@ -69,11 +79,16 @@ func (s SoftwareManagementBundle) Execute(ctx context.Context, srv *Service) err
 		ReportError(ctx, err, "Package manager error.")
 		return err
 	} else if busy {
+		ReportInfo(ctx, nil, "Software skipped: package manager (%s) busy.", pkgManager.Type())
 		return nil
 	}
 
+	ctx = withIndexUpdateSkippedReport(ctx)
+
+	installed := &installedPackages{pkgManager: pkgManager}
+
 	for _, item := range s.Items {
-		if err := item.Execute(ctx, srv, pkgManager); err != nil {
+		if err := item.Execute(ctx, srv, installed); err != nil {
 			return err
 		}
 	}
@@ -88,6 +103,9 @@ type ConfigFile struct {
 
 	// ConfigLocation defines an absolute path in the system where file will be created.
 	ConfigLocation string `json:"config_location"`
+
+	// FileAttributes define optional owner, group and mode of the file.
+	FileAttributes
 }
 
 // Software defines software to be maintained in the system.
@@ -101,11 +119,38 @@ type Software struct {
 	// PreCondition defines an optional command which needs to return 0 in order for the Software to be installed.
 	PreCondition string `json:"pre_condition,omitempty"`
 
+	// When defines an optional condition on system facts and parameters (see CheckCondition),
+	// which needs to be met in order for the Software to be installed (e.g. "sys.arch == 'aarch64'").
+	When string `json:"when,omitempty"`
+
 	// ConfigFiles to be created for the software.
 	ConfigFiles []ConfigFile `json:"config_files"`
 
 	// Parameters for the ConfigFiles templating.
 	Parameters []TemplateParameter `json:"parameters"`
+
+	// DropIns defines systemd drop-in overrides for the service unit (rendered using Parameters).
+	DropIns []SystemdDropIn `json:"systemd_drop_ins,omitempty"`
+
+	// DiskSpaceFactor defines how many times the package file size must be available on the package database
+	// partition before installing a package from file (defaults to defaultDiskSpaceFactor).
+	DiskSpaceFactor float64 `json:"disk_space_factor,omitempty"`
+
+	// Enable defines whether the service unit should be enabled (true) or disabled (false) in systemd.
+	Enable *bool `json:"enable,omitempty"`
+
+	// Masked defines whether the service unit should be masked (true) or unmasked (false) in systemd.
+	Masked *bool `json:"masked,omitempty"`
+
+	// DiscardPackageFile removes package file downloaded from the file manager right after installation,
+	// instead of keeping it in the software cache directory. Only package information is kept, so the file
+	// is downloaded again only when it changes in the file manager or the package is no longer installed.
+	DiscardPackageFile bool `json:"discard_package_file,omitempty"`
+
+	// AllowConflicts defines whether a package installed from file may overwrite files owned by installed packages.
+	// Declared package conflicts are always refused.
+	// Files are overwritten only after regular installation fails and it's always reported.
+	AllowConflicts bool `json:"allow_conflicts,omitempty"`
 }
 
 func (s Software) serviceName(ctx context.Context, srv *Service) string {
@@ -118,6 +163,13 @@ func (s Software) serviceName(ctx context.Context, srv *Service) string {
 		// in the cache and parse correctly, so we are not too concerned about proper error handling here.
 		pkgFileCachePath := filepath.Join(srv.cacheDirectory, SoftwareCacheDirectory, s.Package)
 
+		// discarded package file is no longer available, so use its persisted package information
+		if s.DiscardPackageFile {
+			if pkgInfo := readPackageFileInfo(pkgFileCachePath, ""); pkgInfo != nil {
+				return pkgInfo.Name
+			}
+		}
+
 		pkgInfo, err := software.DefaultPackageManager.ParsePackageFile(ctx, pkgFileCachePath)
 		if err != nil {
 			return ""
@@ -130,7 +182,11 @@ func (s Software) serviceName(ctx context.Context, srv *Service) string {
 }
 
 // Execute a Software configuration on the system.
-func (s Software) Execute(ctx context.Context, srv *Service, pkgManager software.PackageManager) error {
+func (s Software) Execute(ctx context.Context, srv *Service, installed *installedPackages) error {
+	if !conditionMet(ctx, s.When) {
+		return nil
+	}
+
 	if !CheckPreCondition(ctx, s.PreCondition) {
 		return nil
 	}
@@ -143,9 +199,9 @@ func (s Software) Execute(ctx context.Context, srv *Service, pkgManager software
 
 	// install package
 	if strings.HasSuffix(s.Package, software.DefaultPackageManager.FileSuffix()) {
-		shouldRestart, err = s.installFromFile(ctx, srv, pkgManager)
+		shouldRestart, err = s.installFromFile(ctx, srv, installed)
 	} else {
-		shouldRestart, err = s.installFromRepository(ctx, pkgManager)
+		shouldRestart, err = s.installFromRepository(ctx, installed)
 	}
 	if err != nil {
 		return err
@@ -155,8 +211,15 @@ func (s Software) Execute(ctx context.Context, srv *Service, pkgManager software
 	for _, cfgFile := range s.ConfigFiles {
 		var created bool
 
+		var attrs *fileAttributes
+		if attrs, err = cfgFile.FileAttributes.resolve(); err != nil {
+			ReportError(ctx, err, "Invalid file attributes for %s", cfgFile.ConfigLocation)
+			return err
+		}
+
 		parameters := templateParametersMap(s.Parameters)
-		created, err = srv.downloadTemplateFile(ctx, "", cfgFile.ConfigTemplate, cfgFile.ConfigLocation, parameters)
+		fileCtx := withFileAttributes(ctx, attrs)
+		created, err = srv.downloadTemplateFile(fileCtx, "", cfgFile.ConfigTemplate, cfgFile.ConfigLocation, parameters)
 		if err != nil {
 			return err
 		}
@@ -166,8 +229,27 @@ func (s Software) Execute(ctx context.Context, srv *Service, pkgManager software
 		}
 	}
 
-	// restart service if needed
-	if shouldRestart {
+	// apply systemd drop-in overrides
+	if len(s.DropIns) > 0 {
+		var reloaded bool
+		if reloaded, err = s.applyDropIns(ctx, srv); err != nil {
+			return err
+		}
+
+		if reloaded {
+			shouldRestart = true
+		}
+	}
+
+	// apply systemd unit file state
+	if s.Enable != nil || s.Masked != nil {
+		if err = s.applyUnitFileState(ctx, srv); err != nil {
+			return err
+		}
+	}
+
+	// restart service if needed (or deferred by one of the previous runs)
+	if srv.restartAllowed(ctx, "service:"+s.Package, shouldRestart) {
 		s.restart(ctx, srv)
 	}
 
@@ -175,15 +257,33 @@ func (s Software) Execute(ctx context.Context, srv *Service, pkgManager software
 }
 
 // installFromFile installs package from a file.
-func (s Software) installFromFile(ctx context.Context, srv *Service, pkgManager software.PackageManager) (bool, error) {
+func (s Software) installFromFile(ctx context.Context, srv *Service, installed *installedPackages) (bool, error) {
+	ctx = withReportAction(ctx, reportActionInstall, s.Package)
+
+	pkgManager := installed.pkgManager
+
 	// download package from the file manager into software cache directory
 	var pkgFileCachePath string
+	var pkgFileDigest string
+
+	discardPackageFile := s.DiscardPackageFile && !strings.HasPrefix(s.Package, localFileSchema)
 
 	if strings.HasPrefix(s.Package, localFileSchema) {
 		pkgFileCachePath = strings.TrimPrefix(s.Package, localFileSchema)
 	} else {
 		pkgFileCachePath = filepath.Join(srv.cacheDirectory, SoftwareCacheDirectory, s.Package)
 
+		if discardPackageFile {
+			isInstalled, digest, err := srv.isDiscardedPackageInstalled(ctx, installed, s.Package, pkgFileCachePath)
+			if err != nil || isInstalled {
+				return false, err
+			}
+
+			pkgFileDigest = digest
+
+			defer removePackageFile(pkgFileCachePath)
+		}
+
 		if _, err := srv.downloadFile(ctx, "", s.Package, pkgFileCachePath); err != nil {
 			return false, err
 		}
@@ -195,6 +295,10 @@ func (s Software) installFromFile(ctx context.Context, srv *Service, pkgManager
 		return false, err
 	}
 
+	if discardPackageFile {
+		writePackageFileInfo(pkgFileCachePath, pkgFileDigest, pkgInfo)
+	}
+
 	// check non-empty architecture
 	if pkgInfo.Architecture == "" {
 		ReportError(ctx, nil, "Package %s reports empty architecture", pkgInfo.Name)
@@ -208,21 +312,38 @@ func (s Software) installFromFile(ctx context.Context, srv *Service, pkgManager
 	}
 
 	// Check whether package is installed
-	if isInstalled, err := s.isPackageInstalled(ctx, pkgInfo, pkgManager); err != nil {
+	if isInstalled, err := installed.has(ctx, pkgInfo); err != nil {
 		return false, err
 	} else if isInstalled {
 		return false, nil
 	}
 
+	// make sure there is enough disk space to unpack and install the package
+	if err = s.checkDiskSpace(pkgManager.Type(), pkgFileCachePath); err != nil {
+		ReportError(ctx, err, "Not enough disk space to install %s", pkgInfo.Name)
+		return false, err
+	}
+
 	// install package using the package manager
 	var output []byte
-	if output, err = pkgManager.InstallLocal(ctx, pkgFileCachePath); err != nil {
-		ReportError(ctx, err, "Unable to install '%s'", s.Package)
+	output, err = pkgManager.InstallLocal(ctx, pkgFileCachePath)
+	installed.invalidate()
+
+	// retry with conflicting files overwritten only when regular installation didn't succeed
+	conflictsOverridden := false
+	if s.AllowConflicts && !installedWithoutError(ctx, installed, pkgInfo, err) {
+		output, err = pkgManager.InstallLocal(software.WithConflictsAllowed(ctx), pkgFileCachePath)
+		installed.invalidate()
+		conflictsOverridden = true
+	}
+
+	if err != nil {
+		ReportError(ctx, err, "Unable to install '%s'.%s", s.Package, packageFailuresSummary(err))
 		return false, err
 	}
 
 	// Verify that package was installed
-	if isInstalled, err := s.isPackageInstalled(ctx, pkgInfo, pkgManager); err != nil {
+	if isInstalled, err := installed.has(ctx, pkgInfo); err != nil {
 		ReportError(ctx, err, "Unable to verify installation of '%s'", s.Package)
 		return false, err
 	} else if !isInstalled {
@@ -230,46 +351,88 @@ func (s Software) installFromFile(ctx context.Context, srv *Service, pkgManager
 		return false, fmt.Errorf("unable to install '%s'", s.Package)
 	}
 
-	ReportInfo(ctx, output, "Successfully installed '%s'", s.Package)
+	if conflictsOverridden {
+		recordChange(ctx)
+		ReportWarning(ctx, output, "Successfully installed '%s' with conflicting files overwritten", s.Package)
+	} else {
+		reportChange(ctx, output, "Successfully installed '%s'", s.Package)
+	}
 
 	return true, nil
 }
 
-func (s Software) isPackageInstalled(ctx context.Context, pkgInfo *software.Package, pkgManager software.PackageManager) (bool, error) {
-	// check if package is already installed
-	installedPackages, err := pkgManager.ListPackages(ctx)
+// installedWithoutError returns true if installation finished without error and the package is installed.
+func installedWithoutError(ctx context.Context, installed *installedPackages, pkgInfo *software.Package, err error) bool {
 	if err != nil {
-		return false, err
+		return false
 	}
 
-	for _, pkg := range installedPackages {
-		// continue if name do not match
-		if pkg.Name != pkgInfo.Name {
-			continue
-		}
-		// name matches and we do not have version information
-		if pkgInfo.Version == "" {
-			return true, nil
-		}
-		// name matches, continue if versions do not match
-		if pkg.Version != pkgInfo.Version {
-			continue
-		}
-		// name and version match, return if architecture is the same
-		if pkg.Architecture == pkgInfo.Architecture {
-			return true, nil
-		}
+	isInstalled, err := installed.has(ctx, pkgInfo)
+
+	return err == nil && isInstalled
+}
+
+// defaultDiskSpaceFactor is the default ratio of required free disk space to the package file size.
+const defaultDiskSpaceFactor = 3.0
+
+// packageDatabasePath returns a path located on the partition where packages are unpacked and registered.
+// On OpenWrt, /var is a tmpfs, so the persistent opkg database location is used for opkg systems.
+func packageDatabasePath(pkgManagerType software.PackageManagerType) string {
+	if pkgManagerType == software.PackageManagerTypeOpkg {
+		return "/usr/lib/opkg"
 	}
-	return false, nil
+
+	return "/var"
+}
+
+// checkDiskSpace returns an error when the package database partition doesn't have enough space to install package.
+func (s Software) checkDiskSpace(pkgManagerType software.PackageManagerType, pkgFilePath string) error {
+	fileInfo, err := os.Stat(pkgFilePath)
+	if err != nil {
+		return fmt.Errorf("error checking package file %s: %w", pkgFilePath, err)
+	}
+
+	factor := s.DiskSpaceFactor
+	if factor <= 0 {
+		factor = defaultDiskSpaceFactor
+	}
+
+	requiredBytes := uint64(float64(fileInfo.Size()) * factor)
+
+	databasePath := packageDatabasePath(pkgManagerType)
+
+	var availableBytes uint64
+	if availableBytes, err = availableDiskSpace(databasePath); err != nil {
+		return err
+	}
+
+	if availableBytes < requiredBytes {
+		return fmt.Errorf("%d bytes required on %s, %d bytes available", requiredBytes, databasePath, availableBytes)
+	}
+
+	return nil
+}
+
+// availableDiskSpace returns number of bytes available to unprivileged users on the filesystem containing path.
+func availableDiskSpace(path string) (uint64, error) {
+	var st syscall.Statfs_t
+
+	if err := syscall.Statfs(path, &st); err != nil {
+		return 0, fmt.Errorf("error checking disk space on %s: %w", path, err)
+	}
+
+	return st.Bavail * uint64(st.Bsize), nil
 }
 
 // installFromRepository install package from package repository.
-func (s Software) installFromRepository(ctx context.Context, pkgManager software.PackageManager) (bool, error) {
+func (s Software) installFromRepository(ctx context.Context, installed *installedPackages) (bool, error) {
+	ctx = withReportAction(ctx, reportActionInstall, s.Package)
+
 	// Check whether package is installed
 	pkgInfo := &software.Package{
 		Name: s.Package,
 	}
-	if isInstalled, err := s.isPackageInstalled(ctx, pkgInfo, pkgManager); err != nil {
+	if isInstalled, err := installed.has(ctx, pkgInfo); err != nil {
 		return false, err
 	} else if isInstalled {
 		return false, nil
@@ -278,16 +441,44 @@ func (s Software) installFromRepository(ctx context.Context, pkgManager software
 	// install package
 	var output []byte
 	var err error
-	if output, err = pkgManager.Install(ctx, s.Package, ""); err != nil {
-		ReportError(ctx, err, "Unable to install '%s'", s.Package)
+	output, err = installed.pkgManager.Install(ctx, s.Package, "")
+	installed.invalidate()
+	if err != nil {
+		ReportError(ctx, err, "Unable to install '%s'.%s", s.Package, packageFailuresSummary(err))
 		return false, err
 	}
 
-	ReportInfo(ctx, output, "Successfully installed '%s'", s.Package)
+	reportChange(ctx, output, "Successfully installed '%s'", s.Package)
 
 	return true, nil
 }
 
+// installedPackages provides indexed lookups of packages installed in the system.
+// The index is built once and shared across all items of the bundle, so large package lists are not scanned per item.
+type installedPackages struct {
+	pkgManager software.PackageManager
+	index      software.PackageIndex
+}
+
+// has returns true if package matching pkgInfo is installed in the system.
+func (ip *installedPackages) has(ctx context.Context, pkgInfo *software.Package) (bool, error) {
+	if ip.index == nil {
+		packages, err := ip.pkgManager.ListPackages(ctx)
+		if err != nil {
+			return false, err
+		}
+
+		ip.index = software.NewPackageIndex(packages)
+	}
+
+	return ip.index.Has(pkgInfo), nil
+}
+
+// invalidate discards the index, so it's rebuilt on next lookup after packages were installed.
+func (ip *installedPackages) invalidate() {
+	ip.index = nil
+}
+
 // restart restarts the service
 func (s Software) restart(ctx context.Context, srv *Service) {
 	var err error
@@ -319,5 +510,5 @@ func (s Software) restart(ctx context.Context, srv *Service) {
 		return
 	}
 
-	ReportInfo(ctx, output, "Restarted service '%s'", serviceName)
+	reportChange(ctx, output, "Restarted service '%s'", serviceName)
 }
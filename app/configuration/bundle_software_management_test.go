@@ -18,6 +18,7 @@ package configuration_test
 
 import (
 	"fmt"
+	"strings"
 	"sync"
 	"testing"
 	"time"
@@ -114,15 +115,38 @@ func Test_SoftwareManagementBundle_InstallPackageFromFile_WithConflicts(t *testi
 			}
 
 			reports := executeSoftwareManagementBundle(r, packages)
-			expectedReports := []string{
-				fmt.Sprintf("[ERR] Unable to install '%s'", filename),
-			}
-			assert.Equal(t, reports, expectedReports)
+			// report includes the list of failed packages reported by the package manager
+			assert.Length(t, reports, 1)
+			assert.HasPrefix(t, reports[0], fmt.Sprintf("[ERR] Unable to install '%s'.", filename))
 		}(test.runner, test.filename)
 	}
 	wg.Wait()
 }
 
+func Test_SoftwareManagementBundle_InstallPackageFromFile_WithConflictsAllowed(t *testing.T) {
+	r := runner.New(t)
+
+	filename := "file:///apt-repo/repo/qbee-test-conflicts_1.0.0_all.deb"
+	packages := []configuration.Software{
+		{
+			Package:        filename,
+			AllowConflicts: true,
+		},
+	}
+
+	// declared package conflicts are refused even when conflicts are allowed
+	reports := executeSoftwareManagementBundle(r, packages)
+	assert.Length(t, reports, 1)
+	assert.HasPrefix(t, reports[0], fmt.Sprintf("[ERR] Unable to install '%s'.", filename))
+
+	output, _ := r.Exec("dpkg-query", "-W", "-f=${Status}", "qbee-test-conflicts")
+	assert.NotEqual(t, string(output), "install ok installed")
+
+	// conflicting package is not installed, so apt is left untouched
+	output = r.MustExec("dpkg-query", "-W", "-f=${Status}", "apt")
+	assert.Equal(t, string(output), "install ok installed")
+}
+
 func Test_SoftwareManagementBundle_InstallPackageFromFile_WithDependencies(t *testing.T) {
 	tt := []struct {
 		name     string
@@ -395,6 +419,67 @@ func Test_SoftwareManagementBundle_InstallPackage_Unsupported_Architecture(t *te
 
 }
 
+func Test_SoftwareManagementBundle_InstallPackageFromFile_NotEnoughDiskSpace(t *testing.T) {
+	r := runner.New(t)
+
+	packages := []configuration.Software{
+		{
+			Package:         "file:///apt-repo/repo/qbee-test_2.1.1_all.deb",
+			ServiceName:     "qbee-test",
+			DiskSpaceFactor: 1e15,
+		},
+	}
+
+	reports := executeSoftwareManagementBundle(r, packages)
+	expectedReports := []string{
+		"[ERR] Not enough disk space to install qbee-test",
+	}
+	assert.Equal(t, reports, expectedReports)
+}
+
+func Test_SoftwareManagementBundle_InstallPackageFromFile_RecoversFailedPostinst(t *testing.T) {
+	r := runner.New(t)
+
+	// postinst script of this package fails on the first attempt only
+	const filename = "file:///apt-repo/repo/qbee-test-postinst-fail_1.0.0_all.deb"
+
+	// leave the package half-configured, as if a previous run was interrupted by the failing postinst
+	_, err := r.Exec("dpkg", "-i", "/apt-repo/repo/qbee-test-postinst-fail_1.0.0_all.deb")
+	assert.NotEqual(t, err, nil)
+
+	packages := []configuration.Software{
+		{
+			Package: "file:///apt-repo/repo/qbee-test_2.1.1_all.deb",
+		},
+	}
+
+	// other packages can still be installed once the half-configured package is recovered
+	reports := executeSoftwareManagementBundle(r, packages)
+	expectedReports := []string{
+		"[INFO] Successfully installed 'file:///apt-repo/repo/qbee-test_2.1.1_all.deb'",
+	}
+	assert.Equal(t, reports, expectedReports)
+
+	output := r.MustExec("dpkg-query", "--show", "--showformat", "${db:Status-Abbrev}", "qbee-test-postinst-fail")
+	assert.Equal(t, strings.TrimSpace(string(output)), "ii")
+
+	// agent converges on the package with failing postinst
+	r.MustExec("dpkg", "--purge", "qbee-test-postinst-fail")
+	r.MustExec("rm", "-f", "/var/lib/qbee-test-postinst-fail.attempted")
+
+	packages = []configuration.Software{{Package: filename}}
+
+	reports = executeSoftwareManagementBundle(r, packages)
+	expectedReports = []string{
+		fmt.Sprintf("[INFO] Successfully installed '%s'", filename),
+	}
+	assert.Equal(t, reports, expectedReports)
+
+	// next run doesn't change anything
+	reports = executeSoftwareManagementBundle(r, packages)
+	assert.Empty(t, reports)
+}
+
 // executeSoftwareManagementBundle is a helper method to quickly execute software management bundle.
 // On success, it returns a slice of produced reports.
 func executeSoftwareManagementBundle(r *runner.Runner, items []configuration.Software) []string {
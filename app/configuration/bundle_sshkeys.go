@@ -89,7 +89,7 @@ func (s SSHKeysBundle) Execute(ctx context.Context, _ *Service) error {
 		}
 
 		if created {
-			ReportInfo(ctx, nil, "Writing authorized_keys for user %s.", user.Username)
+			reportChange(ctx, nil, "Writing authorized_keys for user %s.", user.Username)
 		}
 	}
 
@@ -111,7 +111,7 @@ func (s SSHKeysBundle) createAuthorizedKeysFile(user *inventory.User, keys []str
 	hexDigest := hex.EncodeToString(digest.Sum(nil))
 
 	// check whether the file has correct contents
-	fileReady, err := isFileReady(authorizedKeysFilePath, hexDigest, "")
+	fileReady, err := isFileReady(authorizedKeysFilePath, fileDigest{Algorithm: DigestSHA256, Hex: hexDigest})
 	if err != nil || fileReady {
 		return false, err
 	}
@@ -123,7 +123,7 @@ func (s SSHKeysBundle) createAuthorizedKeysFile(user *inventory.User, keys []str
 
 	// re-create authorized_keys file
 	var file *os.File
-	if file, err = createFile(authorizedKeysFilePath, sshAuthorizedKeysFilePermission); err != nil {
+	if file, err = createFile(authorizedKeysFilePath, sshAuthorizedKeysFilePermission, nil); err != nil {
 		return false, err
 	}
 
@@ -101,7 +101,7 @@ func (u UsersBundle) AddUser(ctx context.Context, username string) error {
 		return err
 	}
 
-	ReportInfo(ctx, output, "Successfully added user '%s'", username)
+	reportChange(ctx, output, "Successfully added user '%s'", username)
 
 	return nil
 }
@@ -124,7 +124,7 @@ func (u UsersBundle) RemoveUser(ctx context.Context, username string) error {
 		return err
 	}
 
-	ReportInfo(ctx, output, "Successfully removed user '%s'", username)
+	reportChange(ctx, output, "Successfully removed user '%s'", username)
 
 	return nil
 }
@@ -0,0 +1,67 @@
+// Copyright 2023 qbee.io
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package configuration
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"go.qbee.io/agent/app/utils"
+)
+
+const (
+	// certificateExpiryFileName records the day when the last certificate expiry warning was added to the reports buffer.
+	certificateExpiryFileName = "certificate_expiry"
+
+	// certificateExpiryBundle is the bundle name used for certificate expiry reports.
+	certificateExpiryBundle = "device_certificate"
+
+	// certificateExpiryDayFormat defines how the day of the last warning is recorded.
+	certificateExpiryDayFormat = "2006-01-02"
+)
+
+// RecordCertificateExpiry adds a warning report about approaching device certificate expiry to the reports buffer
+// in appDirectory, so it's delivered to the device hub by the next successful agent run.
+// The warning is recorded at most once a day, so frequent agent runs don't flood the buffer.
+func RecordCertificateExpiry(appDirectory string, notAfter time.Time, renewErr error) error {
+	markerPath := filepath.Join(appDirectory, certificateExpiryFileName)
+	today := time.Now().Format(certificateExpiryDayFormat)
+
+	if previous, err := os.ReadFile(markerPath); err == nil && string(previous) == today {
+		return nil
+	}
+
+	reporter := NewReporter("", false, nil)
+	ctx := reporter.BundleContext(context.Background(), certificateExpiryBundle, "")
+
+	ReportWarning(ctx, renewErr, "Device certificate expires on %s (in %d days) and could not be renewed.",
+		notAfter.UTC().Format(time.RFC3339), int(time.Until(notAfter).Hours()/24))
+
+	srv := &Service{appDirectory: appDirectory}
+	if err := srv.addReportsToBuffer(reporter.Reports()); err != nil {
+		return err
+	}
+
+	if err := utils.WriteFileSync(markerPath, []byte(today), reportsBufferFileMode); err != nil {
+		return fmt.Errorf("failed to save certificate expiry warning: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,59 @@
+// Copyright 2023 qbee.io
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package configuration
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"go.qbee.io/agent/app/utils/assert"
+)
+
+func TestRecordCertificateExpiry(t *testing.T) {
+	srv := &Service{appDirectory: t.TempDir()}
+
+	bufferedReports := func() []Report {
+		reports, err := srv.readReportsBuffer()
+		assert.NoError(t, err)
+		return reports
+	}
+
+	notAfter := time.Now().Add(10*24*time.Hour + time.Hour)
+	renewErr := errors.New("device hub unavailable")
+
+	assert.NoError(t, RecordCertificateExpiry(srv.appDirectory, notAfter, renewErr))
+
+	reports := bufferedReports()
+	assert.Length(t, reports, 1)
+	assert.Equal(t, reports[0].Bundle, certificateExpiryBundle)
+	assert.Equal(t, reports[0].Severity, severityWarning)
+	assert.Equal(t, reports[0].Text, "Device certificate expires on "+
+		notAfter.UTC().Format(time.RFC3339)+" (in 10 days) and could not be renewed.")
+
+	// the warning is recorded only once a day
+	assert.NoError(t, RecordCertificateExpiry(srv.appDirectory, notAfter, renewErr))
+	assert.Length(t, bufferedReports(), 1)
+
+	// warning is recorded again on the next day
+	markerPath := filepath.Join(srv.appDirectory, certificateExpiryFileName)
+	assert.NoError(t, os.WriteFile(markerPath, []byte("2000-01-01"), reportsBufferFileMode))
+	assert.NoError(t, RecordCertificateExpiry(srv.appDirectory, notAfter, renewErr))
+	assert.Length(t, bufferedReports(), 2)
+}
@@ -24,6 +24,7 @@ import (
 	"fmt"
 	"os/exec"
 	"syscall"
+	"time"
 
 	"go.qbee.io/agent/app/utils"
 )
@@ -70,7 +71,9 @@ func RunCommand(ctx context.Context, command string) ([]byte, error) {
 	cmd.Stderr = tailBuffer
 
 	// run the command
+	start := time.Now()
 	err := cmd.Run()
+	utils.TraceCommand(ctx, cmd, start)
 
 	// grab tail of the output
 	outputLines := tailBuffer.Close()
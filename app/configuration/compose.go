@@ -1,5 +1,10 @@
 package configuration
 
+import (
+	"fmt"
+	"path/filepath"
+)
+
 // Compose controls docker compose projects running in the system.
 type Compose struct {
 	// Name of the project.
@@ -8,6 +13,9 @@ type Compose struct {
 	// File to the docker-compose file.
 	File string `json:"file"`
 
+	// Files are additional compose files layered on top of File in the provided order (e.g. overrides).
+	Files []string `json:"files,omitempty"`
+
 	// ComposeContent is the content any build context (tarball) that is needed for the compose file.
 	// NB: It is not recommend using build context in production environments as it will not create
 	// immutable deployments. Use it only for development purposes.
@@ -24,8 +32,97 @@ type Compose struct {
 
 	// UseContext defines if build context should be used.
 	UseContext bool `json:"use_context,omitempty"`
+
+	// runtime is the compose runtime used to deploy the project.
+	runtime composeRuntime
+}
+
+// composeRuntime defines how compose projects are managed with a specific container runtime.
+type composeRuntime struct {
+	// name is the container runtime type (docker or podman).
+	name string
+
+	// bin is the path to the container runtime executable.
+	bin string
+
+	// command is the compose command prefix, e.g. ["docker", "compose"] or ["podman-compose"].
+	command []string
+
+	// directory is the cache directory (relative to the agent cache) for compose projects.
+	directory string
+}
+
+// projectDirectory returns cache directory for the named project.
+func (r composeRuntime) projectDirectory(service *Service, projectName string) string {
+	return filepath.Join(service.cacheDirectory, r.directory, projectName)
+}
+
+// upCommand returns command which (re)deploys the project.
+func (r composeRuntime) upCommand(project Compose, service *Service) []string {
+	projectDirectory := r.projectDirectory(service, project.Name)
+
+	cmd := append([]string{}, r.command...)
+	cmd = append(cmd, "--project-name", project.Name)
+
+	// podman-compose resolves relative paths against the first compose file and has no --project-directory
+	if r.name == dockerRuntimeType {
+		cmd = append(cmd, "--project-directory", filepath.Join(projectDirectory, composeContext))
+	}
+
+	cmd = append(cmd, project.composeFileArgs(projectDirectory)...)
+
+	if r.name == podmanRuntimeType {
+		return append(cmd, "up", "--detach", "--build", "--remove-orphans", "--timeout", dockerComposeTimeout,
+			"--force-recreate")
+	}
+
+	return append(cmd, "up", "--build", "--remove-orphans", "--wait", "--timeout", dockerComposeTimeout,
+		"--timestamps", "--force-recreate")
+}
+
+// downCommand returns command which removes the named project.
+func (r composeRuntime) downCommand(projectName string) []string {
+	cmd := append([]string{}, r.command...)
+	cmd = append(cmd, "--project-name", projectName, "down", "--remove-orphans", "--volumes", "--timeout", "60")
+
+	if r.name == podmanRuntimeType {
+		return cmd
+	}
+
+	return append(cmd, "--rmi", "all")
 }
 
 const composeFile = "compose.yml"
+const composeOverrideFilePattern = "compose.override-%d.yml"
 const composeContext = "context"
 const dockerComposeTimeout = "60"
+
+// composeFiles returns all compose files of the project in the order they should be applied.
+func (c Compose) composeFiles() []string {
+	files := make([]string, 0, len(c.Files)+1)
+	if c.File != "" {
+		files = append(files, c.File)
+	}
+
+	return append(files, c.Files...)
+}
+
+// localComposeFileName returns name of the local copy of the compose file at the provided index.
+// The first file keeps the legacy name, so existing deployments are not redeployed after upgrade.
+func localComposeFileName(index int) string {
+	if index == 0 {
+		return composeFile
+	}
+
+	return fmt.Sprintf(composeOverrideFilePattern, index)
+}
+
+// composeFileArgs returns --file arguments for all local compose files of the project.
+func (c Compose) composeFileArgs(projectDirectory string) []string {
+	args := make([]string, 0, 2*len(c.composeFiles()))
+	for i := range c.composeFiles() {
+		args = append(args, "--file", filepath.Join(projectDirectory, localComposeFileName(i)))
+	}
+
+	return args
+}
@@ -0,0 +1,121 @@
+// Copyright 2024 qbee.io
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package configuration
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"go.qbee.io/agent/app/utils/assert"
+)
+
+func TestCompose_composeFileArgs(t *testing.T) {
+	compose := Compose{
+		File:  "file:///compose.yml",
+		Files: []string{"file:///compose.prod.yml", "file:///compose.site.yml"},
+	}
+
+	expected := []string{
+		"--file", "/project/compose.yml",
+		"--file", "/project/compose.override-1.yml",
+		"--file", "/project/compose.override-2.yml",
+	}
+
+	assert.Equal(t, compose.composeFileArgs("/project"), expected)
+}
+
+func TestCompose_removeStaleComposeFiles(t *testing.T) {
+	projectDirectory := t.TempDir()
+
+	for i := 0; i < 3; i++ {
+		filePath := filepath.Join(projectDirectory, localComposeFileName(i))
+		if err := os.WriteFile(filePath, []byte("services: {}"), 0600); err != nil {
+			t.Fatalf("cannot create compose file: %v", err)
+		}
+	}
+
+	compose := Compose{File: "file:///compose.yml", Files: []string{"file:///compose.prod.yml"}}
+
+	removed, err := compose.removeStaleComposeFiles(projectDirectory)
+	assert.NoError(t, err)
+	assert.True(t, removed)
+
+	_, err = os.Stat(filepath.Join(projectDirectory, localComposeFileName(1)))
+	assert.NoError(t, err)
+
+	_, err = os.Stat(filepath.Join(projectDirectory, localComposeFileName(2)))
+	assert.True(t, os.IsNotExist(err))
+
+	removed, err = compose.removeStaleComposeFiles(projectDirectory)
+	assert.NoError(t, err)
+	assert.False(t, removed)
+}
+
+func TestComposeRuntime_upCommand(t *testing.T) {
+	service := New(nil, "/app", "/cache")
+	project := Compose{Name: "project-a", File: "file:///compose.yml"}
+
+	docker := composeRuntime{
+		name:      dockerRuntimeType,
+		command:   []string{"docker", "compose"},
+		directory: DockerComposeDirectory,
+	}
+
+	assert.Equal(t, docker.upCommand(project, service), []string{
+		"docker", "compose",
+		"--project-name", "project-a",
+		"--project-directory", "/cache/docker_compose/project-a/context",
+		"--file", "/cache/docker_compose/project-a/compose.yml",
+		"up", "--build", "--remove-orphans", "--wait", "--timeout", "60", "--timestamps", "--force-recreate",
+	})
+
+	podman := composeRuntime{
+		name:      podmanRuntimeType,
+		command:   []string{"podman-compose"},
+		directory: PodmanComposeDirectory,
+	}
+
+	assert.Equal(t, podman.upCommand(project, service), []string{
+		"podman-compose",
+		"--project-name", "project-a",
+		"--file", "/cache/podman_compose/project-a/compose.yml",
+		"up", "--detach", "--build", "--remove-orphans", "--timeout", "60", "--force-recreate",
+	})
+}
+
+func Test_parsePodmanComposeStatus(t *testing.T) {
+	output := []byte(`[
+		{"Labels": {"io.podman.compose.project": "project-a"}, "State": "running"},
+		{"Labels": {"io.podman.compose.project": "project-a"}, "State": "exited"},
+		{"Labels": {"com.docker.compose.project": "project-b"}, "State": "running"},
+		{"Labels": {"other": "label"}, "State": "running"},
+		{"Labels": null, "State": "running"}
+	]`)
+
+	projects, err := parsePodmanComposeStatus(output)
+	assert.NoError(t, err)
+
+	expected := map[string]projectStatus{
+		"project-a": {Name: "project-a", Status: "exited(1), running(1)"},
+		"project-b": {Name: "project-b", Status: "running(1)"},
+	}
+
+	assert.Equal(t, projects, expected)
+	assert.True(t, Compose{}.needsRestart(projects["project-a"]))
+	assert.False(t, Compose{}.needsRestart(projects["project-b"]))
+}
@@ -0,0 +1,341 @@
+// Copyright 2023 qbee.io
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package configuration
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// CheckCondition evaluates the provided condition expression against system facts and parameters.
+// Empty condition is always met.
+//
+// Condition expressions support:
+//   - facts and parameters referenced by name (e.g. sys.arch, sys.os, sys.flavor, sys.host or a parameter key),
+//   - single- or double-quoted string literals (e.g. 'aarch64'),
+//   - comparisons using == and !=,
+//   - logical operators !, && and || (in order of precedence) and parentheses.
+//
+// A name used outside a comparison is true when it is defined and its value is neither empty, "false" nor "0",
+// which allows using parameters as custom device tags, e.g. "sys.arch == 'aarch64' && (gateway || sys.flavor != 'debian')".
+func CheckCondition(ctx context.Context, condition string) (bool, error) {
+	if strings.TrimSpace(condition) == "" {
+		return true, nil
+	}
+
+	return evaluateCondition(condition, func(name string) (string, bool, error) {
+		return lookupConditionValue(ctx, name)
+	})
+}
+
+// conditionMet returns true if the condition is met. Invalid conditions are reported and treated as not met.
+func conditionMet(ctx context.Context, condition string) bool {
+	met, err := CheckCondition(ctx, condition)
+	if err != nil {
+		ReportError(ctx, err, "Invalid condition '%s'", condition)
+		return false
+	}
+
+	return met
+}
+
+// lookupConditionValue returns value of a parameter or a system fact with the provided name.
+func lookupConditionValue(ctx context.Context, name string) (string, bool, error) {
+	if parameterStore, ok := ctx.Value(ctxParameterStore).(*ParameterStore); ok {
+		if err, failed := parameterStore.errors[name]; failed {
+			return "", false, fmt.Errorf("cannot resolve parameter %s: %w", name, err)
+		}
+
+		if value, exists := parameterStore.values[name]; exists {
+			return value, true, nil
+		}
+	}
+
+	if valueFn, exists := systemParameters[name]; exists {
+		value, err := valueFn()
+		if err != nil {
+			return "", false, fmt.Errorf("cannot resolve parameter %s: %w", name, err)
+		}
+
+		return value, true, nil
+	}
+
+	return "", false, nil
+}
+
+// conditionLookup returns value of the named fact or parameter and whether it's defined.
+type conditionLookup func(name string) (value string, defined bool, err error)
+
+type conditionTokenKind int
+
+const (
+	conditionTokenName conditionTokenKind = iota
+	conditionTokenString
+	conditionTokenOperator
+)
+
+type conditionToken struct {
+	kind  conditionTokenKind
+	value string
+}
+
+// conditionOperators lists supported operators (two-character operators first).
+var conditionOperators = []string{"==", "!=", "&&", "||", "!", "(", ")"}
+
+// tokenizeCondition splits condition expression into tokens.
+func tokenizeCondition(condition string) ([]conditionToken, error) {
+	tokens := make([]conditionToken, 0)
+
+	for i := 0; i < len(condition); {
+		char := condition[i]
+
+		switch {
+		case char == ' ' || char == '\t' || char == '\n':
+			i++
+
+		case char == '\'' || char == '"':
+			end := strings.IndexByte(condition[i+1:], char)
+			if end < 0 {
+				return nil, fmt.Errorf("unterminated string at position %d", i)
+			}
+
+			tokens = append(tokens, conditionToken{kind: conditionTokenString, value: condition[i+1 : i+1+end]})
+			i += end + 2
+
+		case isConditionNameChar(char):
+			start := i
+			for i < len(condition) && isConditionNameChar(condition[i]) {
+				i++
+			}
+
+			tokens = append(tokens, conditionToken{kind: conditionTokenName, value: condition[start:i]})
+
+		default:
+			operator := ""
+			for _, op := range conditionOperators {
+				if strings.HasPrefix(condition[i:], op) {
+					operator = op
+					break
+				}
+			}
+
+			if operator == "" {
+				return nil, fmt.Errorf("unexpected character %q at position %d", char, i)
+			}
+
+			tokens = append(tokens, conditionToken{kind: conditionTokenOperator, value: operator})
+			i += len(operator)
+		}
+	}
+
+	return tokens, nil
+}
+
+// isConditionNameChar returns true if the character can be used in fact and parameter names.
+func isConditionNameChar(char byte) bool {
+	return char >= 'a' && char <= 'z' ||
+		char >= 'A' && char <= 'Z' ||
+		char >= '0' && char <= '9' ||
+		char == '_' || char == '.' || char == '-'
+}
+
+// conditionParser is a recursive descent parser evaluating condition expressions.
+type conditionParser struct {
+	tokens []conditionToken
+	pos    int
+	lookup conditionLookup
+}
+
+// evaluateCondition parses and evaluates condition expression using provided lookup function.
+func evaluateCondition(condition string, lookup conditionLookup) (bool, error) {
+	tokens, err := tokenizeCondition(condition)
+	if err != nil {
+		return false, err
+	}
+
+	parser := &conditionParser{tokens: tokens, lookup: lookup}
+
+	result, err := parser.parseOr()
+	if err != nil {
+		return false, err
+	}
+
+	if parser.pos < len(parser.tokens) {
+		return false, fmt.Errorf("unexpected %q", parser.tokens[parser.pos].value)
+	}
+
+	return result, nil
+}
+
+// peekOperator returns true if the next token is the provided operator.
+func (parser *conditionParser) peekOperator(operator string) bool {
+	if parser.pos >= len(parser.tokens) {
+		return false
+	}
+
+	token := parser.tokens[parser.pos]
+
+	return token.kind == conditionTokenOperator && token.value == operator
+}
+
+// parseOr evaluates: and ("||" and)*
+func (parser *conditionParser) parseOr() (bool, error) {
+	result, err := parser.parseAnd()
+	if err != nil {
+		return false, err
+	}
+
+	for parser.peekOperator("||") {
+		parser.pos++
+
+		right, err := parser.parseAnd()
+		if err != nil {
+			return false, err
+		}
+
+		result = result || right
+	}
+
+	return result, nil
+}
+
+// parseAnd evaluates: unary ("&&" unary)*
+func (parser *conditionParser) parseAnd() (bool, error) {
+	result, err := parser.parseUnary()
+	if err != nil {
+		return false, err
+	}
+
+	for parser.peekOperator("&&") {
+		parser.pos++
+
+		right, err := parser.parseUnary()
+		if err != nil {
+			return false, err
+		}
+
+		result = result && right
+	}
+
+	return result, nil
+}
+
+// parseUnary evaluates: "!" unary | "(" or ")" | comparison
+func (parser *conditionParser) parseUnary() (bool, error) {
+	if parser.peekOperator("!") {
+		parser.pos++
+
+		result, err := parser.parseUnary()
+
+		return !result, err
+	}
+
+	if parser.peekOperator("(") {
+		parser.pos++
+
+		result, err := parser.parseOr()
+		if err != nil {
+			return false, err
+		}
+
+		if !parser.peekOperator(")") {
+			return false, fmt.Errorf("missing closing parenthesis")
+		}
+		parser.pos++
+
+		return result, nil
+	}
+
+	return parser.parseComparison()
+}
+
+// parseComparison evaluates: operand (("==" | "!=") operand)?
+func (parser *conditionParser) parseComparison() (bool, error) {
+	left, err := parser.nextOperand()
+	if err != nil {
+		return false, err
+	}
+
+	var operator string
+	switch {
+	case parser.peekOperator("=="), parser.peekOperator("!="):
+		operator = parser.tokens[parser.pos].value
+		parser.pos++
+	case left.kind == conditionTokenString:
+		return false, fmt.Errorf("expected comparison after '%s'", left.value)
+	default:
+		value, defined, err := parser.lookup(left.value)
+		if err != nil {
+			return false, err
+		}
+
+		return defined && value != "" && value != "false" && value != "0", nil
+	}
+
+	right, err := parser.nextOperand()
+	if err != nil {
+		return false, err
+	}
+
+	leftValue, err := parser.operandValue(left)
+	if err != nil {
+		return false, err
+	}
+
+	rightValue, err := parser.operandValue(right)
+	if err != nil {
+		return false, err
+	}
+
+	return (leftValue == rightValue) == (operator == "=="), nil
+}
+
+// nextOperand consumes the next token, which must be a name or a string literal.
+func (parser *conditionParser) nextOperand() (conditionToken, error) {
+	if parser.pos >= len(parser.tokens) {
+		return conditionToken{}, fmt.Errorf("unexpected end of condition")
+	}
+
+	token := parser.tokens[parser.pos]
+	if token.kind == conditionTokenOperator {
+		return conditionToken{}, fmt.Errorf("unexpected %q", token.value)
+	}
+
+	parser.pos++
+
+	return token, nil
+}
+
+// operandValue returns value of the operand used in a comparison.
+// Comparing with undefined names is an error to catch typos, which would otherwise silently skip items.
+func (parser *conditionParser) operandValue(operand conditionToken) (string, error) {
+	if operand.kind == conditionTokenString {
+		return operand.value, nil
+	}
+
+	value, defined, err := parser.lookup(operand.value)
+	if err != nil {
+		return "", err
+	}
+
+	if !defined {
+		return "", fmt.Errorf("unknown fact or parameter %s", operand.value)
+	}
+
+	return value, nil
+}
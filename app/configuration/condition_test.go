@@ -0,0 +1,121 @@
+// Copyright 2023 qbee.io
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package configuration
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"go.qbee.io/agent/app/utils/assert"
+)
+
+func Test_evaluateCondition(t *testing.T) {
+	facts := map[string]string{
+		"sys.arch":   "aarch64",
+		"sys.flavor": "debian",
+		"gateway":    "true",
+		"disabled":   "false",
+		"empty":      "",
+	}
+
+	lookup := func(name string) (string, bool, error) {
+		if name == "broken" {
+			return "", false, fmt.Errorf("broken parameter")
+		}
+
+		value, defined := facts[name]
+		return value, defined, nil
+	}
+
+	tests := []struct {
+		name      string
+		condition string
+		want      bool
+		wantErr   string
+	}{
+		{name: "equal", condition: "sys.arch == 'aarch64'", want: true},
+		{name: "equal double quotes", condition: `sys.arch == "aarch64"`, want: true},
+		{name: "not equal", condition: "sys.arch != 'aarch64'", want: false},
+		{name: "literal on the left", condition: "'debian' == sys.flavor", want: true},
+		{name: "tag set", condition: "gateway", want: true},
+		{name: "tag false", condition: "disabled", want: false},
+		{name: "tag empty", condition: "empty", want: false},
+		{name: "tag undefined", condition: "undefined", want: false},
+		{name: "negation", condition: "!gateway", want: false},
+		{name: "negated comparison", condition: "!(sys.arch == 'x86_64')", want: true},
+		{name: "and", condition: "sys.arch == 'aarch64' && sys.flavor == 'yocto'", want: false},
+		{name: "or", condition: "sys.arch == 'x86_64' || sys.flavor == 'debian'", want: true},
+		{name: "and before or", condition: "gateway || disabled && undefined", want: true},
+		{name: "parentheses", condition: "(gateway || disabled) && undefined", want: false},
+		{name: "compare with undefined", condition: "sys.archh == 'aarch64'", wantErr: "unknown fact or parameter sys.archh"},
+		{name: "lookup error", condition: "broken == 'x'", wantErr: "broken parameter"},
+		{name: "unterminated string", condition: "sys.arch == 'aarch64", wantErr: "unterminated string at position 12"},
+		{name: "unexpected character", condition: "sys.arch = 'aarch64'", wantErr: "unexpected character '=' at position 9"},
+		{name: "missing operand", condition: "sys.arch ==", wantErr: "unexpected end of condition"},
+		{name: "missing parenthesis", condition: "(gateway", wantErr: "missing closing parenthesis"},
+		{name: "trailing tokens", condition: "gateway gateway", wantErr: `unexpected "gateway"`},
+		{name: "literal only", condition: "'aarch64'", wantErr: "expected comparison after 'aarch64'"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := evaluateCondition(tt.condition, lookup)
+			if tt.wantErr != "" {
+				if err == nil {
+					t.Fatalf("expected error %q", tt.wantErr)
+				}
+				assert.Equal(t, err.Error(), tt.wantErr)
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			assert.Equal(t, got, tt.want)
+		})
+	}
+}
+
+func TestCheckCondition(t *testing.T) {
+	parameters := &ParametersBundle{
+		Parameters: []Parameter{{Key: "gateway", Value: "true"}},
+	}
+	ctx := parameters.Context(context.Background(), nil)
+
+	met, err := CheckCondition(ctx, "")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	assert.Equal(t, met, true)
+
+	met, err = CheckCondition(ctx, "gateway && sys.host != ''")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	assert.Equal(t, met, true)
+}
+
+func Test_conditionMet_Invalid(t *testing.T) {
+	reporter := NewReporter("", false, nil)
+	ctx := reporter.BundleContext(context.Background(), "", "")
+	ctx = new(ParametersBundle).Context(ctx, nil)
+
+	assert.Equal(t, conditionMet(ctx, "sys.arch =="), false)
+	assert.Equal(t, len(reporter.reports), 1)
+	assert.Equal(t, reporter.reports[0].Text, "Invalid condition 'sys.arch =='")
+}
@@ -35,6 +35,8 @@ const (
 	BundleRauc                 = "rauc"
 	BundleMetricsMonitor       = "metrics_monitor"
 	BundleDockerCompose        = "docker_compose"
+	BundleHosts                = "hosts"
+	BundleScheduledJobs        = "scheduled_jobs"
 )
 
 // CommittedConfig contains the configuration that is committed.
@@ -50,6 +52,12 @@ type CommittedConfig struct {
 
 	// EdgeURL is the URL of the edge server the agent should connect to enable remote access.
 	EdgeURL string `json:"edge_url"`
+
+	// Signature is a base64-encoded signature of the configuration payload (see verifyConfigSignature).
+	Signature string `json:"signature,omitempty"`
+
+	// payload is the raw configuration payload as received from the device hub.
+	payload []byte
 }
 
 // HasBundle returns true if bundleName is set in the Bundles list.
@@ -98,6 +106,10 @@ func (cc *CommittedConfig) selectBundleByName(bundleName string) Bundle {
 		return cc.BundleData.MetricsMonitor
 	case BundleDockerCompose:
 		return cc.BundleData.DockerCompose
+	case BundleHosts:
+		return cc.BundleData.Hosts
+	case BundleScheduledJobs:
+		return cc.BundleData.ScheduledJobs
 	default:
 		return nil
 	}
@@ -119,6 +131,8 @@ type BundleData struct {
 	NTP                  *NTPBundle                  `json:"ntp,omitempty"`
 	Parameters           *ParametersBundle           `json:"parameters,omitempty"`
 	MetricsMonitor       *MetricsMonitorBundle       `json:"metrics_monitor,omitempty"`
+	Hosts                *HostsBundle                `json:"hosts,omitempty"`
+	ScheduledJobs        *ScheduledJobsBundle        `json:"scheduled_jobs,omitempty"`
 
 	// Software
 	SoftwareManagement *SoftwareManagementBundle `json:"software_management,omitempty"`
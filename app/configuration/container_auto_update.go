@@ -0,0 +1,109 @@
+// Copyright 2023 qbee.io
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package configuration
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"strings"
+
+	"go.qbee.io/agent/app/utils"
+)
+
+// autoUpdated returns true if the container's image tag should be checked for new digests.
+func (c Container) autoUpdated() bool {
+	if !c.AutoUpdate || c.ContainerRuntime != podmanRuntimeType {
+		return false
+	}
+
+	_, _, pinned := strings.Cut(c.Image, "@")
+
+	return !pinned
+}
+
+// latestImageDigest checks the registry for the current digest of the container's image tag.
+// Pulling an unchanged tag only fetches its manifest, so layers are downloaded only when the digest changes.
+// Returns an empty string when the container is not auto-updated or the registry cannot be reached,
+// in which case the locally available image is used.
+func (c Container) latestImageDigest(ctx context.Context, containerBin string) string {
+	if !c.autoUpdated() {
+		return ""
+	}
+
+	previousDigest := c.localImageDigest(ctx, containerBin)
+
+	output, err := utils.RunCommand(ctx, []string{containerBin, "pull", "--quiet", c.Image})
+	if err != nil {
+		ReportWarning(ctx, err, "Unable to check registry for updates of image %s.", c.Image)
+		return ""
+	}
+
+	digest := c.localImageDigest(ctx, containerBin)
+	if digest == "" {
+		err = fmt.Errorf("cannot determine digest of image %s", c.Image)
+		ReportWarning(ctx, err, "Unable to check registry for updates of image %s.", c.Image)
+		return ""
+	}
+
+	if previousDigest != "" && digest != previousDigest {
+		reportChange(ctx, output, "Pulled image %s with digest %s.", c.Image, digest)
+	}
+
+	return digest
+}
+
+// localImageDigest returns digest of the locally available container's image or an empty string if it's not available.
+func (c Container) localImageDigest(ctx context.Context, containerBin string) string {
+	cmd := []string{containerBin, "image", "inspect", "--format", "{{.Digest}}", c.Image}
+
+	output, err := utils.RunCommand(ctx, cmd)
+	if err != nil {
+		return ""
+	}
+
+	return string(bytes.TrimSpace(output))
+}
+
+// inspectImageDigest records digest of the image used by the existing container in its info.
+func (c Container) inspectImageDigest(ctx context.Context, containerBin string, container *containerInfo) error {
+	cmd := []string{containerBin, "container", "inspect", "--format", "{{.ImageDigest}}", container.ID}
+
+	output, err := utils.RunCommand(ctx, cmd)
+	if err != nil {
+		return err
+	}
+
+	container.ImageDigest = string(bytes.TrimSpace(output))
+
+	return nil
+}
+
+// imageDigestMatch returns true if the existing container uses image with the provided digest.
+// Digest is not tracked when it's empty (container not auto-updated).
+func (c Container) imageDigestMatch(ctx context.Context, containerBin string, container *containerInfo, digest string) bool {
+	if digest == "" {
+		return true
+	}
+
+	if err := c.inspectImageDigest(ctx, containerBin, container); err != nil {
+		ReportWarning(ctx, err, "Cannot check image digest of container for image %s.", c.Image)
+		return true
+	}
+
+	return container.ImageDigest == digest
+}
@@ -28,7 +28,10 @@ import (
 	"os"
 	"os/user"
 	"path/filepath"
+	"regexp"
+	"sort"
 	"strings"
+	"time"
 
 	"go.qbee.io/agent/app/log"
 	"go.qbee.io/agent/app/utils"
@@ -37,6 +40,28 @@ import (
 const dockerRuntimeType = "docker"
 const podmanRuntimeType = "podman"
 
+// Supported container image pull policies.
+const (
+	pullPolicyAlways  = "always"
+	pullPolicyMissing = "missing"
+	pullPolicyNever   = "never"
+)
+
+// defaultContainerLogTailLines is the number of container log lines attached to failure reports by default.
+const defaultContainerLogTailLines = 50
+
+// containerIDLabel is the label identifying containers started by the agent (holds the configured container name).
+const containerIDLabel = "qbee-docker-id"
+
+// containerImageIDLabel is the label holding local ID of the image used to start the container.
+const containerImageIDLabel = "qbee-docker-image-id"
+
+// restartPolicyRE matches restart policies supported by docker and podman.
+var restartPolicyRE = regexp.MustCompile(`^(no|always|unless-stopped|on-failure(:[0-9]+)?)$`)
+
+// imageDigestRE matches image digest of an image reference pinned by digest (e.g. "debian@sha256:...").
+var imageDigestRE = regexp.MustCompile(`^sha256:[a-f0-9]{64}$`)
+
 // Container defines a docker container instance.
 type Container struct {
 	// ContainerRuntime defines the container runtime to be used.
@@ -54,6 +79,9 @@ type Container struct {
 	// EnvFile defines an env file (from file manager) to be used inside container.
 	EnvFile string `json:"env_file"`
 
+	// Env defines environment variables (--env) to be set inside container.
+	Env map[string]string `json:"env,omitempty"`
+
 	// Command to be executed in the container.
 	Command string `json:"command"`
 
@@ -62,6 +90,136 @@ type Container struct {
 
 	// SkipRestart defines whether the container should be restarted if it's stopped
 	SkipRestart bool `json:"skip_restart,omitempty"`
+
+	// SecurityOpts defines security options (--security-opt) for the container (e.g. "no-new-privileges").
+	SecurityOpts []string `json:"security_opts,omitempty"`
+
+	// CapAdd defines Linux capabilities to add to the container (--cap-add).
+	CapAdd []string `json:"cap_add,omitempty"`
+
+	// CapDrop defines Linux capabilities to drop from the container (--cap-drop).
+	CapDrop []string `json:"cap_drop,omitempty"`
+
+	// ReadOnly mounts the container's root filesystem as read only (--read-only).
+	ReadOnly bool `json:"read_only,omitempty"`
+
+	// UserNS defines user namespace to use for the container (--userns).
+	UserNS string `json:"userns,omitempty"`
+
+	// PullPolicy defines when the image should be pulled before starting the container:
+	// - always - image is pulled on every run,
+	// - missing - image is pulled only when it's not available locally,
+	// - never - image is never pulled and must be available locally.
+	// When not set, image is pulled by the container runtime only if it's missing (without tracking image changes).
+	PullPolicy string `json:"pull_policy,omitempty"`
+
+	// RestartPolicy defines the restart policy of the container runtime (--restart):
+	// no, always, unless-stopped, on-failure or on-failure:<max-retries>.
+	// It overrides --restart set in docker_args.
+	// With always or unless-stopped policy (set here or in docker_args), the agent doesn't restart exited containers,
+	// but still restarts them on configuration or image changes. With on-failure policy, the agent restarts
+	// containers which exited cleanly or exhausted their retries.
+	RestartPolicy string `json:"restart_policy,omitempty"`
+
+	// AutoUpdate defines whether the image tag is checked for a new digest in the registry on every run (podman only).
+	// When the digest of the tag changes, the new image is pulled and the container is restarted with it.
+	// Images pinned by digest (e.g. "debian@sha256:...") are not checked.
+	AutoUpdate bool `json:"auto_update,omitempty"`
+
+	// LogTailLines defines how many lines of container logs are attached to failure reports (set by the bundle).
+	LogTailLines int `json:"-"`
+}
+
+// validate checks whether container's image reference and pull policy are valid.
+func (c Container) validate() error {
+	switch c.PullPolicy {
+	case "", pullPolicyAlways, pullPolicyMissing, pullPolicyNever:
+	default:
+		return fmt.Errorf("unsupported pull policy: %s", c.PullPolicy)
+	}
+
+	if _, digest, pinned := strings.Cut(c.Image, "@"); pinned && !imageDigestRE.MatchString(digest) {
+		return fmt.Errorf("invalid image digest: %s", digest)
+	}
+
+	for name := range c.Env {
+		if name == "" || strings.Contains(name, "=") {
+			return fmt.Errorf("invalid environment variable name: %q", name)
+		}
+	}
+
+	if c.RestartPolicy != "" && !restartPolicyRE.MatchString(c.RestartPolicy) {
+		return fmt.Errorf("unsupported restart policy: %s", c.RestartPolicy)
+	}
+
+	if c.AutoUpdate && c.ContainerRuntime != podmanRuntimeType {
+		return fmt.Errorf("auto update is only supported for podman containers")
+	}
+
+	if c.AutoUpdate && c.PullPolicy == pullPolicyNever {
+		return fmt.Errorf("auto update cannot be used with pull policy %s", pullPolicyNever)
+	}
+
+	return nil
+}
+
+// restartPolicy returns restart policy of the container, as defined by RestartPolicy or --restart in Args.
+func (c Container) restartPolicy() string {
+	if c.RestartPolicy != "" {
+		return c.RestartPolicy
+	}
+
+	args, err := utils.ParseCommandLine(c.Args)
+	if err != nil {
+		return ""
+	}
+
+	policy := ""
+	for i, arg := range args {
+		if value, found := strings.CutPrefix(arg, "--restart="); found {
+			policy = value
+		} else if arg == "--restart" && i+1 < len(args) {
+			policy = args[i+1]
+		}
+	}
+
+	return policy
+}
+
+// withoutRestartArgs returns provided command line arguments with --restart option removed.
+func withoutRestartArgs(args []string) []string {
+	filtered := make([]string, 0, len(args))
+
+	for i := 0; i < len(args); i++ {
+		if strings.HasPrefix(args[i], "--restart=") {
+			continue
+		}
+
+		if args[i] == "--restart" {
+			i++
+			continue
+		}
+
+		filtered = append(filtered, args[i])
+	}
+
+	return filtered
+}
+
+// runtimeRestarts returns true when the container runtime is responsible for restarting exited container.
+// Containers with on-failure policy are not restarted by the runtime after a clean exit or exhausted retries,
+// so they are left to the runtime only while it's restarting them.
+func (c Container) runtimeRestarts(container *containerInfo) bool {
+	if strings.EqualFold(container.State, "restarting") {
+		return true
+	}
+
+	switch c.restartPolicy() {
+	case "always", "unless-stopped":
+		return true
+	default:
+		return false
+	}
 }
 
 // execute ensures that configured container is running
@@ -69,6 +227,11 @@ func (c Container) execute(ctx context.Context, srv *Service, containerBin strin
 	var err error
 	var needRestart bool
 
+	if err = c.validate(); err != nil {
+		ReportError(ctx, err, "Invalid configuration for image %s.", c.Image)
+		return err
+	}
+
 	if !CheckPreCondition(ctx, c.PreCondition) {
 		// skip container if pre-condition is not met
 		return nil
@@ -87,9 +250,14 @@ func (c Container) execute(ctx context.Context, srv *Service, containerBin strin
 		return err
 	}
 
+	var imageID, imageDigest string
+	if imageID, imageDigest, err = c.ensureImage(ctx, containerBin); err != nil {
+		return err
+	}
+
 	// start a new container if it doesn't exist
 	if !container.exists() {
-		return c.run(ctx, srv, containerBin)
+		return c.run(ctx, srv, containerBin, imageID)
 	}
 
 	if c.SkipRestart {
@@ -101,19 +269,92 @@ func (c Container) execute(ctx context.Context, srv *Service, containerBin strin
 		return err
 	}
 
-	if !container.isRunning() {
-		ReportWarning(ctx, nil, "Container exited for image %s.", c.Image)
+	// exited containers with a restart policy are left to the container runtime
+	if !container.isRunning() && !c.runtimeRestarts(container) {
+		ReportWarning(ctx, c.logs(ctx, containerBin, container.ID), "Container exited for image %s.", c.Image)
 		needRestart = true
 	} else if !container.argsMatch(args) {
 		ReportWarning(ctx, nil, "Container configuration update detected for image %s.", c.Image)
 		needRestart = true
+	} else if !container.imageMatch(imageID) {
+		ReportWarning(ctx, nil, "Container image update detected for image %s.", c.Image)
+		needRestart = true
+	} else if !c.imageDigestMatch(ctx, containerBin, container, imageDigest) {
+		ReportWarning(ctx, nil, "New digest %s detected for image %s.", imageDigest, c.Image)
+		needRestart = true
+	}
+
+	// restarting running containers is deferred until the maintenance window
+	if container.isRunning() {
+		needRestart = srv.restartAllowed(ctx, "container:"+c.Name, needRestart)
 	}
 
 	if !needRestart {
 		return nil
 	}
 
-	return c.restart(ctx, srv, containerBin, container.ID)
+	return c.restart(ctx, srv, containerBin, container.ID, imageID)
+}
+
+// ensureImage makes sure that container's image is available locally and checks auto-updated images for new digests.
+// Returns local image ID (empty when pull policy is not set) and image digest (empty when digest is not tracked).
+func (c Container) ensureImage(ctx context.Context, containerBin string) (string, string, error) {
+	imageID, err := c.pullImage(ctx, containerBin)
+	if err != nil {
+		return "", "", err
+	}
+
+	digest := c.latestImageDigest(ctx, containerBin)
+
+	// auto-update might have pulled a new image for the tag
+	if imageID != "" && digest != "" {
+		imageID = c.localImageID(ctx, containerBin)
+	}
+
+	return imageID, digest, nil
+}
+
+// pullImage makes sure that container's image is available locally according to the pull policy.
+// Returns local image ID, or an empty string when pull policy is not set.
+func (c Container) pullImage(ctx context.Context, containerBin string) (string, error) {
+	if c.PullPolicy == "" {
+		return "", nil
+	}
+
+	imageID := c.localImageID(ctx, containerBin)
+
+	if c.PullPolicy == pullPolicyAlways || (c.PullPolicy == pullPolicyMissing && imageID == "") {
+		output, err := utils.RunCommand(ctx, []string{containerBin, "pull", c.Image})
+		if err != nil {
+			ReportError(ctx, err, "Unable to pull image %s.", c.Image)
+			return "", err
+		}
+
+		previousImageID := imageID
+		if imageID = c.localImageID(ctx, containerBin); imageID != previousImageID {
+			reportChange(ctx, output, "Pulled image %s.", c.Image)
+		}
+	}
+
+	if imageID == "" {
+		err := fmt.Errorf("image %s is not available locally", c.Image)
+		ReportError(ctx, err, "Image %s is not available locally (pull policy: %s).", c.Image, c.PullPolicy)
+		return "", err
+	}
+
+	return imageID, nil
+}
+
+// localImageID returns ID of the locally available container's image or an empty string if it's not available.
+func (c Container) localImageID(ctx context.Context, containerBin string) string {
+	cmd := []string{containerBin, "image", "inspect", "--format", "{{.Id}}", c.Image}
+
+	output, err := utils.RunCommand(ctx, cmd)
+	if err != nil {
+		return ""
+	}
+
+	return string(bytes.TrimSpace(output))
 }
 
 // args returns docker cli command line arguments needed to launch the container.
@@ -127,11 +368,21 @@ func (c Container) args(srv *Service) ([]string, error) {
 		args = append(args, "--env-file", envFilePath)
 	}
 
+	args = append(args, c.envArgs()...)
+
+	args = append(args, c.securityArgs()...)
+
 	extraArgs, err := utils.ParseCommandLine(c.Args)
 	if err != nil {
 		return nil, err
 	}
 
+	// restart policy field overrides the one in args, so only one --restart option is passed to the runtime
+	if c.RestartPolicy != "" {
+		args = append(args, "--restart", c.RestartPolicy)
+		extraArgs = withoutRestartArgs(extraArgs)
+	}
+
 	if len(extraArgs) != 0 {
 		args = append(args, extraArgs...)
 	}
@@ -149,6 +400,65 @@ func (c Container) args(srv *Service) ([]string, error) {
 	return args, nil
 }
 
+// resolveContainerEnv returns a copy of container's environment variables with parameters resolved in their values.
+func resolveContainerEnv(ctx context.Context, env map[string]string) map[string]string {
+	if len(env) == 0 {
+		return nil
+	}
+
+	resolved := make(map[string]string, len(env))
+	for name, value := range env {
+		resolved[name] = resolveParameters(ctx, value)
+	}
+
+	return resolved
+}
+
+// envArgs returns docker cli command line arguments for container's environment variables.
+// Variables are sorted by name, so the arguments (and their checksum) are stable between runs.
+func (c Container) envArgs() []string {
+	names := make([]string, 0, len(c.Env))
+	for name := range c.Env {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	args := make([]string, 0, 2*len(names))
+	for _, name := range names {
+		args = append(args, "--env", fmt.Sprintf("%s=%s", name, c.Env[name]))
+	}
+
+	return args
+}
+
+// securityArgs returns docker cli command line arguments for container's security settings.
+func (c Container) securityArgs() []string {
+	args := make([]string, 0)
+
+	for _, securityOpt := range c.SecurityOpts {
+		args = append(args, "--security-opt", securityOpt)
+	}
+
+	for _, capability := range c.CapAdd {
+		args = append(args, "--cap-add", capability)
+	}
+
+	for _, capability := range c.CapDrop {
+		args = append(args, "--cap-drop", capability)
+	}
+
+	if c.ReadOnly {
+		args = append(args, "--read-only")
+	}
+
+	if c.UserNS != "" {
+		args = append(args, "--userns", c.UserNS)
+	}
+
+	return args
+}
+
 // id returns container identifier base on its name.
 func (c Container) id() string {
 	return fmt.Sprintf("%x", sha256.Sum256([]byte(c.Name)))
@@ -169,25 +479,58 @@ func (c Container) localEnvFilePath(srv *Service) string {
 }
 
 // start a container
-func (c Container) run(ctx context.Context, srv *Service, containerBin string) error {
-	runCmd, err := c.getRunCommand(srv, containerBin)
+func (c Container) run(ctx context.Context, srv *Service, containerBin, imageID string) error {
+	runCmd, err := c.getRunCommand(srv, containerBin, imageID)
 	if err != nil {
 		return err
 	}
 
 	output, err := utils.RunCommand(ctx, runCmd)
 	if err != nil {
-		ReportError(ctx, err, "Unable to start container for image %s.", c.Image)
+		ReportError(ctx, c.withLogs(ctx, containerBin, err), "Unable to start container for image %s.", c.Image)
 		return err
 	}
 
-	ReportInfo(ctx, output, "Successfully started container for image %s.", c.Image)
+	reportChange(ctx, output, "Successfully started container for image %s.", c.Image)
 
 	return nil
 }
 
+// withLogs returns the error followed by the most recent logs of the container which failed to start.
+func (c Container) withLogs(ctx context.Context, containerBin string, err error) string {
+	return fmt.Sprintf("%v\n%s", err, c.logs(ctx, containerBin, c.Name))
+}
+
+// logs returns the most recent logs of the container identified by containerRef (name or ID).
+// When logs cannot be retrieved (e.g. container no longer exists), the reason is returned instead.
+func (c Container) logs(ctx context.Context, containerBin, containerRef string) string {
+	tailLines := c.LogTailLines
+	if tailLines <= 0 {
+		tailLines = defaultContainerLogTailLines
+	}
+
+	cmd := []string{containerBin, "logs", "--tail", fmt.Sprintf("%d", tailLines), containerRef}
+
+	// container logs are written to both stdout and stderr, depending on the container's output stream
+	command := utils.NewCommand(ctx, cmd)
+
+	start := time.Now()
+	output, err := command.CombinedOutput()
+	utils.TraceCommand(ctx, command, start)
+	if err != nil {
+		if strings.Contains(strings.ToLower(string(output)), "no such container") {
+			return fmt.Sprintf("Container %s no longer exists, logs are not available.", containerRef)
+		}
+
+		return fmt.Sprintf("Unable to get container logs: %v\n%s", err, output)
+	}
+
+	return fmt.Sprintf("Container logs (last %d lines):\n%s", tailLines, output)
+}
+
 // getRunCommand returns run command string for the container.
-func (c Container) getRunCommand(srv *Service, containerBin string) ([]string, error) {
+// When imageID is provided, it's recorded as a container label to detect image updates.
+func (c Container) getRunCommand(srv *Service, containerBin, imageID string) ([]string, error) {
 	args, err := c.args(srv)
 
 	if err != nil {
@@ -197,10 +540,14 @@ func (c Container) getRunCommand(srv *Service, containerBin string) ([]string, e
 	runCmd := []string{
 		containerBin, "run",
 		"--detach",
-		"--label", fmt.Sprintf("qbee-docker-id=%s", c.Name),
+		"--label", fmt.Sprintf("%s=%s", containerIDLabel, c.Name),
 		"--label", fmt.Sprintf("qbee-docker-args-sha=%x", sha256.Sum256([]byte(strings.Join(args, " ")))),
 	}
 
+	if imageID != "" {
+		runCmd = append(runCmd, "--label", fmt.Sprintf("%s=%s", containerImageIDLabel, imageID))
+	}
+
 	return append(runCmd, args...), nil
 }
 
@@ -211,7 +558,7 @@ func (c Container) kill(ctx context.Context, containerID, containerBin string) {
 	}
 	// Attempt to forcefully kill the container
 	if _, err := utils.RunCommand(ctx, cmd); err != nil {
-		log.Errorf("Failed to kill container %s: %w", containerID, err)
+		log.Errorf("Failed to kill container %s: %v", containerID, err)
 	}
 
 	// TODO: check if container is still present after kill
@@ -221,14 +568,14 @@ func (c Container) kill(ctx context.Context, containerID, containerBin string) {
 
 	// Attempt to remove the container
 	if _, err := utils.RunCommand(ctx, cmd); err != nil {
-		log.Errorf("Failed to remove container %s: %w", containerID, err)
+		log.Errorf("Failed to remove container %s: %v", containerID, err)
 	}
 }
 
 // restart an existing container
-func (c Container) restart(ctx context.Context, srv *Service, containerBin, containerID string) error {
+func (c Container) restart(ctx context.Context, srv *Service, containerBin, containerID, imageID string) error {
 
-	runCmd, err := c.getRunCommand(srv, containerBin)
+	runCmd, err := c.getRunCommand(srv, containerBin, imageID)
 	if err != nil {
 		ReportError(ctx, err, "Unable to get run command for image %s.", c.Image)
 		return err
@@ -238,11 +585,11 @@ func (c Container) restart(ctx context.Context, srv *Service, containerBin, cont
 
 	output, err := utils.RunCommand(ctx, runCmd)
 	if err != nil {
-		ReportError(ctx, err, "Unable to restart container for image %s.", c.Image)
+		ReportError(ctx, c.withLogs(ctx, containerBin, err), "Unable to restart container for image %s.", c.Image)
 		return err
 	}
 
-	ReportInfo(ctx, output, "Successfully restarted container for image %s.", c.Image)
+	reportChange(ctx, output, "Successfully restarted container for image %s.", c.Image)
 
 	return nil
 }
@@ -251,6 +598,9 @@ type containerInfo struct {
 	ID     string            `json:"id"`
 	Labels map[string]string `json:"labels"`
 	State  string            `json:"state"`
+
+	// ImageDigest is the digest of the image used by the container (only inspected for auto-updated containers).
+	ImageDigest string `json:"image_digest,omitempty"`
 }
 
 // isRunning returns true if container is currently running.
@@ -282,6 +632,16 @@ func (ci *containerInfo) argsMatch(args []string) bool {
 	return false
 }
 
+// imageMatch returns true if container is running with the provided image ID.
+// Image is not tracked when the image ID is empty (no pull policy set).
+func (ci *containerInfo) imageMatch(imageID string) bool {
+	if imageID == "" {
+		return true
+	}
+
+	return ci.Labels[containerImageIDLabel] == imageID
+}
+
 // getStatus returns a status for
 func (c Container) getStatus(ctx context.Context, containerBin string) (*containerInfo, error) {
 
@@ -296,7 +656,7 @@ func (c Container) getStatus(ctx context.Context, containerBin string) (*contain
 		"container", "ls",
 		"--all",
 		"--no-trunc",
-		"--filter", fmt.Sprintf("label=qbee-docker-id=%s", c.Name),
+		"--filter", fmt.Sprintf("label=%s=%s", containerIDLabel, c.Name),
 		"--format", format,
 	}
 
@@ -428,14 +788,15 @@ func (a RegistryAuth) execute(ctx context.Context, dockerBin string) error {
 	}
 
 	// otherwise we need to add those credentials with login command
-	cmd := []string{dockerBin, "login", "--username", a.Username, "--password", a.Password, a.URL()}
-	output, err := utils.RunCommand(ctx, cmd)
+	// password is provided on stdin, so it's not visible in the process list
+	cmd := []string{dockerBin, "login", "--username", a.Username, "--password-stdin", a.URL()}
+	output, err := utils.RunCommandWithStdin(ctx, cmd, strings.NewReader(a.Password))
 	if err != nil {
 		ReportError(ctx, err, "Unable to authenticate with %s repository.", a.URL())
 		return err
 	}
 
-	ReportInfo(ctx, output, "Configured credentials for %s.", a.URL())
+	reportChange(ctx, output, "Configured credentials for %s.", a.URL())
 	return nil
 }
 
@@ -498,3 +859,161 @@ func (a RegistryAuth) getPodmanUserConfigFile() string {
 
 	return filepath.Join("/tmp", "podman-run-"+a.user.Uid, "containers", "auth.json")
 }
+
+// composeProjectLabel is the label set by compose on all containers belonging to a compose project.
+const composeProjectLabel = "com.docker.compose.project"
+
+// duplicateContainerNames returns names which are used by more than one container (in order of first appearance).
+func duplicateContainerNames(containers []Container) []string {
+	seen := make(map[string]int)
+	duplicates := make([]string, 0)
+
+	for _, container := range containers {
+		seen[container.Name]++
+
+		if seen[container.Name] == 2 {
+			duplicates = append(duplicates, container.Name)
+		}
+	}
+
+	return duplicates
+}
+
+// composeContainerNames returns a map of container name -> compose project name for containers managed by compose.
+func composeContainerNames(ctx context.Context, containerRuntime, containerBin string) (map[string]string, error) {
+	format := fmt.Sprintf(`{{.Names}}\t{{.Label "%s"}}`, composeProjectLabel)
+
+	if containerRuntime == podmanRuntimeType {
+		format = fmt.Sprintf(`{{.Names}}\t{{index .Labels "%s"}}`, composeProjectLabel)
+	}
+
+	cmd := []string{
+		containerBin,
+		"container", "ls",
+		"--all",
+		"--filter", fmt.Sprintf("label=%s", composeProjectLabel),
+		"--format", format,
+	}
+
+	names := make(map[string]string)
+
+	err := utils.ForLinesInCommandOutput(ctx, cmd, func(line string) error {
+		fields := strings.SplitN(strings.TrimSpace(line), "\t", 2)
+		if len(fields) != 2 || fields[0] == "" {
+			return nil
+		}
+
+		names[fields[0]] = fields[1]
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return names, nil
+}
+
+// managedContainers returns a map of container ID -> configured container name for containers started by the agent.
+func managedContainers(ctx context.Context, containerRuntime, containerBin string) (map[string]string, error) {
+	format := fmt.Sprintf(`{{.ID}}\t{{.Label "%s"}}`, containerIDLabel)
+
+	if containerRuntime == podmanRuntimeType {
+		format = fmt.Sprintf(`{{.ID}}\t{{index .Labels "%s"}}`, containerIDLabel)
+	}
+
+	cmd := []string{
+		containerBin,
+		"container", "ls",
+		"--all",
+		"--no-trunc",
+		"--filter", fmt.Sprintf("label=%s", containerIDLabel),
+		"--format", format,
+	}
+
+	containers := make(map[string]string)
+
+	err := utils.ForLinesInCommandOutput(ctx, cmd, func(line string) error {
+		fields := strings.SplitN(strings.TrimSpace(line), "\t", 2)
+		if len(fields) != 2 || fields[0] == "" || fields[1] == "" {
+			return nil
+		}
+
+		containers[fields[0]] = fields[1]
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return containers, nil
+}
+
+// cleanOrphanedContainers stops and removes containers started by the agent, which are not defined in the bundle.
+// Only containers labelled by the agent are considered, so containers created by other means are never touched.
+func cleanOrphanedContainers(ctx context.Context, containerRuntime, containerBin string, containers []Container) error {
+	runningContainers, err := managedContainers(ctx, containerRuntime, containerBin)
+	if err != nil {
+		ReportError(ctx, err, "Unable to list containers started by the agent.")
+		return err
+	}
+
+	configuredNames := make(map[string]bool)
+	for _, container := range containers {
+		configuredNames[container.Name] = true
+	}
+
+	orphanIDs := make([]string, 0)
+	for containerID, name := range runningContainers {
+		if !configuredNames[name] {
+			orphanIDs = append(orphanIDs, containerID)
+		}
+	}
+
+	sort.Strings(orphanIDs)
+
+	for _, containerID := range orphanIDs {
+		name := runningContainers[containerID]
+
+		output, err := utils.RunCommand(ctx, []string{containerBin, "rm", "--force", containerID})
+		if err != nil {
+			ReportError(ctx, err, "Unable to remove orphaned container %s.", name)
+			return err
+		}
+
+		reportChange(ctx, output, "Removed orphaned container %s.", name)
+	}
+
+	return nil
+}
+
+// checkContainerNames reports an error when container names are not unique within the bundle
+// or when they collide with containers managed by compose projects.
+func checkContainerNames(ctx context.Context, containerRuntime, containerBin string, containers []Container) error {
+	if duplicates := duplicateContainerNames(containers); len(duplicates) > 0 {
+		names := strings.Join(duplicates, ", ")
+		ReportError(ctx, nil, "Duplicate container names found in configuration: %s", names)
+		return fmt.Errorf("duplicate container names: %s", names)
+	}
+
+	composeContainers, err := composeContainerNames(ctx, containerRuntime, containerBin)
+	if err != nil {
+		// compose containers cannot be resolved, so we skip the cross-check rather than block the bundle
+		log.Debugf("cannot list compose containers: %v", err)
+		return nil
+	}
+
+	conflicts := make([]string, 0)
+	for _, container := range containers {
+		if project, ok := composeContainers[container.Name]; ok {
+			conflicts = append(conflicts, fmt.Sprintf("%s (compose project %s)", container.Name, project))
+		}
+	}
+
+	if len(conflicts) > 0 {
+		names := strings.Join(conflicts, ", ")
+		ReportError(ctx, nil, "Container names conflict with compose projects: %s", names)
+		return fmt.Errorf("container names conflict with compose projects: %s", names)
+	}
+
+	return nil
+}
@@ -0,0 +1,225 @@
+// Copyright 2024 qbee.io
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package configuration
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"go.qbee.io/agent/app/utils/assert"
+)
+
+func TestContainer_validate(t *testing.T) {
+	digest := "sha256:" + strings.Repeat("a", 64)
+
+	tests := []struct {
+		name      string
+		container Container
+		wantErr   string
+	}{
+		{
+			name:      "tagged image",
+			container: Container{Image: "debian:bookworm"},
+		},
+		{
+			name:      "image pinned by digest",
+			container: Container{Image: "debian@" + digest, PullPolicy: pullPolicyMissing},
+		},
+		{
+			name:      "invalid digest",
+			container: Container{Image: "debian@sha256:abc"},
+			wantErr:   "invalid image digest: sha256:abc",
+		},
+		{
+			name:      "unsupported pull policy",
+			container: Container{Image: "debian", PullPolicy: "sometimes"},
+			wantErr:   "unsupported pull policy: sometimes",
+		},
+		{
+			name:      "restart policy with max retries",
+			container: Container{Image: "debian", RestartPolicy: "on-failure:3"},
+		},
+		{
+			name:      "unsupported restart policy",
+			container: Container{Image: "debian", RestartPolicy: "sometimes"},
+			wantErr:   "unsupported restart policy: sometimes",
+		},
+		{
+			name:      "podman auto update",
+			container: Container{Image: "debian", ContainerRuntime: podmanRuntimeType, AutoUpdate: true},
+		},
+		{
+			name:      "docker auto update",
+			container: Container{Image: "debian", ContainerRuntime: dockerRuntimeType, AutoUpdate: true},
+			wantErr:   "auto update is only supported for podman containers",
+		},
+		{
+			name:      "auto update without pulling",
+			container: Container{Image: "debian", ContainerRuntime: podmanRuntimeType, AutoUpdate: true, PullPolicy: "never"},
+			wantErr:   "auto update cannot be used with pull policy never",
+		},
+		{
+			name:      "invalid env variable name",
+			container: Container{Image: "debian", Env: map[string]string{"A=B": "value"}},
+			wantErr:   `invalid environment variable name: "A=B"`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.container.validate()
+			if tt.wantErr == "" {
+				assert.NoError(t, err)
+				return
+			}
+
+			if err == nil {
+				t.Fatalf("expected error %q, got nil", tt.wantErr)
+			}
+			assert.Equal(t, err.Error(), tt.wantErr)
+		})
+	}
+}
+
+func TestContainer_runtimeRestarts(t *testing.T) {
+	tests := []struct {
+		name      string
+		container Container
+		state     string
+		policy    string
+		restarts  bool
+	}{
+		{name: "no policy", container: Container{Args: "--rm"}},
+		{name: "policy field", container: Container{RestartPolicy: "always"}, policy: "always", restarts: true},
+		{name: "policy disabled", container: Container{RestartPolicy: "no"}, policy: "no"},
+		{name: "policy in args", container: Container{Args: "--restart=unless-stopped"}, policy: "unless-stopped", restarts: true},
+		{name: "separate policy arg", container: Container{Args: "-v /data:/data --restart on-failure"}, policy: "on-failure"},
+		{name: "on-failure while restarting", container: Container{RestartPolicy: "on-failure:3"}, state: "restarting", policy: "on-failure:3", restarts: true},
+		{name: "field overrides args", container: Container{Args: "--restart=always", RestartPolicy: "no"}, policy: "no"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.container.restartPolicy(), tt.policy)
+			assert.Equal(t, tt.container.runtimeRestarts(&containerInfo{State: tt.state}), tt.restarts)
+		})
+	}
+}
+
+func TestContainer_args_RestartPolicy(t *testing.T) {
+	container := Container{
+		Name:          "test",
+		Image:         "debian:stable",
+		Args:          "--restart=always -v /data:/data --restart always",
+		RestartPolicy: "no",
+	}
+
+	args, err := container.args(nil)
+	assert.NoError(t, err)
+
+	expectedArgs := []string{
+		"--name", "test",
+		"--restart", "no",
+		"-v", "/data:/data",
+		"debian:stable",
+	}
+	assert.Equal(t, args, expectedArgs)
+}
+
+func TestContainer_autoUpdated(t *testing.T) {
+	digest := "sha256:" + strings.Repeat("a", 64)
+
+	tests := []struct {
+		name      string
+		container Container
+		want      bool
+	}{
+		{name: "disabled", container: Container{Image: "debian:stable", ContainerRuntime: podmanRuntimeType}},
+		{name: "moving tag", container: Container{Image: "debian:stable", ContainerRuntime: podmanRuntimeType, AutoUpdate: true}, want: true},
+		{name: "pinned by digest", container: Container{Image: "debian@" + digest, ContainerRuntime: podmanRuntimeType, AutoUpdate: true}},
+		{name: "docker", container: Container{Image: "debian:stable", ContainerRuntime: dockerRuntimeType, AutoUpdate: true}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.container.autoUpdated(), tt.want)
+		})
+	}
+}
+
+func Test_containerInfo_imageMatch(t *testing.T) {
+	ci := &containerInfo{Labels: map[string]string{containerImageIDLabel: "sha256:abc"}}
+
+	assert.True(t, ci.imageMatch(""))
+	assert.True(t, ci.imageMatch("sha256:abc"))
+	assert.False(t, ci.imageMatch("sha256:def"))
+}
+
+func TestContainer_logs(t *testing.T) {
+	containerBin := filepath.Join(t.TempDir(), "docker")
+	script := `#!/bin/sh
+if [ "$4" = "missing" ]; then
+	echo "Error response from daemon: No such container: missing" >&2
+	exit 1
+fi
+echo "tail $3 of $4"
+echo "crash reason" >&2
+`
+	assert.NoError(t, os.WriteFile(containerBin, []byte(script), 0700))
+
+	ctx := context.Background()
+
+	t.Run("default tail", func(t *testing.T) {
+		logs := Container{}.logs(ctx, containerBin, "abc")
+		assert.Equal(t, logs, "Container logs (last 50 lines):\ntail 50 of abc\ncrash reason\n")
+	})
+
+	t.Run("configured tail", func(t *testing.T) {
+		logs := Container{LogTailLines: 5}.logs(ctx, containerBin, "abc")
+		assert.Equal(t, logs, "Container logs (last 5 lines):\ntail 5 of abc\ncrash reason\n")
+	})
+
+	t.Run("container no longer exists", func(t *testing.T) {
+		logs := Container{}.logs(ctx, containerBin, "missing")
+		assert.Equal(t, logs, "Container missing no longer exists, logs are not available.")
+	})
+}
+
+func TestContainer_args_Env(t *testing.T) {
+	container := Container{
+		Name:  "test",
+		Image: "debian:stable",
+		Env: map[string]string{
+			"B_VAR": "b value",
+			"A_VAR": "a=1",
+		},
+	}
+
+	args, err := container.args(nil)
+	assert.NoError(t, err)
+
+	expectedArgs := []string{
+		"--name", "test",
+		"--env", "A_VAR=a=1",
+		"--env", "B_VAR=b value",
+		"debian:stable",
+	}
+	assert.Equal(t, args, expectedArgs)
+}
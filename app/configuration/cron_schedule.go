@@ -0,0 +1,229 @@
+// Copyright 2023 qbee.io
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package configuration
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// cronScheduleMacros maps supported cron macros to their 5-field equivalents.
+var cronScheduleMacros = map[string]string{
+	"@hourly":   "0 * * * *",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@weekly":   "0 0 * * 0",
+	"@monthly":  "0 0 1 * *",
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+}
+
+// cronField defines allowed values of a cron schedule field.
+type cronField struct {
+	name string
+	min  int
+	max  int
+}
+
+// cronFields lists fields of a cron schedule in order.
+var cronFields = []cronField{
+	{name: "minute", min: 0, max: 59},
+	{name: "hour", min: 0, max: 23},
+	{name: "day of month", min: 1, max: 31},
+	{name: "month", min: 1, max: 12},
+	{name: "day of week", min: 0, max: 7},
+}
+
+// cronWeekdays maps cron day of week numbers to systemd weekday names (both 0 and 7 are Sunday).
+var cronWeekdays = []string{"Sun", "Mon", "Tue", "Wed", "Thu", "Fri", "Sat", "Sun"}
+
+// parseCronSchedule validates numeric cron schedule (e.g. "*/5 * * * 1-5") or a macro (e.g. "@daily")
+// and returns its 5 fields.
+func parseCronSchedule(schedule string) ([]string, error) {
+	schedule = strings.TrimSpace(schedule)
+
+	if strings.HasPrefix(schedule, "@") {
+		expanded, ok := cronScheduleMacros[schedule]
+		if !ok {
+			return nil, fmt.Errorf("unsupported schedule macro %q", schedule)
+		}
+		schedule = expanded
+	}
+
+	fields := strings.Fields(schedule)
+	if len(fields) != len(cronFields) {
+		return nil, fmt.Errorf("schedule %q must have %d fields", schedule, len(cronFields))
+	}
+
+	for i, field := range fields {
+		for _, item := range strings.Split(field, ",") {
+			if err := cronFields[i].validate(item); err != nil {
+				return nil, fmt.Errorf("invalid %s in schedule %q: %w", cronFields[i].name, schedule, err)
+			}
+		}
+	}
+
+	return fields, nil
+}
+
+// validate a single item of the field (*, */step, value, start-end or start-end/step).
+func (field cronField) validate(item string) error {
+	valueRange, step, hasStep := strings.Cut(item, "/")
+
+	if hasStep {
+		stepValue, err := strconv.Atoi(step)
+		if err != nil || stepValue < 1 || stepValue > field.max {
+			return fmt.Errorf("invalid step %q", step)
+		}
+	}
+
+	if valueRange == "*" {
+		return nil
+	}
+
+	start, end, isRange := strings.Cut(valueRange, "-")
+	if !isRange && hasStep {
+		return fmt.Errorf("step requires a range or * in %q", item)
+	}
+
+	startValue, err := field.parseValue(start)
+	if err != nil {
+		return err
+	}
+
+	if !isRange {
+		return nil
+	}
+
+	endValue, err := field.parseValue(end)
+	if err != nil {
+		return err
+	}
+
+	if startValue > endValue {
+		return fmt.Errorf("invalid range %q", valueRange)
+	}
+
+	return nil
+}
+
+// parseValue parses numeric value of the field and checks its bounds.
+func (field cronField) parseValue(value string) (int, error) {
+	number, err := strconv.Atoi(value)
+	if err != nil || number < field.min || number > field.max {
+		return 0, fmt.Errorf("value %q out of range %d-%d", value, field.min, field.max)
+	}
+
+	return number, nil
+}
+
+// cronToCalendar converts a cron schedule to systemd calendar event expression (OnCalendar).
+// Ranges with steps are not supported and restricting both day of month and day of week is rejected,
+// since systemd requires both to match while cron runs the job when either of them matches.
+func cronToCalendar(schedule string) (string, error) {
+	fields, err := parseCronSchedule(schedule)
+	if err != nil {
+		return "", err
+	}
+
+	dayOfMonth, dayOfWeek := fields[2], fields[4]
+
+	if dayOfMonth != "*" && dayOfWeek != "*" {
+		return "", fmt.Errorf("schedule %q restricts both day of month and day of week", schedule)
+	}
+
+	converted := make([]string, 0, len(fields))
+
+	for i, field := range fields[:4] {
+		var value string
+		if value, err = calendarField(field, cronFields[i].min); err != nil {
+			return "", fmt.Errorf("cannot convert schedule %q: %w", schedule, err)
+		}
+		converted = append(converted, value)
+	}
+
+	calendar := fmt.Sprintf("*-%s-%s %s:%s:00", converted[3], converted[2], converted[1], converted[0])
+
+	if dayOfWeek == "*" {
+		return calendar, nil
+	}
+
+	weekdays := make([]string, 0)
+	for _, item := range strings.Split(dayOfWeek, ",") {
+		if strings.Contains(item, "/") {
+			return "", fmt.Errorf("cannot convert schedule %q: steps are not supported for day of week", schedule)
+		}
+
+		start, end, isRange := strings.Cut(item, "-")
+		startValue, _ := strconv.Atoi(start)
+
+		if !isRange {
+			weekdays = append(weekdays, cronWeekdays[startValue])
+			continue
+		}
+
+		endValue, _ := strconv.Atoi(end)
+		weekdays = append(weekdays, calendarWeekdayRange(startValue, endValue)...)
+	}
+
+	return strings.Join(weekdays, ",") + " " + calendar, nil
+}
+
+// calendarField converts a numeric cron field into systemd calendar syntax (e.g. "*/5" -> "0/5", "1-5" -> "1..5").
+func calendarField(field string, first int) (string, error) {
+	items := make([]string, 0)
+
+	for _, item := range strings.Split(field, ",") {
+		valueRange, step, hasStep := strings.Cut(item, "/")
+
+		switch {
+		case valueRange == "*" && hasStep:
+			items = append(items, fmt.Sprintf("%d/%s", first, step))
+		case valueRange == "*":
+			items = append(items, "*")
+		case hasStep:
+			return "", fmt.Errorf("ranges with steps are not supported")
+		default:
+			items = append(items, strings.Replace(valueRange, "-", "..", 1))
+		}
+	}
+
+	return strings.Join(items, ","), nil
+}
+
+// calendarWeekdayRange converts cron day of week range to systemd weekdays.
+// systemd weeks start on Monday, so Sunday (0 or 7) at the edges of the range is listed separately.
+func calendarWeekdayRange(start, end int) []string {
+	weekdays := make([]string, 0)
+
+	if start == 0 || end == 7 {
+		weekdays = append(weekdays, cronWeekdays[0])
+	}
+
+	start = max(start, 1)
+	end = min(end, 6)
+
+	switch {
+	case start == end:
+		weekdays = append(weekdays, cronWeekdays[start])
+	case start < end:
+		weekdays = append(weekdays, cronWeekdays[start]+".."+cronWeekdays[end])
+	}
+
+	return weekdays
+}
@@ -0,0 +1,91 @@
+// Copyright 2023 qbee.io
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package configuration
+
+import (
+	"testing"
+
+	"go.qbee.io/agent/app/utils/assert"
+)
+
+func Test_parseCronSchedule(t *testing.T) {
+	tests := []struct {
+		name     string
+		schedule string
+		want     []string
+		wantErr  bool
+	}{
+		{name: "every minute", schedule: "* * * * *", want: []string{"*", "*", "*", "*", "*"}},
+		{name: "steps, ranges and lists", schedule: "*/15 8-18 1,15 * 1-5", want: []string{"*/15", "8-18", "1,15", "*", "1-5"}},
+		{name: "range with step", schedule: "0 8-18/2 * * *", want: []string{"0", "8-18/2", "*", "*", "*"}},
+		{name: "macro", schedule: "@daily", want: []string{"0", "0", "*", "*", "*"}},
+		{name: "unsupported macro", schedule: "@reboot", wantErr: true},
+		{name: "too few fields", schedule: "* * * *", wantErr: true},
+		{name: "out of range", schedule: "60 * * * *", wantErr: true},
+		{name: "zero day of month", schedule: "0 0 0 * *", wantErr: true},
+		{name: "reversed range", schedule: "0 18-8 * * *", wantErr: true},
+		{name: "invalid step", schedule: "*/0 * * * *", wantErr: true},
+		{name: "step without range", schedule: "5/10 * * * *", wantErr: true},
+		{name: "names are not supported", schedule: "0 0 * * mon", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseCronSchedule(tt.schedule)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseCronSchedule() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			if !tt.wantErr {
+				assert.Equal(t, got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_cronToCalendar(t *testing.T) {
+	tests := []struct {
+		name     string
+		schedule string
+		want     string
+		wantErr  bool
+	}{
+		{name: "every minute", schedule: "* * * * *", want: "*-*-* *:*:00"},
+		{name: "every 15 minutes", schedule: "*/15 * * * *", want: "*-*-* *:0/15:00"},
+		{name: "daily", schedule: "@daily", want: "*-*-* 0:0:00"},
+		{name: "monthly", schedule: "30 4 1,15 * *", want: "*-*-1,15 4:30:00"},
+		{name: "every other month", schedule: "0 0 1 */2 *", want: "*-1/2-1 0:0:00"},
+		{name: "weekdays", schedule: "0 8-18 * * 1-5", want: "Mon..Fri *-*-* 8..18:0:00"},
+		{name: "weekly", schedule: "@weekly", want: "Sun *-*-* 0:0:00"},
+		{name: "whole week", schedule: "0 0 * * 0-6", want: "Sun,Mon..Sat *-*-* 0:0:00"},
+		{name: "weekend", schedule: "0 0 * * 6-7", want: "Sun,Sat *-*-* 0:0:00"},
+		{name: "day of month and day of week", schedule: "0 0 1 * 1", wantErr: true},
+		{name: "range with step", schedule: "0 8-18/2 * * *", wantErr: true},
+		{name: "invalid", schedule: "0 0 * *", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := cronToCalendar(tt.schedule)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("cronToCalendar() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			assert.Equal(t, got, tt.want)
+		})
+	}
+}
@@ -0,0 +1,99 @@
+// Copyright 2024 qbee.io
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package configuration
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+
+	"go.qbee.io/agent/app/api"
+)
+
+// downloadError provides details about a failed file download, so broken file sources are easier to debug.
+type downloadError struct {
+	// origin is the scheme and host of the file source (e.g. "https://artifacts.example.com").
+	origin string
+
+	// statusCode is the HTTP response status code (0 if no response was received).
+	statusCode int
+
+	// connection is true if the file source couldn't be reached.
+	connection bool
+
+	err error
+}
+
+// newDownloadError returns download error for a file source at origin, detecting its type from err.
+func newDownloadError(origin string, err error) *downloadError {
+	downloadErr := &downloadError{
+		origin:     origin,
+		connection: errors.As(err, new(api.ConnectionError)),
+		err:        err,
+	}
+
+	var apiErr *api.Error
+	if errors.As(err, &apiErr) {
+		downloadErr.statusCode = apiErr.ResponseCode
+	}
+
+	return downloadErr
+}
+
+// urlOrigin returns scheme and host of the URL.
+func urlOrigin(rawURL string) string {
+	parsedURL, err := url.Parse(rawURL)
+	if err != nil {
+		return rawURL
+	}
+
+	return parsedURL.Scheme + "://" + parsedURL.Host
+}
+
+// summary returns a short description of the failure cause.
+func (err *downloadError) summary() string {
+	switch {
+	case err.connection:
+		return fmt.Sprintf("connection error to %s", err.origin)
+	case err.statusCode >= 500:
+		return fmt.Sprintf("server error from %s (HTTP %d)", err.origin, err.statusCode)
+	case err.statusCode > 0:
+		return fmt.Sprintf("request rejected by %s (HTTP %d)", err.origin, err.statusCode)
+	default:
+		return fmt.Sprintf("error from %s", err.origin)
+	}
+}
+
+// Error returns a string representation of the error.
+func (err *downloadError) Error() string {
+	return fmt.Sprintf("%s: %v", err.summary(), err.err)
+}
+
+// Unwrap returns the underlying error.
+func (err *downloadError) Unwrap() error {
+	return err.err
+}
+
+// downloadErrorSummary returns download failure cause to be included in a report message (empty if not available).
+func downloadErrorSummary(err error) string {
+	var downloadErr *downloadError
+	if !errors.As(err, &downloadErr) {
+		return ""
+	}
+
+	return " (" + downloadErr.summary() + ")"
+}
@@ -0,0 +1,64 @@
+// Copyright 2024 qbee.io
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package configuration
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"testing"
+
+	"go.qbee.io/agent/app/api"
+	"go.qbee.io/agent/app/utils/assert"
+)
+
+func Test_downloadErrorSummary(t *testing.T) {
+	origin := "https://device.app.qbee.io:443"
+
+	tests := []struct {
+		name string
+		err  error
+		want string
+	}{
+		{
+			name: "not a download error",
+			err:  errors.New("error"),
+			want: "",
+		},
+		{
+			name: "connection error",
+			err:  newDownloadError(origin, api.NewConnectionError(errors.New("timeout"))),
+			want: " (connection error to https://device.app.qbee.io:443)",
+		},
+		{
+			name: "permission error",
+			err:  fmt.Errorf("error getting file: %w", newDownloadError(origin, api.NewError(403, bytes.NewBufferString("forbidden")))),
+			want: " (request rejected by https://device.app.qbee.io:443 (HTTP 403))",
+		},
+		{
+			name: "server error",
+			err:  newDownloadError(urlOrigin("https://mirror.example.com/files/app.tar.gz"), api.NewError(502, bytes.NewBufferString(""))),
+			want: " (server error from https://mirror.example.com (HTTP 502))",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, downloadErrorSummary(tt.err), tt.want)
+		})
+	}
+}
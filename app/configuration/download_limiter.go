@@ -0,0 +1,161 @@
+// Copyright 2024 qbee.io
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package configuration
+
+import (
+	"context"
+	"io"
+	"sync"
+	"time"
+)
+
+const (
+	// downloadChunkSize is the maximum number of bytes read from a rate-limited download at once.
+	downloadChunkSize = 32 * 1024
+
+	// downloadBurstDuration defines how much unused bandwidth (as time at the full rate) can be used at once.
+	downloadBurstDuration = time.Second
+)
+
+// downloadLimiter limits bandwidth and concurrency of file downloads.
+// Bandwidth limit is shared by all concurrent downloads. Nil limiter doesn't limit anything.
+type downloadLimiter struct {
+	// rate is the download bandwidth limit in bytes per second (0 -> unlimited).
+	rate int64
+
+	// slots limits number of concurrent downloads (nil -> unlimited).
+	slots chan struct{}
+
+	// next is the time when the bandwidth used so far is paid off.
+	next time.Time
+	lock sync.Mutex
+}
+
+// newDownloadLimiter returns a new download limiter, or nil if neither of the limits is set.
+func newDownloadLimiter(rate int64, maxConcurrent int) *downloadLimiter {
+	if rate <= 0 && maxConcurrent <= 0 {
+		return nil
+	}
+
+	limiter := &downloadLimiter{
+		rate: max(rate, 0),
+	}
+
+	if maxConcurrent > 0 {
+		limiter.slots = make(chan struct{}, maxConcurrent)
+	}
+
+	return limiter
+}
+
+// acquire waits for a free download slot and returns a function releasing it.
+func (limiter *downloadLimiter) acquire(ctx context.Context) (func(), error) {
+	if limiter == nil || limiter.slots == nil {
+		return func() {}, nil
+	}
+
+	select {
+	case limiter.slots <- struct{}{}:
+		return func() { <-limiter.slots }, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// wait blocks until n bytes can be downloaded within the bandwidth limit.
+// Returns how long it waited.
+func (limiter *downloadLimiter) wait(ctx context.Context, n int) (time.Duration, error) {
+	if limiter == nil || limiter.rate == 0 || n <= 0 {
+		return 0, nil
+	}
+
+	limiter.lock.Lock()
+	now := time.Now()
+	if earliest := now.Add(-downloadBurstDuration); limiter.next.Before(earliest) {
+		limiter.next = earliest
+	}
+	limiter.next = limiter.next.Add(time.Duration(n) * time.Second / time.Duration(limiter.rate))
+	delay := limiter.next.Sub(now)
+	limiter.lock.Unlock()
+
+	if delay <= 0 {
+		return 0, nil
+	}
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return delay, nil
+	case <-ctx.Done():
+		return delay, ctx.Err()
+	}
+}
+
+// limit returns src reader limited by the download bandwidth limit.
+// Release function is called when the returned reader is closed.
+func (limiter *downloadLimiter) limit(ctx context.Context, src io.ReadCloser, release func()) io.ReadCloser {
+	return &limitedReader{
+		ctx:     ctx,
+		src:     src,
+		limiter: limiter,
+		release: release,
+	}
+}
+
+// limitedReader is a download reader limited by the download limiter.
+type limitedReader struct {
+	ctx       context.Context
+	src       io.ReadCloser
+	limiter   *downloadLimiter
+	release   func()
+	releaser  sync.Once
+	throttled bool
+}
+
+// Read reads up to len(p) bytes, waiting when the bandwidth limit was reached.
+func (reader *limitedReader) Read(p []byte) (int, error) {
+	if reader.limiter != nil && reader.limiter.rate > 0 {
+		p = p[:min(len(p), int(min(reader.limiter.rate, downloadChunkSize)))]
+	}
+
+	n, err := reader.src.Read(p)
+
+	delay, waitErr := reader.limiter.wait(reader.ctx, n)
+	if delay > 0 {
+		reader.throttled = true
+	}
+
+	if waitErr != nil {
+		return n, waitErr
+	}
+
+	return n, err
+}
+
+// Close closes the source reader and releases the download slot.
+func (reader *limitedReader) Close() error {
+	reader.releaser.Do(reader.release)
+	return reader.src.Close()
+}
+
+// downloadThrottled returns true if download from the reader was slowed down by the bandwidth limit.
+func downloadThrottled(reader io.Reader) bool {
+	limited, ok := reader.(*limitedReader)
+	return ok && limited.throttled
+}
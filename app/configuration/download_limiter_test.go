@@ -0,0 +1,95 @@
+// Copyright 2024 qbee.io
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package configuration
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"testing"
+	"time"
+
+	"go.qbee.io/agent/app/utils/assert"
+)
+
+func Test_newDownloadLimiter(t *testing.T) {
+	assert.Equal(t, newDownloadLimiter(0, 0), (*downloadLimiter)(nil))
+
+	limiter := newDownloadLimiter(1024, 0)
+	assert.Equal(t, limiter.rate, int64(1024))
+	assert.Equal(t, limiter.slots, (chan struct{})(nil))
+
+	limiter = newDownloadLimiter(-1, 2)
+	assert.Equal(t, limiter.rate, int64(0))
+	assert.Equal(t, cap(limiter.slots), 2)
+}
+
+func Test_downloadLimiter_bandwidth(t *testing.T) {
+	ctx := context.Background()
+	data := bytes.Repeat([]byte("a"), 15000)
+
+	// download within the burst allowance is not throttled
+	limiter := newDownloadLimiter(20000, 0)
+	reader := limiter.limit(ctx, io.NopCloser(bytes.NewReader(data)), func() {})
+
+	downloaded, err := io.ReadAll(reader)
+	assert.NoError(t, err)
+	assert.Equal(t, downloaded, data)
+	assert.False(t, downloadThrottled(reader))
+
+	// exceeding the rate slows down the download
+	limiter = newDownloadLimiter(10000, 0)
+	reader = limiter.limit(ctx, io.NopCloser(bytes.NewReader(data)), func() {})
+
+	start := time.Now()
+	downloaded, err = io.ReadAll(reader)
+	assert.NoError(t, err)
+	assert.Equal(t, downloaded, data)
+	assert.True(t, downloadThrottled(reader))
+	assert.True(t, time.Since(start) >= 400*time.Millisecond)
+
+	// nil limiter doesn't limit downloads
+	var unlimited *downloadLimiter
+	reader = unlimited.limit(ctx, io.NopCloser(bytes.NewReader(data)), func() {})
+
+	downloaded, err = io.ReadAll(reader)
+	assert.NoError(t, err)
+	assert.Equal(t, downloaded, data)
+	assert.False(t, downloadThrottled(reader))
+}
+
+func Test_downloadLimiter_concurrency(t *testing.T) {
+	limiter := newDownloadLimiter(0, 1)
+
+	release, err := limiter.acquire(context.Background())
+	assert.NoError(t, err)
+
+	// no slot is available until the download is released
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	_, err = limiter.acquire(ctx)
+	assert.Equal(t, err, context.DeadlineExceeded)
+
+	reader := limiter.limit(context.Background(), io.NopCloser(bytes.NewReader(nil)), release)
+	assert.NoError(t, reader.Close())
+	assert.NoError(t, reader.Close())
+
+	release, err = limiter.acquire(context.Background())
+	assert.NoError(t, err)
+	release()
+}
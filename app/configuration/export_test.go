@@ -17,8 +17,12 @@
 package configuration
 
 import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
 	"strings"
 
+	"go.qbee.io/agent/app/utils"
 	"go.qbee.io/agent/app/utils/runner"
 )
 
@@ -27,6 +31,11 @@ func (srv *Service) ResetRebootAfterRun() {
 	srv.rebootAfterRun = false
 }
 
+// ResetRestartAgentAfterRun allows to reset internal restartAgentAfterRun flag from tests.
+func (srv *Service) ResetRestartAgentAfterRun() {
+	srv.restartAgentAfterRun = false
+}
+
 // ExecuteTestConfigInDocker executes provided config inside a docker container and returns reports and logs.
 func ExecuteTestConfigInDocker(r *runner.Runner, config CommittedConfig) ([]string, []string) {
 	r.CreateJSON("/app/config.json", config)
@@ -53,3 +62,41 @@ func ParseTestConfigExecuteOutput(output []byte) ([]string, []string) {
 
 	return reports, logs
 }
+
+// ExecuteTestConfigInDockerJSON executes provided config inside a docker container
+// and returns structured reports (with decoded operation logs) and agent logs.
+func ExecuteTestConfigInDockerJSON(r *runner.Runner, config CommittedConfig) ([]Report, []string) {
+	r.CreateJSON("/app/config.json", config)
+
+	return ParseTestConfigExecuteJSONOutput(r.MustExec("qbee-agent", "config", "--output", "json", "-f", "/app/config.json"))
+}
+
+// ParseTestConfigExecuteJSONOutput parses logs and JSON reports out of the configuration-execute command output.
+// Report's operation log is decoded from base64 to plain text.
+func ParseTestConfigExecuteJSONOutput(output []byte) ([]Report, []string) {
+	if len(output) == 0 {
+		return nil, nil
+	}
+
+	reports := make([]Report, 0)
+	logs := make([]string, 0)
+
+	_ = utils.ForLines(bytes.NewReader(output), func(line string) error {
+		report := Report{}
+
+		if json.Unmarshal([]byte(line), &report) != nil || report.Severity == "" {
+			logs = append(logs, strings.TrimSpace(line))
+			return nil
+		}
+
+		if decodedLog, err := base64.StdEncoding.DecodeString(report.Log); err == nil {
+			report.Log = string(decodedLog)
+		}
+
+		reports = append(reports, report)
+
+		return nil
+	})
+
+	return reports, logs
+}
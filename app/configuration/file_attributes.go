@@ -0,0 +1,234 @@
+// Copyright 2024 qbee.io
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package configuration
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/user"
+	"strconv"
+	"syscall"
+)
+
+const ctxFileAttributes = contextKey("configuration:file-attributes")
+
+// FileAttributes defines optional ownership and permissions of a managed file.
+// When not set, files inherit ownership from their parent directory and use default permissions.
+type FileAttributes struct {
+	// Owner defines user name or uid of the file owner.
+	Owner string `json:"owner,omitempty"`
+
+	// Group defines group name or gid of the file.
+	Group string `json:"group,omitempty"`
+
+	// Mode defines file permissions in octal notation (e.g. "0600").
+	Mode string `json:"mode,omitempty"`
+}
+
+// fileAttributes contains resolved file attributes (-1 uid/gid and 0 mode mean not set).
+type fileAttributes struct {
+	uid  int
+	gid  int
+	mode os.FileMode
+
+	// immutable is set for files managed with the immutable attribute, which is cleared to update them
+	immutable bool
+}
+
+// resolve user and group names to ids and parse file mode.
+// Returns nil if no attributes are defined.
+func (attrs FileAttributes) resolve() (*fileAttributes, error) {
+	if attrs.Owner == "" && attrs.Group == "" && attrs.Mode == "" {
+		return nil, nil
+	}
+
+	resolved := &fileAttributes{uid: -1, gid: -1}
+
+	var err error
+
+	if attrs.Owner != "" {
+		if resolved.uid, err = lookupID(attrs.Owner, lookupUserID); err != nil {
+			return nil, fmt.Errorf("cannot resolve owner %s: %w", attrs.Owner, err)
+		}
+	}
+
+	if attrs.Group != "" {
+		if resolved.gid, err = lookupID(attrs.Group, lookupGroupID); err != nil {
+			return nil, fmt.Errorf("cannot resolve group %s: %w", attrs.Group, err)
+		}
+	}
+
+	if attrs.Mode != "" {
+		mode, err := strconv.ParseUint(attrs.Mode, 8, 32)
+		if err != nil || mode == 0 || mode > uint64(os.ModePerm) {
+			return nil, fmt.Errorf("invalid file mode %s", attrs.Mode)
+		}
+
+		resolved.mode = os.FileMode(mode)
+	}
+
+	return resolved, nil
+}
+
+// lookupID returns numeric id for provided name, or the name itself if it's numeric.
+func lookupID(name string, lookupFn func(string) (string, error)) (int, error) {
+	if id, err := strconv.Atoi(name); err == nil {
+		return id, nil
+	}
+
+	id, err := lookupFn(name)
+	if err != nil {
+		return 0, err
+	}
+
+	return strconv.Atoi(id)
+}
+
+// lookupUserID returns uid for the user name.
+func lookupUserID(name string) (string, error) {
+	u, err := user.Lookup(name)
+	if err != nil {
+		return "", err
+	}
+
+	return u.Uid, nil
+}
+
+// lookupGroupID returns gid for the group name.
+func lookupGroupID(name string) (string, error) {
+	g, err := user.LookupGroup(name)
+	if err != nil {
+		return "", err
+	}
+
+	return g.Gid, nil
+}
+
+// withFileAttributes returns context with file attributes applied to files created by the file manager.
+func withFileAttributes(ctx context.Context, attrs *fileAttributes) context.Context {
+	return context.WithValue(ctx, ctxFileAttributes, attrs)
+}
+
+// fileAttributesFromContext returns file attributes set in context (nil if not set).
+func fileAttributesFromContext(ctx context.Context) *fileAttributes {
+	attrs, _ := ctx.Value(ctxFileAttributes).(*fileAttributes)
+	return attrs
+}
+
+// withImmutable returns attributes of a file managed with the immutable attribute.
+func (attrs *fileAttributes) withImmutable() *fileAttributes {
+	if attrs == nil {
+		return &fileAttributes{uid: -1, gid: -1, immutable: true}
+	}
+
+	withImmutable := *attrs
+	withImmutable.immutable = true
+
+	return &withImmutable
+}
+
+// isImmutable returns true if the file is managed with the immutable attribute.
+func (attrs *fileAttributes) isImmutable() bool {
+	return attrs != nil && attrs.immutable
+}
+
+// owner returns uid and gid for the file, using provided values for attributes which are not set.
+func (attrs *fileAttributes) owner(uid, gid int) (int, int) {
+	if attrs == nil {
+		return uid, gid
+	}
+
+	if attrs.uid >= 0 {
+		uid = attrs.uid
+	}
+
+	if attrs.gid >= 0 {
+		gid = attrs.gid
+	}
+
+	return uid, gid
+}
+
+// permission returns file mode for the file, using provided value if mode is not set.
+func (attrs *fileAttributes) permission(permission os.FileMode) os.FileMode {
+	if attrs == nil || attrs.mode == 0 {
+		return permission
+	}
+
+	return attrs.mode
+}
+
+// match returns true if existing file at path has the expected attributes.
+func (attrs *fileAttributes) match(path string) (bool, error) {
+	if attrs == nil {
+		return true, nil
+	}
+
+	fileInfo, err := os.Stat(path)
+	if err != nil {
+		return false, fmt.Errorf("cannot check file attributes: %s - %w", path, err)
+	}
+
+	fileStat, ok := fileInfo.Sys().(*syscall.Stat_t)
+	if !ok {
+		return false, fmt.Errorf("cannot check file attributes: %s - unsupported OS", path)
+	}
+
+	uid, gid := attrs.owner(int(fileStat.Uid), int(fileStat.Gid))
+	mode := attrs.permission(fileInfo.Mode().Perm())
+
+	return uid == int(fileStat.Uid) && gid == int(fileStat.Gid) && mode == fileInfo.Mode().Perm(), nil
+}
+
+// apply sets ownership and permissions of an existing file at path.
+func (attrs *fileAttributes) apply(path string) error {
+	if attrs == nil {
+		return nil
+	}
+
+	if err := os.Chown(path, attrs.uid, attrs.gid); err != nil {
+		return fmt.Errorf("error setting owner on %s: %w", path, err)
+	}
+
+	if attrs.mode != 0 {
+		if err := os.Chmod(path, attrs.mode); err != nil {
+			return fmt.Errorf("error setting mode on %s: %w", path, err)
+		}
+	}
+
+	return nil
+}
+
+// ensureFileAttributes applies file attributes from context to an existing file with the right contents.
+// Returns true if file attributes were changed.
+func ensureFileAttributes(ctx context.Context, label, path string) (bool, error) {
+	attrs := fileAttributesFromContext(ctx)
+
+	matched, err := attrs.match(path)
+	if err != nil || matched {
+		return false, err
+	}
+
+	if err = attrs.apply(path); err != nil {
+		return false, err
+	}
+
+	reportChange(ctx, nil, msgWithLabel(label, "Successfully updated ownership and permissions of %s", path))
+
+	return true, nil
+}
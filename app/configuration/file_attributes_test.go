@@ -0,0 +1,114 @@
+// Copyright 2024 qbee.io
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package configuration
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	"go.qbee.io/agent/app/utils/assert"
+)
+
+func TestFileAttributes_resolve(t *testing.T) {
+	tests := []struct {
+		name    string
+		attrs   FileAttributes
+		want    *fileAttributes
+		wantErr bool
+	}{
+		{
+			name: "not set",
+		},
+		{
+			name:  "names",
+			attrs: FileAttributes{Owner: "root", Group: "root", Mode: "0600"},
+			want:  &fileAttributes{uid: 0, gid: 0, mode: 0600},
+		},
+		{
+			name:  "numeric ids",
+			attrs: FileAttributes{Owner: "1000", Group: "1001"},
+			want:  &fileAttributes{uid: 1000, gid: 1001},
+		},
+		{
+			name:  "mode only",
+			attrs: FileAttributes{Mode: "755"},
+			want:  &fileAttributes{uid: -1, gid: -1, mode: 0755},
+		},
+		{
+			name:    "unknown user",
+			attrs:   FileAttributes{Owner: "qbee-non-existing-user"},
+			wantErr: true,
+		},
+		{
+			name:    "invalid mode",
+			attrs:   FileAttributes{Mode: "0999"},
+			wantErr: true,
+		},
+		{
+			name:    "mode with special bits",
+			attrs:   FileAttributes{Mode: "4755"},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.attrs.resolve()
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("expected error, got %v", got)
+				}
+				return
+			}
+
+			assert.NoError(t, err)
+			assert.Equal(t, got, tt.want)
+		})
+	}
+}
+
+func Test_ensureFileAttributes(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "file")
+	assert.NoError(t, os.WriteFile(path, []byte("contents"), fileManagerDefaultFilePermission))
+
+	attrs, err := FileAttributes{Owner: strconv.Itoa(os.Getuid()), Mode: "0600"}.resolve()
+	assert.NoError(t, err)
+
+	ctx := withFileAttributes(context.Background(), attrs)
+
+	// mode change is applied to an existing file with unchanged contents
+	changed, err := ensureFileAttributes(ctx, "", path)
+	assert.NoError(t, err)
+	assert.True(t, changed)
+
+	fileInfo, err := os.Stat(path)
+	assert.NoError(t, err)
+	assert.Equal(t, fileInfo.Mode().Perm(), os.FileMode(0600))
+
+	// nothing changes when file already has the requested attributes
+	changed, err = ensureFileAttributes(ctx, "", path)
+	assert.NoError(t, err)
+	assert.False(t, changed)
+
+	// without attributes set, existing file is left as is
+	changed, err = ensureFileAttributes(context.Background(), "", path)
+	assert.NoError(t, err)
+	assert.False(t, changed)
+}
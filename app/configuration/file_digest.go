@@ -0,0 +1,145 @@
+// Copyright 2024 qbee.io
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package configuration
+
+import (
+	"crypto/md5"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"strings"
+
+	"lukechampine.com/blake3"
+)
+
+// DigestAlgorithm defines a hash algorithm used to calculate file digests.
+type DigestAlgorithm string
+
+// Supported digest algorithms.
+const (
+	DigestMD5    DigestAlgorithm = "md5"
+	DigestSHA256 DigestAlgorithm = "sha256"
+	DigestSHA512 DigestAlgorithm = "sha512"
+	DigestBLAKE3 DigestAlgorithm = "blake3"
+)
+
+// defaultDigestAlgorithm is used when digest algorithm is not explicitly set.
+const defaultDigestAlgorithm = DigestSHA256
+
+// fileDigestTagPrefix prefixes file metadata tags carrying hex-encoded digests (e.g. qbee_digest_sha256).
+const fileDigestTagPrefix = "qbee_digest_"
+
+// validate returns an error if the algorithm is not supported for verifying file contents.
+// MD5 is only used for file manager metadata of existing files, so it cannot be requested explicitly.
+func (algorithm DigestAlgorithm) validate() error {
+	switch algorithm {
+	case DigestSHA256, DigestSHA512, DigestBLAKE3:
+		return nil
+	default:
+		return fmt.Errorf("unsupported digest algorithm %q", algorithm)
+	}
+}
+
+// newHash returns a new hash for the algorithm.
+func (algorithm DigestAlgorithm) newHash() (hash.Hash, error) {
+	switch algorithm {
+	case DigestMD5:
+		return md5.New(), nil
+	case DigestSHA256:
+		return sha256.New(), nil
+	case DigestSHA512:
+		return sha512.New(), nil
+	case DigestBLAKE3:
+		return blake3.New(32, nil), nil
+	default:
+		return nil, fmt.Errorf("unsupported digest algorithm %q", algorithm)
+	}
+}
+
+// hexLength returns length of a hex-encoded digest calculated with the algorithm.
+func (algorithm DigestAlgorithm) hexLength() int {
+	switch algorithm {
+	case DigestMD5:
+		return 2 * md5.Size
+	case DigestSHA512:
+		return 2 * sha512.Size
+	default:
+		return 2 * sha256.Size
+	}
+}
+
+// tag returns name of the file metadata tag carrying digest calculated with the algorithm.
+func (algorithm DigestAlgorithm) tag() string {
+	return fileDigestTagPrefix + string(algorithm)
+}
+
+// fileDigest is a hex-encoded digest of a file together with the algorithm used to calculate it.
+type fileDigest struct {
+	Algorithm DigestAlgorithm
+	Hex       string
+}
+
+// String returns digest in "<algorithm>:<hex>" notation.
+func (digest fileDigest) String() string {
+	return fmt.Sprintf("%s:%s", digest.Algorithm, digest.Hex)
+}
+
+// calculateDigest returns digest of data read from the reader.
+func calculateDigest(reader io.Reader, algorithm DigestAlgorithm) (fileDigest, error) {
+	digest, err := algorithm.newHash()
+	if err != nil {
+		return fileDigest{}, err
+	}
+
+	if _, err = io.Copy(digest, reader); err != nil {
+		return fileDigest{}, err
+	}
+
+	return fileDigest{Algorithm: algorithm, Hex: hex.EncodeToString(digest.Sum(nil))}, nil
+}
+
+// parseFileDigest returns digest from "<algorithm>:<hex>" or "<hex>" notation.
+// Without an algorithm prefix, the provided algorithm (or SHA256 if empty) is assumed.
+func parseFileDigest(digest string, algorithm DigestAlgorithm) (fileDigest, error) {
+	hexDigest := strings.ToLower(digest)
+
+	if prefix, value, found := strings.Cut(hexDigest, ":"); found {
+		if algorithm != "" && DigestAlgorithm(prefix) != algorithm {
+			return fileDigest{}, fmt.Errorf("invalid digest %s: expected %s digest", digest, algorithm)
+		}
+
+		algorithm = DigestAlgorithm(prefix)
+		hexDigest = value
+	}
+
+	if algorithm == "" {
+		algorithm = defaultDigestAlgorithm
+	}
+
+	if err := algorithm.validate(); err != nil {
+		return fileDigest{}, fmt.Errorf("invalid digest %s: %w", digest, err)
+	}
+
+	if _, err := hex.DecodeString(hexDigest); err != nil || len(hexDigest) != algorithm.hexLength() {
+		return fileDigest{}, fmt.Errorf("invalid digest %s: expected hex-encoded %s", digest, strings.ToUpper(string(algorithm)))
+	}
+
+	return fileDigest{Algorithm: algorithm, Hex: hexDigest}, nil
+}
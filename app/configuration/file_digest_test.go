@@ -0,0 +1,148 @@
+// Copyright 2024 qbee.io
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package configuration
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"go.qbee.io/agent/app/utils/assert"
+)
+
+func Test_calculateDigest(t *testing.T) {
+	tests := []struct {
+		algorithm DigestAlgorithm
+		expected  string
+	}{
+		{
+			algorithm: DigestMD5,
+			expected:  "098f6bcd4621d373cade4e832627b4f6",
+		},
+		{
+			algorithm: DigestSHA256,
+			expected:  "9f86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00a08",
+		},
+		{
+			algorithm: DigestSHA512,
+			expected: "ee26b0dd4af7e749aa1a8ee3c10ae9923f618980772e473f8819a5d4940e0db2" +
+				"7ac185f8a0e1d5f84f88bc887fd67b143732c304cc5fa9ad8e6f57f50028a8ff",
+		},
+		{
+			algorithm: DigestBLAKE3,
+			expected:  "4878ca0425c739fa427f7eda20fe845f6b2e46ba5fe2a14df5b1e32f50603215",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(string(tt.algorithm), func(t *testing.T) {
+			digest, err := calculateDigest(strings.NewReader("test"), tt.algorithm)
+			assert.NoError(t, err)
+			assert.Equal(t, digest, fileDigest{Algorithm: tt.algorithm, Hex: tt.expected})
+			assert.Length(t, digest.Hex, tt.algorithm.hexLength())
+		})
+	}
+
+	if _, err := calculateDigest(strings.NewReader("test"), "crc32"); err == nil {
+		t.Fatalf("expected error for unsupported algorithm")
+	}
+}
+
+func Test_parseFileDigest_algorithms(t *testing.T) {
+	sha512Digest := strings.Repeat("ab", 64)
+	blake3Digest := strings.Repeat("cd", 32)
+
+	got, err := parseFileDigest("sha512:"+sha512Digest, "")
+	assert.NoError(t, err)
+	assert.Equal(t, got, fileDigest{Algorithm: DigestSHA512, Hex: sha512Digest})
+
+	got, err = parseFileDigest(sha512Digest, DigestSHA512)
+	assert.NoError(t, err)
+	assert.Equal(t, got, fileDigest{Algorithm: DigestSHA512, Hex: sha512Digest})
+
+	got, err = parseFileDigest("BLAKE3:"+strings.ToUpper(blake3Digest), DigestBLAKE3)
+	assert.NoError(t, err)
+	assert.Equal(t, got, fileDigest{Algorithm: DigestBLAKE3, Hex: blake3Digest})
+
+	invalid := []struct {
+		digest    string
+		algorithm DigestAlgorithm
+	}{
+		{digest: sha512Digest, algorithm: ""},
+		{digest: blake3Digest, algorithm: DigestSHA512},
+		{digest: "sha256:" + blake3Digest, algorithm: DigestBLAKE3},
+		{digest: "crc32:" + blake3Digest, algorithm: ""},
+		{digest: "blake3:" + strings.Repeat("zz", 32), algorithm: ""},
+	}
+
+	for _, tt := range invalid {
+		if _, err = parseFileDigest(tt.digest, tt.algorithm); err == nil {
+			t.Fatalf("expected error for digest %s (%s)", tt.digest, tt.algorithm)
+		}
+	}
+}
+
+func TestFileMetadata_Digest(t *testing.T) {
+	sha256Digest := strings.Repeat("01", 32)
+	sha512Digest := strings.Repeat("02", 64)
+
+	// legacy metadata
+	metadata := FileMetadata{MD5: "0123456789abcdef0123456789abcdef"}
+	assert.Equal(t, metadata.Digest(), fileDigest{Algorithm: DigestMD5, Hex: metadata.MD5})
+
+	metadata.Tags = map[string]string{DigestSHA256.tag(): sha256Digest, DigestSHA512.tag(): sha512Digest}
+	assert.Equal(t, metadata.Digest(), fileDigest{Algorithm: DigestSHA256, Hex: sha256Digest})
+
+	// metadata with algorithm
+	metadata.Algorithm = DigestSHA512
+	assert.Equal(t, metadata.Digest(), fileDigest{Algorithm: DigestSHA512, Hex: sha512Digest})
+
+	// fallback when digest for the algorithm is missing
+	metadata.Algorithm = DigestBLAKE3
+	assert.Equal(t, metadata.Digest(), fileDigest{Algorithm: DigestSHA256, Hex: sha256Digest})
+}
+
+func Test_templateDigest_matchesRenderedFile(t *testing.T) {
+	dir := t.TempDir()
+	templatePath := filepath.Join(dir, "template")
+	renderedPath := filepath.Join(dir, "rendered")
+
+	assert.NoError(t, os.WriteFile(templatePath, []byte("key={{value}}\n"), 0600))
+	assert.NoError(t, os.WriteFile(renderedPath, []byte("key=test\n"), 0600))
+
+	params := map[string]string{"value": "test"}
+
+	for _, algorithm := range []DigestAlgorithm{DigestSHA256, DigestSHA512, DigestBLAKE3} {
+		digest, err := calculateTemplateDigest(templatePath, params, algorithm)
+		assert.NoError(t, err)
+		assert.Equal(t, digest.Algorithm, algorithm)
+
+		ready, err := isFileReady(renderedPath, digest)
+		assert.NoError(t, err)
+		assert.True(t, ready)
+	}
+
+	srv := &Service{}
+	metadata, err := srv.getFileMetadataFromLocal("file://"+renderedPath, DigestBLAKE3)
+	assert.NoError(t, err)
+	assert.Equal(t, metadata.Algorithm, DigestBLAKE3)
+
+	ready, err := isFileReady(renderedPath, metadata.Digest())
+	assert.NoError(t, err)
+	assert.True(t, ready)
+}
@@ -0,0 +1,227 @@
+// Copyright 2023 qbee.io
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package configuration
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"go.qbee.io/agent/app/utils"
+)
+
+// fileExtractStateDirectory is a cache sub-directory keeping state of extracted archives.
+const fileExtractStateDirectory = "file_extract"
+
+// extractState is recorded after an archive is extracted, so unchanged archives aren't extracted again.
+type extractState struct {
+	Archive string `json:"archive"`
+	Digest  string `json:"digest"`
+
+	// Files extracted from the archive (relative to the extraction directory),
+	// so files removed from the archive are removed from the directory when a new version is extracted.
+	Files []string `json:"files,omitempty"`
+}
+
+// sameArchive returns true if both states describe the same archive contents.
+func (state extractState) sameArchive(other extractState) bool {
+	return state.Archive == other.Archive && state.Digest == other.Digest
+}
+
+// extractStatePath returns path of the state file for the extraction directory.
+func (srv *Service) extractStatePath(directory string) string {
+	name := hex.EncodeToString([]byte(filepath.Clean(directory)))
+	return filepath.Join(srv.cacheDirectory, fileExtractStateDirectory, name+".json")
+}
+
+// extractArchive extracts the archive into the directory, unless the same archive was already extracted there.
+// Ownership and permissions from the context file attributes are applied to the extracted tree.
+// Returns true if the archive was extracted.
+func (srv *Service) extractArchive(ctx context.Context, label, archive, directory string) (bool, error) {
+	if !utils.IsSupportedTarExtension(archive) {
+		err := fmt.Errorf("unsupported archive extension %s", archive)
+		ReportError(ctx, err, msgWithLabel(label, "Unable to extract %s", archive))
+		return false, err
+	}
+
+	if !filepath.IsAbs(directory) {
+		err := fmt.Errorf("extract directory must be an absolute path: %s", directory)
+		ReportError(ctx, err, msgWithLabel(label, "Unable to extract %s", archive))
+		return false, err
+	}
+
+	state, err := newExtractState(archive)
+	if err != nil {
+		ReportError(ctx, err, msgWithLabel(label, "Unable to extract %s", archive))
+		return false, err
+	}
+
+	statePath := srv.extractStatePath(directory)
+
+	previousState, readErr := readExtractState(statePath)
+	if _, err = os.Stat(directory); err == nil && readErr == nil && previousState.sameArchive(state) {
+		return false, nil
+	}
+
+	if state.Files, err = extractArchiveTree(ctx, archive, directory); err != nil {
+		ReportError(ctx, err, msgWithLabel(label, "Unable to extract %s to %s", archive, directory))
+		return false, err
+	}
+
+	if err = removeStaleFiles(directory, previousState.Files, state.Files); err != nil {
+		ReportWarning(ctx, err, msgWithLabel(label, "Unable to remove files no longer present in %s", archive))
+	}
+
+	if err = writeExtractState(statePath, state); err != nil {
+		ReportError(ctx, err, msgWithLabel(label, "Unable to record extraction state of %s", archive))
+		return false, err
+	}
+
+	reportChange(ctx, nil, msgWithLabel(label, "Successfully extracted %s to %s", archive, directory))
+
+	return true, nil
+}
+
+// newExtractState returns extraction state for the current contents of the archive.
+func newExtractState(archive string) (extractState, error) {
+	archiveFile, err := os.Open(archive)
+	if err != nil {
+		return extractState{}, err
+	}
+	defer archiveFile.Close()
+
+	digest, err := calculateDigest(archiveFile, defaultDigestAlgorithm)
+	if err != nil {
+		return extractState{}, fmt.Errorf("cannot calculate digest of %s: %w", archive, err)
+	}
+
+	return extractState{Archive: archive, Digest: digest.String()}, nil
+}
+
+// readExtractState returns extraction state recorded in the state file.
+func readExtractState(statePath string) (extractState, error) {
+	var state extractState
+
+	stateBytes, err := os.ReadFile(statePath)
+	if err != nil {
+		return state, err
+	}
+
+	err = json.Unmarshal(stateBytes, &state)
+
+	return state, err
+}
+
+// writeExtractState records extraction state in the state file.
+func writeExtractState(statePath string, state extractState) error {
+	if err := os.MkdirAll(filepath.Dir(statePath), 0700); err != nil {
+		return err
+	}
+
+	stateBytes, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(statePath, stateBytes, 0600)
+}
+
+// extractArchiveTree unpacks the archive into the directory and applies file attributes from context to the tree.
+// Configured mode is applied to regular files, while directories get it with execute bit added for each read bit.
+// Returns paths of extracted files relative to the directory.
+func extractArchiveTree(ctx context.Context, archive, directory string) ([]string, error) {
+	if err := os.MkdirAll(directory, 0755); err != nil {
+		return nil, err
+	}
+
+	files, err := utils.UnpackTarFiles(archive, directory)
+	if err != nil {
+		return nil, err
+	}
+
+	attrs := fileAttributesFromContext(ctx)
+	if attrs == nil {
+		return files, nil
+	}
+
+	return files, filepath.WalkDir(directory, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if entry.Type()&fs.ModeSymlink != 0 {
+			return nil
+		}
+
+		entryAttrs := *attrs
+		if entry.IsDir() && entryAttrs.mode != 0 {
+			entryAttrs.mode |= (entryAttrs.mode & 0444) >> 2
+		}
+
+		return entryAttrs.apply(path)
+	})
+}
+
+// removeStaleFiles removes files extracted from the previous version of the archive, which are not present
+// in the current one. Directories are removed only when they are empty, so files added locally are preserved.
+func removeStaleFiles(directory string, previousFiles, currentFiles []string) error {
+	current := make(map[string]bool, len(currentFiles))
+	for _, file := range currentFiles {
+		current[file] = true
+	}
+
+	stale := make([]string, 0)
+	for _, file := range previousFiles {
+		if !current[file] {
+			stale = append(stale, file)
+		}
+	}
+
+	// nested paths are removed before their parent directories
+	sort.Sort(sort.Reverse(sort.StringSlice(stale)))
+
+	var errs []error
+	for _, file := range stale {
+		path := filepath.Join(directory, file)
+
+		fileInfo, err := os.Lstat(path)
+		if err != nil {
+			if !errors.Is(err, fs.ErrNotExist) {
+				errs = append(errs, err)
+			}
+			continue
+		}
+
+		if fileInfo.IsDir() {
+			if entries, readErr := os.ReadDir(path); readErr != nil || len(entries) > 0 {
+				continue
+			}
+		}
+
+		if err = os.Remove(path); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	return errors.Join(errs...)
+}
@@ -0,0 +1,129 @@
+// Copyright 2023 qbee.io
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package configuration
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"context"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	"go.qbee.io/agent/app/utils/assert"
+)
+
+// writeTestArchive creates a tar.gz archive with provided files (name -> contents).
+func writeTestArchive(t *testing.T, path string, files map[string]string) {
+	archiveFile, err := os.Create(path)
+	assert.NoError(t, err)
+	defer archiveFile.Close()
+
+	gzWriter := gzip.NewWriter(archiveFile)
+	tarWriter := tar.NewWriter(gzWriter)
+
+	for name, contents := range files {
+		header := &tar.Header{Name: name, Mode: 0644, Size: int64(len(contents)), Typeflag: tar.TypeReg}
+		assert.NoError(t, tarWriter.WriteHeader(header))
+
+		_, err = tarWriter.Write([]byte(contents))
+		assert.NoError(t, err)
+	}
+
+	assert.NoError(t, tarWriter.Close())
+	assert.NoError(t, gzWriter.Close())
+}
+
+func Test_extractArchive(t *testing.T) {
+	srv := New(nil, t.TempDir(), t.TempDir())
+	archive := filepath.Join(t.TempDir(), "app-1.0.tar.gz")
+	directory := filepath.Join(t.TempDir(), "app")
+
+	writeTestArchive(t, archive, map[string]string{"bin/app": "v1", "README": "readme"})
+
+	attrs, err := FileAttributes{Owner: strconv.Itoa(os.Getuid()), Mode: "0640"}.resolve()
+	assert.NoError(t, err)
+
+	ctx := withFileAttributes(context.Background(), attrs)
+
+	extracted, err := srv.extractArchive(ctx, "", archive, directory)
+	assert.NoError(t, err)
+	assert.True(t, extracted)
+
+	contents, err := os.ReadFile(filepath.Join(directory, "bin", "app"))
+	assert.NoError(t, err)
+	assert.Equal(t, string(contents), "v1")
+
+	fileInfo, err := os.Stat(filepath.Join(directory, "README"))
+	assert.NoError(t, err)
+	assert.Equal(t, fileInfo.Mode().Perm(), os.FileMode(0640))
+
+	// directories get execute bit for each read bit of the configured mode
+	dirInfo, err := os.Stat(filepath.Join(directory, "bin"))
+	assert.NoError(t, err)
+	assert.Equal(t, dirInfo.Mode().Perm(), os.FileMode(0750))
+
+	// unchanged archive is not extracted again
+	extracted, err = srv.extractArchive(ctx, "", archive, directory)
+	assert.NoError(t, err)
+	assert.False(t, extracted)
+
+	// changed archive is extracted again
+	writeTestArchive(t, archive, map[string]string{"bin/app": "v2"})
+	assert.NoError(t, os.WriteFile(filepath.Join(directory, "local.conf"), []byte("local"), 0600))
+
+	extracted, err = srv.extractArchive(ctx, "", archive, directory)
+	assert.NoError(t, err)
+	assert.True(t, extracted)
+
+	contents, err = os.ReadFile(filepath.Join(directory, "bin", "app"))
+	assert.NoError(t, err)
+	assert.Equal(t, string(contents), "v2")
+
+	// files removed from the archive are removed, while files added locally are preserved
+	_, err = os.Stat(filepath.Join(directory, "README"))
+	assert.True(t, os.IsNotExist(err))
+
+	_, err = os.Stat(filepath.Join(directory, "local.conf"))
+	assert.NoError(t, err)
+
+	// removed directory is extracted again
+	assert.NoError(t, os.RemoveAll(directory))
+
+	extracted, err = srv.extractArchive(ctx, "", archive, directory)
+	assert.NoError(t, err)
+	assert.True(t, extracted)
+}
+
+func Test_extractArchive_Unsupported(t *testing.T) {
+	srv := New(nil, t.TempDir(), t.TempDir())
+	archive := filepath.Join(t.TempDir(), "app.zip")
+	assert.NoError(t, os.WriteFile(archive, []byte("zip"), 0600))
+
+	_, err := srv.extractArchive(context.Background(), "", archive, t.TempDir())
+	assert.NotEqual(t, err, nil)
+}
+
+func Test_extractArchive_PathTraversal(t *testing.T) {
+	srv := New(nil, t.TempDir(), t.TempDir())
+	archive := filepath.Join(t.TempDir(), "app.tar.gz")
+	writeTestArchive(t, archive, map[string]string{"../escaped": "x"})
+
+	_, err := srv.extractArchive(context.Background(), "", archive, filepath.Join(t.TempDir(), "app"))
+	assert.NotEqual(t, err, nil)
+}
@@ -20,12 +20,9 @@ import (
 	"bufio"
 	"bytes"
 	"context"
-	"crypto/md5"
-	"crypto/sha256"
 	"encoding/hex"
 	"errors"
 	"fmt"
-	"hash"
 	"io"
 	"io/fs"
 	"os"
@@ -54,11 +51,17 @@ const PodmanContainerDirectory = "podman_containers"
 // DockerComposeDirectory is where the agent will download docker-compose related files.
 const DockerComposeDirectory = "docker_compose"
 
+// PodmanComposeDirectory is where the agent will download podman compose related files.
+const PodmanComposeDirectory = "podman_compose"
+
 // FileMetadata is the metadata of a file.
 type FileMetadata struct {
 	MD5          string            `json:"md5"`
 	LastModified int64             `json:"last_modified"`
 	Tags         map[string]string `json:"tags,omitempty"`
+
+	// Algorithm defines which digest tag identifies the file contents (legacy metadata uses SHA256 or MD5).
+	Algorithm DigestAlgorithm `json:"algorithm,omitempty"`
 }
 
 // TemplateParameter defines a single parameter used to replace placeholder in a template.
@@ -81,7 +84,7 @@ func templateParametersMap(templateParameters []TemplateParameter) map[string]st
 	return parameters
 }
 
-const fileDigestSHA256Tag = "qbee_digest_sha256"
+var fileDigestSHA256Tag = DigestSHA256.tag()
 
 // SHA256 returns hex-encoded sha256 digest of the file (if present), otherwise an empty string.
 func (md *FileMetadata) SHA256() string {
@@ -92,6 +95,20 @@ func (md *FileMetadata) SHA256() string {
 	return md.Tags[fileDigestSHA256Tag]
 }
 
+// Digest returns the digest identifying file contents.
+// Digest for the metadata algorithm is preferred, falling back to SHA256 and MD5 digests of legacy metadata.
+func (md *FileMetadata) Digest() fileDigest {
+	if md.Algorithm != "" && md.Tags[md.Algorithm.tag()] != "" {
+		return fileDigest{Algorithm: md.Algorithm, Hex: md.Tags[md.Algorithm.tag()]}
+	}
+
+	if sha256Digest := md.SHA256(); sha256Digest != "" {
+		return fileDigest{Algorithm: DigestSHA256, Hex: sha256Digest}
+	}
+
+	return fileDigest{Algorithm: DigestMD5, Hex: md.MD5}
+}
+
 // downloadFile and return true when file was created. In case the right file already existed, return false.
 func (srv *Service) downloadFile(ctx context.Context, label, src, dst string) (bool, error) {
 	var err error
@@ -100,8 +117,8 @@ func (srv *Service) downloadFile(ctx context.Context, label, src, dst string) (b
 	dst = resolveParameters(ctx, dst)
 
 	defer func() {
-		if err != nil {
-			ReportError(ctx, err, msgWithLabel(label, "Unable to download file %s to %s", src, dst))
+		if err != nil && !reportReadOnlyMount(ctx, label, dst, err) {
+			ReportError(ctx, err, msgWithLabel(label, "Unable to download file %s to %s%s", src, dst, downloadErrorSummary(err)))
 		}
 	}()
 
@@ -123,9 +140,23 @@ func (srv *Service) downloadFile(ctx context.Context, label, src, dst string) (b
 func (srv *Service) downloadMetadataCompare(ctx context.Context, label, src, dst string, fileMetadata *FileMetadata) (bool, error) {
 	var err error
 
-	var fileReady bool
-	if fileReady, err = isFileReady(dst, fileMetadata.SHA256(), fileMetadata.MD5); err != nil || fileReady {
-		return false, err
+	expectedDigest := fileMetadata.Digest()
+
+	// without a known digest, the file is downloaded and compared with the existing one
+	var existingDigest fileDigest
+	if expectedDigest.Hex == "" {
+		if existingDigest, err = calculateFileDigest(dst, defaultDigestAlgorithm); err != nil {
+			return false, err
+		}
+	} else {
+		var fileReady bool
+		if fileReady, err = isFileReady(dst, expectedDigest); err != nil {
+			return false, err
+		}
+
+		if fileReady {
+			return ensureFileAttributes(ctx, label, dst)
+		}
 	}
 
 	var srcFile io.ReadCloser
@@ -135,18 +166,46 @@ func (srv *Service) downloadMetadataCompare(ctx context.Context, label, src, dst
 
 	defer srcFile.Close()
 
-	var dstFile *os.File
-	if dstFile, err = createFile(dst, fileManagerDefaultFilePermission); err != nil {
+	// snapshot is taken before the file is prepared for rewriting, so it records the original attributes
+	var snapshot *fileSnapshot
+	if snapshot, err = snapshotFile(ctx, dst); err != nil {
 		return false, err
 	}
 
-	defer dstFile.Close()
+	// file is downloaded to a temporary file, so dst is only replaced with contents which passed verification
+	err = writeFileAtomically(dst, fileManagerDefaultFilePermission, fileAttributesFromContext(ctx), func(w io.Writer) error {
+		digest, digestErr := defaultDigestAlgorithm.newHash()
+		if digestErr != nil {
+			return digestErr
+		}
+
+		if _, copyErr := io.Copy(io.MultiWriter(w, digest), srcFile); copyErr != nil {
+			return fmt.Errorf("error writing file %s: %w", dst, copyErr)
+		}
 
-	if _, err = io.Copy(dstFile, srcFile); err != nil {
-		return false, fmt.Errorf("error writing file %s: %w", dst, err)
+		if existingDigest.Hex != "" && existingDigest.Hex == hex.EncodeToString(digest.Sum(nil)) {
+			return errFileUnchanged
+		}
+
+		return nil
+	})
+
+	if errors.Is(err, errFileUnchanged) {
+		if err = dropFileSnapshot(ctx, snapshot); err != nil {
+			return false, err
+		}
+		return ensureFileAttributes(ctx, label, dst)
 	}
 
-	ReportInfo(ctx, nil, msgWithLabel(label, "Successfully downloaded file %s to %s", src, dst))
+	if err != nil {
+		return false, err
+	}
+
+	if downloadThrottled(srcFile) {
+		ReportInfo(ctx, nil, msgWithLabel(label, "Download of %s was throttled to %d bytes/s", src, srv.downloadLimiter.rate))
+	}
+
+	reportChange(ctx, nil, msgWithLabel(label, "Successfully downloaded file %s to %s", src, dst))
 
 	return true, nil
 }
@@ -158,17 +217,35 @@ func getLocalFile(src string) (io.ReadCloser, error) {
 	return os.Open(strings.TrimPrefix(src, localFileSchema))
 }
 
-// getFile returns file reader for a file in file manager.
+// getFile returns file reader for a file in file manager, on the local filesystem or under HTTP(S) URL.
 func (srv *Service) getFile(ctx context.Context, src string) (io.ReadCloser, error) {
 	if strings.HasPrefix(src, localFileSchema) {
 		return getLocalFile(src)
 	}
 
-	return srv.getFileFromAPI(ctx, src)
+	release, err := srv.downloadLimiter.acquire(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("error waiting for download slot: %w", err)
+	}
+
+	var file io.ReadCloser
+	if isURLSource(src) {
+		file, err = srv.getFileFromURL(ctx, src)
+	} else {
+		file, err = srv.getFileFromAPI(ctx, src)
+	}
+
+	if err != nil {
+		release()
+		return nil, err
+	}
+
+	return srv.downloadLimiter.limit(ctx, file, release), nil
 }
 
 // getFileMetadataFromLocal returns metadata for a file on the local filesystem.
-func (srv *Service) getFileMetadataFromLocal(src string) (*FileMetadata, error) {
+// File digest is calculated with the provided algorithm.
+func (srv *Service) getFileMetadataFromLocal(src string, algorithm DigestAlgorithm) (*FileMetadata, error) {
 	fp, err := os.Open(strings.TrimPrefix(src, localFileSchema))
 	if err != nil {
 		return nil, fmt.Errorf("error opening file %s: %w", src, err)
@@ -181,18 +258,17 @@ func (srv *Service) getFileMetadataFromLocal(src string) (*FileMetadata, error)
 		return nil, fmt.Errorf("error getting file metadata %s: %w", src, err)
 	}
 
-	digest := sha256.New()
-	if _, err = io.Copy(digest, fp); err != nil {
+	var digest fileDigest
+	if digest, err = calculateDigest(fp, algorithm); err != nil {
 		return nil, fmt.Errorf("error calculating file checksum %s: %w", src, err)
 	}
 
-	hexDigest := hex.EncodeToString(digest.Sum(nil))
-
 	fileMetadata := &FileMetadata{
 		LastModified: fileInfo.ModTime().Unix(),
 		Tags: map[string]string{
-			fileDigestSHA256Tag: hexDigest,
+			algorithm.tag(): digest.Hex,
 		},
+		Algorithm: algorithm,
 	}
 
 	return fileMetadata, nil
@@ -200,11 +276,27 @@ func (srv *Service) getFileMetadataFromLocal(src string) (*FileMetadata, error)
 
 // getFileMetadata returns metadata for a file in the file manager.
 func (srv *Service) getFileMetadata(ctx context.Context, src string) (*FileMetadata, error) {
+	algorithm := fileDigestAlgorithmFromContext(ctx)
+
 	if strings.HasPrefix(src, localFileSchema) {
-		return srv.getFileMetadataFromLocal(src)
+		return srv.getFileMetadataFromLocal(src, algorithm)
+	}
+
+	if isURLSource(src) {
+		return srv.getFileMetadataFromURL(ctx, src)
+	}
+
+	fileMetadata, err := srv.getFileMetadataFromAPI(ctx, src)
+	if err != nil {
+		return nil, err
 	}
 
-	return srv.getFileMetadataFromAPI(ctx, src)
+	// prefer digest calculated with the requested algorithm, if provided by the file manager
+	if fileMetadata.Algorithm == "" && fileMetadata.Tags[algorithm.tag()] != "" {
+		fileMetadata.Algorithm = algorithm
+	}
+
+	return fileMetadata, nil
 }
 
 // downloadTemplateFile and execute - returns true if file template was executed and resulted in a new dst file.
@@ -225,7 +317,7 @@ func (srv *Service) downloadTemplateFile(
 	}
 
 	defer func() {
-		if err != nil {
+		if err != nil && !reportReadOnlyMount(ctx, label, dst, err) {
 			ReportError(ctx, err, msgWithLabel(label, "Unable to render template file %s to %s.", src, dst))
 		}
 	}()
@@ -237,21 +329,27 @@ func (srv *Service) downloadTemplateFile(
 	} else {
 		cacheSrc = filepath.Join(srv.cacheDirectory, FileDistributionCacheDirectory, src)
 
-		if _, err = srv.downloadFile(ctx, label, src, cacheSrc); err != nil {
+		// file attributes and snapshots apply only to the rendered file, not to the cached template
+		cacheCtx := withFileSnapshotter(withFileAttributes(ctx, nil), nil)
+		if _, err = srv.downloadFile(cacheCtx, label, src, cacheSrc); err != nil {
 			return false, err
 		}
 	}
 
-	var sha256digest string
-	if sha256digest, err = calculateTemplateDigest(cacheSrc, params); err != nil {
+	var templateDigest fileDigest
+	if templateDigest, err = calculateTemplateDigest(cacheSrc, params, fileDigestAlgorithmFromContext(ctx)); err != nil {
 		return false, err
 	}
 
 	var fileReady bool
-	if fileReady, err = isFileReady(dst, sha256digest, ""); err != nil || fileReady {
+	if fileReady, err = isFileReady(dst, templateDigest); err != nil {
 		return false, err
 	}
 
+	if fileReady {
+		return ensureFileAttributes(ctx, label, dst)
+	}
+
 	var srcFile io.ReadCloser
 	if srcFile, err = os.Open(cacheSrc); err != nil {
 		return false, fmt.Errorf("error opening template file %s: %w", cacheSrc, err)
@@ -259,18 +357,21 @@ func (srv *Service) downloadTemplateFile(
 
 	defer srcFile.Close()
 
-	var dstFile io.WriteCloser
-	if dstFile, err = createFile(dst, fileManagerDefaultFilePermission); err != nil {
+	// snapshot is taken before the file is prepared for rewriting, so it records the original attributes
+	if _, err = snapshotFile(ctx, dst); err != nil {
 		return false, err
 	}
 
-	defer dstFile.Close()
+	// render to a temporary file first, so an interrupted render never leaves a partial file in place
+	renderFunc := func(dstFile io.Writer) error {
+		return renderTemplate(srcFile, params, dstFile)
+	}
 
-	if err = renderTemplate(srcFile, params, dstFile); err != nil {
+	if err = writeFileAtomically(dst, fileManagerDefaultFilePermission, fileAttributesFromContext(ctx), renderFunc); err != nil {
 		return false, err
 	}
 
-	ReportInfo(ctx, nil, msgWithLabel(label, "Successfully rendered template file %s to %s", src, dst))
+	reportChange(ctx, nil, msgWithLabel(label, "Successfully rendered template file %s to %s", src, dst))
 
 	return true, nil
 }
@@ -379,40 +480,72 @@ func templateScanner(data []byte, atEOF bool) (advance int, token []byte, err er
 	return 0, nil, nil
 }
 
-// calculateTemplateDigest calculate SHA256 digest of a rendered template.
-func calculateTemplateDigest(src string, params map[string]string) (string, error) {
-	digest := sha256.New()
+// calculateTemplateDigest calculates digest of a rendered template using the provided algorithm.
+func calculateTemplateDigest(src string, params map[string]string, algorithm DigestAlgorithm) (fileDigest, error) {
+	digest, err := algorithm.newHash()
+	if err != nil {
+		return fileDigest{}, err
+	}
 
 	srcFile, err := os.Open(src)
 	if err != nil {
-		return "", fmt.Errorf("error opening template file %s: %w", src, err)
+		return fileDigest{}, fmt.Errorf("error opening template file %s: %w", src, err)
 	}
 
 	defer srcFile.Close()
 
 	if err = renderTemplate(srcFile, params, digest); err != nil {
-		return "", fmt.Errorf("digest calculation of the template file %s failed: %w", src, err)
+		return fileDigest{}, fmt.Errorf("digest calculation of the template file %s failed: %w", src, err)
 	}
 
-	hexDigest := hex.EncodeToString(digest.Sum(nil))
+	return fileDigest{Algorithm: algorithm, Hex: hex.EncodeToString(digest.Sum(nil))}, nil
+}
 
-	return hexDigest, nil
+// createFile under provided path with ownership inherited from the parent directory.
+// When set, attrs override the inherited ownership and provided permission.
+func createFile(path string, permission os.FileMode, attrs *fileAttributes) (*os.File, error) {
+	return createFileFor(path, path, permission, attrs)
 }
 
-// createFile under provided path and with provided uid and gid.
-func createFile(path string, permission os.FileMode) (*os.File, error) {
-	uid, gid, err := determineFileOwner(path)
+// createFileFor creates file at path with owner and permissions determined for the dst path.
+// This allows to prepare a temporary file, which replaces dst once it's complete.
+func createFileFor(path, dst string, permission os.FileMode, attrs *fileAttributes) (*os.File, error) {
+	uid, gid, err := determineFileOwner(dst)
 	if err != nil {
 		return nil, err
 	}
 
-	if err = makeDirectories(path, fileManagerDefaultDirectoryPermission, uid, gid); err != nil {
+	if err = makeDirectories(dst, fileManagerDefaultDirectoryPermission, uid, gid); err != nil {
 		return nil, err
 	}
 
+	uid, gid = attrs.owner(uid, gid)
+	permission = attrs.permission(permission)
+
+	// immutable files cannot be rewritten, so the attribute needs to be cleared first (callers re-apply it),
+	// but only for files managed with the attribute, so it's not removed from files protected by an admin
+	if attrs.isImmutable() {
+		if _, err = setImmutable(dst, false); err != nil &&
+			!errors.Is(err, fs.ErrNotExist) && !errors.Is(err, errImmutableNotSupported) {
+			return nil, err
+		}
+	} else if immutable, _ := isImmutable(dst); immutable {
+		return nil, fmt.Errorf("cannot update %s: file has the immutable attribute set", dst)
+	}
+
+	mode := os.FileMode(0)
+	if attrs != nil && attrs.mode != 0 {
+		mode = attrs.mode
+	} else if path != dst {
+		// temporary file replaces dst, so it needs to keep the mode of the existing file
+		if fileInfo, statErr := os.Stat(dst); statErr == nil {
+			mode = fileInfo.Mode().Perm()
+		}
+	}
+
 	var file *os.File
 	if file, err = os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_TRUNC, permission); err != nil {
-		return nil, fmt.Errorf("error creating file %s: %w", path, err)
+		return nil, fmt.Errorf("error creating file %s: %w", path, readOnlyFilesystemError(path, err))
 	}
 
 	if err = file.Chown(uid, gid); err != nil {
@@ -420,40 +553,112 @@ func createFile(path string, permission os.FileMode) (*os.File, error) {
 		return nil, fmt.Errorf("error setting owner on %s: %w", path, err)
 	}
 
+	// permission is only used when file is created, so make sure existing files get the requested mode
+	if mode != 0 {
+		if err = file.Chmod(mode); err != nil {
+			_ = file.Close()
+			return nil, fmt.Errorf("error setting mode on %s: %w", path, err)
+		}
+	}
+
 	return file, nil
 }
 
-// isFileReady returns true if provided file exists and has expected contents.
-func isFileReady(path, sha256Digest, md5Digest string) (bool, error) {
+// partFileSuffix is appended to the path of a file which is being written, until it's complete.
+const partFileSuffix = ".part"
+
+// writeFileAtomically writes file contents using the write function to a temporary .part file,
+// which replaces dst only after all contents were written successfully.
+func writeFileAtomically(dst string, permission os.FileMode, attrs *fileAttributes, write func(io.Writer) error) error {
+	partPath := dst + partFileSuffix
+
+	partFile, err := createFileFor(partPath, dst, permission, attrs)
+	if err != nil {
+		return err
+	}
+
+	if err = write(partFile); err != nil {
+		_ = partFile.Close()
+		_ = os.Remove(partPath)
+		return err
+	}
+
+	if err = partFile.Close(); err != nil {
+		_ = os.Remove(partPath)
+		return fmt.Errorf("error writing file %s: %w", partPath, err)
+	}
+
+	if err = os.Rename(partPath, dst); err != nil {
+		_ = os.Remove(partPath)
+		return fmt.Errorf("error replacing file %s: %w", dst, err)
+	}
+
+	return nil
+}
+
+// syncToDisk flushes provided file and its parent directory to disk,
+// so both file contents and its directory entry survive a power loss.
+func syncToDisk(path string) error {
+	for _, syncPath := range []string{path, filepath.Dir(path)} {
+		fd, err := os.Open(syncPath)
+		if err != nil {
+			return fmt.Errorf("error opening %s: %w", syncPath, err)
+		}
+
+		err = fd.Sync()
+		_ = fd.Close()
+
+		if err != nil {
+			return fmt.Errorf("error syncing %s: %w", syncPath, err)
+		}
+	}
+
+	return nil
+}
+
+// errFileUnchanged is returned when downloaded file has the same contents as the existing one.
+var errFileUnchanged = errors.New("file unchanged")
+
+// calculateFileDigest returns digest of the provided file (empty if the file doesn't exist).
+func calculateFileDigest(path string, algorithm DigestAlgorithm) (fileDigest, error) {
 	fd, err := os.Open(path)
 	if err != nil {
 		if errors.Is(err, fs.ErrNotExist) {
-			return false, nil
+			return fileDigest{}, nil
 		}
 
-		return false, fmt.Errorf("checking if file is ready failed: %w", err)
+		return fileDigest{}, fmt.Errorf("error opening file %s: %w", path, err)
 	}
 
 	defer fd.Close()
 
-	var expectedHexDigest string
-	var digest hash.Hash
+	digest, err := calculateDigest(fd, algorithm)
+	if err != nil {
+		return fileDigest{}, fmt.Errorf("calculating local file checksum failed: %w", err)
+	}
 
-	if sha256Digest != "" {
-		expectedHexDigest = sha256Digest
-		digest = sha256.New()
-	} else {
-		expectedHexDigest = md5Digest
-		digest = md5.New()
+	return digest, nil
+}
+
+// isFileReady returns true if provided file exists and has expected contents.
+func isFileReady(path string, expected fileDigest) (bool, error) {
+	fd, err := os.Open(path)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return false, nil
+		}
+
+		return false, fmt.Errorf("checking if file is ready failed: %w", err)
 	}
 
-	if _, err = io.Copy(digest, fd); err != nil {
+	defer fd.Close()
+
+	calculated, err := calculateDigest(fd, expected.Algorithm)
+	if err != nil {
 		return false, fmt.Errorf("calculating local file checksum failed: %w", err)
 	}
 
-	calculatedHexDigest := hex.EncodeToString(digest.Sum(nil))
-
-	fileIsReady := calculatedHexDigest == expectedHexDigest
+	fileIsReady := calculated.Hex == expected.Hex
 
 	return fileIsReady, nil
 }
@@ -504,7 +709,7 @@ func makeDirectories(dst string, permissions os.FileMode, uid, gid int) error {
 		}
 
 		if err = os.Mkdir(dirPath, permissions); err != nil {
-			return fmt.Errorf("cannot create directorty %s: %w", dirPath, err)
+			return fmt.Errorf("cannot create directorty %s: %w", dirPath, readOnlyFilesystemError(dirPath, err))
 		}
 
 		if err = os.Chown(dirPath, uid, gid); err != nil {
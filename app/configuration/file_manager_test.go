@@ -19,8 +19,12 @@ package configuration
 import (
 	"bytes"
 	"fmt"
+	"io"
+	"os"
 	"path/filepath"
 	"testing"
+
+	"go.qbee.io/agent/app/utils/assert"
 )
 
 func Test_renderTemplate(t *testing.T) {
@@ -203,3 +207,56 @@ func Test_resolveDestinationPath(t *testing.T) {
 		})
 	}
 }
+
+func Test_syncToDisk(t *testing.T) {
+	filePath := filepath.Join(t.TempDir(), "file")
+
+	if err := os.WriteFile(filePath, []byte("test"), 0600); err != nil {
+		t.Fatalf("error writing test file: %v", err)
+	}
+
+	assert.NoError(t, syncToDisk(filePath))
+
+	err := syncToDisk(filepath.Join(t.TempDir(), "missing"))
+	assert.NotEqual(t, err, nil)
+}
+
+func Test_writeFileAtomically(t *testing.T) {
+	filePath := filepath.Join(t.TempDir(), "file")
+
+	if err := os.WriteFile(filePath, []byte("original"), 0604); err != nil {
+		t.Fatalf("error writing test file: %v", err)
+	}
+
+	// failed write keeps the original file in place
+	err := writeFileAtomically(filePath, fileManagerDefaultFilePermission, nil, func(w io.Writer) error {
+		_, _ = w.Write([]byte("partial"))
+		return fmt.Errorf("interrupted")
+	})
+	assert.Equal(t, err.Error(), "interrupted")
+
+	contents, err := os.ReadFile(filePath)
+	assert.NoError(t, err)
+	assert.Equal(t, string(contents), "original")
+
+	_, err = os.Stat(filePath + partFileSuffix)
+	assert.True(t, os.IsNotExist(err))
+
+	// successful write replaces the file and keeps its mode
+	err = writeFileAtomically(filePath, fileManagerDefaultFilePermission, nil, func(w io.Writer) error {
+		_, writeErr := w.Write([]byte("rendered"))
+		return writeErr
+	})
+	assert.NoError(t, err)
+
+	contents, err = os.ReadFile(filePath)
+	assert.NoError(t, err)
+	assert.Equal(t, string(contents), "rendered")
+
+	fileInfo, err := os.Stat(filePath)
+	assert.NoError(t, err)
+	assert.Equal(t, fileInfo.Mode().Perm(), os.FileMode(0604))
+
+	_, err = os.Stat(filePath + partFileSuffix)
+	assert.True(t, os.IsNotExist(err))
+}
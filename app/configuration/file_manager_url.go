@@ -0,0 +1,185 @@
+// Copyright 2024 qbee.io
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package configuration
+
+import (
+	"context"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"net/http"
+	"regexp"
+	"strings"
+)
+
+const (
+	httpFileSchema  = "http://"
+	httpsFileSchema = "https://"
+
+	checksumSHA256Header = "X-Checksum-Sha256"
+)
+
+const (
+	ctxFileDigest          = contextKey("configuration:file-digest")
+	ctxFileDigestAlgorithm = contextKey("configuration:file-digest-algorithm")
+)
+
+var sha256HexRE = regexp.MustCompile(`^[0-9a-f]{64}$`)
+
+// isURLSource returns true if the file source is an HTTP(S) URL.
+func isURLSource(src string) bool {
+	return strings.HasPrefix(src, httpsFileSchema) || strings.HasPrefix(src, httpFileSchema)
+}
+
+// withFileDigest returns context with expected digest of the downloaded file.
+func withFileDigest(ctx context.Context, digest fileDigest) context.Context {
+	return context.WithValue(ctx, ctxFileDigest, digest)
+}
+
+// fileDigestFromContext returns expected digest of the downloaded file (empty if not set).
+func fileDigestFromContext(ctx context.Context) fileDigest {
+	digest, _ := ctx.Value(ctxFileDigest).(fileDigest)
+	return digest
+}
+
+// withFileDigestAlgorithm returns context with algorithm used to calculate digests of the distributed file.
+func withFileDigestAlgorithm(ctx context.Context, algorithm DigestAlgorithm) context.Context {
+	return context.WithValue(ctx, ctxFileDigestAlgorithm, algorithm)
+}
+
+// fileDigestAlgorithmFromContext returns algorithm used to calculate digests of the distributed file.
+// Algorithm of the expected digest takes precedence, defaulting to SHA256 when none is set.
+func fileDigestAlgorithmFromContext(ctx context.Context) DigestAlgorithm {
+	if digest := fileDigestFromContext(ctx); digest.Algorithm != "" {
+		return digest.Algorithm
+	}
+
+	if algorithm, _ := ctx.Value(ctxFileDigestAlgorithm).(DigestAlgorithm); algorithm != "" {
+		return algorithm
+	}
+
+	return defaultDigestAlgorithm
+}
+
+// getFileMetadataFromURL returns metadata for a file available under HTTP(S) URL.
+// File checksum is taken from the expected digest (if set in context) or X-Checksum-Sha256 response header.
+// ETags are opaque and not treated as checksums, so without a checksum the metadata has no digest.
+func (srv *Service) getFileMetadataFromURL(ctx context.Context, src string) (*FileMetadata, error) {
+	response, err := srv.requestURL(ctx, http.MethodHead, src)
+	if err != nil {
+		return nil, err
+	}
+
+	_ = response.Body.Close()
+
+	fileMetadata := &FileMetadata{
+		Tags: make(map[string]string),
+	}
+
+	if lastModified, err := http.ParseTime(response.Header.Get("Last-Modified")); err == nil {
+		fileMetadata.LastModified = lastModified.Unix()
+	}
+
+	switch checksum := strings.ToLower(response.Header.Get(checksumSHA256Header)); {
+	case fileDigestFromContext(ctx).Hex != "":
+		expectedDigest := fileDigestFromContext(ctx)
+		fileMetadata.Tags[expectedDigest.Algorithm.tag()] = expectedDigest.Hex
+		fileMetadata.Algorithm = expectedDigest.Algorithm
+	case sha256HexRE.MatchString(checksum):
+		fileMetadata.Tags[fileDigestSHA256Tag] = checksum
+	}
+
+	return fileMetadata, nil
+}
+
+// getFileFromURL returns file reader for a file available under HTTP(S) URL.
+// When expected digest is set in context, reading the file fails if its contents don't match the digest.
+func (srv *Service) getFileFromURL(ctx context.Context, src string) (io.ReadCloser, error) {
+	response, err := srv.requestURL(ctx, http.MethodGet, src)
+	if err != nil {
+		return nil, err
+	}
+
+	expectedDigest := fileDigestFromContext(ctx)
+	if expectedDigest.Hex == "" {
+		return response.Body, nil
+	}
+
+	digest, err := expectedDigest.Algorithm.newHash()
+	if err != nil {
+		_ = response.Body.Close()
+		return nil, err
+	}
+
+	return &digestVerifyingReader{
+		ReadCloser: response.Body,
+		src:        src,
+		digest:     digest,
+		expected:   expectedDigest.Hex,
+	}, nil
+}
+
+// requestURL sends HTTP request to the URL and returns response with 2xx status code.
+func (srv *Service) requestURL(ctx context.Context, method, src string) (*http.Response, error) {
+	request, err := http.NewRequestWithContext(ctx, method, src, nil)
+	if err != nil {
+		return nil, fmt.Errorf("error creating request for %s: %w", src, err)
+	}
+
+	var response *http.Response
+	if response, err = srv.httpClient.Do(request); err != nil {
+		downloadErr := &downloadError{origin: urlOrigin(src), connection: true, err: err}
+		return nil, fmt.Errorf("error getting file %s: %w", src, downloadErr)
+	}
+
+	if response.StatusCode < http.StatusOK || response.StatusCode >= http.StatusMultipleChoices {
+		_ = response.Body.Close()
+
+		downloadErr := &downloadError{
+			origin:     urlOrigin(src),
+			statusCode: response.StatusCode,
+			err:        fmt.Errorf("unexpected response status %s", response.Status),
+		}
+
+		return nil, fmt.Errorf("error getting file %s: %w", src, downloadErr)
+	}
+
+	return response, nil
+}
+
+// digestVerifyingReader returns an error at the end of the stream if read data doesn't match the expected digest.
+type digestVerifyingReader struct {
+	io.ReadCloser
+	src      string
+	digest   hash.Hash
+	expected string
+}
+
+// Read data from the underlying reader and verify digest when all data was read.
+func (reader *digestVerifyingReader) Read(p []byte) (int, error) {
+	n, err := reader.ReadCloser.Read(p)
+	reader.digest.Write(p[:n])
+
+	if err == io.EOF {
+		if calculated := hex.EncodeToString(reader.digest.Sum(nil)); calculated != reader.expected {
+			return n, fmt.Errorf("digest mismatch for %s: expected %s, got %s", reader.src, reader.expected, calculated)
+		}
+	}
+
+	return n, err
+}
@@ -0,0 +1,172 @@
+// Copyright 2024 qbee.io
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package configuration
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"go.qbee.io/agent/app/api"
+	"go.qbee.io/agent/app/utils/assert"
+)
+
+func TestService_getFileFromURL(t *testing.T) {
+	contents := []byte("file contents")
+	digest := sha256.Sum256(contents)
+	hexDigest := hex.EncodeToString(digest[:])
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/checksum", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set(checksumSHA256Header, hexDigest)
+		_, _ = w.Write(contents)
+	})
+	mux.HandleFunc("/etag", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("ETag", `"0123456789abcdef0123456789abcdef"`)
+		_, _ = w.Write(contents)
+	})
+	mux.HandleFunc("/plain", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write(contents)
+	})
+
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	srv := &Service{httpClient: api.NewHTTPClient()}
+	ctx := context.Background()
+
+	t.Run("checksum header", func(t *testing.T) {
+		metadata, err := srv.getFileMetadata(ctx, server.URL+"/checksum")
+		assert.NoError(t, err)
+		assert.Equal(t, metadata.SHA256(), hexDigest)
+	})
+
+	t.Run("etag is not a checksum", func(t *testing.T) {
+		metadata, err := srv.getFileMetadata(ctx, server.URL+"/etag")
+		assert.NoError(t, err)
+		assert.Equal(t, metadata.Digest().Hex, "")
+	})
+
+	t.Run("no checksum", func(t *testing.T) {
+		metadata, err := srv.getFileMetadata(ctx, server.URL+"/plain")
+		assert.NoError(t, err)
+		assert.Equal(t, metadata.Digest().Hex, "")
+
+		metadata, err = srv.getFileMetadata(withFileDigest(ctx, fileDigest{Algorithm: DigestSHA256, Hex: hexDigest}), server.URL+"/plain")
+		assert.NoError(t, err)
+		assert.Equal(t, metadata.SHA256(), hexDigest)
+	})
+
+	t.Run("not found", func(t *testing.T) {
+		_, err := srv.getFile(ctx, server.URL+"/missing")
+		assert.Equal(t, downloadErrorSummary(err), fmt.Sprintf(" (request rejected by %s (HTTP 404))", server.URL))
+	})
+
+	t.Run("matching digest", func(t *testing.T) {
+		reader, err := srv.getFile(withFileDigest(ctx, fileDigest{Algorithm: DigestSHA256, Hex: hexDigest}), server.URL+"/plain")
+		assert.NoError(t, err)
+		defer reader.Close()
+
+		data, err := io.ReadAll(reader)
+		assert.NoError(t, err)
+		assert.Equal(t, data, contents)
+	})
+
+	t.Run("digest mismatch", func(t *testing.T) {
+		otherDigest := sha256.Sum256([]byte("other"))
+
+		reader, err := srv.getFile(withFileDigest(ctx, fileDigest{Algorithm: DigestSHA256, Hex: hex.EncodeToString(otherDigest[:])}), server.URL+"/plain")
+		assert.NoError(t, err)
+		defer reader.Close()
+
+		if _, err = io.ReadAll(reader); err == nil {
+			t.Fatalf("expected digest mismatch error")
+		}
+	})
+}
+
+func TestService_downloadFile_URL(t *testing.T) {
+	contents := []byte("file contents")
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/plain", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write(contents)
+	})
+
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	srv := &Service{httpClient: api.NewHTTPClient()}
+	ctx := context.Background()
+	dst := filepath.Join(t.TempDir(), "file")
+
+	t.Run("digest mismatch keeps existing file", func(t *testing.T) {
+		assert.NoError(t, os.WriteFile(dst, []byte("existing"), 0600))
+
+		otherDigest := sha256.Sum256([]byte("other"))
+		digestCtx := withFileDigest(ctx, fileDigest{Algorithm: DigestSHA256, Hex: hex.EncodeToString(otherDigest[:])})
+
+		if _, err := srv.downloadFile(digestCtx, "", server.URL+"/plain", dst); err == nil {
+			t.Fatalf("expected digest mismatch error")
+		}
+
+		data, err := os.ReadFile(dst)
+		assert.NoError(t, err)
+		assert.Equal(t, string(data), "existing")
+
+		_, err = os.Stat(dst + partFileSuffix)
+		assert.Equal(t, os.IsNotExist(err), true)
+	})
+
+	t.Run("without checksum file is compared with existing one", func(t *testing.T) {
+		created, err := srv.downloadFile(ctx, "", server.URL+"/plain", dst)
+		assert.NoError(t, err)
+		assert.Equal(t, created, true)
+
+		created, err = srv.downloadFile(ctx, "", server.URL+"/plain", dst)
+		assert.NoError(t, err)
+		assert.Equal(t, created, false)
+
+		data, err := os.ReadFile(dst)
+		assert.NoError(t, err)
+		assert.Equal(t, data, contents)
+	})
+}
+
+func Test_parseFileDigest(t *testing.T) {
+	hexDigest := "9f86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00a08"
+	expected := fileDigest{Algorithm: DigestSHA256, Hex: hexDigest}
+
+	for _, digest := range []string{hexDigest, "sha256:" + hexDigest} {
+		got, err := parseFileDigest(digest, "")
+		assert.NoError(t, err)
+		assert.Equal(t, got, expected)
+	}
+
+	for _, digest := range []string{"", "md5:0123456789abcdef0123456789abcdef", hexDigest[1:]} {
+		if _, err := parseFileDigest(digest, ""); err == nil {
+			t.Fatalf("expected error for digest %s", digest)
+		}
+	}
+}
@@ -0,0 +1,315 @@
+// Copyright 2023 qbee.io
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package configuration
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"syscall"
+)
+
+// fileSnapshotDirectory is the cache subdirectory where previous versions of files are kept
+// until a transactional file set succeeds.
+const fileSnapshotDirectory = "file_snapshots"
+
+const fileSnapshotDirectoryPermission = 0700
+
+const ctxFileSnapshotter = contextKey("configuration:file-snapshotter")
+
+// fileSnapshot keeps the previous version of a file, so it can be restored when a transactional file set fails.
+// Symbolic links are replaced (not followed) when a file is rewritten, so for them only the link target is kept.
+type fileSnapshot struct {
+	path         string
+	snapshotPath string
+	existed      bool
+	wasImmutable bool
+	linkTarget   string
+	mode         os.FileMode
+	uid          int
+	gid          int
+}
+
+// takeFileSnapshot copies the file at path (if it exists) to the snapshot directory and records its mode and ownership.
+func takeFileSnapshot(path, directory string) (*fileSnapshot, error) {
+	pathDigest := sha256.Sum256([]byte(path))
+
+	snapshot := &fileSnapshot{
+		path:         path,
+		snapshotPath: filepath.Join(directory, hex.EncodeToString(pathDigest[:])),
+		uid:          -1,
+		gid:          -1,
+	}
+
+	fileInfo, err := os.Lstat(path)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return snapshot, nil
+		}
+		return nil, fmt.Errorf("cannot check file %s: %w", path, err)
+	}
+
+	isSymlink := fileInfo.Mode()&fs.ModeSymlink != 0
+	if !isSymlink && !fileInfo.Mode().IsRegular() {
+		return nil, fmt.Errorf("cannot snapshot %s: not a regular file", path)
+	}
+
+	snapshot.existed = true
+
+	if fileStat, ok := fileInfo.Sys().(*syscall.Stat_t); ok {
+		snapshot.uid, snapshot.gid = int(fileStat.Uid), int(fileStat.Gid)
+	}
+
+	if isSymlink {
+		if snapshot.linkTarget, err = os.Readlink(path); err != nil {
+			return nil, fmt.Errorf("cannot read symbolic link %s: %w", path, err)
+		}
+		return snapshot, nil
+	}
+
+	snapshot.mode = fileInfo.Mode().Perm()
+	// errors are ignored, since filesystem might not support the attribute
+	snapshot.wasImmutable, _ = isImmutable(path)
+
+	if err = os.MkdirAll(directory, fileSnapshotDirectoryPermission); err != nil {
+		return nil, fmt.Errorf("cannot create snapshot directory %s: %w", directory, err)
+	}
+
+	if err = copyFile(path, snapshot.snapshotPath, 0600); err != nil {
+		return nil, err
+	}
+
+	return snapshot, nil
+}
+
+// copyFile copies contents of src to a new dst file with provided permission.
+// Incomplete dst file is removed on error.
+func copyFile(src, dst string, permission os.FileMode) error {
+	srcFile, err := os.Open(src)
+	if err != nil {
+		return fmt.Errorf("cannot open file %s: %w", src, err)
+	}
+	defer srcFile.Close()
+
+	dstFile, err := os.OpenFile(dst, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, permission)
+	if err != nil {
+		return fmt.Errorf("cannot create file %s: %w", dst, err)
+	}
+
+	if _, err = io.Copy(dstFile, srcFile); err != nil {
+		_ = dstFile.Close()
+		_ = os.Remove(dst)
+		return fmt.Errorf("cannot write file %s: %w", dst, err)
+	}
+
+	if err = dstFile.Close(); err != nil {
+		_ = os.Remove(dst)
+		return fmt.Errorf("cannot write file %s: %w", dst, err)
+	}
+
+	return nil
+}
+
+// restore the previous version of the file (or remove the file, if it didn't exist before).
+// Snapshot is copied next to the file first, so the file is replaced atomically.
+func (snapshot *fileSnapshot) restore() error {
+	if _, err := setImmutable(snapshot.path, false); err != nil &&
+		!errors.Is(err, fs.ErrNotExist) && !errors.Is(err, errImmutableNotSupported) {
+		return fmt.Errorf("cannot clear immutable attribute on %s: %w", snapshot.path, err)
+	}
+
+	if !snapshot.existed {
+		if err := os.Remove(snapshot.path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return fmt.Errorf("cannot remove file %s: %w", snapshot.path, err)
+		}
+		return nil
+	}
+
+	partPath := snapshot.path + partFileSuffix
+
+	if snapshot.linkTarget != "" {
+		return snapshot.restoreSymlink(partPath)
+	}
+
+	if err := copyFile(snapshot.snapshotPath, partPath, snapshot.mode); err != nil {
+		return fmt.Errorf("cannot restore file %s: %w", snapshot.path, err)
+	}
+
+	// permissions are set explicitly, since file creation mode is affected by umask
+	if err := os.Chmod(partPath, snapshot.mode); err != nil {
+		_ = os.Remove(partPath)
+		return fmt.Errorf("cannot set file permissions %s: %w", partPath, err)
+	}
+
+	if err := os.Chown(partPath, snapshot.uid, snapshot.gid); err != nil {
+		_ = os.Remove(partPath)
+		return fmt.Errorf("cannot set file owner %s: %w", partPath, err)
+	}
+
+	if err := os.Rename(partPath, snapshot.path); err != nil {
+		_ = os.Remove(partPath)
+		return fmt.Errorf("cannot restore file %s: %w", snapshot.path, err)
+	}
+
+	if snapshot.wasImmutable {
+		if _, err := setImmutable(snapshot.path, true); err != nil {
+			return fmt.Errorf("cannot set immutable attribute on %s: %w", snapshot.path, err)
+		}
+	}
+
+	return snapshot.discard()
+}
+
+// restoreSymlink recreates the symbolic link at partPath first, so the file is replaced atomically.
+func (snapshot *fileSnapshot) restoreSymlink(partPath string) error {
+	if err := os.Remove(partPath); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("cannot remove file %s: %w", partPath, err)
+	}
+
+	if err := os.Symlink(snapshot.linkTarget, partPath); err != nil {
+		return fmt.Errorf("cannot restore symbolic link %s: %w", snapshot.path, err)
+	}
+
+	if err := os.Lchown(partPath, snapshot.uid, snapshot.gid); err != nil {
+		_ = os.Remove(partPath)
+		return fmt.Errorf("cannot set symbolic link owner %s: %w", partPath, err)
+	}
+
+	if err := os.Rename(partPath, snapshot.path); err != nil {
+		_ = os.Remove(partPath)
+		return fmt.Errorf("cannot restore symbolic link %s: %w", snapshot.path, err)
+	}
+
+	return nil
+}
+
+// discard the file copy.
+func (snapshot *fileSnapshot) discard() error {
+	if !snapshot.existed || snapshot.linkTarget != "" {
+		return nil
+	}
+
+	if err := os.Remove(snapshot.snapshotPath); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("cannot remove snapshot file %s: %w", snapshot.snapshotPath, err)
+	}
+
+	return nil
+}
+
+// fileSnapshots keeps snapshots of files changed by a transactional file set.
+type fileSnapshots []*fileSnapshot
+
+// has returns true if the file at path was already snapshotted.
+func (snapshots fileSnapshots) has(path string) bool {
+	for _, snapshot := range snapshots {
+		if snapshot.path == path {
+			return true
+		}
+	}
+
+	return false
+}
+
+// discard all file copies after the file set succeeded.
+func (snapshots fileSnapshots) discard(ctx context.Context, label string) {
+	for _, snapshot := range snapshots {
+		if err := snapshot.discard(); err != nil {
+			ReportWarning(ctx, err, msgWithLabel(label, "Unable to remove snapshot of %s", snapshot.path))
+		}
+	}
+}
+
+// rollback restores all files in reverse order of changes. Returns true if all files were restored.
+func (snapshots fileSnapshots) rollback(ctx context.Context, label string) bool {
+	restored := true
+
+	for i := len(snapshots) - 1; i >= 0; i-- {
+		if err := snapshots[i].restore(); err != nil {
+			ReportError(ctx, err, msgWithLabel(label, "Unable to restore previous version of %s", snapshots[i].path))
+			restored = false
+		}
+	}
+
+	return restored
+}
+
+// fileSnapshotter takes snapshots of files right before they are rewritten by a transactional file set.
+type fileSnapshotter struct {
+	directory string
+	snapshots fileSnapshots
+}
+
+// snapshot the file at path, unless it was already snapshotted. Returns nil snapshot if no new snapshot was taken.
+func (snapshotter *fileSnapshotter) snapshot(path string) (*fileSnapshot, error) {
+	if snapshotter.snapshots.has(path) {
+		return nil, nil
+	}
+
+	snapshot, err := takeFileSnapshot(path, snapshotter.directory)
+	if err != nil {
+		return nil, err
+	}
+
+	snapshotter.snapshots = append(snapshotter.snapshots, snapshot)
+
+	return snapshot, nil
+}
+
+// drop the snapshot of a file which turned out not to need any changes.
+func (snapshotter *fileSnapshotter) drop(snapshot *fileSnapshot) error {
+	for i := range snapshotter.snapshots {
+		if snapshotter.snapshots[i] == snapshot {
+			snapshotter.snapshots = append(snapshotter.snapshots[:i], snapshotter.snapshots[i+1:]...)
+			break
+		}
+	}
+
+	return snapshot.discard()
+}
+
+// withFileSnapshotter returns context with snapshotter used before files are rewritten.
+func withFileSnapshotter(ctx context.Context, snapshotter *fileSnapshotter) context.Context {
+	return context.WithValue(ctx, ctxFileSnapshotter, snapshotter)
+}
+
+// snapshotFile takes a snapshot of the file at path, when context has a snapshotter set.
+// Snapshot must be taken before the file is prepared for rewriting (e.g. its immutable attribute is cleared).
+// Returns nil snapshot if no new snapshot was taken.
+func snapshotFile(ctx context.Context, path string) (*fileSnapshot, error) {
+	snapshotter, _ := ctx.Value(ctxFileSnapshotter).(*fileSnapshotter)
+	if snapshotter == nil {
+		return nil, nil
+	}
+
+	return snapshotter.snapshot(path)
+}
+
+// dropFileSnapshot drops the snapshot taken by snapshotFile, when the file was left unchanged.
+func dropFileSnapshot(ctx context.Context, snapshot *fileSnapshot) error {
+	snapshotter, _ := ctx.Value(ctxFileSnapshotter).(*fileSnapshotter)
+	if snapshotter == nil || snapshot == nil {
+		return nil
+	}
+
+	return snapshotter.drop(snapshot)
+}
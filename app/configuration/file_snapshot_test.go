@@ -0,0 +1,214 @@
+// Copyright 2023 qbee.io
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package configuration
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"go.qbee.io/agent/app/utils/assert"
+)
+
+func Test_fileSnapshot(t *testing.T) {
+	dir := t.TempDir()
+
+	existingPath := filepath.Join(dir, "existing")
+	if err := os.WriteFile(existingPath, []byte("old"), 0640); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	newPath := filepath.Join(dir, "new")
+	snapshotDirectory := filepath.Join(t.TempDir(), fileSnapshotDirectory)
+
+	existing, err := takeFileSnapshot(existingPath, snapshotDirectory)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	created, err := takeFileSnapshot(newPath, snapshotDirectory)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	for _, path := range []string{existingPath, newPath} {
+		if err = os.WriteFile(path, []byte("new"), 0600); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+
+	reporter := NewReporter("", false, nil)
+	ctx := reporter.BundleContext(context.Background(), "", "")
+
+	assert.Equal(t, fileSnapshots{existing, created}.rollback(ctx, ""), true)
+	assert.Equal(t, len(reporter.reports), 0)
+
+	data, err := os.ReadFile(existingPath)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	assert.Equal(t, string(data), "old")
+
+	fileInfo, err := os.Stat(existingPath)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	assert.Equal(t, fileInfo.Mode().Perm(), os.FileMode(0640))
+
+	if _, err = os.Stat(newPath); !os.IsNotExist(err) {
+		t.Fatalf("expected %s to be removed, got %v", newPath, err)
+	}
+
+	if _, err = os.Stat(existing.snapshotPath); !os.IsNotExist(err) {
+		t.Fatalf("expected snapshot to be removed, got %v", err)
+	}
+}
+
+func Test_fileSnapshot_Symlink(t *testing.T) {
+	dir := t.TempDir()
+
+	targetPath := filepath.Join(dir, "target")
+	if err := os.WriteFile(targetPath, []byte("old"), 0640); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	linkPath := filepath.Join(dir, "link")
+	if err := os.Symlink(targetPath, linkPath); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	snapshot, err := takeFileSnapshot(linkPath, filepath.Join(t.TempDir(), fileSnapshotDirectory))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// rewriting the file replaces the link, while the link target is left intact
+	err = writeFileAtomically(linkPath, 0600, nil, func(w io.Writer) error {
+		_, writeErr := w.Write([]byte("new"))
+		return writeErr
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if err = snapshot.restore(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	linkTarget, err := os.Readlink(linkPath)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	assert.Equal(t, linkTarget, targetPath)
+
+	data, err := os.ReadFile(linkPath)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	assert.Equal(t, string(data), "old")
+}
+
+func Test_takeFileSnapshot_NotRegularFile(t *testing.T) {
+	if _, err := takeFileSnapshot(t.TempDir(), t.TempDir()); err == nil {
+		t.Fatalf("expected error")
+	}
+}
+
+func TestFileSet_execute_Transactional(t *testing.T) {
+	dir := t.TempDir()
+
+	srcPath := filepath.Join(dir, "src")
+	dstPath := filepath.Join(dir, "dst")
+
+	for path, contents := range map[string]string{srcPath: "new", dstPath: "old"} {
+		if err := os.WriteFile(path, []byte(contents), 0600); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+
+	cacheDirectory := t.TempDir()
+	srv := New(nil, dir, cacheDirectory)
+
+	fileSet := FileSet{
+		Files:         []File{{Source: "file://" + srcPath, Destination: dstPath}},
+		AfterCommand:  fmt.Sprintf("grep -q old %s", dstPath),
+		Transactional: true,
+	}
+
+	reporter := NewReporter("", false, nil)
+	ctx := reporter.BundleContext(context.Background(), "", "")
+	ctx = new(ParametersBundle).Context(ctx, nil)
+
+	if err := fileSet.execute(ctx, srv); err == nil {
+		t.Fatalf("expected error")
+	}
+
+	reports := make([]string, 0, len(reporter.reports))
+	for _, report := range reporter.reports {
+		reports = append(reports, report.String())
+	}
+
+	expectedReports := []string{
+		fmt.Sprintf("[INFO] Successfully downloaded file file://%s to %s", srcPath, dstPath),
+		"[ERR] After command failed: exit status 1",
+		"[WARN] Rolled back 1 changed file(s) to previous versions",
+		"[INFO] Successfully executed after command after rollback",
+	}
+	assert.Equal(t, reports, expectedReports)
+
+	data, err := os.ReadFile(dstPath)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	assert.Equal(t, string(data), "old")
+
+	// snapshots are kept in the cache directory, not next to the managed files
+	snapshots, err := os.ReadDir(filepath.Join(cacheDirectory, fileSnapshotDirectory))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	assert.Equal(t, len(snapshots), 0)
+
+	// unchanged files are not rewritten and don't take snapshots
+	fileSet.AfterCommand = ""
+	fileSet.Files[0].Source = "file://" + dstPath
+	fileSet.Files[0].Destination = srcPath
+
+	if err = os.WriteFile(srcPath, []byte("old"), 0600); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	reporter.reports = nil
+	if err = fileSet.execute(ctx, srv); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	assert.Equal(t, len(reporter.reports), 0)
+
+	if snapshots, err = os.ReadDir(filepath.Join(cacheDirectory, fileSnapshotDirectory)); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	assert.Equal(t, len(snapshots), 0)
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	assert.Equal(t, len(entries), 2)
+}
@@ -0,0 +1,168 @@
+// Copyright 2024 qbee.io
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package configuration
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"syscall"
+)
+
+// Symlink defines a symbolic link to be maintained in the filesystem.
+type Symlink struct {
+	// Target defines the path the symlink points to.
+	Target string `json:"target"`
+
+	// LinkPath defines absolute path of the symlink.
+	LinkPath string `json:"link_path"`
+
+	// Force allows to replace a regular file existing at LinkPath with the symlink.
+	Force bool `json:"force,omitempty"`
+
+	// Owner defines user name or uid of the symlink owner (defaults to the owner of the parent directory).
+	Owner string `json:"owner,omitempty"`
+
+	// Group defines group name or gid of the symlink (defaults to the group of the parent directory).
+	Group string `json:"group,omitempty"`
+}
+
+// ensure makes sure that the symlink exists and points to the configured target.
+// Returns true if the symlink was created or changed.
+func (s Symlink) ensure(ctx context.Context, label string) (bool, error) {
+	target := s.Target
+	linkPath := s.LinkPath
+
+	if target == "" || !filepath.IsAbs(linkPath) {
+		err := fmt.Errorf("symlink requires a target and an absolute link path")
+		ReportError(ctx, err, msgWithLabel(label, "Invalid symlink %s -> %s", linkPath, target))
+		return false, err
+	}
+
+	uid, gid, err := s.owner(linkPath)
+	if err != nil {
+		ReportError(ctx, err, msgWithLabel(label, "Unable to determine owner of symlink %s", linkPath))
+		return false, err
+	}
+
+	var currentTarget string
+	var isRegularFile bool
+
+	linkInfo, err := os.Lstat(linkPath)
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+	case err != nil:
+		ReportError(ctx, err, msgWithLabel(label, "Unable to check symlink %s", linkPath))
+		return false, err
+	case linkInfo.Mode()&os.ModeSymlink != 0:
+		if currentTarget, err = os.Readlink(linkPath); err != nil {
+			ReportError(ctx, err, msgWithLabel(label, "Unable to read symlink %s", linkPath))
+			return false, err
+		}
+
+		if currentTarget == target && symlinkOwnerMatches(linkInfo, uid, gid) {
+			return false, nil
+		}
+	case linkInfo.IsDir():
+		err = fmt.Errorf("%s is a directory", linkPath)
+		ReportError(ctx, err, msgWithLabel(label, "Unable to create symlink %s", linkPath))
+		return false, err
+	case !s.Force:
+		err = fmt.Errorf("%s exists and is not a symlink", linkPath)
+		ReportError(ctx, err, msgWithLabel(label, "Unable to create symlink %s, use force to replace the file", linkPath))
+		return false, err
+	default:
+		isRegularFile = true
+	}
+
+	if err = createSymlink(target, linkPath, uid, gid); err != nil {
+		ReportError(ctx, err, msgWithLabel(label, "Unable to create symlink %s", linkPath))
+		return false, err
+	}
+
+	switch {
+	case isRegularFile:
+		reportChange(ctx, nil, msgWithLabel(label, "Replaced file %s with symlink to %s", linkPath, target))
+	case currentTarget == "":
+		reportChange(ctx, nil, msgWithLabel(label, "Created symlink %s -> %s", linkPath, target))
+	case currentTarget != target:
+		reportChange(ctx, nil, msgWithLabel(label, "Updated symlink %s -> %s (was %s)", linkPath, target, currentTarget))
+	default:
+		reportChange(ctx, nil, msgWithLabel(label, "Updated ownership of symlink %s", linkPath))
+	}
+
+	return true, nil
+}
+
+// owner returns uid and gid for the symlink at linkPath.
+func (s Symlink) owner(linkPath string) (int, int, error) {
+	uid, gid, err := determineFileOwner(filepath.Dir(linkPath))
+	if err != nil {
+		return 0, 0, err
+	}
+
+	attrs, err := FileAttributes{Owner: s.Owner, Group: s.Group}.resolve()
+	if err != nil {
+		return 0, 0, err
+	}
+
+	uid, gid = attrs.owner(uid, gid)
+
+	return uid, gid, nil
+}
+
+// symlinkOwnerMatches returns true if the symlink is owned by the provided uid and gid.
+func symlinkOwnerMatches(linkInfo os.FileInfo, uid, gid int) bool {
+	linkStat, ok := linkInfo.Sys().(*syscall.Stat_t)
+	if !ok {
+		return true
+	}
+
+	return int(linkStat.Uid) == uid && int(linkStat.Gid) == gid
+}
+
+// createSymlink atomically creates (or replaces) the symlink at linkPath pointing to target.
+func createSymlink(target, linkPath string, uid, gid int) error {
+	if err := makeDirectories(linkPath, fileManagerDefaultDirectoryPermission, uid, gid); err != nil {
+		return err
+	}
+
+	partPath := linkPath + partFileSuffix
+
+	if err := os.Remove(partPath); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("cannot remove %s: %w", partPath, err)
+	}
+
+	if err := os.Symlink(target, partPath); err != nil {
+		return fmt.Errorf("cannot create symlink %s: %w", partPath, err)
+	}
+
+	if err := os.Lchown(partPath, uid, gid); err != nil {
+		_ = os.Remove(partPath)
+		return fmt.Errorf("cannot change owner of %s: %w", partPath, err)
+	}
+
+	if err := os.Rename(partPath, linkPath); err != nil {
+		_ = os.Remove(partPath)
+		return fmt.Errorf("cannot replace %s: %w", linkPath, err)
+	}
+
+	return nil
+}
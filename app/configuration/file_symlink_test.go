@@ -0,0 +1,85 @@
+// Copyright 2024 qbee.io
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package configuration
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"go.qbee.io/agent/app/utils/assert"
+)
+
+func TestSymlink_ensure(t *testing.T) {
+	dir := t.TempDir()
+	linkPath := filepath.Join(dir, "app", "current")
+
+	reporter := NewReporter("", false, nil)
+	ctx := reporter.BundleContext(context.Background(), "", "")
+
+	ensure := func(symlink Symlink) (bool, error) {
+		reporter.reports = nil
+		return symlink.ensure(ctx, "")
+	}
+
+	assertTarget := func(expectedTarget string) {
+		target, err := os.Readlink(linkPath)
+		assert.NoError(t, err)
+		assert.Equal(t, target, expectedTarget)
+	}
+
+	// symlink is created (including missing parent directories)
+	changed, err := ensure(Symlink{Target: "releases/1", LinkPath: linkPath})
+	assert.NoError(t, err)
+	assert.True(t, changed)
+	assert.Equal(t, reporter.reports[0].Text, "Created symlink "+linkPath+" -> releases/1")
+	assertTarget("releases/1")
+
+	// nothing changes when the symlink already points to the target
+	changed, err = ensure(Symlink{Target: "releases/1", LinkPath: linkPath})
+	assert.NoError(t, err)
+	assert.False(t, changed)
+	assert.Empty(t, reporter.reports)
+
+	// symlink is updated when the target changes
+	changed, err = ensure(Symlink{Target: "releases/2", LinkPath: linkPath})
+	assert.NoError(t, err)
+	assert.True(t, changed)
+	assert.Equal(t, reporter.reports[0].Text, "Updated symlink "+linkPath+" -> releases/2 (was releases/1)")
+	assertTarget("releases/2")
+
+	// regular file is not replaced without force
+	assert.NoError(t, os.Remove(linkPath))
+	assert.NoError(t, os.WriteFile(linkPath, []byte("data"), 0600))
+
+	changed, err = ensure(Symlink{Target: "releases/2", LinkPath: linkPath})
+	assert.Equal(t, err.Error(), linkPath+" exists and is not a symlink")
+	assert.False(t, changed)
+
+	// regular file is replaced with force
+	changed, err = ensure(Symlink{Target: "releases/2", LinkPath: linkPath, Force: true})
+	assert.NoError(t, err)
+	assert.True(t, changed)
+	assert.Equal(t, reporter.reports[0].Text, "Replaced file "+linkPath+" with symlink to releases/2")
+	assertTarget("releases/2")
+
+	// directories are never replaced
+	changed, err = ensure(Symlink{Target: "releases/2", LinkPath: dir, Force: true})
+	assert.Equal(t, err.Error(), dir+" is a directory")
+	assert.False(t, changed)
+}
@@ -0,0 +1,152 @@
+// Copyright 2024 qbee.io
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package configuration
+
+import (
+	"strconv"
+	"strings"
+)
+
+// firewallEstablishedRule accepts packets of established connections (including the agent's control connection).
+// It must always be the first rule of the filter/INPUT chain.
+const firewallEstablishedRule = "-A INPUT -m conntrack --ctstate RELATED,ESTABLISHED -j ACCEPT"
+
+// firewallChainDiff returns iptables arguments (without binary and table) which transform current rules of the chain
+// (as listed by `iptables -S <chain>`) into the expected ones (as rendered with policy first).
+// Rules are deleted and inserted by their line numbers, so unchanged rules are never removed from the chain.
+// Returns false when the diff cannot be computed safely and the chain must be flushed instead.
+func firewallChainDiff(chain FirewallChainName, current, expected []string, pinEstablished bool) ([][]string, bool) {
+	currentPolicy, currentRules, ok := parseFirewallChainRules(chain, current)
+	if !ok {
+		return nil, false
+	}
+
+	expectedPolicy, expectedRules, ok := parseFirewallChainRules(chain, expected)
+	if !ok || expectedPolicy == "" {
+		return nil, false
+	}
+
+	operations := make([][]string, 0)
+
+	// make sure that established connections are accepted before anything else is changed
+	if pinEstablished && len(expectedRules) > 0 && expectedRules[0] == firewallEstablishedRule {
+		if len(currentRules) == 0 || currentRules[0] != firewallEstablishedRule {
+			operations = append(operations, firewallRuleOperation("-I", chain, 1, firewallEstablishedRule))
+			currentRules = append([]string{firewallEstablishedRule}, currentRules...)
+		}
+	}
+
+	keepCurrent, keepExpected := firewallCommonRules(currentRules, expectedRules)
+
+	// delete rules from the bottom, so line numbers of remaining rules don't change
+	for i := len(currentRules) - 1; i >= 0; i-- {
+		if !keepCurrent[i] {
+			operations = append(operations, []string{"-D", string(chain), strconv.Itoa(i + 1)})
+		}
+	}
+
+	// insert missing rules from the top, so every rule lands on its expected line number
+	for i, rule := range expectedRules {
+		if !keepExpected[i] {
+			operations = append(operations, firewallRuleOperation("-I", chain, i+1, rule))
+		}
+	}
+
+	// policy is set last, so restrictive policy is applied only when all rules are in place
+	if currentPolicy != expectedPolicy {
+		operations = append(operations, strings.Fields(expectedPolicy))
+	}
+
+	return operations, true
+}
+
+// parseFirewallChainRules splits chain listing into policy and rules.
+// Returns false if listing contains anything else than policy and rules of the provided chain.
+func parseFirewallChainRules(chain FirewallChainName, lines []string) (string, []string, bool) {
+	policy := ""
+	rules := make([]string, 0, len(lines))
+
+	for _, line := range lines {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+
+		fields := strings.Fields(line)
+		if len(fields) < 3 || fields[1] != string(chain) {
+			return "", nil, false
+		}
+
+		switch fields[0] {
+		case "-P":
+			if policy != "" {
+				return "", nil, false
+			}
+			policy = strings.Join(fields, " ")
+		case "-A":
+			rules = append(rules, strings.Join(fields, " "))
+		default:
+			return "", nil, false
+		}
+	}
+
+	return policy, rules, true
+}
+
+// firewallCommonRules returns which of the current and expected rules are part of their longest common subsequence.
+func firewallCommonRules(current, expected []string) ([]bool, []bool) {
+	lcs := make([][]int, len(current)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(expected)+1)
+	}
+
+	for i := len(current) - 1; i >= 0; i-- {
+		for j := len(expected) - 1; j >= 0; j-- {
+			if current[i] == expected[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+
+	keepCurrent := make([]bool, len(current))
+	keepExpected := make([]bool, len(expected))
+
+	for i, j := 0, 0; i < len(current) && j < len(expected); {
+		switch {
+		case current[i] == expected[j]:
+			keepCurrent[i] = true
+			keepExpected[j] = true
+			i++
+			j++
+		case lcs[i+1][j] >= lcs[i][j+1]:
+			i++
+		default:
+			j++
+		}
+	}
+
+	return keepCurrent, keepExpected
+}
+
+// firewallRuleOperation converts rendered rule (-A <chain> <spec>) into an operation at the provided line number.
+func firewallRuleOperation(operation string, chain FirewallChainName, lineNumber int, rule string) []string {
+	spec := strings.Fields(rule)[2:]
+
+	return append([]string{operation, string(chain), strconv.Itoa(lineNumber)}, spec...)
+}
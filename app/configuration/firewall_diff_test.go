@@ -0,0 +1,108 @@
+// Copyright 2024 qbee.io
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package configuration
+
+import (
+	"testing"
+
+	"go.qbee.io/agent/app/utils/assert"
+)
+
+func Test_firewallChainDiff(t *testing.T) {
+	const (
+		policyAccept = "-P INPUT ACCEPT"
+		policyDrop   = "-P INPUT DROP"
+		loopback     = "-A INPUT -i lo -j ACCEPT"
+		ssh          = "-A INPUT -p tcp -m tcp --dport 22 -j ACCEPT"
+		http         = "-A INPUT -p tcp -m tcp --dport 80 -j ACCEPT"
+	)
+
+	tests := []struct {
+		name     string
+		current  []string
+		expected []string
+		want     [][]string
+		wantOK   bool
+	}{
+		{
+			name:     "empty chain",
+			current:  []string{policyAccept, ""},
+			expected: []string{policyDrop, firewallEstablishedRule, loopback, ssh},
+			want: [][]string{
+				{"-I", "INPUT", "1", "-m", "conntrack", "--ctstate", "RELATED,ESTABLISHED", "-j", "ACCEPT"},
+				{"-I", "INPUT", "2", "-i", "lo", "-j", "ACCEPT"},
+				{"-I", "INPUT", "3", "-p", "tcp", "-m", "tcp", "--dport", "22", "-j", "ACCEPT"},
+				{"-P", "INPUT", "DROP"},
+			},
+			wantOK: true,
+		},
+		{
+			name:     "rule added",
+			current:  []string{policyDrop, firewallEstablishedRule, loopback, ssh},
+			expected: []string{policyDrop, firewallEstablishedRule, loopback, http, ssh},
+			want: [][]string{
+				{"-I", "INPUT", "3", "-p", "tcp", "-m", "tcp", "--dport", "80", "-j", "ACCEPT"},
+			},
+			wantOK: true,
+		},
+		{
+			name:     "rule removed",
+			current:  []string{policyDrop, firewallEstablishedRule, loopback, http, ssh},
+			expected: []string{policyDrop, firewallEstablishedRule, loopback, ssh},
+			want: [][]string{
+				{"-D", "INPUT", "3"},
+			},
+			wantOK: true,
+		},
+		{
+			name:     "established rule moved to the top first",
+			current:  []string{policyDrop, ssh, firewallEstablishedRule},
+			expected: []string{policyDrop, firewallEstablishedRule, ssh},
+			want: [][]string{
+				{"-I", "INPUT", "1", "-m", "conntrack", "--ctstate", "RELATED,ESTABLISHED", "-j", "ACCEPT"},
+				{"-D", "INPUT", "3"},
+			},
+			wantOK: true,
+		},
+		{
+			name:     "rules reordered",
+			current:  []string{policyDrop, firewallEstablishedRule, http, ssh},
+			expected: []string{policyDrop, firewallEstablishedRule, ssh, http},
+			want: [][]string{
+				{"-D", "INPUT", "2"},
+				{"-I", "INPUT", "3", "-p", "tcp", "-m", "tcp", "--dport", "80", "-j", "ACCEPT"},
+			},
+			wantOK: true,
+		},
+		{
+			name:     "unexpected listing",
+			current:  []string{"-N CUSTOM", policyDrop},
+			expected: []string{policyDrop, firewallEstablishedRule},
+			wantOK:   false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := firewallChainDiff(Input, tt.current, tt.expected, true)
+			assert.Equal(t, ok, tt.wantOK)
+			if tt.wantOK {
+				assert.Equal(t, got, tt.want)
+			}
+		})
+	}
+}
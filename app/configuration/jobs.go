@@ -0,0 +1,376 @@
+// Copyright 2023 qbee.io
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package configuration
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"go.qbee.io/agent/app/log"
+	"go.qbee.io/agent/app/utils"
+)
+
+const (
+	deviceJobAPIPath       = "/v1/org/device/auth/job"
+	deviceJobResultAPIPath = "/v1/org/device/auth/job/%s/result"
+)
+
+const (
+	jobsStateFileName = "jobs.json"
+	jobsStateFileMode = 0600
+
+	defaultJobTimeout = 10 * time.Minute
+	maxJobTimeout     = executeTimeout
+
+	jobOutputLinesLimit = 1000
+)
+
+// Job defines a one-shot command executed on the device.
+//
+// Example payload:
+//
+//	{
+//	  "id": "5f0e7c1a",
+//	  "command": "journalctl -u app --since today",
+//	  "timeout": 60,
+//	  "working_directory": "/var/lib/app",
+//	  "env": {"LANG": "C"},
+//	  "device_id": "a1b2c3...",
+//	  "expires_at": 1700000000,
+//	  "signature": "MEUCIQ..."
+//	}
+type Job struct {
+	// ID uniquely identifies the job. Jobs with the same ID are executed only once.
+	ID string `json:"id"`
+
+	// Command is a shell command executed by the job (parameters are resolved).
+	Command string `json:"command"`
+
+	// Timeout defines how long the command can run (in seconds, defaults to 10 minutes).
+	Timeout int `json:"timeout,omitempty"`
+
+	// WorkingDirectory defines working directory of the command (defaults to /).
+	WorkingDirectory string `json:"working_directory,omitempty"`
+
+	// Env defines additional environment variables of the command.
+	Env map[string]string `json:"env,omitempty"`
+
+	// DeviceID identifies the device the job is scheduled for. Jobs scheduled for other devices are refused.
+	DeviceID string `json:"device_id"`
+
+	// ExpiresAt is a Unix timestamp after which the job is refused.
+	ExpiresAt int64 `json:"expires_at"`
+}
+
+// timeout returns duration after which the job is terminated.
+func (job Job) timeout() time.Duration {
+	timeout := time.Duration(job.Timeout) * time.Second
+
+	if timeout <= 0 {
+		return defaultJobTimeout
+	}
+
+	return min(timeout, maxJobTimeout)
+}
+
+// JobResult contains the outcome of an executed job delivered to the device hub.
+type JobResult struct {
+	JobID     string `json:"job_id"`
+	Stdout    string `json:"stdout"`
+	Stderr    string `json:"stderr"`
+	ExitCode  int    `json:"exit_code"`
+	Error     string `json:"error,omitempty"`
+	StartedAt int64  `json:"started_at"`
+	Duration  int64  `json:"duration_ms"`
+}
+
+// jobsState records completed jobs and results which were not delivered yet.
+type jobsState struct {
+	// Completed maps IDs of completed jobs to their expiration time (Unix timestamp).
+	// Jobs are remembered until they expire, since expired jobs are refused anyway.
+	Completed map[string]int64 `json:"completed_jobs"`
+	Pending   []JobResult      `json:"pending,omitempty"`
+}
+
+// pruneCompleted forgets completed jobs which already expired.
+func (state *jobsState) pruneCompleted(now time.Time) {
+	for jobID, expiresAt := range state.Completed {
+		if expiresAt <= now.Unix() {
+			delete(state.Completed, jobID)
+		}
+	}
+}
+
+// RunJobs executes a one-shot job fetched from the device hub (if remote jobs are enabled) and delivers its result.
+// Job command is executed under the execution lock with parameters and secrets from the provided config,
+// and secrets are redacted from its output. Jobs are executed at most once, even if their result wasn't delivered.
+// Only jobs signed with the config signing key are executed.
+func (srv *Service) RunJobs(ctx context.Context, configData *CommittedConfig) error {
+	if !srv.remoteJobsEnabled {
+		return nil
+	}
+
+	state, err := srv.loadJobsState()
+	if err != nil {
+		return err
+	}
+
+	// results which failed to be delivered during previous runs are delivered first
+	if err = srv.deliverJobResults(ctx, state); err != nil {
+		return err
+	}
+
+	job, err := srv.getJob(ctx)
+	if err != nil || job == nil {
+		return err
+	}
+
+	if _, completed := state.Completed[job.ID]; completed {
+		log.Debugf("job %s already completed - skipping", job.ID)
+		return nil
+	}
+
+	// when the lock is held by another process, the job is not marked as completed and is retried during next run
+	if err = srv.acquireLock(executeTimeout); err != nil {
+		return fmt.Errorf("failed to acquire execution lock: %w", err)
+	}
+
+	// job is marked as completed before it's executed, so it's not executed again if the agent crashes
+	state.pruneCompleted(time.Now())
+	if state.Completed == nil {
+		state.Completed = make(map[string]int64)
+	}
+	state.Completed[job.ID] = job.ExpiresAt
+
+	if err = srv.saveJobsState(state); err != nil {
+		if releaseErr := srv.releaseLock(); releaseErr != nil {
+			log.Errorf("failed to release execution lock - %v", releaseErr)
+		}
+		return err
+	}
+
+	parametersBundle := configData.BundleData.Parameters
+	if parametersBundle == nil {
+		parametersBundle = new(ParametersBundle)
+	}
+
+	log.Infof("executing job %s", job.ID)
+
+	reporter := NewReporter(configData.CommitID, false, parametersBundle.SecretsList())
+	jobCtx := utils.WithRedactor(parametersBundle.Context(ctx, srv.urlSigner), reporter.Redact)
+
+	result := runJob(jobCtx, *job)
+
+	if err = srv.releaseLock(); err != nil {
+		log.Errorf("failed to release execution lock - %v", err)
+	}
+
+	result.Stdout = reporter.Redact(result.Stdout)
+	result.Stderr = reporter.Redact(result.Stderr)
+	result.Error = reporter.Redact(result.Error)
+
+	log.Infof("job %s finished with exit code %d", job.ID, result.ExitCode)
+
+	state.Pending = append(state.Pending, result)
+
+	if err = srv.saveJobsState(state); err != nil {
+		return err
+	}
+
+	return srv.deliverJobResults(ctx, state)
+}
+
+// getJob returns the job scheduled for the device or nil if there is none.
+// Job must carry a valid signature, so jobs are refused when config signing key is not set.
+// Signed device ID and expiration time make sure that a job can't be replayed on other devices or after it expired.
+func (srv *Service) getJob(ctx context.Context) (*Job, error) {
+	payload := make(json.RawMessage, 0)
+
+	if err := srv.api.Get(ctx, deviceJobAPIPath, &payload); err != nil {
+		return nil, fmt.Errorf("error getting job: %w", err)
+	}
+
+	if len(bytes.TrimSpace(payload)) == 0 || bytes.Equal(bytes.TrimSpace(payload), []byte("null")) {
+		return nil, nil
+	}
+
+	job := new(Job)
+	if err := json.Unmarshal(payload, job); err != nil {
+		return nil, fmt.Errorf("error decoding job: %w", err)
+	}
+
+	if job.ID == "" {
+		return nil, nil
+	}
+
+	if srv.configSigningKey == nil {
+		return nil, fmt.Errorf("job %s refused: config signing key is not configured", job.ID)
+	}
+
+	if err := verifyConfigSignature(payload, srv.configSigningKey); err != nil {
+		return nil, fmt.Errorf("job %s signature verification failed: %w", job.ID, err)
+	}
+
+	if job.DeviceID == "" || job.DeviceID != srv.deviceID {
+		return nil, fmt.Errorf("job %s refused: scheduled for a different device", job.ID)
+	}
+
+	if !time.Now().Before(time.Unix(job.ExpiresAt, 0)) {
+		return nil, fmt.Errorf("job %s refused: expired", job.ID)
+	}
+
+	return job, nil
+}
+
+// runJob executes the job command and returns its result.
+func runJob(ctx context.Context, job Job) JobResult {
+	result := JobResult{JobID: job.ID, StartedAt: time.Now().Unix()}
+	started := time.Now()
+
+	ctx, cancel := context.WithTimeout(ctx, job.timeout())
+	defer cancel()
+
+	shell := getShell()
+	if shell == "" {
+		result.ExitCode = -1
+		result.Error = "no supported shell found"
+		return result
+	}
+
+	cmd := utils.NewCommand(ctx, []string{shell, "-c", resolveParameters(ctx, job.Command)})
+
+	if job.WorkingDirectory != "" {
+		cmd.Dir = job.WorkingDirectory
+	}
+
+	cmd.Env = append(os.Environ(), jobEnv(ctx, job.Env)...)
+
+	// only the most recent lines of the output are delivered
+	stdout := utils.NewTailBuffer(jobOutputLinesLimit)
+	stderr := utils.NewTailBuffer(jobOutputLinesLimit)
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+
+	err := cmd.Run()
+	utils.TraceCommand(ctx, cmd, started)
+
+	result.Stdout = string(bytes.Join(stdout.Close(), []byte("\n")))
+	result.Stderr = string(bytes.Join(stderr.Close(), []byte("\n")))
+	result.Duration = time.Since(started).Milliseconds()
+
+	if err != nil {
+		result.ExitCode = -1
+		result.Error = err.Error()
+
+		exitError := new(exec.ExitError)
+		if errors.As(err, &exitError) && exitError.ExitCode() >= 0 {
+			result.ExitCode = exitError.ExitCode()
+		}
+
+		if ctx.Err() != nil {
+			result.Error = fmt.Sprintf("job timed out after %s", job.timeout())
+		}
+	}
+
+	return result
+}
+
+// jobEnv returns job environment variables (with parameters resolved) in a stable order.
+func jobEnv(ctx context.Context, env map[string]string) []string {
+	names := make([]string, 0, len(env))
+	for name := range env {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	vars := make([]string, 0, len(names))
+	for _, name := range names {
+		vars = append(vars, fmt.Sprintf("%s=%s", name, resolveParameters(ctx, env[name])))
+	}
+
+	return vars
+}
+
+// deliverJobResults delivers pending job results to the device hub and removes delivered ones from the state.
+func (srv *Service) deliverJobResults(ctx context.Context, state *jobsState) error {
+	if len(state.Pending) == 0 {
+		return nil
+	}
+
+	var deliveryErr error
+	for len(state.Pending) > 0 {
+		result := state.Pending[0]
+
+		path := fmt.Sprintf(deviceJobResultAPIPath, result.JobID)
+		if deliveryErr = srv.api.Post(ctx, path, result, nil); deliveryErr != nil {
+			deliveryErr = fmt.Errorf("error delivering result of job %s: %w", result.JobID, deliveryErr)
+			break
+		}
+
+		state.Pending = state.Pending[1:]
+	}
+
+	if err := srv.saveJobsState(state); err != nil {
+		return err
+	}
+
+	return deliveryErr
+}
+
+// loadJobsState loads jobs state from the state file (empty state if it doesn't exist).
+func (srv *Service) loadJobsState() (*jobsState, error) {
+	state := new(jobsState)
+
+	data, err := os.ReadFile(filepath.Join(srv.appDirectory, jobsStateFileName))
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return state, nil
+		}
+		return nil, fmt.Errorf("failed to read jobs state: %w", err)
+	}
+
+	if err = json.Unmarshal(data, state); err != nil {
+		return nil, fmt.Errorf("failed to decode jobs state: %w", err)
+	}
+
+	return state, nil
+}
+
+// saveJobsState persists jobs state in the state file.
+func (srv *Service) saveJobsState(state *jobsState) error {
+	data, err := json.Marshal(state)
+	if err != nil {
+		return fmt.Errorf("failed to encode jobs state: %w", err)
+	}
+
+	statePath := filepath.Join(srv.appDirectory, jobsStateFileName)
+	if err = utils.WriteFileSync(statePath, data, jobsStateFileMode); err != nil {
+		return fmt.Errorf("failed to save jobs state: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,244 @@
+// Copyright 2023 qbee.io
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package configuration
+
+import (
+	"compress/gzip"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+
+	"go.qbee.io/agent/app/api"
+	"go.qbee.io/agent/app/utils/assert"
+)
+
+// jobsTestServer serves a single job and collects delivered results.
+// Job is signed with the signing key, unless it's not set.
+type jobsTestServer struct {
+	job        Job
+	signingKey *ecdsa.PrivateKey
+	t          *testing.T
+	mutex      sync.Mutex
+	results    []JobResult
+}
+
+func (server *jobsTestServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch {
+	case r.Method == http.MethodGet && r.URL.Path == deviceJobAPIPath:
+		payload, _ := json.Marshal(server.job)
+		if server.signingKey != nil {
+			payload = signTestConfig(server.t, server.signingKey, string(payload))
+		}
+		_, _ = w.Write(payload)
+	case r.Method == http.MethodPost && r.URL.Path == "/v1/org/device/auth/job/"+server.job.ID+"/result":
+		var body io.Reader = r.Body
+		if r.Header.Get("Content-Encoding") == "gzip" {
+			gzipReader, err := gzip.NewReader(r.Body)
+			if err != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			body = gzipReader
+		}
+
+		result := JobResult{}
+		if err := json.NewDecoder(body).Decode(&result); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		server.mutex.Lock()
+		server.results = append(server.results, result)
+		server.mutex.Unlock()
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+const jobsTestDeviceID = "test-device"
+
+// newJobsTestService returns a service with remote jobs enabled, connected to the test server.
+// Jobs served by the test server are signed with a key trusted by the service,
+// and unless set, scheduled for the service's device with expiration time in the future.
+func newJobsTestService(t *testing.T, handler *jobsTestServer) *Service {
+	privateKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NoError(t, err)
+
+	handler.t = t
+	handler.signingKey = privateKey
+
+	if handler.job.DeviceID == "" {
+		handler.job.DeviceID = jobsTestDeviceID
+	}
+
+	if handler.job.ExpiresAt == 0 {
+		handler.job.ExpiresAt = time.Now().Add(time.Hour).Unix()
+	}
+
+	server := httptest.NewTLSServer(handler)
+	t.Cleanup(server.Close)
+
+	serverURL, err := url.Parse(server.URL)
+	assert.NoError(t, err)
+
+	host, port, err := net.SplitHostPort(serverURL.Host)
+	assert.NoError(t, err)
+
+	apiClient := api.NewClient(host, port).WithTLSConfig(&tls.Config{InsecureSkipVerify: true})
+
+	srv := New(apiClient, t.TempDir(), t.TempDir()).
+		WithConfigSigningKey(&privateKey.PublicKey).
+		WithDeviceID(jobsTestDeviceID)
+	srv.remoteJobsEnabled = true
+
+	return srv
+}
+
+func TestService_RunJobs(t *testing.T) {
+	server := &jobsTestServer{
+		job: Job{
+			ID:               "job-1",
+			Command:          "echo $GREETING $(secret); pwd; echo failed >&2; exit 3",
+			WorkingDirectory: "/tmp",
+			Env:              map[string]string{"GREETING": "hello"},
+		},
+	}
+
+	srv := newJobsTestService(t, server)
+
+	configData := &CommittedConfig{
+		BundleData: BundleData{
+			Parameters: &ParametersBundle{Secrets: []Parameter{{Key: "secret", Value: "seCre7"}}},
+		},
+	}
+
+	assert.NoError(t, srv.RunJobs(context.Background(), configData))
+
+	assert.Length(t, server.results, 1)
+
+	result := server.results[0]
+	assert.Equal(t, result.JobID, "job-1")
+	assert.Equal(t, result.Stdout, "hello ********\n/tmp")
+	assert.Equal(t, result.Stderr, "failed")
+	assert.Equal(t, result.ExitCode, 3)
+
+	// completed job is not executed again
+	assert.NoError(t, srv.RunJobs(context.Background(), configData))
+	assert.Length(t, server.results, 1)
+}
+
+func TestService_RunJobs_Disabled(t *testing.T) {
+	server := &jobsTestServer{job: Job{ID: "job-1", Command: "true"}}
+
+	srv := newJobsTestService(t, server)
+	srv.remoteJobsEnabled = false
+
+	assert.NoError(t, srv.RunJobs(context.Background(), &CommittedConfig{}))
+	assert.Length(t, server.results, 0)
+}
+
+func TestService_RunJobs_NoJob(t *testing.T) {
+	server := &jobsTestServer{}
+
+	srv := newJobsTestService(t, server)
+
+	assert.NoError(t, srv.RunJobs(context.Background(), &CommittedConfig{}))
+	assert.Length(t, server.results, 0)
+}
+
+func TestService_RunJobs_Unsigned(t *testing.T) {
+	server := &jobsTestServer{job: Job{ID: "job-1", Command: "true"}}
+
+	srv := newJobsTestService(t, server)
+	server.signingKey = nil
+
+	assert.NotEqual(t, srv.RunJobs(context.Background(), &CommittedConfig{}), nil)
+	assert.Length(t, server.results, 0)
+
+	// jobs are refused when signing key is not configured
+	srv.configSigningKey = nil
+
+	assert.NotEqual(t, srv.RunJobs(context.Background(), &CommittedConfig{}), nil)
+	assert.Length(t, server.results, 0)
+}
+
+func TestService_RunJobs_OtherDevice(t *testing.T) {
+	server := &jobsTestServer{job: Job{ID: "job-1", Command: "true", DeviceID: "other-device"}}
+
+	srv := newJobsTestService(t, server)
+
+	assert.NotEqual(t, srv.RunJobs(context.Background(), &CommittedConfig{}), nil)
+	assert.Length(t, server.results, 0)
+}
+
+func TestService_RunJobs_Expired(t *testing.T) {
+	server := &jobsTestServer{job: Job{ID: "job-1", Command: "true", ExpiresAt: time.Now().Add(-time.Minute).Unix()}}
+
+	srv := newJobsTestService(t, server)
+
+	assert.NotEqual(t, srv.RunJobs(context.Background(), &CommittedConfig{}), nil)
+	assert.Length(t, server.results, 0)
+}
+
+func Test_jobsState_pruneCompleted(t *testing.T) {
+	now := time.Now()
+
+	state := &jobsState{Completed: map[string]int64{
+		"expired": now.Add(-time.Minute).Unix(),
+		"valid":   now.Add(time.Minute).Unix(),
+	}}
+
+	state.pruneCompleted(now)
+
+	assert.Equal(t, state.Completed, map[string]int64{"valid": now.Add(time.Minute).Unix()})
+}
+
+func TestService_RunJobs_Locked(t *testing.T) {
+	server := &jobsTestServer{job: Job{ID: "job-1", Command: "true"}}
+
+	srv := newJobsTestService(t, server)
+
+	assert.NoError(t, srv.acquireLock(executeTimeout))
+
+	assert.NotEqual(t, srv.RunJobs(context.Background(), &CommittedConfig{}), nil)
+	assert.Length(t, server.results, 0)
+
+	// job is executed once the lock is released
+	assert.NoError(t, srv.releaseLock())
+
+	assert.NoError(t, srv.RunJobs(context.Background(), &CommittedConfig{}))
+	assert.Length(t, server.results, 1)
+}
+
+func Test_runJob_Timeout(t *testing.T) {
+	result := runJob(context.Background(), Job{ID: "job-1", Command: "sleep 10", Timeout: 1})
+
+	assert.Equal(t, result.ExitCode, -1)
+	assert.Equal(t, result.Error, "job timed out after 1s")
+	assert.True(t, result.Duration < (5*time.Second).Milliseconds())
+}
@@ -17,14 +17,34 @@
 package configuration
 
 import (
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io/fs"
 	"os"
 	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
 	"time"
+
+	"go.qbee.io/agent/app/log"
 )
 
 const lockFileName = "config.lock"
 
+// LockStatus describes the configuration execution lock.
+type LockStatus struct {
+	// PID - process ID of the lock holder.
+	PID int `json:"pid"`
+
+	// AcquiredAt - Unix timestamp when the lock was acquired.
+	AcquiredAt int64 `json:"acquired_at"`
+
+	// Stale - whether the lock holder process is no longer running.
+	Stale bool `json:"stale"`
+}
+
 // lockFilePath returns the path to the lock file.
 func (srv *Service) lockFilePath() string {
 
@@ -42,14 +62,77 @@ func (srv *Service) lockFilePath() string {
 	return filepath.Join(srv.appDirectory, lockFileName)
 }
 
+// readLock returns the current state of the execution lock or nil if the lock is not held.
+// Lock file which cannot be parsed (e.g. empty after a crash) is reported with unknown PID (0),
+// so it's only reclaimed once it expires based on its modification time.
+func (srv *Service) readLock() (*LockStatus, error) {
+	lockFilePath := srv.lockFilePath()
+
+	lockFileStat, err := os.Stat(lockFilePath)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("could not check lock file: %w", err)
+	}
+
+	data, err := os.ReadFile(lockFilePath)
+	if err != nil {
+		return nil, fmt.Errorf("could not read lock file: %w", err)
+	}
+
+	lockStatus := new(LockStatus)
+
+	// lock files created by older agent versions contain only the holder PID
+	if err = json.Unmarshal(data, lockStatus); err != nil {
+		pid, pidErr := strconv.Atoi(strings.TrimSpace(string(data)))
+		if pidErr != nil {
+			log.Warnf("could not parse lock file %s: %v", lockFilePath, err)
+			return &LockStatus{AcquiredAt: lockFileStat.ModTime().Unix()}, nil
+		}
+
+		lockStatus = &LockStatus{PID: pid, AcquiredAt: lockFileStat.ModTime().Unix()}
+	}
+
+	lockStatus.Stale = !processAlive(lockStatus.PID)
+
+	return lockStatus, nil
+}
+
+// processAlive returns true if a process with provided PID is running.
+func processAlive(pid int) bool {
+	if pid <= 0 {
+		return false
+	}
+
+	// signal 0 performs only the existence and permission checks
+	err := syscall.Kill(pid, 0)
+
+	return err == nil || errors.Is(err, syscall.EPERM)
+}
+
 // acquireLock for the configuration execution.
+// Lock is reclaimed when it's older than lockFileTimeout or when its holder process is no longer running.
 func (srv *Service) acquireLock(lockFileTimeout time.Duration) error {
-	// Check if lock file exists and is not expired
-	if lockFileStat, err := os.Stat(srv.lockFilePath()); err == nil {
-		lockFileExpired := time.Since(lockFileStat.ModTime()) > lockFileTimeout
+	lockStatus, err := srv.readLock()
+	if err != nil {
+		return err
+	}
 
-		if !lockFileExpired {
-			return fmt.Errorf("another process is running configuration")
+	if lockStatus != nil {
+		acquiredAt := time.Unix(lockStatus.AcquiredAt, 0)
+
+		switch {
+		case lockStatus.PID == 0 && time.Since(acquiredAt) > lockFileTimeout:
+			log.Warnf("reclaiming expired execution lock created at %s", acquiredAt)
+		case lockStatus.PID == 0:
+			return fmt.Errorf("another process is running configuration since %s", acquiredAt)
+		case lockStatus.Stale:
+			log.Warnf("reclaiming stale execution lock held by PID %d since %s", lockStatus.PID, acquiredAt)
+		case time.Since(acquiredAt) > lockFileTimeout:
+			log.Warnf("reclaiming expired execution lock held by PID %d since %s", lockStatus.PID, acquiredAt)
+		default:
+			return fmt.Errorf("another process (PID %d) is running configuration since %s", lockStatus.PID, acquiredAt)
 		}
 
 		if err = srv.releaseLock(); err != nil {
@@ -57,15 +140,28 @@ func (srv *Service) acquireLock(lockFileTimeout time.Duration) error {
 		}
 	}
 
+	lockFileData, err := json.Marshal(LockStatus{PID: os.Getpid(), AcquiredAt: time.Now().Unix()})
+	if err != nil {
+		return fmt.Errorf("could not encode lock file: %w", err)
+	}
+
 	// Create lock file
 	lockFile, err := os.OpenFile(srv.lockFilePath(), os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644)
 	if err != nil {
-		return fmt.Errorf("could not create lock file: %w", err)
+		return fmt.Errorf("could not create lock file: %w", readOnlyFilesystemError(srv.lockFilePath(), err))
 	}
-	defer lockFile.Close()
 
-	lockFileData := fmt.Sprintf("%10d", os.Getpid())
-	if _, err = lockFile.Write([]byte(lockFileData)); err != nil {
+	if _, err = lockFile.Write(lockFileData); err == nil {
+		err = lockFile.Sync()
+	}
+
+	if closeErr := lockFile.Close(); err == nil {
+		err = closeErr
+	}
+
+	// incomplete lock file would block execution until it expires, so it's removed
+	if err != nil {
+		_ = os.Remove(srv.lockFilePath())
 		return fmt.Errorf("could not write lock file: %w", err)
 	}
 
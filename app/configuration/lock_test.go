@@ -0,0 +1,147 @@
+// Copyright 2023 qbee.io
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package configuration
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"testing"
+	"time"
+
+	"go.qbee.io/agent/app/utils/assert"
+)
+
+func TestService_acquireLock(t *testing.T) {
+	srv := New(nil, t.TempDir(), "")
+
+	if err := srv.acquireLock(time.Hour); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer func() { _ = srv.releaseLock() }()
+
+	lockStatus, err := srv.readLock()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	assert.Equal(t, lockStatus.PID, os.Getpid())
+	assert.Equal(t, lockStatus.Stale, false)
+
+	// lock held by running process must not be reclaimed
+	if err = srv.acquireLock(time.Hour); err == nil {
+		t.Fatalf("expected error")
+	}
+
+	assert.Equal(t, srv.Status().Lock, lockStatus)
+}
+
+func TestService_acquireLock_Stale(t *testing.T) {
+	srv := New(nil, t.TempDir(), "")
+
+	// use PID of a process which is no longer running
+	cmd := exec.Command("true")
+	if err := cmd.Run(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	deadPID := cmd.Process.Pid
+
+	lockFileData := fmt.Sprintf(`{"pid":%d,"acquired_at":%d}`, deadPID, time.Now().Unix())
+	if err := os.WriteFile(srv.lockFilePath(), []byte(lockFileData), 0644); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer func() { _ = srv.releaseLock() }()
+
+	lockStatus, err := srv.readLock()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	assert.Equal(t, lockStatus, &LockStatus{PID: deadPID, AcquiredAt: lockStatus.AcquiredAt, Stale: true})
+
+	if err = srv.acquireLock(time.Hour); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	lockStatus, err = srv.readLock()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	assert.Equal(t, lockStatus.PID, os.Getpid())
+}
+
+func TestService_readLock_LegacyFormat(t *testing.T) {
+	srv := New(nil, t.TempDir(), "")
+
+	lockFileData := fmt.Sprintf("%10d", os.Getpid())
+	if err := os.WriteFile(srv.lockFilePath(), []byte(lockFileData), 0644); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer func() { _ = srv.releaseLock() }()
+
+	lockStatus, err := srv.readLock()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	assert.Equal(t, lockStatus.PID, os.Getpid())
+	assert.Equal(t, lockStatus.Stale, false)
+}
+
+func TestService_acquireLock_Unparsable(t *testing.T) {
+	srv := New(nil, t.TempDir(), "")
+
+	// lock file left empty by a process which crashed right after creating it
+	if err := os.WriteFile(srv.lockFilePath(), nil, 0644); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer func() { _ = srv.releaseLock() }()
+
+	lockStatus, err := srv.readLock()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	assert.Equal(t, lockStatus.PID, 0)
+	assert.Equal(t, lockStatus.Stale, false)
+
+	// lock is respected until it expires
+	if err = srv.acquireLock(time.Hour); err == nil {
+		t.Fatalf("expected error")
+	}
+
+	past := time.Now().Add(-2 * time.Hour)
+	if err = os.Chtimes(srv.lockFilePath(), past, past); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if err = srv.acquireLock(time.Hour); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	lockStatus, err = srv.readLock()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	assert.Equal(t, lockStatus.PID, os.Getpid())
+}
+
+func TestService_readLock_NotHeld(t *testing.T) {
+	srv := New(nil, t.TempDir(), "")
+
+	lockStatus, err := srv.readLock()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	assert.Equal(t, lockStatus, (*LockStatus)(nil))
+}
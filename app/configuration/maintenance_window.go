@@ -0,0 +1,269 @@
+// Copyright 2024 qbee.io
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package configuration
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"go.qbee.io/agent/app/log"
+	"go.qbee.io/agent/app/utils"
+)
+
+// MaintenanceWindow defines a recurring time window in which disruptive actions are allowed.
+//
+// Example payload:
+//
+//	{
+//	  "start": "22:00",
+//	  "end": "04:00",
+//	  "weekdays": ["sat", "sun"],
+//	  "timezone": "Europe/Oslo"
+//	}
+type MaintenanceWindow struct {
+	// Start of the window as a wall-clock time (HH:MM).
+	Start string `json:"start"`
+
+	// End of the window as a wall-clock time (HH:MM).
+	// Windows ending before they start span midnight. Windows with the same start and end last the whole day.
+	End string `json:"end"`
+
+	// Weekdays on which the window starts (e.g. "mon", "tue"). Empty means every day.
+	Weekdays []string `json:"weekdays,omitempty"`
+
+	// Timezone is an IANA time zone name (e.g. "Europe/Oslo"). Empty means the system's local time zone.
+	Timezone string `json:"timezone,omitempty"`
+}
+
+// InMaintenanceWindow returns true if provided time falls within the maintenance window.
+// Start and end are compared with the wall-clock time in the window's time zone,
+// so the window follows daylight saving time changes.
+func (w MaintenanceWindow) InMaintenanceWindow(now time.Time) (bool, error) {
+	start, err := parseWallClockTime(w.Start)
+	if err != nil {
+		return false, fmt.Errorf("invalid maintenance window start: %w", err)
+	}
+
+	end, err := parseWallClockTime(w.End)
+	if err != nil {
+		return false, fmt.Errorf("invalid maintenance window end: %w", err)
+	}
+
+	weekdays, err := parseWeekdays(w.Weekdays)
+	if err != nil {
+		return false, err
+	}
+
+	location := time.Local
+	if w.Timezone != "" {
+		if location, err = time.LoadLocation(w.Timezone); err != nil {
+			return false, fmt.Errorf("invalid maintenance window timezone: %w", err)
+		}
+	}
+
+	localNow := now.In(location)
+	minuteOfDay := localNow.Hour()*60 + localNow.Minute()
+	today := localNow.Weekday()
+	yesterday := (today + 6) % 7
+
+	switch {
+	case start == end:
+		return weekdays[today], nil
+	case start < end:
+		return weekdays[today] && minuteOfDay >= start && minuteOfDay < end, nil
+	case minuteOfDay >= start:
+		return weekdays[today], nil
+	case minuteOfDay < end:
+		// window spanning midnight, which started the day before
+		return weekdays[yesterday], nil
+	default:
+		return false, nil
+	}
+}
+
+// parseWallClockTime parses HH:MM time and returns it as minutes since midnight.
+func parseWallClockTime(value string) (int, error) {
+	parsed, err := time.Parse("15:04", value)
+	if err != nil {
+		return 0, fmt.Errorf("expected HH:MM time, got %q", value)
+	}
+
+	return parsed.Hour()*60 + parsed.Minute(), nil
+}
+
+// parseWeekdays returns a set of weekdays from their names (e.g. "mon" or "Monday").
+// Empty list of names results in all weekdays.
+func parseWeekdays(names []string) (map[time.Weekday]bool, error) {
+	weekdays := make(map[time.Weekday]bool, 7)
+
+	for _, name := range names {
+		found := false
+		for day := time.Sunday; day <= time.Saturday; day++ {
+			if len(name) >= 3 && strings.HasPrefix(strings.ToLower(day.String()), strings.ToLower(name)) {
+				weekdays[day] = true
+				found = true
+				break
+			}
+		}
+
+		if !found {
+			return nil, fmt.Errorf("invalid maintenance window weekday %q", name)
+		}
+	}
+
+	if len(names) == 0 {
+		for day := time.Sunday; day <= time.Saturday; day++ {
+			weekdays[day] = true
+		}
+	}
+
+	return weekdays, nil
+}
+
+// inMaintenanceWindow returns true if disruptive actions are allowed at the provided time.
+// Without a configured maintenance window, disruptive actions are always allowed.
+func (srv *Service) inMaintenanceWindow(now time.Time) (bool, error) {
+	if srv.maintenanceWindow == nil {
+		return true, nil
+	}
+
+	return srv.maintenanceWindow.InMaintenanceWindow(now)
+}
+
+const (
+	restartsPendingFileName = "restarts_pending.json"
+	restartsPendingFileMode = 0600
+)
+
+// restartAllowed returns true if restart of the resource (e.g. a service or a container) can be performed now.
+// Restart is needed when required by the current run or deferred by one of the previous runs.
+// Outside the maintenance window, needed restarts are recorded and performed by a later run within the window.
+func (srv *Service) restartAllowed(ctx context.Context, resource string, required bool) bool {
+	pendingRestarts := srv.loadPendingRestarts()
+	pending := pendingRestarts[resource]
+
+	if !required && !pending {
+		return false
+	}
+
+	if srv.disruptiveActionAllowed(ctx, "Restarts") {
+		if pending {
+			delete(pendingRestarts, resource)
+			srv.savePendingRestarts(pendingRestarts)
+		}
+
+		return true
+	}
+
+	if !pending {
+		pendingRestarts[resource] = true
+		srv.savePendingRestarts(pendingRestarts)
+	}
+
+	log.Debugf("restart of %s deferred until maintenance window", resource)
+
+	return false
+}
+
+// disruptiveActionAllowed returns true if a disruptive action (e.g. a restart, full upgrade or RAUC bundle installation)
+// can be performed now. Outside the maintenance window, deferral of each action is reported once,
+// not by every run outside the maintenance window.
+func (srv *Service) disruptiveActionAllowed(ctx context.Context, action string) bool {
+	if inMaintenanceWindow, err := srv.inMaintenanceWindow(time.Now()); err == nil && inMaintenanceWindow {
+		return true
+	}
+
+	if !srv.deferralsReported[action] {
+		if srv.deferralsReported == nil {
+			srv.deferralsReported = make(map[string]bool)
+		}
+
+		srv.deferralsReported[action] = true
+		ReportInfo(ctx, nil, "%s deferred until maintenance window.", action)
+	}
+
+	return false
+}
+
+// resetDeferrals makes sure that actions deferred after the maintenance window are reported again.
+func (srv *Service) resetDeferrals(now time.Time) {
+	if inMaintenanceWindow, err := srv.inMaintenanceWindow(now); err == nil && inMaintenanceWindow {
+		srv.deferralsReported = nil
+	}
+}
+
+// loadPendingRestarts returns a set of resources with restarts deferred until the maintenance window.
+func (srv *Service) loadPendingRestarts() map[string]bool {
+	pendingRestarts := make(map[string]bool)
+
+	data, err := os.ReadFile(filepath.Join(srv.appDirectory, restartsPendingFileName))
+	if err != nil {
+		if !errors.Is(err, fs.ErrNotExist) {
+			log.Errorf("failed to read pending restarts: %v", err)
+		}
+		return pendingRestarts
+	}
+
+	var resources []string
+	if err = json.Unmarshal(data, &resources); err != nil {
+		log.Errorf("failed to parse pending restarts: %v", err)
+		return pendingRestarts
+	}
+
+	for _, resource := range resources {
+		pendingRestarts[resource] = true
+	}
+
+	return pendingRestarts
+}
+
+// savePendingRestarts persists the set of resources with deferred restarts.
+func (srv *Service) savePendingRestarts(pendingRestarts map[string]bool) {
+	pendingFilePath := filepath.Join(srv.appDirectory, restartsPendingFileName)
+
+	if len(pendingRestarts) == 0 {
+		if err := os.Remove(pendingFilePath); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			log.Errorf("failed to remove pending restarts: %v", err)
+		}
+		return
+	}
+
+	resources := make([]string, 0, len(pendingRestarts))
+	for resource := range pendingRestarts {
+		resources = append(resources, resource)
+	}
+
+	sort.Strings(resources)
+
+	data, err := json.Marshal(resources)
+	if err != nil {
+		log.Errorf("failed to encode pending restarts: %v", err)
+		return
+	}
+
+	if err = utils.WriteFileSync(pendingFilePath, data, restartsPendingFileMode); err != nil {
+		log.Errorf("failed to record pending restarts: %v", err)
+	}
+}
@@ -0,0 +1,257 @@
+// Copyright 2024 qbee.io
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package configuration
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"go.qbee.io/agent/app/utils/assert"
+)
+
+func TestMaintenanceWindow_InMaintenanceWindow(t *testing.T) {
+	tests := []struct {
+		name     string
+		window   MaintenanceWindow
+		now      string
+		expected bool
+	}{
+		{
+			name:     "within daily window",
+			window:   MaintenanceWindow{Start: "01:00", End: "05:00", Timezone: "UTC"},
+			now:      "2024-06-15T03:00:00Z",
+			expected: true,
+		},
+		{
+			name:     "window start is inclusive",
+			window:   MaintenanceWindow{Start: "01:00", End: "05:00", Timezone: "UTC"},
+			now:      "2024-06-15T01:00:00Z",
+			expected: true,
+		},
+		{
+			name:     "window end is exclusive",
+			window:   MaintenanceWindow{Start: "01:00", End: "05:00", Timezone: "UTC"},
+			now:      "2024-06-15T05:00:00Z",
+			expected: false,
+		},
+		{
+			name:     "before daily window",
+			window:   MaintenanceWindow{Start: "01:00", End: "05:00", Timezone: "UTC"},
+			now:      "2024-06-15T00:59:00Z",
+			expected: false,
+		},
+		{
+			name:     "window in time zone",
+			window:   MaintenanceWindow{Start: "22:00", End: "23:59", Timezone: "Europe/Oslo"},
+			now:      "2024-06-15T21:30:00Z", // 23:30 CEST
+			expected: true,
+		},
+		{
+			name:     "outside window in time zone",
+			window:   MaintenanceWindow{Start: "22:00", End: "23:59", Timezone: "Europe/Oslo"},
+			now:      "2024-06-15T19:30:00Z", // 21:30 CEST
+			expected: false,
+		},
+		{
+			name:     "same instant within window in New York",
+			window:   MaintenanceWindow{Start: "08:00", End: "10:00", Timezone: "America/New_York"},
+			now:      "2024-01-10T14:00:00Z", // 09:00 EST
+			expected: true,
+		},
+		{
+			name:     "same instant outside window in Tokyo",
+			window:   MaintenanceWindow{Start: "08:00", End: "10:00", Timezone: "Asia/Tokyo"},
+			now:      "2024-01-10T14:00:00Z", // 23:00 JST
+			expected: false,
+		},
+		{
+			name:     "overnight window before midnight",
+			window:   MaintenanceWindow{Start: "22:00", End: "04:00", Weekdays: []string{"sat"}, Timezone: "Europe/Oslo"},
+			now:      "2024-06-15T21:00:00Z", // Saturday 23:00 CEST
+			expected: true,
+		},
+		{
+			name:     "overnight window after midnight belongs to the previous day",
+			window:   MaintenanceWindow{Start: "22:00", End: "04:00", Weekdays: []string{"sat"}, Timezone: "Europe/Oslo"},
+			now:      "2024-06-16T01:00:00Z", // Sunday 03:00 CEST
+			expected: true,
+		},
+		{
+			name:     "overnight window after midnight started on excluded day",
+			window:   MaintenanceWindow{Start: "22:00", End: "04:00", Weekdays: []string{"sat"}, Timezone: "Europe/Oslo"},
+			now:      "2024-06-15T00:00:00Z", // Saturday 02:00 CEST, window started on Friday
+			expected: false,
+		},
+		{
+			name:     "overnight window on excluded day",
+			window:   MaintenanceWindow{Start: "22:00", End: "04:00", Weekdays: []string{"sat"}, Timezone: "Europe/Oslo"},
+			now:      "2024-06-16T21:00:00Z", // Sunday 23:00 CEST
+			expected: false,
+		},
+		{
+			name:     "whole day window on selected weekday",
+			window:   MaintenanceWindow{Start: "00:00", End: "00:00", Weekdays: []string{"Monday"}, Timezone: "UTC"},
+			now:      "2024-01-15T12:00:00Z",
+			expected: true,
+		},
+		{
+			name:     "whole day window on other weekday",
+			window:   MaintenanceWindow{Start: "00:00", End: "00:00", Weekdays: []string{"Monday"}, Timezone: "UTC"},
+			now:      "2024-01-16T12:00:00Z",
+			expected: false,
+		},
+		{
+			name:     "winter time wall-clock",
+			window:   MaintenanceWindow{Start: "03:00", End: "04:00", Timezone: "Europe/Oslo"},
+			now:      "2024-03-30T02:30:00Z", // 03:30 CET
+			expected: true,
+		},
+		{
+			name:     "summer time wall-clock after spring forward",
+			window:   MaintenanceWindow{Start: "03:00", End: "04:00", Timezone: "Europe/Oslo"},
+			now:      "2024-03-31T01:30:00Z", // 03:30 CEST
+			expected: true,
+		},
+		{
+			name:     "window follows spring forward",
+			window:   MaintenanceWindow{Start: "03:00", End: "04:00", Timezone: "Europe/Oslo"},
+			now:      "2024-03-31T02:30:00Z", // 04:30 CEST (would be 03:30 CET)
+			expected: false,
+		},
+		{
+			name:     "skipped hour on spring forward",
+			window:   MaintenanceWindow{Start: "02:00", End: "04:00", Timezone: "Europe/Oslo"},
+			now:      "2024-03-31T00:30:00Z", // 01:30 CET
+			expected: false,
+		},
+		{
+			name:     "first pass of the repeated hour on fall back",
+			window:   MaintenanceWindow{Start: "02:00", End: "03:00", Timezone: "Europe/Oslo"},
+			now:      "2024-10-27T00:30:00Z", // 02:30 CEST
+			expected: true,
+		},
+		{
+			name:     "second pass of the repeated hour on fall back",
+			window:   MaintenanceWindow{Start: "02:00", End: "03:00", Timezone: "Europe/Oslo"},
+			now:      "2024-10-27T01:30:00Z", // 02:30 CET
+			expected: true,
+		},
+		{
+			name:     "fall back in southern hemisphere",
+			window:   MaintenanceWindow{Start: "02:00", End: "03:00", Timezone: "Australia/Sydney"},
+			now:      "2024-04-06T16:30:00Z", // 02:30 AEST on 2024-04-07, after clocks went back from 03:00 AEDT
+			expected: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			now, err := time.Parse(time.RFC3339, tt.now)
+			assert.NoError(t, err)
+
+			got, err := tt.window.InMaintenanceWindow(now)
+			assert.NoError(t, err)
+			assert.Equal(t, got, tt.expected)
+		})
+	}
+}
+
+func TestMaintenanceWindow_InMaintenanceWindow_invalid(t *testing.T) {
+	windows := []MaintenanceWindow{
+		{Start: "25:00", End: "04:00"},
+		{Start: "22:00", End: "4"},
+		{Start: "22:00", End: "04:00", Weekdays: []string{"mo"}},
+		{Start: "22:00", End: "04:00", Weekdays: []string{"someday"}},
+		{Start: "22:00", End: "04:00", Timezone: "Mars/Olympus_Mons"},
+	}
+
+	for _, window := range windows {
+		if _, err := window.InMaintenanceWindow(time.Now()); err == nil {
+			t.Fatalf("expected error for %+v", window)
+		}
+	}
+}
+
+func TestService_RebootAfterRun_outsideMaintenanceWindow(t *testing.T) {
+	otherDay := time.Now().UTC().Add(48 * time.Hour).Weekday().String()
+
+	srv := &Service{appDirectory: t.TempDir(), allowReboot: true}
+	srv.maintenanceWindow = &MaintenanceWindow{Start: "00:00", End: "00:00", Weekdays: []string{otherDay}, Timezone: "UTC"}
+
+	srv.RebootAfterRun(context.Background())
+	assert.False(t, srv.ShouldReboot())
+
+	pending, err := srv.isRebootPending()
+	assert.NoError(t, err)
+	assert.True(t, pending)
+
+	srv.maintenanceWindow = nil
+	assert.NoError(t, srv.runDeferredReboot(context.Background()))
+	assert.True(t, srv.ShouldReboot())
+}
+
+func TestService_restartAllowed(t *testing.T) {
+	otherDay := time.Now().UTC().Add(48 * time.Hour).Weekday().String()
+	outsideWindow := &MaintenanceWindow{Start: "00:00", End: "00:00", Weekdays: []string{otherDay}, Timezone: "UTC"}
+
+	reporter := NewReporter("", false, nil)
+	ctx := reporter.BundleContext(context.Background(), BundleSoftwareManagement, "")
+
+	srv := &Service{appDirectory: t.TempDir(), maintenanceWindow: outsideWindow}
+
+	// restarts outside the maintenance window are deferred and the deferral is reported once
+	assert.False(t, srv.restartAllowed(ctx, "service:nginx", true))
+	assert.False(t, srv.restartAllowed(ctx, "service:mosquitto", true))
+	assert.False(t, srv.restartAllowed(ctx, "service:redis", false))
+	assert.Length(t, reporter.Reports(), 1)
+	assert.Equal(t, reporter.Reports()[0].Text, "Restarts deferred until maintenance window.")
+
+	// deferred restarts are performed within the maintenance window, even if no longer required
+	srv.maintenanceWindow = nil
+	srv.resetDeferrals(time.Now())
+	assert.True(t, srv.restartAllowed(ctx, "service:nginx", false))
+	assert.True(t, srv.restartAllowed(ctx, "service:mosquitto", false))
+	assert.False(t, srv.restartAllowed(ctx, "service:nginx", false))
+	assert.Length(t, srv.deferralsReported, 0)
+
+	_, err := os.Stat(filepath.Join(srv.appDirectory, restartsPendingFileName))
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestService_disruptiveActionAllowed(t *testing.T) {
+	otherDay := time.Now().UTC().Add(48 * time.Hour).Weekday().String()
+	outsideWindow := &MaintenanceWindow{Start: "00:00", End: "00:00", Weekdays: []string{otherDay}, Timezone: "UTC"}
+
+	reporter := NewReporter("", false, nil)
+	ctx := reporter.BundleContext(context.Background(), BundlePackageManagement, "")
+
+	srv := &Service{maintenanceWindow: outsideWindow}
+
+	// each deferred action is reported once
+	assert.False(t, srv.disruptiveActionAllowed(ctx, "Full upgrade"))
+	assert.False(t, srv.disruptiveActionAllowed(ctx, "Full upgrade"))
+	assert.False(t, srv.disruptiveActionAllowed(ctx, "RAUC bundle installation"))
+	assert.Length(t, reporter.Reports(), 2)
+	assert.Equal(t, reporter.Reports()[0].Text, "Full upgrade deferred until maintenance window.")
+	assert.Equal(t, reporter.Reports()[1].Text, "RAUC bundle installation deferred until maintenance window.")
+
+	srv.maintenanceWindow = nil
+	assert.True(t, srv.disruptiveActionAllowed(ctx, "Full upgrade"))
+}
@@ -0,0 +1,104 @@
+// Copyright 2024 qbee.io
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package configuration
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+
+	"go.qbee.io/agent/app/log"
+	"go.qbee.io/agent/app/utils"
+)
+
+const (
+	postRebootCommandFileName = "post_reboot_command"
+	postRebootCommandFileMode = 0600
+	postRebootCommandTimeout  = 5 * time.Minute
+)
+
+// SavePostRebootCommand records configured post-reboot command, so it can be executed after the system reboots.
+// If no post-reboot command is configured, previously recorded command is removed.
+func (srv *Service) SavePostRebootCommand() error {
+	commandFilePath := filepath.Join(srv.appDirectory, postRebootCommandFileName)
+
+	if srv.postRebootCommand == "" {
+		if err := os.Remove(commandFilePath); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return fmt.Errorf("failed to remove post-reboot command: %w", err)
+		}
+
+		return nil
+	}
+
+	if err := utils.WriteFileSync(commandFilePath, []byte(srv.postRebootCommand), postRebootCommandFileMode); err != nil {
+		return fmt.Errorf("failed to save post-reboot command: %w", err)
+	}
+
+	return nil
+}
+
+// RunPostRebootCommand executes post-reboot command recorded before the system reboot (if any) and reports its result.
+// The command is removed before execution, so it runs at most once after each reboot.
+func (srv *Service) RunPostRebootCommand(ctx context.Context) error {
+	commandFilePath := filepath.Join(srv.appDirectory, postRebootCommandFileName)
+
+	command, err := os.ReadFile(commandFilePath)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil
+		}
+
+		return fmt.Errorf("failed to read post-reboot command: %w", err)
+	}
+
+	if err = os.Remove(commandFilePath); err != nil {
+		return fmt.Errorf("failed to remove post-reboot command: %w", err)
+	}
+
+	reporter := NewReporter(srv.currentCommitID, srv.reportToConsole, nil).WithConsoleFormat(srv.consoleReportFormat)
+	settingsCtx := reporter.BundleContext(ctx, BundleSettings, "")
+
+	ctxWithTimeout, cancel := context.WithTimeout(settingsCtx, postRebootCommandTimeout)
+	defer cancel()
+
+	output, err := utils.RunCommand(ctxWithTimeout, []string{getShell(), "-c", string(command)})
+	if err != nil {
+		ReportWarning(settingsCtx, output, "Post-reboot command failed: %v", err)
+	} else {
+		ReportInfo(settingsCtx, output, "Post-reboot command succeeded.")
+	}
+
+	if srv.auditLog != nil {
+		if err = srv.auditLog.record(reporter.Reports()); err != nil {
+			log.Errorf("failed to record audit log: %v", err)
+		}
+	}
+
+	if delivered, err := srv.sendReports(ctx, reporter.Reports()); err != nil {
+		if bufferErr := srv.addReportsToBuffer(reporter.Reports()[delivered:]); bufferErr != nil {
+			log.Errorf("failed to add reports to buffer: %v", bufferErr)
+		}
+
+		return fmt.Errorf("failed to send post-reboot command report: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,116 @@
+// Copyright 2024 qbee.io
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package configuration
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"go.qbee.io/agent/app/api"
+	"go.qbee.io/agent/app/utils/assert"
+)
+
+func TestService_SavePostRebootCommand(t *testing.T) {
+	srv := &Service{appDirectory: t.TempDir()}
+	commandFilePath := filepath.Join(srv.appDirectory, postRebootCommandFileName)
+
+	srv.postRebootCommand = "systemctl is-active my-app"
+	assert.NoError(t, srv.SavePostRebootCommand())
+
+	command, err := os.ReadFile(commandFilePath)
+	assert.NoError(t, err)
+	assert.Equal(t, string(command), srv.postRebootCommand)
+
+	// previously recorded command is removed when post-reboot command is not configured anymore
+	srv.postRebootCommand = ""
+	assert.NoError(t, srv.SavePostRebootCommand())
+
+	if _, err = os.Stat(commandFilePath); !os.IsNotExist(err) {
+		t.Fatalf("expected post-reboot command to be removed, got %v", err)
+	}
+
+	// nothing is executed when no command was recorded
+	assert.NoError(t, srv.RunPostRebootCommand(context.Background()))
+}
+
+// newPostRebootTestService returns a service connected to a test server responding with the provided status code.
+func newPostRebootTestService(t *testing.T, statusCode int) *Service {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(statusCode)
+	}))
+	t.Cleanup(server.Close)
+
+	serverURL, err := url.Parse(server.URL)
+	assert.NoError(t, err)
+
+	host, port, err := net.SplitHostPort(serverURL.Host)
+	assert.NoError(t, err)
+
+	apiClient := api.NewClient(host, port).WithTLSConfig(&tls.Config{InsecureSkipVerify: true})
+
+	return New(apiClient, t.TempDir(), t.TempDir())
+}
+
+func TestService_RunPostRebootCommand(t *testing.T) {
+	srv := newPostRebootTestService(t, http.StatusOK)
+	markerPath := filepath.Join(t.TempDir(), "executed")
+
+	srv.postRebootCommand = "echo executed >> " + markerPath
+	assert.NoError(t, srv.SavePostRebootCommand())
+
+	assert.NoError(t, srv.RunPostRebootCommand(context.Background()))
+
+	// command runs at most once after each reboot
+	assert.NoError(t, srv.RunPostRebootCommand(context.Background()))
+
+	output, err := os.ReadFile(markerPath)
+	assert.NoError(t, err)
+	assert.Equal(t, string(output), "executed\n")
+
+	// delivered reports are not buffered
+	reports, err := srv.readReportsBuffer()
+	assert.NoError(t, err)
+	assert.Length(t, reports, 0)
+}
+
+func TestService_RunPostRebootCommand_Failure(t *testing.T) {
+	srv := newPostRebootTestService(t, http.StatusServiceUnavailable)
+
+	srv.postRebootCommand = "echo not ready; exit 3"
+	assert.NoError(t, srv.SavePostRebootCommand())
+
+	// reports which failed to be delivered are buffered
+	assert.NotEqual(t, srv.RunPostRebootCommand(context.Background()), nil)
+
+	reports, err := srv.readReportsBuffer()
+	assert.NoError(t, err)
+	assert.Length(t, reports, 1)
+	assert.Equal(t, reports[0].Bundle, BundleSettings)
+	assert.Equal(t, reports[0].Severity, severityWarning)
+	assert.HasPrefix(t, reports[0].Text, "Post-reboot command failed:")
+
+	if _, err = os.Stat(filepath.Join(srv.appDirectory, postRebootCommandFileName)); !os.IsNotExist(err) {
+		t.Fatalf("expected post-reboot command to be removed, got %v", err)
+	}
+}
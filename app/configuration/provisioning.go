@@ -0,0 +1,94 @@
+// Copyright 2024 qbee.io
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package configuration
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+
+	"go.qbee.io/agent/app/utils"
+)
+
+const (
+	provisioningMarkerFileName = "provisioned.json"
+	provisioningMarkerFileMode = 0600
+)
+
+// provisioningMarker records the result of the one-time provisioning command.
+type provisioningMarker struct {
+	Command   string `json:"command"`
+	Succeeded bool   `json:"succeeded"`
+	Timestamp int64  `json:"ts"`
+}
+
+// isProvisioned returns true if the provisioning command was already executed on the device.
+func (srv *Service) isProvisioned() (bool, error) {
+	_, err := os.Stat(filepath.Join(srv.appDirectory, provisioningMarkerFileName))
+	if err == nil {
+		return true, nil
+	}
+
+	if errors.Is(err, fs.ErrNotExist) {
+		return false, nil
+	}
+
+	return false, fmt.Errorf("failed to check provisioning marker: %w", err)
+}
+
+// runProvisioningCommand executes the provisioning command once per device and reports its result.
+// The result is recorded in a marker file, so the command is not executed again unless the marker is removed.
+func (srv *Service) runProvisioningCommand(ctx context.Context) error {
+	if srv.provisioningCommand == "" {
+		return nil
+	}
+
+	provisioned, err := srv.isProvisioned()
+	if err != nil || provisioned {
+		return err
+	}
+
+	output, err := RunCommand(ctx, srv.provisioningCommand)
+	if err != nil {
+		ReportError(ctx, output, "Provisioning command failed: %v", err)
+	} else {
+		ReportInfo(ctx, output, "Provisioning command succeeded.")
+	}
+
+	marker := provisioningMarker{
+		Command:   srv.provisioningCommand,
+		Succeeded: err == nil,
+		Timestamp: time.Now().Unix(),
+	}
+
+	markerData, err := json.Marshal(marker)
+	if err != nil {
+		return fmt.Errorf("failed to encode provisioning marker: %w", err)
+	}
+
+	markerPath := filepath.Join(srv.appDirectory, provisioningMarkerFileName)
+	if err = utils.WriteFileSync(markerPath, markerData, provisioningMarkerFileMode); err != nil {
+		return fmt.Errorf("failed to save provisioning marker: %w", err)
+	}
+
+	return nil
+}
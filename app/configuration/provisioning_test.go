@@ -0,0 +1,60 @@
+// Copyright 2024 qbee.io
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package configuration
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"go.qbee.io/agent/app/utils/assert"
+)
+
+func TestService_runProvisioningCommand(t *testing.T) {
+	srv := &Service{appDirectory: t.TempDir()}
+	counterPath := filepath.Join(srv.appDirectory, "counter")
+	markerPath := filepath.Join(srv.appDirectory, provisioningMarkerFileName)
+
+	srv.provisioningCommand = "echo run >> " + counterPath + " && false"
+
+	// failed command is still recorded and not executed on subsequent runs
+	for i := 0; i < 2; i++ {
+		assert.NoError(t, srv.runProvisioningCommand(context.Background()))
+	}
+
+	output, err := os.ReadFile(counterPath)
+	assert.NoError(t, err)
+	assert.Equal(t, string(output), "run\n")
+
+	markerData, err := os.ReadFile(markerPath)
+	assert.NoError(t, err)
+
+	marker := new(provisioningMarker)
+	assert.NoError(t, json.Unmarshal(markerData, marker))
+	assert.Equal(t, marker.Command, srv.provisioningCommand)
+	assert.False(t, marker.Succeeded)
+
+	// clearing the marker allows the command to be executed again
+	assert.NoError(t, os.Remove(markerPath))
+	assert.NoError(t, srv.runProvisioningCommand(context.Background()))
+
+	output, err = os.ReadFile(counterPath)
+	assert.NoError(t, err)
+	assert.Equal(t, string(output), "run\nrun\n")
+}
@@ -0,0 +1,176 @@
+// Copyright 2024 qbee.io
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package configuration
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+const procMountsPath = "/proc/mounts"
+
+// errReadOnlyFilesystem is returned when the agent attempts to write to a read-only filesystem.
+var errReadOnlyFilesystem = errors.New("target filesystem is read-only")
+
+// readOnlyFilesystemError returns a clear error when err is caused by writing path on a read-only filesystem (EROFS).
+// Other errors are returned unchanged.
+func readOnlyFilesystemError(path string, err error) error {
+	if errors.Is(err, syscall.EROFS) {
+		return fmt.Errorf("%w: cannot write %s", errReadOnlyFilesystem, path)
+	}
+
+	return err
+}
+
+// mountPoint defines a mounted filesystem.
+type mountPoint struct {
+	device   string
+	path     string
+	fsType   string
+	readOnly bool
+}
+
+// parseMounts returns mounted filesystems from /proc/mounts formatted input (in the mount order).
+func parseMounts(reader io.Reader) ([]mountPoint, error) {
+	mounts := make([]mountPoint, 0)
+
+	scanner := bufio.NewScanner(reader)
+	for scanner.Scan() {
+		// e.g. "/dev/root / ext4 ro,relatime 0 0"
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 4 {
+			continue
+		}
+
+		mount := mountPoint{
+			device: unescapeMountField(fields[0]),
+			path:   unescapeMountField(fields[1]),
+			fsType: fields[2],
+		}
+
+		for _, option := range strings.Split(fields[3], ",") {
+			if option == "ro" {
+				mount.readOnly = true
+				break
+			}
+		}
+
+		mounts = append(mounts, mount)
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("error reading mounts: %w", err)
+	}
+
+	return mounts, nil
+}
+
+// unescapeMountField decodes octal escapes (e.g. "\040" for space) used in /proc/mounts.
+func unescapeMountField(field string) string {
+	if !strings.Contains(field, `\`) {
+		return field
+	}
+
+	var builder strings.Builder
+
+	for i := 0; i < len(field); i++ {
+		if field[i] == '\\' && i+3 < len(field) {
+			if char, err := strconv.ParseUint(field[i+1:i+4], 8, 8); err == nil {
+				builder.WriteByte(byte(char))
+				i += 3
+				continue
+			}
+		}
+
+		builder.WriteByte(field[i])
+	}
+
+	return builder.String()
+}
+
+// findMount returns the filesystem on which provided path is located (nil if not found).
+// When multiple filesystems are mounted at the same path, the most recent one is returned.
+func findMount(mounts []mountPoint, path string) *mountPoint {
+	path = filepath.Clean(path)
+
+	var found *mountPoint
+
+	for i := range mounts {
+		mountPath := mounts[i].path
+
+		if mountPath != "/" && path != mountPath && !strings.HasPrefix(path, mountPath+"/") {
+			continue
+		}
+
+		if found == nil || len(mountPath) >= len(found.path) {
+			found = &mounts[i]
+		}
+	}
+
+	return found
+}
+
+// readOnlyMount returns read-only mounted filesystem on which provided path is located, or nil otherwise.
+func readOnlyMount(path string) (*mountPoint, error) {
+	file, err := os.Open(procMountsPath)
+	if err != nil {
+		return nil, fmt.Errorf("error opening %s: %w", procMountsPath, err)
+	}
+	defer file.Close()
+
+	mounts, err := parseMounts(file)
+	if err != nil {
+		return nil, err
+	}
+
+	if mount := findMount(mounts, path); mount != nil && mount.readOnly {
+		return mount, nil
+	}
+
+	return nil, nil
+}
+
+// reportReadOnlyMount reports an error if the filesystem of the destination path is mounted read-only.
+// This makes failing storage (e.g. root remounted read-only after filesystem errors) or read-only rootfs
+// of A/B update systems visible, instead of a generic write failure.
+// Only errors caused by the read-only filesystem are reported, other errors (e.g. failed download) are not.
+// Returns true if read-only filesystem was reported.
+func reportReadOnlyMount(ctx context.Context, label, path string, err error) bool {
+	if !errors.Is(err, errReadOnlyFilesystem) && !errors.Is(err, syscall.EROFS) {
+		return false
+	}
+
+	mount, mountErr := readOnlyMount(path)
+	if mountErr == nil && mount != nil {
+		ReportError(ctx, err, msgWithLabel(label, "Cannot write %s: filesystem %s (%s) mounted at %s is read-only",
+			path, mount.device, mount.fsType, mount.path))
+		return true
+	}
+
+	// read-only filesystems might not be visible in mounts (e.g. read-only overlay lower layers)
+	ReportError(ctx, err, msgWithLabel(label, "Cannot write %s: target filesystem is read-only", path))
+
+	return true
+}
@@ -0,0 +1,99 @@
+// Copyright 2024 qbee.io
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package configuration
+
+import (
+	"context"
+	"errors"
+	"os"
+	"strings"
+	"syscall"
+	"testing"
+
+	"go.qbee.io/agent/app/utils/assert"
+)
+
+const testProcMounts = `/dev/root / ext4 ro,relatime 0 0
+proc /proc proc rw,nosuid,nodev,noexec,relatime 0 0
+tmpfs /tmp tmpfs rw,nosuid,nodev 0 0
+/dev/mmcblk0p3 /data ext4 rw,relatime 0 0
+/dev/mmcblk0p4 /data/app\040files ext4 ro,relatime 0 0
+`
+
+func Test_findMount(t *testing.T) {
+	mounts, err := parseMounts(strings.NewReader(testProcMounts))
+	assert.NoError(t, err)
+	assert.Length(t, mounts, 5)
+
+	tests := []struct {
+		path     string
+		device   string
+		readOnly bool
+	}{
+		{path: "/etc/app.conf", device: "/dev/root", readOnly: true},
+		{path: "/tmp/file", device: "tmpfs"},
+		{path: "/data", device: "/dev/mmcblk0p3"},
+		{path: "/data/app.conf", device: "/dev/mmcblk0p3"},
+		{path: "/data/app files/app.conf", device: "/dev/mmcblk0p4", readOnly: true},
+		{path: "/data/app filesystem", device: "/dev/mmcblk0p3"},
+		{path: "/tmp/../etc/hosts", device: "/dev/root", readOnly: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			mount := findMount(mounts, tt.path)
+			if mount == nil {
+				t.Fatalf("mount not found for %s", tt.path)
+			}
+
+			assert.Equal(t, mount.device, tt.device)
+			assert.Equal(t, mount.readOnly, tt.readOnly)
+		})
+	}
+}
+
+func Test_findMount_Overmounted(t *testing.T) {
+	mounts, err := parseMounts(strings.NewReader("/dev/root / ext4 rw 0 0\n/dev/root / ext4 ro 0 0\n"))
+	assert.NoError(t, err)
+
+	// the most recent mount takes precedence
+	mount := findMount(mounts, "/etc/hosts")
+	assert.True(t, mount.readOnly)
+}
+
+func Test_readOnlyFilesystemError(t *testing.T) {
+	err := readOnlyFilesystemError("/etc/app.conf", &os.PathError{Op: "open", Path: "/etc/app.conf", Err: syscall.EROFS})
+	assert.True(t, errors.Is(err, errReadOnlyFilesystem))
+	assert.Equal(t, err.Error(), "target filesystem is read-only: cannot write /etc/app.conf")
+
+	otherErr := &os.PathError{Op: "open", Path: "/etc/app.conf", Err: syscall.EACCES}
+	assert.Equal(t, readOnlyFilesystemError("/etc/app.conf", otherErr), error(otherErr))
+}
+
+func Test_reportReadOnlyMount(t *testing.T) {
+	reporter := NewReporter("", false, nil)
+	ctx := reporter.BundleContext(context.Background(), BundleFileDistribution, "")
+
+	// errors not caused by read-only filesystem are left to the caller
+	otherErr := &os.PathError{Op: "open", Path: "/etc/app.conf", Err: syscall.EACCES}
+	assert.Equal(t, reportReadOnlyMount(ctx, "", "/etc/app.conf", otherErr), false)
+	assert.Length(t, reporter.Reports(), 0)
+
+	roErr := readOnlyFilesystemError("/etc/app.conf", &os.PathError{Op: "open", Path: "/etc/app.conf", Err: syscall.EROFS})
+	assert.Equal(t, reportReadOnlyMount(ctx, "", "/etc/app.conf", roErr), true)
+	assert.Length(t, reporter.Reports(), 1)
+}
@@ -0,0 +1,149 @@
+// Copyright 2024 qbee.io
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package configuration
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"go.qbee.io/agent/app/log"
+	"go.qbee.io/agent/app/utils"
+)
+
+const (
+	rebootPendingFileName = "reboot_pending"
+	rebootPendingFileMode = 0600
+)
+
+// deferReboot records that a reboot was requested while reboots are disallowed by the settings bundle.
+// The deferred reboot is performed by a later run, once reboots are allowed again.
+func (srv *Service) deferReboot(ctx context.Context) {
+	pendingFilePath := filepath.Join(srv.appDirectory, rebootPendingFileName)
+	timestamp := []byte(strconv.FormatInt(time.Now().Unix(), 10))
+
+	if err := utils.WriteFileSync(pendingFilePath, timestamp, rebootPendingFileMode); err != nil {
+		ReportError(ctx, err, "Cannot record deferred reboot.")
+		return
+	}
+
+	ReportWarning(ctx, nil, "Reboot deferred by policy")
+}
+
+// isRebootPending returns true if there is a reboot deferred by policy.
+func (srv *Service) isRebootPending() (bool, error) {
+	_, err := os.Stat(filepath.Join(srv.appDirectory, rebootPendingFileName))
+	if err == nil {
+		return true, nil
+	}
+
+	if errors.Is(err, fs.ErrNotExist) {
+		return false, nil
+	}
+
+	return false, fmt.Errorf("failed to check pending reboot: %w", err)
+}
+
+// rebootAllowed returns true if the settings bundle allows to reboot the system at the moment.
+func (srv *Service) rebootAllowed() bool {
+	if !srv.allowReboot {
+		return false
+	}
+
+	inMaintenanceWindow, err := srv.inMaintenanceWindow(time.Now())
+
+	return err == nil && inMaintenanceWindow
+}
+
+// systemBootTime returns time when the system was booted.
+func systemBootTime() (time.Time, error) {
+	sysinfo := new(syscall.Sysinfo_t)
+	if err := syscall.Sysinfo(sysinfo); err != nil {
+		return time.Time{}, fmt.Errorf("failed to get system uptime: %w", err)
+	}
+
+	return time.Now().Add(-time.Duration(sysinfo.Uptime) * time.Second), nil
+}
+
+// clearRebootPendingAfterBoot removes the pending reboot marker when the system was booted after the reboot
+// was deferred (e.g. rebooted manually), so the deferred reboot is not performed needlessly.
+func (srv *Service) clearRebootPendingAfterBoot() error {
+	pendingFilePath := filepath.Join(srv.appDirectory, rebootPendingFileName)
+
+	data, err := os.ReadFile(pendingFilePath)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil
+		}
+		return fmt.Errorf("failed to check pending reboot: %w", err)
+	}
+
+	// marker without a valid timestamp is kept, so the deferred reboot is not lost
+	deferredAt, err := strconv.ParseInt(strings.TrimSpace(string(data)), 10, 64)
+	if err != nil {
+		return nil
+	}
+
+	bootTime, err := systemBootTime()
+	if err != nil {
+		return err
+	}
+
+	if !bootTime.After(time.Unix(deferredAt, 0)) {
+		return nil
+	}
+
+	if err = os.Remove(pendingFilePath); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("failed to remove pending reboot marker: %w", err)
+	}
+
+	log.Infof("System was rebooted since the reboot was deferred, clearing pending reboot")
+
+	return nil
+}
+
+// runDeferredReboot schedules reboot deferred by policy during one of the previous runs, if reboots are now allowed.
+// Deferred reboot is dropped when the system was rebooted in the meantime.
+func (srv *Service) runDeferredReboot(ctx context.Context) error {
+	if err := srv.clearRebootPendingAfterBoot(); err != nil {
+		return err
+	}
+
+	if !srv.rebootAllowed() {
+		return nil
+	}
+
+	pending, err := srv.isRebootPending()
+	if err != nil || !pending {
+		return err
+	}
+
+	if err = os.Remove(filepath.Join(srv.appDirectory, rebootPendingFileName)); err != nil {
+		return fmt.Errorf("failed to remove pending reboot marker: %w", err)
+	}
+
+	srv.RebootAfterRun(ctx)
+
+	return nil
+}
@@ -0,0 +1,63 @@
+// Copyright 2024 qbee.io
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package configuration
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"go.qbee.io/agent/app/utils/assert"
+)
+
+func TestService_RebootAfterRun_deferredByPolicy(t *testing.T) {
+	srv := &Service{appDirectory: t.TempDir()}
+	pendingFilePath := filepath.Join(srv.appDirectory, rebootPendingFileName)
+
+	// reboot is deferred when disallowed
+	srv.RebootAfterRun(context.Background())
+	assert.False(t, srv.ShouldReboot())
+
+	_, err := os.Stat(pendingFilePath)
+	assert.NoError(t, err)
+
+	// deferred reboot is kept while reboots are disallowed
+	assert.NoError(t, srv.runDeferredReboot(context.Background()))
+	assert.False(t, srv.ShouldReboot())
+
+	// deferred reboot is scheduled once reboots are allowed again
+	srv.allowReboot = true
+	assert.NoError(t, srv.runDeferredReboot(context.Background()))
+	assert.True(t, srv.ShouldReboot())
+
+	_, err = os.Stat(pendingFilePath)
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestService_runDeferredReboot_rebootedSinceDeferral(t *testing.T) {
+	srv := &Service{appDirectory: t.TempDir(), allowReboot: true}
+	pendingFilePath := filepath.Join(srv.appDirectory, rebootPendingFileName)
+
+	// reboot deferred long before the system was booted is no longer needed
+	assert.NoError(t, os.WriteFile(pendingFilePath, []byte("1"), rebootPendingFileMode))
+	assert.NoError(t, srv.runDeferredReboot(context.Background()))
+	assert.False(t, srv.ShouldReboot())
+
+	_, err := os.Stat(pendingFilePath)
+	assert.True(t, os.IsNotExist(err))
+}
@@ -19,11 +19,18 @@ package configuration
 import (
 	"context"
 	"encoding/base64"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"os"
+	"os/exec"
+	"sort"
 	"strings"
 	"time"
 
 	"go.qbee.io/agent/app/api"
+	"go.qbee.io/agent/app/log"
+	"go.qbee.io/agent/app/software"
 )
 
 // Report represents a single configuration report.
@@ -45,17 +52,49 @@ type Report struct {
 
 	// Timestamp when the report was created.
 	Timestamp int64 `json:"ts"`
+
+	// Code is a machine-readable report code in the <bundle>[.<action>].<status> format
+	// (e.g. "package_management.install.failed").
+	Code string `json:"code,omitempty"`
+
+	// Action performed when the report was created (e.g. "install"), if known.
+	Action string `json:"action,omitempty"`
+
+	// Target of the action (e.g. package name or file path), if known.
+	Target string `json:"target,omitempty"`
+
+	// Status of the reported operation: ok, warning or failed.
+	Status string `json:"status,omitempty"`
+
+	// ErrorClass classifies the error attached to the report (e.g. "timeout"), if any.
+	ErrorClass string `json:"error_class,omitempty"`
+
+	// PackageFailures lists packages which failed to be installed or upgraded, if known.
+	PackageFailures []software.PackageFailure `json:"package_failures,omitempty"`
 }
 
 func (report Report) String() string {
 	return fmt.Sprintf("[%s] %s", report.Severity, report.Text)
 }
 
+// ReportFormat defines how reports are printed to console.
+type ReportFormat int
+
+// Supported console report formats.
+const (
+	// ReportFormatText prints human-readable reports and operation logs (e.g. "report: [INFO] text").
+	ReportFormatText ReportFormat = iota
+
+	// ReportFormatJSON prints each report as a single JSON line (operation log is included in the report).
+	ReportFormatJSON
+)
+
 // Reporter is used to collect configuration reports from a single execution.
 type Reporter struct {
 	commitID        string
 	reports         []Report
 	reportToConsole bool
+	consoleFormat   ReportFormat
 	secrets         []string
 }
 
@@ -65,8 +104,28 @@ const (
 	ctxReporter               = contextKey("configuration:reporter")
 	ctxReporterBundleName     = contextKey("configuration:reporter:bundle-name")
 	ctxReporterBundleCommitID = contextKey("configuration:reporter:bundle-commit-id")
+	ctxReporterAction         = contextKey("configuration:reporter:action")
 )
 
+// Report actions.
+const (
+	reportActionInstall = "install"
+	reportActionUpgrade = "upgrade"
+	reportActionRemove  = "remove"
+)
+
+// reportAction defines the action and its target attached to reports.
+type reportAction struct {
+	action string
+	target string
+}
+
+// withReportAction returns context with the action (e.g. "install") and its target (e.g. package name)
+// attached to all reports created with it.
+func withReportAction(ctx context.Context, action, target string) context.Context {
+	return context.WithValue(ctx, ctxReporterAction, reportAction{action: action, target: target})
+}
+
 // BundleContext returns context with bundle information attached to it.
 func (reporter *Reporter) BundleContext(ctx context.Context, bundleName string, bundleCommitID string) context.Context {
 	ctx = context.WithValue(ctx, ctxReporter, reporter)
@@ -74,6 +133,12 @@ func (reporter *Reporter) BundleContext(ctx context.Context, bundleName string,
 	return context.WithValue(ctx, ctxReporterBundleCommitID, bundleCommitID)
 }
 
+// WithConsoleFormat sets the format of reports printed to console.
+func (reporter *Reporter) WithConsoleFormat(format ReportFormat) *Reporter {
+	reporter.consoleFormat = format
+	return reporter
+}
+
 // Reports returns collected reports.
 func (reporter *Reporter) Reports() []Report {
 	return reporter.reports
@@ -96,8 +161,26 @@ func NewReporter(commitID string, reportToConsole bool, secrets []string) *Repor
 		commitID:        commitID,
 		reports:         make([]Report, 0),
 		reportToConsole: reportToConsole,
-		secrets:         secrets,
+		secrets:         redactableSecrets(secrets),
+	}
+}
+
+// redactableSecrets returns non-empty secrets ordered from the longest to the shortest,
+// so secrets containing other secrets are redacted as a whole.
+func redactableSecrets(secrets []string) []string {
+	redactable := make([]string, 0, len(secrets))
+
+	for _, secret := range secrets {
+		if secret != "" {
+			redactable = append(redactable, secret)
+		}
 	}
+
+	sort.SliceStable(redactable, func(i, j int) bool {
+		return len(redactable[i]) > len(redactable[j])
+	})
+
+	return redactable
 }
 
 const (
@@ -106,6 +189,78 @@ const (
 	severityError   = "ERR"
 )
 
+// Report statuses.
+const (
+	ReportStatusOK      = "ok"
+	ReportStatusWarning = "warning"
+	ReportStatusFailed  = "failed"
+)
+
+// reportStatuses maps report severity to report status.
+var reportStatuses = map[string]string{
+	severityInfo:    ReportStatusOK,
+	severityWarning: ReportStatusWarning,
+	severityError:   ReportStatusFailed,
+}
+
+// Error classes of reports.
+const (
+	ReportErrorClassTimeout            = "timeout"
+	ReportErrorClassCanceled           = "canceled"
+	ReportErrorClassConnection         = "connection"
+	ReportErrorClassReadOnlyFilesystem = "read-only-filesystem"
+	ReportErrorClassPermissionDenied   = "permission-denied"
+	ReportErrorClassNotFound           = "not-found"
+	ReportErrorClassPackageManager     = "package-manager"
+	ReportErrorClassCommand            = "command-failed"
+	ReportErrorClassOther              = "other"
+)
+
+// reportErrorClass returns error class of the extra log, or empty string when extra log is not an error.
+func reportErrorClass(extraLog any) string {
+	err, isError := extraLog.(error)
+	if !isError || err == nil {
+		return ""
+	}
+
+	var pkgErr *software.PackageError
+	var exitErr *exec.ExitError
+
+	switch {
+	case errors.Is(err, context.DeadlineExceeded):
+		return ReportErrorClassTimeout
+	case errors.Is(err, context.Canceled):
+		return ReportErrorClassCanceled
+	case errors.As(err, new(api.ConnectionError)):
+		return ReportErrorClassConnection
+	case errors.Is(err, errReadOnlyFilesystem):
+		return ReportErrorClassReadOnlyFilesystem
+	case errors.Is(err, os.ErrPermission):
+		return ReportErrorClassPermissionDenied
+	case errors.Is(err, os.ErrNotExist):
+		return ReportErrorClassNotFound
+	case errors.As(err, &pkgErr):
+		return ReportErrorClassPackageManager
+	case errors.As(err, &exitErr):
+		return ReportErrorClassCommand
+	default:
+		return ReportErrorClassOther
+	}
+}
+
+// reportCode returns report code in the <bundle>[.<action>].<status> format.
+func reportCode(bundle, action, status string) string {
+	parts := make([]string, 0, 3)
+
+	for _, part := range []string{bundle, action, status} {
+		if part != "" {
+			parts = append(parts, part)
+		}
+	}
+
+	return strings.Join(parts, ".")
+}
+
 // msgWithLabel returns a message with a label (if provided).
 func msgWithLabel(label, msgFmt string, args ...any) string {
 	if label == "" {
@@ -160,26 +315,52 @@ func addReport(ctx context.Context, severity string, extraLog any, msgFmt string
 	extraLogBytes = reporter.Redact(extraLogBytes)
 	text := reporter.Redact(fmt.Sprintf(msgFmt, args...))
 
+	bundleName := ctx.Value(ctxReporterBundleName).(string)
+	action, _ := ctx.Value(ctxReporterAction).(reportAction)
+	status := reportStatuses[severity]
+
 	report := Report{
-		Bundle:         ctx.Value(ctxReporterBundleName).(string),
+		Bundle:         bundleName,
 		BundleCommitID: ctx.Value(ctxReporterBundleCommitID).(string),
 		CommitID:       reporter.commitID,
-		Labels:         ctx.Value(ctxReporterBundleName).(string),
+		Labels:         bundleName,
 		Severity:       severity,
 		Text:           text,
 		Log:            base64.StdEncoding.EncodeToString([]byte(extraLogBytes)),
 		Timestamp:      time.Now().Unix(),
+		Code:           reportCode(bundleName, action.action, status),
+		Action:         action.action,
+		Target:         reporter.Redact(action.target),
+		Status:         status,
+		ErrorClass:     reportErrorClass(extraLog),
+	}
+
+	var pkgErr *software.PackageError
+	if err, isError := extraLog.(error); isError && errors.As(err, &pkgErr) {
+		report.PackageFailures = pkgErr.Failures
 	}
 
 	if reporter.reportToConsole {
-		if len(extraLogBytes) > 0 {
-			for _, line := range strings.Split(strings.TrimSpace(extraLogBytes), "\n") {
-				fmt.Println(consolePrefixLog, line)
-			}
+		reporter.printReport(report, extraLogBytes)
+	}
+
+	reporter.reports = append(reporter.reports, report)
+}
+
+// printReport prints report to console using reporter's console format.
+func (reporter *Reporter) printReport(report Report, extraLog string) {
+	if reporter.consoleFormat == ReportFormatJSON {
+		if err := json.NewEncoder(os.Stdout).Encode(report); err != nil {
+			log.Errorf("failed to encode report: %v", err)
 		}
+		return
+	}
 
-		fmt.Println(consolePrefixReport, report)
+	if len(extraLog) > 0 {
+		for _, line := range strings.Split(strings.TrimSpace(extraLog), "\n") {
+			fmt.Println(consolePrefixLog, line)
+		}
 	}
 
-	reporter.reports = append(reporter.reports, report)
+	fmt.Println(consolePrefixReport, report)
 }
@@ -23,6 +23,7 @@ import (
 	"testing"
 
 	"go.qbee.io/agent/app/api"
+	"go.qbee.io/agent/app/software"
 	"go.qbee.io/agent/app/utils/assert"
 )
 
@@ -66,6 +67,42 @@ func Test_Reporter_Redact(t *testing.T) {
 			expectedReportText: "log message",
 			expectedReportLog:  "recording ******** in extra log",
 		},
+		{
+			name:    "reporter with secret in command output",
+			secrets: []string{"secret123"},
+			testFn: func(ctx context.Context) {
+				ReportInfo(ctx, []byte("Container secret123-web-1 Started\n"), "Started compose project %s", "secret123")
+			},
+			expectedReportText: "Started compose project ********",
+			expectedReportLog:  "Container ********-web-1 Started\n",
+		},
+		{
+			name:    "reporter with secret in error",
+			secrets: []string{"secret123"},
+			testFn: func(ctx context.Context) {
+				ReportError(ctx, fmt.Errorf("command failed: secret123"), "log message")
+			},
+			expectedReportText: "log message",
+			expectedReportLog:  "command failed: ********",
+		},
+		{
+			name:    "reporter with overlapping secrets",
+			secrets: []string{"secret", "secret123"},
+			testFn: func(ctx context.Context) {
+				ReportInfo(ctx, "secret123 and secret", "log message")
+			},
+			expectedReportText: "log message",
+			expectedReportLog:  "******** and ********",
+		},
+		{
+			name:    "reporter with empty secret",
+			secrets: []string{""},
+			testFn: func(ctx context.Context) {
+				ReportInfo(ctx, "extra log", "log message")
+			},
+			expectedReportText: "log message",
+			expectedReportLog:  "extra log",
+		},
 	}
 
 	for _, c := range cases {
@@ -137,3 +174,82 @@ func Test_Reporter_Skip_Connectivity_Issues(t *testing.T) {
 		})
 	}
 }
+
+func Test_Reporter_StructuredFields(t *testing.T) {
+	cases := []struct {
+		name     string
+		testFn   func(ctx context.Context)
+		expected Report
+	}{
+		{
+			name: "info without action",
+			testFn: func(ctx context.Context) {
+				ReportInfo(ctx, nil, "message")
+			},
+			expected: Report{Code: "package_management.ok", Status: ReportStatusOK},
+		},
+		{
+			name: "error with action",
+			testFn: func(ctx context.Context) {
+				ctx = withReportAction(ctx, reportActionInstall, "secret123-tools")
+				ReportError(ctx, fmt.Errorf("install failed: %w", context.DeadlineExceeded), "message")
+			},
+			expected: Report{
+				Code:       "package_management.install.failed",
+				Action:     reportActionInstall,
+				Target:     "********-tools",
+				Status:     ReportStatusFailed,
+				ErrorClass: ReportErrorClassTimeout,
+			},
+		},
+		{
+			name: "warning with string log",
+			testFn: func(ctx context.Context) {
+				ctx = withReportAction(ctx, reportActionUpgrade, "")
+				ReportWarning(ctx, "output", "message")
+			},
+			expected: Report{
+				Code:   "package_management.upgrade.warning",
+				Action: reportActionUpgrade,
+				Status: ReportStatusWarning,
+			},
+		},
+		{
+			name: "package manager error",
+			testFn: func(ctx context.Context) {
+				pkgErr := &software.PackageError{
+					Failures: []software.PackageFailure{{Package: "curl", Reason: software.FailureReasonNotFound}},
+					Err:      fmt.Errorf("exit status 100"),
+				}
+				ReportError(ctx, fmt.Errorf("install failed: %w", pkgErr), "message")
+			},
+			expected: Report{
+				Code:            "package_management.failed",
+				Status:          ReportStatusFailed,
+				ErrorClass:      ReportErrorClassPackageManager,
+				PackageFailures: []software.PackageFailure{{Package: "curl", Reason: software.FailureReasonNotFound}},
+			},
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			reporter := NewReporter("", false, []string{"secret123"})
+
+			ctx := reporter.BundleContext(context.Background(), BundlePackageManagement, "")
+
+			c.testFn(ctx)
+
+			assert.Length(t, reporter.reports, 1)
+
+			report := reporter.reports[0]
+
+			assert.Equal(t, report.Code, c.expected.Code)
+			assert.Equal(t, report.Action, c.expected.Action)
+			assert.Equal(t, report.Target, c.expected.Target)
+			assert.Equal(t, report.Status, c.expected.Status)
+			assert.Equal(t, report.ErrorClass, c.expected.ErrorClass)
+			assert.Equal(t, report.PackageFailures, c.expected.PackageFailures)
+		})
+	}
+}
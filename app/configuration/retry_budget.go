@@ -0,0 +1,77 @@
+// Copyright 2023 qbee.io
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package configuration
+
+import (
+	"errors"
+	"sync"
+
+	"go.qbee.io/agent/app/api"
+)
+
+// errRetryBudgetExhausted is returned by device hub operations once the run's retry budget is exhausted.
+var errRetryBudgetExhausted = errors.New("run retry budget exhausted")
+
+// retryBudget limits the number of failed device hub operations during a single run.
+// Once exhausted, remaining operations fail fast, so a degraded network doesn't stretch a run far beyond its interval.
+type retryBudget struct {
+	// limit of failed operations per run (0 means unlimited)
+	limit    int
+	failures int
+	mutex    sync.Mutex
+}
+
+// reset starts a new run with provided limit.
+func (budget *retryBudget) reset(limit int) {
+	budget.mutex.Lock()
+	defer budget.mutex.Unlock()
+
+	budget.limit = limit
+	budget.failures = 0
+}
+
+// check returns errRetryBudgetExhausted if no more failed operations are allowed in the current run.
+func (budget *retryBudget) check() error {
+	budget.mutex.Lock()
+	defer budget.mutex.Unlock()
+
+	if budget.limit > 0 && budget.failures >= budget.limit {
+		return errRetryBudgetExhausted
+	}
+
+	return nil
+}
+
+// track consumes the budget if the operation failed due to connectivity issues.
+func (budget *retryBudget) track(err error) {
+	if err == nil || !errors.As(err, new(api.ConnectionError)) {
+		return
+	}
+
+	budget.mutex.Lock()
+	defer budget.mutex.Unlock()
+
+	budget.failures++
+}
+
+// failedOperations returns number of failed operations in the current run.
+func (budget *retryBudget) failedOperations() int {
+	budget.mutex.Lock()
+	defer budget.mutex.Unlock()
+
+	return budget.failures
+}
@@ -0,0 +1,61 @@
+// Copyright 2023 qbee.io
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package configuration
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"go.qbee.io/agent/app/api"
+)
+
+func Test_retryBudget(t *testing.T) {
+	connectionErr := fmt.Errorf("error getting file: %w", api.NewConnectionError(errors.New("timeout")))
+
+	budget := new(retryBudget)
+	budget.reset(2)
+
+	// only connectivity issues consume the budget
+	budget.track(nil)
+	budget.track(errors.New("not found"))
+	budget.track(connectionErr)
+
+	if err := budget.check(); err != nil {
+		t.Fatalf("expected budget to be available, got %v", err)
+	}
+
+	budget.track(connectionErr)
+
+	if err := budget.check(); !errors.Is(err, errRetryBudgetExhausted) {
+		t.Fatalf("expected budget to be exhausted, got %v", err)
+	}
+
+	if got := budget.failedOperations(); got != 2 {
+		t.Fatalf("expected 2 failed operations, got %d", got)
+	}
+
+	// new run with unlimited budget
+	budget.reset(0)
+	for i := 0; i < 10; i++ {
+		budget.track(connectionErr)
+	}
+
+	if err := budget.check(); err != nil {
+		t.Fatalf("expected unlimited budget, got %v", err)
+	}
+}
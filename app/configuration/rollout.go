@@ -0,0 +1,40 @@
+// Copyright 2024 qbee.io
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package configuration
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+)
+
+// inRollout returns true if device should execute a bundle with provided rollout percentage.
+// Each device is assigned a stable bucket (0-99) based on a hash of its ID,
+// so increasing the percentage only adds devices to the ones already selected.
+func inRollout(deviceID string, percentage int) bool {
+	if percentage <= 0 || percentage >= 100 {
+		return true
+	}
+
+	return rolloutBucket(deviceID) < percentage
+}
+
+// rolloutBucket returns a stable bucket (0-99) for the device.
+func rolloutBucket(deviceID string) int {
+	digest := sha256.Sum256([]byte(deviceID))
+
+	return int(binary.BigEndian.Uint64(digest[:8]) % 100)
+}
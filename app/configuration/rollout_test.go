@@ -0,0 +1,56 @@
+// Copyright 2024 qbee.io
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package configuration
+
+import (
+	"fmt"
+	"testing"
+
+	"go.qbee.io/agent/app/utils/assert"
+)
+
+func Test_inRollout(t *testing.T) {
+	// bundles without rollout percentage are executed on all devices
+	assert.True(t, inRollout("device", 0))
+	assert.True(t, inRollout("device", 100))
+
+	selected := make(map[string]bool)
+
+	for _, percentage := range []int{10, 25, 50, 90} {
+		count := 0
+
+		for i := 0; i < 1000; i++ {
+			deviceID := fmt.Sprintf("device-%d", i)
+
+			if !inRollout(deviceID, percentage) {
+				// devices selected at lower percentage stay selected as the percentage grows
+				if selected[deviceID] {
+					t.Fatalf("device %s deselected at %d%%", deviceID, percentage)
+				}
+				continue
+			}
+
+			selected[deviceID] = true
+			count++
+		}
+
+		// selection should roughly match requested percentage
+		if count < percentage*10-50 || count > percentage*10+50 {
+			t.Errorf("expected around %d devices selected at %d%%, got %d", percentage*10, percentage, count)
+		}
+	}
+}
@@ -0,0 +1,81 @@
+// Copyright 2023 qbee.io
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package configuration
+
+import (
+	"time"
+
+	"go.qbee.io/agent/app/inventory"
+)
+
+// runStats accumulates bundle execution statistics across agent runs.
+type runStats struct {
+	// bundles contains accumulated statistics mapped by bundle name
+	bundles map[string]*inventory.BundleRun
+
+	// lastRun contains statistics of the last finished run (nil if no run finished yet)
+	lastRun *inventory.AgentRun
+
+	// currentRun contains statistics of the run in progress
+	currentRun *inventory.AgentRun
+}
+
+// start begins collecting statistics for a new run.
+func (stats *runStats) start(commitID string, startTime time.Time) {
+	stats.currentRun = &inventory.AgentRun{
+		CommitID: commitID,
+		Started:  startTime.Unix(),
+		Bundles:  make([]inventory.BundleRun, 0),
+	}
+}
+
+// addBundle records a single bundle execution of the current run.
+func (stats *runStats) addBundle(bundleName string, duration time.Duration, success bool) {
+	if stats.bundles == nil {
+		stats.bundles = make(map[string]*inventory.BundleRun)
+	}
+
+	bundleStats, ok := stats.bundles[bundleName]
+	if !ok {
+		bundleStats = &inventory.BundleRun{Name: bundleName}
+		stats.bundles[bundleName] = bundleStats
+	}
+
+	bundleStats.Duration = duration.Milliseconds()
+	bundleStats.TotalDuration += duration.Milliseconds()
+
+	if success {
+		bundleStats.Succeeded++
+	} else {
+		bundleStats.Failed++
+	}
+
+	if stats.currentRun != nil {
+		stats.currentRun.Bundles = append(stats.currentRun.Bundles, *bundleStats)
+	}
+}
+
+// finish completes the current run, which becomes available as the last run.
+func (stats *runStats) finish(duration time.Duration) {
+	if stats.currentRun == nil {
+		return
+	}
+
+	stats.currentRun.Duration = duration.Milliseconds()
+	stats.lastRun = stats.currentRun
+	stats.currentRun = nil
+}
@@ -0,0 +1,58 @@
+// Copyright 2023 qbee.io
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package configuration
+
+import (
+	"testing"
+	"time"
+
+	"go.qbee.io/agent/app/inventory"
+	"go.qbee.io/agent/app/utils/assert"
+)
+
+func Test_runStats(t *testing.T) {
+	stats := new(runStats)
+	assert.Equal(t, stats.lastRun, (*inventory.AgentRun)(nil))
+
+	startTime := time.Now()
+
+	stats.start("commit1", startTime)
+	stats.addBundle(BundleFileDistribution, 2*time.Second, true)
+	stats.addBundle(BundleUsers, time.Second, false)
+	stats.finish(3 * time.Second)
+
+	stats.start("commit2", startTime)
+	stats.addBundle(BundleFileDistribution, time.Second, true)
+	stats.finish(time.Second)
+
+	expectedRun := &inventory.AgentRun{
+		CommitID: "commit2",
+		Started:  startTime.Unix(),
+		Duration: 1000,
+		Bundles: []inventory.BundleRun{
+			{
+				Name:          BundleFileDistribution,
+				Duration:      1000,
+				TotalDuration: 3000,
+				Succeeded:     2,
+			},
+		},
+	}
+
+	assert.Equal(t, stats.lastRun, expectedRun)
+	assert.Equal(t, stats.bundles[BundleUsers].Failed, 1)
+}
@@ -0,0 +1,124 @@
+// Copyright 2023 qbee.io
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package configuration
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync/atomic"
+)
+
+const (
+	bundleRunStatusUnchanged = "no changes"
+	bundleRunStatusChanged   = "changed"
+	bundleRunStatusFailed    = "failed"
+)
+
+const ctxChangeRecorder = contextKey("configuration:change-recorder")
+
+// changeRecorder records whether a bundle made changes to the system.
+type changeRecorder struct {
+	changed atomic.Bool
+}
+
+// withChangeRecorder returns context with a new change recorder attached to it.
+func withChangeRecorder(ctx context.Context) (context.Context, *changeRecorder) {
+	recorder := new(changeRecorder)
+
+	return context.WithValue(ctx, ctxChangeRecorder, recorder), recorder
+}
+
+// recordChange marks the bundle executed with the provided context as changed.
+func recordChange(ctx context.Context) {
+	if recorder, ok := ctx.Value(ctxChangeRecorder).(*changeRecorder); ok {
+		recorder.changed.Store(true)
+	}
+}
+
+// reportChange records a change made by the bundle and adds an info message about it to the reporter.
+func reportChange(ctx context.Context, extraLog any, msgFmt string, args ...any) {
+	recordChange(ctx)
+	ReportInfo(ctx, extraLog, msgFmt, args...)
+}
+
+// bundleRunSummary describes the outcome of a single bundle execution.
+type bundleRunSummary struct {
+	Bundle string
+	Status string
+}
+
+// newBundleRunSummary returns summary of a bundle execution based on the changes recorded by the bundle
+// and the reports it produced. Bundle which reported an error is considered failed.
+func newBundleRunSummary(bundleName string, changed bool, reports []Report) bundleRunSummary {
+	summary := bundleRunSummary{
+		Bundle: bundleName,
+		Status: bundleRunStatusUnchanged,
+	}
+
+	if changed {
+		summary.Status = bundleRunStatusChanged
+	}
+
+	for _, report := range reports {
+		if report.Severity == severityError {
+			summary.Status = bundleRunStatusFailed
+			break
+		}
+	}
+
+	return summary
+}
+
+// runSummary contains outcomes of all bundles executed during an agent run.
+type runSummary []bundleRunSummary
+
+// failed returns true if any of the bundles failed.
+func (summary runSummary) failed() bool {
+	for _, bundleSummary := range summary {
+		if bundleSummary.Status == bundleRunStatusFailed {
+			return true
+		}
+	}
+
+	return false
+}
+
+// bundles returns names of executed bundles.
+func (summary runSummary) bundles() []string {
+	names := make([]string, 0, len(summary))
+	for _, bundleSummary := range summary {
+		names = append(names, bundleSummary.Bundle)
+	}
+
+	return names
+}
+
+// report adds an info report summarizing the run to the reporter set in context.
+func (summary runSummary) report(ctx context.Context) {
+	counts := make(map[string]int)
+	lines := make([]string, 0, len(summary))
+
+	for _, bundleSummary := range summary {
+		counts[bundleSummary.Status]++
+		lines = append(lines, fmt.Sprintf("%s: %s", bundleSummary.Bundle, bundleSummary.Status))
+	}
+
+	ReportInfo(ctx, strings.Join(lines, "\n"),
+		"Run summary: %d bundle(s) changed, %d without changes, %d failed.",
+		counts[bundleRunStatusChanged], counts[bundleRunStatusUnchanged], counts[bundleRunStatusFailed])
+}
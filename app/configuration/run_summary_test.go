@@ -0,0 +1,74 @@
+// Copyright 2023 qbee.io
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package configuration
+
+import (
+	"context"
+	"encoding/base64"
+	"testing"
+
+	"go.qbee.io/agent/app/utils/assert"
+)
+
+func Test_runSummary(t *testing.T) {
+	summary := runSummary{
+		newBundleRunSummary(BundleFileDistribution, false, []Report{{Severity: severityInfo}}),
+		newBundleRunSummary(BundleUsers, true, []Report{{Severity: severityInfo}}),
+		newBundleRunSummary(BundleSSHKeys, true, []Report{{Severity: severityInfo}, {Severity: severityError}}),
+	}
+
+	reporter := NewReporter("commit", false, nil)
+	summary.report(reporter.BundleContext(context.Background(), BundleSettings, "bundle-commit"))
+
+	reports := reporter.Reports()
+	assert.Length(t, reports, 1)
+	assert.Equal(t, reports[0].Severity, severityInfo)
+	assert.Equal(t, reports[0].Bundle, BundleSettings)
+	assert.Equal(t, reports[0].Text, "Run summary: 1 bundle(s) changed, 1 without changes, 1 failed.")
+
+	expectedLog := "file_distribution: no changes\nusers: changed\nsshkeys: failed"
+	assert.Equal(t, reports[0].Log, base64.StdEncoding.EncodeToString([]byte(expectedLog)))
+}
+
+func Test_runSummary_failed(t *testing.T) {
+	summary := runSummary{
+		newBundleRunSummary(BundleFileDistribution, false, nil),
+		newBundleRunSummary(BundleUsers, false, []Report{{Severity: severityWarning}}),
+	}
+	assert.False(t, summary.failed())
+
+	summary = append(summary, newBundleRunSummary(BundleSSHKeys, false, []Report{{Severity: severityError}}))
+	assert.True(t, summary.failed())
+}
+
+func Test_reportChange(t *testing.T) {
+	reporter := NewReporter("commit", false, nil)
+	ctx, changes := withChangeRecorder(reporter.BundleContext(context.Background(), BundleUsers, "bundle-commit"))
+
+	ReportInfo(ctx, nil, "Package index update skipped: %s.", "not needed")
+	ReportWarning(ctx, nil, "Reboot deferred by policy")
+	assert.False(t, changes.changed.Load())
+	assert.Equal(t, newBundleRunSummary(BundleUsers, changes.changed.Load(), reporter.Reports()).Status,
+		bundleRunStatusUnchanged)
+
+	reportChange(ctx, nil, "Successfully added user '%s'", "test")
+	assert.True(t, changes.changed.Load())
+	assert.Length(t, reporter.Reports(), 3)
+	assert.Equal(t, reporter.Reports()[2].Severity, severityInfo)
+	assert.Equal(t, newBundleRunSummary(BundleUsers, changes.changed.Load(), reporter.Reports()).Status,
+		bundleRunStatusChanged)
+}
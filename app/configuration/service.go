@@ -19,17 +19,23 @@ package configuration
 import (
 	"bytes"
 	"context"
+	"crypto/ecdsa"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
+	"net/http"
 	"os"
 	"path/filepath"
+	"strings"
 	"time"
 
 	"go.qbee.io/agent/app/api"
+	"go.qbee.io/agent/app/inventory"
 	"go.qbee.io/agent/app/log"
 	"go.qbee.io/agent/app/metrics"
+	"go.qbee.io/agent/app/software"
+	"go.qbee.io/agent/app/utils"
 )
 
 const defaultAgentInterval = 5 // minutes
@@ -39,6 +45,9 @@ const defaultFirstRunRetryCounter = 5
 type Service struct {
 	api *api.Client
 
+	// httpClient is used to download files from HTTP(S) URLs
+	httpClient *http.Client
+
 	// appDirectory is a directory where the agent stores its data
 	appDirectory string
 
@@ -57,40 +66,122 @@ type Service struct {
 	// urlSigner is used to sign URLs for the device hub
 	urlSigner URLSigner
 
+	// configSigningKey is used to verify configuration signatures (verification is disabled when nil)
+	configSigningKey *ecdsa.PublicKey
+
 	rebootAfterRun           bool
 	reportToConsole          bool
+	consoleReportFormat      ReportFormat
+	bundleFilter             BundleFilter
+	settingsOverridesPath    string
 	reportingEnabled         bool
 	metricsEnabled           bool
 	softwareInventoryEnabled bool
+	indexUpdatePolicy        software.IndexUpdatePolicy
 	processInventoryEnabled  bool
+	processInventoryFilter   inventory.ProcessFilter
+	portsInventoryEnabled    bool
+	containerStatsEnabled    bool
+	inventoryBatchEnabled    bool
+	inventoryBatchSize       int
+	runSummaryEnabled        bool
+
+	// metricsExporterAddress defines where Prometheus metrics exporter listens (empty -> disabled)
+	metricsExporterAddress string
+
+	// retryBudgetLimit defines how many device hub operations may fail during a single run (0 -> unlimited)
+	retryBudgetLimit int
+	retryBudget      retryBudget
+
+	// remoteJobsEnabled defines whether one-shot jobs are fetched from the device hub and executed
+	remoteJobsEnabled bool
+
+	// postRebootCommand is executed on agent start after a reboot scheduled by the agent
+	postRebootCommand string
+
+	// provisioningCommand is executed only once on the device
+	provisioningCommand string
+
+	// allowReboot defines whether the agent may reboot the system (otherwise reboots are deferred)
+	allowReboot bool
+
+	// maintenanceWindow limits when disruptive actions and reboots are executed (nil -> no limit)
+	maintenanceWindow *MaintenanceWindow
+
+	// deferralsReported contains disruptive actions which deferral outside the maintenance window is already reported
+	deferralsReported map[string]bool
+
+	// deviceID is a stable device identifier used to select devices for bundle rollouts
+	deviceID string
 
 	runInterval               int
 	runIntervalChangeNotifier chan time.Duration
 
+	// reportsBatchCount and reportsBatchSize (in bytes) limit a single reports delivery request
+	reportsBatchCount int
+	reportsBatchSize  int
+
+	// reportsCompression enables gzip compression of reports delivery requests
+	reportsCompression bool
+
+	// downloadLimiter limits bandwidth and concurrency of file downloads (nil -> unlimited)
+	downloadLimiter *downloadLimiter
+
 	// connectivityWatchdogThreshold defines failed API connections threshold at which server will be rebooted
 	// 0 -> disabled
 	connectivityWatchdogThreshold int
 	failedConnectionsCount        int
 
+	// connectivityWatchdogAction defines what to do when the threshold is reached
+	connectivityWatchdogAction WatchdogAction
+
+	// connectivityWatchdogNetworkService is restarted by the restart-network watchdog action
+	connectivityWatchdogNetworkService string
+
+	// restartAgentAfterRun is set when the agent should be restarted after the run
+	restartAgentAfterRun bool
+
 	// metrics service
 	metrics *metrics.Service
 
 	// firstRun is true if the agent is running for the first time after startup
 	firstRunRetryCounter int
+
+	// runStats contains bundle execution statistics
+	runStats runStats
+
+	// status contains the status of the last run (exposed on the local status socket)
+	status statusTracker
+
+	// auditLog records changes applied to the system (disabled when nil)
+	auditLog *auditLog
+
+	// lastRunFailed is true if any bundle failed or reported an error during the last configuration run
+	lastRunFailed bool
 }
 
 // New returns a new instance of configuration Service.
 func New(apiClient *api.Client, appDirectory, cacheDirectory string) *Service {
+	httpClient := api.NewHTTPClient()
+	if apiClient != nil {
+		httpClient = apiClient.NewDownloadClient()
+	}
+
 	return &Service{
 		api:            apiClient,
+		httpClient:     httpClient,
 		appDirectory:   appDirectory,
 		cacheDirectory: cacheDirectory,
 		runInterval:    defaultAgentInterval,
+		allowReboot:    true,
 
 		// this will notify the main agent loop about changes to the agent run interval
 		// we don't expect more than a single consumer of this, that's why a buffered channel is used
 		runIntervalChangeNotifier: make(chan time.Duration, 1),
 		firstRunRetryCounter:      defaultFirstRunRetryCounter,
+		reportsBatchCount:         defaultReportsBatchCount,
+		reportsBatchSize:          defaultReportsBatchSize,
+		reportsCompression:        true,
 	}
 }
 
@@ -100,6 +191,62 @@ func (srv *Service) WithURLSigner(urlSigner URLSigner) *Service {
 	return srv
 }
 
+// WithConfigSigningKey sets the public key used to verify configuration signatures.
+// When set, unsigned or invalid configurations are neither applied nor cached.
+func (srv *Service) WithConfigSigningKey(publicKey *ecdsa.PublicKey) *Service {
+	srv.configSigningKey = publicKey
+	return srv
+}
+
+// WithReportsDelivery sets limits for a single reports delivery request and whether its body is compressed.
+// Non-positive batchCount or batchSize keep the default limits.
+func (srv *Service) WithReportsDelivery(batchCount, batchSize int, compression bool) *Service {
+	if batchCount > 0 {
+		srv.reportsBatchCount = batchCount
+	}
+
+	if batchSize > 0 {
+		srv.reportsBatchSize = batchSize
+	}
+
+	srv.reportsCompression = compression
+	return srv
+}
+
+// WithDownloadLimits limits bandwidth (in bytes per second) shared by all file downloads
+// and number of concurrent downloads. Non-positive values don't limit downloads.
+func (srv *Service) WithDownloadLimits(rateLimit int64, maxConcurrent int) *Service {
+	srv.downloadLimiter = newDownloadLimiter(rateLimit, maxConcurrent)
+	return srv
+}
+
+// WithAuditLog enables local audit log of changes applied by the agent, stored in the app directory.
+// Audit log is rotated when it reaches maxSize bytes and maxFiles rotated files are kept.
+// Non-positive maxSize or maxFiles use the defaults.
+func (srv *Service) WithAuditLog(maxSize int64, maxFiles int) *Service {
+	srv.auditLog = newAuditLog(srv.appDirectory, maxSize, maxFiles)
+	return srv
+}
+
+// WithBundleFilter sets filter selecting bundles executed during configuration runs.
+// The filter doesn't change the configuration itself, so it's not persisted.
+func (srv *Service) WithBundleFilter(filter BundleFilter) *Service {
+	srv.bundleFilter = filter
+	return srv
+}
+
+// WithSettingsOverrides sets path of the local settings overrides file (see applySettingsOverrides).
+func (srv *Service) WithSettingsOverrides(path string) *Service {
+	srv.settingsOverridesPath = path
+	return srv
+}
+
+// WithDeviceID sets device identifier used to select devices for gradual bundle rollouts.
+func (srv *Service) WithDeviceID(deviceID string) *Service {
+	srv.deviceID = deviceID
+	return srv
+}
+
 // WithUserCacheDirectory sets the user cache directory for the service.
 func (srv *Service) WithUserCacheDirectory(userCacheDirectory string) *Service {
 	srv.userCacheDirectory = userCacheDirectory
@@ -117,16 +264,56 @@ func (srv *Service) MetricsEnabled() bool {
 	return srv.metricsEnabled
 }
 
+// MetricsExporterAddress returns bind address of the Prometheus metrics exporter (empty if disabled).
+func (srv *Service) MetricsExporterAddress() string {
+	return srv.metricsExporterAddress
+}
+
 // CollectSoftwareInventory returns true if software inventory collection is enabled.
 func (srv *Service) CollectSoftwareInventory() bool {
 	return srv.softwareInventoryEnabled
 }
 
+// IndexUpdatePolicy returns policy used by package managers to decide whether to update package indexes.
+func (srv *Service) IndexUpdatePolicy() software.IndexUpdatePolicy {
+	return srv.indexUpdatePolicy
+}
+
 // CollectProcessInventory returns true if process inventory collection is enabled.
 func (srv *Service) CollectProcessInventory() bool {
 	return srv.processInventoryEnabled
 }
 
+// ProcessInventoryFilter returns filter applied to the process inventory.
+func (srv *Service) ProcessInventoryFilter() inventory.ProcessFilter {
+	return srv.processInventoryFilter
+}
+
+// CollectPortsInventory returns true if ports inventory collection is enabled.
+func (srv *Service) CollectPortsInventory() bool {
+	return srv.portsInventoryEnabled
+}
+
+// CollectContainerStatsInventory returns true if container resource usage inventory collection is enabled.
+func (srv *Service) CollectContainerStatsInventory() bool {
+	return srv.containerStatsEnabled
+}
+
+// BatchInventories returns true if inventories should be delivered in batched requests.
+func (srv *Service) BatchInventories() bool {
+	return srv.inventoryBatchEnabled
+}
+
+// InventoryBatchSize returns maximum number of inventories delivered in a single batched request (0 -> unlimited).
+func (srv *Service) InventoryBatchSize() int {
+	return srv.inventoryBatchSize
+}
+
+// AgentRunInventory returns timing statistics of the last configuration run (nil if no run finished yet).
+func (srv *Service) AgentRunInventory() *inventory.AgentRun {
+	return srv.runStats.lastRun
+}
+
 // RunInterval returns agent's run interval.
 func (srv *Service) RunInterval() time.Duration {
 	return time.Duration(srv.runInterval) * time.Minute
@@ -147,13 +334,37 @@ func (srv *Service) EnableConsoleReporting() {
 	srv.reportToConsole = true
 }
 
+// SetConsoleReportFormat sets the format of reports printed to console.
+func (srv *Service) SetConsoleReportFormat(format ReportFormat) {
+	srv.consoleReportFormat = format
+}
+
+// LastRunFailed returns true if any bundle failed or reported an error during the last configuration run.
+func (srv *Service) LastRunFailed() bool {
+	return srv.lastRunFailed
+}
+
 // applyDefaultSettings to the agent.
 func (srv *Service) applyDefaultSettings() {
 	srv.reportToConsole = true
 	srv.reportingEnabled = true
 	srv.metricsEnabled = true
+	srv.metricsExporterAddress = ""
 	srv.softwareInventoryEnabled = true
+	srv.indexUpdatePolicy = software.IndexUpdatePolicy{}
 	srv.processInventoryEnabled = false
+	srv.processInventoryFilter = inventory.ProcessFilter{}
+	srv.portsInventoryEnabled = true
+	srv.containerStatsEnabled = false
+	srv.inventoryBatchEnabled = false
+	srv.inventoryBatchSize = 0
+	srv.runSummaryEnabled = false
+	srv.retryBudgetLimit = 0
+	srv.remoteJobsEnabled = false
+	srv.postRebootCommand = ""
+	srv.provisioningCommand = ""
+	srv.allowReboot = true
+	srv.maintenanceWindow = nil
 	srv.runInterval = defaultAgentInterval
 }
 
@@ -192,6 +403,11 @@ func (srv *Service) Execute(ctx context.Context, configData *CommittedConfig) er
 	defer cancel()
 
 	if err := srv.acquireLock(executeTimeout); err != nil {
+		if errors.Is(err, errReadOnlyFilesystem) {
+			log.Errorf("failed to acquire execution lock - %v", err)
+			return err
+		}
+
 		log.Infof("failed to acquire execution lock - %v", err)
 		return nil
 	}
@@ -207,9 +423,39 @@ func (srv *Service) Execute(ctx context.Context, configData *CommittedConfig) er
 		srv.connectivityWatchdogThreshold = 0
 	}
 
-	reporter := NewReporter(configData.CommitID, srv.reportToConsole, parametersBundle.SecretsList())
+	reporter := NewReporter(configData.CommitID, srv.reportToConsole, parametersBundle.SecretsList()).
+		WithConsoleFormat(srv.consoleReportFormat)
+	ctxWithTimeout = utils.WithRedactor(ctxWithTimeout, reporter.Redact)
+	ctxWithTimeout = software.WithIndexUpdatePolicy(ctxWithTimeout, srv.indexUpdatePolicy)
+	summary := make(runSummary, 0, len(configData.Bundles))
+
+	runStart := time.Now()
+	srv.runStats.start(configData.CommitID, runStart)
+	srv.retryBudget.reset(srv.retryBudgetLimit)
+
+	settingsCtx := reporter.BundleContext(ctxWithTimeout, BundleSettings, configData.BundleData.Settings.BundleCommitID())
+	if err := srv.runProvisioningCommand(settingsCtx); err != nil {
+		log.Errorf("failed to run provisioning command: %v", err)
+	}
+
+	if err := srv.runDeferredReboot(settingsCtx); err != nil {
+		log.Errorf("failed to run deferred reboot: %v", err)
+	}
+
+	if _, err := srv.inMaintenanceWindow(runStart); err != nil {
+		ReportError(settingsCtx, err, "Invalid maintenance window, disruptive actions and reboots will be deferred.")
+	}
+
+	srv.resetDeferrals(runStart)
 
-	for _, bundleName := range configData.Bundles {
+	bundles, err := configData.executionOrder()
+	if err != nil {
+		ReportWarning(settingsCtx, err, "Invalid bundle dependencies, bundles are executed in the configured order.")
+	}
+
+	log.Debugf("bundles execution order: %s", strings.Join(bundles, ", "))
+
+	for _, bundleName := range bundles {
 		log.Debugf("starting processing of bundle %s", bundleName)
 
 		// Check if context deadline was reached and stop bundles execution if so.
@@ -228,6 +474,11 @@ func (srv *Service) Execute(ctx context.Context, configData *CommittedConfig) er
 			continue
 		}
 
+		if !srv.bundleFilter.allows(bundleName) {
+			log.Warnf("bundle %s skipped by command line filter", bundleName)
+			continue
+		}
+
 		bundle := configData.selectBundleByName(bundleName)
 		if bundle == nil {
 			log.Errorf("configuration missing for bundle %s - skipping", bundleName)
@@ -241,12 +492,50 @@ func (srv *Service) Execute(ctx context.Context, configData *CommittedConfig) er
 
 		bundleCtx := reporter.BundleContext(ctxWithTimeout, bundleName, bundle.BundleCommitID())
 
-		log.Debugf("executing bundle %s", bundleName)
-		if err := bundle.Execute(bundleCtx, srv); err != nil {
-			log.Errorf("bundle %s execution failed: %v", bundleName, err)
+		if rollout := bundle.RolloutPercentage(); !inRollout(srv.deviceID, rollout) {
+			ReportInfo(bundleCtx, nil, "Bundle deferred by rollout (enabled for %d%% of devices).", rollout)
+			continue
 		}
 
-		log.Debugf("bundle %s execution finished", bundleName)
+		// Stop bundles execution early if too many device hub operations already failed during this run.
+		if srv.retryBudget.check() != nil {
+			ReportWarning(bundleCtx, nil,
+				"Run stopped early: %d device hub operations failed, exceeding the retry budget of %d.",
+				srv.retryBudget.failedOperations(), srv.retryBudgetLimit)
+			break
+		}
+
+		bundleLog := log.With(log.Fields{Bundle: bundleName, CommitID: bundle.BundleCommitID()})
+
+		bundleLog.Debugf("executing bundle %s", bundleName)
+		reportsCount := len(reporter.Reports())
+		bundleStart := time.Now()
+		bundleCtx, changes := withChangeRecorder(bundleCtx)
+		err := bundle.Execute(bundleCtx, srv)
+		srv.runStats.addBundle(bundleName, time.Since(bundleStart), err == nil)
+		if err != nil {
+			bundleLog.Errorf("bundle %s execution failed: %v", bundleName, err)
+		}
+
+		bundleSummary := newBundleRunSummary(bundleName, changes.changed.Load(), reporter.Reports()[reportsCount:])
+		if err != nil {
+			bundleSummary.Status = bundleRunStatusFailed
+		}
+
+		summary = append(summary, bundleSummary)
+
+		bundleLog.Debugf("bundle %s execution finished", bundleName)
+	}
+
+	srv.runStats.finish(time.Since(runStart))
+	srv.lastRunFailed = summary.failed()
+
+	// audit log is independent of reports delivery, so it's recorded even if reporting is disabled
+	if srv.auditLog != nil {
+		executedBundles := append(summary.bundles(), BundleSettings)
+		if err := srv.auditLog.recordRun(configData.CommitID, executedBundles, reporter.Reports()); err != nil {
+			log.Errorf("failed to record audit log: %v", err)
+		}
 	}
 
 	// assign config's commitID as current
@@ -256,16 +545,23 @@ func (srv *Service) Execute(ctx context.Context, configData *CommittedConfig) er
 		srv.configChangeTime = time.Now()
 	}
 
+	srv.recordStatus(summary)
+
 	if !srv.reportingEnabled {
 		log.Debugf("reporting is disabled - skipping sending reports")
 		return nil
 	}
 
+	if srv.runSummaryEnabled {
+		settingsCtx := reporter.BundleContext(ctx, BundleSettings, configData.BundleData.Settings.BundleCommitID())
+		summary.report(settingsCtx)
+	}
+
 	log.Debugf("sending reports to the server")
-	if _, err := srv.sendReports(ctx, reporter.Reports()); err != nil {
+	if delivered, err := srv.sendReports(ctx, reporter.Reports()); err != nil {
 		log.Debugf("failed to send reports to the server: %v, adding to the buffer", err)
 
-		if bufferErr := srv.addReportsToBuffer(reporter.Reports()); bufferErr != nil {
+		if bufferErr := srv.addReportsToBuffer(reporter.Reports()[delivered:]); bufferErr != nil {
 			log.Errorf("failed to add reports to buffer: %v", bufferErr)
 		}
 
@@ -282,11 +578,18 @@ func (srv *Service) Execute(ctx context.Context, configData *CommittedConfig) er
 }
 
 // RebootAfterRun schedules system reboot after current agent run.
+// When reboots are disallowed by the settings bundle (or outside the maintenance window),
+// the reboot is deferred until they are allowed again.
 func (srv *Service) RebootAfterRun(ctx context.Context) {
 	if srv.rebootAfterRun {
 		return
 	}
 
+	if !srv.rebootAllowed() {
+		srv.deferReboot(ctx)
+		return
+	}
+
 	ReportWarning(ctx, nil, "Scheduling system reboot.")
 	srv.rebootAfterRun = true
 }
@@ -296,6 +599,21 @@ func (srv *Service) ShouldReboot() bool {
 	return srv.rebootAfterRun
 }
 
+// RestartAgentAfterRun sets a flag to restart the agent after the run.
+func (srv *Service) RestartAgentAfterRun(ctx context.Context) {
+	if srv.restartAgentAfterRun {
+		return
+	}
+
+	ReportWarning(ctx, nil, "Scheduling agent restart.")
+	srv.restartAgentAfterRun = true
+}
+
+// ShouldRestartAgent returns true if the agent should be restarted after agent run.
+func (srv *Service) ShouldRestartAgent() bool {
+	return srv.restartAgentAfterRun
+}
+
 // reportAPIError tracks failed API connection attempts, so we can trigger reboot when connectivity watchdog is enabled.
 func (srv *Service) reportAPIError(ctx context.Context, err error) {
 	if srv.connectivityWatchdogThreshold == 0 {
@@ -311,10 +629,16 @@ func (srv *Service) reportAPIError(ctx context.Context, err error) {
 
 	if srv.failedConnectionsCount >= srv.connectivityWatchdogThreshold {
 		// since we don't have a reporter defined on this context, we need to create a new one
-		reporter := NewReporter(srv.currentCommitID, srv.reportToConsole, nil)
+		reporter := NewReporter(srv.currentCommitID, srv.reportToConsole, nil).WithConsoleFormat(srv.consoleReportFormat)
 		bundleCtx := reporter.BundleContext(ctx, BundleConnectivityWatchdog, "")
 
-		srv.RebootAfterRun(bundleCtx)
+		srv.triggerConnectivityWatchdog(bundleCtx)
+
+		if srv.auditLog != nil {
+			if err := srv.auditLog.record(reporter.Reports()); err != nil {
+				log.Errorf("failed to record audit log: %v", err)
+			}
+		}
 
 		// Since we are reporting API issue, there is probably no point sending the reports,
 		// so we just add them straight to the buffer on the filesystem.
@@ -487,11 +811,16 @@ func (srv *Service) Get(ctx context.Context) (*CommittedConfig, error) {
 
 		log.Warnf("failed to get config from API: %v", err)
 
+		srv.applySettingsOverrides(cfg)
+
 		return cfg, nil
 	}
 
 	srv.persistConfig(cfg)
 
+	// overrides are applied after persisting, so the cached config keeps the server-provided payload
+	srv.applySettingsOverrides(cfg)
+
 	return cfg, nil
 }
 
@@ -511,7 +840,13 @@ func (srv *Service) persistConfig(cfg *CommittedConfig) {
 	}
 	defer fp.Close()
 
-	if err = json.NewEncoder(fp).Encode(cfg); err != nil {
+	// persist original payload when available, so its signature can be verified when loaded from cache
+	if cfg.payload != nil {
+		_, err = fp.Write(cfg.payload)
+	} else {
+		err = json.NewEncoder(fp).Encode(cfg)
+	}
+	if err != nil {
 		log.Errorf("failed to marshal config: %v", err)
 		return
 	}
@@ -527,13 +862,18 @@ func (srv *Service) persistConfig(cfg *CommittedConfig) {
 func (srv *Service) loadConfig(cfg *CommittedConfig) error {
 	filename := filepath.Join(srv.appDirectory, configCacheFileName)
 
-	fp, err := os.Open(filename)
+	payload, err := os.ReadFile(filename)
 	if err != nil {
 		return fmt.Errorf("failed to open config cache file: %v", err)
 	}
-	defer fp.Close()
 
-	if err = json.NewDecoder(fp).Decode(cfg); err != nil {
+	if srv.configSigningKey != nil {
+		if err = verifyConfigSignature(payload, srv.configSigningKey); err != nil {
+			return fmt.Errorf("cached config signature verification failed: %w", err)
+		}
+	}
+
+	if err = json.Unmarshal(payload, cfg); err != nil {
 		return fmt.Errorf("failed to unmarshal config: %v", err)
 	}
 
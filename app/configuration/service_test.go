@@ -18,8 +18,10 @@ package configuration
 
 import (
 	"context"
+	"encoding/json"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 	"time"
 
@@ -137,6 +139,50 @@ func TestInvalidBytesReportsBuffer(t *testing.T) {
 	})
 }
 
+func TestService_encodeReportsBatch(t *testing.T) {
+	reports := make([]Report, 5)
+	for i := range reports {
+		reports[i] = Report{Bundle: "bundle", Severity: severityInfo, Text: strings.Repeat("x", 100)}
+	}
+
+	reportSize := len(mustJSON(t, reports[0])) + 1
+
+	t.Run("limited by count", func(t *testing.T) {
+		srv := New(nil, "", "").WithReportsDelivery(2, 0, true)
+
+		buf, count, err := srv.encodeReportsBatch(reports)
+		assert.NoError(t, err)
+		assert.Equal(t, count, 2)
+		assert.Equal(t, buf.Len(), 2*reportSize)
+	})
+
+	t.Run("limited by size", func(t *testing.T) {
+		srv := New(nil, "", "").WithReportsDelivery(0, 3*reportSize+1, true)
+
+		buf, count, err := srv.encodeReportsBatch(reports)
+		assert.NoError(t, err)
+		assert.Equal(t, count, 3)
+		assert.Equal(t, buf.Len(), 3*reportSize)
+	})
+
+	t.Run("single report exceeding size limit", func(t *testing.T) {
+		srv := New(nil, "", "").WithReportsDelivery(0, 10, true)
+
+		_, count, err := srv.encodeReportsBatch(reports)
+		assert.NoError(t, err)
+		assert.Equal(t, count, 1)
+	})
+}
+
+func mustJSON(t *testing.T, value any) []byte {
+	data, err := json.Marshal(value)
+	if err != nil {
+		t.Fatalf("failed to encode JSON: %v", err)
+	}
+
+	return data
+}
+
 func TestService_persistConfig(t *testing.T) {
 	apiClient := api.NewClient("invalid-host.example", "12345")
 	srv := New(apiClient, t.TempDir(), "")
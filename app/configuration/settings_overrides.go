@@ -0,0 +1,114 @@
+// Copyright 2023 qbee.io
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package configuration
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"go.qbee.io/agent/app/log"
+)
+
+// settingsOverridesForbiddenKeys are settings bundle metadata keys, which cannot be overridden locally.
+var settingsOverridesForbiddenKeys = []string{"enabled", "bundle_commit_id", "rollout_percentage", "depends_on"}
+
+// defaultSettings returns settings bundle equivalent to the default agent settings (see applyDefaultSettings).
+func defaultSettings() SettingsBundle {
+	return SettingsBundle{
+		Metadata:                Metadata{Enabled: true},
+		EnableMetrics:           true,
+		EnableReports:           true,
+		EnableSoftwareInventory: true,
+		RunInterval:             defaultAgentInterval,
+	}
+}
+
+// applySettingsOverrides merges local settings overrides over the settings bundle of the provided config.
+//
+// The overrides file is a JSON object with a subset of settings bundle fields, e.g.:
+//
+//	{
+//	  "metrics": false,
+//	  "agentinterval": 1
+//	}
+//
+// Fields set in the overrides file always win over the server-provided settings, other fields are preserved.
+// When the config doesn't have an enabled settings bundle, overrides are merged over the default settings.
+// Only settings bundle fields can be overridden, so an invalid overrides file is ignored as a whole.
+// A missing overrides file is a no-op.
+func (srv *Service) applySettingsOverrides(cfg *CommittedConfig) {
+	if srv.settingsOverridesPath == "" {
+		return
+	}
+
+	overrides, err := os.ReadFile(srv.settingsOverridesPath)
+	if err != nil {
+		if !errors.Is(err, os.ErrNotExist) {
+			log.Errorf("failed to read settings overrides: %v", err)
+		}
+		return
+	}
+
+	if err = mergeSettingsOverrides(cfg, overrides); err != nil {
+		log.Errorf("ignoring settings overrides from %s: %v", srv.settingsOverridesPath, err)
+		return
+	}
+
+	log.Debugf("applied settings overrides from %s", srv.settingsOverridesPath)
+}
+
+// mergeSettingsOverrides merges JSON-encoded settings overrides over the settings bundle of the provided config.
+func mergeSettingsOverrides(cfg *CommittedConfig, overrides []byte) error {
+	var overriddenKeys map[string]json.RawMessage
+	if err := json.Unmarshal(overrides, &overriddenKeys); err != nil {
+		return fmt.Errorf("invalid overrides: %w", err)
+	}
+
+	// keys are compared case-insensitively, since JSON decoding matches fields that way
+	for overriddenKey := range overriddenKeys {
+		for _, key := range settingsOverridesForbiddenKeys {
+			if strings.EqualFold(overriddenKey, key) {
+				return fmt.Errorf("setting %s cannot be overridden", key)
+			}
+		}
+	}
+
+	settings := cfg.BundleData.Settings
+	if !cfg.HasBundle(BundleSettings) || !settings.Enabled {
+		settings = defaultSettings()
+	}
+
+	// decoding into the existing settings only changes fields present in the overrides
+	decoder := json.NewDecoder(bytes.NewReader(overrides))
+	decoder.DisallowUnknownFields()
+
+	if err := decoder.Decode(&settings); err != nil {
+		return fmt.Errorf("invalid overrides: %w", err)
+	}
+
+	if !cfg.HasBundle(BundleSettings) {
+		cfg.Bundles = append(cfg.Bundles, BundleSettings)
+	}
+
+	cfg.BundleData.Settings = settings
+
+	return nil
+}
@@ -0,0 +1,157 @@
+// Copyright 2023 qbee.io
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package configuration
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"go.qbee.io/agent/app/api"
+	"go.qbee.io/agent/app/utils/assert"
+)
+
+func Test_mergeSettingsOverrides(t *testing.T) {
+	tests := []struct {
+		name      string
+		cfg       *CommittedConfig
+		overrides string
+		want      *CommittedConfig
+		wantErr   bool
+	}{
+		{
+			name: "local overrides win over server settings",
+			cfg: &CommittedConfig{
+				Bundles: []string{BundleSettings},
+				BundleData: BundleData{Settings: SettingsBundle{
+					Metadata:      Metadata{Enabled: true, CommitID: "abc"},
+					EnableMetrics: true,
+					EnableReports: true,
+					RunInterval:   10,
+				}},
+			},
+			overrides: `{"metrics": false, "agentinterval": 1}`,
+			want: &CommittedConfig{
+				Bundles: []string{BundleSettings},
+				BundleData: BundleData{Settings: SettingsBundle{
+					Metadata:      Metadata{Enabled: true, CommitID: "abc"},
+					EnableMetrics: false,
+					EnableReports: true,
+					RunInterval:   1,
+				}},
+			},
+		},
+		{
+			name:      "overrides are merged over default settings",
+			cfg:       &CommittedConfig{},
+			overrides: `{"agentinterval": 1}`,
+			want: &CommittedConfig{
+				Bundles: []string{BundleSettings},
+				BundleData: BundleData{Settings: SettingsBundle{
+					Metadata:                Metadata{Enabled: true},
+					EnableMetrics:           true,
+					EnableReports:           true,
+					EnableSoftwareInventory: true,
+					RunInterval:             1,
+				}},
+			},
+		},
+		{
+			name:      "unknown fields are rejected",
+			cfg:       &CommittedConfig{},
+			overrides: `{"users": []}`,
+			wantErr:   true,
+		},
+		{
+			name:      "metadata cannot be overridden",
+			cfg:       &CommittedConfig{},
+			overrides: `{"enabled": false}`,
+			wantErr:   true,
+		},
+		{
+			name:      "metadata keys are matched case-insensitively",
+			cfg:       &CommittedConfig{},
+			overrides: `{"Enabled": false}`,
+			wantErr:   true,
+		},
+		{
+			name:      "bundle dependencies cannot be overridden",
+			cfg:       &CommittedConfig{},
+			overrides: `{"depends_on": ["users"]}`,
+			wantErr:   true,
+		},
+		{
+			name:      "invalid JSON",
+			cfg:       &CommittedConfig{},
+			overrides: `{"metrics":`,
+			wantErr:   true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := mergeSettingsOverrides(tt.cfg, []byte(tt.overrides))
+			if tt.wantErr {
+				assert.NotEqual(t, err, nil)
+				return
+			}
+
+			assert.NoError(t, err)
+			assert.Equal(t, tt.cfg, tt.want)
+		})
+	}
+}
+
+func TestService_applySettingsOverrides(t *testing.T) {
+	overridesPath := filepath.Join(t.TempDir(), "settings-overrides.json")
+
+	apiClient := api.NewClient("invalid-host.example", "12345")
+	srv := New(apiClient, t.TempDir(), "").WithSettingsOverrides(overridesPath)
+
+	cfg := &CommittedConfig{
+		CommitID: "abc",
+		Bundles:  []string{BundleSettings},
+		BundleData: BundleData{
+			Settings: SettingsBundle{
+				Metadata:    Metadata{Enabled: true},
+				RunInterval: 10,
+			},
+		},
+	}
+
+	srv.persistConfig(cfg)
+
+	t.Run("missing overrides file is a no-op", func(t *testing.T) {
+		committedConfig, err := srv.Get(context.Background())
+		assert.NoError(t, err)
+		assert.Equal(t, committedConfig, cfg)
+	})
+
+	t.Run("overrides are applied to config returned by Get", func(t *testing.T) {
+		assert.NoError(t, os.WriteFile(overridesPath, []byte(`{"agentinterval": 1}`), 0600))
+
+		committedConfig, err := srv.Get(context.Background())
+		assert.NoError(t, err)
+		assert.Equal(t, committedConfig.BundleData.Settings.RunInterval, 1)
+
+		// cached config is not affected by overrides
+		loadedCfg := new(CommittedConfig)
+		assert.NoError(t, srv.loadConfig(loadedCfg))
+		assert.Equal(t, loadedCfg.BundleData.Settings.RunInterval, 10)
+	})
+}
@@ -0,0 +1,104 @@
+// Copyright 2023 qbee.io
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package configuration
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+)
+
+// configSignatureField is the name of the configuration payload field carrying the signature.
+const configSignatureField = "signature"
+
+// ParseConfigSigningKey parses PEM-encoded P-256 public key used to verify configuration signatures.
+func ParseConfigSigningKey(pemBytes []byte) (*ecdsa.PublicKey, error) {
+	pemBlock, _ := pem.Decode(pemBytes)
+	if pemBlock == nil {
+		return nil, fmt.Errorf("error decoding config signing key's PEM block")
+	}
+
+	key, err := x509.ParsePKIXPublicKey(pemBlock.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing config signing key: %w", err)
+	}
+
+	publicKey, ok := key.(*ecdsa.PublicKey)
+	if !ok || publicKey.Curve != elliptic.P256() {
+		return nil, fmt.Errorf("config signing key must be a P-256 public key")
+	}
+
+	return publicKey, nil
+}
+
+// verifyConfigSignature verifies that configuration payload carries a valid signature made with the publicKey.
+// Signature is an ASN.1 ECDSA signature (base64-encoded) of the SHA-256 digest of the canonical payload.
+func verifyConfigSignature(payload []byte, publicKey *ecdsa.PublicKey) error {
+	canonicalPayload, signature, err := canonicalConfigPayload(payload)
+	if err != nil {
+		return err
+	}
+
+	digest := sha256.Sum256(canonicalPayload)
+
+	if !ecdsa.VerifyASN1(publicKey, digest[:], signature) {
+		return fmt.Errorf("invalid config signature")
+	}
+
+	return nil
+}
+
+// canonicalConfigPayload returns canonical form of the configuration payload and its decoded signature.
+// Canonical form is the payload without the signature field, encoded as compact JSON with sorted keys
+// and without HTML escaping.
+func canonicalConfigPayload(payload []byte) ([]byte, []byte, error) {
+	decoder := json.NewDecoder(bytes.NewReader(payload))
+	decoder.UseNumber()
+
+	data := make(map[string]any)
+	if err := decoder.Decode(&data); err != nil {
+		return nil, nil, fmt.Errorf("error decoding config payload: %w", err)
+	}
+
+	encodedSignature, _ := data[configSignatureField].(string)
+	if encodedSignature == "" {
+		return nil, nil, fmt.Errorf("config is not signed")
+	}
+
+	delete(data, configSignatureField)
+
+	signature, err := base64.StdEncoding.DecodeString(encodedSignature)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error decoding config signature: %w", err)
+	}
+
+	buf := new(bytes.Buffer)
+	encoder := json.NewEncoder(buf)
+	encoder.SetEscapeHTML(false)
+
+	if err = encoder.Encode(data); err != nil {
+		return nil, nil, fmt.Errorf("error encoding canonical config payload: %w", err)
+	}
+
+	return bytes.TrimSuffix(buf.Bytes(), []byte("\n")), signature, nil
+}
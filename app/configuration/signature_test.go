@@ -0,0 +1,168 @@
+// Copyright 2023 qbee.io
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package configuration
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"go.qbee.io/agent/app/utils/assert"
+)
+
+// signTestConfig returns config payload signed with the provided private key.
+func signTestConfig(t *testing.T, privateKey *ecdsa.PrivateKey, payload string) []byte {
+	decoder := json.NewDecoder(strings.NewReader(payload))
+	decoder.UseNumber()
+
+	canonicalData := make(map[string]any)
+	if err := decoder.Decode(&canonicalData); err != nil {
+		t.Fatalf("error decoding payload: %v", err)
+	}
+
+	canonicalPayload := new(bytes.Buffer)
+	encoder := json.NewEncoder(canonicalPayload)
+	encoder.SetEscapeHTML(false)
+
+	if err := encoder.Encode(canonicalData); err != nil {
+		t.Fatalf("error encoding payload: %v", err)
+	}
+
+	digest := sha256.Sum256(bytes.TrimSuffix(canonicalPayload.Bytes(), []byte("\n")))
+
+	signature, err := ecdsa.SignASN1(rand.Reader, privateKey, digest[:])
+	if err != nil {
+		t.Fatalf("error signing payload: %v", err)
+	}
+
+	data := make(map[string]any)
+	if err = json.Unmarshal([]byte(payload), &data); err != nil {
+		t.Fatalf("error decoding payload: %v", err)
+	}
+
+	data[configSignatureField] = base64.StdEncoding.EncodeToString(signature)
+
+	signedPayload, err := json.MarshalIndent(data, "", "  ")
+	if err != nil {
+		t.Fatalf("error encoding signed payload: %v", err)
+	}
+
+	return signedPayload
+}
+
+func Test_verifyConfigSignature(t *testing.T) {
+	privateKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("error generating key: %v", err)
+	}
+
+	otherKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("error generating key: %v", err)
+	}
+
+	// canonical form: sorted keys, no whitespace
+	payload := `{"bundle_data":{"settings":{"agentinterval":10,"enabled":true}},"bundles":["settings"],"commit_id":"abc"}`
+	signedPayload := signTestConfig(t, privateKey, payload)
+
+	t.Run("valid signature", func(t *testing.T) {
+		assert.NoError(t, verifyConfigSignature(signedPayload, &privateKey.PublicKey))
+	})
+
+	t.Run("signed by other key", func(t *testing.T) {
+		err := verifyConfigSignature(signedPayload, &otherKey.PublicKey)
+		assert.Equal(t, err.Error(), "invalid config signature")
+	})
+
+	t.Run("tampered payload", func(t *testing.T) {
+		data := make(map[string]any)
+		if err := json.Unmarshal(signedPayload, &data); err != nil {
+			t.Fatalf("error decoding payload: %v", err)
+		}
+
+		data["commit_id"] = "def"
+		tamperedPayload, _ := json.Marshal(data)
+
+		err := verifyConfigSignature(tamperedPayload, &privateKey.PublicKey)
+		assert.Equal(t, err.Error(), "invalid config signature")
+	})
+
+	t.Run("unsigned payload", func(t *testing.T) {
+		err := verifyConfigSignature([]byte(payload), &privateKey.PublicKey)
+		assert.Equal(t, err.Error(), "config is not signed")
+	})
+}
+
+func TestService_loadConfig_signed(t *testing.T) {
+	privateKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("error generating key: %v", err)
+	}
+
+	srv := New(nil, t.TempDir(), "").WithConfigSigningKey(&privateKey.PublicKey)
+	cacheFilePath := filepath.Join(srv.appDirectory, configCacheFileName)
+
+	t.Run("unsigned cached config is rejected", func(t *testing.T) {
+		if err := os.WriteFile(cacheFilePath, []byte(`{"commit_id":"abc"}`), configCacheFileMode); err != nil {
+			t.Fatalf("error writing cache file: %v", err)
+		}
+
+		err := srv.loadConfig(new(CommittedConfig))
+		assert.Equal(t, err.Error(), "cached config signature verification failed: config is not signed")
+	})
+
+	t.Run("signed config is persisted with its signature", func(t *testing.T) {
+		cfg, err := srv.decodeConfig(signTestConfig(t, privateKey, `{"commit_id":"abc"}`))
+		if err != nil {
+			t.Fatalf("error decoding config: %v", err)
+		}
+
+		srv.persistConfig(cfg)
+
+		loadedCfg := new(CommittedConfig)
+		assert.NoError(t, srv.loadConfig(loadedCfg))
+		assert.Equal(t, loadedCfg.CommitID, "abc")
+		assert.Equal(t, loadedCfg.Signature, cfg.Signature)
+	})
+}
+
+func TestParseConfigSigningKey(t *testing.T) {
+	privateKey, err := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	if err != nil {
+		t.Fatalf("error generating key: %v", err)
+	}
+
+	publicKeyDER, err := x509.MarshalPKIXPublicKey(&privateKey.PublicKey)
+	if err != nil {
+		t.Fatalf("error marshaling public key: %v", err)
+	}
+
+	publicKeyPEM := pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: publicKeyDER})
+
+	_, err = ParseConfigSigningKey(publicKeyPEM)
+	assert.Equal(t, err.Error(), "config signing key must be a P-256 public key")
+}
@@ -0,0 +1,118 @@
+// Copyright 2023 qbee.io
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package configuration
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"os"
+
+	"go.qbee.io/agent/app/log"
+	"go.qbee.io/agent/app/software"
+	"go.qbee.io/agent/app/utils"
+)
+
+// packageFileInfoFileMode is the file mode of persisted package information.
+const packageFileInfoFileMode = 0600
+
+// packageFileInfoSuffix is appended to the package file path to get path of its persisted package information.
+const packageFileInfoSuffix = ".info.json"
+
+// packageFileInfo is persisted information about a package file, which is not kept after installation.
+// It allows checking whether the package is installed without downloading the package file again.
+type packageFileInfo struct {
+	// Digest of the package file in "<algorithm>:<hex>" notation.
+	Digest string `json:"digest"`
+
+	// Package information parsed from the package file.
+	Package software.Package `json:"package"`
+}
+
+// readPackageFileInfo returns persisted package information of the package file.
+// When digest is not empty, nil is returned unless the information was recorded for a file with the same digest.
+func readPackageFileInfo(pkgFilePath, digest string) *software.Package {
+	data, err := os.ReadFile(pkgFilePath + packageFileInfoSuffix)
+	if err != nil {
+		if !errors.Is(err, fs.ErrNotExist) {
+			log.Warnf("failed to read package information for %s: %v", pkgFilePath, err)
+		}
+		return nil
+	}
+
+	info := new(packageFileInfo)
+	if err = json.Unmarshal(data, info); err != nil {
+		log.Warnf("failed to parse package information for %s: %v", pkgFilePath, err)
+		return nil
+	}
+
+	if digest != "" && info.Digest != digest {
+		return nil
+	}
+
+	return &info.Package
+}
+
+// writePackageFileInfo persists package information of the package file.
+func writePackageFileInfo(pkgFilePath, digest string, pkgInfo *software.Package) {
+	data, err := json.Marshal(packageFileInfo{Digest: digest, Package: *pkgInfo})
+	if err != nil {
+		log.Warnf("failed to encode package information for %s: %v", pkgFilePath, err)
+		return
+	}
+
+	if err = utils.WriteFileSync(pkgFilePath+packageFileInfoSuffix, data, packageFileInfoFileMode); err != nil {
+		log.Warnf("failed to write package information for %s: %v", pkgFilePath, err)
+	}
+}
+
+// removePackageFile removes package file which is not kept after installation.
+func removePackageFile(pkgFilePath string) {
+	if err := os.Remove(pkgFilePath); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		log.Warnf("failed to remove package file %s: %v", pkgFilePath, err)
+	}
+}
+
+// isDiscardedPackageInstalled returns true if package from the last downloaded (and discarded) package file is installed,
+// and the package file didn't change in the file manager since. Returns also the current digest of the package file.
+func (srv *Service) isDiscardedPackageInstalled(
+	ctx context.Context,
+	installed *installedPackages,
+	src string,
+	pkgFilePath string,
+) (bool, string, error) {
+	fileMetadata, err := srv.getFileMetadata(ctx, src)
+	if err != nil {
+		ReportError(ctx, err, "Unable to get metadata of %s%s", src, downloadErrorSummary(err))
+		return false, "", err
+	}
+
+	digest := fileMetadata.Digest().String()
+
+	pkgInfo := readPackageFileInfo(pkgFilePath, digest)
+	if pkgInfo == nil {
+		return false, digest, nil
+	}
+
+	isInstalled, err := installed.has(ctx, pkgInfo)
+	if err != nil {
+		return false, digest, err
+	}
+
+	return isInstalled, digest, nil
+}
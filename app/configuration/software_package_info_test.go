@@ -0,0 +1,56 @@
+// Copyright 2023 qbee.io
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package configuration
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"go.qbee.io/agent/app/software"
+	"go.qbee.io/agent/app/utils/assert"
+)
+
+func Test_packageFileInfo(t *testing.T) {
+	pkgFilePath := filepath.Join(t.TempDir(), "qbee-test_2.1.1_all.deb")
+
+	// no information recorded yet
+	assert.Equal(t, readPackageFileInfo(pkgFilePath, ""), (*software.Package)(nil))
+
+	assert.NoError(t, os.WriteFile(pkgFilePath, []byte("package"), 0600))
+
+	pkgInfo := &software.Package{Name: "qbee-test", Version: "2.1.1", Architecture: "all"}
+	writePackageFileInfo(pkgFilePath, "sha256:abc", pkgInfo)
+
+	removePackageFile(pkgFilePath)
+
+	_, err := os.Stat(pkgFilePath)
+	assert.True(t, os.IsNotExist(err))
+
+	// information is kept after the package file is removed
+	assert.Equal(t, readPackageFileInfo(pkgFilePath, "sha256:abc"), pkgInfo)
+	assert.Equal(t, readPackageFileInfo(pkgFilePath, ""), pkgInfo)
+
+	// package file changed in the file manager
+	assert.Equal(t, readPackageFileInfo(pkgFilePath, "sha256:def"), (*software.Package)(nil))
+}
+
+func Test_packageDatabasePath(t *testing.T) {
+	assert.Equal(t, packageDatabasePath(software.PackageManagerTypeOpkg), "/usr/lib/opkg")
+	assert.Equal(t, packageDatabasePath(software.PackageManagerTypeDebian), "/var")
+	assert.Equal(t, packageDatabasePath(software.PackageManagerTypeRpm), "/var")
+}
@@ -0,0 +1,74 @@
+// Copyright 2024 qbee.io
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package configuration
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"go.qbee.io/agent/app/utils"
+)
+
+const (
+	// startupErrorFileName records the last startup error added to the reports buffer.
+	startupErrorFileName = "startup_error"
+
+	// startupErrorBundle is the bundle name used for startup error reports.
+	startupErrorBundle = "startup"
+)
+
+// RecordStartupError adds a report about a failed agent startup step to the reports buffer in appDirectory,
+// so it's delivered to the device hub by the next successful agent run.
+// The same error is recorded only once, so an agent restarted in a loop doesn't flood the buffer.
+// Failures to record the error are returned, but never recorded themselves.
+func RecordStartupError(appDirectory, step string, startupErr error) error {
+	markerPath := filepath.Join(appDirectory, startupErrorFileName)
+	description := fmt.Sprintf("%s: %v", step, startupErr)
+
+	if previous, err := os.ReadFile(markerPath); err == nil && string(previous) == description {
+		return nil
+	}
+
+	reporter := NewReporter("", false, nil)
+	ctx := reporter.BundleContext(context.Background(), startupErrorBundle, "")
+
+	ReportError(ctx, startupErr, "Agent startup failed: %s.", step)
+
+	srv := &Service{appDirectory: appDirectory}
+	if err := srv.addReportsToBuffer(reporter.Reports()); err != nil {
+		return err
+	}
+
+	if err := utils.WriteFileSync(markerPath, []byte(description), reportsBufferFileMode); err != nil {
+		return fmt.Errorf("failed to save startup error: %w", err)
+	}
+
+	return nil
+}
+
+// ClearStartupError forgets the last recorded startup error, so its next occurrence is recorded again.
+func ClearStartupError(appDirectory string) error {
+	if err := os.Remove(filepath.Join(appDirectory, startupErrorFileName)); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("failed to remove startup error: %w", err)
+	}
+
+	return nil
+}
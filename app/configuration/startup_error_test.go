@@ -0,0 +1,62 @@
+// Copyright 2024 qbee.io
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package configuration
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"go.qbee.io/agent/app/utils/assert"
+)
+
+func TestRecordStartupError(t *testing.T) {
+	srv := &Service{appDirectory: t.TempDir()}
+
+	bufferedReports := func() []Report {
+		reports, err := srv.readReportsBuffer()
+		assert.NoError(t, err)
+		return reports
+	}
+
+	startupErr := errors.New("cannot open TPM device /dev/tpmrm0")
+
+	assert.NoError(t, RecordStartupError(srv.appDirectory, "load private key", startupErr))
+
+	reports := bufferedReports()
+	assert.Length(t, reports, 1)
+	assert.Equal(t, reports[0].Bundle, startupErrorBundle)
+	assert.Equal(t, reports[0].Severity, severityError)
+	assert.Equal(t, reports[0].Text, "Agent startup failed: load private key.")
+
+	// the same error is recorded only once
+	assert.NoError(t, RecordStartupError(srv.appDirectory, "load private key", startupErr))
+	assert.Length(t, bufferedReports(), 1)
+
+	// different error is recorded
+	assert.NoError(t, RecordStartupError(srv.appDirectory, "load device certificate", startupErr))
+	assert.Length(t, bufferedReports(), 2)
+
+	// error is recorded again after a successful startup
+	assert.NoError(t, ClearStartupError(srv.appDirectory))
+	assert.NoError(t, RecordStartupError(srv.appDirectory, "load device certificate", startupErr))
+	assert.Length(t, bufferedReports(), 3)
+
+	// failure to write to the buffer is returned
+	missingDirectory := filepath.Join(srv.appDirectory, "missing")
+	assert.NotEqual(t, RecordStartupError(missingDirectory, "prepare agent directories", startupErr), nil)
+}
@@ -0,0 +1,115 @@
+// Copyright 2024 qbee.io
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package configuration
+
+import (
+	"sync"
+
+	"go.qbee.io/agent/app/log"
+)
+
+// Status describes the current configuration state of the agent.
+type Status struct {
+	// CommitID - currently applied configuration commit ID.
+	CommitID string `json:"commit_id"`
+
+	// LastRun - Unix timestamp when the last configuration run started (0 if no run finished yet).
+	LastRun int64 `json:"last_run"`
+
+	// LastRunDuration - duration of the last configuration run (in milliseconds).
+	LastRunDuration int64 `json:"last_run_duration_ms"`
+
+	// Bundles - results of bundles executed during the last run (in execution order).
+	Bundles []BundleStatus `json:"bundles"`
+
+	// RebootPending - whether a system reboot was requested by the configuration.
+	RebootPending bool `json:"reboot_pending"`
+
+	// Lock - state of the execution lock (nil if no configuration run is in progress).
+	Lock *LockStatus `json:"lock,omitempty"`
+
+	// CertificateNotAfter - Unix timestamp when the device certificate expires (0 if not known).
+	CertificateNotAfter int64 `json:"certificate_not_after,omitempty"`
+}
+
+// BundleStatus describes the result of a single bundle execution.
+type BundleStatus struct {
+	// Name - name of the bundle (e.g. "file_distribution").
+	Name string `json:"name"`
+
+	// Result - "no changes", "changed" or "failed".
+	Result string `json:"result"`
+}
+
+// statusTracker keeps the status of the last configuration run, safe for concurrent access.
+type statusTracker struct {
+	lock   sync.RWMutex
+	status Status
+}
+
+// record the status of a finished configuration run.
+func (tracker *statusTracker) record(status Status) {
+	tracker.lock.Lock()
+	defer tracker.lock.Unlock()
+
+	tracker.status = status
+}
+
+// get returns a copy of the last recorded status.
+func (tracker *statusTracker) get() Status {
+	tracker.lock.RLock()
+	defer tracker.lock.RUnlock()
+
+	status := tracker.status
+	status.Bundles = append(make([]BundleStatus, 0, len(status.Bundles)), status.Bundles...)
+
+	return status
+}
+
+// Status returns configuration status of the last run (empty if no run finished yet)
+// together with the current state of the execution lock.
+func (srv *Service) Status() Status {
+	status := srv.status.get()
+
+	lockStatus, err := srv.readLock()
+	if err != nil {
+		log.Warnf("failed to read execution lock status: %v", err)
+	}
+	status.Lock = lockStatus
+
+	return status
+}
+
+// recordStatus records the status of a finished configuration run.
+func (srv *Service) recordStatus(summary runSummary) {
+	status := Status{
+		CommitID:      srv.currentCommitID,
+		Bundles:       make([]BundleStatus, 0, len(summary)),
+		RebootPending: srv.rebootAfterRun,
+	}
+
+	if lastRun := srv.runStats.lastRun; lastRun != nil {
+		status.LastRun = lastRun.Started
+		status.LastRunDuration = lastRun.Duration
+	}
+
+	for _, bundleSummary := range summary {
+		status.Bundles = append(status.Bundles, BundleStatus{Name: bundleSummary.Bundle, Result: bundleSummary.Status})
+	}
+
+	srv.status.record(status)
+}
@@ -0,0 +1,318 @@
+// Copyright 2024 qbee.io
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package configuration
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"go.qbee.io/agent/app/log"
+	"go.qbee.io/agent/app/utils"
+)
+
+const (
+	systemdUnitDirectory = "/etc/systemd/system"
+	systemdDropInSuffix  = ".conf"
+
+	// systemdReloadPendingDirectory contains markers of units with drop-ins changed,
+	// but not yet applied by reloading systemd configuration.
+	systemdReloadPendingDirectory = "systemd_reload_pending"
+)
+
+// SystemdDropIn defines a systemd drop-in override for the software's service unit.
+type SystemdDropIn struct {
+	// Name of the drop-in file (e.g. "override.conf").
+	Name string `json:"name"`
+
+	// Template defines a source template file from file manager.
+	Template string `json:"template"`
+}
+
+// systemdDropInPath returns location of the drop-in file for the provided service unit.
+func systemdDropInPath(unit, name string) (string, error) {
+	if name == "" || strings.ContainsRune(name, '/') || !strings.HasSuffix(name, systemdDropInSuffix) {
+		return "", fmt.Errorf("invalid drop-in name '%s': must be a file name with %s suffix", name, systemdDropInSuffix)
+	}
+
+	return filepath.Join(systemdUnitDirectory, unit+".d", name), nil
+}
+
+// systemdUnit returns systemd unit name for the service.
+func systemdUnit(serviceName string) string {
+	if strings.Contains(serviceName, ".") {
+		return serviceName
+	}
+
+	return serviceName + ".service"
+}
+
+// applyDropIns writes systemd drop-in overrides for the service and reloads systemd if any of them changed.
+// Returns true if the service needs to be restarted.
+func (s Software) applyDropIns(ctx context.Context, srv *Service) (bool, error) {
+	serviceName := s.serviceName(ctx, srv)
+	if serviceName == "" {
+		err := fmt.Errorf("cannot determine service name")
+		ReportError(ctx, err, "Unable to apply systemd drop-ins for '%s'", s.Package)
+		return false, err
+	}
+
+	if _, err := exec.LookPath("systemctl"); err != nil {
+		ReportError(ctx, err, "Unable to apply systemd drop-ins for '%s': systemd is not available", serviceName)
+		return false, err
+	}
+
+	unit := systemdUnit(serviceName)
+
+	loaded, err := systemdUnitLoaded(ctx, unit)
+	if err != nil {
+		ReportError(ctx, err, "Unable to check systemd unit %s", unit)
+		return false, err
+	}
+
+	if !loaded {
+		err = fmt.Errorf("unit %s not found", unit)
+		ReportError(ctx, nil, "Unable to apply systemd drop-ins: unit %s doesn't exist", unit)
+		return false, err
+	}
+
+	changed := false
+	parameters := templateParametersMap(s.Parameters)
+
+	for _, dropIn := range s.DropIns {
+		var dropInPath string
+		if dropInPath, err = systemdDropInPath(unit, resolveParameters(ctx, dropIn.Name)); err != nil {
+			ReportError(ctx, err, "Unable to apply systemd drop-in for unit %s", unit)
+			return false, err
+		}
+
+		var created bool
+		if created, err = srv.downloadTemplateFile(ctx, "", dropIn.Template, dropInPath, parameters); err != nil {
+			return false, err
+		}
+
+		changed = changed || created
+	}
+
+	// drop-ins don't change again after a failed reload, so the reload is kept pending until it succeeds
+	if changed {
+		if err = srv.setSystemdReloadPending(unit); err != nil {
+			ReportError(ctx, err, "Unable to record pending systemd configuration reload for unit %s", unit)
+			return false, err
+		}
+	} else if !srv.systemdReloadPending(unit) {
+		return false, nil
+	}
+
+	var output []byte
+	if output, err = utils.RunCommand(ctx, []string{"systemctl", "daemon-reload"}); err != nil {
+		ReportError(ctx, err, "Unable to reload systemd configuration after drop-ins update for unit %s", unit)
+		return false, err
+	}
+
+	if err = srv.clearSystemdReloadPending(unit); err != nil {
+		log.Errorf("failed to clear pending systemd configuration reload for unit %s: %v", unit, err)
+	}
+
+	reportChange(ctx, output, "Reloaded systemd configuration after drop-ins update for unit %s", unit)
+
+	return true, nil
+}
+
+// systemdReloadPendingPath returns location of the pending reload marker for the unit.
+func (srv *Service) systemdReloadPendingPath(unit string) string {
+	return filepath.Join(srv.appDirectory, systemdReloadPendingDirectory, unit)
+}
+
+// setSystemdReloadPending records that systemd configuration must be reloaded to apply drop-ins of the unit.
+func (srv *Service) setSystemdReloadPending(unit string) error {
+	markerPath := srv.systemdReloadPendingPath(unit)
+
+	if err := os.MkdirAll(filepath.Dir(markerPath), 0700); err != nil {
+		return fmt.Errorf("error creating pending reload directory: %w", err)
+	}
+
+	if err := os.WriteFile(markerPath, nil, 0600); err != nil {
+		return fmt.Errorf("error creating pending reload marker: %w", err)
+	}
+
+	return nil
+}
+
+// systemdReloadPending returns true if a previous reload of systemd configuration for the unit has failed.
+func (srv *Service) systemdReloadPending(unit string) bool {
+	_, err := os.Stat(srv.systemdReloadPendingPath(unit))
+	return err == nil
+}
+
+// clearSystemdReloadPending removes the pending reload marker for the unit.
+func (srv *Service) clearSystemdReloadPending(unit string) error {
+	if err := os.Remove(srv.systemdReloadPendingPath(unit)); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+
+	return nil
+}
+
+// systemdUnitLoaded returns true if systemd unit definition exists in the system.
+// Masked units are reported as existing, so they can be unmasked.
+func systemdUnitLoaded(ctx context.Context, unit string) (bool, error) {
+	output, err := utils.RunCommand(ctx, []string{"systemctl", "show", "--property=LoadState", unit})
+	if err != nil {
+		return false, fmt.Errorf("error checking unit status: %w", err)
+	}
+
+	return systemdUnitExists(output), nil
+}
+
+// systemdUnitExists returns true if provided LoadState property indicates that the unit exists.
+func systemdUnitExists(loadState []byte) bool {
+	switch string(bytes.TrimSpace(loadState)) {
+	case "LoadState=loaded", "LoadState=masked":
+		return true
+	default:
+		return false
+	}
+}
+
+// systemdUnitFileActionResults maps systemctl unit file actions to their reported results.
+var systemdUnitFileActionResults = map[string]string{
+	"enable":  "enabled",
+	"disable": "disabled",
+	"mask":    "masked",
+	"unmask":  "unmasked",
+}
+
+// systemdUnitFileState returns unit file state as reported by `systemctl is-enabled` (e.g. enabled, disabled, masked).
+// The command exits with non-zero code for disabled or masked units, so the exit code is ignored if state is reported.
+func systemdUnitFileState(ctx context.Context, unit string) (string, error) {
+	command := utils.NewCommand(ctx, []string{"systemctl", "is-enabled", unit})
+
+	start := time.Now()
+	output, err := command.Output()
+	utils.TraceCommand(ctx, command, start)
+
+	state := strings.TrimSpace(string(output))
+	if state == "" {
+		if err == nil {
+			err = fmt.Errorf("empty output")
+		}
+		return "", fmt.Errorf("error checking unit file state of %s: %w", unit, err)
+	}
+
+	return state, nil
+}
+
+// systemdUnitFileActions returns systemctl commands (in order) required to bring unit file from state to desired one.
+// Masked takes precedence over Enable, since masked unit cannot be enabled.
+func systemdUnitFileActions(state string, enable, masked *bool) []string {
+	actions := make([]string, 0)
+
+	isMasked := strings.HasPrefix(state, "masked")
+
+	if masked != nil {
+		if *masked {
+			if !isMasked {
+				actions = append(actions, "mask")
+			}
+			return actions
+		}
+
+		if isMasked {
+			actions = append(actions, "unmask")
+			state = "disabled"
+		}
+	}
+
+	if enable == nil {
+		return actions
+	}
+
+	isEnabled := false
+	switch state {
+	case "enabled", "enabled-runtime", "static", "alias", "indirect", "generated", "transient":
+		isEnabled = true
+	}
+
+	if *enable && !isEnabled {
+		actions = append(actions, "enable")
+	}
+
+	if !*enable && (state == "enabled" || state == "enabled-runtime") {
+		actions = append(actions, "disable")
+	}
+
+	return actions
+}
+
+// applyUnitFileState enables, disables, masks or unmasks the service unit according to the configuration.
+func (s Software) applyUnitFileState(ctx context.Context, srv *Service) error {
+	var err error
+
+	defer func() {
+		if err != nil {
+			ReportWarning(ctx, err, "Required enable state of '%s' cannot be applied", s.Package)
+		}
+	}()
+
+	serviceName := s.serviceName(ctx, srv)
+	if serviceName == "" {
+		err = fmt.Errorf("cannot determine service name")
+		return nil
+	}
+
+	if _, err = exec.LookPath("systemctl"); err != nil {
+		err = fmt.Errorf("systemd is not available")
+		return nil
+	}
+
+	unit := systemdUnit(serviceName)
+
+	var loaded bool
+	if loaded, err = systemdUnitLoaded(ctx, unit); err != nil {
+		return nil
+	}
+
+	if !loaded {
+		err = fmt.Errorf("unit %s not found", unit)
+		return nil
+	}
+
+	var state string
+	if state, err = systemdUnitFileState(ctx, unit); err != nil {
+		return nil
+	}
+
+	for _, action := range systemdUnitFileActions(state, s.Enable, s.Masked) {
+		output, actionErr := utils.RunCommand(ctx, []string{"systemctl", action, unit})
+		if actionErr != nil {
+			ReportError(ctx, actionErr, "Unable to %s unit %s", action, unit)
+			return actionErr
+		}
+
+		reportChange(ctx, output, "Unit %s %s", unit, systemdUnitFileActionResults[action])
+	}
+
+	return nil
+}
@@ -0,0 +1,132 @@
+// Copyright 2024 qbee.io
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package configuration
+
+import (
+	"testing"
+
+	"go.qbee.io/agent/app/utils/assert"
+)
+
+func Test_systemdDropInPath(t *testing.T) {
+	tests := []struct {
+		name     string
+		unit     string
+		dropIn   string
+		wantPath string
+		wantErr  bool
+	}{
+		{
+			name:     "valid drop-in",
+			unit:     systemdUnit("nginx"),
+			dropIn:   "override.conf",
+			wantPath: "/etc/systemd/system/nginx.service.d/override.conf",
+		},
+		{
+			name:     "unit with type suffix",
+			unit:     systemdUnit("backup.timer"),
+			dropIn:   "10-schedule.conf",
+			wantPath: "/etc/systemd/system/backup.timer.d/10-schedule.conf",
+		},
+		{
+			name:    "empty name",
+			unit:    "nginx.service",
+			wantErr: true,
+		},
+		{
+			name:    "path traversal",
+			unit:    "nginx.service",
+			dropIn:  "../../nginx.service",
+			wantErr: true,
+		},
+		{
+			name:    "missing suffix",
+			unit:    "nginx.service",
+			dropIn:  "override",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := systemdDropInPath(tt.unit, tt.dropIn)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("expected error, got %s", got)
+				}
+				return
+			}
+
+			assert.NoError(t, err)
+			assert.Equal(t, got, tt.wantPath)
+		})
+	}
+}
+
+func Test_systemdUnitFileActions(t *testing.T) {
+	yes, no := true, false
+
+	tests := []struct {
+		name   string
+		state  string
+		enable *bool
+		masked *bool
+		want   []string
+	}{
+		{name: "enable disabled unit", state: "disabled", enable: &yes, want: []string{"enable"}},
+		{name: "enable enabled unit", state: "enabled", enable: &yes, want: []string{}},
+		{name: "enable static unit", state: "static", enable: &yes, want: []string{}},
+		{name: "disable enabled unit", state: "enabled", enable: &no, want: []string{"disable"}},
+		{name: "disable disabled unit", state: "disabled", enable: &no, want: []string{}},
+		{name: "disable static unit", state: "static", enable: &no, want: []string{}},
+		{name: "mask enabled unit", state: "enabled", enable: &yes, masked: &yes, want: []string{"mask"}},
+		{name: "mask masked unit", state: "masked", masked: &yes, want: []string{}},
+		{name: "unmask masked unit", state: "masked", masked: &no, want: []string{"unmask"}},
+		{name: "unmask and enable", state: "masked-runtime", enable: &yes, masked: &no, want: []string{"unmask", "enable"}},
+		{name: "unmask unmasked unit", state: "disabled", masked: &no, want: []string{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, systemdUnitFileActions(tt.state, tt.enable, tt.masked), tt.want)
+		})
+	}
+}
+
+func Test_systemdUnitExists(t *testing.T) {
+	assert.Equal(t, systemdUnitExists([]byte("LoadState=loaded\n")), true)
+	assert.Equal(t, systemdUnitExists([]byte("LoadState=masked\n")), true)
+	assert.Equal(t, systemdUnitExists([]byte("LoadState=not-found\n")), false)
+}
+
+func Test_systemdReloadPending(t *testing.T) {
+	srv := New(nil, t.TempDir(), t.TempDir())
+	unit := systemdUnit("nginx")
+
+	assert.False(t, srv.systemdReloadPending(unit))
+	assert.NoError(t, srv.clearSystemdReloadPending(unit))
+
+	assert.NoError(t, srv.setSystemdReloadPending(unit))
+	assert.True(t, srv.systemdReloadPending(unit))
+	assert.False(t, srv.systemdReloadPending(systemdUnit("sshd")))
+
+	// pending reload is kept by a new service instance (e.g. after agent restart)
+	assert.True(t, New(nil, srv.appDirectory, t.TempDir()).systemdReloadPending(unit))
+
+	assert.NoError(t, srv.clearSystemdReloadPending(unit))
+	assert.False(t, srv.systemdReloadPending(unit))
+}
@@ -0,0 +1,53 @@
+// Copyright 2023 qbee.io
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package inventory
+
+// TypeAgentRun is the inventory type for agent run statistics.
+const TypeAgentRun Type = "agent_run"
+
+// AgentRun contains timing information about the last configuration run of the agent.
+type AgentRun struct {
+	// CommitID - configuration commit ID applied during the run.
+	CommitID string `json:"commit_id"`
+
+	// Started - Unix timestamp when the run started.
+	Started int64 `json:"started"`
+
+	// Duration - total duration of the run (in milliseconds).
+	Duration int64 `json:"duration_ms"`
+
+	// Bundles - statistics of bundles executed during the run (in execution order).
+	Bundles []BundleRun `json:"bundles"`
+}
+
+// BundleRun contains timing information and execution counters of a single configuration bundle.
+type BundleRun struct {
+	// Name - name of the bundle (e.g. "file_distribution").
+	Name string `json:"name"`
+
+	// Duration - duration of the bundle execution in the last run (in milliseconds).
+	Duration int64 `json:"duration_ms"`
+
+	// TotalDuration - accumulated duration of all executions of the bundle since agent start (in milliseconds).
+	TotalDuration int64 `json:"total_duration_ms"`
+
+	// Succeeded - number of successful executions of the bundle since agent start.
+	Succeeded int `json:"succeeded"`
+
+	// Failed - number of failed executions of the bundle since agent start.
+	Failed int `json:"failed"`
+}
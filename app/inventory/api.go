@@ -19,6 +19,7 @@ package inventory
 import (
 	"bytes"
 	"context"
+	"encoding/json"
 	"fmt"
 )
 
@@ -32,3 +33,31 @@ func (srv *Service) send(ctx context.Context, inventoryType Type, buf *bytes.Buf
 
 	return nil
 }
+
+// batchInventoryPath is the device hub API path for batched inventory delivery.
+const batchInventoryPath = "/v1/org/device/auth/inventory"
+
+// sendBatch delivers multiple inventories to the device hub in a single request.
+func (srv *Service) sendBatch(ctx context.Context, items []batchItem) error {
+	if len(items) == 0 {
+		return nil
+	}
+
+	request := batchRequest{
+		Inventories: make(map[Type]json.RawMessage, len(items)),
+	}
+
+	for _, item := range items {
+		request.Inventories[item.inventoryType] = item.data
+	}
+
+	if err := srv.api.Post(ctx, batchInventoryPath, request, nil); err != nil {
+		return fmt.Errorf("error sending batched inventory request: %w", err)
+	}
+
+	for _, item := range items {
+		srv.markDelivered(item.inventoryType, item.digest)
+	}
+
+	return nil
+}
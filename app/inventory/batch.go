@@ -0,0 +1,152 @@
+// Copyright 2023 qbee.io
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package inventory
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"go.qbee.io/agent/app/api"
+)
+
+// batchItem is a single inventory waiting to be delivered in a batched request.
+type batchItem struct {
+	inventoryType Type
+	data          json.RawMessage
+	digest        string
+}
+
+// batch collects inventories to be delivered together.
+type batch struct {
+	size  int
+	items []batchItem
+}
+
+// batchRequest is the payload of a batched inventory delivery.
+type batchRequest struct {
+	Inventories map[Type]json.RawMessage `json:"inventories"`
+}
+
+// StartBatch makes Send collect changed inventories, which are delivered by SendBatch.
+// Size limits how many inventories are delivered in a single request (0 means unlimited).
+// When device hub doesn't support batched delivery, inventories are sent right away.
+func (srv *Service) StartBatch(size int) {
+	srv.batchLock.Lock()
+	defer srv.batchLock.Unlock()
+
+	if srv.batchUnsupported {
+		return
+	}
+
+	srv.batch = &batch{size: size}
+}
+
+// addToBatch adds inventory to the active batch.
+// Returns false if batching is not active and inventory needs to be sent right away.
+func (srv *Service) addToBatch(inventoryType Type, buf *bytes.Buffer, digest string) bool {
+	srv.batchLock.Lock()
+	defer srv.batchLock.Unlock()
+
+	if srv.batch == nil {
+		return false
+	}
+
+	srv.batch.items = append(srv.batch.items, batchItem{
+		inventoryType: inventoryType,
+		data:          bytes.TrimSpace(buf.Bytes()),
+		digest:        digest,
+	})
+
+	return true
+}
+
+// SendBatch delivers inventories collected since StartBatch and stops batching.
+// When a batched request is rejected, inventories from that request are sent one by one,
+// so a single failing inventory doesn't prevent delivery of the others.
+func (srv *Service) SendBatch(ctx context.Context) error {
+	srv.batchLock.Lock()
+	currentBatch := srv.batch
+	srv.batch = nil
+	srv.batchLock.Unlock()
+
+	if currentBatch == nil {
+		return nil
+	}
+
+	errs := make([]error, 0)
+	batchUnsupported := false
+
+	for _, items := range currentBatch.chunks() {
+		if !batchUnsupported {
+			err := srv.sendBatch(ctx, items)
+			if err == nil {
+				continue
+			}
+
+			apiError := new(api.Error)
+			if !errors.As(err, &apiError) {
+				errs = append(errs, err)
+				continue
+			}
+
+			if batchUnsupported = isBatchUnsupported(apiError); batchUnsupported {
+				srv.batchLock.Lock()
+				srv.batchUnsupported = true
+				srv.batchLock.Unlock()
+			}
+		}
+
+		for _, item := range items {
+			if err := srv.send(ctx, item.inventoryType, bytes.NewBuffer(item.data)); err != nil {
+				errs = append(errs, err)
+				continue
+			}
+
+			srv.markDelivered(item.inventoryType, item.digest)
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// chunks returns batch items split into chunks of batch size.
+func (b *batch) chunks() [][]batchItem {
+	if b.size <= 0 || len(b.items) <= b.size {
+		return [][]batchItem{b.items}
+	}
+
+	chunks := make([][]batchItem, 0, (len(b.items)+b.size-1)/b.size)
+	for start := 0; start < len(b.items); start += b.size {
+		end := min(start+b.size, len(b.items))
+		chunks = append(chunks, b.items[start:end])
+	}
+
+	return chunks
+}
+
+// isBatchUnsupported returns true if API error indicates that batched inventory delivery is not supported.
+func isBatchUnsupported(apiError *api.Error) bool {
+	switch apiError.ResponseCode {
+	case http.StatusNotFound, http.StatusMethodNotAllowed, http.StatusNotImplemented:
+		return true
+	default:
+		return false
+	}
+}
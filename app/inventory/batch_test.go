@@ -0,0 +1,107 @@
+// Copyright 2023 qbee.io
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package inventory
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"go.qbee.io/agent/app/api"
+	"go.qbee.io/agent/app/utils/assert"
+)
+
+func TestService_SendBatch(t *testing.T) {
+	ctx := context.Background()
+	apiClient, mock := api.NewMockedClient()
+	srv := New(apiClient)
+
+	batchResponses := []*api.MockResponse{
+		mock.Add(http.StatusOK, ""),
+		mock.Add(http.StatusOK, ""),
+	}
+
+	srv.StartBatch(2)
+	assert.NoError(t, srv.Send(ctx, TypeUsers, []string{"user"}))
+	assert.NoError(t, srv.Send(ctx, TypePorts, []string{"port"}))
+	assert.NoError(t, srv.Send(ctx, TypeSoftware, []string{"software"}))
+	assert.NoError(t, srv.SendBatch(ctx))
+
+	for _, response := range batchResponses {
+		assert.True(t, response.Called())
+		assert.Equal(t, response.Request().Method, http.MethodPost)
+		assert.Equal(t, response.Request().URL.Path, batchInventoryPath)
+	}
+
+	// unchanged inventories are not delivered again
+	srv.StartBatch(0)
+	assert.NoError(t, srv.Send(ctx, TypeUsers, []string{"user"}))
+	assert.NoError(t, srv.SendBatch(ctx))
+}
+
+func TestService_SendBatch_partialFailure(t *testing.T) {
+	ctx := context.Background()
+	apiClient, mock := api.NewMockedClient()
+	srv := New(apiClient)
+
+	mock.Add(http.StatusBadRequest, "invalid ports inventory")
+	usersResponse := mock.Add(http.StatusOK, "")
+	portsResponse := mock.Add(http.StatusBadRequest, "invalid ports inventory")
+
+	srv.StartBatch(0)
+	assert.NoError(t, srv.Send(ctx, TypeUsers, []string{"user"}))
+	assert.NoError(t, srv.Send(ctx, TypePorts, []string{"port"}))
+
+	err := srv.SendBatch(ctx)
+	assert.Equal(t, err.Error(), "error sending ports inventory request: unexpected API response: 400 invalid ports inventory")
+
+	// rejected batch is delivered one by one
+	assert.Equal(t, usersResponse.Request().Method, http.MethodPut)
+	assert.Equal(t, usersResponse.Request().URL.Path, "/v1/org/device/auth/inventory/users")
+	assert.Equal(t, portsResponse.Request().URL.Path, "/v1/org/device/auth/inventory/ports")
+
+	// only the failed inventory is delivered again
+	retryResponse := mock.Add(http.StatusOK, "")
+
+	srv.StartBatch(0)
+	assert.NoError(t, srv.Send(ctx, TypeUsers, []string{"user"}))
+	assert.NoError(t, srv.Send(ctx, TypePorts, []string{"port"}))
+	assert.NoError(t, srv.SendBatch(ctx))
+	assert.Equal(t, retryResponse.Request().URL.Path, batchInventoryPath)
+}
+
+func TestService_SendBatch_unsupported(t *testing.T) {
+	ctx := context.Background()
+	apiClient, mock := api.NewMockedClient()
+	srv := New(apiClient)
+
+	mock.Add(http.StatusNotFound, "")
+	usersResponse := mock.Add(http.StatusOK, "")
+
+	srv.StartBatch(0)
+	assert.NoError(t, srv.Send(ctx, TypeUsers, []string{"user"}))
+	assert.NoError(t, srv.SendBatch(ctx))
+	assert.Equal(t, usersResponse.Request().URL.Path, "/v1/org/device/auth/inventory/users")
+
+	// once batching is known to be unsupported, inventories are sent right away
+	portsResponse := mock.Add(http.StatusOK, "")
+
+	srv.StartBatch(0)
+	assert.NoError(t, srv.Send(ctx, TypePorts, []string{"port"}))
+	assert.True(t, portsResponse.Called())
+	assert.NoError(t, srv.SendBatch(ctx))
+}
@@ -0,0 +1,200 @@
+// Copyright 2023 qbee.io
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package inventory
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"go.qbee.io/agent/app/log"
+	"go.qbee.io/agent/app/utils"
+	"go.qbee.io/agent/app/utils/cache"
+)
+
+// TypeContainerStats is the inventory type for resource usage of containers managed by the agent.
+const TypeContainerStats Type = "container_stats"
+
+// ContainerStats represents resource usage of containers managed by the agent.
+type ContainerStats struct {
+	Containers []ContainerStat `json:"items"`
+}
+
+// ContainerStat represents resource usage of a single container.
+type ContainerStat struct {
+	// Engine - container engine running the container (docker or podman).
+	Engine string `json:"engine"`
+
+	// ID - container ID.
+	ID string `json:"id"`
+
+	// Name - container name.
+	Name string `json:"name"`
+
+	// CPUPercent - CPU usage (e.g. "0.52%").
+	CPUPercent string `json:"cpu_percent"`
+
+	// MemoryUsage - memory usage and limit (e.g. "12.5MiB / 1.94GiB").
+	MemoryUsage string `json:"memory_usage"`
+
+	// MemoryPercent - memory usage relative to the limit (e.g. "0.63%").
+	MemoryPercent string `json:"memory_percent"`
+
+	// NetIO - network traffic received and sent (e.g. "1.2kB / 648B").
+	NetIO string `json:"net_io"`
+
+	// BlockIO - data read from and written to block devices (e.g. "8.19kB / 0B").
+	BlockIO string `json:"block_io"`
+
+	// PIDs - number of processes running in the container.
+	PIDs string `json:"pids"`
+}
+
+// managedContainerLabel is the label set on all containers started by the agent.
+const managedContainerLabel = "qbee-docker-id"
+
+const containerStatsFormat = `{"id":"{{.ID}}","name":"{{.Name}}","cpu_percent":"{{.CPUPerc}}",` +
+	`"memory_usage":"{{.MemUsage}}","memory_percent":"{{.MemPerc}}","net_io":"{{.NetIO}}",` +
+	`"block_io":"{{.BlockIO}}","pids":"{{.PIDs}}"}`
+
+const (
+	containerStatsCacheKey = "inventory:container-stats"
+	containerStatsCacheTTL = 30 * time.Second
+)
+
+// CollectContainerStatsInventory returns populated ContainerStats inventory for containers managed by the agent.
+// Collected stats are cached briefly, since collecting them requires sampling all running containers.
+func CollectContainerStatsInventory(ctx context.Context) (*ContainerStats, error) {
+	if cachedStats, ok := cache.Get(containerStatsCacheKey); ok {
+		return cachedStats.(*ContainerStats), nil
+	}
+
+	engines := make([]string, 0, 2)
+	if HasDocker() {
+		engines = append(engines, "docker")
+	}
+	if HasPodman() {
+		engines = append(engines, "podman")
+	}
+
+	if len(engines) == 0 {
+		return nil, nil
+	}
+
+	containerStats := &ContainerStats{
+		Containers: make([]ContainerStat, 0),
+	}
+
+	for _, engine := range engines {
+		stats, err := collectContainerStats(ctx, engine)
+		if err != nil {
+			return nil, err
+		}
+
+		containerStats.Containers = append(containerStats.Containers, stats...)
+	}
+
+	cache.Set(containerStatsCacheKey, containerStats, containerStatsCacheTTL)
+
+	return containerStats, nil
+}
+
+// collectContainerStats returns resource usage of running containers managed by the agent using provided engine.
+// Only containers of the root user are sampled, since the agent doesn't start rootless containers.
+func collectContainerStats(ctx context.Context, engine string) ([]ContainerStat, error) {
+	listCmd := []string{
+		engine, "container", "ls", "--quiet", "--no-trunc", "--filter", "label=" + managedContainerLabel,
+	}
+
+	output, err := utils.RunCommand(ctx, listCmd)
+	if err != nil {
+		return nil, fmt.Errorf("error listing %s containers: %w", engine, err)
+	}
+
+	containerIDs := strings.Fields(string(output))
+	if len(containerIDs) == 0 {
+		return nil, nil
+	}
+
+	stats, err := sampleContainerStats(ctx, engine, containerIDs)
+	if err == nil {
+		return stats, nil
+	}
+
+	// a container removed after it was listed fails sampling of all containers, so they are sampled one by one
+	stats = make([]ContainerStat, 0, len(containerIDs))
+
+	for _, containerID := range containerIDs {
+		containerStats, sampleErr := sampleContainerStats(ctx, engine, []string{containerID})
+		if sampleErr != nil {
+			if isNoSuchContainer(sampleErr) {
+				log.Debugf("%s container %s no longer exists - skipping stats", engine, containerID)
+				continue
+			}
+			return nil, sampleErr
+		}
+
+		stats = append(stats, containerStats...)
+	}
+
+	return stats, nil
+}
+
+// sampleContainerStats returns resource usage of provided containers using provided engine.
+func sampleContainerStats(ctx context.Context, engine string, containerIDs []string) ([]ContainerStat, error) {
+	cmd := []string{engine, "stats", "--no-stream", "--format", containerStatsFormat}
+	if engine == "docker" {
+		cmd = append(cmd, "--no-trunc")
+	}
+	cmd = append(cmd, containerIDs...)
+
+	stats := make([]ContainerStat, 0, len(containerIDs))
+
+	err := utils.ForLinesInCommandOutput(ctx, cmd, func(line string) error {
+		stat, err := parseContainerStat(engine, line)
+		if err != nil {
+			return err
+		}
+
+		stats = append(stats, *stat)
+
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error collecting %s container stats: %w", engine, err)
+	}
+
+	return stats, nil
+}
+
+// isNoSuchContainer returns true if the error is caused by a container which doesn't exist.
+func isNoSuchContainer(err error) bool {
+	return strings.Contains(strings.ToLower(err.Error()), "no such container")
+}
+
+// parseContainerStat parses a single line of container stats output.
+func parseContainerStat(engine, line string) (*ContainerStat, error) {
+	stat := &ContainerStat{Engine: engine}
+
+	if err := json.Unmarshal([]byte(line), stat); err != nil {
+		return nil, fmt.Errorf("error decoding %s container stats: %w", engine, err)
+	}
+
+	return stat, nil
+}
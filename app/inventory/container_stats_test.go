@@ -0,0 +1,72 @@
+// Copyright 2024 qbee.io
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package inventory
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"go.qbee.io/agent/app/utils"
+)
+
+func Test_parseContainerStat(t *testing.T) {
+	line := `{"id":"2f1a8c","name":"web","cpu_percent":"0.52%","memory_usage":"12.5MiB / 1.94GiB",` +
+		`"memory_percent":"0.63%","net_io":"1.2kB / 648B","block_io":"8.19kB / 0B","pids":"3"}`
+
+	got, err := parseContainerStat("podman", line)
+	if err != nil {
+		t.Fatalf("parseContainerStat() error = %v", err)
+	}
+
+	want := &ContainerStat{
+		Engine:        "podman",
+		ID:            "2f1a8c",
+		Name:          "web",
+		CPUPercent:    "0.52%",
+		MemoryUsage:   "12.5MiB / 1.94GiB",
+		MemoryPercent: "0.63%",
+		NetIO:         "1.2kB / 648B",
+		BlockIO:       "8.19kB / 0B",
+		PIDs:          "3",
+	}
+
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("parseContainerStat() = %v, want %v", got, want)
+	}
+
+	if _, err = parseContainerStat("docker", "invalid"); err == nil {
+		t.Errorf("parseContainerStat() expected error for invalid line")
+	}
+}
+
+func Test_isNoSuchContainer(t *testing.T) {
+	tests := map[string]bool{
+		"Error response from daemon: No such container: 2f1a8c":                        true,
+		`Error: unable to look up container 2f1a8c: no such container`:                 true,
+		"Cannot connect to the Docker daemon at unix:///var/run/docker.sock":           false,
+		`Error: unable to get stats: container 2f1a8c has no cgroup: invalid argument`: false,
+	}
+
+	for stderr, want := range tests {
+		err := &utils.CommandError{Cmd: []string{"docker", "stats"}, Err: errors.New("exit status 1"), Stderr: []byte(stderr)}
+
+		if got := isNoSuchContainer(err); got != want {
+			t.Errorf("isNoSuchContainer(%q) = %v, want %v", stderr, got, want)
+		}
+	}
+}
@@ -16,9 +16,14 @@
 
 package inventory
 
+import "time"
+
 // TypePorts is the inventory type for listening network ports.
 const TypePorts Type = "ports"
 
+const portsInventoryCacheKey = "inventory:ports"
+const portsInventoryCacheTTL = 30 * time.Second
+
 // Ports contains information about currently listening network ports.
 type Ports struct {
 	Ports []Port `json:"items"`
@@ -32,6 +37,18 @@ type Port struct {
 	// Socket - which socket is listening (e.g. "0.0.0.0:69").
 	Socket string `json:"socket"`
 
+	// Address - local address of the listening socket (e.g. "0.0.0.0").
+	Address string `json:"address"`
+
+	// Port - local port number of the listening socket (e.g. 69).
+	Port int `json:"port"`
+
+	// PID - ID of the process owning the socket (0 if unknown).
+	PID int `json:"pid,omitempty"`
+
+	// Binary - path to the executable of the process owning the socket (e.g. "/usr/sbin/in.tftpd").
+	Binary string `json:"binary,omitempty"`
+
 	// Process - which process is controlling the socket (e.g. "/usr/sbin/in.tftpd ...").
 	Process string `json:"proc_info"`
 }
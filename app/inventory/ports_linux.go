@@ -33,10 +33,15 @@ import (
 	"go.qbee.io/agent/app/inventory/linux"
 	"go.qbee.io/agent/app/log"
 	"go.qbee.io/agent/app/utils"
+	"go.qbee.io/agent/app/utils/cache"
 )
 
 // CollectPortsInventory returns populated Ports inventory based on current system status.
 func CollectPortsInventory() (*Ports, error) {
+	if cachedItem, ok := cache.Get(portsInventoryCacheKey); ok {
+		return cachedItem.(*Ports), nil
+	}
+
 	ports := new(Ports)
 
 	var protocols = []string{"tcp", "tcp6", "udp", "udp6"}
@@ -57,6 +62,8 @@ func CollectPortsInventory() (*Ports, error) {
 		}
 	}
 
+	cache.Set(portsInventoryCacheKey, ports, portsInventoryCacheTTL)
+
 	return ports, nil
 }
 
@@ -110,7 +117,11 @@ func loadProcessFDInodes() (map[uint64]string, error) {
 
 // parseNetworkPorts parses /proc/net/<protocol> file format and returns a list of listening ports.
 func parseNetworkPorts(protocol string, inodesMap map[uint64]string) ([]Port, error) {
-	procFilePath := filepath.Join("/proc/net", protocol)
+	return parseNetworkPortsFile(filepath.Join(linux.ProcFS, "net", protocol), protocol, inodesMap)
+}
+
+// parseNetworkPortsFile parses provided file in /proc/net/<protocol> format and returns a list of listening ports.
+func parseNetworkPortsFile(procFilePath, protocol string, inodesMap map[uint64]string) ([]Port, error) {
 	ports := make([]Port, 0)
 
 	err := utils.ForLinesInFile(procFilePath, func(line string) error {
@@ -133,22 +144,30 @@ func parseNetworkPorts(protocol string, inodesMap map[uint64]string) ([]Port, er
 			return fmt.Errorf("error parsing inode %s: %w", inode, err)
 		}
 
-		var cmdLine string
+		listeningPort := Port{
+			Protocol: protocol,
+			Socket:   fmt.Sprintf("%s:%d", address, port),
+			Address:  address.String(),
+			Port:     int(port),
+		}
 
 		// lookup socket's inode in the inode map to identify the process owning it
 		if fileDescriptorPath, found := inodesMap[uint64(inodeInt)]; found {
-			processID := strings.SplitN(fileDescriptorPath, "/", 4)[2]
+			processID := filepath.Base(fileDescriptorPath)
 
-			if cmdLine, err = linux.GetProcessCommand(processID); err != nil {
+			if listeningPort.Process, err = linux.GetProcessCommand(processID); err != nil {
 				return err
 			}
+
+			listeningPort.PID, _ = strconv.Atoi(processID)
+
+			// executable link is not readable for all processes, so we report it only when available
+			if binary, err := os.Readlink(filepath.Join(fileDescriptorPath, "exe")); err == nil {
+				listeningPort.Binary = binary
+			}
 		}
 
-		ports = append(ports, Port{
-			Protocol: protocol,
-			Socket:   fmt.Sprintf("%s:%d", address, port),
-			Process:  cmdLine,
-		})
+		ports = append(ports, listeningPort)
 
 		return nil
 	})
@@ -19,7 +19,13 @@ package inventory
 import (
 	"encoding/json"
 	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
 	"testing"
+
+	"go.qbee.io/agent/app/inventory/linux"
+	"go.qbee.io/agent/app/utils/assert"
 )
 
 func TestCollectPortsInventory(t *testing.T) {
@@ -32,3 +38,57 @@ func TestCollectPortsInventory(t *testing.T) {
 
 	fmt.Println(string(data))
 }
+
+func Test_parseNetworkPortsFile(t *testing.T) {
+	procNetTCP := `  sl  local_address rem_address   st tx_queue rx_queue tr tm->when retrnsmt   uid  timeout inode
+   0: 0100007F:0277 00000000:0000 0A 00000000:00000000 00:00000000 00000000     0        0 21370 1 0000000000000000 100 0 0 10 0
+   1: 00000000:0016 00000000:0000 0A 00000000:00000000 00:00000000 00000000     0        0 17655 1 0000000000000000 100 0 0 10 0
+   2: 0F02000A:0016 0202000A:E3C6 01 00000000:00000000 02:000A0CF4 00000000     0        0 38071 4 0000000000000000 20 4 31 10 -1
+`
+
+	procFilePath := filepath.Join(t.TempDir(), "tcp")
+	if err := os.WriteFile(procFilePath, []byte(procNetTCP), 0600); err != nil {
+		t.Fatalf("error writing test file: %v", err)
+	}
+
+	// map socket inode to the test process, so we can verify process resolution
+	pid := os.Getpid()
+	inodesMap := map[uint64]string{
+		17655: filepath.Join(linux.ProcFS, strconv.Itoa(pid)),
+	}
+
+	ports, err := parseNetworkPortsFile(procFilePath, "tcp", inodesMap)
+	if err != nil {
+		t.Fatalf("error parsing ports: %v", err)
+	}
+
+	processCommand, err := linux.GetProcessCommand(strconv.Itoa(pid))
+	if err != nil {
+		t.Fatalf("error getting process command: %v", err)
+	}
+
+	binary, err := os.Executable()
+	if err != nil {
+		t.Fatalf("error getting executable path: %v", err)
+	}
+
+	expectedPorts := []Port{
+		{
+			Protocol: "tcp",
+			Socket:   "127.0.0.1:631",
+			Address:  "127.0.0.1",
+			Port:     631,
+		},
+		{
+			Protocol: "tcp",
+			Socket:   "0.0.0.0:22",
+			Address:  "0.0.0.0",
+			Port:     22,
+			PID:      pid,
+			Binary:   binary,
+			Process:  processCommand,
+		},
+	}
+
+	assert.Equal(t, ports, expectedPorts)
+}
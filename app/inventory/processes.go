@@ -40,4 +40,7 @@ type Process struct {
 
 	// Command - program command.
 	Command string `json:"cmdline"`
+
+	// Count - number of aggregated processes (set only when processes are aggregated by executable).
+	Count int `json:"count,omitempty"`
 }
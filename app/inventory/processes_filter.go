@@ -0,0 +1,182 @@
+// Copyright 2023 qbee.io
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package inventory
+
+import (
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Supported process sort orders.
+const (
+	ProcessSortByCPU    = "cpu"
+	ProcessSortByMemory = "memory"
+)
+
+// ProcessFilter limits processes reported in the process inventory.
+// An empty filter preserves all processes.
+type ProcessFilter struct {
+	// Include - regular expressions matched against process command line.
+	// When set, only matching processes are reported.
+	Include []string `json:"include,omitempty"`
+
+	// Exclude - regular expressions matched against process command line.
+	// Matching processes are not reported.
+	Exclude []string `json:"exclude,omitempty"`
+
+	// Limit - maximum number of reported processes (0 means no limit).
+	Limit int `json:"limit,omitempty"`
+
+	// SortBy - "cpu" (default) or "memory", defines which processes are reported when limit is set.
+	SortBy string `json:"sort_by,omitempty"`
+
+	// AggregateByExecutable - report a single entry per executable with summed CPU and memory usage.
+	AggregateByExecutable bool `json:"aggregate_by_executable,omitempty"`
+}
+
+// Apply returns processes matching the filter.
+// Filters are applied in order: include/exclude, aggregation, and the top-N limit.
+func (filter ProcessFilter) Apply(processes *Processes) (*Processes, error) {
+	usage, err := processUsage(filter.SortBy)
+	if err != nil {
+		return nil, err
+	}
+
+	include, err := compileProcessPatterns(filter.Include)
+	if err != nil {
+		return nil, err
+	}
+
+	exclude, err := compileProcessPatterns(filter.Exclude)
+	if err != nil {
+		return nil, err
+	}
+
+	filtered := make([]Process, 0, len(processes.Processes))
+
+	for _, process := range processes.Processes {
+		if len(include) > 0 && !matchesAnyPattern(include, process.Command) {
+			continue
+		}
+
+		if matchesAnyPattern(exclude, process.Command) {
+			continue
+		}
+
+		filtered = append(filtered, process)
+	}
+
+	if filter.AggregateByExecutable {
+		filtered = aggregateProcesses(filtered)
+	}
+
+	if filter.Limit > 0 && len(filtered) > filter.Limit {
+		sort.SliceStable(filtered, func(i, j int) bool {
+			return usage(filtered[i]) > usage(filtered[j])
+		})
+
+		filtered = filtered[:filter.Limit]
+	}
+
+	return &Processes{Processes: filtered}, nil
+}
+
+// compileProcessPatterns returns compiled regular expressions.
+func compileProcessPatterns(patterns []string) ([]*regexp.Regexp, error) {
+	compiled := make([]*regexp.Regexp, 0, len(patterns))
+
+	for _, pattern := range patterns {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid process filter pattern %q: %w", pattern, err)
+		}
+
+		compiled = append(compiled, re)
+	}
+
+	return compiled, nil
+}
+
+// matchesAnyPattern returns true if value matches any of the provided patterns.
+func matchesAnyPattern(patterns []*regexp.Regexp, value string) bool {
+	for _, re := range patterns {
+		if re.MatchString(value) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// processExecutable returns executable name of the process based on its command line.
+func processExecutable(command string) string {
+	fields := strings.Fields(command)
+	if len(fields) == 0 {
+		return command
+	}
+
+	return filepath.Base(fields[0])
+}
+
+// aggregateProcesses returns a single process entry per executable (in order of first appearance).
+// Aggregated entries have summed CPU and memory usage, no PID and the user set only when it's shared by all processes.
+func aggregateProcesses(processes []Process) []Process {
+	aggregated := make([]Process, 0)
+	index := make(map[string]int)
+
+	for _, process := range processes {
+		executable := processExecutable(process.Command)
+
+		i, ok := index[executable]
+		if !ok {
+			index[executable] = len(aggregated)
+			aggregated = append(aggregated, Process{
+				User:    process.User,
+				Memory:  process.Memory,
+				CPU:     process.CPU,
+				Command: executable,
+				Count:   1,
+			})
+			continue
+		}
+
+		if aggregated[i].User != process.User {
+			aggregated[i].User = ""
+		}
+
+		aggregated[i].Memory += process.Memory
+		aggregated[i].CPU += process.CPU
+		aggregated[i].Count++
+	}
+
+	return aggregated
+}
+
+// processUsage returns function returning process resource usage used to select top-N processes.
+func processUsage(sortBy string) (func(process Process) float64, error) {
+	switch sortBy {
+	case "", ProcessSortByCPU:
+		return func(process Process) float64 { return process.CPU }, nil
+	case ProcessSortByMemory:
+		return func(process Process) float64 { return process.Memory }, nil
+	default:
+		return nil, fmt.Errorf("unsupported process sort order: %s", sortBy)
+	}
+}
@@ -0,0 +1,124 @@
+// Copyright 2023 qbee.io
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package inventory
+
+import (
+	"reflect"
+	"testing"
+)
+
+var testProcesses = &Processes{
+	Processes: []Process{
+		{PID: 1, User: "root", CPU: 0.1, Memory: 0.5, Command: "/sbin/init"},
+		{PID: 10, User: "www", CPU: 5, Memory: 2, Command: "/usr/sbin/nginx -g daemon off;"},
+		{PID: 11, User: "www", CPU: 15, Memory: 1, Command: "/usr/sbin/nginx -g daemon off;"},
+		{PID: 20, User: "root", CPU: 1, Memory: 10, Command: "/usr/bin/dockerd"},
+		{PID: 30, User: "app", CPU: 20, Memory: 3, Command: "/opt/app/bin/worker --queue=default"},
+	},
+}
+
+func pids(processes *Processes) []int {
+	result := make([]int, 0, len(processes.Processes))
+	for _, process := range processes.Processes {
+		result = append(result, process.PID)
+	}
+
+	return result
+}
+
+func TestProcessFilter_Apply(t *testing.T) {
+	tests := []struct {
+		name   string
+		filter ProcessFilter
+		want   []int
+	}{
+		{
+			name: "empty filter preserves all processes",
+			want: []int{1, 10, 11, 20, 30},
+		},
+		{
+			name:   "exclude",
+			filter: ProcessFilter{Exclude: []string{"nginx", "^/sbin/"}},
+			want:   []int{20, 30},
+		},
+		{
+			name:   "include and exclude",
+			filter: ProcessFilter{Include: []string{"^/usr/"}, Exclude: []string{"dockerd"}},
+			want:   []int{10, 11},
+		},
+		{
+			name:   "top-N by CPU",
+			filter: ProcessFilter{Limit: 2},
+			want:   []int{30, 11},
+		},
+		{
+			name:   "top-N by memory",
+			filter: ProcessFilter{Limit: 2, SortBy: ProcessSortByMemory},
+			want:   []int{20, 30},
+		},
+		{
+			name:   "limit larger than number of processes keeps the order",
+			filter: ProcessFilter{Limit: 10},
+			want:   []int{1, 10, 11, 20, 30},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.filter.Apply(testProcesses)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if !reflect.DeepEqual(pids(got), tt.want) {
+				t.Errorf("Apply() = %v, want %v", pids(got), tt.want)
+			}
+		})
+	}
+}
+
+func TestProcessFilter_Apply_Aggregate(t *testing.T) {
+	filter := ProcessFilter{AggregateByExecutable: true, Limit: 2}
+
+	got, err := filter.Apply(testProcesses)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	want := []Process{
+		{User: "www", CPU: 20, Memory: 3, Command: "nginx", Count: 2},
+		{User: "app", CPU: 20, Memory: 3, Command: "worker", Count: 1},
+	}
+
+	if !reflect.DeepEqual(got.Processes, want) {
+		t.Errorf("Apply() = %+v, want %+v", got.Processes, want)
+	}
+}
+
+func TestProcessFilter_Apply_Invalid(t *testing.T) {
+	invalidFilters := []ProcessFilter{
+		{Include: []string{"("}},
+		{Exclude: []string{"["}},
+		{SortBy: "disk"},
+	}
+
+	for _, filter := range invalidFilters {
+		if _, err := filter.Apply(testProcesses); err == nil {
+			t.Errorf("expected error for filter %+v", filter)
+		}
+	}
+}
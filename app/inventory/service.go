@@ -33,6 +33,13 @@ type Service struct {
 	api                           *api.Client
 	deliveredInventoryDigests     map[Type]string
 	deliveredInventoryDigestsLock sync.Mutex
+
+	// batch collects inventories to be delivered in batched requests (nil when batching is not active)
+	batch     *batch
+	batchLock sync.Mutex
+
+	// batchUnsupported is set when device hub doesn't support batched inventory delivery
+	batchUnsupported bool
 }
 
 // New returns a new instance of inventory Service.
@@ -62,13 +69,22 @@ func (srv *Service) Send(ctx context.Context, inventoryType Type, inventoryData
 		return nil
 	}
 
+	if srv.addToBatch(inventoryType, buf, currentDigest) {
+		return nil
+	}
+
 	if err := srv.send(ctx, inventoryType, buf); err != nil {
 		return fmt.Errorf("error sending %s inventory request: %w", inventoryType, err)
 	}
 
-	srv.deliveredInventoryDigestsLock.Lock()
-	srv.deliveredInventoryDigests[inventoryType] = currentDigest
-	srv.deliveredInventoryDigestsLock.Unlock()
+	srv.markDelivered(inventoryType, currentDigest)
 
 	return nil
 }
+
+// markDelivered records digest of the inventory delivered to the device hub.
+func (srv *Service) markDelivered(inventoryType Type, digest string) {
+	srv.deliveredInventoryDigestsLock.Lock()
+	srv.deliveredInventoryDigests[inventoryType] = digest
+	srv.deliveredInventoryDigestsLock.Unlock()
+}
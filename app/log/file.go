@@ -0,0 +1,143 @@
+// Copyright 2023 qbee.io
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package log
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+const (
+	defaultFileMaxSizeMB  = 10
+	defaultFileMaxBackups = 3
+	logFileMode           = 0600
+	logDirectoryMode      = 0700
+)
+
+// rotatingFile is a log file rotated when its size exceeds the limit.
+type rotatingFile struct {
+	lock       sync.Mutex
+	path       string
+	maxSize    int64
+	maxBackups int
+	file       *os.File
+	size       int64
+}
+
+var currentFile *rotatingFile
+
+// SetFileOutput configures logging to a file at path (in addition to the standard output).
+// The file is rotated when it exceeds maxSizeMB megabytes, keeping up to maxBackups rotated files (path.1, path.2, ...).
+// Non-positive values fall back to the default limits.
+func SetFileOutput(path string, maxSizeMB, maxBackups int) error {
+	if maxSizeMB <= 0 {
+		maxSizeMB = defaultFileMaxSizeMB
+	}
+
+	if maxBackups <= 0 {
+		maxBackups = defaultFileMaxBackups
+	}
+
+	logFile := &rotatingFile{
+		path:       path,
+		maxSize:    int64(maxSizeMB) * 1024 * 1024,
+		maxBackups: maxBackups,
+	}
+
+	if err := logFile.open(); err != nil {
+		return err
+	}
+
+	if currentFile != nil {
+		_ = currentFile.close()
+	}
+
+	currentFile = logFile
+
+	log.SetOutput(io.MultiWriter(os.Stderr, logFile))
+
+	return nil
+}
+
+// open opens (or creates) the log file for appending.
+func (f *rotatingFile) open() error {
+	if err := os.MkdirAll(filepath.Dir(f.path), logDirectoryMode); err != nil {
+		return fmt.Errorf("error creating log directory: %w", err)
+	}
+
+	file, err := os.OpenFile(f.path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, logFileMode)
+	if err != nil {
+		return fmt.Errorf("error opening log file %s: %w", f.path, err)
+	}
+
+	fileInfo, err := file.Stat()
+	if err != nil {
+		_ = file.Close()
+		return fmt.Errorf("error checking log file %s: %w", f.path, err)
+	}
+
+	f.file = file
+	f.size = fileInfo.Size()
+
+	return nil
+}
+
+// close closes the log file.
+func (f *rotatingFile) close() error {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	return f.file.Close()
+}
+
+// Write writes p to the log file, rotating the file first if it would exceed the size limit.
+func (f *rotatingFile) Write(p []byte) (int, error) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	if f.size > 0 && f.size+int64(len(p)) > f.maxSize {
+		if err := f.rotate(); err != nil {
+			return 0, err
+		}
+	}
+
+	n, err := f.file.Write(p)
+	f.size += int64(n)
+
+	return n, err
+}
+
+// rotate shifts rotated files (dropping the oldest one) and starts a new log file.
+func (f *rotatingFile) rotate() error {
+	if err := f.file.Close(); err != nil {
+		return fmt.Errorf("error closing log file %s: %w", f.path, err)
+	}
+
+	for i := f.maxBackups - 1; i > 0; i-- {
+		_ = os.Rename(fmt.Sprintf("%s.%d", f.path, i), fmt.Sprintf("%s.%d", f.path, i+1))
+	}
+
+	if err := os.Rename(f.path, f.path+".1"); err != nil {
+		return fmt.Errorf("error rotating log file %s: %w", f.path, err)
+	}
+
+	return f.open()
+}
@@ -0,0 +1,62 @@
+// Copyright 2023 qbee.io
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package log
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func Test_rotatingFile_Write(t *testing.T) {
+	logPath := filepath.Join(t.TempDir(), "agent.log")
+
+	logFile := &rotatingFile{path: logPath, maxSize: 10, maxBackups: 2}
+	if err := logFile.open(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer logFile.close()
+
+	for _, line := range []string{"line-1\n", "line-2\n", "line-3\n", "line-4\n"} {
+		if _, err := logFile.Write([]byte(line)); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+
+	expectedFiles := map[string]string{
+		logPath:        "line-4\n",
+		logPath + ".1": "line-3\n",
+		logPath + ".2": "line-2\n",
+	}
+
+	for path, expectedContent := range expectedFiles {
+		content, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		if !bytes.Equal(content, []byte(expectedContent)) {
+			t.Errorf("expected %s to contain %q, got %q", path, expectedContent, content)
+		}
+	}
+
+	// the oldest rotated file is dropped
+	if _, err := os.Stat(logPath + ".3"); !os.IsNotExist(err) {
+		t.Errorf("expected %s.3 not to exist, got %v", logPath, err)
+	}
+}
@@ -16,7 +16,13 @@
 
 package log
 
-import "log"
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+)
 
 // Supported logs severity levels.
 const (
@@ -24,6 +30,9 @@ const (
 	WARNING
 	INFO
 	DEBUG
+
+	// TRACE additionally logs every external command executed by the agent.
+	TRACE
 )
 
 var levelPrefix = map[int]string{
@@ -31,39 +40,144 @@ var levelPrefix = map[int]string{
 	WARNING: "[WARNING] ",
 	INFO:    "[INFO] ",
 	DEBUG:   "[DEBUG] ",
+	TRACE:   "[TRACE] ",
+}
+
+var levelName = map[int]string{
+	ERROR:   "ERROR",
+	WARNING: "WARNING",
+	INFO:    "INFO",
+	DEBUG:   "DEBUG",
+	TRACE:   "TRACE",
 }
 
 var level = INFO
 
-func logf(msgLevel int, msg string, args ...any) {
+// Format defines log output format.
+type Format int
+
+// Supported log formats.
+const (
+	// Text format prints log messages as "[LEVEL] message" lines.
+	Text Format = iota
+
+	// JSON format prints each log message as a single-line JSON object.
+	JSON
+)
+
+var format = Text
+
+// Fields define optional context attached to log messages (included only in the JSON format).
+type Fields struct {
+	Bundle   string `json:"bundle,omitempty"`
+	CommitID string `json:"commit_id,omitempty"`
+}
+
+// jsonEntry defines a single log message in the JSON format.
+type jsonEntry struct {
+	Timestamp string `json:"timestamp"`
+	Level     string `json:"level"`
+	Message   string `json:"message"`
+	Fields
+}
+
+func logf(fields Fields, msgLevel int, msg string, args ...any) {
 	if level < msgLevel {
 		return
 	}
 
-	log.Printf(levelPrefix[msgLevel]+msg, args...)
+	if format == Text {
+		log.Printf(levelPrefix[msgLevel]+msg, args...)
+		return
+	}
+
+	// multi-line messages (e.g. command output) are encoded as a single JSON string
+	entry, err := json.Marshal(jsonEntry{
+		Timestamp: time.Now().UTC().Format(time.RFC3339Nano),
+		Level:     levelName[msgLevel],
+		Message:   strings.TrimRight(fmt.Sprintf(msg, args...), "\n"),
+		Fields:    fields,
+	})
+	if err != nil {
+		return
+	}
+
+	log.Print(string(entry))
+}
+
+// Tracef logs message with TRACE severity.
+func Tracef(msg string, args ...any) {
+	logf(Fields{}, TRACE, msg, args...)
 }
 
 // Debugf logs message with DEBUG severity.
 func Debugf(msg string, args ...any) {
-	logf(DEBUG, msg, args...)
+	logf(Fields{}, DEBUG, msg, args...)
 }
 
 // Infof logs message with INFO severity.
 func Infof(msg string, args ...any) {
-	logf(INFO, msg, args...)
+	logf(Fields{}, INFO, msg, args...)
 }
 
 // Warnf logs message with WARNING severity.
 func Warnf(msg string, args ...any) {
-	logf(WARNING, msg, args...)
+	logf(Fields{}, WARNING, msg, args...)
 }
 
 // Errorf logs message with ERROR severity.
 func Errorf(msg string, args ...any) {
-	logf(ERROR, msg, args...)
+	logf(Fields{}, ERROR, msg, args...)
 }
 
 // SetLevel sets current log level.
 func SetLevel(newLevel int) {
 	level = newLevel
 }
+
+// Enabled returns true if messages with provided severity are logged.
+func Enabled(msgLevel int) bool {
+	return level >= msgLevel
+}
+
+// SetFormat sets log output format.
+func SetFormat(newFormat Format) {
+	format = newFormat
+
+	// JSON entries include their own timestamp
+	if format == JSON {
+		log.SetFlags(0)
+	} else {
+		log.SetFlags(log.LstdFlags)
+	}
+}
+
+// Logger logs messages with attached fields.
+type Logger struct {
+	fields Fields
+}
+
+// With returns a logger which attaches provided fields to all messages.
+func With(fields Fields) *Logger {
+	return &Logger{fields: fields}
+}
+
+// Debugf logs message with DEBUG severity.
+func (l *Logger) Debugf(msg string, args ...any) {
+	logf(l.fields, DEBUG, msg, args...)
+}
+
+// Infof logs message with INFO severity.
+func (l *Logger) Infof(msg string, args ...any) {
+	logf(l.fields, INFO, msg, args...)
+}
+
+// Warnf logs message with WARNING severity.
+func (l *Logger) Warnf(msg string, args ...any) {
+	logf(l.fields, WARNING, msg, args...)
+}
+
+// Errorf logs message with ERROR severity.
+func (l *Logger) Errorf(msg string, args ...any) {
+	logf(l.fields, ERROR, msg, args...)
+}
@@ -0,0 +1,58 @@
+// Copyright 2023 qbee.io
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package log
+
+import (
+	"bytes"
+	"encoding/json"
+	"log"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestSetFormat_JSON(t *testing.T) {
+	buffer := new(bytes.Buffer)
+	log.SetOutput(buffer)
+	SetFormat(JSON)
+
+	defer func() {
+		log.SetOutput(os.Stderr)
+		SetFormat(Text)
+	}()
+
+	With(Fields{Bundle: "file_distribution", CommitID: "abc"}).Errorf("command failed:\n%s", "line 1\nline 2")
+	Debugf("not logged at the default level")
+
+	lines := strings.Split(strings.TrimSpace(buffer.String()), "\n")
+	if len(lines) != 1 {
+		t.Fatalf("expected single log line, got %q", buffer.String())
+	}
+
+	entry := new(jsonEntry)
+	if err := json.Unmarshal([]byte(lines[0]), entry); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if entry.Level != "ERROR" || entry.Message != "command failed:\nline 1\nline 2" || entry.Timestamp == "" {
+		t.Errorf("unexpected log entry: %+v", entry)
+	}
+
+	if entry.Bundle != "file_distribution" || entry.CommitID != "abc" {
+		t.Errorf("unexpected log entry fields: %+v", entry.Fields)
+	}
+}
@@ -28,7 +28,7 @@ func (w *Writer) Write(p []byte) (n int, err error) {
 		return len(p), nil
 	}
 
-	logf(w.level, "%s%s", w.prefix, p)
+	logf(Fields{}, w.level, "%s%s", w.prefix, p)
 
 	return len(p), nil
 }
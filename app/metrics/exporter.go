@@ -0,0 +1,134 @@
+// Copyright 2023 qbee.io
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package metrics
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"go.qbee.io/agent/app/log"
+)
+
+// DefaultExporterAddress is the default bind address of the Prometheus metrics exporter.
+const DefaultExporterAddress = "127.0.0.1:9101"
+
+// exporterShutdownTimeout defines how long the exporter waits for in-flight scrapes when stopped.
+const exporterShutdownTimeout = 5 * time.Second
+
+// Exporter exposes collected metrics over HTTP in Prometheus text exposition format.
+type Exporter struct {
+	service *Service
+	lock    sync.Mutex
+	address string
+	server  *http.Server
+}
+
+// NewExporter returns a new Prometheus exporter for metrics collected by the provided service.
+func NewExporter(service *Service) *Exporter {
+	return &Exporter{
+		service: service,
+	}
+}
+
+// ServeHTTP responds with current metrics.
+// Scrapes don't affect delta-metrics delivered to the device hub.
+func (e *Exporter) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+
+	if err := WritePrometheus(w, e.service.Current()); err != nil {
+		log.Errorf("failed to write metrics to %s: %v", r.RemoteAddr, err)
+	}
+}
+
+// UpdateState starts, restarts or stops the exporter, so it listens on the provided address.
+// Empty address stops the exporter.
+func (e *Exporter) UpdateState(address string) error {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+
+	if address == e.address {
+		return nil
+	}
+
+	if err := e.stop(); err != nil {
+		return err
+	}
+
+	if address == "" {
+		return nil
+	}
+
+	listener, err := net.Listen("tcp", address)
+	if err != nil {
+		return fmt.Errorf("error starting metrics exporter on %s: %w", address, err)
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", e)
+
+	server := &http.Server{
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	go func() {
+		if serveErr := server.Serve(listener); !errors.Is(serveErr, http.ErrServerClosed) {
+			log.Errorf("metrics exporter error: %v", serveErr)
+		}
+	}()
+
+	log.Infof("metrics exporter listening on %s", listener.Addr())
+
+	e.address = address
+	e.server = server
+
+	return nil
+}
+
+// Stop the exporter (if running).
+func (e *Exporter) Stop() error {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+
+	return e.stop()
+}
+
+// stop shuts down the running server. Caller must hold the lock.
+func (e *Exporter) stop() error {
+	if e.server == nil {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), exporterShutdownTimeout)
+	defer cancel()
+
+	err := e.server.Shutdown(ctx)
+
+	e.server = nil
+	e.address = ""
+
+	if err != nil {
+		return fmt.Errorf("error stopping metrics exporter: %w", err)
+	}
+
+	return nil
+}
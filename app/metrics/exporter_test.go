@@ -0,0 +1,157 @@
+// Copyright 2023 qbee.io
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package metrics
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"go.qbee.io/agent/app/utils/assert"
+)
+
+func TestWritePrometheus(t *testing.T) {
+	metrics := []Metric{
+		{
+			Label:  CPU,
+			Values: Values{CPUValues: &CPUValues{User: 1250, System: 300, IOWait: 5}},
+		},
+		{
+			Label:  Network,
+			ID:     "eth0",
+			Values: Values{NetworkValues: &NetworkValues{RXBytes: 17423, TXBytes: 7126}},
+		},
+		{
+			Label:  Memory,
+			Values: Values{MemoryValues: &MemoryValues{MemoryFree: 1000, MemoryUtilization: 25, SwapUtilization: 0}},
+		},
+		{
+			Label:  Filesystem,
+			ID:     "/",
+			Values: Values{FilesystemValues: &FilesystemValues{Available: 2, Use: 14}},
+		},
+		{
+			Label:  Filesystem,
+			ID:     `/mnt/"data"`,
+			Values: Values{FilesystemValues: &FilesystemValues{Available: 1, Use: 50}},
+		},
+		{
+			Label:  LoadAverage,
+			Values: Values{LoadAverageValues: &LoadAverageValues{Minute1: 1.17, Minute5: 0.84, Minute15: 0.77}},
+		},
+	}
+
+	buf := new(bytes.Buffer)
+	assert.NoError(t, WritePrometheus(buf, metrics))
+
+	expected := []string{
+		"# HELP qbee_cpu_seconds_total CPU time spent in each mode since boot.",
+		"# TYPE qbee_cpu_seconds_total counter",
+		`qbee_cpu_seconds_total{mode="user"} 12.5`,
+		`qbee_cpu_seconds_total{mode="system"} 3`,
+		`qbee_cpu_seconds_total{mode="iowait"} 0.05`,
+		"# HELP qbee_memory_available_bytes Memory available for starting new applications.",
+		"# TYPE qbee_memory_available_bytes gauge",
+		"qbee_memory_available_bytes 1.024e+06",
+		"# HELP qbee_memory_utilization_percent Memory utilization.",
+		"# TYPE qbee_memory_utilization_percent gauge",
+		"qbee_memory_utilization_percent 25",
+		"# HELP qbee_swap_utilization_percent Swap utilization.",
+		"# TYPE qbee_swap_utilization_percent gauge",
+		"qbee_swap_utilization_percent 0",
+		"# HELP qbee_filesystem_available_bytes Filesystem space available to unprivileged users.",
+		"# TYPE qbee_filesystem_available_bytes gauge",
+		`qbee_filesystem_available_bytes{mountpoint="/"} 2048`,
+		`qbee_filesystem_available_bytes{mountpoint="/mnt/\"data\""} 1024`,
+		"# HELP qbee_filesystem_utilization_percent Filesystem utilization.",
+		"# TYPE qbee_filesystem_utilization_percent gauge",
+		`qbee_filesystem_utilization_percent{mountpoint="/"} 14`,
+		`qbee_filesystem_utilization_percent{mountpoint="/mnt/\"data\""} 50`,
+		"# HELP qbee_load1 System load average over 1 minute.",
+		"# TYPE qbee_load1 gauge",
+		"qbee_load1 1.17",
+		"# HELP qbee_load5 System load average over 5 minutes.",
+		"# TYPE qbee_load5 gauge",
+		"qbee_load5 0.84",
+		"# HELP qbee_load15 System load average over 15 minutes.",
+		"# TYPE qbee_load15 gauge",
+		"qbee_load15 0.77",
+		"# HELP qbee_network_receive_bytes_total Bytes received on a network interface.",
+		"# TYPE qbee_network_receive_bytes_total counter",
+		`qbee_network_receive_bytes_total{interface="eth0"} 17423`,
+		"# HELP qbee_network_transmit_bytes_total Bytes transmitted on a network interface.",
+		"# TYPE qbee_network_transmit_bytes_total counter",
+		`qbee_network_transmit_bytes_total{interface="eth0"} 7126`,
+		"",
+	}
+
+	assert.Equal(t, strings.Split(buf.String(), "\n"), expected)
+}
+
+func TestExporter_UpdateState(t *testing.T) {
+	exporter := NewExporter(New(nil))
+
+	assert.NoError(t, exporter.UpdateState("127.0.0.1:0"))
+	assert.Equal(t, exporter.address, "127.0.0.1:0")
+
+	// empty address stops the exporter
+	assert.NoError(t, exporter.UpdateState(""))
+	assert.Empty(t, exporter.address)
+
+	if exporter.server != nil {
+		t.Fatalf("expected exporter to be stopped")
+	}
+
+	// stopping a stopped exporter is a no-op
+	assert.NoError(t, exporter.Stop())
+}
+
+func TestExporter_ServeHTTP(t *testing.T) {
+	server := httptest.NewServer(NewExporter(New(nil)))
+	defer server.Close()
+
+	response, err := http.Get(server.URL + "/metrics")
+	assert.NoError(t, err)
+	defer response.Body.Close()
+
+	body, err := io.ReadAll(response.Body)
+	assert.NoError(t, err)
+
+	assert.Equal(t, response.StatusCode, http.StatusOK)
+	assert.Equal(t, response.Header.Get("Content-Type"), "text/plain; version=0.0.4; charset=utf-8")
+
+	if !strings.Contains(string(body), "# TYPE qbee_load1 gauge") {
+		t.Fatalf("missing load average metric in:\n%s", body)
+	}
+}
+
+func TestExporter_ServeHTTP_KeepsDeltaState(t *testing.T) {
+	service := New(nil)
+	server := httptest.NewServer(NewExporter(service))
+	defer server.Close()
+
+	response, err := http.Get(server.URL + "/metrics")
+	assert.NoError(t, err)
+	_ = response.Body.Close()
+
+	if service.previousCPUValues != nil || len(service.previousNetworkValues) != 0 {
+		t.Fatalf("scrape must not change delta-metrics state")
+	}
+}
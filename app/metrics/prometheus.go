@@ -0,0 +1,124 @@
+// Copyright 2023 qbee.io
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// prometheusNamespace prefixes all exported metric names.
+const prometheusNamespace = "qbee"
+
+// clockTicksPerSecond is the unit of CPU times in /proc/stat (USER_HZ, 100 on all supported architectures).
+const clockTicksPerSecond = 100
+
+// Prometheus metric types.
+const (
+	prometheusGauge   = "gauge"
+	prometheusCounter = "counter"
+)
+
+// prometheusFamilies defines exported metric families (in order of exposition).
+var prometheusFamilies = []struct {
+	name       string
+	help       string
+	metricType string
+}{
+	{name: "cpu_seconds_total", help: "CPU time spent in each mode since boot.", metricType: prometheusCounter},
+	{name: "memory_available_bytes", help: "Memory available for starting new applications.", metricType: prometheusGauge},
+	{name: "memory_utilization_percent", help: "Memory utilization.", metricType: prometheusGauge},
+	{name: "swap_utilization_percent", help: "Swap utilization.", metricType: prometheusGauge},
+	{name: "filesystem_available_bytes", help: "Filesystem space available to unprivileged users.", metricType: prometheusGauge},
+	{name: "filesystem_utilization_percent", help: "Filesystem utilization.", metricType: prometheusGauge},
+	{name: "load1", help: "System load average over 1 minute.", metricType: prometheusGauge},
+	{name: "load5", help: "System load average over 5 minutes.", metricType: prometheusGauge},
+	{name: "load15", help: "System load average over 15 minutes.", metricType: prometheusGauge},
+	{name: "network_receive_bytes_total", help: "Bytes received on a network interface.", metricType: prometheusCounter},
+	{name: "network_transmit_bytes_total", help: "Bytes transmitted on a network interface.", metricType: prometheusCounter},
+	{name: "temperature_celsius", help: "Temperature in degrees Celsius.", metricType: prometheusGauge},
+}
+
+// prometheusLabelValueEscaper escapes label values according to the text exposition format.
+var prometheusLabelValueEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// WritePrometheus writes provided metrics in Prometheus text exposition format.
+// CPU and network values must be cumulative totals (see Service.Current), since they are exported as counters.
+func WritePrometheus(w io.Writer, metrics []Metric) error {
+	samples := make(map[string][]string)
+
+	add := func(name, labelName, labelValue string, value float64) {
+		labels := ""
+		if labelName != "" {
+			labels = fmt.Sprintf(`{%s="%s"}`, labelName, prometheusLabelValueEscaper.Replace(labelValue))
+		}
+
+		sample := fmt.Sprintf("%s_%s%s %s", prometheusNamespace, name, labels, strconv.FormatFloat(value, 'g', -1, 64))
+		samples[name] = append(samples[name], sample)
+	}
+
+	for _, metric := range metrics {
+		values := metric.Values
+
+		switch {
+		case metric.Label == CPU && values.CPUValues != nil:
+			add("cpu_seconds_total", "mode", "user", values.CPUValues.User/clockTicksPerSecond)
+			add("cpu_seconds_total", "mode", "system", values.CPUValues.System/clockTicksPerSecond)
+			add("cpu_seconds_total", "mode", "iowait", values.CPUValues.IOWait/clockTicksPerSecond)
+		case metric.Label == Memory && values.MemoryValues != nil:
+			// memory values are reported in kB by the kernel
+			add("memory_available_bytes", "", "", float64(values.MemoryValues.MemoryFree)*1024)
+			add("memory_utilization_percent", "", "", float64(values.MemoryValues.MemoryUtilization))
+			add("swap_utilization_percent", "", "", float64(values.MemoryValues.SwapUtilization))
+		case metric.Label == Filesystem && values.FilesystemValues != nil:
+			add("filesystem_available_bytes", "mountpoint", metric.ID,
+				float64(values.FilesystemValues.Available)*fsBlockSize)
+			add("filesystem_utilization_percent", "mountpoint", metric.ID, float64(values.FilesystemValues.Use))
+		case metric.Label == LoadAverage && values.LoadAverageValues != nil:
+			add("load1", "", "", values.LoadAverageValues.Minute1)
+			add("load5", "", "", values.LoadAverageValues.Minute5)
+			add("load15", "", "", values.LoadAverageValues.Minute15)
+		case metric.Label == Network && values.NetworkValues != nil:
+			add("network_receive_bytes_total", "interface", metric.ID, float64(values.NetworkValues.RXBytes))
+			add("network_transmit_bytes_total", "interface", metric.ID, float64(values.NetworkValues.TXBytes))
+		case metric.Label == Temperature && values.TemperatureValues != nil:
+			add("temperature_celsius", "sensor", metric.ID, values.TemperatureValues.Temperature)
+		}
+	}
+
+	for _, family := range prometheusFamilies {
+		if len(samples[family.name]) == 0 {
+			continue
+		}
+
+		name := prometheusNamespace + "_" + family.name
+
+		if _, err := fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", name, family.help, name, family.metricType); err != nil {
+			return err
+		}
+
+		for _, sample := range samples[family.name] {
+			if _, err := fmt.Fprintln(w, sample); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
@@ -108,6 +108,38 @@ func (s *Service) Collect() []Metric {
 	return allMetrics
 }
 
+// Current returns current system metrics without affecting the state used to calculate delta-metrics.
+// CPU and network values are cumulative totals since boot.
+func (s *Service) Current() []Metric {
+	allMetrics := make([]Metric, 0)
+
+	for _, collector := range metricsCollectors {
+		if metrics, err := collector.fn(); err != nil {
+			log.Errorf("%s metrics error: %v", collector.name, err)
+		} else {
+			allMetrics = append(allMetrics, metrics...)
+		}
+	}
+
+	if cpuValues, err := CollectCPU(); err != nil {
+		log.Errorf("cpu metrics error: %v", err)
+	} else {
+		allMetrics = append(allMetrics, Metric{
+			Label:     CPU,
+			Timestamp: time.Now().Unix(),
+			Values:    Values{CPUValues: cpuValues},
+		})
+	}
+
+	if networkMetrics, err := CollectNetwork(); err != nil {
+		log.Errorf("network metrics error: %v", err)
+	} else {
+		allMetrics = append(allMetrics, networkMetrics...)
+	}
+
+	return allMetrics
+}
+
 func (s *Service) doCollectCPU() (*Metric, error) {
 
 	cpuValues, err := CollectCPU()
@@ -24,6 +24,9 @@ import (
 
 	"github.com/xtaci/smux"
 	"go.qbee.io/transport"
+
+	"go.qbee.io/agent/app/api"
+	"go.qbee.io/agent/app/log"
 )
 
 // New creates a new instance of the remote access service.
@@ -37,6 +40,7 @@ func New() *Service {
 type Service struct {
 	client    *transport.DeviceClient
 	tlsConfig *tls.Config
+	binding   api.LocalBinding
 	mutex     sync.Mutex
 
 	// consoleMap is a map of all active consoles.
@@ -50,8 +54,38 @@ type Service struct {
 }
 
 // WithTLSConfig sets the TLS configuration for the remote access service.
+// Already initialized client is stopped (e.g. after key rotation), so it's re-created with the new configuration
+// and started again on the next state update.
 func (s *Service) WithTLSConfig(tlsConfig *tls.Config) *Service {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
 	s.tlsConfig = tlsConfig
+
+	if s.client == nil {
+		return s
+	}
+
+	if s.client.IsRunning() {
+		if err := s.client.Close(); err != nil {
+			log.Warnf("failed to stop remote access client: %v", err)
+		}
+	}
+
+	s.client = nil
+
+	return s
+}
+
+// WithLocalBinding sets local address and/or network interface configured for outgoing connections.
+// Remote access transport doesn't support custom dialers, so the binding is not applied to remote access connections
+// (a warning is logged when the client is initialized).
+func (s *Service) WithLocalBinding(binding api.LocalBinding) *Service {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.binding = binding
+
 	return s
 }
 
@@ -72,6 +106,10 @@ func (s *Service) ensureInit(edgeURL string) error {
 		return err
 	}
 
+	if s.binding.IsSet() {
+		log.Warnf("local binding is not applied to remote access connections to %s", edgeURL)
+	}
+
 	s.client = client.
 		WithHandler(transport.MessageTypeTCPTunnel, transport.HandleTCPTunnel).
 		WithHandler(transport.MessageTypeUDPTunnel, transport.HandleUDPTunnel).
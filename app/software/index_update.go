@@ -0,0 +1,202 @@
+// Copyright 2023 qbee.io
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package software
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"go.qbee.io/agent/app/log"
+	"go.qbee.io/agent/app/utils"
+)
+
+// IndexUpdatePolicy defines when package managers update package indexes (e.g. apt-get update)
+// before listing available updates.
+type IndexUpdatePolicy struct {
+	// Disabled skips index updates, so available updates are listed from existing package indexes.
+	Disabled bool
+
+	// Interval defines minimal time between index updates (0 updates indexes every time updates are listed).
+	Interval time.Duration
+}
+
+const ctxIndexUpdatePolicy = contextKey("software:index-update-policy")
+
+// WithIndexUpdatePolicy returns context with policy used by package managers to decide whether to update package indexes.
+// Without a policy, indexes are updated every time updates are listed.
+func WithIndexUpdatePolicy(ctx context.Context, policy IndexUpdatePolicy) context.Context {
+	return context.WithValue(ctx, ctxIndexUpdatePolicy, policy)
+}
+
+var indexUpdateLock sync.Mutex
+
+// lastIndexUpdates keeps time of the last successful index update for each package manager.
+var lastIndexUpdates = make(map[PackageManagerType]time.Time)
+
+// indexUpdateStateDirectory is the directory where time of the last index update is persisted (disabled when empty).
+var indexUpdateStateDirectory string
+
+// SetIndexUpdateStateDirectory sets the directory where time of the last index update is persisted,
+// so the index update interval is respected across agent restarts.
+func SetIndexUpdateStateDirectory(directory string) {
+	indexUpdateLock.Lock()
+	defer indexUpdateLock.Unlock()
+
+	indexUpdateStateDirectory = directory
+}
+
+// indexUpdateState is the persisted time of the last successful index update.
+type indexUpdateState struct {
+	// Updated - Unix timestamp of the last successful index update.
+	Updated int64 `json:"updated"`
+}
+
+// indexUpdateStateFilePath returns path of the file with persisted index update state of the package manager
+// (empty if persistence is disabled). Caller must hold indexUpdateLock.
+func indexUpdateStateFilePath(pkgManagerType PackageManagerType) string {
+	if indexUpdateStateDirectory == "" {
+		return ""
+	}
+
+	return filepath.Join(indexUpdateStateDirectory, fmt.Sprintf("%s-%s-index-update.json", pkgCacheKeyPrefix, pkgManagerType))
+}
+
+// lastIndexUpdate returns time of the last successful index update (zero time if unknown).
+// Caller must hold indexUpdateLock.
+func lastIndexUpdate(pkgManagerType PackageManagerType) time.Time {
+	if updated, ok := lastIndexUpdates[pkgManagerType]; ok {
+		return updated
+	}
+
+	filePath := indexUpdateStateFilePath(pkgManagerType)
+	if filePath == "" {
+		return time.Time{}
+	}
+
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		if !errors.Is(err, fs.ErrNotExist) {
+			log.Warnf("failed to read index update state %s: %v", filePath, err)
+		}
+		return time.Time{}
+	}
+
+	state := new(indexUpdateState)
+	if err = json.Unmarshal(data, state); err != nil {
+		log.Warnf("failed to parse index update state %s: %v", filePath, err)
+		return time.Time{}
+	}
+
+	updated := time.Unix(state.Updated, 0)
+	lastIndexUpdates[pkgManagerType] = updated
+
+	return updated
+}
+
+// indexUpdateSkipReason returns a reason why package index update should be skipped,
+// or empty string when indexes should be updated.
+func indexUpdateSkipReason(policy IndexUpdatePolicy, pkgManagerType PackageManagerType) string {
+	indexUpdateLock.Lock()
+	defer indexUpdateLock.Unlock()
+
+	if policy.Disabled {
+		return "index updates are disabled"
+	}
+
+	if policy.Interval <= 0 {
+		return ""
+	}
+
+	updated := lastIndexUpdate(pkgManagerType)
+	if updated.IsZero() {
+		return ""
+	}
+
+	sinceUpdate := time.Since(updated)
+	if sinceUpdate < 0 || sinceUpdate >= policy.Interval {
+		return ""
+	}
+
+	return fmt.Sprintf("indexes were updated %s ago (update interval is %s)",
+		sinceUpdate.Truncate(time.Second), policy.Interval)
+}
+
+// skipIndexUpdate returns true if package index update should be skipped according to the index update policy
+// set with WithIndexUpdatePolicy. Skipped update is logged and reported through the handler set with
+// WithIndexUpdateSkippedHandler.
+func skipIndexUpdate(ctx context.Context, pkgManagerType PackageManagerType) bool {
+	policy, _ := ctx.Value(ctxIndexUpdatePolicy).(IndexUpdatePolicy)
+
+	reason := indexUpdateSkipReason(policy, pkgManagerType)
+	if reason == "" {
+		return false
+	}
+
+	log.Infof("skipping %s package index update: %s", pkgManagerType, reason)
+
+	if handler, ok := ctx.Value(ctxIndexUpdateSkippedHandler).(IndexUpdateSkippedHandler); ok {
+		handler(reason)
+	}
+
+	return true
+}
+
+// markIndexUpdated records successful package index update.
+func markIndexUpdated(pkgManagerType PackageManagerType) {
+	indexUpdateLock.Lock()
+	defer indexUpdateLock.Unlock()
+
+	now := time.Now()
+	lastIndexUpdates[pkgManagerType] = now
+
+	filePath := indexUpdateStateFilePath(pkgManagerType)
+	if filePath == "" {
+		return
+	}
+
+	data, err := json.Marshal(indexUpdateState{Updated: now.Unix()})
+	if err != nil {
+		log.Warnf("failed to encode index update state: %v", err)
+		return
+	}
+
+	if err = os.MkdirAll(filepath.Dir(filePath), pkgCacheDirectoryMode); err != nil {
+		log.Warnf("failed to create package cache directory: %v", err)
+		return
+	}
+
+	if err = utils.WriteFileSync(filePath, data, pkgCacheFileMode); err != nil {
+		log.Warnf("failed to write index update state %s: %v", filePath, err)
+	}
+}
+
+// IndexUpdateSkippedHandler is called with a reason when package index update is skipped by the index update policy.
+type IndexUpdateSkippedHandler func(reason string)
+
+const ctxIndexUpdateSkippedHandler = contextKey("software:index-update-skipped-handler")
+
+// WithIndexUpdateSkippedHandler returns context with a handler called when package index update is skipped.
+func WithIndexUpdateSkippedHandler(ctx context.Context, handler IndexUpdateSkippedHandler) context.Context {
+	return context.WithValue(ctx, ctxIndexUpdateSkippedHandler, handler)
+}
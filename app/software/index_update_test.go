@@ -0,0 +1,62 @@
+// Copyright 2023 qbee.io
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package software
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"go.qbee.io/agent/app/utils/assert"
+)
+
+func TestIndexUpdatePolicy(t *testing.T) {
+	SetIndexUpdateStateDirectory(t.TempDir())
+	defer SetIndexUpdateStateDirectory("")
+
+	const pkgManagerType = PackageManagerType("test")
+
+	// by default, indexes are updated every time
+	assert.False(t, skipIndexUpdate(context.Background(), pkgManagerType))
+
+	ctx := WithIndexUpdatePolicy(context.Background(), IndexUpdatePolicy{Interval: time.Hour})
+
+	// no previous update recorded
+	assert.False(t, skipIndexUpdate(ctx, pkgManagerType))
+
+	markIndexUpdated(pkgManagerType)
+
+	var reason string
+	ctx = WithIndexUpdateSkippedHandler(ctx, func(skipReason string) {
+		reason = skipReason
+	})
+
+	assert.True(t, skipIndexUpdate(ctx, pkgManagerType))
+	assert.HasPrefix(t, reason, "indexes were updated 0s ago")
+
+	// simulate agent restart, so the last update is read from the persisted state
+	delete(lastIndexUpdates, pkgManagerType)
+	assert.True(t, skipIndexUpdate(ctx, pkgManagerType))
+
+	// stale indexes are updated
+	lastIndexUpdates[pkgManagerType] = time.Now().Add(-2 * time.Hour)
+	assert.False(t, skipIndexUpdate(ctx, pkgManagerType))
+
+	ctx = WithIndexUpdatePolicy(ctx, IndexUpdatePolicy{Disabled: true})
+	assert.True(t, skipIndexUpdate(ctx, pkgManagerType))
+	assert.Equal(t, reason, "index updates are disabled")
+}
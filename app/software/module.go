@@ -0,0 +1,176 @@
+// Copyright 2023 qbee.io
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package software
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Module defines a module stream (e.g. nodejs:18) with an optional profile to install.
+type Module struct {
+	// Name of the module (e.g. "nodejs").
+	Name string `json:"name"`
+
+	// Stream of the module to enable (e.g. "18").
+	Stream string `json:"stream"`
+
+	// Profile of the module to install (e.g. "common"). When empty, the stream is only enabled.
+	Profile string `json:"profile,omitempty"`
+}
+
+var moduleTokenRE = regexp.MustCompile(`^[A-Za-z0-9_.+-]+$`)
+
+// Validate returns an error if module definition is not valid.
+func (module Module) Validate() error {
+	if !moduleTokenRE.MatchString(module.Name) {
+		return fmt.Errorf("invalid module name: %q", module.Name)
+	}
+
+	if !moduleTokenRE.MatchString(module.Stream) {
+		return fmt.Errorf("invalid stream for module %s: %q", module.Name, module.Stream)
+	}
+
+	if module.Profile != "" && !moduleTokenRE.MatchString(module.Profile) {
+		return fmt.Errorf("invalid profile for module %s: %q", module.Name, module.Profile)
+	}
+
+	return nil
+}
+
+// String returns module spec in the dnf format (name:stream or name:stream/profile).
+func (module Module) String() string {
+	if module.Profile == "" {
+		return module.Name + ":" + module.Stream
+	}
+
+	return module.Name + ":" + module.Stream + "/" + module.Profile
+}
+
+// ModuleChange describes a module stream which was enabled or a module profile which was installed.
+type ModuleChange struct {
+	// Module which was changed.
+	Module Module
+
+	// Enabled is true if the stream was enabled (or switched from another stream).
+	Enabled bool
+
+	// Installed is true if the profile was installed.
+	Installed bool
+}
+
+// ModuleManager is implemented by package managers supporting module streams (dnf on RHEL 8+ and Fedora).
+type ModuleManager interface {
+	// ModulesSupported returns true if the host system supports module streams.
+	ModulesSupported(ctx context.Context) bool
+
+	// ConfigureModules ensures provided module streams are enabled and their profiles installed.
+	// Returns changed modules and output of the executed commands.
+	ConfigureModules(ctx context.Context, modules []Module) ([]ModuleChange, []byte, error)
+}
+
+// enabledModule describes an enabled module stream and its installed profiles.
+type enabledModule struct {
+	stream            string
+	installedProfiles map[string]bool
+}
+
+// parseEnabledModules parses output of "dnf module list --enabled".
+//
+// Example output:
+//
+//	Red Hat Universal Base Image 8 (RPMs) - AppStream
+//	Name       Stream     Profiles                                Summary
+//	nodejs     18 [e]     common [d] [i], development, minimal    Javascript runtime
+//
+//	Hint: [d]efault, [e]nabled, [x]disabled, [i]nstalled
+func parseEnabledModules(output []byte) map[string]enabledModule {
+	modules := make(map[string]enabledModule)
+
+	scanner := bufio.NewScanner(bytes.NewReader(output))
+	inTable := false
+
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+
+		if line == "" || strings.HasPrefix(line, "Hint:") {
+			inTable = false
+			continue
+		}
+
+		fields := strings.Fields(line)
+
+		if len(fields) >= 2 && fields[0] == "Name" && fields[1] == "Stream" {
+			inTable = true
+			continue
+		}
+
+		if !inTable || len(fields) < 2 {
+			continue
+		}
+
+		module := enabledModule{stream: fields[1], installedProfiles: make(map[string]bool)}
+
+		parseModuleProfiles(fields[2:], module.installedProfiles)
+
+		// module might be listed by multiple repositories
+		if existing, ok := modules[fields[0]]; ok {
+			for profile := range existing.installedProfiles {
+				module.installedProfiles[profile] = true
+			}
+		}
+
+		modules[fields[0]] = module
+	}
+
+	return modules
+}
+
+// parseModuleProfiles collects installed profiles from the fields following the module stream.
+// Profiles are separated by commas and followed by markers (e.g. "common [d] [i], minimal"),
+// the first field after the last profile starts the module summary.
+func parseModuleProfiles(fields []string, installed map[string]bool) {
+	// skip stream markers (e.g. "[d][e]")
+	for len(fields) > 0 && strings.HasPrefix(fields[0], "[") {
+		fields = fields[1:]
+	}
+
+	for len(fields) > 0 {
+		profile := strings.TrimSuffix(fields[0], ",")
+		more := profile != fields[0]
+		fields = fields[1:]
+
+		for !more && len(fields) > 0 && strings.HasPrefix(fields[0], "[") {
+			marker := strings.TrimSuffix(fields[0], ",")
+			more = marker != fields[0]
+
+			if strings.Contains(marker, "[i]") {
+				installed[profile] = true
+			}
+
+			fields = fields[1:]
+		}
+
+		if !more {
+			return
+		}
+	}
+}
@@ -0,0 +1,83 @@
+// Copyright 2023 qbee.io
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package software
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestModule_Validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		module  Module
+		wantErr bool
+	}{
+		{name: "valid", module: Module{Name: "nodejs", Stream: "18"}},
+		{name: "valid with profile", module: Module{Name: "php", Stream: "8.1", Profile: "common"}},
+		{name: "missing stream", module: Module{Name: "nodejs"}, wantErr: true},
+		{name: "invalid name", module: Module{Name: "nodejs;reboot", Stream: "18"}, wantErr: true},
+		{name: "invalid profile", module: Module{Name: "nodejs", Stream: "18", Profile: "a b"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.module.Validate(); (err != nil) != tt.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestModule_String(t *testing.T) {
+	if got := (Module{Name: "nodejs", Stream: "18"}).String(); got != "nodejs:18" {
+		t.Errorf("String() = %v", got)
+	}
+
+	if got := (Module{Name: "nodejs", Stream: "18", Profile: "common"}).String(); got != "nodejs:18/common" {
+		t.Errorf("String() = %v", got)
+	}
+}
+
+func Test_parseEnabledModules(t *testing.T) {
+	output := `Red Hat Universal Base Image 8 (RPMs) - AppStream
+Name       Stream     Profiles                                  Summary
+nodejs     18 [e]     common [d] [i], development, minimal, s2i  Javascript runtime
+php        8.1 [e]    common [d], devel, minimal                PHP scripting language
+ruby       3.1 [d][e] common [d][i]                             An interpreter of object-oriented scripting language
+
+Extra Packages for Enterprise Linux Modular 8 - x86_64
+Name       Stream     Profiles                                  Summary
+nodejs     18 [e]     minimal [i]                               Javascript runtime
+
+Hint: [d]efault, [e]nabled, [x]disabled, [i]nstalled
+`
+
+	want := map[string]enabledModule{
+		"nodejs": {stream: "18", installedProfiles: map[string]bool{"common": true, "minimal": true}},
+		"php":    {stream: "8.1", installedProfiles: map[string]bool{}},
+		"ruby":   {stream: "3.1", installedProfiles: map[string]bool{"common": true}},
+	}
+
+	if got := parseEnabledModules([]byte(output)); !reflect.DeepEqual(got, want) {
+		t.Errorf("parseEnabledModules() = %v, want %v", got, want)
+	}
+
+	if got := parseEnabledModules(nil); len(got) != 0 {
+		t.Errorf("parseEnabledModules() = %v, want empty", got)
+	}
+}
@@ -0,0 +1,282 @@
+// Copyright 2024 qbee.io
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package software
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"go.qbee.io/agent/app/api"
+)
+
+const opkgListsDir = "/var/opkg-lists"
+
+var opkgListsDirRE = regexp.MustCompile(`^option\s+lists_dir\s+(?:\S+\s+)?(\S+)$`)
+
+// resolveOpkgListsPath returns the directory where opkg keeps downloaded feed package lists.
+func resolveOpkgListsPath(configPath string) string {
+	if configPath == "" {
+		return opkgListsDir
+	}
+
+	configFile, err := os.Open(configPath)
+	if err != nil {
+		return opkgListsDir
+	}
+	defer configFile.Close()
+
+	scanner := bufio.NewScanner(configFile)
+
+	for scanner.Scan() {
+		if matches := opkgListsDirRE.FindStringSubmatch(strings.TrimSpace(scanner.Text())); matches != nil {
+			return matches[1]
+		}
+	}
+
+	return opkgListsDir
+}
+
+var opkgFeedRE = regexp.MustCompile(`^src(?:/gz)?\s+(\S+)\s+(\S+)$`)
+
+// resolveOpkgFeeds returns a map of feed name -> feed URL from the main config and the config directory next to it.
+func resolveOpkgFeeds(configPath string) map[string]string {
+	feeds := make(map[string]string)
+
+	if configPath == "" {
+		return feeds
+	}
+
+	configPaths := []string{configPath}
+
+	if extraConfigPaths, err := filepath.Glob(filepath.Join(filepath.Dir(configPath), "opkg", "*.conf")); err == nil {
+		configPaths = append(configPaths, extraConfigPaths...)
+	}
+
+	for _, path := range configPaths {
+		configFile, err := os.Open(path)
+		if err != nil {
+			continue
+		}
+
+		scanner := bufio.NewScanner(configFile)
+
+		for scanner.Scan() {
+			if matches := opkgFeedRE.FindStringSubmatch(strings.TrimSpace(scanner.Text())); matches != nil {
+				feeds[matches[1]] = matches[2]
+			}
+		}
+
+		configFile.Close()
+	}
+
+	return feeds
+}
+
+// opkgFeedPackage describes a specific package version available in a feed.
+type opkgFeedPackage struct {
+	URL       string
+	SHA256Sum string
+	MD5Sum    string
+}
+
+// findOpkgPackage returns a specific package version from the feed package lists.
+// Feeds are searched in name order, so the same feed is used when multiple feeds provide the package.
+func findOpkgPackage(listsDir string, feeds map[string]string, pkgName, version string) (*opkgFeedPackage, error) {
+	feedNames := make([]string, 0, len(feeds))
+	for feedName := range feeds {
+		feedNames = append(feedNames, feedName)
+	}
+
+	sort.Strings(feedNames)
+
+	for _, feedName := range feedNames {
+		pkg, err := findOpkgFeedPackage(filepath.Join(listsDir, feedName), pkgName, version)
+		if err != nil {
+			return nil, err
+		}
+
+		if pkg != nil {
+			pkg.URL = strings.TrimRight(feeds[feedName], "/") + "/" + pkg.URL
+			return pkg, nil
+		}
+	}
+
+	return nil, fmt.Errorf("package %s version %s not found in any feed", pkgName, version)
+}
+
+// findOpkgFeedPackage returns a specific package version from a feed package list, with URL relative to the feed.
+// Returns nil if package version is not in the list.
+func findOpkgFeedPackage(listPath, pkgName, version string) (*opkgFeedPackage, error) {
+	listData, err := os.ReadFile(listPath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+
+		return nil, fmt.Errorf("error reading feed package list %s: %w", listPath, err)
+	}
+
+	var reader io.Reader = bytes.NewReader(listData)
+
+	// package lists can be stored compressed
+	if bytes.HasPrefix(listData, []byte{0x1f, 0x8b}) {
+		if reader, err = gzip.NewReader(reader); err != nil {
+			return nil, fmt.Errorf("error decompressing feed package list %s: %w", listPath, err)
+		}
+	}
+
+	var name, pkgVersion string
+	pkg := new(opkgFeedPackage)
+
+	// package stanzas are separated by empty lines, so checksums might follow the filename
+	matched := func() bool {
+		return name == pkgName && pkgVersion == version && pkg.URL != ""
+	}
+
+	scanner := bufio.NewScanner(reader)
+
+	for scanner.Scan() {
+		line := scanner.Text()
+		if strings.TrimSpace(line) == "" {
+			if matched() {
+				return pkg, nil
+			}
+
+			continue
+		}
+
+		key, value, _ := strings.Cut(line, ":")
+		value = strings.TrimSpace(value)
+
+		switch key {
+		case "Package":
+			if matched() {
+				return pkg, nil
+			}
+
+			name, pkgVersion, pkg = value, "", new(opkgFeedPackage)
+		case "Version":
+			pkgVersion = value
+		case "Filename":
+			pkg.URL = value
+		case "SHA256sum":
+			pkg.SHA256Sum = strings.ToLower(value)
+		case "MD5Sum":
+			pkg.MD5Sum = strings.ToLower(value)
+		}
+	}
+
+	if err = scanner.Err(); err != nil {
+		return nil, fmt.Errorf("error reading feed package list %s: %w", listPath, err)
+	}
+
+	if matched() {
+		return pkg, nil
+	}
+
+	return nil, nil
+}
+
+// opkgHTTPClient is used to download packages from http(s) feeds.
+var opkgHTTPClient = api.NewHTTPClient()
+
+// SetDownloadClient sets HTTP client used to download packages from http(s) feeds
+// (e.g. to use agent's trusted CA certificates and local binding).
+func SetDownloadClient(client *http.Client) {
+	opkgHTTPClient = client
+}
+
+// downloadOpkgPackage downloads a package file from a feed URL (http, https or file) to dst
+// and verifies it against the checksum from the feed package list.
+func downloadOpkgPackage(ctx context.Context, pkg *opkgFeedPackage, dst string) error {
+	var digest hash.Hash
+	var expectedDigest string
+
+	switch {
+	case pkg.SHA256Sum != "":
+		digest, expectedDigest = sha256.New(), pkg.SHA256Sum
+	case pkg.MD5Sum != "":
+		digest, expectedDigest = md5.New(), pkg.MD5Sum
+	default:
+		return fmt.Errorf("no checksum for package %s in the feed package list", pkg.URL)
+	}
+
+	parsedURL, err := url.Parse(pkg.URL)
+	if err != nil {
+		return fmt.Errorf("invalid package URL %s: %w", pkg.URL, err)
+	}
+
+	var src io.ReadCloser
+
+	switch parsedURL.Scheme {
+	case "file":
+		if src, err = os.Open(parsedURL.Path); err != nil {
+			return fmt.Errorf("error opening package file %s: %w", parsedURL.Path, err)
+		}
+	case "http", "https":
+		var request *http.Request
+		if request, err = http.NewRequestWithContext(ctx, http.MethodGet, pkg.URL, nil); err != nil {
+			return fmt.Errorf("error preparing package download request: %w", err)
+		}
+
+		var response *http.Response
+		if response, err = opkgHTTPClient.Do(request); err != nil {
+			return fmt.Errorf("error downloading package %s: %w", pkg.URL, err)
+		}
+
+		if response.StatusCode != http.StatusOK {
+			response.Body.Close()
+			return fmt.Errorf("error downloading package %s: unexpected status %s", pkg.URL, response.Status)
+		}
+
+		src = response.Body
+	default:
+		return fmt.Errorf("unsupported package URL scheme: %s", parsedURL.Scheme)
+	}
+	defer src.Close()
+
+	dstFile, err := os.Create(dst)
+	if err != nil {
+		return fmt.Errorf("error creating package file %s: %w", dst, err)
+	}
+	defer dstFile.Close()
+
+	if _, err = io.Copy(io.MultiWriter(dstFile, digest), src); err != nil {
+		return fmt.Errorf("error writing package file %s: %w", dst, err)
+	}
+
+	if actualDigest := hex.EncodeToString(digest.Sum(nil)); actualDigest != expectedDigest {
+		return fmt.Errorf("checksum mismatch for package %s: expected %s, got %s", pkg.URL, expectedDigest, actualDigest)
+	}
+
+	return nil
+}
@@ -0,0 +1,184 @@
+// Copyright 2023 qbee.io
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package software
+
+import (
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"go.qbee.io/agent/app/log"
+	"go.qbee.io/agent/app/utils"
+	"go.qbee.io/agent/app/utils/cache"
+)
+
+const (
+	pkgCacheDirectoryMode = 0700
+	pkgCacheFileMode      = 0600
+)
+
+// pkgCacheDirectory is the directory where package lists are persisted (persistence is disabled when empty).
+var pkgCacheDirectory string
+var pkgCacheDirectoryLock sync.Mutex
+
+// SetPackageCacheDirectory enables persisting package lists in the provided directory,
+// so they remain cached (within pkgCacheTTL) across agent restarts.
+func SetPackageCacheDirectory(directory string) {
+	pkgCacheDirectoryLock.Lock()
+	defer pkgCacheDirectoryLock.Unlock()
+
+	pkgCacheDirectory = directory
+}
+
+// packageCacheFile is the cached package list.
+type packageCacheFile struct {
+	// Expires - Unix timestamp when the package list expires.
+	Expires int64 `json:"expires"`
+
+	// DatabaseModTime - modification time (Unix nanoseconds) of the package database when the list was cached.
+	DatabaseModTime int64 `json:"database_mod_time"`
+
+	// Packages - cached package list.
+	Packages []Package `json:"packages"`
+}
+
+// packageCacheFilePath returns path of the file persisting package list for the cache key.
+// Returns an empty string when persistence is disabled.
+func packageCacheFilePath(key string) string {
+	pkgCacheDirectoryLock.Lock()
+	defer pkgCacheDirectoryLock.Unlock()
+
+	if pkgCacheDirectory == "" {
+		return ""
+	}
+
+	return filepath.Join(pkgCacheDirectory, strings.ReplaceAll(key, ":", "-")+".json")
+}
+
+// packageDatabaseModTime returns the latest modification time (Unix nanoseconds) of the package database files.
+// Missing files are ignored, so 0 is returned when none of them exists.
+func packageDatabaseModTime(databasePaths []string) int64 {
+	var modTime int64
+
+	for _, path := range databasePaths {
+		fileInfo, err := os.Stat(path)
+		if err != nil {
+			continue
+		}
+
+		if fileModTime := fileInfo.ModTime().UnixNano(); fileModTime > modTime {
+			modTime = fileModTime
+		}
+	}
+
+	return modTime
+}
+
+// getCachedPackages returns cached package list from memory or - when persistence is enabled - from disk.
+// Cached list is discarded when the package database was modified since (e.g. by a package installed manually).
+// Package managers call it while holding their lock, so cache is not updated concurrently.
+func getCachedPackages(key string, databasePaths []string) ([]Package, bool) {
+	databaseModTime := packageDatabaseModTime(databasePaths)
+
+	if cachedPackages, ok := cache.Get(key); ok {
+		if cacheFile := cachedPackages.(*packageCacheFile); cacheFile.DatabaseModTime == databaseModTime {
+			return cacheFile.Packages, true
+		}
+
+		invalidateCachedPackages(key)
+		return nil, false
+	}
+
+	filePath := packageCacheFilePath(key)
+	if filePath == "" {
+		return nil, false
+	}
+
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		if !errors.Is(err, fs.ErrNotExist) {
+			log.Warnf("failed to read package cache %s: %v", filePath, err)
+		}
+		return nil, false
+	}
+
+	cacheFile := new(packageCacheFile)
+	if err = json.Unmarshal(data, cacheFile); err != nil {
+		log.Warnf("failed to parse package cache %s: %v", filePath, err)
+		return nil, false
+	}
+
+	ttl := time.Until(time.Unix(cacheFile.Expires, 0))
+	if ttl <= 0 || cacheFile.DatabaseModTime != databaseModTime {
+		return nil, false
+	}
+
+	cache.Set(key, cacheFile, ttl)
+
+	return cacheFile.Packages, true
+}
+
+// setCachedPackages caches package list in memory and - when persistence is enabled - on disk.
+func setCachedPackages(key string, databasePaths []string, packages []Package) {
+	cacheFile := &packageCacheFile{
+		Expires:         time.Now().Add(pkgCacheTTL).Unix(),
+		DatabaseModTime: packageDatabaseModTime(databasePaths),
+		Packages:        packages,
+	}
+
+	cache.Set(key, cacheFile, pkgCacheTTL)
+
+	filePath := packageCacheFilePath(key)
+	if filePath == "" {
+		return
+	}
+
+	data, err := json.Marshal(cacheFile)
+	if err != nil {
+		log.Warnf("failed to encode package cache: %v", err)
+		return
+	}
+
+	if err = os.MkdirAll(filepath.Dir(filePath), pkgCacheDirectoryMode); err != nil {
+		log.Warnf("failed to create package cache directory: %v", err)
+		return
+	}
+
+	if err = utils.WriteFileSync(filePath, data, pkgCacheFileMode); err != nil {
+		log.Warnf("failed to write package cache %s: %v", filePath, err)
+	}
+}
+
+// invalidateCachedPackages removes package list from memory and disk cache.
+// It's called after any operation which might have changed installed packages or available updates.
+func invalidateCachedPackages(key string) {
+	cache.Delete(key)
+
+	filePath := packageCacheFilePath(key)
+	if filePath == "" {
+		return
+	}
+
+	if err := os.Remove(filePath); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		log.Warnf("failed to remove package cache %s: %v", filePath, err)
+	}
+}
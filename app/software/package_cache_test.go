@@ -0,0 +1,111 @@
+// Copyright 2023 qbee.io
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package software
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"go.qbee.io/agent/app/utils/assert"
+	"go.qbee.io/agent/app/utils/cache"
+)
+
+func TestPackageCache_Persisted(t *testing.T) {
+	SetPackageCacheDirectory(t.TempDir())
+	defer SetPackageCacheDirectory("")
+
+	const key = "packages:test:packages"
+	packages := []Package{{Name: "curl", Version: "7.88.1", Architecture: "amd64", Update: "7.88.2"}}
+
+	setCachedPackages(key, nil, packages)
+
+	// simulate agent restart by clearing the in-memory cache
+	cache.Delete(key)
+
+	cachedPackages, ok := getCachedPackages(key, nil)
+	assert.True(t, ok)
+	assert.Equal(t, cachedPackages, packages)
+
+	// invalidation removes the persisted list as well
+	invalidateCachedPackages(key)
+
+	_, ok = getCachedPackages(key, nil)
+	assert.False(t, ok)
+
+	_, err := os.Stat(packageCacheFilePath(key))
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestPackageCache_Expired(t *testing.T) {
+	SetPackageCacheDirectory(t.TempDir())
+	defer SetPackageCacheDirectory("")
+
+	const key = "packages:test:expired"
+
+	data, err := json.Marshal(packageCacheFile{
+		Expires:  time.Now().Add(-time.Minute).Unix(),
+		Packages: []Package{{Name: "curl", Version: "7.88.1"}},
+	})
+	assert.NoError(t, err)
+	assert.NoError(t, os.WriteFile(packageCacheFilePath(key), data, pkgCacheFileMode))
+
+	_, ok := getCachedPackages(key, nil)
+	assert.False(t, ok)
+}
+
+func TestPackageCache_NotPersisted(t *testing.T) {
+	const key = "packages:test:memory"
+
+	setCachedPackages(key, nil, []Package{{Name: "curl"}})
+	defer invalidateCachedPackages(key)
+
+	assert.Equal(t, packageCacheFilePath(key), "")
+
+	_, ok := getCachedPackages(key, nil)
+	assert.True(t, ok)
+}
+
+func TestPackageCache_DatabaseModified(t *testing.T) {
+	SetPackageCacheDirectory(t.TempDir())
+	defer SetPackageCacheDirectory("")
+
+	const key = "packages:test:database"
+
+	databasePath := filepath.Join(t.TempDir(), "status")
+	databasePaths := []string{databasePath, filepath.Join(t.TempDir(), "missing")}
+	assert.NoError(t, os.WriteFile(databasePath, []byte("Package: curl\n"), 0600))
+
+	setCachedPackages(key, databasePaths, []Package{{Name: "curl"}})
+	defer invalidateCachedPackages(key)
+
+	_, ok := getCachedPackages(key, databasePaths)
+	assert.True(t, ok)
+
+	// simulate package installed outside the agent
+	modTime := time.Now().Add(time.Minute)
+	assert.NoError(t, os.Chtimes(databasePath, modTime, modTime))
+
+	_, ok = getCachedPackages(key, databasePaths)
+	assert.False(t, ok)
+
+	// persisted list is discarded as well
+	_, err := os.Stat(packageCacheFilePath(key))
+	assert.True(t, os.IsNotExist(err))
+}
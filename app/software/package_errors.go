@@ -0,0 +1,311 @@
+// Copyright 2023 qbee.io
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package software
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+
+	"go.qbee.io/agent/app/utils"
+)
+
+// Reasons of package failures (stable values, suitable for aggregation).
+const (
+	FailureReasonNotFound           = "not-found"
+	FailureReasonUnmetDependencies  = "unmet-dependencies"
+	FailureReasonHeldBrokenPackages = "held-broken-packages"
+	FailureReasonUnauthenticated    = "unauthenticated"
+	FailureReasonDownloadFailed     = "download-failed"
+	FailureReasonConflict           = "conflict"
+	FailureReasonInstallError       = "install-error"
+)
+
+// PackageFailure describes a package which failed to be installed or upgraded.
+type PackageFailure struct {
+	// Package name (empty when the failure is not related to a specific package).
+	Package string `json:"package"`
+
+	// Reason is one of FailureReason* values.
+	Reason string `json:"reason"`
+}
+
+// PackageError is returned by package managers when installation or upgrade fails,
+// listing failed packages parsed from the package manager output.
+type PackageError struct {
+	// Failures lists failed packages in order of appearance in the output.
+	Failures []PackageFailure
+
+	// Err is the error returned by the package manager command.
+	Err error
+}
+
+// Error returns the underlying error message.
+func (err *PackageError) Error() string {
+	return err.Err.Error()
+}
+
+// Unwrap returns the underlying error.
+func (err *PackageError) Unwrap() error {
+	return err.Err
+}
+
+// Summary returns a concise list of failed packages, e.g. "Failed packages: curl (not-found), libc6 (conflict)."
+func (err *PackageError) Summary() string {
+	failures := make([]string, len(err.Failures))
+	for i, failure := range err.Failures {
+		pkgName := failure.Package
+		if pkgName == "" {
+			pkgName = "*"
+		}
+
+		failures[i] = fmt.Sprintf("%s (%s)", pkgName, failure.Reason)
+	}
+
+	return fmt.Sprintf("Failed packages: %s.", strings.Join(failures, ", "))
+}
+
+// packageFailures collects failures, keeping only the first reason for each package.
+type packageFailures []PackageFailure
+
+// add failure unless the package has already failed.
+func (failures *packageFailures) add(pkgName, reason string) {
+	for _, failure := range *failures {
+		if failure.Package == pkgName {
+			return
+		}
+	}
+
+	*failures = append(*failures, PackageFailure{Package: pkgName, Reason: reason})
+}
+
+// failuresParser returns failed packages found in package manager output.
+type failuresParser func(output []byte) []PackageFailure
+
+// runPackageCommand runs package manager command using utils.RunCommand.
+// On failure, the error includes both stdout and stderr of the command (package managers report
+// dependency problems on stdout) and is a PackageError when failed packages are found in the output.
+func runPackageCommand(ctx context.Context, cmd []string, parseFailures failuresParser) ([]byte, error) {
+	output, err := utils.RunCommand(ctx, cmd)
+	if err == nil {
+		return output, nil
+	}
+
+	var cmdErr *utils.CommandError
+	if !errors.As(err, &cmdErr) {
+		return nil, err
+	}
+
+	output = append(cmdErr.Stdout, cmdErr.Stderr...)
+
+	return nil, newPackageError(fmt.Errorf("error running command %v: %w\n%s", cmd, cmdErr.Err, output), output, parseFailures)
+}
+
+// newPackageError returns PackageError with failed packages parsed from the output,
+// or unchanged err when no failed packages are found.
+func newPackageError(err error, output []byte, parseFailures failuresParser) error {
+	failures := parseFailures(output)
+	if len(failures) == 0 {
+		return err
+	}
+
+	return &PackageError{Failures: failures, Err: err}
+}
+
+var (
+	// e.g. " libfoo : Depends: libbar (>= 2) but it is not going to be installed"
+	aptUnmetDependencyRE = regexp.MustCompile(`^\s*(\S+)\s*:\s*(Pre)?Depends:`)
+
+	// e.g. "E: Unable to locate package foo" or "E: Version '1.2' for 'foo' was not found"
+	aptNotFoundRE = regexp.MustCompile(`^E: (?:Unable to locate package (\S+)|Version '[^']*' for '([^']+)' was not found)`)
+
+	// e.g. "E: Failed to fetch http://deb.debian.org/debian/pool/main/c/curl/curl_7.88_amd64.deb  404  Not Found"
+	aptFetchFailedRE = regexp.MustCompile(`^E: Failed to fetch (\S+)`)
+
+	// e.g. "dpkg: error processing package foo (--configure):" or "dpkg: error processing archive /tmp/foo.deb (--install):"
+	dpkgErrorRE = regexp.MustCompile(`^dpkg: error processing (?:package|archive) (\S+)`)
+)
+
+// parseAptFailures returns failed packages found in apt-get and dpkg output.
+func parseAptFailures(output []byte) []PackageFailure {
+	failures := make(packageFailures, 0)
+	heldBroken := false
+
+	// section defines which list of packages (one or more per line) is being parsed
+	section := ""
+
+	scanner := bufio.NewScanner(bytes.NewReader(output))
+	for scanner.Scan() {
+		line := scanner.Text()
+
+		if section != "" {
+			if strings.HasPrefix(line, " ") {
+				for _, pkgRef := range strings.Fields(line) {
+					failures.add(debPackageName(pkgRef), section)
+				}
+				continue
+			}
+
+			section = ""
+		}
+
+		switch {
+		case strings.HasPrefix(line, "WARNING: The following packages cannot be authenticated!"):
+			section = FailureReasonUnauthenticated
+		case strings.HasPrefix(line, "Errors were encountered while processing:"):
+			section = FailureReasonInstallError
+		case strings.Contains(line, "you have held broken packages"):
+			heldBroken = true
+		}
+
+		if match := aptUnmetDependencyRE.FindStringSubmatch(line); match != nil {
+			failures.add(match[1], FailureReasonUnmetDependencies)
+		} else if match = aptNotFoundRE.FindStringSubmatch(line); match != nil {
+			failures.add(match[1]+match[2], FailureReasonNotFound)
+		} else if match = aptFetchFailedRE.FindStringSubmatch(line); match != nil {
+			failures.add(debPackageName(match[1]), FailureReasonDownloadFailed)
+		} else if match = dpkgErrorRE.FindStringSubmatch(line); match != nil {
+			failures.add(debPackageName(match[1]), FailureReasonInstallError)
+		}
+	}
+
+	// held broken packages are reported as unmet dependencies of individual packages (if any are listed)
+	if heldBroken {
+		for i := range failures {
+			if failures[i].Reason == FailureReasonUnmetDependencies {
+				failures[i].Reason = FailureReasonHeldBrokenPackages
+			}
+		}
+
+		if len(failures) == 0 {
+			failures.add("", FailureReasonHeldBrokenPackages)
+		}
+	}
+
+	return failures
+}
+
+// debPackageName returns package name from a package file name or URL (e.g. ".../curl_7.88_amd64.deb" -> "curl").
+func debPackageName(pkgRef string) string {
+	pkgName := path.Base(pkgRef)
+	if !strings.HasSuffix(pkgName, ".deb") {
+		return pkgName
+	}
+
+	pkgName, _, _ = strings.Cut(pkgName, "_")
+
+	return pkgName
+}
+
+var (
+	// e.g. "No package foo available." (yum) or "No match for argument: foo" (dnf)
+	yumNotFoundRE = regexp.MustCompile(`^(?:No package (\S+) available|No match for argument: (\S+))`)
+
+	// e.g. "Error: Package: foo-1.2-1.el7.x86_64 (base)" (yum), followed by "Requires: ..."
+	yumRequiresRE = regexp.MustCompile(`^Error: Package: (\S+)`)
+
+	// e.g. "  - nothing provides libbar needed by foo-1.2-1.x86_64" (dnf)
+	dnfNothingProvidesRE = regexp.MustCompile(`nothing provides .* needed by (\S+)`)
+
+	// e.g. "Public key for foo-1.2-1.x86_64.rpm is not installed" or "Package foo-1.2-1.x86_64.rpm is not signed"
+	yumUnauthenticatedRE = regexp.MustCompile(`(?:Public key for (\S+) is not installed|Package (\S+) is not signed)`)
+
+	// e.g. "file /usr/bin/foo from install of foo-1.2-1.x86_64 conflicts with file from package bar-1.0-1.x86_64"
+	rpmConflictRE = regexp.MustCompile(`from install of (\S+) conflicts with`)
+)
+
+// parseYumFailures returns failed packages found in yum/dnf and rpm output.
+func parseYumFailures(output []byte) []PackageFailure {
+	failures := make(packageFailures, 0)
+
+	scanner := bufio.NewScanner(bytes.NewReader(output))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+
+		if match := yumNotFoundRE.FindStringSubmatch(line); match != nil {
+			failures.add(match[1]+match[2], FailureReasonNotFound)
+		} else if match = yumRequiresRE.FindStringSubmatch(line); match != nil {
+			failures.add(match[1], FailureReasonUnmetDependencies)
+		} else if match = dnfNothingProvidesRE.FindStringSubmatch(line); match != nil {
+			failures.add(match[1], FailureReasonUnmetDependencies)
+		} else if match = yumUnauthenticatedRE.FindStringSubmatch(line); match != nil {
+			failures.add(strings.TrimSuffix(match[1]+match[2], ".rpm"), FailureReasonUnauthenticated)
+		} else if match = rpmConflictRE.FindStringSubmatch(line); match != nil {
+			failures.add(match[1], FailureReasonConflict)
+		}
+	}
+
+	return failures
+}
+
+var (
+	// e.g. "Unknown package 'foo'."
+	opkgNotFoundRE = regexp.MustCompile(`Unknown package '([^']+)'`)
+
+	// e.g. " * satisfy_dependencies_for: Cannot satisfy the following dependencies for foo:"
+	opkgUnmetDependenciesRE = regexp.MustCompile(`Cannot satisfy the following dependencies for (\S+?):?$`)
+
+	// e.g. " * opkg_download: Failed to download http://downloads.openwrt.org/.../foo_1.2_mips.ipk, wget returned 8."
+	opkgDownloadFailedRE = regexp.MustCompile(`Failed to download (\S+?),?\s`)
+
+	// e.g. " * check_data_file_clashes: Package foo wants to install file /usr/bin/foo"
+	opkgConflictRE = regexp.MustCompile(`Package (\S+) wants to install file`)
+
+	// e.g. " * opkg_install_pkg: Failed to verify the signature of foo."
+	opkgSignatureRE = regexp.MustCompile(`Failed to verify the signature of (\S+?)\.?$`)
+)
+
+// parseOpkgFailures returns failed packages found in opkg output.
+func parseOpkgFailures(output []byte) []PackageFailure {
+	failures := make(packageFailures, 0)
+
+	scanner := bufio.NewScanner(bytes.NewReader(output))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+
+		if match := opkgNotFoundRE.FindStringSubmatch(line); match != nil {
+			failures.add(match[1], FailureReasonNotFound)
+		} else if match = opkgUnmetDependenciesRE.FindStringSubmatch(line); match != nil {
+			failures.add(match[1], FailureReasonUnmetDependencies)
+		} else if match = opkgDownloadFailedRE.FindStringSubmatch(line + " "); match != nil {
+			failures.add(opkgPackageName(match[1]), FailureReasonDownloadFailed)
+		} else if match = opkgConflictRE.FindStringSubmatch(line); match != nil {
+			failures.add(match[1], FailureReasonConflict)
+		} else if match = opkgSignatureRE.FindStringSubmatch(line); match != nil {
+			failures.add(match[1], FailureReasonUnauthenticated)
+		}
+	}
+
+	return failures
+}
+
+// opkgPackageName returns package name from a package file name or URL (e.g. ".../foo_1.2_mips.ipk" -> "foo").
+func opkgPackageName(pkgRef string) string {
+	pkgName := path.Base(pkgRef)
+	if !strings.HasSuffix(pkgName, ".ipk") {
+		return pkgName
+	}
+
+	pkgName, _, _ = strings.Cut(pkgName, "_")
+
+	return pkgName
+}
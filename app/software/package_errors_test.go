@@ -0,0 +1,279 @@
+// Copyright 2023 qbee.io
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package software
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func Test_parseAptFailures(t *testing.T) {
+	tests := []struct {
+		name   string
+		output string
+		want   []PackageFailure
+	}{
+		{
+			name: "unmet dependencies with held broken packages",
+			output: `Some packages could not be installed. This may mean that you have
+requested an impossible situation or if you are using the unstable
+distribution that some required packages have not yet been created
+or been moved out of Incoming.
+The following information may help to resolve the situation:
+
+The following packages have unmet dependencies:
+ foo : Depends: libbar (>= 2.0) but it is not going to be installed
+       Depends: libbaz but it is not installable
+ qux : PreDepends: dpkg (>= 1.20)
+E: Unable to correct problems, you have held broken packages.
+`,
+			want: []PackageFailure{
+				{Package: "foo", Reason: FailureReasonHeldBrokenPackages},
+				{Package: "qux", Reason: FailureReasonHeldBrokenPackages},
+			},
+		},
+		{
+			name: "held broken packages without package list",
+			output: `E: Unable to correct problems, you have held broken packages.
+`,
+			want: []PackageFailure{
+				{Package: "", Reason: FailureReasonHeldBrokenPackages},
+			},
+		},
+		{
+			name: "not found",
+			output: `Reading package lists...
+E: Unable to locate package foo
+E: Version '1.2.3' for 'bar' was not found
+`,
+			want: []PackageFailure{
+				{Package: "foo", Reason: FailureReasonNotFound},
+				{Package: "bar", Reason: FailureReasonNotFound},
+			},
+		},
+		{
+			name: "unauthenticated",
+			output: `WARNING: The following packages cannot be authenticated!
+  foo bar
+E: There were unauthenticated packages and -y was used without --allow-unauthenticated
+`,
+			want: []PackageFailure{
+				{Package: "foo", Reason: FailureReasonUnauthenticated},
+				{Package: "bar", Reason: FailureReasonUnauthenticated},
+			},
+		},
+		{
+			name: "download failed",
+			output: `E: Failed to fetch http://deb.debian.org/debian/pool/main/c/curl/curl_7.88.1-10_amd64.deb  404  Not Found [IP: 151.101.2.132 80]
+E: Unable to fetch some archives, maybe run apt-get update or try with --fix-missing?
+`,
+			want: []PackageFailure{
+				{Package: "curl", Reason: FailureReasonDownloadFailed},
+			},
+		},
+		{
+			name: "dpkg errors",
+			output: `dpkg: error processing archive /tmp/qbee-test_1.0.0_all.deb (--install):
+ trying to overwrite '/usr/bin/qbee-test', which is also in package other 1.0
+dpkg: error processing package foo (--configure):
+ installed foo package post-installation script subprocess returned error exit status 1
+Errors were encountered while processing:
+ /tmp/qbee-test_1.0.0_all.deb
+ foo
+ bar
+`,
+			want: []PackageFailure{
+				{Package: "qbee-test", Reason: FailureReasonInstallError},
+				{Package: "foo", Reason: FailureReasonInstallError},
+				{Package: "bar", Reason: FailureReasonInstallError},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := parseAptFailures([]byte(tt.output)); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseAptFailures() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_parseYumFailures(t *testing.T) {
+	tests := []struct {
+		name   string
+		output string
+		want   []PackageFailure
+	}{
+		{
+			name: "yum not found",
+			output: `No package foo available.
+Error: Nothing to do
+`,
+			want: []PackageFailure{
+				{Package: "foo", Reason: FailureReasonNotFound},
+			},
+		},
+		{
+			name: "dnf not found",
+			output: `No match for argument: foo
+Error: Unable to find a match: foo
+`,
+			want: []PackageFailure{
+				{Package: "foo", Reason: FailureReasonNotFound},
+			},
+		},
+		{
+			name: "yum requires",
+			output: `Error: Package: foo-1.2-1.el7.x86_64 (base)
+           Requires: libbar.so.2()(64bit)
+ You could try using --skip-broken to work around the problem
+`,
+			want: []PackageFailure{
+				{Package: "foo-1.2-1.el7.x86_64", Reason: FailureReasonUnmetDependencies},
+			},
+		},
+		{
+			name: "dnf nothing provides",
+			output: `Error: 
+ Problem: cannot install the best candidate for the job
+  - nothing provides libbar >= 2 needed by foo-1.2-1.x86_64
+`,
+			want: []PackageFailure{
+				{Package: "foo-1.2-1.x86_64", Reason: FailureReasonUnmetDependencies},
+			},
+		},
+		{
+			name: "unauthenticated",
+			output: `Public key for foo-1.2-1.x86_64.rpm is not installed
+Package bar-1.0-1.noarch.rpm is not signed
+`,
+			want: []PackageFailure{
+				{Package: "foo-1.2-1.x86_64", Reason: FailureReasonUnauthenticated},
+				{Package: "bar-1.0-1.noarch", Reason: FailureReasonUnauthenticated},
+			},
+		},
+		{
+			name: "file conflict",
+			output: `Transaction check error:
+  file /usr/bin/qbee-test from install of qbee-test-conflicts-1.0.0-1.noarch conflicts with file from package qbee-test-1.0.0-1.noarch
+`,
+			want: []PackageFailure{
+				{Package: "qbee-test-conflicts-1.0.0-1.noarch", Reason: FailureReasonConflict},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := parseYumFailures([]byte(tt.output)); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseYumFailures() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_parseOpkgFailures(t *testing.T) {
+	tests := []struct {
+		name   string
+		output string
+		want   []PackageFailure
+	}{
+		{
+			name: "not found",
+			output: `Unknown package 'foo'.
+Collected errors:
+ * opkg_install_cmd: Cannot install package foo.
+`,
+			want: []PackageFailure{
+				{Package: "foo", Reason: FailureReasonNotFound},
+			},
+		},
+		{
+			name: "unmet dependencies",
+			output: `Collected errors:
+ * satisfy_dependencies_for: Cannot satisfy the following dependencies for foo:
+ * 	libbar (>= 2.0)
+`,
+			want: []PackageFailure{
+				{Package: "foo", Reason: FailureReasonUnmetDependencies},
+			},
+		},
+		{
+			name: "download failed",
+			output: `Collected errors:
+ * opkg_download: Failed to download https://downloads.openwrt.org/packages/foo_1.2-1_mips_24kc.ipk, wget returned 8.
+`,
+			want: []PackageFailure{
+				{Package: "foo", Reason: FailureReasonDownloadFailed},
+			},
+		},
+		{
+			name: "file conflict",
+			output: `Collected errors:
+ * check_data_file_clashes: Package foo wants to install file /usr/bin/bar
+	But that file is already provided by package  * bar
+`,
+			want: []PackageFailure{
+				{Package: "foo", Reason: FailureReasonConflict},
+			},
+		},
+		{
+			name: "signature",
+			output: `Collected errors:
+ * opkg_install_pkg: Failed to verify the signature of foo.
+`,
+			want: []PackageFailure{
+				{Package: "foo", Reason: FailureReasonUnauthenticated},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := parseOpkgFailures([]byte(tt.output)); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseOpkgFailures() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_runPackageCommand(t *testing.T) {
+	script := `echo " foo : Depends: bar but it is not going to be installed"; echo "E: Unable to locate package baz" >&2; exit 100`
+
+	output, err := runPackageCommand(context.Background(), []string{"sh", "-c", script}, parseAptFailures)
+	if output != nil {
+		t.Errorf("runPackageCommand() output = %q, want nil", output)
+	}
+
+	var pkgErr *PackageError
+	if !errors.As(err, &pkgErr) {
+		t.Fatalf("runPackageCommand() error = %v, want PackageError", err)
+	}
+
+	wantSummary := "Failed packages: foo (unmet-dependencies), baz (not-found)."
+	if got := pkgErr.Summary(); got != wantSummary {
+		t.Errorf("Summary() = %q, want %q", got, wantSummary)
+	}
+
+	// raw output of both streams is kept in the error
+	for _, line := range []string{"foo : Depends: bar", "E: Unable to locate package baz"} {
+		if !strings.Contains(err.Error(), line) {
+			t.Errorf("error %q doesn't contain %q", err.Error(), line)
+		}
+	}
+}
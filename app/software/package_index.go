@@ -0,0 +1,54 @@
+// Copyright 2023 qbee.io
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package software
+
+// PackageIndex provides lookups of packages by name.
+// It should be used instead of linear scans when checking many packages against a large package list.
+type PackageIndex map[string][]Package
+
+// NewPackageIndex returns a PackageIndex built from the provided list of packages.
+func NewPackageIndex(packages []Package) PackageIndex {
+	index := make(PackageIndex, len(packages))
+
+	for _, pkg := range packages {
+		index[pkg.Name] = append(index[pkg.Name], pkg)
+	}
+
+	return index
+}
+
+// Has returns true if a package matching pkgInfo is present in the index.
+// When pkgInfo has no version set, only the name is matched.
+// Otherwise, version and architecture must match as well.
+func (index PackageIndex) Has(pkgInfo *Package) bool {
+	packages, ok := index[pkgInfo.Name]
+	if !ok {
+		return false
+	}
+
+	if pkgInfo.Version == "" {
+		return true
+	}
+
+	for _, pkg := range packages {
+		if pkg.Version == pkgInfo.Version && pkg.Architecture == pkgInfo.Architecture {
+			return true
+		}
+	}
+
+	return false
+}
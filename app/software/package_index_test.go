@@ -0,0 +1,83 @@
+// Copyright 2023 qbee.io
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package software
+
+import (
+	"fmt"
+	"testing"
+
+	"go.qbee.io/agent/app/utils/assert"
+)
+
+func TestPackageIndex_Has(t *testing.T) {
+	packages := make([]Package, 0, 50000)
+	for i := 0; i < 50000; i++ {
+		packages = append(packages, Package{
+			Name:         fmt.Sprintf("pkg-%d", i),
+			Version:      "1.0.0",
+			Architecture: "amd64",
+		})
+	}
+
+	// add a second architecture of the same package
+	packages = append(packages, Package{Name: "pkg-1", Version: "1.0.0", Architecture: "i386"})
+
+	index := NewPackageIndex(packages)
+
+	tests := []struct {
+		name string
+		pkg  *Package
+		want bool
+	}{
+		{
+			name: "name only",
+			pkg:  &Package{Name: "pkg-49999"},
+			want: true,
+		},
+		{
+			name: "name, version and architecture",
+			pkg:  &Package{Name: "pkg-100", Version: "1.0.0", Architecture: "amd64"},
+			want: true,
+		},
+		{
+			name: "secondary architecture",
+			pkg:  &Package{Name: "pkg-1", Version: "1.0.0", Architecture: "i386"},
+			want: true,
+		},
+		{
+			name: "different version",
+			pkg:  &Package{Name: "pkg-100", Version: "2.0.0", Architecture: "amd64"},
+			want: false,
+		},
+		{
+			name: "different architecture",
+			pkg:  &Package{Name: "pkg-100", Version: "1.0.0", Architecture: "arm64"},
+			want: false,
+		},
+		{
+			name: "not installed",
+			pkg:  &Package{Name: "pkg-50000"},
+			want: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, index.Has(tt.pkg), tt.want)
+		})
+	}
+}
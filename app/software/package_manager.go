@@ -28,6 +28,33 @@ var DefaultPackageManager PackageManager
 const pkgCacheTTL = 24 * time.Hour
 const pkgCacheKeyPrefix = "packages"
 
+const ctxAllowConflicts = contextKey("software:allow-conflicts")
+
+// WithConflictsAllowed returns context instructing InstallLocal to override conflicts with installed packages.
+func WithConflictsAllowed(ctx context.Context) context.Context {
+	return context.WithValue(ctx, ctxAllowConflicts, true)
+}
+
+// conflictsAllowed returns true if conflicts with installed packages should be overridden.
+func conflictsAllowed(ctx context.Context) bool {
+	allowed, _ := ctx.Value(ctxAllowConflicts).(bool)
+	return allowed
+}
+
+const ctxInstallRecommends = contextKey("software:install-recommends")
+
+// WithInstallRecommends returns context instructing package managers whether to install recommended packages
+// (weak dependencies) when installing or upgrading packages. Without it, the system default is used.
+func WithInstallRecommends(ctx context.Context, install bool) context.Context {
+	return context.WithValue(ctx, ctxInstallRecommends, install)
+}
+
+// installRecommends returns install recommends policy and whether it is set in the context.
+func installRecommends(ctx context.Context) (install bool, isSet bool) {
+	install, isSet = ctx.Value(ctxInstallRecommends).(bool)
+	return install, isSet
+}
+
 // PackageManagers provides a map of all package managers supported by the agent.
 var PackageManagers = map[PackageManagerType]PackageManager{
 	PackageManagerTypeDebian: new(DebianPackageManager),
@@ -45,6 +72,24 @@ func init() {
 	}
 }
 
+// RemoveOptions defines how packages are removed.
+type RemoveOptions struct {
+	// Purge removes also configuration files of the package (Debian only).
+	Purge bool
+
+	// AutoRemove removes also dependencies, which are no longer required by any installed package.
+	AutoRemove bool
+}
+
+// TransactionInstaller is implemented by package managers able to install multiple packages in a single transaction,
+// so dependencies are resolved once and either all packages are installed or none of them.
+type TransactionInstaller interface {
+	// InstallTransaction ensures packages with provided versions are installed in a single transaction.
+	// Package with empty version is installed in the latest version.
+	// Returns output of the installation command.
+	InstallTransaction(ctx context.Context, packages []Package) ([]byte, error)
+}
+
 // PackageManagerType defines package manager type.
 type PackageManagerType string
 
@@ -71,7 +116,13 @@ type PackageManager interface {
 	// Install ensures a package with provided version number is installed in the system.
 	Install(ctx context.Context, pkgName, version string) ([]byte, error)
 
+	// Remove ensures a package is not installed in the system.
+	// Packages required by other installed packages are not removed.
+	Remove(ctx context.Context, pkgName string, opts RemoveOptions) ([]byte, error)
+
 	// InstallLocal package.
+	// When context is created with WithConflictsAllowed, files owned by installed packages are overwritten.
+	// Declared package conflicts are always refused.
 	InstallLocal(ctx context.Context, pkgFilePath string) ([]byte, error)
 
 	// PackageArchitecture returns the architecture of the package manager
@@ -82,4 +133,14 @@ type PackageManager interface {
 
 	// ParsePackageFile returns a package from a file path.
 	ParsePackageFile(ctx context.Context, filePath string) (*Package, error)
+
+	// ConfigureRepositories ensures provided repositories (and their signing keys) are configured.
+	// Package index is refreshed only when any of the repositories was added or updated.
+	// Returns added/updated repositories and output of the package index refresh.
+	// When the refresh fails, repository files are restored, so it is retried on the next run.
+	ConfigureRepositories(ctx context.Context, repos []Repository) ([]RepositoryChange, []byte, error)
+
+	// RebootRequired returns true if the system signals that a reboot is required (e.g. after kernel update),
+	// together with the reason (e.g. packages which triggered it) when available.
+	RebootRequired(ctx context.Context) (bool, string, error)
 }
@@ -17,11 +17,15 @@
 package software
 
 import (
+	"bytes"
 	"context"
+	"errors"
 	"fmt"
 	"io"
+	"io/fs"
 	"os"
 	"os/exec"
+	"path/filepath"
 	"regexp"
 	"runtime"
 	"strings"
@@ -39,6 +43,9 @@ const debianFileSuffix string = ".deb"
 var debianPackagesCacheKey = fmt.Sprintf("%s:%s:packages", pkgCacheKeyPrefix, PackageManagerTypeDebian)
 var debianPkgArchCacheKey = fmt.Sprintf("%s:%s:arch", pkgCacheKeyPrefix, PackageManagerTypeDebian)
 
+// debianDatabasePaths are the dpkg status files.
+var debianDatabasePaths = []string{"/var/lib/dpkg/status"}
+
 const (
 	aptGetPath = "/usr/bin/apt-get"
 	dpkgPath   = "/usr/bin/dpkg"
@@ -47,6 +54,12 @@ const (
 	dpkgLockMode = 0640
 )
 
+// Files created by packages (e.g. kernel, libc) on Debian-based systems when a reboot is required.
+var (
+	debRebootRequiredPath     = "/var/run/reboot-required"
+	debRebootRequiredPkgsPath = "/var/run/reboot-required.pkgs"
+)
+
 // DebianPackageManager implements PackageManager interface for Debian-based systems.
 type DebianPackageManager struct {
 	supportsAllowDowngradesFlag bool
@@ -112,8 +125,8 @@ func (deb *DebianPackageManager) ListPackages(ctx context.Context) ([]Package, e
 	deb.lock.Lock()
 	defer deb.lock.Unlock()
 
-	if cachedPackages, ok := cache.Get(debianPackagesCacheKey); ok {
-		return cachedPackages.([]Package), nil
+	if cachedPackages, ok := getCachedPackages(debianPackagesCacheKey, debianDatabasePaths); ok {
+		return cachedPackages, nil
 	}
 
 	installedPackages, err := deb.listInstalledPackages(ctx)
@@ -131,7 +144,7 @@ func (deb *DebianPackageManager) ListPackages(ctx context.Context) ([]Package, e
 		installedPackages[i].Update = availableUpdates[pkg.ID()]
 	}
 
-	cache.Set(debianPackagesCacheKey, installedPackages, pkgCacheTTL)
+	setCachedPackages(debianPackagesCacheKey, debianDatabasePaths, installedPackages)
 
 	return installedPackages, nil
 }
@@ -173,10 +186,14 @@ func (deb *DebianPackageManager) listInstalledPackages(ctx context.Context) ([]P
 
 // listAvailableUpdates returns a map of pkgName:arch -> availableUpdateVersion for packages with available updates.
 func (deb *DebianPackageManager) listAvailableUpdates(ctx context.Context) (map[string]string, error) {
-	updateCmd := []string{aptGetPath, "update"}
+	if !skipIndexUpdate(ctx, PackageManagerTypeDebian) {
+		updateCmd := []string{aptGetPath, "update"}
 
-	if _, err := utils.RunCommand(ctx, updateCmd); err != nil {
-		return nil, err
+		if _, err := utils.RunCommand(ctx, updateCmd); err != nil {
+			return nil, err
+		}
+
+		markIndexUpdated(PackageManagerTypeDebian)
 	}
 
 	updates := make(map[string]string)
@@ -219,13 +236,99 @@ func (deb *DebianPackageManager) parseUpdateAvailableLine(line string) *Package
 	}
 }
 
-var aptGetBaseCommand = []string{
-	"DEBIAN_FRONTEND=noninteractive",
-	aptGetPath,
-	`-o Dpkg::Options::="--force-confdef"`,
-	`-o Dpkg::Options::="--force-confold"`,
-	"-f",
-	"-y",
+// DpkgConfigMode defines how dpkg resolves conflicts between modified and new package configuration files.
+type DpkgConfigMode string
+
+// Supported dpkg configuration file modes.
+const (
+	// DpkgConfigModeOld keeps the currently installed version of modified configuration files.
+	DpkgConfigModeOld DpkgConfigMode = "confold"
+
+	// DpkgConfigModeNew installs the package maintainer's version of modified configuration files.
+	DpkgConfigModeNew DpkgConfigMode = "confnew"
+)
+
+// AptOptions defines additional options for apt-get commands.
+type AptOptions struct {
+	// ConfigMode defines how configuration file conflicts are resolved (defaults to DpkgConfigModeOld).
+	ConfigMode DpkgConfigMode
+
+	// ExtraOptions are passed to apt-get as "-o <option>" (e.g. "Acquire::Retries=3").
+	ExtraOptions []string
+}
+
+// aptOptionRE matches apt configuration options in the Name::Sub=value format.
+// Values are restricted to characters which are safe to pass through the shell unquoted.
+var aptOptionRE = regexp.MustCompile(`^[A-Za-z][A-Za-z0-9_-]*(::[A-Za-z0-9_-]+)*=[A-Za-z0-9_.,:/+@-]*$`)
+
+// Validate returns an error if apt options are not supported.
+func (opts AptOptions) Validate() error {
+	switch opts.ConfigMode {
+	case "", DpkgConfigModeOld, DpkgConfigModeNew:
+	default:
+		return fmt.Errorf("unsupported dpkg config mode: %s", opts.ConfigMode)
+	}
+
+	for _, option := range opts.ExtraOptions {
+		if !aptOptionRE.MatchString(option) {
+			return fmt.Errorf("invalid apt option: %s", option)
+		}
+	}
+
+	return nil
+}
+
+type contextKey string
+
+const ctxAptOptions = contextKey("software:apt-options")
+
+// WithAptOptions returns context with apt options used by the Debian package manager.
+func WithAptOptions(ctx context.Context, opts AptOptions) context.Context {
+	return context.WithValue(ctx, ctxAptOptions, opts)
+}
+
+// aptGetCommand returns apt-get base command with options set in context.
+func aptGetCommand(ctx context.Context) []string {
+	opts, _ := ctx.Value(ctxAptOptions).(AptOptions)
+
+	configMode := opts.ConfigMode
+	if configMode == "" {
+		configMode = DpkgConfigModeOld
+	}
+
+	cmd := []string{
+		"DEBIAN_FRONTEND=noninteractive",
+		aptGetPath,
+		`-o Dpkg::Options::="--force-confdef"`,
+		fmt.Sprintf(`-o Dpkg::Options::="--force-%s"`, configMode),
+	}
+
+	for _, option := range opts.ExtraOptions {
+		cmd = append(cmd, "-o", option)
+	}
+
+	if install, isSet := installRecommends(ctx); isSet {
+		cmd = append(cmd, "-o", fmt.Sprintf("APT::Install-Recommends=%t", install))
+	}
+
+	return append(cmd, "-f", "-y")
+}
+
+// dpkgCommand returns non-interactive dpkg base command with configuration file mode set in context.
+func dpkgCommand(ctx context.Context) []string {
+	opts, _ := ctx.Value(ctxAptOptions).(AptOptions)
+
+	configMode := opts.ConfigMode
+	if configMode == "" {
+		configMode = DpkgConfigModeOld
+	}
+
+	return []string{
+		"DEBIAN_FRONTEND=noninteractive",
+		dpkgPath,
+		"--force-confdef",
+		fmt.Sprintf("--force-%s", configMode),
+	}
 }
 
 // UpgradeAll performs system upgrade if there are available upgrades.
@@ -253,19 +356,19 @@ func (deb *DebianPackageManager) UpgradeAll(ctx context.Context) (int, []byte, e
 	}
 
 	// perform system upgrade
-	upgradeCommand := append(aptGetBaseCommand, "upgrade")
-	distUpgradeCommand := append(aptGetBaseCommand, "dist-upgrade")
+	upgradeCommand := append(aptGetCommand(ctx), "upgrade")
+	distUpgradeCommand := append(aptGetCommand(ctx), "dist-upgrade")
 
 	cmd := append(append(upgradeCommand, "&&"), distUpgradeCommand...)
 
 	shellCmd := []string{"sh", "-c", strings.Join(cmd, " ")}
 
 	var output []byte
-	if output, err = utils.RunCommand(ctx, shellCmd); err != nil {
+	if output, err = runPackageCommand(ctx, shellCmd, parseAptFailures); err != nil {
 		return 0, output, err
 	}
 
-	cache.Delete(debianPackagesCacheKey)
+	invalidateCachedPackages(debianPackagesCacheKey)
 
 	return updatesAvailable, output, err
 }
@@ -274,11 +377,26 @@ func (deb *DebianPackageManager) UpgradeAll(ctx context.Context) (int, []byte, e
 // If version is empty, the latest version of the package is installed.
 // Returns output of the installation command.
 func (deb *DebianPackageManager) Install(ctx context.Context, pkgName, version string) ([]byte, error) {
+	return deb.InstallTransaction(ctx, []Package{{Name: pkgName, Version: version}})
+}
+
+// InstallTransaction ensures packages with provided versions are installed using a single apt-get command.
+func (deb *DebianPackageManager) InstallTransaction(ctx context.Context, packages []Package) ([]byte, error) {
 	deb.lock.Lock()
 	defer deb.lock.Unlock()
 
-	if version != "" {
-		pkgName = fmt.Sprintf("%s=%s", pkgName, version)
+	// apt-get refuses to install anything while packages are left unconfigured
+	recoveryOutput, err := deb.configurePending(ctx)
+	if err != nil {
+		return recoveryOutput, err
+	}
+
+	pkgSpecs := make([]string, len(packages))
+	for i, pkg := range packages {
+		pkgSpecs[i] = pkg.Name
+		if pkg.Version != "" {
+			pkgSpecs[i] = fmt.Sprintf("%s=%s", pkg.Name, pkg.Version)
+		}
 	}
 
 	var downgradesFlag string
@@ -288,13 +406,39 @@ func (deb *DebianPackageManager) Install(ctx context.Context, pkgName, version s
 		downgradesFlag = "--force-yes"
 	}
 
-	installCommand := append(aptGetBaseCommand, downgradesFlag, "install", pkgName)
+	installCommand := append(append(aptGetCommand(ctx), downgradesFlag, "install"), pkgSpecs...)
 
 	shellCmd := []string{"sh", "-c", strings.Join(installCommand, " ")}
 
-	defer cache.Delete(debianPackagesCacheKey)
+	defer invalidateCachedPackages(debianPackagesCacheKey)
+
+	output, err := runPackageCommand(ctx, shellCmd, parseAptFailures)
 
-	return utils.RunCommand(ctx, shellCmd)
+	return append(recoveryOutput, output...), err
+}
+
+// Remove package using dpkg, which refuses to remove packages required by other installed packages.
+// With AutoRemove, apt-get is used to remove also dependencies which are no longer required.
+func (deb *DebianPackageManager) Remove(ctx context.Context, pkgName string, opts RemoveOptions) ([]byte, error) {
+	deb.lock.Lock()
+	defer deb.lock.Unlock()
+
+	defer invalidateCachedPackages(debianPackagesCacheKey)
+
+	var removeCommand []string
+
+	switch {
+	case opts.AutoRemove && opts.Purge:
+		removeCommand = append(aptGetCommand(ctx), "--auto-remove", "purge", pkgName)
+	case opts.AutoRemove:
+		removeCommand = append(aptGetCommand(ctx), "--auto-remove", "remove", pkgName)
+	case opts.Purge:
+		removeCommand = append(dpkgCommand(ctx), "--purge", pkgName)
+	default:
+		removeCommand = append(dpkgCommand(ctx), "--remove", pkgName)
+	}
+
+	return utils.RunCommand(ctx, []string{"sh", "-c", strings.Join(removeCommand, " ")})
 }
 
 // InstallLocal package.
@@ -302,27 +446,122 @@ func (deb *DebianPackageManager) InstallLocal(ctx context.Context, pkgFilePath s
 	deb.lock.Lock()
 	defer deb.lock.Unlock()
 
-	defer cache.Delete(debianPackagesCacheKey)
+	defer invalidateCachedPackages(debianPackagesCacheKey)
+
+	// packages left unconfigured by a previous run need to be configured before installing new ones
+	recoveryOutput, err := deb.configurePending(ctx)
+	if err != nil {
+		return recoveryOutput, err
+	}
+
+	// only files owned by other packages are overwritten, since forcing past declared package conflicts
+	// leaves dpkg in a broken state, which is then resolved by removing one of the packages
+	installCommand := []string{dpkgPath}
+	if conflictsAllowed(ctx) {
+		installCommand = append(installCommand, "--force-overwrite")
+	}
+	installCommand = append(installCommand, "-i", pkgFilePath)
 
-	installCommand := []string{dpkgPath, "-i", pkgFilePath}
 	cmd := []string{"sh", "-c", strings.Join(installCommand, " ")}
-	dpkgOutput, err := utils.RunCommand(ctx, cmd)
+	dpkgOutput, err := runPackageCommand(ctx, cmd, parseAptFailures)
 
 	// dpkg succeeded, return
 	if err == nil {
-		return dpkgOutput, nil
+		return append(recoveryOutput, dpkgOutput...), nil
+	}
+
+	dpkgOutput = append(recoveryOutput, err.Error()+"\n"...)
+
+	// package might be left half-configured (e.g. failing postinst script), so retry its configuration.
+	// Packages with missing dependencies can't be configured yet, so failure is resolved by apt-get below.
+	recoveryOutput, err = deb.configurePending(ctx)
+	dpkgOutput = append(dpkgOutput, recoveryOutput...)
+	if err != nil {
+		dpkgOutput = append(dpkgOutput, err.Error()+"\n"...)
 	}
 
 	// dpkg fails, so we need to run "apt-get install -f" to install any possible dependencies
-	dpkgOutput = []byte(err.Error())
 
-	installCommand = append(aptGetBaseCommand, "install")
+	installCommand = append(aptGetCommand(ctx), "install")
 	cmd = []string{"sh", "-c", strings.Join(installCommand, " ")}
-	aptOutput, err := utils.RunCommand(ctx, cmd)
+	aptOutput, err := runPackageCommand(ctx, cmd, parseAptFailures)
 
 	return append(dpkgOutput, aptOutput...), err
 }
 
+// configurePending configures packages which were unpacked, but not (fully) configured,
+// e.g. due to a failing postinst script, missing dependencies or an interrupted dpkg run.
+// Returns recovery output, which is empty when no packages needed configuration.
+func (deb *DebianPackageManager) configurePending(ctx context.Context) ([]byte, error) {
+	// dpkg --audit lists packages in inconsistent state and exits with 0 regardless of the result
+	auditOutput, err := utils.RunCommand(ctx, []string{dpkgPath, "--audit"})
+	if err != nil {
+		return nil, fmt.Errorf("error checking dpkg database: %w", err)
+	}
+
+	auditOutput = bytes.TrimSpace(auditOutput)
+	if len(auditOutput) == 0 {
+		return nil, nil
+	}
+
+	recoveryOutput := []byte(fmt.Sprintf("Recovering packages left unconfigured:\n%s\n", auditOutput))
+
+	configureCommand := append(dpkgCommand(ctx), "--configure", "--pending")
+	cmd := []string{"sh", "-c", strings.Join(configureCommand, " ")}
+
+	output, err := utils.RunCommand(ctx, cmd)
+	if err == nil {
+		return append(recoveryOutput, output...), nil
+	}
+
+	recoveryOutput = append(recoveryOutput, err.Error()+"\n"...)
+
+	// packages unpacked without their dependencies can't be configured by dpkg,
+	// so let apt-get install the missing dependencies and finish the configuration
+	fixCommand := append(aptGetCommand(ctx), "install")
+	cmd = []string{"sh", "-c", strings.Join(fixCommand, " ")}
+
+	if output, err = utils.RunCommand(ctx, cmd); err != nil {
+		return append(recoveryOutput, err.Error()...), fmt.Errorf("error configuring pending packages: %w", err)
+	}
+
+	return append(recoveryOutput, output...), nil
+}
+
+// RebootRequired returns true if /var/run/reboot-required exists.
+// Reason lists packages from /var/run/reboot-required.pkgs which requested the reboot.
+func (deb *DebianPackageManager) RebootRequired(_ context.Context) (bool, string, error) {
+	if _, err := os.Stat(debRebootRequiredPath); err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return false, "", nil
+		}
+
+		return false, "", fmt.Errorf("cannot check %s: %w", debRebootRequiredPath, err)
+	}
+
+	pkgsData, err := os.ReadFile(debRebootRequiredPkgsPath)
+	if err != nil {
+		// packages list is optional
+		return true, "", nil
+	}
+
+	pkgs := make([]string, 0)
+	seen := make(map[string]bool)
+
+	for _, pkg := range strings.Fields(string(pkgsData)) {
+		if !seen[pkg] {
+			seen[pkg] = true
+			pkgs = append(pkgs, pkg)
+		}
+	}
+
+	if len(pkgs) == 0 {
+		return true, "", nil
+	}
+
+	return true, fmt.Sprintf("Reboot required by packages: %s", strings.Join(pkgs, ", ")), nil
+}
+
 // PackageArchitecture returns the architecture of the package manager
 func (deb *DebianPackageManager) PackageArchitecture() (string, error) {
 
@@ -392,3 +631,57 @@ func (deb *DebianPackageManager) IsSupportedArchitecture(arch string) error {
 
 	return fmt.Errorf("architecture %s is not supported by the system", arch)
 }
+
+const (
+	aptSourcesDir  = "/etc/apt/sources.list.d"
+	aptKeyringsDir = "/etc/apt/keyrings"
+)
+
+// renderAptRepository returns apt source list file and signing key file for the repository.
+func renderAptRepository(repo Repository) ([]repositoryFile, error) {
+	if repo.Distribution == "" {
+		return nil, fmt.Errorf("distribution is required for repository %s", repo.Name)
+	}
+
+	source := []string{"deb"}
+	files := make([]repositoryFile, 1)
+
+	if repo.SigningKey != "" {
+		keyPath := filepath.Join(aptKeyringsDir, repo.fileName(".asc"))
+		source = append(source, fmt.Sprintf("[signed-by=%s]", keyPath))
+		files = append(files, repositoryFile{path: keyPath, content: signingKeyContent(repo.SigningKey)})
+	}
+
+	source = append(source, repo.URL, repo.Distribution)
+	source = append(source, repo.Components...)
+
+	files[0] = repositoryFile{
+		path:    filepath.Join(aptSourcesDir, repo.fileName(".list")),
+		content: []byte(strings.Join(source, " ") + "\n"),
+	}
+
+	return files, nil
+}
+
+// ConfigureRepositories ensures provided apt repositories are configured and runs apt-get update on changes.
+func (deb *DebianPackageManager) ConfigureRepositories(
+	ctx context.Context,
+	repos []Repository,
+) ([]RepositoryChange, []byte, error) {
+	deb.lock.Lock()
+	defer deb.lock.Unlock()
+
+	changes, backup, err := configureRepositories(repos, renderAptRepository)
+	if err != nil || len(changes) == 0 {
+		return changes, nil, err
+	}
+
+	defer invalidateCachedPackages(debianPackagesCacheKey)
+
+	output, err := utils.RunCommand(ctx, []string{aptGetPath, "update"})
+	if err != nil {
+		return nil, output, restoreRepositories(backup, fmt.Errorf("error updating package index: %w", err))
+	}
+
+	return changes, output, nil
+}
@@ -18,6 +18,7 @@ package software
 
 import (
 	"context"
+	"os"
 	"os/exec"
 	"path/filepath"
 	"reflect"
@@ -112,3 +113,144 @@ func TestParseDebianPackage(t *testing.T) {
 		t.Fatalf("expected %v, got %v", expectedPkg, pkgInfo)
 	}
 }
+
+func TestAptOptions_Validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		opts    AptOptions
+		wantErr bool
+	}{
+		{name: "defaults", opts: AptOptions{}},
+		{name: "confnew", opts: AptOptions{ConfigMode: DpkgConfigModeNew}},
+		{name: "unsupported mode", opts: AptOptions{ConfigMode: "confmiss"}, wantErr: true},
+		{name: "valid option", opts: AptOptions{ExtraOptions: []string{"Acquire::Retries=3", "APT::Get::Fix-Missing=true"}}},
+		{name: "missing value separator", opts: AptOptions{ExtraOptions: []string{"Acquire::Retries"}}, wantErr: true},
+		{name: "shell injection", opts: AptOptions{ExtraOptions: []string{"Acquire::Retries=3;reboot"}}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.opts.Validate(); (err != nil) != tt.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func Test_aptGetCommand(t *testing.T) {
+	want := []string{
+		"DEBIAN_FRONTEND=noninteractive",
+		aptGetPath,
+		`-o Dpkg::Options::="--force-confdef"`,
+		`-o Dpkg::Options::="--force-confold"`,
+		"-f",
+		"-y",
+	}
+
+	if got := aptGetCommand(context.Background()); !reflect.DeepEqual(got, want) {
+		t.Errorf("aptGetCommand() = %v, want %v", got, want)
+	}
+
+	ctx := WithAptOptions(context.Background(), AptOptions{
+		ConfigMode:   DpkgConfigModeNew,
+		ExtraOptions: []string{"Acquire::Retries=3"},
+	})
+
+	want = []string{
+		"DEBIAN_FRONTEND=noninteractive",
+		aptGetPath,
+		`-o Dpkg::Options::="--force-confdef"`,
+		`-o Dpkg::Options::="--force-confnew"`,
+		"-o",
+		"Acquire::Retries=3",
+		"-f",
+		"-y",
+	}
+
+	if got := aptGetCommand(ctx); !reflect.DeepEqual(got, want) {
+		t.Errorf("aptGetCommand() = %v, want %v", got, want)
+	}
+
+	ctx = WithInstallRecommends(context.Background(), false)
+
+	want = []string{
+		"DEBIAN_FRONTEND=noninteractive",
+		aptGetPath,
+		`-o Dpkg::Options::="--force-confdef"`,
+		`-o Dpkg::Options::="--force-confold"`,
+		"-o",
+		"APT::Install-Recommends=false",
+		"-f",
+		"-y",
+	}
+
+	if got := aptGetCommand(ctx); !reflect.DeepEqual(got, want) {
+		t.Errorf("aptGetCommand() = %v, want %v", got, want)
+	}
+}
+
+func Test_dpkgCommand(t *testing.T) {
+	want := []string{
+		"DEBIAN_FRONTEND=noninteractive",
+		dpkgPath,
+		"--force-confdef",
+		"--force-confold",
+	}
+
+	if got := dpkgCommand(context.Background()); !reflect.DeepEqual(got, want) {
+		t.Errorf("dpkgCommand() = %v, want %v", got, want)
+	}
+
+	ctx := WithAptOptions(context.Background(), AptOptions{ConfigMode: DpkgConfigModeNew})
+
+	want = []string{
+		"DEBIAN_FRONTEND=noninteractive",
+		dpkgPath,
+		"--force-confdef",
+		"--force-confnew",
+	}
+
+	if got := dpkgCommand(ctx); !reflect.DeepEqual(got, want) {
+		t.Errorf("dpkgCommand() = %v, want %v", got, want)
+	}
+}
+
+func TestDebPackageManager_RebootRequired(t *testing.T) {
+	dir := t.TempDir()
+
+	originalPath, originalPkgsPath := debRebootRequiredPath, debRebootRequiredPkgsPath
+	debRebootRequiredPath = filepath.Join(dir, "reboot-required")
+	debRebootRequiredPkgsPath = filepath.Join(dir, "reboot-required.pkgs")
+	defer func() {
+		debRebootRequiredPath, debRebootRequiredPkgsPath = originalPath, originalPkgsPath
+	}()
+
+	deb := new(DebianPackageManager)
+
+	checkRebootRequired := func(wantRequired bool, wantReason string) {
+		t.Helper()
+
+		required, reason, err := deb.RebootRequired(context.Background())
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		if required != wantRequired || reason != wantReason {
+			t.Errorf("RebootRequired() = %v, %q, want %v, %q", required, reason, wantRequired, wantReason)
+		}
+	}
+
+	checkRebootRequired(false, "")
+
+	if err := os.WriteFile(debRebootRequiredPath, []byte("*** System restart required ***\n"), 0644); err != nil {
+		t.Fatalf("cannot create file: %v", err)
+	}
+
+	checkRebootRequired(true, "")
+
+	if err := os.WriteFile(debRebootRequiredPkgsPath, []byte("linux-image-amd64\nlibc6\nlinux-image-amd64\n"), 0644); err != nil {
+		t.Fatalf("cannot create file: %v", err)
+	}
+
+	checkRebootRequired(true, "Reboot required by packages: linux-image-amd64, libc6")
+}
@@ -23,6 +23,7 @@ import (
 	"io"
 	"os"
 	"os/exec"
+	"path"
 	"path/filepath"
 	"regexp"
 	"runtime"
@@ -41,6 +42,9 @@ const opkgFileSuffix string = ".ipk"
 var opkgPackagesCacheKey = fmt.Sprintf("%s:%s:packages", pkgCacheKeyPrefix, PackageManagerTypeOpkg)
 var opkgPkgArchCacheKey = fmt.Sprintf("%s:%s:arch", pkgCacheKeyPrefix, PackageManagerTypeOpkg)
 
+// opkgDatabasePaths are the opkg status files (depending on the distribution).
+var opkgDatabasePaths = []string{"/usr/lib/opkg/status", "/var/lib/opkg/status"}
+
 const (
 	opkgLockPath = "/var/lock/opkg.lock"
 	opkgLockMode = 0640
@@ -110,8 +114,8 @@ func (opkg *OpkgPackageManager) ListPackages(ctx context.Context) ([]Package, er
 	opkg.lock.Lock()
 	defer opkg.lock.Unlock()
 
-	if cachedPackages, ok := cache.Get(opkgPackagesCacheKey); ok {
-		return cachedPackages.([]Package), nil
+	if cachedPackages, ok := getCachedPackages(opkgPackagesCacheKey, opkgDatabasePaths); ok {
+		return cachedPackages, nil
 	}
 
 	installedPackages, err := opkg.listInstalledPackages(ctx)
@@ -132,17 +136,21 @@ func (opkg *OpkgPackageManager) ListPackages(ctx context.Context) ([]Package, er
 		}
 	}
 
-	cache.Set(opkgPackagesCacheKey, installedPackages, pkgCacheTTL)
+	setCachedPackages(opkgPackagesCacheKey, opkgDatabasePaths, installedPackages)
 
 	return installedPackages, nil
 }
 
 func (opkg *OpkgPackageManager) listAvailableUpdates(ctx context.Context) (map[string]string, error) {
 
-	updateCmd := []string{opkgCmd, "update"}
+	if !skipIndexUpdate(ctx, PackageManagerTypeOpkg) {
+		updateCmd := []string{opkgCmd, "update"}
 
-	if _, err := utils.RunCommand(ctx, updateCmd); err != nil {
-		return nil, err
+		if _, err := utils.RunCommand(ctx, updateCmd); err != nil {
+			return nil, err
+		}
+
+		markIndexUpdated(PackageManagerTypeOpkg)
 	}
 
 	cmd := []string{opkgCmd, "list-upgradable"}
@@ -322,14 +330,14 @@ func (opkg *OpkgPackageManager) UpgradeAll(ctx context.Context) (int, []byte, er
 	var output []byte
 
 	for _, cmd := range cmdList {
-		tmpOut, err := utils.RunCommand(ctx, cmd)
+		tmpOut, err := runPackageCommand(ctx, cmd, parseOpkgFailures)
 		output = append(output, tmpOut...)
 		if err != nil {
 			return 0, output, fmt.Errorf("error upgrading packages: %w", err)
 		}
 	}
 
-	cache.Delete(opkgPackagesCacheKey)
+	invalidateCachedPackages(opkgPackagesCacheKey)
 
 	return len(cmdList), output, nil
 }
@@ -339,12 +347,57 @@ func (opkg *OpkgPackageManager) Install(ctx context.Context, pkgName, version st
 	opkg.lock.Lock()
 	defer opkg.lock.Unlock()
 
-	cmd := []string{opkgCmd, "install", pkgName}
 	if version != "" {
-		return nil, fmt.Errorf("installing specific package versions is not supported by opkg")
+		return opkg.installVersion(ctx, pkgName, version)
+	}
+
+	cmd := []string{opkgCmd, "install", pkgName}
+
+	defer invalidateCachedPackages(opkgPackagesCacheKey)
+
+	return runPackageCommand(ctx, cmd, parseOpkgFailures)
+}
+
+// installVersion installs a specific version of a package by downloading it from a configured feed.
+// opkg always installs the best candidate from its feeds, so the requested version is resolved from
+// the feed package lists (the same lists used by `opkg list`), downloaded and installed locally.
+func (opkg *OpkgPackageManager) installVersion(ctx context.Context, pkgName, version string) ([]byte, error) {
+	configPath := resolveOpkgConfigPath()
+
+	pkg, err := findOpkgPackage(resolveOpkgListsPath(configPath), resolveOpkgFeeds(configPath), pkgName, version)
+	if err != nil {
+		return nil, err
+	}
+
+	tmpDir, err := os.MkdirTemp("", "qbee-opkg-")
+	if err != nil {
+		return nil, fmt.Errorf("error creating download directory: %w", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	pkgFilePath := filepath.Join(tmpDir, path.Base(pkg.URL))
+
+	if err = downloadOpkgPackage(ctx, pkg, pkgFilePath); err != nil {
+		return nil, err
 	}
 
-	defer cache.Delete(opkgPackagesCacheKey)
+	// the requested version might be older than the installed one
+	return opkg.installLocal(ctx, pkgFilePath, "--force-downgrade")
+}
+
+// Remove package. opkg refuses to remove packages required by other installed packages.
+// With AutoRemove, also dependencies which were installed automatically and are no longer required are removed.
+// opkg doesn't distinguish between removing and purging, so Purge is ignored.
+func (opkg *OpkgPackageManager) Remove(ctx context.Context, pkgName string, opts RemoveOptions) ([]byte, error) {
+	opkg.lock.Lock()
+	defer opkg.lock.Unlock()
+
+	defer invalidateCachedPackages(opkgPackagesCacheKey)
+
+	cmd := []string{opkgCmd, "remove", pkgName}
+	if opts.AutoRemove {
+		cmd = []string{opkgCmd, "remove", "--autoremove", pkgName}
+	}
 
 	return utils.RunCommand(ctx, cmd)
 }
@@ -354,11 +407,27 @@ func (opkg *OpkgPackageManager) InstallLocal(ctx context.Context, pkgFilePath st
 	opkg.lock.Lock()
 	defer opkg.lock.Unlock()
 
-	cmd := []string{opkgCmd, "install", pkgFilePath}
+	return opkg.installLocal(ctx, pkgFilePath)
+}
 
-	defer cache.Delete(opkgPackagesCacheKey)
+// installLocal installs package from a file using provided extra opkg options.
+// Caller must hold the package manager lock.
+func (opkg *OpkgPackageManager) installLocal(ctx context.Context, pkgFilePath string, options ...string) ([]byte, error) {
+	cmd := append([]string{opkgCmd}, options...)
+	if conflictsAllowed(ctx) {
+		cmd = append(cmd, "--force-overwrite")
+	}
 
-	return utils.RunCommand(ctx, cmd)
+	cmd = append(cmd, "install", pkgFilePath)
+
+	defer invalidateCachedPackages(opkgPackagesCacheKey)
+
+	return runPackageCommand(ctx, cmd, parseOpkgFailures)
+}
+
+// RebootRequired always returns false, since opkg based systems don't signal required reboots.
+func (opkg *OpkgPackageManager) RebootRequired(_ context.Context) (bool, string, error) {
+	return false, "", nil
 }
 
 // PackageArchitecture returns the architecture of the package manager
@@ -430,3 +499,44 @@ func (opkg *OpkgPackageManager) IsSupportedArchitecture(arch string) error {
 
 	return fmt.Errorf("architecture %s is not supported by the system", arch)
 }
+
+const opkgFeedsDir = "/etc/opkg"
+
+// renderOpkgFeed returns opkg feed configuration file for the repository.
+func renderOpkgFeed(repo Repository) ([]repositoryFile, error) {
+	if repo.SigningKey != "" {
+		return nil, fmt.Errorf("signing keys are not supported by opkg (repository %s)", repo.Name)
+	}
+
+	files := []repositoryFile{
+		{
+			path:    filepath.Join(opkgFeedsDir, repo.fileName(".conf")),
+			content: []byte(fmt.Sprintf("src/gz %s %s\n", repo.Name, repo.URL)),
+		},
+	}
+
+	return files, nil
+}
+
+// ConfigureRepositories ensures provided opkg feeds are configured and runs opkg update on changes.
+func (opkg *OpkgPackageManager) ConfigureRepositories(
+	ctx context.Context,
+	repos []Repository,
+) ([]RepositoryChange, []byte, error) {
+	opkg.lock.Lock()
+	defer opkg.lock.Unlock()
+
+	changes, backup, err := configureRepositories(repos, renderOpkgFeed)
+	if err != nil || len(changes) == 0 {
+		return changes, nil, err
+	}
+
+	defer invalidateCachedPackages(opkgPackagesCacheKey)
+
+	output, err := utils.RunCommand(ctx, []string{opkgCmd, "update"})
+	if err != nil {
+		return nil, output, restoreRepositories(backup, fmt.Errorf("error updating package index: %w", err))
+	}
+
+	return changes, output, nil
+}
@@ -18,9 +18,12 @@ package software
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"os"
 	"path/filepath"
 	"reflect"
+	"strings"
 	"testing"
 )
 
@@ -161,3 +164,172 @@ option info_dir /usr/share/opkg/info
 		})
 	}
 }
+
+func Test_resolveOpkgFeeds(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	configPath := filepath.Join(tmpDir, "opkg.conf")
+	configContents := "src/gz base https://downloads.openwrt.org/base\noption lists_dir ext /tmp/opkg-lists\n"
+
+	if err := os.WriteFile(configPath, []byte(configContents), 0644); err != nil {
+		t.Fatalf("error writing opkg.conf file: %v", err)
+	}
+
+	if err := os.Mkdir(filepath.Join(tmpDir, "opkg"), 0755); err != nil {
+		t.Fatalf("error creating opkg config directory: %v", err)
+	}
+
+	customFeedsPath := filepath.Join(tmpDir, "opkg", "customfeeds.conf")
+	if err := os.WriteFile(customFeedsPath, []byte("# comment\nsrc/gz qbee file:///opkg-repo/repo\n"), 0644); err != nil {
+		t.Fatalf("error writing customfeeds.conf file: %v", err)
+	}
+
+	wantFeeds := map[string]string{
+		"base": "https://downloads.openwrt.org/base",
+		"qbee": "file:///opkg-repo/repo",
+	}
+
+	if got := resolveOpkgFeeds(configPath); !reflect.DeepEqual(got, wantFeeds) {
+		t.Errorf("resolveOpkgFeeds() = %v, want %v", got, wantFeeds)
+	}
+
+	if got := resolveOpkgListsPath(configPath); got != "/tmp/opkg-lists" {
+		t.Errorf("resolveOpkgListsPath() = %v, want /tmp/opkg-lists", got)
+	}
+}
+
+func Test_findOpkgPackage(t *testing.T) {
+	// use the test repository package list as the downloaded "qbee" feed list
+	listsDir := t.TempDir()
+
+	packagesList, err := os.ReadFile("../../test/resources/opkg/repo/Packages.gz")
+	if err != nil {
+		t.Fatalf("error reading test package list: %v", err)
+	}
+
+	if err = os.WriteFile(filepath.Join(listsDir, "qbee"), packagesList, 0644); err != nil {
+		t.Fatalf("error writing package list: %v", err)
+	}
+
+	// a later feed providing the same package with its checksum before the filename
+	mirrorList := "Package: qbee-test\nVersion: 1.0.1\nSHA256sum: ABCDEF\nFilename: qbee-test_1.0.1_all.ipk\n"
+	if err = os.WriteFile(filepath.Join(listsDir, "zmirror"), []byte(mirrorList), 0644); err != nil {
+		t.Fatalf("error writing package list: %v", err)
+	}
+
+	feeds := map[string]string{
+		"qbee":    "file:///opkg-repo/repo/",
+		"zmirror": "https://example.com/mirror",
+		"missing": "https://example.com/missing",
+	}
+
+	tests := []struct {
+		name    string
+		feeds   map[string]string
+		version string
+		want    *opkgFeedPackage
+		wantErr bool
+	}{
+		{
+			name:    "older version",
+			feeds:   feeds,
+			version: "1.0.1",
+			want: &opkgFeedPackage{
+				URL:    "file:///opkg-repo/repo/qbee-test_1.0.1_all.ipk",
+				MD5Sum: "61bdb36ce2628a7563851a0374c1ad08",
+			},
+		},
+		{
+			name:    "newer version",
+			feeds:   feeds,
+			version: "2.1.1",
+			want: &opkgFeedPackage{
+				URL:    "file:///opkg-repo/repo/qbee-test_2.1.1_all.ipk",
+				MD5Sum: "6729434e7648477c1f8b49197448861b",
+			},
+		},
+		{
+			name:    "checksum before filename",
+			feeds:   map[string]string{"zmirror": "https://example.com/mirror"},
+			version: "1.0.1",
+			want: &opkgFeedPackage{
+				URL:       "https://example.com/mirror/qbee-test_1.0.1_all.ipk",
+				SHA256Sum: "abcdef",
+			},
+		},
+		{name: "unknown version", feeds: feeds, version: "3.0.0", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := findOpkgPackage(listsDir, tt.feeds, "qbee-test", tt.version)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("findOpkgPackage() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("findOpkgPackage() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_downloadOpkgPackage(t *testing.T) {
+	src, err := filepath.Abs("../../test/resources/opkg/repo/qbee-test_1.0.1_all.ipk")
+	if err != nil {
+		t.Fatalf("error resolving package path: %v", err)
+	}
+
+	srcData, err := os.ReadFile(src)
+	if err != nil {
+		t.Fatalf("error reading package: %v", err)
+	}
+
+	sha256Sum := sha256.Sum256(srcData)
+
+	tests := []struct {
+		name    string
+		pkg     *opkgFeedPackage
+		wantErr bool
+	}{
+		{
+			name: "sha256",
+			pkg:  &opkgFeedPackage{URL: "file://" + src, SHA256Sum: hex.EncodeToString(sha256Sum[:])},
+		},
+		{
+			name: "md5",
+			pkg:  &opkgFeedPackage{URL: "file://" + src, MD5Sum: "61bdb36ce2628a7563851a0374c1ad08"},
+		},
+		{
+			name:    "checksum mismatch",
+			pkg:     &opkgFeedPackage{URL: "file://" + src, SHA256Sum: strings.Repeat("0", 64)},
+			wantErr: true,
+		},
+		{
+			name:    "no checksum",
+			pkg:     &opkgFeedPackage{URL: "file://" + src},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dst := filepath.Join(t.TempDir(), "qbee-test_1.0.1_all.ipk")
+
+			err := downloadOpkgPackage(context.Background(), tt.pkg, dst)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("downloadOpkgPackage() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			if tt.wantErr {
+				return
+			}
+
+			dstData, _ := os.ReadFile(dst)
+
+			if !reflect.DeepEqual(srcData, dstData) {
+				t.Errorf("downloaded package doesn't match the source")
+			}
+		})
+	}
+}
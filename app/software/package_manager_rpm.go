@@ -23,9 +23,11 @@ import (
 	"fmt"
 	"os"
 	"os/exec"
+	"path/filepath"
 	"runtime"
 	"strings"
 	"sync"
+	"time"
 
 	"go.qbee.io/agent/app/utils"
 	"go.qbee.io/agent/app/utils/cache"
@@ -38,9 +40,21 @@ const rpmFileSuffix string = ".rpm"
 var rpmPackagesCacheKey = fmt.Sprintf("%s:%s:packages", pkgCacheKeyPrefix, PackageManagerTypeRpm)
 var rpmPkgArchCacheKey = fmt.Sprintf("%s:%s:arch", pkgCacheKeyPrefix, PackageManagerTypeRpm)
 
+// rpmDatabasePaths are the rpm database files (depending on the database backend and location).
+var rpmDatabasePaths = []string{
+	"/var/lib/rpm/rpmdb.sqlite",
+	"/var/lib/rpm/Packages",
+	"/var/lib/rpm/Packages.db",
+	"/usr/lib/sysimage/rpm/rpmdb.sqlite",
+	"/usr/lib/sysimage/rpm/Packages.db",
+}
+
 const (
-	rpmPath = "rpm"
-	yumPath = "yum"
+	rpmPath                       = "rpm"
+	yumPath                       = "yum"
+	dnfPath                       = "dnf"
+	needsRestartingPath           = "needs-restarting"
+	needsRestartingRebootExitCode = 1
 )
 
 // RpmPackageManager implements PackageManager interface for RPM based systems (Fedora, CentOS etc.)
@@ -98,8 +112,8 @@ func (rpm *RpmPackageManager) ListPackages(ctx context.Context) ([]Package, erro
 	rpm.lock.Lock()
 	defer rpm.lock.Unlock()
 
-	if cachedPackages, ok := cache.Get(rpmPackagesCacheKey); ok {
-		return cachedPackages.([]Package), nil
+	if cachedPackages, ok := getCachedPackages(rpmPackagesCacheKey, rpmDatabasePaths); ok {
+		return cachedPackages, nil
 	}
 
 	installedPackages, err := rpm.listInstalledPackages(ctx)
@@ -116,7 +130,7 @@ func (rpm *RpmPackageManager) ListPackages(ctx context.Context) ([]Package, erro
 	for i, pkg := range installedPackages {
 		installedPackages[i].Update = availableUpdates[pkg.ID()]
 	}
-	cache.Set(rpmPackagesCacheKey, installedPackages, pkgCacheTTL)
+	setCachedPackages(rpmPackagesCacheKey, rpmDatabasePaths, installedPackages)
 
 	return installedPackages, nil
 }
@@ -150,17 +164,29 @@ func (rpm *RpmPackageManager) listAvailableUpdates(ctx context.Context) (map[str
 		yumPath,
 		"--quiet",
 		"--assumeyes",
-		"check-update",
 	}
 
+	// check-update refreshes expired repository metadata, unless only cached metadata is allowed
+	indexUpdateSkipped := skipIndexUpdate(ctx, PackageManagerTypeRpm)
+	if indexUpdateSkipped {
+		cmd = append(cmd, "--cacheonly")
+	}
+
+	cmd = append(cmd, "check-update")
+
 	updates := make(map[string]string)
 
 	// yum check-updates returns 100 when there are updates available
 	cmdProc := utils.NewCommand(ctx, cmd)
 
+	start := time.Now()
 	output, err := cmdProc.CombinedOutput()
+	utils.TraceCommand(ctx, cmdProc, start)
 	// no error, no updates
 	if err == nil {
+		if !indexUpdateSkipped {
+			markIndexUpdated(PackageManagerTypeRpm)
+		}
 		return nil, nil
 	}
 
@@ -171,6 +197,10 @@ func (rpm *RpmPackageManager) listAvailableUpdates(ctx context.Context) (map[str
 		}
 	}
 
+	if !indexUpdateSkipped {
+		markIndexUpdated(PackageManagerTypeRpm)
+	}
+
 	err = utils.ForLines(bytes.NewBuffer(output), func(line string) error {
 		pkg := rpm.parseUpdateAvailableLine(strings.TrimSpace(line))
 		if pkg != nil {
@@ -222,6 +252,26 @@ func (rpm *RpmPackageManager) listInstalledPackages(ctx context.Context) ([]Pack
 	return installedPackages, nil
 }
 
+// yumCommand returns non-interactive yum base command with install recommends policy set in context.
+func yumCommand(ctx context.Context) []string {
+	return append([]string{yumPath, "--assumeyes", "--quiet"}, weakDepsOptions(ctx)...)
+}
+
+// weakDepsOptions returns yum/dnf options enforcing install recommends policy set in context.
+// Weak dependencies are supported only by dnf, yum ignores the option.
+func weakDepsOptions(ctx context.Context) []string {
+	install, isSet := installRecommends(ctx)
+	if !isSet {
+		return nil
+	}
+
+	if install {
+		return []string{"--setopt=install_weak_deps=True"}
+	}
+
+	return []string{"--setopt=install_weak_deps=False"}
+}
+
 // UpgradeAll performs upgrade of all packages.
 func (rpm *RpmPackageManager) UpgradeAll(ctx context.Context) (int, []byte, error) {
 	// check for updates
@@ -245,43 +295,64 @@ func (rpm *RpmPackageManager) UpgradeAll(ctx context.Context) (int, []byte, erro
 		return 0, nil, nil
 	}
 
-	upgradeCommand := []string{
-		yumPath,
-		"--assumeyes",
-		"--quiet",
-		"update",
-	}
+	upgradeCommand := append(yumCommand(ctx), "update")
 
 	var output []byte
-	if output, err = utils.RunCommand(ctx, upgradeCommand); err != nil {
+	if output, err = runPackageCommand(ctx, upgradeCommand, parseYumFailures); err != nil {
 		return 0, output, err
 	}
 
-	cache.Delete(rpmPackagesCacheKey)
+	invalidateCachedPackages(rpmPackagesCacheKey)
 
 	return updatesAvailable, output, err
 }
 
 // Install ensures a package with provided version number is installed in the system.
 func (rpm *RpmPackageManager) Install(ctx context.Context, pkgName, version string) ([]byte, error) {
+	return rpm.InstallTransaction(ctx, []Package{{Name: pkgName, Version: version}})
+}
+
+// InstallTransaction ensures packages with provided versions are installed in a single yum/dnf transaction.
+func (rpm *RpmPackageManager) InstallTransaction(ctx context.Context, packages []Package) ([]byte, error) {
 	rpm.lock.Lock()
 	defer rpm.lock.Unlock()
 
-	defer cache.Delete(rpmPackagesCacheKey)
+	defer invalidateCachedPackages(rpmPackagesCacheKey)
 
-	if version != "" {
-		pkgName = fmt.Sprintf("%s-%s", pkgName, version)
+	installCommand := append(yumCommand(ctx), "install")
+
+	for _, pkg := range packages {
+		if pkg.Version != "" {
+			installCommand = append(installCommand, fmt.Sprintf("%s-%s", pkg.Name, pkg.Version))
+		} else {
+			installCommand = append(installCommand, pkg.Name)
+		}
 	}
 
-	installCommand := []string{
-		yumPath,
-		"--assumeyes",
-		"--quiet",
-		"install",
-		pkgName,
+	return runPackageCommand(ctx, installCommand, parseYumFailures)
+}
+
+// Remove package using rpm, which refuses to remove packages required by other installed packages.
+// With AutoRemove, yum is used to remove also dependencies which are no longer required.
+// RPM packages don't distinguish between removing and purging, so Purge is ignored.
+func (rpm *RpmPackageManager) Remove(ctx context.Context, pkgName string, opts RemoveOptions) ([]byte, error) {
+	rpm.lock.Lock()
+	defer rpm.lock.Unlock()
+
+	defer invalidateCachedPackages(rpmPackagesCacheKey)
+
+	if opts.AutoRemove {
+		return utils.RunCommand(ctx, []string{
+			yumPath,
+			"--assumeyes",
+			"--quiet",
+			"--setopt=clean_requirements_on_remove=1",
+			"remove",
+			pkgName,
+		})
 	}
 
-	return utils.RunCommand(ctx, installCommand)
+	return utils.RunCommand(ctx, []string{rpmPath, "--erase", pkgName})
 }
 
 // InstallLocal package.
@@ -289,17 +360,66 @@ func (rpm *RpmPackageManager) InstallLocal(ctx context.Context, pkgFilePath stri
 	rpm.lock.Lock()
 	defer rpm.lock.Unlock()
 
-	defer cache.Delete(rpmPackagesCacheKey)
+	defer invalidateCachedPackages(rpmPackagesCacheKey)
 
-	installCmd := []string{
-		yumPath,
-		"--assumeyes",
-		"--quiet",
-		"install",
-		pkgFilePath,
+	// rpm is used directly, since yum cannot replace files owned by other packages.
+	// Explicit package conflicts are still refused, as overriding them requires skipping all dependency checks.
+	if conflictsAllowed(ctx) {
+		return runPackageCommand(ctx, []string{rpmPath, "--upgrade", "--replacefiles", "--replacepkgs", pkgFilePath}, parseYumFailures)
 	}
 
-	return utils.RunCommand(ctx, installCmd)
+	installCmd := append(yumCommand(ctx), "install", pkgFilePath)
+
+	return runPackageCommand(ctx, installCmd, parseYumFailures)
+}
+
+// RebootRequired returns true if `needs-restarting -r` (from yum-utils/dnf-utils) reports that reboot is required.
+// Reason lists updated core libraries and services reported by the command.
+func (rpm *RpmPackageManager) RebootRequired(ctx context.Context) (bool, string, error) {
+	if _, err := exec.LookPath(needsRestartingPath); err != nil {
+		return false, "", fmt.Errorf("cannot determine whether reboot is required, install yum-utils or dnf-utils: %w", err)
+	}
+
+	command := utils.NewCommand(ctx, []string{needsRestartingPath, "-r"})
+
+	start := time.Now()
+	output, err := command.Output()
+	utils.TraceCommand(ctx, command, start)
+	if err == nil {
+		return false, "", nil
+	}
+
+	exitErr := new(exec.ExitError)
+	if !errors.As(err, &exitErr) || exitErr.ExitCode() != needsRestartingRebootExitCode {
+		return false, "", fmt.Errorf("error running %s: %w", needsRestartingPath, err)
+	}
+
+	updated := parseNeedsRestartingOutput(output)
+	if len(updated) == 0 {
+		return true, "", nil
+	}
+
+	return true, fmt.Sprintf("Reboot required by updated packages: %s", strings.Join(updated, ", ")), nil
+}
+
+// parseNeedsRestartingOutput returns list of updated packages from `needs-restarting -r` output.
+// Supported format:
+//
+//	Core libraries or services have been updated since boot-up:
+//	  * kernel
+//	  * systemd
+//
+//	Reboot is required to fully utilize these updates.
+func parseNeedsRestartingOutput(output []byte) []string {
+	updated := make([]string, 0)
+
+	for _, line := range strings.Split(string(output), "\n") {
+		if pkg, found := strings.CutPrefix(strings.TrimSpace(line), "* "); found {
+			updated = append(updated, strings.TrimSpace(pkg))
+		}
+	}
+
+	return updated
 }
 
 // PackageArchitecture returns the architecture of the package manager
@@ -366,3 +486,154 @@ func (rpm *RpmPackageManager) IsSupportedArchitecture(arch string) error {
 	}
 	return fmt.Errorf("architecture %s is not supported by the system", arch)
 }
+
+const (
+	yumReposDir = "/etc/yum.repos.d"
+	rpmKeysDir  = "/etc/pki/rpm-gpg"
+)
+
+// renderYumRepository returns yum repository file and signing key file for the repository.
+func renderYumRepository(repo Repository) ([]repositoryFile, error) {
+	id := repo.fileName("")
+
+	lines := []string{
+		fmt.Sprintf("[%s]", id),
+		fmt.Sprintf("name=%s", repo.Name),
+		fmt.Sprintf("baseurl=%s", repo.URL),
+		"enabled=1",
+	}
+
+	files := make([]repositoryFile, 1)
+
+	if repo.SigningKey != "" {
+		keyPath := filepath.Join(rpmKeysDir, repo.fileName(".asc"))
+		lines = append(lines, "gpgcheck=1", fmt.Sprintf("gpgkey=file://%s", keyPath))
+		files = append(files, repositoryFile{path: keyPath, content: signingKeyContent(repo.SigningKey)})
+	} else {
+		lines = append(lines, "gpgcheck=0")
+	}
+
+	files[0] = repositoryFile{
+		path:    filepath.Join(yumReposDir, repo.fileName(".repo")),
+		content: []byte(strings.Join(lines, "\n") + "\n"),
+	}
+
+	return files, nil
+}
+
+// ConfigureRepositories ensures provided yum repositories are configured and refreshes metadata cache on changes.
+func (rpm *RpmPackageManager) ConfigureRepositories(
+	ctx context.Context,
+	repos []Repository,
+) ([]RepositoryChange, []byte, error) {
+	rpm.lock.Lock()
+	defer rpm.lock.Unlock()
+
+	changes, backup, err := configureRepositories(repos, renderYumRepository)
+	if err != nil || len(changes) == 0 {
+		return changes, nil, err
+	}
+
+	defer invalidateCachedPackages(rpmPackagesCacheKey)
+
+	// import signing keys of changed repositories, so package installation doesn't need to prompt for them
+	for _, repo := range repos {
+		if repo.SigningKey == "" || !repositoryChanged(changes, repo.Name) {
+			continue
+		}
+
+		keyPath := filepath.Join(rpmKeysDir, repo.fileName(".asc"))
+		if output, err := utils.RunCommand(ctx, []string{rpmPath, "--import", keyPath}); err != nil {
+			err = fmt.Errorf("error importing signing key for repository %s: %w", repo.Name, err)
+			return nil, output, restoreRepositories(backup, err)
+		}
+	}
+
+	output, err := utils.RunCommand(ctx, []string{yumPath, "--assumeyes", "--quiet", "makecache"})
+	if err != nil {
+		return nil, output, restoreRepositories(backup, fmt.Errorf("error updating package index: %w", err))
+	}
+
+	return changes, output, nil
+}
+
+// dnfNoModulesMessage is reported by dnf (with non-zero exit code) when no modules match the module list filter.
+const dnfNoModulesMessage = "No matching Modules to list"
+
+// ModulesSupported returns true if dnf with module support is available on the system.
+func (rpm *RpmPackageManager) ModulesSupported(ctx context.Context) bool {
+	if _, err := exec.LookPath(dnfPath); err != nil {
+		return false
+	}
+
+	_, err := utils.RunCommand(ctx, []string{dnfPath, "--quiet", "module", "--help"})
+
+	return err == nil
+}
+
+// ConfigureModules ensures provided module streams are enabled and their profiles installed.
+// Enabled streams are switched by resetting the module first.
+func (rpm *RpmPackageManager) ConfigureModules(ctx context.Context, modules []Module) ([]ModuleChange, []byte, error) {
+	for _, module := range modules {
+		if err := module.Validate(); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	rpm.lock.Lock()
+	defer rpm.lock.Unlock()
+
+	listOutput, err := utils.RunCommand(ctx, []string{dnfPath, "--quiet", "module", "list", "--enabled"})
+	if err != nil && !strings.Contains(err.Error(), dnfNoModulesMessage) {
+		return nil, nil, fmt.Errorf("error listing enabled modules: %w", err)
+	}
+
+	enabledModules := parseEnabledModules(listOutput)
+
+	changes := make([]ModuleChange, 0)
+	output := make([]byte, 0)
+
+	for _, module := range modules {
+		change := ModuleChange{Module: module}
+		enabled, isEnabled := enabledModules[module.Name]
+
+		if !isEnabled || enabled.stream != module.Stream {
+			if isEnabled {
+				cmdOutput, err := utils.RunCommand(ctx, []string{dnfPath, "--assumeyes", "--quiet", "module", "reset", module.Name})
+				output = append(output, cmdOutput...)
+				if err != nil {
+					return changes, output, fmt.Errorf("error resetting module %s: %w", module.Name, err)
+				}
+			}
+
+			streamSpec := module.Name + ":" + module.Stream
+			cmdOutput, err := utils.RunCommand(ctx, []string{dnfPath, "--assumeyes", "--quiet", "module", "enable", streamSpec})
+			output = append(output, cmdOutput...)
+			if err != nil {
+				return changes, output, fmt.Errorf("error enabling module stream %s: %w", streamSpec, err)
+			}
+
+			change.Enabled = true
+			enabled = enabledModule{stream: module.Stream}
+		}
+
+		if module.Profile != "" && !enabled.installedProfiles[module.Profile] {
+			invalidateCachedPackages(rpmPackagesCacheKey)
+
+			installCmd := append([]string{dnfPath, "--assumeyes", "--quiet"}, weakDepsOptions(ctx)...)
+			cmdOutput, err := utils.RunCommand(ctx, append(installCmd, "module", "install", module.String()))
+			output = append(output, cmdOutput...)
+			if err != nil {
+				return changes, output, fmt.Errorf("error installing module profile %s: %w", module, err)
+			}
+
+			change.Installed = true
+		}
+
+		if change.Enabled || change.Installed {
+			changes = append(changes, change)
+		}
+	}
+
+	return changes, output, nil
+}
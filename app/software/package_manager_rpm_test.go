@@ -17,6 +17,7 @@
 package software
 
 import (
+	"context"
 	"reflect"
 	"testing"
 )
@@ -63,3 +64,50 @@ func TestRpmUpdatesParse(t *testing.T) {
 	}
 
 }
+
+func Test_parseNeedsRestartingOutput(t *testing.T) {
+	output := []byte(`Core libraries or services have been updated since boot-up:
+  * kernel
+  * systemd
+
+Reboot is required to fully utilize these updates.
+More information: https://access.redhat.com/solutions/27943
+`)
+
+	want := []string{"kernel", "systemd"}
+
+	if got := parseNeedsRestartingOutput(output); !reflect.DeepEqual(got, want) {
+		t.Errorf("parseNeedsRestartingOutput() = %v, want %v", got, want)
+	}
+}
+
+func Test_yumCommand(t *testing.T) {
+	tests := []struct {
+		name string
+		ctx  context.Context
+		want []string
+	}{
+		{
+			name: "system default",
+			ctx:  context.Background(),
+			want: []string{yumPath, "--assumeyes", "--quiet"},
+		},
+		{
+			name: "install recommends",
+			ctx:  WithInstallRecommends(context.Background(), true),
+			want: []string{yumPath, "--assumeyes", "--quiet", "--setopt=install_weak_deps=True"},
+		},
+		{
+			name: "no recommends",
+			ctx:  WithInstallRecommends(context.Background(), false),
+			want: []string{yumPath, "--assumeyes", "--quiet", "--setopt=install_weak_deps=False"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := yumCommand(tt.ctx); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("yumCommand() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
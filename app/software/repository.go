@@ -0,0 +1,237 @@
+// Copyright 2024 qbee.io
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package software
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"go.qbee.io/agent/app/utils"
+)
+
+// Repository defines a third-party package repository.
+type Repository struct {
+	// Name identifies the repository and is used to name the repository files.
+	Name string `json:"name"`
+
+	// URL of the repository.
+	URL string `json:"url"`
+
+	// Distribution defines the apt suite of the repository (e.g. "bookworm"). Debian only.
+	Distribution string `json:"distribution,omitempty"`
+
+	// Components defines the apt components of the repository (e.g. "main"). Debian only.
+	Components []string `json:"components,omitempty"`
+
+	// SigningKey is an ASCII-armored public key used to verify packages from the repository.
+	SigningKey string `json:"signing_key,omitempty"`
+}
+
+// RepositoryChange describes a repository which was added or updated.
+type RepositoryChange struct {
+	// Name of the repository.
+	Name string
+
+	// Added is true for repositories which were not configured before.
+	Added bool
+}
+
+const (
+	repositoryFilePrefix = "qbee-"
+	repositoryFileMode   = 0644
+	repositoryDirMode    = 0755
+)
+
+var repositoryNameRE = regexp.MustCompile(`^[A-Za-z0-9_.-]+$`)
+var repositoryComponentRE = regexp.MustCompile(`^[A-Za-z0-9_./-]+$`)
+
+// Validate returns an error if repository definition is not valid.
+func (repo Repository) Validate() error {
+	if !repositoryNameRE.MatchString(repo.Name) {
+		return fmt.Errorf("invalid repository name: %q", repo.Name)
+	}
+
+	if repo.URL == "" || strings.ContainsAny(repo.URL, " \t\n") {
+		return fmt.Errorf("invalid URL for repository %s: %q", repo.Name, repo.URL)
+	}
+
+	for _, component := range append([]string{repo.Distribution}, repo.Components...) {
+		if component != "" && !repositoryComponentRE.MatchString(component) {
+			return fmt.Errorf("invalid distribution or component for repository %s: %q", repo.Name, component)
+		}
+	}
+
+	return nil
+}
+
+// fileName returns name of the repository file (or signing key file) with provided extension.
+func (repo Repository) fileName(extension string) string {
+	return repositoryFilePrefix + repo.Name + extension
+}
+
+// writeRepositoryFile writes content to the path only when it's different from the current file content.
+// Returns whether the file existed before and whether it was changed.
+// Previous content of changed files is recorded in the backup.
+func writeRepositoryFile(path string, content []byte, backup *repositoryBackup) (bool, bool, error) {
+	currentContent, err := os.ReadFile(path)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return false, false, fmt.Errorf("error reading %s: %w", path, err)
+	}
+
+	existed := err == nil
+
+	if existed && bytes.Equal(currentContent, content) {
+		return true, false, nil
+	}
+
+	if err = os.MkdirAll(filepath.Dir(path), repositoryDirMode); err != nil {
+		return existed, false, fmt.Errorf("error creating directory for %s: %w", path, err)
+	}
+
+	*backup = append(*backup, repositoryFileBackup{path: path, content: currentContent, existed: existed})
+
+	if err = utils.WriteFileSync(path, content, repositoryFileMode); err != nil {
+		return existed, false, fmt.Errorf("error writing %s: %w", path, err)
+	}
+
+	return existed, true, nil
+}
+
+// repositoryFileBackup records content of a repository file before it was changed.
+type repositoryFileBackup struct {
+	path    string
+	content []byte
+	existed bool
+}
+
+// repositoryBackup records repository files changed by configureRepositories.
+type repositoryBackup []repositoryFileBackup
+
+// restore changed repository files to their previous content and removes added files.
+// Restored repositories are reported as changed again on the next run, so the index refresh is retried.
+func (backup repositoryBackup) restore() error {
+	var errs []error
+
+	for i := len(backup) - 1; i >= 0; i-- {
+		file := backup[i]
+
+		var err error
+		if file.existed {
+			err = utils.WriteFileSync(file.path, file.content, repositoryFileMode)
+		} else if err = os.Remove(file.path); errors.Is(err, fs.ErrNotExist) {
+			err = nil
+		}
+
+		if err != nil {
+			errs = append(errs, fmt.Errorf("error restoring %s: %w", file.path, err))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// repositoryFile defines expected content of a file needed by a repository.
+type repositoryFile struct {
+	path    string
+	content []byte
+}
+
+// configureRepositories writes repository files (and signing keys) for all repositories.
+// render returns files needed by the repository, where the first file is the repository definition.
+// Returned backup allows to restore previous state of the files when the package index cannot be refreshed.
+// On error, changed files are restored.
+func configureRepositories(
+	repos []Repository,
+	render func(repo Repository) ([]repositoryFile, error),
+) (changes []RepositoryChange, backup repositoryBackup, err error) {
+	changes = make([]RepositoryChange, 0)
+
+	defer func() {
+		if err == nil {
+			return
+		}
+
+		if restoreErr := backup.restore(); restoreErr != nil {
+			err = errors.Join(err, restoreErr)
+		}
+
+		changes = changes[:0]
+	}()
+
+	for _, repo := range repos {
+		if err = repo.Validate(); err != nil {
+			return changes, backup, err
+		}
+
+		var files []repositoryFile
+		if files, err = render(repo); err != nil {
+			return changes, backup, err
+		}
+
+		var added, changed bool
+
+		for i, file := range files {
+			var existed, fileChanged bool
+			if existed, fileChanged, err = writeRepositoryFile(file.path, file.content, &backup); err != nil {
+				return changes, backup, err
+			}
+
+			if i == 0 {
+				added = !existed
+			}
+
+			changed = changed || fileChanged
+		}
+
+		if changed {
+			changes = append(changes, RepositoryChange{Name: repo.Name, Added: added})
+		}
+	}
+
+	return changes, backup, nil
+}
+
+// restoreRepositories restores repository files after failed index refresh, so the refresh is retried on the next run.
+func restoreRepositories(backup repositoryBackup, err error) error {
+	if restoreErr := backup.restore(); restoreErr != nil {
+		return errors.Join(err, restoreErr)
+	}
+
+	return err
+}
+
+// signingKeyContent returns signing key file content (always terminated by a new line).
+func signingKeyContent(key string) []byte {
+	return []byte(strings.TrimSpace(key) + "\n")
+}
+
+// repositoryChanged returns true if repository with provided name is in the list of changes.
+func repositoryChanged(changes []RepositoryChange, name string) bool {
+	for _, change := range changes {
+		if change.Name == name {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,193 @@
+// Copyright 2023 qbee.io
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package software
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestRepository_Validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		repo    Repository
+		wantErr bool
+	}{
+		{
+			name: "valid",
+			repo: Repository{Name: "example", URL: "https://example.com/debian", Distribution: "bookworm"},
+		},
+		{
+			name:    "invalid name",
+			repo:    Repository{Name: "../example", URL: "https://example.com/debian"},
+			wantErr: true,
+		},
+		{
+			name:    "missing URL",
+			repo:    Repository{Name: "example"},
+			wantErr: true,
+		},
+		{
+			name:    "invalid component",
+			repo:    Repository{Name: "example", URL: "https://example.com", Components: []string{"main contrib"}},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.repo.Validate(); (err != nil) != tt.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func Test_renderAptRepository(t *testing.T) {
+	repo := Repository{
+		Name:         "example",
+		URL:          "https://example.com/debian",
+		Distribution: "bookworm",
+		Components:   []string{"main", "contrib"},
+		SigningKey:   "KEY",
+	}
+
+	got, err := renderAptRepository(repo)
+	if err != nil {
+		t.Fatalf("renderAptRepository() error = %v", err)
+	}
+
+	want := []repositoryFile{
+		{
+			path:    "/etc/apt/sources.list.d/qbee-example.list",
+			content: []byte("deb [signed-by=/etc/apt/keyrings/qbee-example.asc] https://example.com/debian bookworm main contrib\n"),
+		},
+		{
+			path:    "/etc/apt/keyrings/qbee-example.asc",
+			content: []byte("KEY\n"),
+		},
+	}
+
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("renderAptRepository() = %q, want %q", got, want)
+	}
+
+	repo.Distribution = ""
+	if _, err = renderAptRepository(repo); err == nil {
+		t.Errorf("expected error for repository without distribution")
+	}
+}
+
+func Test_renderYumRepository(t *testing.T) {
+	repo := Repository{
+		Name: "example",
+		URL:  "https://example.com/rpm",
+	}
+
+	got, err := renderYumRepository(repo)
+	if err != nil {
+		t.Fatalf("renderYumRepository() error = %v", err)
+	}
+
+	want := []repositoryFile{
+		{
+			path:    "/etc/yum.repos.d/qbee-example.repo",
+			content: []byte("[qbee-example]\nname=example\nbaseurl=https://example.com/rpm\nenabled=1\ngpgcheck=0\n"),
+		},
+	}
+
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("renderYumRepository() = %q, want %q", got, want)
+	}
+}
+
+func Test_configureRepositories(t *testing.T) {
+	dir := t.TempDir()
+	repo := Repository{Name: "example", URL: "https://example.com/v1"}
+
+	render := func(repo Repository) ([]repositoryFile, error) {
+		return []repositoryFile{{path: filepath.Join(dir, repo.fileName(".list")), content: []byte(repo.URL)}}, nil
+	}
+
+	// first run adds the repository
+	changes, _, err := configureRepositories([]Repository{repo}, render)
+	if err != nil {
+		t.Fatalf("configureRepositories() error = %v", err)
+	}
+
+	if want := []RepositoryChange{{Name: "example", Added: true}}; !reflect.DeepEqual(changes, want) {
+		t.Errorf("configureRepositories() = %v, want %v", changes, want)
+	}
+
+	// no changes on the subsequent run
+	if changes, _, err = configureRepositories([]Repository{repo}, render); err != nil || len(changes) != 0 {
+		t.Errorf("configureRepositories() = %v, %v, expected no changes", changes, err)
+	}
+
+	// changed definition updates the repository
+	repo.URL = "https://example.com/v2"
+	changes, backup, err := configureRepositories([]Repository{repo}, render)
+	if err != nil {
+		t.Fatalf("configureRepositories() error = %v", err)
+	}
+
+	if want := []RepositoryChange{{Name: "example", Added: false}}; !reflect.DeepEqual(changes, want) {
+		t.Errorf("configureRepositories() = %v, want %v", changes, want)
+	}
+
+	content, err := os.ReadFile(filepath.Join(dir, "qbee-example.list"))
+	if err != nil {
+		t.Fatalf("error reading repository file: %v", err)
+	}
+
+	if string(content) != repo.URL {
+		t.Errorf("repository file content = %q, want %q", content, repo.URL)
+	}
+
+	// failed index refresh restores the previous definition, so the change is applied again on the next run
+	if err = backup.restore(); err != nil {
+		t.Fatalf("restore() error = %v", err)
+	}
+
+	if content, err = os.ReadFile(filepath.Join(dir, "qbee-example.list")); err != nil {
+		t.Fatalf("error reading repository file: %v", err)
+	}
+
+	if string(content) != "https://example.com/v1" {
+		t.Errorf("restored repository file content = %q", content)
+	}
+
+	if changes, _, err = configureRepositories([]Repository{repo}, render); err != nil || len(changes) != 1 {
+		t.Errorf("configureRepositories() = %v, %v, expected repository to be updated again", changes, err)
+	}
+
+	// added repository is removed on restore
+	newRepo := Repository{Name: "new", URL: "https://example.com/new"}
+	if _, backup, err = configureRepositories([]Repository{newRepo}, render); err != nil {
+		t.Fatalf("configureRepositories() error = %v", err)
+	}
+
+	if err = backup.restore(); err != nil {
+		t.Fatalf("restore() error = %v", err)
+	}
+
+	if _, err = os.Stat(filepath.Join(dir, "qbee-new.list")); !os.IsNotExist(err) {
+		t.Errorf("expected added repository file to be removed, got %v", err)
+	}
+}
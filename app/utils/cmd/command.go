@@ -185,7 +185,11 @@ func (cmd Command) evaluateArgs(args []string, opts Options) ([]string, Options,
 					return nil, nil, fmt.Errorf("value required for %s", arg)
 				}
 
-				opts[opt.Name] = args[i]
+				if previous, isSet := opts[opt.Name]; opt.Repeatable && isSet {
+					opts[opt.Name] = previous + "," + args[i]
+				} else {
+					opts[opt.Name] = args[i]
+				}
 			}
 		} else {
 			args = args[i:]
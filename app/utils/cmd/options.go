@@ -18,6 +18,9 @@ type Option struct {
 	// It won't consume value argument.
 	Flag string
 
+	// Repeatable option can be provided multiple times. Values are joined with a comma.
+	Repeatable bool
+
 	// Required option. If no value is set, help message will be displayed.
 	Required bool
 
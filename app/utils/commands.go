@@ -21,6 +21,7 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"io"
 	"os/exec"
 	"runtime"
 	"syscall"
@@ -29,13 +30,23 @@ import (
 
 // RunCommand runs a command and returns its output.
 func RunCommand(ctx context.Context, cmd []string) ([]byte, error) {
+	return RunCommandWithStdin(ctx, cmd, nil)
+}
+
+// RunCommandWithStdin runs a command with provided stdin and returns its output.
+// Use it to pass sensitive data (e.g. passwords) which shouldn't be visible in the command's arguments.
+func RunCommandWithStdin(ctx context.Context, cmd []string, stdin io.Reader) ([]byte, error) {
 	command := NewCommand(ctx, cmd)
+	command.Stdin = stdin
 
+	start := time.Now()
 	output, err := command.Output()
+	TraceCommand(ctx, command, start)
+
 	if err != nil {
 		exitError := new(exec.ExitError)
 		if errors.As(err, &exitError) {
-			return nil, fmt.Errorf("error running command %v: %w\n%s", cmd, err, exitError.Stderr)
+			return nil, &CommandError{Cmd: cmd, Err: err, Stdout: output, Stderr: exitError.Stderr}
 		}
 
 		return nil, fmt.Errorf("error running command %v: %w", cmd, err)
@@ -43,6 +54,76 @@ func RunCommand(ctx context.Context, cmd []string) ([]byte, error) {
 	return output, nil
 }
 
+// CommandError is returned when a command exits with a non-zero status.
+// It keeps the command's output, so callers can inspect what the command reported on stdout as well.
+type CommandError struct {
+	// Cmd is the failed command.
+	Cmd []string
+
+	// Err is the error returned when running the command.
+	Err error
+
+	// Stdout produced by the command.
+	Stdout []byte
+
+	// Stderr produced by the command.
+	Stderr []byte
+}
+
+// Error returns error message with the command's stderr.
+func (err *CommandError) Error() string {
+	return fmt.Sprintf("error running command %v: %v\n%s", err.Cmd, err.Err, err.Stderr)
+}
+
+// Unwrap returns the underlying error.
+func (err *CommandError) Unwrap() error {
+	return err.Err
+}
+
+// RunCommandStreaming runs a command with provided stdin (can be nil) and runs fn for every line of the stdout
+// as soon as it's produced. When fn returns an error, the command is killed and the error is returned.
+func RunCommandStreaming(ctx context.Context, cmd []string, stdin io.Reader, fn func(string) error) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	command := NewCommand(ctx, cmd)
+	command.Stdin = stdin
+
+	stderr := new(bytes.Buffer)
+	command.Stderr = stderr
+
+	stdout, err := command.StdoutPipe()
+	if err != nil {
+		return fmt.Errorf("error running command %v: %w", cmd, err)
+	}
+
+	start := time.Now()
+	if err = command.Start(); err != nil {
+		return fmt.Errorf("error running command %v: %w", cmd, err)
+	}
+
+	if err = ForLines(stdout, fn); err != nil {
+		// output is no longer processed, so there is no point in running the command further
+		cancel()
+	}
+
+	// make sure the command is not blocked on writing output which wasn't consumed
+	_, _ = io.Copy(io.Discard, stdout)
+
+	waitErr := command.Wait()
+	TraceCommand(ctx, command, start)
+
+	if err != nil {
+		return fmt.Errorf("error running command %v: %w", cmd, err)
+	}
+
+	if waitErr != nil {
+		return fmt.Errorf("error running command %v: %w\n%s", cmd, waitErr, stderr.Bytes())
+	}
+
+	return nil
+}
+
 // NewCommand creates a new exec.Cmd with the given context and command.
 func NewCommand(ctx context.Context, cmd []string) *exec.Cmd {
 	command := exec.CommandContext(ctx, cmd[0], cmd[1:]...)
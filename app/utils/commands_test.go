@@ -18,6 +18,9 @@ package utils
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"os/exec"
 	"strings"
 	"testing"
 	"time"
@@ -139,3 +142,79 @@ func TestParseCommandLine(t *testing.T) {
 		})
 	}
 }
+
+func TestRunCommandWithStdin(t *testing.T) {
+	output, err := RunCommandWithStdin(context.Background(), []string{"cat"}, strings.NewReader("s3cr3t"))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if string(output) != "s3cr3t" {
+		t.Fatalf("unexpected output: %q", output)
+	}
+}
+
+func TestRunCommandStreaming(t *testing.T) {
+	t.Run("all lines processed", func(t *testing.T) {
+		var lines []string
+		err := RunCommandStreaming(context.Background(), []string{"cat"}, strings.NewReader("a\nb\n"), func(line string) error {
+			lines = append(lines, line)
+			return nil
+		})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		if strings.Join(lines, ",") != "a,b" {
+			t.Fatalf("unexpected lines: %v", lines)
+		}
+	})
+
+	t.Run("command killed on callback error", func(t *testing.T) {
+		start := time.Now()
+		cmd := []string{"sh", "-c", "while true; do echo 'hello'; sleep 0.1; done"}
+		err := RunCommandStreaming(context.Background(), cmd, nil, func(line string) error {
+			return fmt.Errorf("stop")
+		})
+
+		if err == nil || !strings.Contains(err.Error(), "stop") {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		if elapsed := time.Since(start); elapsed.Seconds() > 2 {
+			t.Fatalf("unexpected elapsed time: %v", elapsed)
+		}
+	})
+
+	t.Run("failed command", func(t *testing.T) {
+		err := RunCommandStreaming(context.Background(), []string{"sh", "-c", "echo failure >&2; exit 1"}, nil,
+			func(line string) error { return nil })
+
+		if err == nil || !strings.Contains(err.Error(), "exit status 1\nfailure") {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	})
+}
+
+func TestRunCommand_CommandError(t *testing.T) {
+	cmd := []string{"sh", "-c", "echo out; echo err >&2; exit 3"}
+
+	_, err := RunCommand(context.Background(), cmd)
+
+	var cmdErr *CommandError
+	if !errors.As(err, &cmdErr) {
+		t.Fatalf("expected CommandError, got %v", err)
+	}
+
+	if string(cmdErr.Stdout) != "out\n" || string(cmdErr.Stderr) != "err\n" {
+		t.Fatalf("unexpected output: stdout = %q, stderr = %q", cmdErr.Stdout, cmdErr.Stderr)
+	}
+
+	if expected := fmt.Sprintf("error running command %v: exit status 3\nerr\n", cmd); err.Error() != expected {
+		t.Fatalf("unexpected error message: %q", err.Error())
+	}
+
+	if !errors.As(err, new(*exec.ExitError)) {
+		t.Fatalf("expected ExitError to be unwrapped from %v", err)
+	}
+}
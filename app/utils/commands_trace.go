@@ -0,0 +1,57 @@
+// Copyright 2023 qbee.io
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package utils
+
+import (
+	"context"
+	"os/exec"
+	"strings"
+	"time"
+
+	"go.qbee.io/agent/app/log"
+)
+
+type contextKey string
+
+const ctxRedactor = contextKey("utils:redactor")
+
+// WithRedactor returns context with a function redacting secrets from traced command lines.
+func WithRedactor(ctx context.Context, redact func(string) string) context.Context {
+	return context.WithValue(ctx, ctxRedactor, redact)
+}
+
+// TraceCommand logs finished command with its working directory, exit code and duration at TRACE level.
+// Command line is redacted using the redactor set in context (see WithRedactor).
+func TraceCommand(ctx context.Context, command *exec.Cmd, start time.Time) {
+	if !log.Enabled(log.TRACE) {
+		return
+	}
+
+	commandLine := strings.Join(command.Args, " ")
+	if redact, ok := ctx.Value(ctxRedactor).(func(string) string); ok {
+		commandLine = redact(commandLine)
+	}
+
+	// exit code is -1 when the command couldn't be started or was terminated by a signal
+	exitCode := -1
+	if command.ProcessState != nil {
+		exitCode = command.ProcessState.ExitCode()
+	}
+
+	log.Tracef("command [%s] in %s exited with code %d after %s",
+		commandLine, command.Dir, exitCode, time.Since(start).Round(time.Millisecond))
+}
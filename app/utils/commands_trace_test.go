@@ -0,0 +1,57 @@
+// Copyright 2023 qbee.io
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package utils
+
+import (
+	"bytes"
+	"context"
+	stdlog "log"
+	"os"
+	"strings"
+	"testing"
+
+	"go.qbee.io/agent/app/log"
+)
+
+func TestTraceCommand(t *testing.T) {
+	buffer := new(bytes.Buffer)
+	stdlog.SetOutput(buffer)
+	log.SetLevel(log.TRACE)
+
+	defer func() {
+		stdlog.SetOutput(os.Stderr)
+		log.SetLevel(log.INFO)
+	}()
+
+	ctx := WithRedactor(context.Background(), func(s string) string {
+		return strings.ReplaceAll(s, "s3cr3t", "********")
+	})
+
+	if _, err := RunCommand(ctx, []string{"sh", "-c", "echo s3cr3t; exit 3"}); err == nil {
+		t.Fatalf("expected error")
+	}
+
+	got := buffer.String()
+	expected := "[TRACE] command [sh -c echo ********; exit 3] in / exited with code 3 after "
+	if !strings.Contains(got, expected) {
+		t.Fatalf("expected %q in log, got %q", expected, got)
+	}
+
+	if strings.Contains(got, "s3cr3t") {
+		t.Fatalf("secret not redacted: %q", got)
+	}
+}
@@ -20,8 +20,10 @@ import (
 	"archive/tar"
 	"compress/bzip2"
 	"compress/gzip"
+	"errors"
 	"fmt"
 	"io"
+	"io/fs"
 	"os"
 	"path/filepath"
 	"strings"
@@ -29,9 +31,16 @@ import (
 
 // UnpackTar unpacks a tar archive to a destination directory.
 func UnpackTar(tarPath string, destPath string) error {
+	_, err := UnpackTarFiles(tarPath, destPath)
+	return err
+}
+
+// UnpackTarFiles unpacks a tar archive to a destination directory and returns paths of unpacked entries
+// relative to the destination directory.
+func UnpackTarFiles(tarPath string, destPath string) ([]string, error) {
 	tarFile, err := os.Open(tarPath)
 	if err != nil {
-		return err
+		return nil, err
 	}
 	defer tarFile.Close()
 
@@ -44,12 +53,12 @@ func UnpackTar(tarPath string, destPath string) error {
 	case "tar.gz":
 		gzReader, err := gzip.NewReader(tarFile)
 		if err != nil {
-			return err
+			return nil, err
 		}
 		defer gzReader.Close()
 		return unpackTar(gzReader, destPath)
 	default:
-		return fmt.Errorf("unsupported tar format: %s", tarPath)
+		return nil, fmt.Errorf("unsupported tar format: %s", tarPath)
 	}
 }
 
@@ -63,9 +72,20 @@ func IsSupportedTarExtension(tarPath string) bool {
 	}
 }
 
+// supportedTarExtensions lists extensions of supported tar formats, from the most specific.
+var supportedTarExtensions = []string{"tar.gz", "tar.bz2", "tar"}
+
 // GetTarExtension returns the extension of a tar file.
 func GetTarExtension(tarPath string) string {
 	basename := filepath.Base(tarPath)
+
+	// supported extensions are matched as suffixes, so dots in versioned names (e.g. app-1.2.tar.gz) are allowed
+	for _, extension := range supportedTarExtensions {
+		if strings.HasSuffix(basename, "."+extension) {
+			return extension
+		}
+	}
+
 	parts := strings.Split(basename, ".")
 	if len(parts) < 2 {
 		return ""
@@ -73,9 +93,22 @@ func GetTarExtension(tarPath string) string {
 	return strings.Join(parts[1:], ".")
 }
 
-// unpackTar unpacks a tar archive to a destination directory.
-func unpackTar(reader io.Reader, destPath string) error {
+// unpackTar unpacks a tar archive to a destination directory and returns paths of unpacked entries.
+// Entries are never written outside the destination directory, including through symbolic links.
+func unpackTar(reader io.Reader, destPath string) ([]string, error) {
+	destPath = filepath.Clean(destPath)
+
+	if err := os.MkdirAll(destPath, 0755); err != nil {
+		return nil, err
+	}
+
+	realDestPath, err := filepath.EvalSymlinks(destPath)
+	if err != nil {
+		return nil, err
+	}
+
 	tarReader := tar.NewReader(reader)
+	entries := make([]string, 0)
 
 	for {
 		header, err := tarReader.Next()
@@ -83,27 +116,149 @@ func unpackTar(reader io.Reader, destPath string) error {
 			break
 		}
 		if err != nil {
-			return err
+			return nil, err
 		}
 
 		targetPath := filepath.Join(destPath, header.Name)
 
+		// prevent archive entries from being written outside the destination directory
+		if !isWithinDirectory(targetPath, destPath) {
+			return nil, fmt.Errorf("invalid path in archive: %s", header.Name)
+		}
+
 		switch header.Typeflag {
 		case tar.TypeDir:
-			if err := os.MkdirAll(targetPath, 0755); err != nil {
-				return err
+			if err = makeTarDirectory(targetPath, destPath, realDestPath); err != nil {
+				return nil, err
 			}
 		case tar.TypeReg:
-			targetFile, err := os.Create(targetPath)
+			if err = unpackTarFile(tarReader, targetPath, destPath, realDestPath, header.FileInfo().Mode().Perm()); err != nil {
+				return nil, err
+			}
+		case tar.TypeSymlink:
+			if err = unpackTarSymlink(header.Linkname, targetPath, destPath, realDestPath); err != nil {
+				return nil, err
+			}
+		default:
+			continue
+		}
+
+		if targetPath != destPath {
+			entries = append(entries, strings.TrimPrefix(targetPath, destPath+string(os.PathSeparator)))
+		}
+	}
+
+	return entries, nil
+}
+
+// isWithinDirectory returns true if path is the directory itself or a path inside it.
+func isWithinDirectory(path, directory string) bool {
+	return path == directory || strings.HasPrefix(path, directory+string(os.PathSeparator))
+}
+
+// makeTarDirectory creates directory at path within destPath one component at a time,
+// so directories are never created through symbolic links pointing outside the destination directory.
+func makeTarDirectory(path, destPath, realDestPath string) error {
+	if path == destPath {
+		return nil
+	}
+
+	currentPath := destPath
+	for _, component := range strings.Split(strings.TrimPrefix(path, destPath+string(os.PathSeparator)), string(os.PathSeparator)) {
+		currentPath = filepath.Join(currentPath, component)
+
+		fileInfo, err := os.Lstat(currentPath)
+		if errors.Is(err, fs.ErrNotExist) {
+			if err = os.Mkdir(currentPath, 0755); err != nil {
+				return err
+			}
+			continue
+		}
+		if err != nil {
+			return err
+		}
+
+		if fileInfo.Mode()&fs.ModeSymlink != 0 {
+			realPath, err := filepath.EvalSymlinks(currentPath)
 			if err != nil {
 				return err
 			}
-			defer targetFile.Close()
 
-			if _, err := io.Copy(targetFile, tarReader); err != nil {
+			if !isWithinDirectory(realPath, realDestPath) {
+				return fmt.Errorf("invalid path in archive: %s points outside the destination directory", currentPath)
+			}
+
+			fileInfo, err = os.Stat(realPath)
+			if err != nil {
 				return err
 			}
 		}
+
+		if !fileInfo.IsDir() {
+			return fmt.Errorf("cannot create directory %s: %s is not a directory", path, currentPath)
+		}
 	}
+
 	return nil
 }
+
+// replaceTarEntry prepares path for a new archive entry. Parent directories are created
+// and existing symbolic link at path is removed, so the entry is not written through it.
+func replaceTarEntry(path, destPath, realDestPath string) error {
+	if err := makeTarDirectory(filepath.Dir(path), destPath, realDestPath); err != nil {
+		return err
+	}
+
+	if fileInfo, err := os.Lstat(path); err == nil && fileInfo.Mode()&fs.ModeSymlink != 0 {
+		return os.Remove(path)
+	}
+
+	return nil
+}
+
+// unpackTarFile writes a single regular file from the tar archive, preserving its permissions.
+func unpackTarFile(reader io.Reader, targetPath, destPath, realDestPath string, mode os.FileMode) error {
+	if err := replaceTarEntry(targetPath, destPath, realDestPath); err != nil {
+		return err
+	}
+
+	targetFile, err := os.OpenFile(targetPath, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, mode)
+	if err != nil {
+		return err
+	}
+	defer targetFile.Close()
+
+	if _, err := io.Copy(targetFile, reader); err != nil {
+		return err
+	}
+
+	return targetFile.Chmod(mode)
+}
+
+// unpackTarSymlink creates a symbolic link from the tar archive.
+// Only relative links pointing within the destination directory are allowed.
+func unpackTarSymlink(linkName, targetPath, destPath, realDestPath string) error {
+	if filepath.IsAbs(linkName) {
+		return fmt.Errorf("invalid symbolic link in archive: %s points to absolute path %s", targetPath, linkName)
+	}
+
+	if err := replaceTarEntry(targetPath, destPath, realDestPath); err != nil {
+		return err
+	}
+
+	// link is resolved from the real parent directory, since the parent path may contain other symbolic links
+	realParent, err := filepath.EvalSymlinks(filepath.Dir(targetPath))
+	if err != nil {
+		return err
+	}
+
+	if !isWithinDirectory(filepath.Join(realParent, linkName), realDestPath) {
+		return fmt.Errorf("invalid symbolic link in archive: %s points outside the destination directory", targetPath)
+	}
+
+	if err = os.Remove(targetPath); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+
+	return os.Symlink(linkName, targetPath)
+}
@@ -16,7 +16,12 @@
 
 package utils
 
-import "testing"
+import (
+	"archive/tar"
+	"os"
+	"path/filepath"
+	"testing"
+)
 
 func Test_GetExtension(t *testing.T) {
 	tests := []struct {
@@ -44,6 +49,11 @@ func Test_GetExtension(t *testing.T) {
 			path: "file:///path/to/file.tar.gz",
 			want: "tar.gz",
 		},
+		{
+			name: "versioned name",
+			path: "/path/to/app-1.2.3.tar.bz2",
+			want: "tar.bz2",
+		},
 	}
 
 	for _, tt := range tests {
@@ -54,3 +64,140 @@ func Test_GetExtension(t *testing.T) {
 		})
 	}
 }
+
+// writeTestTar creates a tar archive with provided headers (regular files get their name as contents).
+func writeTestTar(t *testing.T, path string, headers []*tar.Header) {
+	archiveFile, err := os.Create(path)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer archiveFile.Close()
+
+	tarWriter := tar.NewWriter(archiveFile)
+
+	for _, header := range headers {
+		if header.Typeflag == tar.TypeReg {
+			header.Size = int64(len(header.Name))
+		}
+
+		if err = tarWriter.WriteHeader(header); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		if header.Typeflag == tar.TypeReg {
+			if _, err = tarWriter.Write([]byte(header.Name)); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+		}
+	}
+
+	if err = tarWriter.Close(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func TestUnpackTar(t *testing.T) {
+	archive := filepath.Join(t.TempDir(), "context.tar")
+	destPath := filepath.Join(t.TempDir(), "context")
+
+	// typical docker-compose build context
+	writeTestTar(t, archive, []*tar.Header{
+		{Name: "./", Typeflag: tar.TypeDir, Mode: 0755},
+		{Name: "./Dockerfile", Typeflag: tar.TypeReg, Mode: 0644},
+		{Name: "./app/", Typeflag: tar.TypeDir, Mode: 0755},
+		{Name: "./app/run.sh", Typeflag: tar.TypeReg, Mode: 0755},
+		{Name: "./app/current", Typeflag: tar.TypeSymlink, Linkname: "run.sh"},
+		{Name: "./config", Typeflag: tar.TypeSymlink, Linkname: "app"},
+		{Name: "./config/settings.json", Typeflag: tar.TypeReg, Mode: 0600},
+	})
+
+	if err := UnpackTar(archive, destPath); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	for path, wantContents := range map[string]string{
+		"Dockerfile":           "./Dockerfile",
+		"app/current":          "./app/run.sh",
+		"app/settings.json":    "./config/settings.json",
+		"app/run.sh":           "./app/run.sh",
+		"config/settings.json": "./config/settings.json",
+	} {
+		contents, err := os.ReadFile(filepath.Join(destPath, path))
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		if string(contents) != wantContents {
+			t.Errorf("unexpected contents of %s: %s", path, contents)
+		}
+	}
+
+	fileInfo, err := os.Stat(filepath.Join(destPath, "app", "run.sh"))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if fileInfo.Mode().Perm() != 0755 {
+		t.Errorf("unexpected mode of run.sh: %s", fileInfo.Mode())
+	}
+}
+
+func TestUnpackTar_Escape(t *testing.T) {
+	tests := []struct {
+		name    string
+		headers []*tar.Header
+	}{
+		{
+			name:    "path traversal",
+			headers: []*tar.Header{{Name: "../escaped", Typeflag: tar.TypeReg, Mode: 0644}},
+		},
+		{
+			name:    "absolute symlink",
+			headers: []*tar.Header{{Name: "link", Typeflag: tar.TypeSymlink, Linkname: "/etc"}},
+		},
+		{
+			name:    "symlink outside",
+			headers: []*tar.Header{{Name: "dir/link", Typeflag: tar.TypeSymlink, Linkname: "../../outside"}},
+		},
+		{
+			name: "symlink outside through another symlink",
+			headers: []*tar.Header{
+				{Name: "a/b/", Typeflag: tar.TypeDir, Mode: 0755},
+				{Name: "a/b/up", Typeflag: tar.TypeSymlink, Linkname: ".."},
+				{Name: "a/b/up/link", Typeflag: tar.TypeSymlink, Linkname: "../.."},
+			},
+		},
+		{
+			name: "file written through replaced symlink",
+			headers: []*tar.Header{
+				{Name: "a/", Typeflag: tar.TypeDir, Mode: 0755},
+				{Name: "a/up", Typeflag: tar.TypeSymlink, Linkname: ".."},
+				{Name: "a/up/up", Typeflag: tar.TypeSymlink, Linkname: ".."},
+				{Name: "a/up/up/escaped", Typeflag: tar.TypeReg, Mode: 0644},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			archive := filepath.Join(t.TempDir(), "archive.tar")
+			parentPath := t.TempDir()
+			destPath := filepath.Join(parentPath, "dest")
+
+			writeTestTar(t, archive, tt.headers)
+
+			if err := UnpackTar(archive, destPath); err == nil {
+				t.Fatalf("expected error")
+			}
+
+			entries, err := os.ReadDir(parentPath)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if len(entries) != 1 {
+				t.Fatalf("unexpected entries outside the destination directory: %v", entries)
+			}
+		})
+	}
+}
@@ -10,6 +10,7 @@ require (
 	go.qbee.io/transport v1.24.33
 	golang.org/x/sys v0.28.0
 	google.golang.org/protobuf v1.33.0
+	lukechampine.com/blake3 v1.4.1
 )
 
 require (
@@ -18,6 +19,7 @@ require (
 	github.com/google/go-tdx-guest v0.2.3-0.20231011100059-4cf02bed9d33 // indirect
 	github.com/google/logger v1.1.1 // indirect
 	github.com/google/uuid v1.3.1 // indirect
+	github.com/klauspost/cpuid/v2 v2.0.12 // indirect
 	github.com/pborman/uuid v1.2.1 // indirect
 	github.com/pkg/errors v0.9.1 // indirect
 	golang.org/x/crypto v0.31.0 // indirect